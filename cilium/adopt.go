@@ -0,0 +1,186 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type valueKind int
+
+const (
+	boolValue valueKind = iota
+	intValue
+	stringValue
+)
+
+// agentSetting is a key of the cilium-config ConfigMap along with the chart
+// value it is rendered from
+type agentSetting struct {
+	path string
+	kind valueKind
+}
+
+// agentSettings is the typed configuration model of the agents: the keys of
+// the cilium-config ConfigMap which the adapter imports into the chart values
+// when it adopts an installation it did not create
+var agentSettings = map[string]agentSetting{
+	"enable-ipv4":                  {"ipv4.enabled", boolValue},
+	"enable-ipv6":                  {"ipv6.enabled", boolValue},
+	"cluster-name":                 {"cluster.name", stringValue},
+	"cluster-id":                   {"cluster.id", intValue},
+	"ipam":                         {"ipam.mode", stringValue},
+	"tunnel":                       {"tunnel", stringValue},
+	"routing-mode":                 {"routingMode", stringValue},
+	"tunnel-protocol":              {"tunnelProtocol", stringValue},
+	"auto-direct-node-routes":      {"autoDirectNodeRoutes", boolValue},
+	"ipv4-native-routing-cidr":     {"ipv4NativeRoutingCIDR", stringValue},
+	"enable-endpoint-routes":       {"endpointRoutes.enabled", boolValue},
+	"kube-proxy-replacement":       {"kubeProxyReplacement", stringValue},
+	"enable-bpf-masquerade":        {"bpf.masquerade", boolValue},
+	"monitor-aggregation":          {"bpf.monitorAggregation", stringValue},
+	"enable-ipv4-egress-gateway":   {"egressGateway.enabled", boolValue},
+	"enable-hubble":                {"hubble.enabled", boolValue},
+	"enable-l7-proxy":              {"l7Proxy", boolValue},
+	"enable-policy":                {"policyEnforcementMode", stringValue},
+	"enable-host-firewall":         {"hostFirewall.enabled", boolValue},
+	"enable-local-redirect-policy": {"localRedirectPolicy", boolValue},
+	"enable-ingress-controller":    {"ingressController.enabled", boolValue},
+	"enable-health-checking":       {"healthChecking", boolValue},
+	"debug":                        {"debug.enabled", boolValue},
+}
+
+// deprecatedAgentSettings are the keys still understood by some Cilium
+// versions along with what replaces them
+var deprecatedAgentSettings = map[string]string{
+	"tunnel":                       "routing-mode and tunnel-protocol since Cilium 1.14",
+	"native-routing-cidr":          "ipv4-native-routing-cidr since Cilium 1.11",
+	"enable-remote-node-identity":  "always enabled since Cilium 1.15",
+	"blacklist-conflicting-routes": "removed in Cilium 1.12",
+	"enable-legacy-services":       "removed in Cilium 1.11",
+}
+
+// DeprecatedSetting is a key of the live configuration which is deprecated
+type DeprecatedSetting struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Replacement string `json:"replacement"`
+}
+
+// AdoptionReport describes how the live configuration of an installation
+// the adapter did not create was imported
+type AdoptionReport struct {
+	Version string `json:"version"`
+	// Imported are the chart values derived from the live configuration
+	Imported map[string]interface{} `json:"imported"`
+	// Unknown keys are not part of the model, the chart renders them
+	// from its defaults on the next reconfiguration
+	Unknown    []string            `json:"unknown,omitempty"`
+	Deprecated []DeprecatedSetting `json:"deprecated,omitempty"`
+	// Invalid keys hold values which don't match the type of the model
+	Invalid []string `json:"invalid,omitempty"`
+}
+
+func (r *AdoptionReport) String() string {
+	return fmt.Sprintf("adopted Cilium %s: %d settings imported, %d unknown, %d deprecated, %d invalid",
+		r.Version, len(r.Imported), len(r.Unknown), len(r.Deprecated), len(r.Invalid))
+}
+
+// importAgentConfig converts the cilium-config ConfigMap into chart values
+func importAgentConfig(cfg map[string]string) (map[string]interface{}, *AdoptionReport) {
+	values := map[string]interface{}{}
+	report := &AdoptionReport{Imported: map[string]interface{}{}}
+
+	for key, raw := range cfg {
+		if replacement, ok := deprecatedAgentSettings[key]; ok {
+			report.Deprecated = append(report.Deprecated, DeprecatedSetting{Key: key, Value: raw, Replacement: replacement})
+		}
+
+		setting, ok := agentSettings[key]
+		if key == "enable-wireguard" || key == "enable-ipsec" {
+			// Imported below
+			continue
+		}
+		if !ok {
+			if _, deprecated := deprecatedAgentSettings[key]; !deprecated {
+				report.Unknown = append(report.Unknown, key)
+			}
+			continue
+		}
+
+		var value interface{}
+		switch setting.kind {
+		case boolValue:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				report.Invalid = append(report.Invalid, fmt.Sprintf("%s=%q: expected a boolean", key, raw))
+				continue
+			}
+			value = b
+		case intValue:
+			i, err := strconv.Atoi(raw)
+			if err != nil {
+				report.Invalid = append(report.Invalid, fmt.Sprintf("%s=%q: expected an integer", key, raw))
+				continue
+			}
+			value = i
+		default:
+			value = raw
+		}
+		setValue(values, setting.path, value)
+		report.Imported[setting.path] = value
+	}
+
+	// Encryption is rendered as a flag per type
+	switch {
+	case cfg["enable-wireguard"] == "true":
+		setValue(values, "encryption.enabled", true)
+		setValue(values, "encryption.type", "wireguard")
+		report.Imported["encryption.type"] = "wireguard"
+	case cfg["enable-ipsec"] == "true":
+		setValue(values, "encryption.enabled", true)
+		setValue(values, "encryption.type", "ipsec")
+		report.Imported["encryption.type"] = "ipsec"
+	}
+
+	sort.Strings(report.Unknown)
+	sort.Strings(report.Invalid)
+	sort.Slice(report.Deprecated, func(i, j int) bool { return report.Deprecated[i].Key < report.Deprecated[j].Key })
+	return values, report
+}
+
+// adoptRelease imports the live configuration of a Cilium installation the
+// adapter did not create, so that the first reconfiguration upgrades the
+// release from its actual state instead of the chart defaults
+func (h *Handler) adoptRelease(ctx context.Context, state *releaseState) error {
+	version, err := h.installedCiliumVersion(ctx)
+	if err != nil {
+		return err
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	values, report := importAgentConfig(cfg)
+	report.Version = version
+	state.Version = version
+	mergeValues(values, state.Values)
+	state.Values = values
+	state.Adopted = report
+
+	h.Log.Info(report.String())
+	if len(report.Deprecated) > 0 {
+		var keys []string
+		for _, d := range report.Deprecated {
+			keys = append(keys, fmt.Sprintf("%s (%s)", d.Key, d.Replacement))
+		}
+		h.Log.Info("deprecated cilium-config keys: ", strings.Join(keys, ", "))
+	}
+	if len(report.Invalid) > 0 {
+		h.Log.Info("invalid cilium-config values not imported: ", strings.Join(report.Invalid, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cilium
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	ciliumAgentSelector  = "k8s-app=cilium"
+	ciliumAgentContainer = "cilium-agent"
+)
+
+// agentPod returns the name of the Cilium agent pod running on a node
+func (h *Handler) agentPod(ctx context.Context, node string) (string, error) {
+	if h.KubeClient == nil {
+		return "", ErrNilClient
+	}
+
+	pods, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: ciliumAgentSelector,
+		FieldSelector: "spec.nodeName=" + node,
+	})
+	if err != nil {
+		return "", ErrAgentExec(err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			return pod.Name, nil
+		}
+	}
+	return "", ErrAgentExec(fmt.Errorf("no running Cilium agent on node %s", node))
+}
+
+// execInAgent runs a command in the Cilium agent container of the given
+// pod and returns its output
+func (h *Handler) execInAgent(pod string, command []string) (string, error) {
+	return h.execInPod(ciliumNamespace, pod, ciliumAgentContainer, command)
+}
+
+// execInPod runs a command in a container of a pod and returns its output
+func (h *Handler) execInPod(namespace, pod, container string, command []string) (string, error) {
+	if h.KubeClient == nil {
+		return "", ErrNilClient
+	}
+
+	req := h.KubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(&h.RestConfig, "POST", req.URL())
+	if err != nil {
+		return "", ErrAgentExec(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := executor.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return stdout.String(), ErrAgentExec(fmt.Errorf("%s in %s: %s %s", strings.Join(command, " "), pod, err, stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,208 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	crdEstablishInterval = time.Second
+	crdEstablishTimeout  = time.Minute
+)
+
+var (
+	documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+	crdResource = schema.GroupVersionResource{
+		Group:    "apiextensions.k8s.io",
+		Version:  "v1",
+		Resource: "customresourcedefinitions",
+	}
+
+	// kindRanks orders the resources of a manifest so that every resource
+	// is created after the resources it depends on. Kinds which are not
+	// listed are treated as custom resources and applied last.
+	kindRanks = map[string]int{
+		"CustomResourceDefinition": 0,
+
+		"Namespace": 1,
+
+		"ServiceAccount":     2,
+		"ClusterRole":        2,
+		"ClusterRoleBinding": 2,
+		"Role":               2,
+		"RoleBinding":        2,
+
+		"ConfigMap":             3,
+		"Secret":                3,
+		"PersistentVolumeClaim": 3,
+		"Service":               3,
+
+		"Deployment":  4,
+		"DaemonSet":   4,
+		"StatefulSet": 4,
+		"ReplicaSet":  4,
+		"Job":         4,
+		"CronJob":     4,
+		"Pod":         4,
+	}
+	customResourceRank = 5
+)
+
+// manifestDocument is a single resource of a multi-document manifest
+type manifestDocument struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Contents  string
+	rank      int
+}
+
+// splitManifest breaks a multi-document manifest into its resources,
+// skipping empty documents
+func splitManifest(contents []byte) ([]manifestDocument, error) {
+	var docs []manifestDocument
+	for _, raw := range documentSeparator.Split(string(contents), -1) {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+
+		var meta struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(raw), &meta); err != nil {
+			return nil, err
+		}
+		if meta.Kind == "" {
+			continue
+		}
+
+		rank, ok := kindRanks[meta.Kind]
+		if !ok {
+			rank = customResourceRank
+		}
+		docs = append(docs, manifestDocument{
+			Kind:      meta.Kind,
+			Namespace: meta.Metadata.Namespace,
+			Name:      meta.Metadata.Name,
+			Contents:  raw,
+			rank:      rank,
+		})
+	}
+	return docs, nil
+}
+
+// applyOrdered applies a multi-document manifest in dependency order:
+// CRDs, namespaces, RBAC, configuration, workloads and finally custom
+// resources. Custom resources are only applied once the CRDs of the same
+// manifest are established. Deletion happens in the reverse order.
+func (h *Handler) applyOrdered(ctx context.Context, contents []byte, isDel bool, namespace string) error {
+	kclient := h.MesheryKubeclient
+	if kclient == nil {
+		return ErrNilClient
+	}
+
+	docs, err := splitManifest(contents)
+	if err != nil {
+		return ErrApplyManifest(err)
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		if isDel {
+			return docs[i].rank > docs[j].rank
+		}
+		return docs[i].rank < docs[j].rank
+	})
+
+	labels := environmentFrom(ctx)
+
+	var crds []string
+	for i, doc := range docs {
+		// Wait for the CRDs before moving past them
+		if !isDel && len(crds) > 0 && doc.rank > 0 && docs[i-1].rank == 0 {
+			if err := h.waitForCRDs(ctx, crds); err != nil {
+				return ErrApplyManifest(err)
+			}
+		}
+
+		if len(labels) > 0 && !isDel {
+			if doc.Contents, err = labelDocument(doc.Contents, labels); err != nil {
+				return ErrApplyManifest(err)
+			}
+		}
+
+		if err := kclient.ApplyManifest([]byte(doc.Contents), mesherykube.ApplyOptions{
+			Namespace: namespace,
+			Update:    true,
+			Delete:    isDel,
+		}); err != nil {
+			return ErrApplyManifest(fmt.Errorf("%s %q: %s", doc.Kind, doc.Name, err))
+		}
+		ns := doc.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		recordRendered(ctx, doc.Kind, ns, doc.Name, []byte(doc.Contents), isDel)
+		noteResource(ctx, doc.Kind, ns, doc.Name)
+
+		if doc.rank == 0 {
+			crds = append(crds, doc.Name)
+		}
+	}
+
+	return nil
+}
+
+// waitForCRDs blocks until all of the named CRDs report the Established condition
+func (h *Handler) waitForCRDs(ctx context.Context, names []string) error {
+	if h.DynamicKubeClient == nil {
+		return ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, crdEstablishTimeout)
+	defer cancel()
+
+	for _, name := range names {
+		err := wait.PollImmediateUntil(crdEstablishInterval, func() (bool, error) {
+			crd, err := h.DynamicKubeClient.Resource(crdResource).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			return crdEstablished(crd), nil
+		}, ctx.Done())
+		if err != nil {
+			return fmt.Errorf("CustomResourceDefinition %q was not established: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cond["type"] == "Established" && cond["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
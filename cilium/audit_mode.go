@@ -0,0 +1,155 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// PolicyAuditModeTrait is the trait putting the endpoints selected by a
+// Cilium policy into policy audit mode
+const PolicyAuditModeTrait = "PolicyAuditMode"
+
+const podNamespaceLabel = "io.kubernetes.pod.namespace"
+
+var ciliumEndpointResource = schema.GroupVersionResource{
+	Group:    "cilium.io",
+	Version:  "v2",
+	Resource: "ciliumendpoints",
+}
+
+// handlePolicyAuditMode applies the PolicyAuditMode trait to a policy
+// component. In audit mode the agents log the verdicts of the policies
+// selecting an endpoint without dropping any traffic, so the audit mode
+// covers every policy selecting the same endpoints.
+func handlePolicyAuditMode(ctx context.Context, h *Handler, comp v1alpha1.Component, trait v1alpha1.ConfigurationSpecComponentTrait, isDel bool) (string, error) {
+	enable := !isDel
+	if enabled, ok := trait.Properties["enabled"].(bool); ok && !isDel {
+		enable = enabled
+	}
+
+	kind := getKindFromComponent(comp)
+	if _, ok := policyCRDs[kind]; !ok {
+		return "", ErrPolicyAuditMode(fmt.Errorf("%s only applies to Cilium policies, %q is a %s", PolicyAuditModeTrait, comp.Name, kind))
+	}
+
+	namespace := comp.Namespace
+	if kind == ciliumClusterwideNetworkPolicyKind {
+		namespace = ""
+	}
+	selector, namespace, err := podSelector(comp.Spec.Settings["endpointSelector"], namespace)
+	if err != nil {
+		return "", ErrPolicyAuditMode(err)
+	}
+
+	endpoints, err := h.selectedEndpoints(ctx, namespace, selector)
+	if err != nil {
+		return "", ErrPolicyAuditMode(err)
+	}
+
+	value := "Disabled"
+	if enable {
+		value = "Enabled"
+	}
+	count := 0
+	for node, ids := range endpoints {
+		pod, err := h.agentPod(ctx, node)
+		if err != nil {
+			return "", ErrPolicyAuditMode(err)
+		}
+		for _, id := range ids {
+			if _, err := h.execInAgent(pod, []string{"cilium", "endpoint", "config", id, "PolicyAuditMode=" + value}); err != nil {
+				return "", ErrPolicyAuditMode(err)
+			}
+			count++
+		}
+	}
+
+	state := "disabled"
+	if enable {
+		state = "enabled"
+	}
+	return fmt.Sprintf("policy audit mode %s on %d endpoints selected by %s \"%s\"", state, count, kind, comp.Name), nil
+}
+
+// podSelector converts a Cilium endpoint selector into a pod label
+// selector. Cilium prefixes the labels with their source, and selects the
+// namespace through a label, which is returned as the namespace to list.
+func podSelector(endpointSelector interface{}, namespace string) (string, string, error) {
+	if endpointSelector == nil {
+		return "", "", fmt.Errorf("the policy has no endpointSelector, host policies have no endpoints to audit")
+	}
+
+	byt, err := json.Marshal(endpointSelector)
+	if err != nil {
+		return "", "", err
+	}
+	sel := &metav1.LabelSelector{}
+	if err := json.Unmarshal(byt, sel); err != nil {
+		return "", "", err
+	}
+
+	matchLabels := map[string]string{}
+	for key, val := range sel.MatchLabels {
+		key = trimLabelSource(key)
+		if key == podNamespaceLabel {
+			namespace = val
+			continue
+		}
+		matchLabels[key] = val
+	}
+	sel.MatchLabels = matchLabels
+	for i := range sel.MatchExpressions {
+		sel.MatchExpressions[i].Key = trimLabelSource(sel.MatchExpressions[i].Key)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(sel)
+	if err != nil {
+		return "", "", err
+	}
+	return selector.String(), namespace, nil
+}
+
+func trimLabelSource(key string) string {
+	for _, source := range []string{"k8s:", "any:"} {
+		key = strings.TrimPrefix(key, source)
+	}
+	return key
+}
+
+// selectedEndpoints returns the IDs of the Cilium endpoints of the pods
+// matching selector, by node
+func (h *Handler) selectedEndpoints(ctx context.Context, namespace, selector string) (map[string][]string, error) {
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+
+	pods, err := h.KubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string][]string{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Spec.HostNetwork {
+			continue
+		}
+		ep, err := h.DynamicKubeClient.Resource(ciliumEndpointResource).Namespace(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			// Pods which are not managed by Cilium have no endpoint
+			continue
+		}
+		id, found, _ := unstructured.NestedInt64(ep.Object, "status", "id")
+		if !found {
+			continue
+		}
+		res[pod.Spec.NodeName] = append(res[pod.Spec.NodeName], fmt.Sprint(id))
+	}
+	return res, nil
+}
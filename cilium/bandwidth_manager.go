@@ -0,0 +1,140 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/layer5io/meshery-cilium/internal/probe"
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// EgressBandwidthTrait is the trait limiting the egress bandwidth of the
+// pods of a workload
+const EgressBandwidthTrait = "EgressBandwidth"
+
+// BandwidthManagerRequest is the body of the bandwidth manager operation
+type BandwidthManagerRequest struct {
+	// BBR switches the congestion control of the pods to BBR, which
+	// requires kernel 5.18 on every node
+	BBR bool `json:"bbr,omitempty"`
+}
+
+// configureBandwidthManager toggles the bandwidth manager of the agents,
+// which enforces the egress bandwidth annotations of the pods with EDT
+// rate limiting, optionally along with BBR. The kernel of the nodes is
+// checked first since the agents start without the feature otherwise.
+func (h *Handler) configureBandwidthManager(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	if h.KubeClient == nil {
+		return st, "", ErrNilClient
+	}
+
+	req := BandwidthManagerRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return st, "", ErrConfigureBandwidthManager(err)
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrConfigureBandwidthManager(err)
+	}
+
+	values := map[string]interface{}{}
+	if request.IsDeleteOperation {
+		setValue(values, "bandwidthManager.enabled", false)
+		setValue(values, "bandwidthManager.bbr", false)
+	} else {
+		if cfg["enable-bandwidth-manager"] == "true" && (cfg["enable-bbr"] == "true") == req.BBR {
+			return status.Applied, "bandwidth manager already configured, agents not restarted", nil
+		}
+		features := []string{probe.BandwidthManager}
+		if req.BBR {
+			features = append(features, probe.BBR)
+		}
+		if err := h.checkNodeKernels(ctx, features); err != nil {
+			return st, "", ErrConfigureBandwidthManager(err)
+		}
+		setValue(values, "bandwidthManager.enabled", true)
+		setValue(values, "bandwidthManager.bbr", req.BBR)
+	}
+
+	return h.toggleAgentFeature(ctx, request.IsDeleteOperation, values, ErrConfigureBandwidthManager)
+}
+
+// checkNodeKernels fails when the kernel of a node can't run one of the
+// features
+func (h *Handler) checkNodeKernels(ctx context.Context, features []string) error {
+	nodes, err := h.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var unsupported []string
+	for _, node := range nodes.Items {
+		matrix := probe.Evaluate(probe.Input{Node: node.Name, KernelVersion: node.Status.NodeInfo.KernelVersion})
+		for _, f := range features {
+			if c := matrix.Features[f]; !c.Supported {
+				unsupported = append(unsupported, fmt.Sprintf("%s on %s: %s", f, node.Name, c.Reason))
+			}
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("unsupported by the node kernels: %s", strings.Join(unsupported, "; "))
+	}
+	return nil
+}
+
+// handleEgressBandwidth applies the EgressBandwidth trait to a workload
+// component, annotating its pod template with the limit the bandwidth
+// manager enforces. The ingress bandwidth annotation is not enforced by
+// Cilium.
+func handleEgressBandwidth(ctx context.Context, h *Handler, comp v1alpha1.Component, trait v1alpha1.ConfigurationSpecComponentTrait, isDel bool) (string, error) {
+	kind := getKindFromComponent(comp)
+	if isDel {
+		return fmt.Sprintf("egress bandwidth of %s \"%s\" removed with the workload", kind, comp.Name), nil
+	}
+	namespace := comp.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	if h.KubeClient == nil {
+		return "", ErrNilClient
+	}
+
+	rate, _ := trait.Properties["rate"].(string)
+	if rate == "" {
+		return "", ErrWorkloadAnnotations(fmt.Errorf("%s of %q has no rate", EgressBandwidthTrait, comp.Name))
+	}
+	if _, err := resource.ParseQuantity(rate); err != nil {
+		return "", ErrWorkloadAnnotations(fmt.Errorf("%s: %s", egressBandwidthAnnotation, err))
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return "", ErrWorkloadAnnotations(err)
+	}
+	if cfg["enable-bandwidth-manager"] != "true" {
+		return "", ErrWorkloadAnnotations(fmt.Errorf("the bandwidth manager of the agents is disabled, the limit of %q would be ignored", comp.Name))
+	}
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, egressBandwidthAnnotation, rate))
+	for _, k := range workloadKinds {
+		if k.kind != kind {
+			continue
+		}
+		if err := k.patch(h, ctx, namespace, comp.Name, patch); err != nil {
+			return "", ErrWorkloadAnnotations(fmt.Errorf("%s %s/%s: %s", kind, namespace, comp.Name, err))
+		}
+		return fmt.Sprintf("egress bandwidth of %s \"%s\" limited to %s", kind, comp.Name, rate), nil
+	}
+	return "", ErrWorkloadAnnotations(fmt.Errorf("%s only applies to Deployments, StatefulSets and DaemonSets, %q is a %s", EgressBandwidthTrait, comp.Name, kind))
+}
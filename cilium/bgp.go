@@ -0,0 +1,73 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+)
+
+const (
+	ciliumBGPPeeringPolicyKind = "CiliumBGPPeeringPolicy"
+	ciliumBGPClusterConfigKind = "CiliumBGPClusterConfig"
+)
+
+// bgpControlPlaneEnabled reports whether the agents run the BGP control
+// plane reconciling the BGP resources
+func bgpControlPlaneEnabled(cfg map[string]string) bool {
+	return cfg["enable-bgp-control-plane"] == "true"
+}
+
+// configureBGPControlPlane toggles the BGP control plane of the agents,
+// which then peer with the routers selected by the BGP resources to
+// advertise the pod and load balancer CIDRs.
+func (h *Handler) configureBGPControlPlane(ctx context.Context, del bool) (string, string, error) {
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	version, err := h.ciliumVersion(ctx)
+	if err != nil {
+		return st, "", ErrConfigureBGP(err)
+	}
+	if !versionAtLeast(version, 1, 12) {
+		return st, "", ErrConfigureBGP(fmt.Errorf("the BGP control plane requires Cilium 1.12 or newer, %s is installed", version))
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrConfigureBGP(err)
+	}
+	if !del && bgpControlPlaneEnabled(cfg) {
+		return status.Applied, "BGP control plane already enabled, agents not restarted", nil
+	}
+
+	values := map[string]interface{}{}
+	setValue(values, "bgpControlPlane.enabled", !del)
+	return h.toggleAgentFeature(ctx, del, values, ErrConfigureBGP)
+}
+
+// checkBGPControlPlane fails the apply of a BGP resource early when the
+// agents would ignore it
+func (h *Handler) checkBGPControlPlane(ctx context.Context, kind string) error {
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return ErrConfigureBGP(err)
+	}
+	if !bgpControlPlaneEnabled(cfg) {
+		return ErrBGPControlPlaneDisabled
+	}
+	if kind != ciliumBGPClusterConfigKind {
+		return nil
+	}
+
+	// CiliumBGPClusterConfig superseded CiliumBGPPeeringPolicy in 1.16
+	version, err := h.installedCiliumVersion(ctx)
+	if err != nil {
+		return ErrConfigureBGP(err)
+	}
+	if !versionAtLeast(version, 1, 16) {
+		return ErrConfigureBGP(fmt.Errorf("%s requires Cilium 1.16 or newer, %s is installed, use %s instead", kind, version, ciliumBGPPeeringPolicyKind))
+	}
+	return nil
+}
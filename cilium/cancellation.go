@@ -0,0 +1,151 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	"sigs.k8s.io/yaml"
+)
+
+// runningOperation is an operation in flight, cancel stops its work
+type runningOperation struct {
+	id      string
+	name    string
+	started time.Time
+	cancel  context.CancelFunc
+	// cancelled is set once the operation is cancelled on request
+	cancelled bool
+	// parent is the operation running this one as a step, such as a
+	// pipeline
+	parent *runningOperation
+}
+
+type runningOperationKey struct{}
+
+// CancelRequest is the body of the cancel operation, it selects the
+// running operations by ID or by name
+type CancelRequest struct {
+	OperationID string `json:"operationId,omitempty"`
+	Operation   string `json:"operation,omitempty"`
+}
+
+// startOperation returns the context of an operation derived from parent,
+// cancelled when the adapter shuts down or when the operation, or the one
+// running it as a step, is cancelled on request, along with the function
+// to call once the operation completed
+func (h *Handler) startOperation(parent context.Context, request adapter.OperationRequest) (context.Context, *runningOperation, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	run := &runningOperation{
+		id:      request.OperationID,
+		name:    request.OperationName,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+	run.parent, _ = parent.Value(runningOperationKey{}).(*runningOperation)
+	ctx = context.WithValue(ctx, runningOperationKey{}, run)
+
+	l := h.lifecycle
+	l.mu.Lock()
+	l.running = append(l.running, run)
+	l.mu.Unlock()
+
+	return ctx, run, func() {
+		l.mu.Lock()
+		for i, r := range l.running {
+			if r == run {
+				l.running = append(l.running[:i], l.running[i+1:]...)
+				break
+			}
+		}
+		l.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelOperations cancels the running operations selected by req, except
+// for the operation self, and returns them
+func (l *lifecycle) cancelOperations(req CancelRequest, self string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var cancelled []string
+	for _, r := range l.running {
+		if r.id == self {
+			continue
+		}
+		if req.OperationID != "" && r.id != req.OperationID {
+			continue
+		}
+		if req.Operation != "" && r.name != req.Operation {
+			continue
+		}
+		r.cancelled = true
+		r.cancel()
+		cancelled = append(cancelled, fmt.Sprintf("%s (%s, running for %s)", r.name, r.id, time.Since(r.started).Round(time.Second)))
+	}
+	return cancelled
+}
+
+func (l *lifecycle) wasCancelled(run *runningOperation) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ; run != nil; run = run.parent {
+		if run.cancelled {
+			return true
+		}
+	}
+	return false
+}
+
+// operationTimeout returns the time the operation may run for, zero when
+// it runs until it completes
+func (h *Handler) operationTimeout(name string, op *adapter.Operation) (time.Duration, error) {
+	cfg, err := internalconfig.Timeouts(h.Config)
+	if err != nil {
+		return 0, err
+	}
+	return cfg.For(name, op), nil
+}
+
+// interruption returns why the operation run with ctx was interrupted, or
+// nil when it was not
+func (h *Handler) interruption(ctx context.Context, run *runningOperation, timeout time.Duration) error {
+	switch {
+	case ctx.Err() == nil:
+		return nil
+	case h.lifecycle.ctx.Err() != nil:
+		return ErrOperationCancelled(run.name, "the adapter is shutting down")
+	case h.lifecycle.wasCancelled(run):
+		return ErrOperationCancelled(run.name, "the operation was cancelled on request")
+	case ctx.Err() == context.DeadlineExceeded:
+		return ErrOperationTimedOut(run.name, timeout)
+	}
+	return ErrOperationCancelled(run.name, ctx.Err().Error())
+}
+
+// cancelOperations cancels the running operations selected by the body of
+// the request, their work stops and they stream their final event as
+// cancelled
+func (h *Handler) cancelOperations(request adapter.OperationRequest) (string, string, error) {
+	if request.IsDeleteOperation {
+		return "The cancellation cannot be deleted", "A cancelled operation is run again to resume it.", ErrOpInvalid
+	}
+	req := CancelRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return "Error while parsing the cancel request", err.Error(), ErrCancelOperation(err)
+	}
+	if req.OperationID == "" && req.Operation == "" {
+		err := ErrCancelOperation(fmt.Errorf("the operationId or the operation to cancel is required"))
+		return "Error while parsing the cancel request", err.Error(), err
+	}
+
+	cancelled := h.lifecycle.cancelOperations(req, request.OperationID)
+	if len(cancelled) == 0 {
+		return "No running operation to cancel", "No running operation matched the request.", nil
+	}
+	return fmt.Sprintf("%d operations cancelled", len(cancelled)), strings.Join(cancelled, "\n"), nil
+}
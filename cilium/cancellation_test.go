@@ -0,0 +1,47 @@
+package cilium
+
+import (
+	"testing"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+)
+
+func TestCancellingAPipelineCancelsItsStep(t *testing.T) {
+	h := &Handler{lifecycle: newLifecycle()}
+
+	ctx, pipeline, donePipeline := h.startOperation(h.lifecycle.ctx, adapter.OperationRequest{OperationID: "1", OperationName: "upgrade-and-test"})
+	defer donePipeline()
+	stepCtx, step, doneStep := h.startOperation(ctx, adapter.OperationRequest{OperationID: "1", OperationName: "cilium_connectivity_test"})
+	defer doneStep()
+
+	cancelled := h.lifecycle.cancelOperations(CancelRequest{Operation: "upgrade-and-test"}, "2")
+	if len(cancelled) != 1 {
+		t.Fatalf("cancelOperations() cancelled %v, want the pipeline", cancelled)
+	}
+	if stepCtx.Err() == nil {
+		t.Error("the step is still running once the pipeline is cancelled")
+	}
+	if !h.lifecycle.wasCancelled(step) {
+		t.Error("the step isn't reported as cancelled on request")
+	}
+	if !h.lifecycle.wasCancelled(pipeline) {
+		t.Error("the pipeline isn't reported as cancelled on request")
+	}
+}
+
+func TestCancellingAStepLeavesThePipelineRunning(t *testing.T) {
+	h := &Handler{lifecycle: newLifecycle()}
+
+	ctx, pipeline, donePipeline := h.startOperation(h.lifecycle.ctx, adapter.OperationRequest{OperationID: "1", OperationName: "upgrade-and-test"})
+	defer donePipeline()
+	stepCtx, _, doneStep := h.startOperation(ctx, adapter.OperationRequest{OperationID: "1", OperationName: "cilium_connectivity_test"})
+	defer doneStep()
+
+	h.lifecycle.cancelOperations(CancelRequest{Operation: "cilium_connectivity_test"}, "2")
+	if stepCtx.Err() == nil {
+		t.Error("the step is still running once it is cancelled")
+	}
+	if ctx.Err() != nil || h.lifecycle.wasCancelled(pipeline) {
+		t.Error("the pipeline is cancelled along with its step")
+	}
+}
@@ -16,9 +16,14 @@ package cilium
 
 import (
 	"context"
+	"path/filepath"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-cilium/cilium/oam"
+	"github.com/layer5io/meshery-cilium/internal/artifacts"
+	"github.com/layer5io/meshery-cilium/internal/cli"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshery-cilium/internal/gitops"
 	meshkitCfg "github.com/layer5io/meshkit/config"
 	"github.com/layer5io/meshkit/logger"
 	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
@@ -27,16 +32,66 @@ import (
 // Handler instance for this adapter
 type Handler struct {
 	adapter.Adapter
+
+	// Artifacts stores the files produced by operations
+	Artifacts *artifacts.Store
+
+	// Coordinator serializes the disruptive operations with the other
+	// Meshery adapters managing the cluster
+	Coordinator *oam.Coordinator
+
+	// GitOps exports the manifests applied by the operations, it is nil
+	// when the export is disabled
+	GitOps *gitops.Exporter
+
+	// contexts holds every Kubernetes context received from Meshery
+	contexts *kubeContexts
+	// kubeContext is the context of the cluster the handler works with,
+	// empty for the current context
+	kubeContext string
+
+	// lifecycle cancels and waits for the running operations on shutdown
+	lifecycle *lifecycle
+
+	// fences keeps a single mutating operation running per cluster
+	fences *clusterFences
+
+	// discovery holds the last discovery of the Cilium resources of the
+	// current context
+	discovery *discoveryCache
+
+	// cli runs the cilium and hubble CLIs downloaded into the bin
+	// directory of the adapter
+	cli *cli.Manager
 }
 
 // New initializes a new handler instance
-func New(config meshkitCfg.Handler, log logger.Handler, kc meshkitCfg.Handler) adapter.Handler {
+func New(config meshkitCfg.Handler, log logger.Handler, kc meshkitCfg.Handler, store *artifacts.Store, coordinator *oam.Coordinator, exporter *gitops.Exporter) adapter.Handler {
 	return &Handler{
 		Adapter: adapter.Adapter{
 			Config:            config,
 			Log:               log,
 			KubeconfigHandler: kc,
 		},
+		Artifacts:   store,
+		Coordinator: coordinator,
+		GitOps:      exporter,
+		contexts:    newKubeContexts(),
+		lifecycle:   newLifecycle(),
+		fences:      newClusterFences(),
+		discovery:   &discoveryCache{},
+		cli:         cli.NewManager(filepath.Join(internalconfig.RootPath(), "bin")),
+	}
+}
+
+// attachArtifact stores data as an artifact of the operation. Failing to
+// store an artifact doesn't fail the operation, it is only logged.
+func (h *Handler) attachArtifact(operationID, name string, data []byte) {
+	if h.Artifacts == nil {
+		return
+	}
+	if _, err := h.Artifacts.Put(operationID, name, data); err != nil {
+		h.Log.Error(err)
 	}
 }
 
@@ -58,16 +113,24 @@ func (h *Handler) ProcessOAM(ctx context.Context, oamReq adapter.OAMRequest) (st
 		h.Log.Error(ErrParseOAMConfig)
 	}
 
+	// The request stops when Meshery aborts it, on shutdown or once its
+	// timeout elapses
+	ctx, cancel, err := h.oamContext(ctx)
+	if err != nil {
+		return "", ErrProcessOAM(err)
+	}
+	defer cancel()
+
 	// If operation is delete then first HandleConfiguration and then handle the deployment
 	if oamReq.DeleteOp {
 		// Process configuration
-		msg2, err := h.HandleApplicationConfiguration(config, oamReq.DeleteOp)
+		msg2, err := h.HandleApplicationConfiguration(ctx, config, comps, oamReq.DeleteOp)
 		if err != nil {
 			return msg2, ErrProcessOAM(err)
 		}
 
 		// Process components
-		msg1, err := h.HandleComponents(comps, oamReq.DeleteOp)
+		msg1, err := h.HandleComponents(ctx, comps, oamReq.DeleteOp)
 		if err != nil {
 			return msg1 + "\n" + msg2, ErrProcessOAM(err)
 		}
@@ -76,13 +139,13 @@ func (h *Handler) ProcessOAM(ctx context.Context, oamReq adapter.OAMRequest) (st
 	}
 
 	// Process components
-	msg1, err := h.HandleComponents(comps, oamReq.DeleteOp)
+	msg1, err := h.HandleComponents(ctx, comps, oamReq.DeleteOp)
 	if err != nil {
 		return msg1, ErrProcessOAM(err)
 	}
 
 	// Process configuration
-	msg2, err := h.HandleApplicationConfiguration(config, oamReq.DeleteOp)
+	msg2, err := h.HandleApplicationConfiguration(ctx, config, comps, oamReq.DeleteOp)
 	if err != nil {
 		return msg1 + "\n" + msg2, ErrProcessOAM(err)
 	}
@@ -0,0 +1,162 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/layer5io/meshery-cilium/internal/cli"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultConnectivityTestNamespace = "cilium-test"
+
+// ConnectivityTestRequest is the custom body of a connectivity test
+type ConnectivityTestRequest struct {
+	// Namespace holds the workloads of the test, cilium-test by default
+	Namespace string `json:"namespace"`
+	// Tests are the regular expressions selecting the tests run, all of
+	// them are run when empty
+	Tests []string `json:"tests"`
+}
+
+// connectivityTest runs cilium connectivity test and returns its output,
+// the delete removes the workloads left in the test namespace
+func (h *Handler) connectivityTest(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	req := ConnectivityTestRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return status.Running, "", ErrOpInvalid
+	}
+	if req.Namespace == "" {
+		req.Namespace = defaultConnectivityTestNamespace
+	}
+
+	if request.IsDeleteOperation {
+		if h.KubeClient == nil {
+			return status.Removing, "", ErrNilClient
+		}
+		ns, err := h.KubeClient.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return status.Removed, "Namespace " + req.Namespace + " already removed.", nil
+		}
+		if err != nil {
+			return status.Removing, "", err
+		}
+		// Only the namespaces created by a test run are removed, never one
+		// the test was pointed at which holds other workloads
+		if !isEphemeral(ns.Labels) {
+			return status.Removing, "", ErrCleanup(fmt.Errorf("the namespace %s was not created by a connectivity test, remove the test workloads from it by hand", req.Namespace))
+		}
+		err = h.KubeClient.CoreV1().Namespaces().Delete(ctx, req.Namespace, metav1.DeleteOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return status.Removing, "", err
+		}
+		return status.Removed, "Namespace " + req.Namespace + " removed.", nil
+	}
+
+	if h.KubeClient == nil {
+		return status.Running, "", ErrNilClient
+	}
+	started := time.Now()
+	_, err := h.KubeClient.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return status.Running, "", err
+	}
+	existed := err == nil
+
+	args := []string{"connectivity", "test", "--test-namespace", req.Namespace}
+	if len(req.Tests) > 0 {
+		args = append(args, "--test", strings.Join(req.Tests, ","))
+	}
+	reportProgress(ctx, "Running the Cilium connectivity test", "cilium "+strings.Join(args, " "))
+	out, err := h.runCLI(ctx, cli.Cilium, args...)
+	// The namespace the CLI creates is left behind for inspection until the
+	// garbage collector or the cleanup removes it. An existing namespace
+	// is never marked, collecting it would delete the workloads it holds.
+	if !existed {
+		if markErr := h.markCreatedNamespace(ctx, req.Namespace, started, request.OperationName); markErr != nil {
+			h.Log.Error(ErrCleanup(markErr))
+		}
+	}
+	if err != nil {
+		return status.Running, out, err
+	}
+	return status.Completed, out, nil
+}
+
+// runCLI runs tool against the cluster of the handler, at the version
+// matching the Cilium release running in the cluster
+func (h *Handler) runCLI(ctx context.Context, tool cli.Tool, args ...string) (string, error) {
+	if h.KubeClient == nil || h.RestConfig.Host == "" {
+		return "", ErrNilClient
+	}
+
+	version := internalconfig.CiliumCLIVersion()
+	if tool == cli.Hubble {
+		installed, err := h.installedCiliumVersion(ctx)
+		if err != nil {
+			return "", err
+		}
+		version = internalconfig.HubbleCLIVersion(installed)
+	}
+
+	kubeconfig, err := h.writeKubeconfig()
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(kubeconfig)
+	return h.cli.Run(ctx, tool, version, []string{"KUBECONFIG=" + kubeconfig}, args...)
+}
+
+// writeKubeconfig writes the credentials of the handler to a kubeconfig
+// file for the CLIs, the caller removes it
+func (h *Handler) writeKubeconfig() (string, error) {
+	rc := h.RestConfig
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters["cluster"] = &clientcmdapi.Cluster{
+		Server:                   rc.Host,
+		TLSServerName:            rc.ServerName,
+		InsecureSkipTLSVerify:    rc.Insecure,
+		CertificateAuthority:     rc.CAFile,
+		CertificateAuthorityData: rc.CAData,
+	}
+	cfg.AuthInfos["user"] = &clientcmdapi.AuthInfo{
+		ClientCertificate:     rc.CertFile,
+		ClientCertificateData: rc.CertData,
+		ClientKey:             rc.KeyFile,
+		ClientKeyData:         rc.KeyData,
+		Token:                 rc.BearerToken,
+		TokenFile:             rc.BearerTokenFile,
+		Username:              rc.Username,
+		Password:              rc.Password,
+		AuthProvider:          rc.AuthProvider,
+		Exec:                  rc.ExecProvider,
+	}
+	cfg.Contexts["adapter"] = &clientcmdapi.Context{Cluster: "cluster", AuthInfo: "user"}
+	cfg.CurrentContext = "adapter"
+
+	byt, err := clientcmd.Write(*cfg)
+	if err != nil {
+		return "", ErrWriteKubeconfig(err)
+	}
+	f, err := ioutil.TempFile(internalconfig.RootPath(), "kubeconfig-")
+	if err != nil {
+		return "", ErrWriteKubeconfig(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(byt); err != nil {
+		_ = os.Remove(f.Name())
+		return "", ErrWriteKubeconfig(err)
+	}
+	return f.Name(), nil
+}
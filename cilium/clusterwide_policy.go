@@ -0,0 +1,212 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the adapter when it
+// runs in a pod
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// handleClusterwidePolicy applies a CiliumClusterwideNetworkPolicy
+// component like the other Cilium policies, along with a warning when it
+// would cut kube-system or the adapter itself off the cluster. The
+// policies selecting nodes are applied as host policies.
+func handleClusterwidePolicy(ctx context.Context, h *Handler, comp v1alpha1.Component, isDel bool) (string, error) {
+	if _, ok := comp.Spec.Settings["nodeSelector"]; ok {
+		return handleHostPolicy(ctx, h, comp, isDel)
+	}
+
+	msg, err := handleCiliumCoreComponent(ctx, h, comp, isDel, "", ciliumClusterwideNetworkPolicyKind)
+	if err != nil || isDel {
+		return msg, err
+	}
+
+	warnings := h.clusterwideLockouts(ctx, comp.Spec.Settings)
+	if len(warnings) == 0 {
+		return msg, nil
+	}
+	h.Log.Warn(ErrClusterwideLockout(comp.Name, warnings))
+	return fmt.Sprintf("%s, warning: %s", msg, strings.Join(warnings, "; ")), nil
+}
+
+// clusterwideLockouts lists the ways the rules of a clusterwide policy
+// leave the kube-system pods or the adapter in default deny without the
+// traffic they depend on. The checks are conservative, a warning only
+// means that the rules don't obviously allow that traffic.
+func (h *Handler) clusterwideLockouts(ctx context.Context, spec map[string]interface{}) []string {
+	if h.KubeClient == nil {
+		return nil
+	}
+
+	selector, namespace, err := podSelector(spec["endpointSelector"], "")
+	if err != nil {
+		// Host policies select nodes, not endpoints
+		return nil
+	}
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil
+	}
+	ingress, egress := enforcedDirections(spec)
+
+	var warnings []string
+	if namespace == "" || namespace == "kube-system" {
+		pods, err := h.KubeClient.CoreV1().Pods("kube-system").List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err == nil && len(pods.Items) > 0 {
+			if egress && !allowsEgressTo(spec, "kube-apiserver", "k8s-app", "kube-apiserver") {
+				warnings = append(warnings, fmt.Sprintf("%d kube-system pods lose their egress to the kube-apiserver", len(pods.Items)))
+			}
+			if egress && !allowsEgressTo(spec, "", "k8s-app", "kube-dns") {
+				warnings = append(warnings, fmt.Sprintf("%d kube-system pods lose their egress to kube-dns", len(pods.Items)))
+			}
+			if ingress && !allowsIngressFromCluster(spec) {
+				warnings = append(warnings, fmt.Sprintf("%d kube-system pods, kube-dns included, lose their ingress from the cluster", len(pods.Items)))
+			}
+		}
+	}
+
+	pod, podNamespace := adapterPod()
+	if pod == "" || (namespace != "" && namespace != podNamespace) {
+		return warnings
+	}
+	self, err := h.KubeClient.CoreV1().Pods(podNamespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil || !sel.Matches(labels.Set(self.Labels)) {
+		return warnings
+	}
+	if egress && !allowsEgressTo(spec, "kube-apiserver", "k8s-app", "kube-apiserver") {
+		warnings = append(warnings, "the Meshery adapter loses its egress to the kube-apiserver")
+	}
+	if ingress && !allowsIngressFromCluster(spec) {
+		warnings = append(warnings, "the Meshery adapter loses its ingress from the Meshery server")
+	}
+	return warnings
+}
+
+// enforcedDirections reports whether the endpoints selected by a rule are
+// in default deny for their ingress and their egress
+func enforcedDirections(rule map[string]interface{}) (bool, bool) {
+	_, ingress := rule["ingress"]
+	_, egress := rule["egress"]
+	if defaults, ok := rule["enableDefaultDeny"].(map[string]interface{}); ok {
+		if v, ok := defaults["ingress"].(bool); ok && !v {
+			ingress = false
+		}
+		if v, ok := defaults["egress"].(bool); ok && !v {
+			egress = false
+		}
+	}
+	return ingress, egress
+}
+
+// allowsEgressTo reports whether an egress rule reaches the entity, or the
+// endpoints labeled key=value, or every destination
+func allowsEgressTo(rule map[string]interface{}, entity, key, value string) bool {
+	for _, r := range ruleList(rule["egress"]) {
+		if !hasPeer(r, "to") {
+			return true
+		}
+		for _, e := range stringList(r["toEntities"]) {
+			if e == "all" || e == "cluster" || (entity != "" && e == entity) {
+				return true
+			}
+		}
+		for _, ep := range ruleList(r["toEndpoints"]) {
+			if selectsLabel(ep, key, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsIngressFromCluster reports whether an ingress rule admits every
+// endpoint of the cluster
+func allowsIngressFromCluster(rule map[string]interface{}) bool {
+	for _, r := range ruleList(rule["ingress"]) {
+		if !hasPeer(r, "from") {
+			return true
+		}
+		for _, e := range stringList(r["fromEntities"]) {
+			if e == "all" || e == "cluster" {
+				return true
+			}
+		}
+		for _, ep := range ruleList(r["fromEndpoints"]) {
+			if len(ep) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasPeer reports whether a rule restricts its peers, a rule with ports
+// only allows every peer on those ports
+func hasPeer(rule map[string]interface{}, direction string) bool {
+	for k := range rule {
+		if strings.HasPrefix(k, direction) && k != "toPorts" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsLabel reports whether an endpoint selector selects the endpoints
+// labeled key=value, an empty selector selects every endpoint
+func selectsLabel(selector map[string]interface{}, key, value string) bool {
+	match, _ := selector["matchLabels"].(map[string]interface{})
+	if len(selector) == 0 || (len(match) == 0 && selector["matchExpressions"] == nil) {
+		return true
+	}
+	for k, v := range match {
+		if trimLabelSource(k) == key && v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleList(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	res := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	res := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// adapterPod returns the name and namespace of the pod the adapter runs
+// in, empty when it runs outside of the cluster
+func adapterPod() (string, string) {
+	namespace, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", ""
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		return "", ""
+	}
+	return name, strings.TrimSpace(string(namespace))
+}
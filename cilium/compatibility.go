@@ -0,0 +1,70 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/compat"
+)
+
+// Compatibility is the compatibility matrix of the adapter along with the
+// support of the Cilium version running in the cluster
+type Compatibility struct {
+	compat.Matrix
+	// Installed is the Cilium version of the cluster, empty when no
+	// cluster is configured or Cilium isn't installed
+	Installed string         `json:"installed,omitempty"`
+	Support   compat.Support `json:"support,omitempty"`
+}
+
+// CompatibilityHandler serves the compatibility matrix m, checked against
+// the Cilium version of the cluster managed by the adapter handler h
+func CompatibilityHandler(h adapter.Handler, m compat.Matrix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		res := Compatibility{Matrix: m}
+		// The matrix is served without a cluster as well
+		if handler, ok := h.(*Handler); ok {
+			handler, err := handler.forContext(r.URL.Query().Get("context"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if installed, err := handler.installedCiliumVersion(r.Context()); err == nil {
+				res.Installed = installed
+				res.Support = m.CiliumSupport(installed)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
+
+// AnnounceOutdated streams an event when the cluster managed by the
+// adapter handler h runs a Cilium version newer than the versions the
+// adapter was released for
+func AnnounceOutdated(h adapter.Handler, m compat.Matrix) {
+	handler, ok := h.(*Handler)
+	if !ok || handler.KubeClient == nil {
+		// No cluster configured yet, the next registration checks again
+		return
+	}
+
+	installed, err := handler.installedCiliumVersion(context.TODO())
+	if err != nil || m.CiliumSupport(installed) != compat.TooNew {
+		return
+	}
+
+	handler.StreamInfo(&adapter.Event{
+		Summary: "Cilium adapter update available",
+		Details: fmt.Sprintf("The cluster runs Cilium %s, the adapter %s supports Cilium %s to %s. Upgrade the adapter to manage this version of Cilium.", installed, m.Adapter, m.Cilium.Min, m.Cilium.Max),
+	})
+}
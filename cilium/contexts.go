@@ -0,0 +1,177 @@
+package cilium
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// contextsDir holds the state of the contexts other than the current one
+const contextsDir = "contexts"
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// kubeContexts holds the kubeconfig of every context received from Meshery,
+// so that a single adapter manages several clusters, along with the clients
+// built for the contexts operations targeted
+type kubeContexts struct {
+	mu          sync.Mutex
+	kubeconfigs map[string][]byte
+	clients     map[string]*contextClients
+	// current is the context the handler itself works with
+	current string
+}
+
+type contextClients struct {
+	kube      *mesherykube.Client
+	clientset *kubernetes.Clientset
+}
+
+func newKubeContexts() *kubeContexts {
+	return &kubeContexts{
+		kubeconfigs: map[string][]byte{},
+		clients:     map[string]*contextClients{},
+	}
+}
+
+// add stores every context of a kubeconfig, replacing the contexts of the
+// same name received before. current is the context the handler works
+// with, the current context of the kubeconfig when empty.
+func (c *kubeContexts) add(kubeconfig []byte, current string) error {
+	cfg, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current = current
+	if c.current == "" {
+		c.current = cfg.CurrentContext
+	}
+	for name := range cfg.Contexts {
+		single := cfg.DeepCopy()
+		single.CurrentContext = name
+		byt, err := clientcmd.Write(*single)
+		if err != nil {
+			return err
+		}
+		c.kubeconfigs[name] = byt
+		delete(c.clients, name)
+	}
+	return nil
+}
+
+// isCurrent reports whether name is the context the handler works with
+func (c *kubeContexts) isCurrent(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return name == c.current
+}
+
+// get returns the clients of a context, building them on first use
+func (c *kubeContexts) get(name string) (*contextClients, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if clients, ok := c.clients[name]; ok {
+		return clients, nil
+	}
+	kubeconfig, ok := c.kubeconfigs[name]
+	if !ok {
+		return nil, fmt.Errorf("no kubeconfig received for context %q", name)
+	}
+
+	kube, err := mesherykube.New(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(&kube.RestConfig)
+	if err != nil {
+		return nil, err
+	}
+	clients := &contextClients{kube: kube, clientset: clientset}
+	c.clients[name] = clients
+	return clients, nil
+}
+
+// CreateInstance configures the handler with the current context of the
+// kubeconfig, and keeps its other contexts for the operations targeting them
+func (h *Handler) CreateInstance(kubeconfig []byte, contextName string, ch *chan interface{}) error {
+	if err := h.Adapter.CreateInstance(kubeconfig, contextName, ch); err != nil {
+		return err
+	}
+	if len(kubeconfig) == 0 {
+		// In-cluster credentials, there are no other contexts
+		return nil
+	}
+	if err := h.contexts.add(kubeconfig, contextName); err != nil {
+		return ErrKubeContext(err)
+	}
+	return nil
+}
+
+// requestContext reads the name of the Kubernetes context an operation
+// targets from its body, empty for the current context
+func requestContext(body string) string {
+	target := struct {
+		KubeContext string `json:"kubeContext"`
+	}{}
+	// Bodies which are not YAML simply target the current context
+	_ = yaml.Unmarshal([]byte(body), &target)
+	return target.KubeContext
+}
+
+// forContext returns a handler working with the cluster of a context, the
+// handler itself for the current context
+func (h *Handler) forContext(name string) (*Handler, error) {
+	if name == "" || h.contexts.isCurrent(name) {
+		return h, nil
+	}
+
+	clients, err := h.contexts.get(name)
+	if err != nil {
+		return nil, ErrKubeContext(err)
+	}
+	target := *h
+	target.MesheryKubeclient = clients.kube
+	target.DynamicKubeClient = clients.kube.DynamicKubeClient
+	target.RestConfig = clients.kube.RestConfig
+	target.KubeClient = clients.clientset
+	target.kubeContext = name
+	return &target, nil
+}
+
+// statePath returns the path of a state file of the adapter, such as the
+// Helm release it applied. Every context keeps its own state, the state of
+// the current context is kept at the root.
+func (h *Handler) statePath(name string) string {
+	if h.kubeContext == "" {
+		return filepath.Join(internalconfig.RootPath(), name)
+	}
+	dir := filepath.Join(internalconfig.RootPath(), contextsDir, contextDirName(h.kubeContext))
+	// A failure surfaces when the state file is written
+	_ = os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, name)
+}
+
+// contextDirName returns the directory holding the state of a context, the
+// names of contexts such as the ARNs of EKS clusters aren't valid paths
+func contextDirName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	safe := unsafePathChars.ReplaceAllString(name, "-")
+	if len(safe) > 40 {
+		safe = safe[:40]
+	}
+	return safe + "-" + hex.EncodeToString(sum[:4])
+}
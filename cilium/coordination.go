@@ -0,0 +1,120 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/cilium/oam"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	lockTTL           = 5 * time.Minute
+	lockRetryInterval = 15 * time.Second
+)
+
+// coordinate takes the cluster lock for a disruptive operation, waiting while
+// another Meshery adapter holds it, and keeps it renewed until the returned
+// release function is called with the result of the operation. Operations
+// run unlocked when no coordinator is configured or the Meshery server
+// doesn't support coordination. The wait stops once ctx is cancelled.
+func (h *Handler) coordinate(ctx context.Context, request adapter.OperationRequest) (func(error), error) {
+	noop := func(error) {}
+	if h.Coordinator == nil || h.Coordinator.Timeout <= 0 {
+		return noop, nil
+	}
+
+	cluster, err := h.clusterID(ctx)
+	if err != nil {
+		return noop, err
+	}
+	lock := oam.Lock{
+		Adapter:     internalconfig.CiliumOperation,
+		Cluster:     cluster,
+		Operation:   request.OperationName,
+		OperationID: request.OperationID,
+	}
+
+	var holder *oam.Lock
+	deferred := false
+	waitCtx, cancel := context.WithTimeout(ctx, h.Coordinator.Timeout)
+	defer cancel()
+	err = wait.PollImmediateUntil(lockRetryInterval, func() (bool, error) {
+		lock.ExpiresAt = time.Now().Add(lockTTL)
+		holder, err = h.Coordinator.Acquire(lock)
+		if err != nil {
+			return false, err
+		}
+		if holder != nil && !deferred {
+			deferred = true
+			h.StreamInfo(&adapter.Event{
+				Operationid: request.OperationID,
+				Summary:     fmt.Sprintf("Operation %s deferred", request.OperationName),
+				Details:     fmt.Sprintf("The %s adapter is running %s on the cluster, waiting for it to complete.", holder.Adapter, holder.Operation),
+			})
+		}
+		return holder == nil, nil
+	}, waitCtx.Done())
+	if err == oam.ErrCoordinationUnsupported {
+		return noop, nil
+	}
+	if ctx.Err() != nil {
+		return noop, ErrCoordinateOperation(ctx.Err())
+	}
+	if err == wait.ErrWaitTimeout && holder != nil {
+		return noop, ErrCoordinateOperation(fmt.Errorf("the %s adapter kept the cluster locked for %s while running %s", holder.Adapter, h.Coordinator.Timeout, holder.Operation))
+	}
+	if err != nil {
+		return noop, ErrCoordinateOperation(err)
+	}
+
+	// Renew the lock so that it only expires if the adapter goes away
+	// in the middle of the operation
+	stop := make(chan struct{})
+	go wait.Until(func() {
+		renewed := lock
+		renewed.ExpiresAt = time.Now().Add(lockTTL)
+		if _, err := h.Coordinator.Acquire(renewed); err != nil {
+			h.Log.Error(err)
+		}
+	}, lockTTL/3, stop)
+
+	return func(opErr error) {
+		close(stop)
+		if err := h.Coordinator.Release(lock); err != nil {
+			h.Log.Error(err)
+		}
+
+		announcement := oam.Announcement{
+			Adapter:     lock.Adapter,
+			Cluster:     lock.Cluster,
+			Operation:   lock.Operation,
+			OperationID: lock.OperationID,
+			Succeeded:   opErr == nil,
+			Time:        time.Now(),
+		}
+		if opErr != nil {
+			announcement.Error = opErr.Error()
+		}
+		if err := h.Coordinator.Announce(announcement); err != nil {
+			h.Log.Error(err)
+		}
+	}, nil
+}
+
+// clusterID identifies the cluster across adapters by the UID of its
+// kube-system namespace, which is the same from every kubeconfig
+func (h *Handler) clusterID(ctx context.Context) (string, error) {
+	if h.KubeClient == nil {
+		return "", ErrNilClient
+	}
+	ns, err := h.KubeClient.CoreV1().Namespaces().Get(ctx, "kube-system", metav1.GetOptions{})
+	if err != nil {
+		return "", ErrCoordinateOperation(err)
+	}
+	return string(ns.UID), nil
+}
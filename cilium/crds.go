@@ -0,0 +1,275 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/xeipuuv/gojsonschema"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// ciliumCRDsURL is the location of the CRDs shipped with a Cilium release,
+// by version and file name
+const ciliumCRDsURL = "https://raw.githubusercontent.com/cilium/cilium/v%s/pkg/k8s/apis/cilium.io/client/crds/%s"
+
+// ciliumCRDFiles are the CRD definitions of a Cilium release. Files that
+// don't exist for the requested release are skipped.
+var ciliumCRDFiles = []string{
+	"v2/ciliumnetworkpolicies.yaml",
+	"v2/ciliumclusterwidenetworkpolicies.yaml",
+	"v2/ciliumendpoints.yaml",
+	"v2/ciliumexternalworkloads.yaml",
+	"v2/ciliumidentities.yaml",
+	"v2/ciliumlocalredirectpolicies.yaml",
+	"v2/ciliumnodes.yaml",
+	"v2alpha1/ciliumegressnatpolicies.yaml",
+}
+
+// fetchCRDFile downloads a CRD file of a release, found is false when the
+// release doesn't ship it
+func fetchCRDFile(ctx context.Context, url string) (contents string, found bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("fetching %s returned status code %d", url, resp.StatusCode)
+	}
+	byt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	return string(byt), true, nil
+}
+
+// InvalidResource is a custom resource which doesn't match the schema of
+// the new CRD version
+type InvalidResource struct {
+	Kind       string   `json:"kind"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Name       string   `json:"name"`
+	Violations []string `json:"violations"`
+}
+
+// CRDUpgrade is the outcome of upgrading a single CRD
+type CRDUpgrade struct {
+	Name           string   `json:"name"`
+	StorageVersion string   `json:"storageVersion"`
+	Applied        bool     `json:"applied"`
+	Migrated       int      `json:"migrated,omitempty"`
+	StoredVersions []string `json:"storedVersions,omitempty"`
+}
+
+// CRDUpgradeReport is the result of a CRD upgrade
+type CRDUpgradeReport struct {
+	Version          string            `json:"version"`
+	CRDs             []CRDUpgrade      `json:"crds"`
+	InvalidResources []InvalidResource `json:"invalidResources,omitempty"`
+}
+
+// upgradeCRDs upgrades the Cilium CRDs to the given release independently
+// of the chart, which never upgrades CRDs once installed. The existing
+// custom resources are checked against the new schemas first and the
+// upgrade is aborted if any of them would become invalid. Once applied,
+// the custom resources stored in a previous version are rewritten in the
+// new storage version.
+func (h *Handler) upgradeCRDs(ctx context.Context, version string) (string, *CRDUpgradeReport, error) {
+	st := status.Applying
+	report := &CRDUpgradeReport{Version: version}
+
+	if h.DynamicKubeClient == nil {
+		return st, report, ErrNilClient
+	}
+	if err := h.checkCiliumVersion(ctx, version); err != nil {
+		return st, report, err
+	}
+
+	var crds []*unstructured.Unstructured
+	for _, file := range ciliumCRDFiles {
+		contents, found, err := fetchCRDFile(ctx, fmt.Sprintf(ciliumCRDsURL, version, file))
+		if err != nil {
+			return st, report, ErrUpgradeCRDs(fmt.Errorf("%s: %s", file, err))
+		}
+		if !found {
+			// The CRD is not part of this release
+			continue
+		}
+		crd := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(contents), &crd.Object); err != nil {
+			return st, report, ErrUpgradeCRDs(fmt.Errorf("%s: %s", file, err))
+		}
+		crds = append(crds, crd)
+	}
+	if len(crds) == 0 {
+		return st, report, ErrUpgradeCRDs(fmt.Errorf("no CRDs found for Cilium %s", version))
+	}
+
+	for _, crd := range crds {
+		invalid, err := h.invalidResources(ctx, crd)
+		if err != nil {
+			return st, report, ErrUpgradeCRDs(err)
+		}
+		report.InvalidResources = append(report.InvalidResources, invalid...)
+	}
+	if len(report.InvalidResources) > 0 {
+		return st, report, ErrUpgradeCRDs(fmt.Errorf("%d custom resources would become invalid", len(report.InvalidResources)))
+	}
+
+	for _, crd := range crds {
+		byt, err := yaml.Marshal(crd.Object)
+		if err != nil {
+			return st, report, ErrUpgradeCRDs(err)
+		}
+		if err := h.applyOrdered(ctx, byt, false, ""); err != nil {
+			return st, report, ErrUpgradeCRDs(err)
+		}
+		upgrade := CRDUpgrade{Name: crd.GetName(), StorageVersion: storageVersion(crd), Applied: true}
+
+		upgrade.Migrated, upgrade.StoredVersions, err = h.migrateStorageVersion(ctx, crd)
+		if err != nil {
+			report.CRDs = append(report.CRDs, upgrade)
+			return st, report, ErrUpgradeCRDs(err)
+		}
+		report.CRDs = append(report.CRDs, upgrade)
+	}
+
+	return status.Applied, report, nil
+}
+
+// invalidResources lists the existing custom resources of crd which don't
+// match the schema of its new storage version
+func (h *Handler) invalidResources(ctx context.Context, crd *unstructured.Unstructured) ([]InvalidResource, error) {
+	version := storageVersion(crd)
+	openAPISchema := versionSchema(crd, version)
+	if openAPISchema == nil {
+		return nil, nil
+	}
+
+	list, err := h.DynamicKubeClient.Resource(crdGVR(crd, version)).List(ctx, metav1.ListOptions{})
+	if kerrors.IsNotFound(err) {
+		// Neither the CRD nor the version is served yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	schemaLoader := gojsonschema.NewGoLoader(openAPISchema)
+	var invalid []InvalidResource
+	for _, item := range list.Items {
+		res, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewGoLoader(item.Object))
+		if err != nil {
+			return nil, err
+		}
+		if res.Valid() {
+			continue
+		}
+
+		resource := InvalidResource{Kind: item.GetKind(), Namespace: item.GetNamespace(), Name: item.GetName()}
+		for _, e := range res.Errors() {
+			resource.Violations = append(resource.Violations, e.String())
+		}
+		invalid = append(invalid, resource)
+	}
+	return invalid, nil
+}
+
+// migrateStorageVersion rewrites the custom resources of crd so that they
+// are persisted in the current storage version, then drops the previous
+// versions from the stored versions of the CRD
+func (h *Handler) migrateStorageVersion(ctx context.Context, crd *unstructured.Unstructured) (int, []string, error) {
+	version := storageVersion(crd)
+	if err := h.waitForCRDs(ctx, []string{crd.GetName()}); err != nil {
+		return 0, nil, err
+	}
+
+	current, err := h.DynamicKubeClient.Resource(crdResource).Get(ctx, crd.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return 0, nil, err
+	}
+	stored, _, _ := unstructured.NestedStringSlice(current.Object, "status", "storedVersions")
+	if len(stored) == 0 || (len(stored) == 1 && stored[0] == version) {
+		return 0, stored, nil
+	}
+
+	resource := h.DynamicKubeClient.Resource(crdGVR(crd, version))
+	list, err := resource.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, stored, err
+	}
+
+	// An unchanged update makes the API server persist the object in the
+	// storage version
+	migrated := 0
+	for i := range list.Items {
+		item := &list.Items[i]
+		if _, err := resource.Namespace(item.GetNamespace()).Update(ctx, item, metav1.UpdateOptions{}); err != nil {
+			if kerrors.IsNotFound(err) || kerrors.IsConflict(err) {
+				// Deleted or rewritten concurrently, either way it is stored anew
+				continue
+			}
+			return migrated, stored, fmt.Errorf("migrating %s %s/%s: %s", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+		}
+		migrated++
+	}
+
+	if err := unstructured.SetNestedStringSlice(current.Object, []string{version}, "status", "storedVersions"); err != nil {
+		return migrated, stored, err
+	}
+	if _, err := h.DynamicKubeClient.Resource(crdResource).UpdateStatus(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return migrated, stored, err
+	}
+	return migrated, []string{version}, nil
+}
+
+// storageVersion returns the version of the CRD marked as storage version
+func storageVersion(crd *unstructured.Unstructured) string {
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		vMap, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if storage, _ := vMap["storage"].(bool); storage {
+			name, _ := vMap["name"].(string)
+			return name
+		}
+	}
+	return ""
+}
+
+// versionSchema returns the OpenAPI schema of a version of the CRD
+func versionSchema(crd *unstructured.Unstructured, version string) map[string]interface{} {
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		vMap, ok := v.(map[string]interface{})
+		if !ok || vMap["name"] != version {
+			continue
+		}
+		openAPISchema, _, _ := unstructured.NestedMap(vMap, "schema", "openAPIV3Schema")
+		return openAPISchema
+	}
+	return nil
+}
+
+func crdGVR(crd *unstructured.Unstructured, version string) schema.GroupVersionResource {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	return schema.GroupVersionResource{Group: group, Version: version, Resource: plural}
+}
@@ -0,0 +1,292 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/xeipuuv/gojsonschema"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+)
+
+// fieldManager owns the fields of the resources the adapter applies with
+// server-side apply
+const fieldManager = "meshery-cilium"
+
+// Outcomes of a resource of a custom manifest
+const (
+	resourceApplied = "applied"
+	resourceDeleted = "deleted"
+	resourceAbsent  = "absent"
+	resourceInvalid = "invalid"
+	resourceFailed  = "failed"
+	resourceSkipped = "skipped"
+)
+
+// ResourceResult is the outcome of a single resource of a custom manifest
+type ResourceResult struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Result is applied, deleted, absent, invalid, failed or skipped
+	Result     string   `json:"result"`
+	Violations []string `json:"violations,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ManifestReport is the outcome of the custom manifest operation
+type ManifestReport struct {
+	Resources []ResourceResult `json:"resources"`
+}
+
+// count returns the resources with the result
+func (r *ManifestReport) count(result string) int {
+	n := 0
+	for _, res := range r.Resources {
+		if res.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// manifestResource is a decoded document of a custom manifest
+type manifestResource struct {
+	obj    *unstructured.Unstructured
+	rank   int
+	result *ResourceResult
+}
+
+// applyCustomManifest applies the resources of a multi-document manifest,
+// raw Cilium resources such as the ones of a Meshery design, with
+// server-side apply. The custom resources are validated against the schema
+// of their CRD first, the policies against the rules of Cilium as well, and
+// nothing is applied when one of them is invalid.
+func (h *Handler) applyCustomManifest(ctx context.Context, request adapter.OperationRequest) (string, *ManifestReport, error) {
+	st := status.Deploying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	report := &ManifestReport{Resources: []ResourceResult{}}
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return st, report, ErrNilClient
+	}
+
+	docs, err := splitManifest([]byte(request.CustomBody))
+	if err != nil {
+		return st, report, ErrCustomManifest(err)
+	}
+	namespace := request.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	resources := make([]*manifestResource, 0, len(docs))
+	for _, doc := range docs {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc.Contents), &obj.Object); err != nil {
+			return st, report, ErrCustomManifest(err)
+		}
+		resources = append(resources, &manifestResource{obj: obj, rank: doc.rank, result: &ResourceResult{Kind: obj.GetKind(), Name: obj.GetName()}})
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		if request.IsDeleteOperation {
+			return resources[i].rank > resources[j].rank
+		}
+		return resources[i].rank < resources[j].rank
+	})
+
+	collect := func() {
+		for _, r := range resources {
+			report.Resources = append(report.Resources, *r.result)
+		}
+	}
+
+	if !request.IsDeleteOperation {
+		invalid, err := h.validateManifestResources(ctx, resources)
+		if err != nil {
+			return st, report, ErrCustomManifest(err)
+		}
+		if invalid > 0 {
+			for _, r := range resources {
+				if r.result.Result == "" {
+					r.result.Result = resourceSkipped
+				}
+			}
+			collect()
+			return st, report, ErrCustomManifest(fmt.Errorf("%d of %d resources are invalid, none was applied", invalid, len(resources)))
+		}
+	}
+
+	mapper, err := h.restMapper()
+	if err != nil {
+		return st, report, ErrCustomManifest(err)
+	}
+	labels := environmentFrom(ctx)
+	var crds []string
+	for i, r := range resources {
+		// The resources of the CRDs of the manifest are only mapped once
+		// the CRDs are established
+		if !request.IsDeleteOperation && len(crds) > 0 && r.rank > 0 && resources[i-1].rank == 0 {
+			if err := h.waitForCRDs(ctx, crds); err != nil {
+				return st, report, ErrCustomManifest(err)
+			}
+			if mapper, err = h.restMapper(); err != nil {
+				return st, report, ErrCustomManifest(err)
+			}
+		}
+		if len(labels) > 0 && !request.IsDeleteOperation {
+			merged := r.obj.GetLabels()
+			if merged == nil {
+				merged = map[string]string{}
+			}
+			for k, v := range labels {
+				merged[k] = v
+			}
+			r.obj.SetLabels(merged)
+		}
+		h.applyManifestResource(ctx, mapper, r, namespace, request.IsDeleteOperation)
+		if r.rank == 0 {
+			crds = append(crds, r.obj.GetName())
+		}
+	}
+	collect()
+
+	if failed := report.count(resourceFailed); failed > 0 {
+		return st, report, ErrCustomManifest(fmt.Errorf("%d of %d resources failed", failed, len(resources)))
+	}
+	if request.IsDeleteOperation {
+		return status.Removed, report, nil
+	}
+	return status.Deployed, report, nil
+}
+
+// validateManifestResources validates the custom resources against the
+// schema of their CRD, from the cluster or from the manifest itself, and
+// returns the number of invalid resources
+func (h *Handler) validateManifestResources(ctx context.Context, resources []*manifestResource) (int, error) {
+	crds := map[schema.GroupKind]*unstructured.Unstructured{}
+	list, err := h.DynamicKubeClient.Resource(crdResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for i := range list.Items {
+		crds[crdGroupKind(&list.Items[i])] = &list.Items[i]
+	}
+	for _, r := range resources {
+		if r.obj.GetKind() == "CustomResourceDefinition" {
+			crds[crdGroupKind(r.obj)] = r.obj
+		}
+	}
+
+	invalid := 0
+	for _, r := range resources {
+		if r.obj.GetName() == "" {
+			r.result.Violations = append(r.result.Violations, "metadata.name: is required")
+		}
+		gvk := r.obj.GroupVersionKind()
+		if crd, ok := crds[gvk.GroupKind()]; ok {
+			openAPISchema := versionSchema(crd, gvk.Version)
+			if openAPISchema == nil {
+				r.result.Violations = append(r.result.Violations, fmt.Sprintf("apiVersion: version %q is not served by %s", gvk.Version, crd.GetName()))
+			} else {
+				res, err := gojsonschema.Validate(gojsonschema.NewGoLoader(openAPISchema), gojsonschema.NewGoLoader(r.obj.Object))
+				if err != nil {
+					return 0, err
+				}
+				for _, e := range res.Errors() {
+					r.result.Violations = append(r.result.Violations, e.String())
+				}
+			}
+		}
+		if _, ok := policyCRDs[gvk.Kind]; ok && gvk.Group == "cilium.io" {
+			for _, v := range ruleViolations(gvk.Kind, r.obj.Object) {
+				r.result.Violations = append(r.result.Violations, v.String())
+			}
+		}
+		if len(r.result.Violations) > 0 {
+			r.result.Result = resourceInvalid
+			invalid++
+		}
+	}
+	return invalid, nil
+}
+
+// crdGroupKind is the group and kind of the resources defined by a CRD
+func crdGroupKind(crd *unstructured.Unstructured) schema.GroupKind {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	return schema.GroupKind{Group: group, Kind: kind}
+}
+
+// restMapper maps the kinds to the resources served by the cluster
+func (h *Handler) restMapper() (meta.RESTMapper, error) {
+	groups, err := restmapper.GetAPIGroupResources(h.KubeClient.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	return restmapper.NewDiscoveryRESTMapper(groups), nil
+}
+
+// applyManifestResource applies or deletes a single resource, recording
+// the outcome in its result
+func (h *Handler) applyManifestResource(ctx context.Context, mapper meta.RESTMapper, r *manifestResource, namespace string, isDel bool) {
+	gvk := r.obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		r.result.Result, r.result.Error = resourceFailed, err.Error()
+		return
+	}
+
+	res := h.DynamicKubeClient.Resource(mapping.Resource)
+	client := res.Namespace("")
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if r.obj.GetNamespace() == "" {
+			r.obj.SetNamespace(namespace)
+		}
+		r.result.Namespace = r.obj.GetNamespace()
+		client = res.Namespace(r.obj.GetNamespace())
+	}
+
+	if isDel {
+		err := client.Delete(ctx, r.obj.GetName(), metav1.DeleteOptions{})
+		switch {
+		case kerrors.IsNotFound(err):
+			r.result.Result = resourceAbsent
+		case err != nil:
+			r.result.Result, r.result.Error = resourceFailed, err.Error()
+			return
+		default:
+			r.result.Result = resourceDeleted
+		}
+		recordRendered(ctx, r.obj.GetKind(), r.obj.GetNamespace(), r.obj.GetName(), nil, true)
+		noteResource(ctx, r.obj.GetKind(), r.obj.GetNamespace(), r.obj.GetName())
+		return
+	}
+
+	byt, err := json.Marshal(r.obj.Object)
+	if err != nil {
+		r.result.Result, r.result.Error = resourceFailed, err.Error()
+		return
+	}
+	force := true
+	if _, err := client.Patch(ctx, r.obj.GetName(), types.ApplyPatchType, byt, metav1.PatchOptions{FieldManager: fieldManager, Force: &force}); err != nil {
+		r.result.Result, r.result.Error = resourceFailed, err.Error()
+		return
+	}
+	r.result.Result = resourceApplied
+	noteResource(ctx, r.obj.GetKind(), r.obj.GetNamespace(), r.obj.GetName())
+	if rendered, err := yaml.JSONToYAML(byt); err == nil {
+		recordRendered(ctx, r.obj.GetKind(), r.obj.GetNamespace(), r.obj.GetName(), rendered, false)
+	}
+}
@@ -0,0 +1,403 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// grafanaSidecarLabel is the label the dashboards sidecar of the Grafana
+	// chart watches ConfigMaps for, the Cilium chart uses it as well
+	grafanaSidecarLabel = "grafana_dashboard"
+	// dashboardOwnerLabel marks the dashboards generated by the adapter so
+	// that those of disabled features are pruned
+	dashboardOwnerLabel = "meshery.io/cilium-dashboard"
+
+	// annotationsJob is the job of the pods scraped through their
+	// prometheus.io annotations by the Prometheus community chart
+	annotationsJob = "kubernetes-pods"
+
+	dashboardRateInterval = "5m"
+)
+
+var serviceMonitorResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"}
+
+// DashboardsRequest is the body of the Grafana dashboards operation
+type DashboardsRequest struct {
+	// Namespace is where the dashboard ConfigMaps are created for the
+	// Grafana sidecar, the namespace of the operation by default
+	Namespace string `json:"namespace,omitempty"`
+	// Jobs override the job labels detected from the Prometheus setup
+	Jobs DashboardJobs `json:"jobs,omitempty"`
+}
+
+// DashboardJobs are the Prometheus job labels of the Cilium metrics
+type DashboardJobs struct {
+	Agent  string `json:"agent,omitempty"`
+	Hubble string `json:"hubble,omitempty"`
+}
+
+// DashboardsReport describes the dashboards installed for the enabled features
+type DashboardsReport struct {
+	Namespace string        `json:"namespace"`
+	Features  []string      `json:"features"`
+	Jobs      DashboardJobs `json:"jobs"`
+	// JobSource tells where the job labels come from: a ServiceMonitor,
+	// the scrape annotations or the request
+	JobSource  string             `json:"jobSource"`
+	Dashboards []DashboardSummary `json:"dashboards"`
+	Pruned     []string           `json:"pruned,omitempty"`
+}
+
+// DashboardSummary is a dashboard installed by the operation
+type DashboardSummary struct {
+	Name   string `json:"name"`
+	Title  string `json:"title"`
+	Panels int    `json:"panels"`
+}
+
+// dashboardPanel is a time series panel of a generated dashboard
+type dashboardPanel struct {
+	title  string
+	expr   string
+	legend string
+	unit   string
+}
+
+// dashboardFeatures are the features of the agents the dashboards are
+// generated for, read from the agent configuration
+type dashboardFeatures struct {
+	agentMetrics  bool
+	hubbleMetrics []string
+	bgp           bool
+	encryption    string
+}
+
+func (f dashboardFeatures) names() []string {
+	var names []string
+	if f.agentMetrics {
+		names = append(names, "agent-metrics")
+	}
+	for _, m := range f.hubbleMetrics {
+		names = append(names, "hubble-"+m)
+	}
+	if f.bgp {
+		names = append(names, "bgp")
+	}
+	if f.encryption != "" {
+		names = append(names, "encryption-"+f.encryption)
+	}
+	return names
+}
+
+// detectDashboardFeatures reads the metrics and features enabled on the
+// agents from the cilium-config ConfigMap
+func detectDashboardFeatures(cfg map[string]string) dashboardFeatures {
+	f := dashboardFeatures{
+		agentMetrics: cfg["prometheus-serve-addr"] != "",
+		bgp:          cfg["enable-bgp-control-plane"] == "true" || cfg["bgp-announce-lb-ip"] == "true" || cfg["bgp-announce-pod-cidr"] == "true",
+	}
+	if cfg["hubble-metrics-server"] != "" {
+		// Metrics carry options after a colon, e.g. dns:query;ignoreAAAA
+		for _, m := range strings.Fields(cfg["hubble-metrics"]) {
+			f.hubbleMetrics = append(f.hubbleMetrics, strings.SplitN(m, ":", 2)[0])
+		}
+	}
+	switch {
+	case cfg["enable-wireguard"] == "true":
+		f.encryption = encryptionWireguard
+	case cfg["enable-ipsec"] == "true":
+		f.encryption = encryptionIPsec
+	}
+	return f
+}
+
+// detectDashboardJobs finds the job labels of the agent and Hubble
+// metrics. Prometheus operator setups label the series with the Service
+// selected by the ServiceMonitor of the Cilium chart, annotation based
+// setups with the job scraping the pods.
+func (h *Handler) detectDashboardJobs(ctx context.Context) (DashboardJobs, string) {
+	jobs := DashboardJobs{Agent: annotationsJob, Hubble: annotationsJob}
+	if h.DynamicKubeClient == nil || h.KubeClient == nil {
+		return jobs, "annotations"
+	}
+	monitors, err := h.DynamicKubeClient.Resource(serviceMonitorResource).Namespace(ciliumNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return jobs, "annotations"
+	}
+
+	source := "annotations"
+	for _, monitor := range monitors.Items {
+		selector, _, _ := unstructured.NestedStringMap(monitor.Object, "spec", "selector", "matchLabels")
+		jobLabel, _, _ := unstructured.NestedString(monitor.Object, "spec", "jobLabel")
+		services, err := h.KubeClient.CoreV1().Services(ciliumNamespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(selector).String(),
+		})
+		if err != nil || len(selector) == 0 || len(services.Items) == 0 {
+			continue
+		}
+		svc := services.Items[0]
+		job := svc.Name
+		if v := svc.Labels[jobLabel]; jobLabel != "" && v != "" {
+			job = v
+		}
+		switch selector["k8s-app"] {
+		case "cilium":
+			jobs.Agent, source = job, "servicemonitor"
+		case "hubble":
+			jobs.Hubble, source = job, "servicemonitor"
+		}
+	}
+	return jobs, source
+}
+
+// installDashboards generates the Grafana dashboards of the features
+// enabled on the agents and installs them as ConfigMaps picked up by the
+// Grafana sidecar. The dashboards of features since disabled are pruned,
+// removing the operation removes every generated dashboard.
+func (h *Handler) installDashboards(ctx context.Context, request adapter.OperationRequest) (string, *DashboardsReport, error) {
+	st := status.Installing
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	if h.KubeClient == nil {
+		return st, nil, ErrNilClient
+	}
+
+	req := DashboardsRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return st, nil, ErrGrafanaDashboards(err)
+	}
+	report := &DashboardsReport{Namespace: req.Namespace, Dashboards: []DashboardSummary{}}
+	if report.Namespace == "" {
+		report.Namespace = request.Namespace
+	}
+	if report.Namespace == "" {
+		report.Namespace = ciliumNamespace
+	}
+
+	if request.IsDeleteOperation {
+		pruned, err := h.pruneDashboards(ctx, report.Namespace, nil)
+		report.Pruned = pruned
+		if err != nil {
+			return st, report, ErrGrafanaDashboards(err)
+		}
+		return status.Removed, report, nil
+	}
+
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, report, ErrGrafanaDashboards(err)
+	}
+	features := detectDashboardFeatures(cfg)
+	report.Features = features.names()
+
+	report.Jobs, report.JobSource = h.detectDashboardJobs(ctx)
+	if req.Jobs.Agent != "" || req.Jobs.Hubble != "" {
+		report.JobSource = "request"
+	}
+	if req.Jobs.Agent != "" {
+		report.Jobs.Agent = req.Jobs.Agent
+	}
+	if req.Jobs.Hubble != "" {
+		report.Jobs.Hubble = req.Jobs.Hubble
+	}
+
+	dashboards := featureDashboards(features, report.Jobs)
+	keep := map[string]bool{}
+	var docs []string
+	for _, name := range dashboardNames(dashboards) {
+		d := dashboards[name]
+		cm, err := dashboardConfigMap(name, report.Namespace, d)
+		if err != nil {
+			return st, report, ErrGrafanaDashboards(err)
+		}
+		docs = append(docs, string(cm))
+		keep[name] = true
+		report.Dashboards = append(report.Dashboards, DashboardSummary{Name: name, Title: d.title, Panels: len(d.panels)})
+	}
+	if len(docs) > 0 {
+		if err := h.applyOrdered(ctx, []byte(strings.Join(docs, "---\n")), false, report.Namespace); err != nil {
+			return st, report, ErrGrafanaDashboards(err)
+		}
+	}
+
+	pruned, err := h.pruneDashboards(ctx, report.Namespace, keep)
+	report.Pruned = pruned
+	if err != nil {
+		return st, report, ErrGrafanaDashboards(err)
+	}
+	return status.Installed, report, nil
+}
+
+// pruneDashboards deletes the generated dashboards which are not kept
+func (h *Handler) pruneDashboards(ctx context.Context, namespace string, keep map[string]bool) ([]string, error) {
+	list, err := h.KubeClient.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: dashboardOwnerLabel})
+	if err != nil {
+		return nil, err
+	}
+	var pruned []string
+	for _, cm := range list.Items {
+		if keep[cm.Name] {
+			continue
+		}
+		if err := h.KubeClient.CoreV1().ConfigMaps(namespace).Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !kerrors.IsNotFound(err) {
+			return pruned, err
+		}
+		pruned = append(pruned, cm.Name)
+	}
+	return pruned, nil
+}
+
+// generatedDashboard is a dashboard along with its panels
+type generatedDashboard struct {
+	title  string
+	panels []dashboardPanel
+}
+
+// featureDashboards generates a dashboard per enabled feature, keyed by
+// the name of its ConfigMap
+func featureDashboards(f dashboardFeatures, jobs DashboardJobs) map[string]generatedDashboard {
+	agent := fmt.Sprintf(`job=%q`, jobs.Agent)
+	hubble := fmt.Sprintf(`job=%q`, jobs.Hubble)
+	rate := func(metric, selector, by string) string {
+		return fmt.Sprintf("sum(rate(%s{%s}[%s])) by (%s)", metric, selector, dashboardRateInterval, by)
+	}
+
+	res := map[string]generatedDashboard{}
+	if f.agentMetrics {
+		res["cilium-dashboard-agent"] = generatedDashboard{title: "Cilium Agent", panels: []dashboardPanel{
+			{title: "Endpoints by state", expr: fmt.Sprintf("sum(cilium_endpoint_state{%s}) by (endpoint_state)", agent), legend: "{{endpoint_state}}"},
+			{title: "Forwarded packets", expr: rate("cilium_forward_count_total", agent, "direction"), legend: "{{direction}}", unit: "pps"},
+			{title: "Dropped packets by reason", expr: rate("cilium_drop_count_total", agent, "reason"), legend: "{{reason}}", unit: "pps"},
+			{title: "Policies", expr: fmt.Sprintf("max(cilium_policy{%s})", agent), legend: "policies"},
+			{title: "Policy import errors", expr: fmt.Sprintf("sum(rate(cilium_policy_import_errors_total{%s}[%s]))", agent, dashboardRateInterval), legend: "errors"},
+			{title: "BPF map operation failures", expr: rate("cilium_bpf_map_ops_total", agent+`,outcome="fail"`, "map_name"), legend: "{{map_name}}"},
+			{title: "Agent API latency p95", expr: fmt.Sprintf("histogram_quantile(0.95, %s)", rate("cilium_agent_api_process_time_seconds_bucket", agent, "le, path")), legend: "{{path}}", unit: "s"},
+		}}
+	}
+
+	var hubblePanels []dashboardPanel
+	for _, m := range f.hubbleMetrics {
+		switch m {
+		case "dns":
+			hubblePanels = append(hubblePanels,
+				dashboardPanel{title: "DNS queries", expr: rate("hubble_dns_queries_total", hubble, "qtypes"), legend: "{{qtypes}}", unit: "reqps"},
+				dashboardPanel{title: "DNS errors", expr: rate("hubble_dns_responses_total", hubble+`,rcode!="No Error"`, "rcode"), legend: "{{rcode}}"})
+		case "drop":
+			hubblePanels = append(hubblePanels, dashboardPanel{title: "Dropped flows by reason", expr: rate("hubble_drop_total", hubble, "reason"), legend: "{{reason}}"})
+		case "tcp":
+			hubblePanels = append(hubblePanels, dashboardPanel{title: "TCP flags", expr: rate("hubble_tcp_flags_total", hubble, "flag"), legend: "{{flag}}"})
+		case "flow":
+			hubblePanels = append(hubblePanels, dashboardPanel{title: "Flows by verdict", expr: rate("hubble_flows_processed_total", hubble, "verdict"), legend: "{{verdict}}"})
+		case "icmp":
+			hubblePanels = append(hubblePanels, dashboardPanel{title: "ICMP messages", expr: rate("hubble_icmp_total", hubble, "type"), legend: "{{type}}"})
+		case "port-distribution":
+			hubblePanels = append(hubblePanels, dashboardPanel{title: "Top destination ports", expr: fmt.Sprintf("topk(10, %s)", rate("hubble_port_distribution_total", hubble, "port, protocol")), legend: "{{protocol}}/{{port}}"})
+		case "http", "httpV2":
+			hubblePanels = append(hubblePanels,
+				dashboardPanel{title: "HTTP requests by status", expr: rate("hubble_http_requests_total", hubble, "status"), legend: "{{status}}", unit: "reqps"},
+				dashboardPanel{title: "HTTP request latency p95", expr: fmt.Sprintf("histogram_quantile(0.95, %s)", rate("hubble_http_request_duration_seconds_bucket", hubble, "le")), legend: "p95", unit: "s"})
+		}
+	}
+	if len(hubblePanels) > 0 {
+		res["cilium-dashboard-hubble"] = generatedDashboard{title: "Hubble", panels: hubblePanels}
+	}
+
+	if f.bgp {
+		res["cilium-dashboard-bgp"] = generatedDashboard{title: "Cilium BGP", panels: []dashboardPanel{
+			{title: "BGP session state", expr: fmt.Sprintf("max(cilium_bgp_control_plane_session_state{%s}) by (vrouter, neighbor)", agent), legend: "{{vrouter}} - {{neighbor}}"},
+		}}
+	}
+
+	if f.encryption != "" {
+		panels := []dashboardPanel{
+			{title: "Encryption drops", expr: rate("cilium_drop_count_total", agent+`,reason=~".*(ncrypt|WireGuard|IPsec).*"`, "reason"), legend: "{{reason}}", unit: "pps"},
+		}
+		if f.encryption == encryptionIPsec {
+			panels = append(panels,
+				dashboardPanel{title: "IPsec keys", expr: fmt.Sprintf("max(cilium_ipsec_keys{%s})", agent), legend: "keys"},
+				dashboardPanel{title: "IPsec XFRM errors", expr: fmt.Sprintf("sum(cilium_ipsec_xfrm_error{%s}) by (error, type)", agent), legend: "{{type}} {{error}}"})
+		}
+		res["cilium-dashboard-encryption"] = generatedDashboard{title: fmt.Sprintf("Cilium Encryption (%s)", f.encryption), panels: panels}
+	}
+	return res
+}
+
+// grafanaDashboard renders a dashboard with its panels laid out two per
+// row, querying the Prometheus datasource picked when viewing it
+func grafanaDashboard(uid string, d generatedDashboard) map[string]interface{} {
+	panels := make([]interface{}, 0, len(d.panels))
+	for i, p := range d.panels {
+		panels = append(panels, map[string]interface{}{
+			"id":         i + 1,
+			"type":       "timeseries",
+			"title":      p.title,
+			"datasource": map[string]interface{}{"type": "prometheus", "uid": "${datasource}"},
+			"gridPos":    map[string]interface{}{"x": (i % 2) * 12, "y": (i / 2) * 8, "w": 12, "h": 8},
+			"fieldConfig": map[string]interface{}{
+				"defaults":  map[string]interface{}{"unit": p.unit},
+				"overrides": []interface{}{},
+			},
+			"targets": []interface{}{
+				map[string]interface{}{"refId": "A", "expr": p.expr, "legendFormat": p.legend},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"uid":           uid,
+		"title":         d.title,
+		"tags":          []interface{}{"cilium", "meshery"},
+		"schemaVersion": 36,
+		"time":          map[string]interface{}{"from": "now-1h", "to": "now"},
+		"refresh":       "30s",
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{"name": "datasource", "type": "datasource", "query": "prometheus", "label": "Data source"},
+			},
+		},
+		"panels": panels,
+	}
+}
+
+// dashboardConfigMap renders the ConfigMap holding a dashboard
+func dashboardConfigMap(name, namespace string, d generatedDashboard) ([]byte, error) {
+	dashboard, err := json.MarshalIndent(grafanaDashboard(name, d), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels": map[string]interface{}{
+				grafanaSidecarLabel: "1",
+				dashboardOwnerLabel: "true",
+			},
+		},
+		"data": map[string]interface{}{name + ".json": string(dashboard)},
+	})
+}
+
+func dashboardNames(m map[string]generatedDashboard) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
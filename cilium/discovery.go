@@ -0,0 +1,301 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DiscoveryPath is the path under which the Cilium resources discovered in
+// the cluster are served
+const DiscoveryPath = "/discovery"
+
+// maxUnhealthyListed bounds the unhealthy resources listed by kind, the
+// others are only counted
+const maxUnhealthyListed = 50
+
+// discoveredKinds are the Cilium resources discovered, by kind
+var discoveredKinds = []struct {
+	kind   string
+	gvr    schema.GroupVersionResource
+	health func(*unstructured.Unstructured, map[string]bool) string
+}{
+	{ciliumNetworkPolicyKind, ciliumNetworkPolicyResource, policyHealth},
+	{ciliumClusterwideNetworkPolicyKind, ciliumClusterwidePolicyResource, policyHealth},
+	{"CiliumEndpoint", ciliumEndpointResource, endpointHealth},
+	{"CiliumIdentity", ciliumIdentityResource, identityHealth},
+	{"CiliumNode", ciliumNodeResource, nodeHealth},
+}
+
+// DiscoveredResource is a Cilium resource found unhealthy
+type DiscoveredResource struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+// ResourceInventory counts the resources of a kind by health
+type ResourceInventory struct {
+	Total     int                  `json:"total"`
+	Healthy   int                  `json:"healthy"`
+	Unhealthy []DiscoveredResource `json:"unhealthy,omitempty"`
+}
+
+// Discovery is the state of the Cilium resources of the cluster, whether
+// they were applied through the adapter or not
+type Discovery struct {
+	ObservedAt time.Time                     `json:"observedAt"`
+	Resources  map[string]*ResourceInventory `json:"resources"`
+}
+
+// summary is the part of the discovery streamed to Meshery when it changes
+func (d *Discovery) summary() string {
+	kinds := make([]string, 0, len(d.Resources))
+	for kind := range d.Resources {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		inv := d.Resources[kind]
+		part := fmt.Sprintf("%s: %d/%d healthy", kind, inv.Healthy, inv.Total)
+		if len(inv.Unhealthy) > 0 {
+			names := make([]string, 0, len(inv.Unhealthy))
+			for _, r := range inv.Unhealthy {
+				names = append(names, fmt.Sprintf("%s (%s)", qualifiedName(r.Namespace, r.Name), r.Reason))
+			}
+			part += " - " + strings.Join(names, ", ")
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\n")
+}
+
+func qualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// discoveryCache holds the last discovery of the current context
+type discoveryCache struct {
+	mu   sync.RWMutex
+	last *Discovery
+}
+
+func (c *discoveryCache) get() *Discovery {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.last
+}
+
+// set stores d and reports whether its summary differs from the previous
+// discovery
+func (c *discoveryCache) set(d *Discovery) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := c.last == nil || c.last.summary() != d.summary()
+	c.last = d
+	return changed
+}
+
+// StartDiscovery discovers the Cilium resources of the cluster managed by
+// the adapter handler h every interval, and streams their state to Meshery
+// whenever it changes, until the adapter shuts down
+func StartDiscovery(h adapter.Handler, interval time.Duration) {
+	handler, ok := h.(*Handler)
+	if !ok {
+		return
+	}
+	handler.goOperation(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		failing := false
+		for {
+			// No cluster configured yet, the next tick checks again
+			if handler.KubeClient != nil && handler.DynamicKubeClient != nil {
+				d, err := handler.Discover(handler.lifecycle.ctx)
+				switch {
+				case err != nil && !failing:
+					// Logged once until the discovery recovers
+					handler.Log.Error(err)
+					failing = true
+				case err == nil:
+					failing = false
+					if handler.discovery.set(d) {
+						handler.StreamInfo(&adapter.Event{
+							Summary: "Cilium resources discovered",
+							Details: d.summary(),
+						})
+					}
+				}
+			}
+
+			select {
+			case <-handler.lifecycle.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Discover lists the Cilium policies, endpoints, identities and nodes of
+// the cluster and checks their health
+func (h *Handler) Discover(ctx context.Context) (*Discovery, error) {
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+
+	// The CiliumNodes of removed nodes are left behind when the operator
+	// misses the deletion
+	nodes, err := h.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrDiscovery(err)
+	}
+	known := map[string]bool{}
+	for _, n := range nodes.Items {
+		known[n.Name] = true
+	}
+
+	res := &Discovery{ObservedAt: time.Now().UTC(), Resources: map[string]*ResourceInventory{}}
+	for _, k := range discoveredKinds {
+		inv := &ResourceInventory{}
+		err := h.eachPage(ctx, k.gvr, func(list *unstructured.UnstructuredList) {
+			for i := range list.Items {
+				item := &list.Items[i]
+				inv.Total++
+				reason := k.health(item, known)
+				if reason == "" {
+					inv.Healthy++
+					continue
+				}
+				if len(inv.Unhealthy) < maxUnhealthyListed {
+					inv.Unhealthy = append(inv.Unhealthy, DiscoveredResource{Namespace: item.GetNamespace(), Name: item.GetName(), Reason: reason})
+				}
+			}
+		})
+		if err != nil {
+			return nil, ErrDiscovery(fmt.Errorf("listing %s: %s", k.kind, err))
+		}
+		res.Resources[k.kind] = inv
+	}
+	return res, nil
+}
+
+// policyHealth reports the first node failing to enforce a policy, from
+// the per node status of older agents or the conditions of newer ones
+func policyHealth(u *unstructured.Unstructured, _ map[string]bool) string {
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["status"] != "False" {
+			continue
+		}
+		if msg, _ := cond["message"].(string); msg != "" {
+			return msg
+		}
+		return fmt.Sprintf("%v is False", cond["type"])
+	}
+
+	nodes, _, _ := unstructured.NestedMap(u.Object, "status", "nodes")
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st, ok := nodes[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if msg, _ := st["error"].(string); msg != "" {
+			return fmt.Sprintf("%s: %s", name, msg)
+		}
+		if ok, found := st["ok"].(bool); found && !ok {
+			return fmt.Sprintf("not enforced on %s", name)
+		}
+	}
+	return ""
+}
+
+func endpointHealth(u *unstructured.Unstructured, _ map[string]bool) string {
+	state, _, _ := unstructured.NestedString(u.Object, "status", "state")
+	switch state {
+	case "ready":
+		return ""
+	case "":
+		return "no state reported"
+	}
+	return state
+}
+
+func identityHealth(u *unstructured.Unstructured, _ map[string]bool) string {
+	labels, _, _ := unstructured.NestedStringMap(u.Object, "security-labels")
+	if len(labels) == 0 {
+		return "no security labels"
+	}
+	return ""
+}
+
+func nodeHealth(u *unstructured.Unstructured, known map[string]bool) string {
+	if !known[u.GetName()] {
+		return "the Kubernetes node is gone"
+	}
+	if msg, _, _ := unstructured.NestedString(u.Object, "status", "ipam", "operator-status", "error"); msg != "" {
+		return msg
+	}
+	return ""
+}
+
+// DiscoveryHandler serves the Cilium resources discovered in the cluster
+// managed by the adapter handler h. The last discovery of the loop is
+// served for the current context, the others are discovered on request.
+func DiscoveryHandler(h adapter.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler, ok := h.(*Handler)
+		if !ok {
+			http.Error(w, "discovery is not supported", http.StatusNotImplemented)
+			return
+		}
+		name := r.URL.Query().Get("context")
+		target, err := handler.forContext(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		res := handler.discovery.get()
+		if name != "" || res == nil {
+			res, err = target.Discover(r.Context())
+		}
+		switch {
+		case err == ErrNilClient:
+			http.Error(w, "no cluster configured yet", http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,316 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+const ciliumPolicies = "cilium-policies.json"
+
+// policyStateMu guards the policies applied through the adapter, the
+// components of an application are applied concurrently
+var policyStateMu sync.Mutex
+
+// appliedPolicy is a policy as last applied through the adapter
+type appliedPolicy struct {
+	Kind      string                 `json:"kind"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Name      string                 `json:"name"`
+	Spec      map[string]interface{} `json:"spec"`
+	Manifest  string                 `json:"manifest"`
+}
+
+func (p appliedPolicy) key() string {
+	return fmt.Sprintf("%s/%s", p.Kind, qualifiedName(p.Namespace, p.Name))
+}
+
+func (h *Handler) policyStatePath() string {
+	return h.statePath(ciliumPolicies)
+}
+
+func (h *Handler) loadPolicyState() (map[string]appliedPolicy, error) {
+	policies := map[string]appliedPolicy{}
+	byt, err := ioutil.ReadFile(h.policyStatePath())
+	if os.IsNotExist(err) {
+		return policies, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(byt, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// recordPolicy keeps track of a policy applied or deleted through the
+// adapter, as the desired state drift is detected against
+func (h *Handler) recordPolicy(policy appliedPolicy, isDel bool) error {
+	policyStateMu.Lock()
+	defer policyStateMu.Unlock()
+
+	policies, err := h.loadPolicyState()
+	if err != nil {
+		return err
+	}
+	if isDel {
+		delete(policies, policy.key())
+	} else {
+		policies[policy.key()] = policy
+	}
+	byt, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(h.policyStatePath(), byt, 0600)
+}
+
+// Drift is a difference between the state the adapter last applied and the
+// live cluster
+type Drift struct {
+	// Resource is the kind/name of the drifted resource
+	Resource string `json:"resource"`
+	// Field is the setting or the part of the resource which drifted
+	Field   string `json:"field"`
+	Desired string `json:"desired"`
+	Live    string `json:"live"`
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s: %s, applied %s", d.Resource, d.Field, d.Live, d.Desired)
+}
+
+// DriftReport lists the drift found in the cluster
+type DriftReport struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Drifts    []Drift   `json:"drifts"`
+	// Reconciled are the drifts the reconcile operation restored
+	Reconciled []Drift `json:"reconciled,omitempty"`
+}
+
+// detectDrift compares the release and the policies the adapter last
+// applied with the cilium-config ConfigMap, the image of the agents and
+// the policies of the cluster. Only the settings the adapter applied are
+// compared, the defaults of the chart are left out.
+func (h *Handler) detectDrift(ctx context.Context) (*DriftReport, error) {
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+	report := &DriftReport{CheckedAt: time.Now().UTC(), Drifts: []Drift{}}
+
+	state, err := h.loadReleaseState()
+	if err != nil {
+		return nil, ErrDetectDrift(err)
+	}
+	// Nothing was applied through the adapter yet
+	if state.Version != "" {
+		installed, err := h.installedCiliumVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(installed, "v") != strings.TrimPrefix(state.Version, "v") {
+			report.Drifts = append(report.Drifts, Drift{Resource: "DaemonSet/" + ciliumAgentName, Field: "image", Desired: state.Version, Live: installed})
+		}
+
+		cfg, err := h.agentConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		live, _ := importAgentConfig(cfg)
+		keys := make([]string, 0, len(agentSettings))
+		for key := range agentSettings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			desired, ok := lookupValue(state.Values, agentSettings[key].path)
+			if !ok {
+				continue
+			}
+			cur, ok := lookupValue(live, agentSettings[key].path)
+			if !ok || fmt.Sprint(cur) != fmt.Sprint(desired) {
+				liveValue := cfg[key]
+				if !ok {
+					liveValue = "unset"
+				}
+				report.Drifts = append(report.Drifts, Drift{Resource: "ConfigMap/" + ciliumConfigMap, Field: key, Desired: fmt.Sprint(desired), Live: liveValue})
+			}
+		}
+	}
+
+	policies, err := h.loadPolicyState()
+	if err != nil {
+		return nil, ErrDetectDrift(err)
+	}
+	for _, key := range sortedPolicyKeys(policies) {
+		drift, err := h.policyDrift(ctx, policies[key])
+		if err != nil {
+			return nil, ErrDetectDrift(err)
+		}
+		if drift != nil {
+			report.Drifts = append(report.Drifts, *drift)
+		}
+	}
+	return report, nil
+}
+
+func sortedPolicyKeys(policies map[string]appliedPolicy) []string {
+	keys := make([]string, 0, len(policies))
+	for key := range policies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// policyDrift compares the spec of a policy with the one applied
+func (h *Handler) policyDrift(ctx context.Context, policy appliedPolicy) (*Drift, error) {
+	resource := fmt.Sprintf("%s/%s", policy.Kind, qualifiedName(policy.Namespace, policy.Name))
+	var res dynamic.ResourceInterface = h.DynamicKubeClient.Resource(ciliumNetworkPolicyResource).Namespace(policy.Namespace)
+	if policy.Kind == ciliumClusterwideNetworkPolicyKind {
+		res = h.DynamicKubeClient.Resource(ciliumClusterwidePolicyResource)
+	}
+	live, err := res.Get(ctx, policy.Name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return &Drift{Resource: resource, Field: "existence", Desired: "present", Live: "deleted"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Both sides go through JSON so that the numbers compare alike
+	var desired, cur interface{}
+	byt, _ := json.Marshal(policy.Spec)
+	_ = json.Unmarshal(byt, &desired)
+	byt, _ = json.Marshal(live.Object["spec"])
+	_ = json.Unmarshal(byt, &cur)
+	if !reflect.DeepEqual(desired, cur) {
+		return &Drift{Resource: resource, Field: "spec", Desired: "as applied", Live: "modified"}, nil
+	}
+	return nil, nil
+}
+
+// reconcileDrift restores the state the adapter last applied: the release
+// is upgraded again with its values, which restarts the agents when their
+// configuration drifted, and the drifted policies are applied again
+func (h *Handler) reconcileDrift(ctx context.Context) (string, *DriftReport, error) {
+	st := status.Applying
+	report, err := h.detectDrift(ctx)
+	if err != nil {
+		return st, report, err
+	}
+
+	release := false
+	var redo []string
+	for _, d := range report.Drifts {
+		if d.Resource == "DaemonSet/"+ciliumAgentName || d.Resource == "ConfigMap/"+ciliumConfigMap {
+			release = true
+			continue
+		}
+		redo = append(redo, d.Resource)
+	}
+
+	if release {
+		state, err := h.loadReleaseState()
+		if err != nil {
+			return st, report, ErrDetectDrift(err)
+		}
+		reportProgress(ctx, "Reconciling the Cilium release", fmt.Sprintf("Applying Cilium %s with the values last applied.", state.Version))
+		if err := h.applyRelease(state, state.Version, map[string]interface{}{}); err != nil {
+			return st, report, ErrDetectDrift(err)
+		}
+		if _, err := h.restartAgents(ctx); err != nil {
+			return st, report, ErrDetectDrift(err)
+		}
+	}
+
+	policies, err := h.loadPolicyState()
+	if err != nil {
+		return st, report, ErrDetectDrift(err)
+	}
+	for _, key := range sortedPolicyKeys(policies) {
+		policy := policies[key]
+		if !contains(redo, fmt.Sprintf("%s/%s", policy.Kind, qualifiedName(policy.Namespace, policy.Name))) {
+			continue
+		}
+		reportProgress(ctx, "Reconciling policies", key)
+		if err := h.applyManifest(ctx, []byte(policy.Manifest), false, policy.Namespace); err != nil {
+			return st, report, ErrApplyPolicy(policy.Kind, policy.Name, err)
+		}
+	}
+
+	report.Reconciled = report.Drifts
+	report.Drifts = []Drift{}
+	return status.Applied, report, nil
+}
+
+// fingerprint identifies a set of drifts, so that the same drift is only
+// announced once
+func (r *DriftReport) fingerprint() string {
+	lines := make([]string, 0, len(r.Drifts))
+	for _, d := range r.Drifts {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// StartDriftDetection checks the cluster managed by the adapter handler h
+// for drift every interval, and streams an event to Meshery whenever the
+// drift changes, until the adapter shuts down
+func StartDriftDetection(h adapter.Handler, interval time.Duration) {
+	handler, ok := h.(*Handler)
+	if !ok {
+		return
+	}
+	handler.goOperation(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		announced := ""
+		failing := false
+		for {
+			select {
+			case <-handler.lifecycle.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// No cluster configured yet, the next tick checks again
+			if handler.KubeClient == nil || handler.DynamicKubeClient == nil {
+				continue
+			}
+
+			report, err := handler.detectDrift(handler.lifecycle.ctx)
+			if err != nil {
+				if !failing && err != ErrCiliumNotInstalled {
+					handler.Log.Error(err)
+				}
+				failing = true
+				continue
+			}
+			failing = false
+			if fp := report.fingerprint(); fp != announced {
+				announced = fp
+				if len(report.Drifts) == 0 {
+					continue
+				}
+				handler.StreamInfo(&adapter.Event{
+					Summary: fmt.Sprintf("Cilium configuration drifted, %d differences", len(report.Drifts)),
+					Details: fmt.Sprintf("%s\nRun the Reconcile Cilium configuration operation to restore the applied state.", fp),
+				})
+			}
+		}
+	})
+}
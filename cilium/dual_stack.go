@@ -0,0 +1,186 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PreflightFinding is a reason the cluster can't run a feature, found
+// before Cilium is configured with it
+type PreflightFinding struct {
+	Check string `json:"check"`
+	// Node is the node the finding is about, empty for the cluster
+	Node    string `json:"node,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f PreflightFinding) String() string {
+	if f.Node == "" {
+		return fmt.Sprintf("%s: %s", f.Check, f.Message)
+	}
+	return fmt.Sprintf("%s on %s: %s", f.Check, f.Node, f.Message)
+}
+
+// DualStackRequest is the body of the dual-stack operation
+type DualStackRequest struct {
+	// IPv6PodCIDRList and IPv6MaskSize are the IPv6 pod CIDRs of the
+	// cluster-pool IPAM and the size of the CIDR of each node, the chart
+	// defaults to fd00::/104 and /120
+	IPv6PodCIDRList []string `json:"ipv6PodCIDRList,omitempty"`
+	IPv6MaskSize    int      `json:"ipv6MaskSize,omitempty"`
+}
+
+// DualStackReport is the outcome of the dual-stack operation
+type DualStackReport struct {
+	Findings []PreflightFinding `json:"findings"`
+	// AgentsRestarted describes the restart of the agents, empty when the
+	// preflight failed
+	AgentsRestarted string `json:"agentsRestarted,omitempty"`
+}
+
+// configureDualStack enables IPv6 alongside IPv4 on an installed Cilium,
+// once the preflight checks passed. Disabling leaves the pods with IPv4
+// only once they are restarted.
+func (h *Handler) configureDualStack(ctx context.Context, request adapter.OperationRequest) (string, *DualStackReport, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	report := &DualStackReport{Findings: []PreflightFinding{}}
+
+	req := DualStackRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return st, report, ErrConfigureDualStack(err)
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, report, ErrConfigureDualStack(err)
+	}
+
+	values := map[string]interface{}{}
+	if !request.IsDeleteOperation {
+		if cfg["enable-ipv6"] == "true" {
+			return status.Applied, report, nil
+		}
+		report.Findings, err = h.dualStackPreflight(ctx, cfg["ipam"], req)
+		if err != nil {
+			return st, report, ErrConfigureDualStack(err)
+		}
+		if len(report.Findings) > 0 {
+			return st, report, ErrDualStackPreflight(report.Findings)
+		}
+	}
+	dualStackValues(values, !request.IsDeleteOperation, req)
+
+	if err := h.reconfigureCilium(ctx, values); err != nil {
+		return st, report, ErrConfigureDualStack(err)
+	}
+	rollout, err := h.restartAgents(ctx)
+	if err != nil {
+		return st, report, ErrConfigureDualStack(err)
+	}
+	report.AgentsRestarted = rollout.String()
+
+	if request.IsDeleteOperation {
+		return status.Removed, report, nil
+	}
+	return status.Applied, report, nil
+}
+
+// dualStackValues sets the chart values of dual-stack, the IPv6 traffic
+// leaving the cluster is masqueraded like the IPv4 one
+func dualStackValues(values map[string]interface{}, enable bool, req DualStackRequest) {
+	setValue(values, "ipv6.enabled", enable)
+	setValue(values, "enableIPv6Masquerade", enable)
+	if !enable {
+		return
+	}
+	if len(req.IPv6PodCIDRList) > 0 {
+		setValue(values, "ipam.operator.clusterPoolIPv6PodCIDRList", req.IPv6PodCIDRList)
+	}
+	if req.IPv6MaskSize > 0 {
+		setValue(values, "ipam.operator.clusterPoolIPv6MaskSize", req.IPv6MaskSize)
+	}
+}
+
+// dualStackPreflight lists the reasons the cluster can't run dual-stack
+// with the IPAM mode: the nodes need an IPv6 address for the traffic
+// between them, the kubernetes mode takes the IPv6 pod CIDRs from the
+// nodes, and the cloud IPAM modes only give out IPv4 addresses.
+func (h *Handler) dualStackPreflight(ctx context.Context, ipamMode string, req DualStackRequest) ([]PreflightFinding, error) {
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+	if ipamMode == "" {
+		ipamMode = ipamClusterPool
+	}
+
+	findings := []PreflightFinding{}
+	switch ipamMode {
+	case ipamENI, ipamAzure:
+		findings = append(findings, PreflightFinding{Check: "ipam", Message: fmt.Sprintf("IPAM mode %s only allocates IPv4 addresses", ipamMode)})
+	case ipamClusterPool:
+		for _, cidr := range req.IPv6PodCIDRList {
+			ip, ipNet, err := net.ParseCIDR(cidr)
+			switch {
+			case err != nil:
+				findings = append(findings, PreflightFinding{Check: "podCIDR", Message: err.Error()})
+			case ip.To4() != nil:
+				findings = append(findings, PreflightFinding{Check: "podCIDR", Message: fmt.Sprintf("%s is not an IPv6 CIDR", cidr)})
+			case req.IPv6MaskSize > 0:
+				if size, _ := ipNet.Mask.Size(); size > req.IPv6MaskSize {
+					findings = append(findings, PreflightFinding{Check: "podCIDR", Message: fmt.Sprintf("%s is smaller than the /%d CIDR of a node", cidr, req.IPv6MaskSize)})
+				}
+			}
+		}
+		if req.IPv6MaskSize > 126 {
+			findings = append(findings, PreflightFinding{Check: "podCIDR", Message: fmt.Sprintf("ipv6MaskSize %d leaves no addresses for the pods of a node", req.IPv6MaskSize)})
+		}
+	}
+
+	nodes, err := h.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes.Items {
+		if !hasIPv6Address(node) {
+			findings = append(findings, PreflightFinding{Check: "nodeAddress", Node: node.Name, Message: "the node has no IPv6 InternalIP, the pods of other nodes can't reach its pods over IPv6"})
+		}
+		if ipamMode != ipamKubernetes {
+			continue
+		}
+		if !hasIPv6CIDR(node.Spec.PodCIDRs) {
+			findings = append(findings, PreflightFinding{Check: "nodePodCIDR", Node: node.Name, Message: fmt.Sprintf("the kubernetes IPAM takes the pod CIDRs of the node, %s has no IPv6 one, set a dual-stack --cluster-cidr on the controller manager", strings.Join(node.Spec.PodCIDRs, ", "))})
+		}
+	}
+	return findings, nil
+}
+
+func hasIPv6Address(node corev1.Node) bool {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != corev1.NodeInternalIP {
+			continue
+		}
+		if ip := net.ParseIP(addr.Address); ip != nil && ip.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIPv6CIDR(cidrs []string) bool {
+	for _, cidr := range cidrs {
+		if ip, _, err := net.ParseCIDR(cidr); err == nil && ip.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
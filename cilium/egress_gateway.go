@@ -0,0 +1,72 @@
+package cilium
+
+import (
+	"context"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+)
+
+const ciliumEgressGatewayPolicyKind = "CiliumEgressGatewayPolicy"
+
+// egressGatewayEnabled reports whether the agents run with the egress
+// gateway and the BPF masquerading it depends on
+func egressGatewayEnabled(cfg map[string]string) bool {
+	return cfg["enable-ipv4-egress-gateway"] == "true" && cfg["enable-bpf-masquerade"] == "true"
+}
+
+// kubeProxyReplacementEnabled reports whether the agents replace kube-proxy,
+// whatever the notation of the installed version
+func kubeProxyReplacementEnabled(cfg map[string]string) bool {
+	switch cfg["kube-proxy-replacement"] {
+	case "strict", "partial", "true":
+		return true
+	}
+	return false
+}
+
+// configureEgressGateway enables the egress gateway along with the
+// features it requires, BPF masquerading and the kube-proxy replacement,
+// unless they are already enabled. Disabling only turns off the egress
+// gateway itself.
+func (h *Handler) configureEgressGateway(ctx context.Context, del bool) (string, string, error) {
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrConfigureEgressGateway(err)
+	}
+
+	values := map[string]interface{}{}
+	if del {
+		setValue(values, "egressGateway.enabled", false)
+	} else {
+		if egressGatewayEnabled(cfg) {
+			return status.Applied, "egress gateway already enabled, agents not restarted", nil
+		}
+		setValue(values, "egressGateway.enabled", true)
+		setValue(values, "bpf.masquerade", true)
+		if !kubeProxyReplacementEnabled(cfg) {
+			if err := h.kubeProxyReplacementValues(ctx, values, true); err != nil {
+				return st, "", ErrConfigureEgressGateway(err)
+			}
+		}
+	}
+
+	return h.toggleAgentFeature(ctx, del, values, ErrConfigureEgressGateway)
+}
+
+// checkEgressGateway fails the apply of an egress gateway policy early
+// when the agents would ignore it
+func (h *Handler) checkEgressGateway(ctx context.Context) error {
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return ErrConfigureEgressGateway(err)
+	}
+	if !egressGatewayEnabled(cfg) {
+		return ErrEgressGatewayDisabled
+	}
+	return nil
+}
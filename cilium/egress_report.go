@@ -0,0 +1,362 @@
+package cilium
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Number of recent flows inspected on every agent
+	egressFlowsPerNode = "2000"
+	// Number of destinations listed per workload
+	maxObservedDestinations = 10
+)
+
+var (
+	egressGatewayPolicyResource = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumegressgatewaypolicies"}
+	egressNATPolicyResource     = schema.GroupVersionResource{Group: "cilium.io", Version: "v2alpha1", Resource: "ciliumegressnatpolicies"}
+)
+
+// EgressAssignment is an egress IP assigned to a workload by a policy
+type EgressAssignment struct {
+	Policy           string   `json:"policy"`
+	EgressIP         string   `json:"egressIP,omitempty"`
+	GatewayNodes     []string `json:"gatewayNodes,omitempty"`
+	DestinationCIDRs []string `json:"destinationCIDRs"`
+}
+
+// WorkloadEgress lists the egress IPs used by a workload
+type WorkloadEgress struct {
+	Workload string             `json:"workload"`
+	Pods     int                `json:"pods"`
+	Policies []EgressAssignment `json:"policies,omitempty"`
+	// NodeIPs are the addresses the traffic leaving the cluster outside of
+	// any egress policy is masqueraded to
+	NodeIPs              []string `json:"nodeIPs,omitempty"`
+	ObservedFlows        int      `json:"observedFlows"`
+	ObservedDestinations []string `json:"observedDestinations,omitempty"`
+}
+
+// NamespaceEgress lists the egress IPs used by the workloads of a namespace
+type NamespaceEgress struct {
+	Namespace string            `json:"namespace"`
+	Workloads []*WorkloadEgress `json:"workloads"`
+}
+
+// EgressIPReport maps the workloads to the egress IPs their traffic uses
+type EgressIPReport struct {
+	Namespaces []NamespaceEgress `json:"namespaces"`
+	// Warnings lists the data which could not be collected
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// egressPolicy is the part of an egress gateway or egress NAT policy the
+// report is built from
+type egressPolicy struct {
+	name              string
+	selectors         []map[string]interface{}
+	destinationCIDRs  []string
+	egressIP          string
+	gatewayNodeLabels interface{}
+}
+
+// egressIPReport maps namespaces and workloads to the egress IPs their
+// traffic leaves the cluster with, combining the egress policies with the
+// flows to the world observed by Hubble
+func (h *Handler) egressIPReport(ctx context.Context) (*EgressIPReport, error) {
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+	report := &EgressIPReport{}
+
+	policies, warnings := h.egressPolicies(ctx)
+	report.Warnings = append(report.Warnings, warnings...)
+
+	nodes, err := h.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrEgressIPReport(err)
+	}
+	nodeIPs := map[string]string{}
+	for _, node := range nodes.Items {
+		nodeIPs[node.Name] = nodeAddress(node)
+	}
+
+	workloads := map[string]*WorkloadEgress{}
+	workloadNodes := map[string]map[string]bool{}
+	pods, err := h.KubeClient.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrEgressIPReport(err)
+	}
+	podWorkloads := map[string]string{}
+	for _, pod := range pods.Items {
+		if pod.Spec.HostNetwork {
+			continue
+		}
+		key := pod.Namespace + "/" + podWorkload(pod)
+		podWorkloads[pod.Namespace+"/"+pod.Name] = key
+		w, ok := workloads[key]
+		if !ok {
+			w = &WorkloadEgress{Workload: podWorkload(pod)}
+			workloads[key] = w
+			workloadNodes[key] = map[string]bool{}
+		}
+		w.Pods++
+		if pod.Spec.NodeName != "" {
+			workloadNodes[key][pod.Spec.NodeName] = true
+		}
+	}
+
+	// Assign the policies to the workloads they select
+	for _, policy := range policies {
+		assignment := EgressAssignment{Policy: policy.name, EgressIP: policy.egressIP, DestinationCIDRs: policy.destinationCIDRs}
+		if policy.gatewayNodeLabels != nil {
+			assignment.GatewayNodes, err = h.gatewayNodes(ctx, policy.gatewayNodeLabels, nodeIPs)
+			if err != nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %s", policy.name, err))
+			}
+		}
+
+		for _, sel := range policy.selectors {
+			selected, err := h.selectedPods(ctx, sel)
+			if err != nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %s", policy.name, err))
+				continue
+			}
+			seen := map[string]bool{}
+			for _, pod := range selected {
+				key, ok := podWorkloads[pod]
+				if !ok || seen[key] {
+					continue
+				}
+				seen[key] = true
+				workloads[key].Policies = append(workloads[key].Policies, assignment)
+			}
+		}
+	}
+
+	// Count the flows to the world observed by every agent
+	for _, node := range nodes.Items {
+		flows, err := h.worldFlows(ctx, node.Name)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("flows of node %s: %s", node.Name, err))
+			continue
+		}
+		for pod, destinations := range flows {
+			key, ok := podWorkloads[pod]
+			if !ok {
+				continue
+			}
+			w := workloads[key]
+			w.ObservedFlows += len(destinations)
+			for _, d := range destinations {
+				if len(w.ObservedDestinations) < maxObservedDestinations && !contains(w.ObservedDestinations, d) {
+					w.ObservedDestinations = append(w.ObservedDestinations, d)
+				}
+			}
+		}
+	}
+
+	// Only the workloads covered by a policy or seen leaving the cluster
+	// are of interest for allow-listing
+	byNamespace := map[string][]*WorkloadEgress{}
+	for key, w := range workloads {
+		if len(w.Policies) == 0 && w.ObservedFlows == 0 {
+			continue
+		}
+		for node := range workloadNodes[key] {
+			if ip := nodeIPs[node]; ip != "" && !contains(w.NodeIPs, ip) {
+				w.NodeIPs = append(w.NodeIPs, ip)
+			}
+		}
+		sort.Strings(w.NodeIPs)
+		namespace := strings.SplitN(key, "/", 2)[0]
+		byNamespace[namespace] = append(byNamespace[namespace], w)
+	}
+	for namespace, list := range byNamespace {
+		sort.Slice(list, func(i, j int) bool { return list[i].Workload < list[j].Workload })
+		report.Namespaces = append(report.Namespaces, NamespaceEgress{Namespace: namespace, Workloads: list})
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool { return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace })
+
+	return report, nil
+}
+
+// egressPolicies reads the egress gateway policies along with the egress
+// NAT policies they replaced in Cilium 1.12
+func (h *Handler) egressPolicies(ctx context.Context) ([]egressPolicy, []string) {
+	var res []egressPolicy
+	var warnings []string
+
+	if list, err := h.DynamicKubeClient.Resource(egressGatewayPolicyResource).List(ctx, metav1.ListOptions{}); err == nil {
+		for _, item := range list.Items {
+			p := egressPolicy{name: ciliumEgressGatewayPolicyKind + "/" + item.GetName()}
+			p.selectors = nestedMaps(item.Object, "spec", "selectors")
+			p.destinationCIDRs, _, _ = unstructured.NestedStringSlice(item.Object, "spec", "destinationCIDRs")
+			p.egressIP, _, _ = unstructured.NestedString(item.Object, "spec", "egressGateway", "egressIP")
+			p.gatewayNodeLabels, _, _ = unstructured.NestedFieldNoCopy(item.Object, "spec", "egressGateway", "nodeSelector")
+			res = append(res, p)
+		}
+	} else {
+		warnings = append(warnings, fmt.Sprintf("egress gateway policies: %s", err))
+	}
+
+	if list, err := h.DynamicKubeClient.Resource(egressNATPolicyResource).List(ctx, metav1.ListOptions{}); err == nil {
+		for _, item := range list.Items {
+			p := egressPolicy{name: "CiliumEgressNATPolicy/" + item.GetName()}
+			p.selectors = nestedMaps(item.Object, "spec", "egress")
+			p.destinationCIDRs, _, _ = unstructured.NestedStringSlice(item.Object, "spec", "destinationCIDRs")
+			p.egressIP, _, _ = unstructured.NestedString(item.Object, "spec", "egressSourceIP")
+			res = append(res, p)
+		}
+	}
+
+	return res, warnings
+}
+
+// selectedPods returns the pods, as namespace/name, selected by the pod and
+// namespace selectors of an egress policy
+func (h *Handler) selectedPods(ctx context.Context, sel map[string]interface{}) ([]string, error) {
+	namespaces := []string{""}
+	if nsSel, ok := sel["namespaceSelector"]; ok {
+		selector, _, err := podSelector(nsSel, "")
+		if err != nil {
+			return nil, err
+		}
+		list, err := h.KubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, err
+		}
+		namespaces = namespaces[:0]
+		for _, ns := range list.Items {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+
+	podSel, ok := sel["podSelector"]
+	if !ok {
+		podSel = map[string]interface{}{}
+	}
+
+	var res []string
+	for _, ns := range namespaces {
+		selector, namespace, err := podSelector(podSel, ns)
+		if err != nil {
+			return nil, err
+		}
+		pods, err := h.KubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods.Items {
+			res = append(res, pod.Namespace+"/"+pod.Name)
+		}
+	}
+	return res, nil
+}
+
+// gatewayNodes returns the addresses of the nodes matching the node
+// selector of an egress gateway
+func (h *Handler) gatewayNodes(ctx context.Context, nodeSel interface{}, nodeIPs map[string]string) ([]string, error) {
+	selector, _, err := podSelector(nodeSel, "")
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := h.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, node := range nodes.Items {
+		res = append(res, fmt.Sprintf("%s (%s)", node.Name, nodeIPs[node.Name]))
+	}
+	return res, nil
+}
+
+// worldFlows returns the destinations of the recent flows leaving the
+// cluster observed by the agent of a node, by source pod
+func (h *Handler) worldFlows(ctx context.Context, node string) (map[string][]string, error) {
+	pod, err := h.agentPod(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	out, err := h.execInAgent(pod, []string{"hubble", "observe", "--output", "json", "--last", egressFlowsPerNode, "--to-identity", "world"})
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string][]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			Flow struct {
+				IP struct {
+					Destination string `json:"destination"`
+				} `json:"IP"`
+				Source struct {
+					Namespace string `json:"namespace"`
+					PodName   string `json:"pod_name"`
+				} `json:"source"`
+			} `json:"flow"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Flow.Source.PodName == "" {
+			continue
+		}
+		key := line.Flow.Source.Namespace + "/" + line.Flow.Source.PodName
+		res[key] = append(res[key], line.Flow.IP.Destination)
+	}
+	return res, scanner.Err()
+}
+
+// podWorkload names the workload owning a pod
+func podWorkload(pod corev1.Pod) string {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		if ref.Kind == "ReplicaSet" {
+			if hash := pod.Labels["pod-template-hash"]; hash != "" {
+				return "Deployment/" + strings.TrimSuffix(ref.Name, "-"+hash)
+			}
+		}
+		return ref.Kind + "/" + ref.Name
+	}
+	return "Pod/" + pod.Name
+}
+
+// nodeAddress returns the address of a node traffic is masqueraded to,
+// preferring the external address
+func nodeAddress(node corev1.Node) string {
+	var internal string
+	for _, addr := range node.Status.Addresses {
+		switch addr.Type {
+		case corev1.NodeExternalIP:
+			return addr.Address
+		case corev1.NodeInternalIP:
+			if internal == "" {
+				internal = addr.Address
+			}
+		}
+	}
+	return internal
+}
+
+func nestedMaps(obj map[string]interface{}, fields ...string) []map[string]interface{} {
+	list, _, _ := unstructured.NestedSlice(obj, fields...)
+	var res []map[string]interface{}
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
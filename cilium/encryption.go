@@ -0,0 +1,81 @@
+package cilium
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	encryptionWireguard = "wireguard"
+	encryptionIPsec     = "ipsec"
+
+	ipsecSecretName = "cilium-ipsec-keys"
+	ipsecKeyLength  = 20
+)
+
+// configureEncryption enables or disables transparent node-to-node encryption
+// and restarts the agents so that the new datapath configuration takes effect
+func (h *Handler) configureEncryption(ctx context.Context, del bool, mode string) (string, string, error) {
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	values := map[string]interface{}{}
+	if del {
+		setValue(values, "encryption.enabled", false)
+	} else {
+		switch mode {
+		case encryptionWireguard:
+		case encryptionIPsec:
+			if err := h.ensureIPsecSecret(ctx); err != nil {
+				return st, "", ErrConfigureEncryption(err)
+			}
+		default:
+			return st, "", ErrConfigureEncryption(fmt.Errorf("unsupported encryption type %q", mode))
+		}
+		setValue(values, "encryption.enabled", true)
+		setValue(values, "encryption.type", mode)
+	}
+
+	return h.toggleAgentFeature(ctx, del, values, ErrConfigureEncryption)
+}
+
+// ensureIPsecSecret creates the secret holding the IPsec pre-shared key
+// unless it already exists
+func (h *Handler) ensureIPsecSecret(ctx context.Context) error {
+	if h.KubeClient == nil {
+		return ErrNilClient
+	}
+
+	_, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, ipsecSecretName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	key := make([]byte, ipsecKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	_, err = h.KubeClient.CoreV1().Secrets(ciliumNamespace).Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ipsecSecretName,
+			Namespace: ciliumNamespace,
+		},
+		StringData: map[string]string{
+			"keys": fmt.Sprintf("3 rfc4106(gcm(aes)) %s 128", hex.EncodeToString(key)),
+		},
+	}, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,95 @@
+package cilium
+
+import (
+	"context"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Labels identifying the Meshery environment and workspace a resource was
+// created for, so that Meshery can filter and clean up resources per
+// environment across clusters
+const (
+	environmentLabel = "meshery.io/environment-id"
+	workspaceLabel   = "meshery.io/workspace-id"
+)
+
+type environmentKey struct{}
+
+// requestEnvironment reads the environment and workspace identifiers passed
+// in the body of an operation
+func requestEnvironment(body string) map[string]string {
+	ids := struct {
+		EnvironmentID string `json:"environmentID"`
+		WorkspaceID   string `json:"workspaceID"`
+	}{}
+	// Bodies which are not YAML simply carry no identifiers
+	_ = yaml.Unmarshal([]byte(body), &ids)
+
+	labels := map[string]string{}
+	if ids.EnvironmentID != "" {
+		labels[environmentLabel] = ids.EnvironmentID
+	}
+	if ids.WorkspaceID != "" {
+		labels[workspaceLabel] = ids.WorkspaceID
+	}
+	return labels
+}
+
+// componentEnvironment returns the environment and workspace identifiers
+// set on an OAM component, as labels or as annotations
+func componentEnvironment(annotations, labels map[string]string) map[string]string {
+	res := map[string]string{}
+	for _, key := range []string{environmentLabel, workspaceLabel} {
+		if v := annotations[key]; v != "" {
+			res[key] = v
+		}
+		if v := labels[key]; v != "" {
+			res[key] = v
+		}
+	}
+	return res
+}
+
+// withEnvironment returns a context carrying the environment labels, every
+// resource applied with it is labeled with them
+func withEnvironment(ctx context.Context, labels map[string]string) context.Context {
+	if len(labels) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, environmentKey{}, labels)
+}
+
+// environmentFrom returns the environment labels carried by ctx
+func environmentFrom(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(environmentKey{}).(map[string]string)
+	return labels
+}
+
+// labelDocument adds labels to the metadata of a single manifest document
+func labelDocument(contents string, labels map[string]string) (string, error) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(contents), &doc); err != nil {
+		return "", err
+	}
+
+	metadata, _ := doc["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		doc["metadata"] = metadata
+	}
+	existing, _ := metadata["labels"].(map[string]interface{})
+	if existing == nil {
+		existing = map[string]interface{}{}
+		metadata["labels"] = existing
+	}
+	for k, v := range labels {
+		existing[k] = v
+	}
+
+	byt, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(byt), nil
+}
@@ -0,0 +1,80 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+)
+
+const (
+	ciliumEnvoyConfigKind            = "CiliumEnvoyConfig"
+	ciliumClusterwideEnvoyConfigKind = "CiliumClusterwideEnvoyConfig"
+)
+
+// envoyConfigEnabled reports whether the agents run the embedded Envoy
+// with the CiliumEnvoyConfig resources
+func envoyConfigEnabled(cfg map[string]string) bool {
+	return cfg["enable-envoy-config"] == "true" && cfg["enable-l7-proxy"] != "false"
+}
+
+// configureEnvoyConfig enables the CiliumEnvoyConfig resources along with
+// the L7 proxy and the kube-proxy replacement the agents redirect the
+// services to Envoy with, unless they are already enabled. From Cilium 1.13
+// the services annotated with service.cilium.io/lb-l7 are load balanced by
+// Envoy as well. Disabling only turns off the CiliumEnvoyConfig resources.
+func (h *Handler) configureEnvoyConfig(ctx context.Context, del bool) (string, string, error) {
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	version, err := h.ciliumVersion(ctx)
+	if err != nil {
+		return st, "", ErrConfigureEnvoyConfig(err)
+	}
+	if !versionAtLeast(version, 1, 12) {
+		return st, "", ErrConfigureEnvoyConfig(fmt.Errorf("CiliumEnvoyConfig requires Cilium 1.12 or newer, %s is installed", version))
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrConfigureEnvoyConfig(err)
+	}
+
+	values := map[string]interface{}{}
+	// Cilium 1.14 turned the agent flag into a value of the chart
+	if versionAtLeast(version, 1, 14) {
+		setValue(values, "envoyConfig.enabled", !del)
+	} else {
+		setValue(values, "extraConfig.enable-envoy-config", fmt.Sprint(!del))
+	}
+	if !del {
+		if envoyConfigEnabled(cfg) {
+			return status.Applied, "CiliumEnvoyConfig already enabled, agents not restarted", nil
+		}
+		setValue(values, "l7Proxy", true)
+		if versionAtLeast(version, 1, 13) {
+			setValue(values, "loadBalancer.l7.backend", "envoy")
+		}
+		if !kubeProxyReplacementEnabled(cfg) {
+			if err := h.kubeProxyReplacementValues(ctx, values, true); err != nil {
+				return st, "", ErrConfigureEnvoyConfig(err)
+			}
+		}
+	}
+
+	return h.toggleAgentFeature(ctx, del, values, ErrConfigureEnvoyConfig)
+}
+
+// checkEnvoyConfig fails the apply of a CiliumEnvoyConfig early when the
+// agents would ignore it
+func (h *Handler) checkEnvoyConfig(ctx context.Context) error {
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return ErrConfigureEnvoyConfig(err)
+	}
+	if !envoyConfigEnabled(cfg) {
+		return ErrEnvoyConfigDisabled
+	}
+	return nil
+}
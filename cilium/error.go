@@ -2,6 +2,9 @@
 package cilium
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/layer5io/meshkit/errors"
 )
 
@@ -107,11 +110,308 @@ var (
 
 	//ErrLoadNamespaceCode occur during the process of applying namespace
 	ErrLoadNamespaceCode = "1024"
+
+	// ErrSecurityReportCode represents the errors which are generated
+	// while collecting the ServiceAccount security report
+	ErrSecurityReportCode = "1025"
+
+	// ErrReconfigureCiliumCode represents the errors which are generated
+	// while upgrading the Cilium release with new values
+	ErrReconfigureCiliumCode = "1031"
+
+	// ErrRolloutDaemonSetCode represents the errors which are generated
+	// while restarting or waiting for a DaemonSet rollout
+	ErrRolloutDaemonSetCode = "1032"
+
+	// ErrConfigureEncryptionCode represents the errors which are generated
+	// while toggling transparent encryption
+	ErrConfigureEncryptionCode = "1033"
+
+	// ErrKubeProxyReplacementCode represents the errors which are generated
+	// while toggling the kube-proxy replacement
+	ErrKubeProxyReplacementCode = "1035"
+
+	// ErrApplyManifestCode represents the errors which are generated
+	// while applying a multi-document manifest
+	ErrApplyManifestCode = "1036"
+
+	// ErrInstallTetragonCode represents the errors which are generated
+	// while installing or removing Tetragon
+	ErrInstallTetragonCode = "1040"
+
+	// ErrRunPipelineCode represents the errors which are generated
+	// while running a pipeline
+	ErrRunPipelineCode = "1042"
+
+	// ErrValidatePolicyCode represents the errors which are generated
+	// while a Cilium policy could not be validated
+	ErrValidatePolicyCode = "1043"
+
+	// ErrInvalidPolicyCode represents the errors which are generated
+	// when a Cilium policy fails validation
+	ErrInvalidPolicyCode = "1044"
+
+	// ErrUpgradeCRDsCode represents the errors which are generated
+	// while upgrading the Cilium CRDs
+	ErrUpgradeCRDsCode = "1045"
+
+	// ErrAgentExecCode represents the errors which are generated
+	// while running commands in a Cilium agent
+	ErrAgentExecCode = "1046"
+
+	// ErrPolicyAuditModeCode represents the errors which are generated
+	// while toggling the policy audit mode of endpoints
+	ErrPolicyAuditModeCode = "1047"
+
+	// ErrConfigureEgressGatewayCode represents the errors which are generated
+	// while toggling the egress gateway
+	ErrConfigureEgressGatewayCode = "1048"
+
+	// ErrEgressGatewayDisabledCode represents the error which is generated
+	// when an egress gateway policy is applied while the feature is disabled
+	ErrEgressGatewayDisabledCode = "1049"
+
+	// ErrTrafficMirrorCode represents the errors which are generated
+	// while setting up or tearing down a traffic mirror
+	ErrTrafficMirrorCode = "1050"
+
+	// ErrPolicyConvergenceCode represents the errors which are generated
+	// when an applied policy is not enforced by the selected endpoints
+	ErrPolicyConvergenceCode = "1051"
+
+	// ErrProbeFeaturesCode represents the errors which are generated
+	// while probing the datapath features of the nodes
+	ErrProbeFeaturesCode = "1052"
+
+	// ErrEgressIPReportCode represents the errors which are generated
+	// while building the egress IP report
+	ErrEgressIPReportCode = "1053"
+
+	// ErrCoordinateOperationCode represents the errors which are generated
+	// when an operation can't take the cluster lock from another adapter
+	ErrCoordinateOperationCode = "1055"
+
+	// ErrExposeHubbleUICode represents the errors which are generated
+	// while exposing the Hubble UI through the ingress controller
+	ErrExposeHubbleUICode = "1060"
+
+	// ErrPolicyTestCode represents the errors which are generated
+	// while running a policy test bundle or when its assertions fail
+	ErrPolicyTestCode = "1061"
+
+	// ErrListReportCode represents the error which occurs while listing
+	// a page of a report
+	ErrListReportCode = "1062"
+
+	// ErrKubeContextCode represents the error which occurs when the
+	// Kubernetes context targeted by an operation can't be used
+	ErrKubeContextCode = "1063"
+
+	// ErrSelfTestCode represents the error which occurs when checks of
+	// the self-test fail
+	ErrSelfTestCode = "1067"
+
+	// ErrApplyPolicyCode represents the errors which are generated
+	// while applying or deleting a Cilium policy component
+	ErrApplyPolicyCode = "1070"
+
+	// ErrGrafanaDashboardsCode represents the errors which are generated
+	// while generating or installing the Grafana dashboards
+	ErrGrafanaDashboardsCode = "1071"
+
+	// ErrPurgeCiliumCode represents the errors which are generated while
+	// removing the resources left behind by the uninstall of Cilium
+	ErrPurgeCiliumCode = "1075"
+
+	// ErrWriteKubeconfigCode represents the errors which are generated
+	// while writing the kubeconfig the Cilium CLIs run with
+	ErrWriteKubeconfigCode = "1078"
+
+	// ErrWorkloadAnnotationsCode represents the errors which are generated
+	// while annotating the workloads for the features of Cilium
+	ErrWorkloadAnnotationsCode = "1079"
+
+	// ErrCiliumStatusCode represents the errors which are generated while
+	// collecting the status of the Cilium installation
+	ErrCiliumStatusCode = "1080"
+
+	// ErrHubbleExportCode represents the errors which are generated while
+	// configuring the export of the Hubble flows
+	ErrHubbleExportCode = "1082"
+
+	// ErrHubbleMetricsCode represents the errors which are generated while
+	// configuring the Hubble metrics
+	ErrHubbleMetricsCode = "1083"
+
+	// ErrOperationConflictCode represents the errors which are generated
+	// when a mutating operation targets a cluster another one is running on
+	ErrOperationConflictCode = "1084"
+
+	// ErrMonitoringAddonCode represents the errors which are generated
+	// while provisioning the ServiceMonitors and dashboards of Cilium
+	ErrMonitoringAddonCode = "1085"
+
+	// ErrFQDNEgressCode represents the errors which are generated while
+	// applying the FQDNEgress trait
+	ErrFQDNEgressCode = "1086"
+
+	// ErrPolicyRecommendationCode represents the errors which are
+	// generated while recommending policies from the observed flows
+	ErrPolicyRecommendationCode = "1087"
+
+	// ErrClusterwideLockoutCode represents the warnings which are generated
+	// when a clusterwide policy may cut kube-system or the adapter off
+	ErrClusterwideLockoutCode = "1088"
+
+	// ErrL7HTTPPolicyCode represents the errors which are generated
+	// while applying the L7HTTPPolicy trait
+	ErrL7HTTPPolicyCode = "1089"
+
+	// ErrConfigureEnvoyConfigCode represents the errors which are generated
+	// while enabling the CiliumEnvoyConfig resources
+	ErrConfigureEnvoyConfigCode = "1090"
+
+	// ErrEnvoyConfigDisabledCode represents the error which is generated
+	// when a CiliumEnvoyConfig is applied while the agents ignore it
+	ErrEnvoyConfigDisabledCode = "1091"
+
+	// ErrConfigureMutualAuthCode represents the errors which are generated
+	// while enabling the mutual authentication or requiring it in policies
+	ErrConfigureMutualAuthCode = "1092"
+
+	// ErrConfigureBGPCode represents the errors which are generated
+	// while toggling the BGP control plane
+	ErrConfigureBGPCode = "1093"
+
+	// ErrBGPControlPlaneDisabledCode represents the error which is generated
+	// when a BGP resource is applied while the BGP control plane is disabled
+	ErrBGPControlPlaneDisabledCode = "1094"
+
+	// ErrConfigureBandwidthManagerCode represents the errors which are
+	// generated while toggling the bandwidth manager
+	ErrConfigureBandwidthManagerCode = "1095"
+
+	// ErrConfigureIPAMCode represents the errors which are generated
+	// while validating the IPAM of an install
+	ErrConfigureIPAMCode = "1096"
+
+	// ErrConfigureDualStackCode represents the errors which are generated
+	// while enabling dual-stack
+	ErrConfigureDualStackCode = "1097"
+
+	// ErrDualStackPreflightCode represents the error which is generated
+	// when the cluster can't run dual-stack
+	ErrDualStackPreflightCode = "1098"
+
+	// ErrRollingUpgradeCode represents the errors which are generated
+	// during the rolling upgrade of Cilium
+	ErrRollingUpgradeCode = "1099"
+
+	// ErrPerformanceTestCode represents the errors which are generated
+	// while running a performance test
+	ErrPerformanceTestCode = "1101"
+
+	// ErrDiscoveryCode represents the errors which are generated while
+	// discovering the Cilium resources of the cluster
+	ErrDiscoveryCode = "1102"
+
+	// ErrExportCiliumCode represents the errors which are generated while
+	// exporting the configuration of Cilium
+	ErrExportCiliumCode = "1103"
+
+	// ErrDetectDriftCode represents the errors which are generated while
+	// detecting or reconciling the drift of the Cilium configuration
+	ErrDetectDriftCode = "1104"
+
+	// ErrCustomManifestCode represents the errors which are generated while
+	// validating or applying a custom manifest
+	ErrCustomManifestCode = "1105"
+
+	// ErrConfigureHostFirewallCode represents the errors which are
+	// generated while toggling the host firewall
+	ErrConfigureHostFirewallCode = "1116"
+
+	// ErrHostFirewallDisabledCode represents the warning which is generated
+	// when a host policy is applied while the host firewall is disabled
+	ErrHostFirewallDisabledCode = "1117"
+
+	// ErrConfigureLocalRedirectPolicyCode represents the errors which are
+	// generated while toggling the local redirect policies
+	ErrConfigureLocalRedirectPolicyCode = "1118"
+
+	// ErrLocalRedirectPolicyDisabledCode represents the error which is
+	// generated when a local redirect policy is applied while the feature
+	// is disabled
+	ErrLocalRedirectPolicyDisabledCode = "1119"
+
+	// ErrNodeHealthReportCode represents the errors which are generated
+	// while collecting the health of the nodes
+	ErrNodeHealthReportCode = "1120"
+
+	// ErrNodeUnhealthyCode represents the error which is generated when
+	// the agent or the endpoints of a node are not healthy
+	ErrNodeUnhealthyCode = "1121"
+
+	// ErrOperationCancelledCode represents the error which is generated
+	// when an operation is cancelled before it completed
+	ErrOperationCancelledCode = "1123"
+
+	// ErrOperationTimedOutCode represents the error which is generated
+	// when an operation runs past its timeout
+	ErrOperationTimedOutCode = "1124"
+
+	// ErrCancelOperationCode represents the errors which are generated
+	// while cancelling the running operations
+	ErrCancelOperationCode = "1125"
+
+	// ErrConfigureRegistryCode represents the errors which are generated
+	// when the private registry of an install is invalid
+	ErrConfigureRegistryCode = "1126"
+
+	// ErrConfigureHubbleRelayCode represents the errors which are generated
+	// while enabling Hubble Relay with TLS
+	ErrConfigureHubbleRelayCode = "1127"
+
+	// ErrKubernetesValuesCode represents the errors which are generated
+	// while selecting the chart values for the Kubernetes version of the
+	// cluster
+	ErrKubernetesValuesCode = "1128"
+
+	// ErrCleanupCode represents the errors which are generated while
+	// removing the test resources deployed by the adapter
+	ErrCleanupCode = "1129"
+
+	// ErrPolicyLintCode represents the errors which are generated while
+	// linting the Cilium network policies of the cluster
+	ErrPolicyLintCode = "1130"
+
+	// ErrCiliumNotInstalledCode represents the error which is generated
+	// when an operation requires a running Cilium installation
+	ErrCiliumNotInstalledCode = "1034"
+
+	// ErrCiliumNotInstalled represents the error which is generated
+	// when an operation requires a running Cilium installation
+	ErrCiliumNotInstalled = errors.New(ErrCiliumNotInstalledCode, errors.Alert, []string{"Cilium is not installed"}, []string{"The cilium DaemonSet was not found in kube-system"}, []string{"Cilium has not been installed in the cluster", "Cilium is installed in a different namespace"}, []string{"Install Cilium before running this operation"})
+
+	// ErrEgressGatewayDisabled is the error when an egress gateway policy is applied while the feature is disabled
+	ErrEgressGatewayDisabled = errors.New(ErrEgressGatewayDisabledCode, errors.Alert, []string{"Egress gateway is disabled"}, []string{"CiliumEgressGatewayPolicy resources are ignored by the agents unless the egress gateway is enabled"}, []string{"The egress gateway feature flag is off"}, []string{"Run the egress gateway operation to enable the feature before applying the policy"})
+
+	// ErrEnvoyConfigDisabled is the error when a CiliumEnvoyConfig is applied while the agents ignore it
+	ErrEnvoyConfigDisabled = errors.New(ErrEnvoyConfigDisabledCode, errors.Alert, []string{"CiliumEnvoyConfig is disabled"}, []string{"CiliumEnvoyConfig and CiliumClusterwideEnvoyConfig resources are ignored by the agents unless the embedded Envoy is enabled"}, []string{"The enable-envoy-config flag of the agents is off", "The L7 proxy of the agents is disabled"}, []string{"Run the Envoy L7 proxy operation before applying the configuration"})
+
+	// ErrHostFirewallDisabled is the warning when a host policy is applied while the host firewall is disabled
+	ErrHostFirewallDisabled = errors.New(ErrHostFirewallDisabledCode, errors.Alert, []string{"Host firewall is disabled"}, []string{"The host policies are not enforced by the agents unless the host firewall is enabled"}, []string{"The host firewall feature flag is off"}, []string{"Run the host firewall operation to enforce the host policies"})
+
+	// ErrLocalRedirectPolicyDisabled is the error when a local redirect policy is applied while the feature is disabled
+	ErrLocalRedirectPolicyDisabled = errors.New(ErrLocalRedirectPolicyDisabledCode, errors.Alert, []string{"Local redirect policies are disabled"}, []string{"CiliumLocalRedirectPolicy resources are ignored by the agents unless the local redirect policies are enabled"}, []string{"The enable-local-redirect-policy flag of the agents is off"}, []string{"Run the local redirect policy operation to enable the feature before applying the policy"})
+
+	// ErrBGPControlPlaneDisabled is the error when a BGP resource is applied while the BGP control plane is disabled
+	ErrBGPControlPlaneDisabled = errors.New(ErrBGPControlPlaneDisabledCode, errors.Alert, []string{"BGP control plane is disabled"}, []string{"CiliumBGPPeeringPolicy and CiliumBGPClusterConfig resources are ignored by the agents unless the BGP control plane is enabled"}, []string{"The BGP control plane feature flag is off"}, []string{"Run the BGP control plane operation before applying the configuration"})
 )
 
 // ErrInstallCilium is the error for install mesh
 func ErrInstallCilium(err error) error {
-	return errors.New(ErrInstallCiliumCode, errors.Alert, []string{"Error with Cilium operation"}, []string{"Error occured while installing Cilium mesh through Cilium", err.Error()}, []string{}, []string{})
+	return errors.New(ErrInstallCiliumCode, errors.Alert, []string{"Error with Cilium operation"}, []string{"Error occured while installing Cilium mesh through Cilium", err.Error()}, []string{"The Cilium agents did not become ready", "The Cilium CRDs were not registered by the agents in time"}, []string{"Inspect the logs of the cilium agent and operator pods in kube-system"})
 }
 
 // ErrTarXZF is the error for unzipping the file
@@ -121,22 +421,22 @@ func ErrTarXZF(err error) error {
 
 // ErrMeshConfig is the error for mesh config
 func ErrMeshConfig(err error) error {
-	return errors.New(ErrMeshConfigCode, errors.Alert, []string{"Error configuration mesh"}, []string{err.Error(), "Error getting MeshSpecKey config from in-memory configuration"}, []string{}, []string{"Reconnect the adaptor to the meshkit server"})
+	return errors.New(ErrMeshConfigCode, errors.Alert, []string{"Error configuration mesh"}, []string{err.Error(), "Error getting MeshSpecKey config from in-memory configuration"}, []string{"The adapter configuration was not initialized"}, []string{"Reconnect the adaptor to the meshkit server"})
 }
 
 // ErrRunCiliumCmd is the error for mesh port forward
 func ErrRunCiliumCmd(err error, des string) error {
-	return errors.New(ErrRunCiliumCmdCode, errors.Alert, []string{"Error running cilium command"}, []string{err.Error()}, []string{"Corrupted cilium binary", "Command might be invalid"}, []string{})
+	return errors.New(ErrRunCiliumCmdCode, errors.Alert, []string{"Error running cilium command"}, []string{err.Error(), des}, []string{"Corrupted cilium binary", "Command might be invalid"}, []string{"Reinstall the cilium binary and verify the command is supported by its version"})
 }
 
 // ErrDownloadBinary is the error while downloading Cilium binary
 func ErrDownloadBinary(err error) error {
-	return errors.New(ErrDownloadBinaryCode, errors.Alert, []string{"Error downloading Cilium binary"}, []string{err.Error(), "Error occured while download Cilium binary from its github release"}, []string{"Checkout https://docs.github.com/en/rest/reference/repos#releases for more details"}, []string{})
+	return errors.New(ErrDownloadBinaryCode, errors.Alert, []string{"Error downloading Cilium binary"}, []string{err.Error(), "Error occured while download Cilium binary from its github release"}, []string{"The release binary is not available for the platform", "GitHub is unreachable or rate limited the request"}, []string{"Checkout https://docs.github.com/en/rest/reference/repos#releases for more details"})
 }
 
 // ErrInstallBinary is the error while downloading Cilium binary
 func ErrInstallBinary(err error) error {
-	return errors.New(ErrInstallBinaryCode, errors.Alert, []string{"Error installing Cilium binary"}, []string{err.Error()}, []string{"Corrupted Cilium release binary", "Invalid installation location"}, []string{})
+	return errors.New(ErrInstallBinaryCode, errors.Alert, []string{"Error installing Cilium binary"}, []string{err.Error()}, []string{"Corrupted Cilium release binary", "Invalid installation location"}, []string{"Verify the adapter can write to its installation directory and retry the operation"})
 }
 
 // ErrSampleApp is the error for streaming event
@@ -161,32 +461,32 @@ func ErrRunExecutable(err error) error {
 
 // ErrApplyHelmChart is the error for applying helm chart
 func ErrApplyHelmChart(err error) error {
-	return errors.New(ErrApplyHelmChartCode, errors.Alert, []string{"Error occured while applying Helm Chart"}, []string{err.Error()}, []string{}, []string{})
+	return errors.New(ErrApplyHelmChartCode, errors.Alert, []string{"Error occured while applying Helm Chart"}, []string{err.Error()}, []string{"The chart version is not available in the Cilium Helm repository", "The Helm repository is unreachable", "The kubeconfig lacks the permissions to create the chart resources"}, []string{"Verify the requested version exists at https://helm.cilium.io and the adapter can reach it"})
 }
 
 // ErrParseCiliumCoreComponent is the error when Cilium core component manifest parsing fails
 func ErrParseCiliumCoreComponent(err error) error {
-	return errors.New(ErrParseCiliumCoreComponentCode, errors.Alert, []string{"Cilium core component manifest parsing failing"}, []string{err.Error()}, []string{}, []string{})
+	return errors.New(ErrParseCiliumCoreComponentCode, errors.Alert, []string{"Cilium core component manifest parsing failing"}, []string{err.Error()}, []string{"The settings of the component can't be represented as YAML"}, []string{"Verify the settings of the component match its schema"})
 }
 
 // ErrInvalidOAMComponentType is the error when the OAM component name is not valid
 func ErrInvalidOAMComponentType(compName string) error {
-	return errors.New(ErrInvalidOAMComponentTypeCode, errors.Alert, []string{"invalid OAM component name: ", compName}, []string{}, []string{}, []string{})
+	return errors.New(ErrInvalidOAMComponentTypeCode, errors.Alert, []string{"invalid OAM component name: ", compName}, []string{"The component type is not registered by the Cilium adapter"}, []string{"The component was generated for a different adapter or version"}, []string{"Use a component type listed by the adapter in the Meshery registry"})
 }
 
 // ErrCiliumCoreComponentFail is the error when core Cilium component processing fails
 func ErrCiliumCoreComponentFail(err error) error {
-	return errors.New(ErrCiliumCoreComponentFailCode, errors.Alert, []string{"error in Cilium core component"}, []string{err.Error()}, []string{}, []string{})
+	return errors.New(ErrCiliumCoreComponentFailCode, errors.Alert, []string{"error in Cilium core component"}, []string{err.Error()}, []string{"The component lacks the apiVersion or kind annotations of its workload definition"}, []string{"Recreate the component from the definitions registered by the adapter"})
 }
 
 // ErrProcessOAM is a generic error which is thrown when an OAM operations fails
 func ErrProcessOAM(err error) error {
-	return errors.New(ErrProcessOAMCode, errors.Alert, []string{"error performing OAM operations"}, []string{err.Error()}, []string{}, []string{})
+	return errors.New(ErrProcessOAMCode, errors.Alert, []string{"error performing OAM operations"}, []string{err.Error()}, []string{"One or more components or traits of the design could not be applied"}, []string{"Inspect the listed errors of the components and fix the design"})
 }
 
 // ErrGetLatestRelease is the error for get latest versions
 func ErrGetLatestRelease(err error) error {
-	return errors.New(ErrGetLatestReleaseCode, errors.Alert, []string{"Could not get latest version"}, []string{err.Error()}, []string{"Latest version could not be found at the specified url"}, []string{})
+	return errors.New(ErrGetLatestReleaseCode, errors.Alert, []string{"Could not get latest version"}, []string{err.Error()}, []string{"Latest version could not be found at the specified url"}, []string{"Verify the adapter can reach GitHub or pin the versions with CILIUM_COMPONENT_VERSIONS"})
 }
 
 // ErrLoadNamespace is the occurend while applying namespace
@@ -194,3 +494,326 @@ func ErrLoadNamespace(err error, s string) error {
 	return errors.New(ErrLoadNamespaceCode, errors.Alert, []string{"Error occured while applying namespace "}, []string{err.Error()}, []string{"Trying to access a namespace which is not available"}, []string{"Verify presence of namespace. Confirm Meshery ServiceAccount permissions"})
 
 }
+
+// ErrSecurityReport is the error while collecting the ServiceAccount security report
+func ErrSecurityReport(err error) error {
+	return errors.New(ErrSecurityReportCode, errors.Alert, []string{"Error generating security report"}, []string{err.Error(), "Error occured while inspecting ServiceAccounts, RBAC bindings and token secrets"}, []string{"Meshery ServiceAccount lacks permission to read RBAC resources or secrets"}, []string{"Grant the adapter read access to serviceaccounts, secrets, clusterroles and clusterrolebindings"})
+}
+
+// ErrReconfigureCilium is the error while upgrading the Cilium release with new values
+func ErrReconfigureCilium(err error) error {
+	return errors.New(ErrReconfigureCiliumCode, errors.Alert, []string{"Error reconfiguring Cilium"}, []string{err.Error(), "Error occured while upgrading the Cilium Helm release with new values"}, []string{"Cilium was not installed with Helm", "Invalid Helm values"}, []string{"Verify the Cilium release exists in kube-system"})
+}
+
+// ErrRolloutDaemonSet is the error while restarting or waiting for a DaemonSet rollout
+func ErrRolloutDaemonSet(err error) error {
+	return errors.New(ErrRolloutDaemonSetCode, errors.Alert, []string{"Error rolling out DaemonSet"}, []string{err.Error()}, []string{"Agents failed to become ready with the new configuration", "The rollout did not finish in time"}, []string{"Inspect the logs of the cilium agent pods"})
+}
+
+// ErrConfigureEncryption is the error while toggling transparent encryption
+func ErrConfigureEncryption(err error) error {
+	return errors.New(ErrConfigureEncryptionCode, errors.Alert, []string{"Error configuring transparent encryption"}, []string{err.Error()}, []string{"The kernel does not support the selected encryption type", "The IPsec key secret could not be created"}, []string{"Verify the node kernels support WireGuard or IPsec"})
+}
+
+// ErrKubeProxyReplacement is the error while toggling the kube-proxy replacement
+func ErrKubeProxyReplacement(err error) error {
+	return errors.New(ErrKubeProxyReplacementCode, errors.Alert, []string{"Error configuring kube-proxy replacement"}, []string{err.Error()}, []string{"The API server address could not be determined from the cluster or is a loopback address", "The node kernels lack the required eBPF features"}, []string{"Set k8sServiceHost and k8sServicePort in the body to the address the nodes reach the API server at", "Verify the kernels are 4.19.57 or newer"})
+}
+
+// ErrApplyManifest is the error while applying a multi-document manifest
+func ErrApplyManifest(err error) error {
+	return errors.New(ErrApplyManifestCode, errors.Alert, []string{"Error applying manifest"}, []string{err.Error()}, []string{"Invalid manifest", "A CustomResourceDefinition did not become established in time"}, []string{"Verify the manifest and the adapter permissions on the resources it contains"})
+}
+
+// ErrInstallTetragon is the error while installing or removing Tetragon
+func ErrInstallTetragon(err error) error {
+	return errors.New(ErrInstallTetragonCode, errors.Alert, []string{"Error installing Tetragon"}, []string{err.Error()}, []string{"The Tetragon chart version is not available", "Tetragon requires a kernel with BTF support"}, []string{"Verify the requested Tetragon version exists in the Cilium Helm repository"})
+}
+
+// ErrRunPipeline is the error while running a pipeline
+func ErrRunPipeline(err error) error {
+	return errors.New(ErrRunPipelineCode, errors.Alert, []string{"Error running pipeline"}, []string{err.Error()}, []string{"A pipeline step failed", "A gate was not satisfied in time"}, []string{"Inspect the events of the failed step"})
+}
+
+// ErrValidatePolicy is the error while a Cilium policy could not be validated
+func ErrValidatePolicy(kind, name string, err error) error {
+	return errors.New(ErrValidatePolicyCode, errors.Alert, []string{fmt.Sprintf("Error validating %s %q", kind, name)}, []string{err.Error()}, []string{"The policy CRD could not be read from the cluster"}, []string{"Verify the adapter can read CustomResourceDefinitions"})
+}
+
+// ErrInvalidPolicy is the error when a Cilium policy fails validation
+func ErrInvalidPolicy(kind, name string, violations []PolicyViolation) error {
+	details := make([]string, 0, len(violations))
+	for _, v := range violations {
+		details = append(details, v.String())
+	}
+	return errors.New(ErrInvalidPolicyCode, errors.Alert, []string{fmt.Sprintf("Invalid %s %q", kind, name)}, details, []string{"The policy does not match the CRD schema or violates a Cilium policy rule"}, []string{"Fix the listed fields of the policy"})
+}
+
+// ErrApplyPolicy is the error while applying or deleting a Cilium policy component
+func ErrApplyPolicy(kind, name string, err error) error {
+	return errors.New(ErrApplyPolicyCode, errors.Alert, []string{fmt.Sprintf("Error applying %s %q", kind, name)}, []string{err.Error()}, []string{"The Cilium CRDs are not installed", "The adapter lacks the permissions to manage Cilium policies"}, []string{"Install Cilium and verify the adapter can manage the cilium.io resources"})
+}
+
+// ErrGrafanaDashboards is the error while generating or installing the Grafana dashboards
+func ErrGrafanaDashboards(err error) error {
+	return errors.New(ErrGrafanaDashboardsCode, errors.Alert, []string{"Error installing Grafana dashboards"}, []string{err.Error()}, []string{"Cilium is not installed", "The namespace of the dashboards does not exist"}, []string{"Install Cilium and pass the namespace Grafana watches for dashboards in the operation body"})
+}
+
+// ErrUpgradeCRDs is the error while upgrading the Cilium CRDs
+func ErrUpgradeCRDs(err error) error {
+	return errors.New(ErrUpgradeCRDsCode, errors.Alert, []string{"Error upgrading Cilium CRDs"}, []string{err.Error()}, []string{"Existing custom resources don't match the new CRD schemas", "The CRDs of the requested release could not be fetched"}, []string{"Fix or remove the custom resources listed in the report and retry"})
+}
+
+// ErrAgentExec is the error while running a command in a Cilium agent
+func ErrAgentExec(err error) error {
+	return errors.New(ErrAgentExecCode, errors.Alert, []string{"Error running command in Cilium agent"}, []string{err.Error()}, []string{"The agent pod is not running", "The adapter is not allowed to exec into pods in kube-system"}, []string{"Verify the Cilium agents are running and the adapter can create pods/exec"})
+}
+
+// ErrPolicyAuditMode is the error while toggling the policy audit mode of endpoints
+func ErrPolicyAuditMode(err error) error {
+	return errors.New(ErrPolicyAuditModeCode, errors.Alert, []string{"Error configuring policy audit mode"}, []string{err.Error()}, []string{"The trait is attached to a component which is not a Cilium policy", "The selected endpoints could not be configured"}, []string{"Attach the trait to CiliumNetworkPolicy or CiliumClusterwideNetworkPolicy components"})
+}
+
+// ErrConfigureEgressGateway is the error while toggling the egress gateway
+func ErrConfigureEgressGateway(err error) error {
+	return errors.New(ErrConfigureEgressGatewayCode, errors.Alert, []string{"Error configuring egress gateway"}, []string{err.Error()}, []string{"Cilium is not installed", "The kube-proxy replacement required by the egress gateway could not be enabled"}, []string{"Verify Cilium is installed and the kubeconfig points at a reachable API server"})
+}
+
+// ErrTrafficMirror is the error while setting up or tearing down a traffic mirror
+func ErrTrafficMirror(err error) error {
+	return errors.New(ErrTrafficMirrorCode, errors.Alert, []string{"Error mirroring traffic"}, []string{err.Error()}, []string{"The service does not exist in the namespace", "CiliumEnvoyConfig requires Cilium 1.12 or newer with the Envoy config feature enabled"}, []string{"Pass the service and optionally a duration such as 10m in the operation body"})
+}
+
+// ErrPolicyConvergence is the error when an applied policy is not enforced by the selected endpoints
+func ErrPolicyConvergence(err error) error {
+	return errors.New(ErrPolicyConvergenceCode, errors.Alert, []string{"Policy not enforced"}, []string{err.Error()}, []string{"The agents did not import the policy in time", "Endpoints failed to regenerate with the new policy"}, []string{"Inspect the Cilium agent logs on the nodes of the pending endpoints"})
+}
+
+// ErrProbeFeatures is the error while probing the datapath features of the nodes
+func ErrProbeFeatures(err error) error {
+	return errors.New(ErrProbeFeaturesCode, errors.Alert, []string{"Error probing node features"}, []string{err.Error()}, []string{"The adapter is not allowed to list nodes"}, []string{"Grant the adapter ServiceAccount list access on nodes"})
+}
+
+// ErrEgressIPReport is the error while building the egress IP report
+func ErrEgressIPReport(err error) error {
+	return errors.New(ErrEgressIPReportCode, errors.Alert, []string{"Error building egress IP report"}, []string{err.Error()}, []string{"The adapter is not allowed to list nodes or pods"}, []string{"Grant the adapter ServiceAccount list access on nodes and pods"})
+}
+
+// ErrCoordinateOperation is the error when another adapter keeps the cluster locked
+func ErrCoordinateOperation(err error) error {
+	return errors.New(ErrCoordinateOperationCode, errors.Alert, []string{"Operation deferred by another adapter"}, []string{err.Error()}, []string{"Another Meshery adapter is changing the CNI or the proxies of the cluster"}, []string{"Wait for the operation of the other adapter to complete and retry"})
+}
+
+// ErrExposeHubbleUI is the error while exposing the Hubble UI
+func ErrExposeHubbleUI(err error) error {
+	return errors.New(ErrExposeHubbleUICode, errors.Alert, []string{"Error exposing Hubble UI"}, []string{err.Error()}, []string{"The operation body is missing the host, TLS or authentication settings", "The Cilium ingress controller requires Cilium 1.12 or newer"}, []string{"Pass the host, a TLS secret or cluster issuer and the auth settings in the operation body"})
+}
+
+// ErrPolicyTest is the error while running a policy test bundle
+func ErrPolicyTest(err error) error {
+	return errors.New(ErrPolicyTestCode, errors.Alert, []string{"Policy test failed"}, []string{err.Error()}, []string{"The bundle is not valid", "The fixtures did not start in time", "The policies allow or deny other connections than asserted"}, []string{"Inspect the results attached to the operation and fix the policies or the assertions of the bundle"})
+}
+
+// ErrListReport is the error while listing a page of a report
+func ErrListReport(err error) error {
+	return errors.New(ErrListReportCode, errors.Alert, []string{"Error listing report"}, []string{err.Error()}, []string{"Cilium is not installed", "The continue token expired"}, []string{"Verify Cilium is installed and request the report again from the first page"})
+}
+
+// ErrKubeContext is the error when the Kubernetes context targeted by an operation can't be used
+func ErrKubeContext(err error) error {
+	return errors.New(ErrKubeContextCode, errors.Alert, []string{"Error using Kubernetes context"}, []string{err.Error()}, []string{"The context is not part of the kubeconfigs received from Meshery", "The kubeconfig of the context is not valid"}, []string{"Upload a kubeconfig holding the context to Meshery and reconnect the adapter"})
+}
+
+// ErrSelfTest is the error when checks of the self-test fail
+func ErrSelfTest(err error) error {
+	return errors.New(ErrSelfTestCode, errors.Alert, []string{"Self-test failed"}, []string{err.Error()}, []string{"Cilium is not installed or its agents are not ready", "Network policies are not enforced"}, []string{"Inspect the checks of the self-test report attached to the operation"})
+}
+
+// ErrPurgeCilium is the error while removing the resources left behind by the uninstall of Cilium
+func ErrPurgeCilium(err error) error {
+	return errors.New(ErrPurgeCiliumCode, errors.Alert, []string{"Error purging Cilium"}, []string{err.Error()}, []string{"The adapter is not allowed to remove CRDs, webhooks or secrets", "A custom resource is held by a finalizer"}, []string{"Grant the adapter the permissions to delete the resources and run the purge again"})
+}
+
+// ErrWriteKubeconfig is the error while writing the kubeconfig the Cilium CLIs run with
+func ErrWriteKubeconfig(err error) error {
+	return errors.New(ErrWriteKubeconfigCode, errors.Alert, []string{"Error writing the kubeconfig of the Cilium CLI"}, []string{err.Error()}, []string{"The root directory of the adapter is not writable"}, []string{"Make sure the adapter can write to its root directory"})
+}
+
+// ErrWorkloadAnnotations is the error while annotating the workloads for the features of Cilium
+func ErrWorkloadAnnotations(err error) error {
+	return errors.New(ErrWorkloadAnnotationsCode, errors.Alert, []string{"Error annotating workloads"}, []string{err.Error()}, []string{"The body of the operation is invalid", "The feature relying on the annotations is disabled on the agents", "The adapter is not allowed to patch the workloads"}, []string{"Check the selector and the values in the body", "Enable the feature on the Cilium agents"})
+}
+
+// ErrCiliumStatus is the error while collecting the status of the Cilium installation
+func ErrCiliumStatus(err error) error {
+	return errors.New(ErrCiliumStatusCode, errors.Alert, []string{"Error collecting the Cilium status"}, []string{err.Error()}, []string{"The Cilium operator is not deployed", "The adapter is not allowed to read the Cilium resources"}, []string{"Check that Cilium is installed in kube-system", "Grant the adapter read access to the Cilium resources"})
+}
+
+// ErrHubbleExport is the error while configuring the export of the Hubble flows
+func ErrHubbleExport(err error) error {
+	return errors.New(ErrHubbleExportCode, errors.Alert, []string{"Error exporting Hubble flows"}, []string{err.Error()}, []string{"The operation body is missing the sink settings", "The Secret holding the sink credentials is missing from kube-system", "The Hubble exporter requires Cilium 1.14 or newer"}, []string{"Pass the sink and its settings in the operation body", "Create the Secret of the credentials in kube-system"})
+}
+
+// ErrHubbleMetrics is the error while configuring the Hubble metrics
+func ErrHubbleMetrics(err error) error {
+	return errors.New(ErrHubbleMetricsCode, errors.Alert, []string{"Error configuring Hubble metrics"}, []string{err.Error()}, []string{"The operation body lists unknown metrics"}, []string{"List the metrics among dns, drop, tcp, flow, http, httpV2, icmp, kafka, port-distribution, flows-to-world and policy"})
+}
+
+// ErrOperationConflict is the error when a mutating operation can't run while another one is running on the same cluster
+func ErrOperationConflict(err error) error {
+	return errors.New(ErrOperationConflictCode, errors.Alert, []string{"Conflicting operation running on the cluster"}, []string{err.Error()}, []string{"Another upgrade, install or configuration of Cilium is running on the cluster", "Operations are rejected instead of queued by the operation fencing config"}, []string{"Run the operation again once the running operation completes", "Set OPERATION_FENCING to queue the operations"})
+}
+
+// ErrMonitoringAddon is the error while provisioning the ServiceMonitors and the Grafana dashboards of Cilium
+func ErrMonitoringAddon(err error) error {
+	return errors.New(ErrMonitoringAddonCode, errors.Alert, []string{"Error provisioning Cilium monitoring"}, []string{err.Error()}, []string{"The Prometheus operator is not installed in the cluster", "The dashboards of the Cilium chart require Cilium 1.12 or newer"}, []string{"Install the Prometheus operator, e.g. with the kube-prometheus-stack chart", "Upgrade Cilium to 1.12 or newer"})
+}
+
+// ErrFQDNEgress is the error while applying the FQDNEgress trait to a workload
+func ErrFQDNEgress(err error) error {
+	return errors.New(ErrFQDNEgressCode, errors.Alert, []string{"Error applying the FQDNEgress trait"}, []string{err.Error()}, []string{"The trait is attached to a component which is not a Deployment, StatefulSet or DaemonSet", "The DNS proxy of the Cilium agents is disabled"}, []string{"Attach the trait to a workload with pod labels", "Enable l7Proxy in the Cilium values"})
+}
+
+// ErrPolicyRecommendation is the error while recommending policies from the flows observed by Hubble
+func ErrPolicyRecommendation(err error) error {
+	return errors.New(ErrPolicyRecommendationCode, errors.Alert, []string{"Error recommending policies"}, []string{err.Error()}, []string{"Hubble Relay is not deployed or not ready", "The hubble CLI could not be downloaded", "The operation body is invalid"}, []string{"Enable Hubble Relay in the Cilium values", "Pass the namespace of the workloads and a valid since duration in the operation body"})
+}
+
+// ErrClusterwideLockout is the warning when a clusterwide policy may cut kube-system or the adapter off the cluster
+func ErrClusterwideLockout(name string, warnings []string) error {
+	return errors.New(ErrClusterwideLockoutCode, errors.Alert, []string{fmt.Sprintf("CiliumClusterwideNetworkPolicy %q may lock out critical workloads", name)}, warnings, []string{"The endpointSelector of the policy selects kube-system or the adapter, which are then in default deny"}, []string{"Exclude kube-system from the endpointSelector", "Allow the egress to the kube-apiserver and kube-dns and the ingress from the cluster"})
+}
+
+// ErrL7HTTPPolicy is the error while applying the L7HTTPPolicy trait to a workload
+func ErrL7HTTPPolicy(err error) error {
+	return errors.New(ErrL7HTTPPolicyCode, errors.Alert, []string{"Error applying the L7HTTPPolicy trait"}, []string{err.Error()}, []string{"The trait is attached to a component which is not a Deployment, StatefulSet or DaemonSet", "A method, path or host is not a valid regular expression", "The L7 proxy of the Cilium agents is disabled or bypassed by CNI chaining"}, []string{"Attach the trait to a workload with pod labels", "Fix the regular expressions of the rules", "Enable l7Proxy in the Cilium values"})
+}
+
+// ErrConfigureEnvoyConfig is the error while toggling the CiliumEnvoyConfig resources
+func ErrConfigureEnvoyConfig(err error) error {
+	return errors.New(ErrConfigureEnvoyConfigCode, errors.Alert, []string{"Error configuring the Envoy L7 proxy"}, []string{err.Error()}, []string{"Cilium is not installed or older than 1.12", "The kube-proxy replacement required by CiliumEnvoyConfig could not be enabled"}, []string{"Upgrade Cilium to 1.12 or newer", "Verify the kubeconfig points at a reachable API server"})
+}
+
+// ErrConfigureMutualAuth is the error while enabling the mutual authentication or applying the MutualAuthentication trait
+func ErrConfigureMutualAuth(err error) error {
+	return errors.New(ErrConfigureMutualAuthCode, errors.Alert, []string{"Error configuring mutual authentication"}, []string{err.Error()}, []string{"Cilium is older than 1.14", "SPIRE could not be scheduled or is not ready", "The trait is attached to a component which is not a Cilium policy"}, []string{"Upgrade Cilium to 1.14 or newer", "Inspect the pods of the cilium-spire namespace", "Run the mutual authentication operation before requiring it in policies"})
+}
+
+// ErrConfigureBGP is the error while toggling the BGP control plane or applying a BGP resource
+func ErrConfigureBGP(err error) error {
+	return errors.New(ErrConfigureBGPCode, errors.Alert, []string{"Error configuring the BGP control plane"}, []string{err.Error()}, []string{"Cilium is not installed or older than 1.12", "CiliumBGPClusterConfig is applied to Cilium older than 1.16"}, []string{"Upgrade Cilium", "Use CiliumBGPPeeringPolicy with Cilium older than 1.16"})
+}
+
+// ErrConfigureBandwidthManager is the error while toggling the bandwidth manager
+func ErrConfigureBandwidthManager(err error) error {
+	return errors.New(ErrConfigureBandwidthManagerCode, errors.Alert, []string{"Error configuring the bandwidth manager"}, []string{err.Error()}, []string{"The kernel of a node is older than 5.1, or 5.18 for BBR", "The operation body is invalid"}, []string{"Upgrade the kernel of the nodes", "Enable the bandwidth manager without BBR"})
+}
+
+// ErrConfigureIPAM is the error while validating the IPAM of an install
+func ErrConfigureIPAM(err error) error {
+	return errors.New(ErrConfigureIPAMCode, errors.Alert, []string{"Invalid IPAM configuration"}, []string{err.Error()}, []string{"The IPAM mode requires another cloud provider", "The cluster-pool CIDRs are invalid or smaller than the CIDR of a node", "The nodes have no pod CIDR for the kubernetes mode"}, []string{"Choose the IPAM mode of the cloud provider of the cluster", "Use IPv4 pod CIDRs larger than clusterPoolIPv4MaskSize"})
+}
+
+// ErrConfigureDualStack is the error while enabling dual-stack
+func ErrConfigureDualStack(err error) error {
+	return errors.New(ErrConfigureDualStackCode, errors.Alert, []string{"Error configuring dual-stack"}, []string{err.Error()}, []string{"Cilium is not installed", "The operation body is invalid"}, []string{"Verify Cilium is installed and the kubeconfig points at a reachable API server"})
+}
+
+// ErrDualStackPreflight is the error when the preflight checks of dual-stack found the cluster can't run it
+func ErrDualStackPreflight(findings []PreflightFinding) error {
+	long := make([]string, 0, len(findings))
+	for _, f := range findings {
+		long = append(long, f.String())
+	}
+	return errors.New(ErrDualStackPreflightCode, errors.Alert, []string{"The cluster can't run dual-stack"}, long, []string{"The nodes have no IPv6 address", "The nodes have no IPv6 pod CIDR for the kubernetes IPAM", "The IPAM mode only allocates IPv4 addresses"}, []string{"Give the nodes an IPv6 address and a dual-stack pod CIDR", "Use the cluster-pool IPAM with an IPv6 pod CIDR"})
+}
+
+// ErrRollingUpgrade is the error while starting, resuming or aborting the rolling upgrade of Cilium
+func ErrRollingUpgrade(err error) error {
+	return errors.New(ErrRollingUpgradeCode, errors.Alert, []string{"Error during the rolling upgrade of Cilium"}, []string{err.Error()}, []string{"The requested version is not newer than the installed one", "An upgrade is already in progress or none is to resume", "An upgraded agent did not become ready"}, []string{"Resume or abort the paused upgrade", "Inspect the logs of the agent which did not become ready and abort the upgrade"})
+}
+
+// ErrPerformanceTest is the error while running a performance test or reading its results
+func ErrPerformanceTest(err error) error {
+	return errors.New(ErrPerformanceTestCode, errors.Alert, []string{"Error running the performance test"}, []string{err.Error()}, []string{"The test configuration is not a valid SMP performance test", "The load generator could not reach the endpoint", "The load generator image could not be pulled"}, []string{"Verify the endpoint URL is reachable from the namespace of the operation", "Inspect the logs of the meshery-perf Job"})
+}
+
+// ErrDiscovery is the error while discovering the Cilium resources of the cluster
+func ErrDiscovery(err error) error {
+	return errors.New(ErrDiscoveryCode, errors.Alert, []string{"Error discovering the Cilium resources"}, []string{err.Error()}, []string{"The adapter is not allowed to list the Cilium resources or the nodes"}, []string{"Grant the adapter list access to the cilium.io resources and the nodes"})
+}
+
+// ErrExportCilium is the error while exporting the values and manifests of the running Cilium
+func ErrExportCilium(err error) error {
+	return errors.New(ErrExportCiliumCode, errors.Alert, []string{"Error exporting the Cilium configuration"}, []string{err.Error()}, []string{"The adapter is not allowed to read the Helm release Secrets in kube-system", "The Helm release is corrupted"}, []string{"Grant the adapter read access to the Secrets of kube-system"})
+}
+
+// ErrDetectDrift is the error while comparing the applied state with the cluster or restoring it
+func ErrDetectDrift(err error) error {
+	return errors.New(ErrDetectDriftCode, errors.Alert, []string{"Error detecting the drift of the Cilium configuration"}, []string{err.Error()}, []string{"The state the adapter last applied is unreadable", "The adapter is not allowed to read the Cilium policies"}, []string{"Verify the files of the adapter under ~/.meshery", "Grant the adapter read access to the cilium.io policies"})
+}
+
+// ErrCustomManifest is the error while validating or applying the resources of a custom manifest
+func ErrCustomManifest(err error) error {
+	return errors.New(ErrCustomManifestCode, errors.Alert, []string{"Error applying the custom manifest"}, []string{err.Error()}, []string{"A resource does not match the schema of its CustomResourceDefinition", "The kind of a resource is not served by the cluster", "The adapter is not allowed to apply a resource"}, []string{"Fix the violations listed in the manifest report and apply it again", "Install the CustomResourceDefinitions of the resources first"})
+}
+
+// ErrConfigureHostFirewall is the error while toggling the host firewall
+func ErrConfigureHostFirewall(err error) error {
+	return errors.New(ErrConfigureHostFirewallCode, errors.Alert, []string{"Error configuring the host firewall"}, []string{err.Error()}, []string{"A host policy of the cluster denies the kubelet or kube-apiserver traffic of the nodes", "Cilium is not installed", "The operation body is invalid"}, []string{"Allow the kubelet and kube-apiserver traffic in the host policies, or apply them through the adapter which adds the rules", "Set force in the operation body to enable the host firewall regardless"})
+}
+
+// ErrConfigureLocalRedirectPolicy is the error while toggling the local redirect policies
+func ErrConfigureLocalRedirectPolicy(err error) error {
+	return errors.New(ErrConfigureLocalRedirectPolicyCode, errors.Alert, []string{"Error configuring the local redirect policies"}, []string{err.Error()}, []string{"Cilium is not installed", "The kube-proxy replacement could not be enabled"}, []string{"Install Cilium before enabling the local redirect policies"})
+}
+
+// ErrNodeHealthReport is the error while collecting the health of the nodes
+func ErrNodeHealthReport(err error) error {
+	return errors.New(ErrNodeHealthReportCode, errors.Alert, []string{"Error collecting the health of the nodes"}, []string{err.Error()}, []string{"Cilium is not installed", "The adapter is not allowed to read the Cilium resources"}, []string{"Check that Cilium is installed in kube-system", "Grant the adapter read access to the CiliumNodes and CiliumEndpoints"})
+}
+
+// ErrNodeUnhealthy is the error when the agent or the endpoints of a node are not healthy
+func ErrNodeUnhealthy(node string, problems []string) error {
+	return errors.New(ErrNodeUnhealthyCode, errors.Alert, []string{fmt.Sprintf("Node %s is unhealthy", node)}, problems, []string{"The agent of the node is not ready or failing", "Endpoints of the node are still regenerating", "BPF maps of the node are close to full"}, []string{"Check the logs of the Cilium agent of the node", "Raise the BPF map sizes of the agents when maps are under pressure"})
+}
+
+// ErrOperationCancelled is the error when an operation is cancelled before it completed
+func ErrOperationCancelled(operation, reason string) error {
+	return errors.New(ErrOperationCancelledCode, errors.Alert, []string{fmt.Sprintf("Operation %s cancelled", operation)}, []string{reason}, []string{"The operation was cancelled on request", "The adapter shut down while the operation was running"}, []string{"Run the operation again, the changes it made before it was cancelled are kept"})
+}
+
+// ErrOperationTimedOut is the error when an operation runs past its timeout
+func ErrOperationTimedOut(operation string, timeout time.Duration) error {
+	return errors.New(ErrOperationTimedOutCode, errors.Alert, []string{fmt.Sprintf("Operation %s timed out", operation)}, []string{fmt.Sprintf("The operation did not complete within %s", timeout)}, []string{"The cluster is slow to converge", "The timeout of the operation is too short"}, []string{"Raise the timeout of the operation with OPERATION_TIMEOUTS", "Check the state of the cluster before running the operation again"})
+}
+
+// ErrCancelOperation is the error while cancelling the running operations
+func ErrCancelOperation(err error) error {
+	return errors.New(ErrCancelOperationCode, errors.Alert, []string{"Error cancelling operations"}, []string{err.Error()}, []string{"The operation body doesn't select the operations to cancel"}, []string{"Pass the operationId or the operation name to cancel in the operation body"})
+}
+
+// ErrConfigureRegistry is the error when the private registry of an install is invalid
+func ErrConfigureRegistry(err error) error {
+	return errors.New(ErrConfigureRegistryCode, errors.Alert, []string{"Invalid image registry"}, []string{err.Error()}, []string{"The registry prefix is missing or is a URL", "An image pull secret doesn't exist in kube-system"}, []string{"Pass the registry prefix as an image reference such as registry.example.com:5000/mirror", "Create the image pull secrets in kube-system before installing"})
+}
+
+// ErrConfigureHubbleRelay is the error while enabling Hubble Relay with TLS
+func ErrConfigureHubbleRelay(err error) error {
+	return errors.New(ErrConfigureHubbleRelayCode, errors.Alert, []string{"Error configuring Hubble Relay"}, []string{err.Error()}, []string{"The cert-manager issuer is missing or cert-manager is not installed", "The certificates to reuse are missing or invalid", "Hubble Relay did not become ready"}, []string{"Pass an existing issuer for the certmanager method or use certgen", "Use the certgen method to generate new certificates", "Check the logs of the hubble-relay Deployment in kube-system"})
+}
+
+// ErrKubernetesValues is the error while selecting the chart values for the Kubernetes version of the cluster
+func ErrKubernetesValues(err error) error {
+	return errors.New(ErrKubernetesValuesCode, errors.Alert, []string{"Error selecting the chart values for the cluster"}, []string{err.Error()}, []string{"The namespace of Cilium enforces a Pod Security level stricter than privileged", "The APIs served by the cluster could not be discovered"}, []string{"Label kube-system with pod-security.kubernetes.io/enforce=privileged", "Check that the adapter can reach the API server of the cluster"})
+}
+
+// ErrCleanup is the error while removing the test resources deployed by the adapter
+func ErrCleanup(err error) error {
+	return errors.New(ErrCleanupCode, errors.Alert, []string{"Error removing test resources"}, []string{err.Error()}, []string{"The adapter is not allowed to list or delete the test resources", "The operation body is invalid"}, []string{"Grant the service account of the adapter the permission to delete the resources it deployed", "Pass olderThan as a duration such as 1h in the operation body"})
+}
+
+// ErrPolicyLint is the error while linting the Cilium network policies
+func ErrPolicyLint(err error) error {
+	return errors.New(ErrPolicyLintCode, errors.Alert, []string{"Error linting the network policies"}, []string{err.Error()}, []string{"The adapter is not allowed to list the policies, namespaces or pods", "The operation body is invalid"}, []string{"Grant the service account of the adapter the permission to list the Cilium policies, namespaces and pods", "Pass the namespace to lint in the operation body, or nothing to lint the whole cluster"})
+}
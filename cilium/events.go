@@ -0,0 +1,110 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/layer5io/meshery-cilium/internal/events"
+)
+
+type eventNotesKey struct{}
+
+// eventNotes collects what the final event of an operation refers to while
+// it runs: the resources it applied and the hints to remediate a failure
+type eventNotes struct {
+	mu          sync.Mutex
+	resources   []events.Resource
+	remediation []string
+}
+
+// withEventNotes returns a context whose operation notes its resources and
+// remediation hints in notes
+func withEventNotes(ctx context.Context, notes *eventNotes) context.Context {
+	return context.WithValue(ctx, eventNotesKey{}, notes)
+}
+
+// noteResource notes a resource applied or deleted by the operation run
+// with ctx, it does nothing when the operation has no final event
+func noteResource(ctx context.Context, kind, namespace, name string) {
+	notes, ok := ctx.Value(eventNotesKey{}).(*eventNotes)
+	if !ok {
+		return
+	}
+	notes.mu.Lock()
+	defer notes.mu.Unlock()
+	notes.resources = append(notes.resources, events.Resource{Kind: kind, Namespace: namespace, Name: name})
+}
+
+// noteRemediation notes how to remediate the failure of the operation run
+// with ctx, the hints are shown along with the probable cause of its error
+func noteRemediation(ctx context.Context, hints ...string) {
+	notes, ok := ctx.Value(eventNotesKey{}).(*eventNotes)
+	if !ok {
+		return
+	}
+	notes.mu.Lock()
+	defer notes.mu.Unlock()
+	notes.remediation = append(notes.remediation, hints...)
+}
+
+// event returns the final event of an operation, an error event when err
+// is set. The notes may be nil.
+func (n *eventNotes) event(operationID, summary, details string, err error) events.Event {
+	e := events.Event{
+		Severity:    events.SeverityInfo,
+		OperationID: operationID,
+		Summary:     summary,
+		Details:     details,
+		Err:         err,
+	}
+	if err != nil {
+		e.Severity = events.SeverityError
+	}
+	if n == nil {
+		return e
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e.Resources = append([]events.Resource{}, n.resources...)
+	// The hints only help with a failure
+	if err != nil {
+		e.Remediation = append([]string{}, n.remediation...)
+	}
+	return e
+}
+
+// emit streams e to Meshery with its severity
+func (h *Handler) emit(e events.Event) {
+	switch e.Severity {
+	case events.SeverityError:
+		err := e.Err
+		if err == nil {
+			err = fmt.Errorf("%s", e.Summary)
+		}
+		h.StreamErr(e.Adapter(), err)
+	case events.SeverityWarning:
+		h.Log.Warn(fmt.Errorf("%s", e.Summary))
+		if h.Channel != nil {
+			*h.Channel <- e.Adapter()
+		}
+	default:
+		h.StreamInfo(e.Adapter())
+	}
+}
+
+// emitPolicy streams the outcome of applying a policy, Meshery doesn't run
+// the OAM components as operations so the events have no operation ID
+func (h *Handler) emitPolicy(kind, namespace, name, summary string, err error) {
+	e := events.Event{
+		Severity:  events.SeverityInfo,
+		Summary:   summary,
+		Resources: []events.Resource{{Kind: kind, Namespace: namespace, Name: name}},
+		Err:       err,
+	}
+	if err != nil {
+		e.Severity = events.SeverityError
+		e.Details = err.Error()
+	}
+	h.emit(e)
+}
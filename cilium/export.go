@@ -0,0 +1,192 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Sources of an export
+const (
+	exportHelmRelease = "helm-release"
+	exportAgentConfig = "agent-config"
+)
+
+// ExportReport describes the configuration exported from the cluster, the
+// values and the manifests themselves are artifacts of the operation
+type ExportReport struct {
+	// Source is helm-release when Cilium was installed with Helm, and
+	// agent-config when the values were rebuilt from the agent settings
+	Source   string `json:"source"`
+	Version  string `json:"version"`
+	Revision int    `json:"revision,omitempty"`
+	// Objects lists the kind/name of the manifests of the bundle
+	Objects []string `json:"objects"`
+	// Unknown are the agent settings without a chart value, only set for
+	// the agent-config source
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// ciliumExport is the exported configuration of an installation
+type ciliumExport struct {
+	report *ExportReport
+	// values are the values passed to the chart, computed the values
+	// rendered along with the defaults of the chart
+	values    []byte
+	computed  []byte
+	manifests []byte
+}
+
+// exportCilium reads the configuration of the running Cilium so that it
+// can be installed elsewhere with the same chart version and values. The
+// Helm release is read when there is one, the values are rebuilt from the
+// agent settings and the manifests taken from the cluster otherwise.
+func (h *Handler) exportCilium(ctx context.Context) (*ciliumExport, error) {
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+	rel, err := h.deployedRelease()
+	if err != nil {
+		return nil, ErrExportCilium(err)
+	}
+	if rel == nil {
+		return h.exportLiveConfig(ctx)
+	}
+
+	res := &ciliumExport{report: &ExportReport{Source: exportHelmRelease, Revision: rel.Version}}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		res.report.Version = rel.Chart.Metadata.Version
+	}
+	config := rel.Config
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	if res.values, err = yaml.Marshal(config); err != nil {
+		return nil, ErrExportCilium(err)
+	}
+	computed, err := chartutil.CoalesceValues(rel.Chart, config)
+	if err != nil {
+		return nil, ErrExportCilium(err)
+	}
+	if res.computed, err = yaml.Marshal(computed); err != nil {
+		return nil, ErrExportCilium(err)
+	}
+	res.manifests = []byte(rel.Manifest)
+	res.report.Objects = manifestObjects(rel.Manifest)
+	return res, nil
+}
+
+// deployedRelease returns the deployed revision of the Cilium release, from
+// the Secrets of the default storage of Helm or the ConfigMaps of older
+// releases, nil when Cilium was not installed with Helm
+func (h *Handler) deployedRelease() (*release.Release, error) {
+	query := map[string]string{"name": ciliumHelmChart, "owner": "helm", "status": "deployed"}
+	stores := []driver.Driver{
+		driver.NewSecrets(h.KubeClient.CoreV1().Secrets(ciliumNamespace)),
+		driver.NewConfigMaps(h.KubeClient.CoreV1().ConfigMaps(ciliumNamespace)),
+	}
+	for _, store := range stores {
+		releases, err := store.Query(query)
+		if err == driver.ErrReleaseNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(releases, func(i, j int) bool { return releases[i].Version > releases[j].Version })
+		return releases[0], nil
+	}
+	return nil, nil
+}
+
+// exportLiveConfig exports an installation which is not a Helm release
+func (h *Handler) exportLiveConfig(ctx context.Context) (*ciliumExport, error) {
+	version, err := h.installedCiliumVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := h.KubeClient.CoreV1().ConfigMaps(ciliumNamespace).Get(ctx, ciliumConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrExportCilium(err)
+	}
+	ds, err := h.KubeClient.AppsV1().DaemonSets(ciliumNamespace).Get(ctx, ciliumAgentName, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrExportCilium(err)
+	}
+
+	values, adoption := importAgentConfig(cm.Data)
+	res := &ciliumExport{report: &ExportReport{Source: exportAgentConfig, Version: version, Unknown: adoption.Unknown}}
+	if res.values, err = yaml.Marshal(values); err != nil {
+		return nil, ErrExportCilium(err)
+	}
+
+	cm.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+	ds.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"}
+	ds.Status = appsv1.DaemonSetStatus{}
+	objects := []interface{}{cm, ds}
+	metas := []*metav1.ObjectMeta{&cm.ObjectMeta, &ds.ObjectMeta}
+	// The operator is optional for some IPAM modes
+	if op, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Get(ctx, ciliumOperatorName, metav1.GetOptions{}); err == nil {
+		op.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}
+		op.Status = appsv1.DeploymentStatus{}
+		objects = append(objects, op)
+		metas = append(metas, &op.ObjectMeta)
+	}
+
+	var bundle []string
+	for i, obj := range objects {
+		stripServerFields(metas[i])
+		byt, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, ErrExportCilium(err)
+		}
+		bundle = append(bundle, string(byt))
+	}
+	res.manifests = []byte("---\n" + strings.Join(bundle, "---\n"))
+	res.report.Objects = []string{"ConfigMap/" + cm.Name, "DaemonSet/" + ds.Name}
+	if len(objects) > 2 {
+		res.report.Objects = append(res.report.Objects, "Deployment/"+ciliumOperatorName)
+	}
+	return res, nil
+}
+
+// stripServerFields removes the fields set by the API server, which are
+// rejected or meaningless when the manifest is applied to another cluster
+func stripServerFields(meta *metav1.ObjectMeta) {
+	meta.UID = ""
+	meta.ResourceVersion = ""
+	meta.Generation = 0
+	meta.CreationTimestamp = metav1.Time{}
+	meta.ManagedFields = nil
+	meta.SelfLink = ""
+	delete(meta.Annotations, corev1.LastAppliedConfigAnnotation)
+	delete(meta.Annotations, "deprecated.daemonset.template.generation")
+	delete(meta.Annotations, "deployment.kubernetes.io/revision")
+}
+
+// manifestObjects lists the kind/name of the documents of a manifest
+func manifestObjects(manifest string) []string {
+	objects := []string{}
+	for _, doc := range strings.Split(manifest, "\n---") {
+		obj := struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		objects = append(objects, fmt.Sprintf("%s/%s", obj.Kind, obj.Metadata.Name))
+	}
+	return objects
+}
@@ -0,0 +1,94 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/paging"
+	"github.com/layer5io/meshery-cilium/internal/probe"
+)
+
+// FeaturesPath is the path under which the node capability matrices are served
+const FeaturesPath = "/features"
+
+// maxFeatureNodes caps the nodes probed for a single page
+const maxFeatureNodes = 100
+
+// nodeFeatures probes the datapath features of a page of the nodes of the
+// cluster
+func (h *Handler) nodeFeatures(ctx context.Context, params paging.Params) (paging.Page, error) {
+	if h.KubeClient == nil {
+		return paging.Page{}, ErrNilClient
+	}
+
+	nodes, err := h.KubeClient.CoreV1().Nodes().List(ctx, params.ListOptions())
+	if err != nil {
+		return paging.Page{}, ErrProbeFeatures(err)
+	}
+
+	res := make([]probe.NodeFeatures, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		in := probe.Input{
+			Node:          node.Name,
+			KernelVersion: node.Status.NodeInfo.KernelVersion,
+		}
+
+		pod, err := h.agentPod(ctx, node.Name)
+		if err == nil {
+			in.AgentStatus, err = h.execInAgent(pod, []string{"cilium", "status", "--verbose"})
+		}
+		if err == nil {
+			in.CongestionControl, err = h.execInAgent(pod, []string{"cat", "/proc/sys/net/ipv4/tcp_available_congestion_control"})
+		}
+
+		features := probe.Evaluate(in)
+		if err != nil {
+			features.Error = err.Error()
+		}
+		res = append(res, features)
+	}
+	return paging.FromList(res, nodes.ListMeta), nil
+}
+
+// FeaturesHandler serves the capability matrices of the nodes of the
+// cluster managed by the adapter handler h
+func FeaturesHandler(h adapter.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler, ok := h.(*Handler)
+		if !ok {
+			http.Error(w, "feature probes are not supported", http.StatusNotImplemented)
+			return
+		}
+		handler, err := handler.forContext(r.URL.Query().Get("context"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// Probing execs into the agents, pages are kept small
+		params, err := paging.Parse(r, maxFeatureNodes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		features, err := handler.nodeFeatures(r.Context(), params)
+		if err == ErrNilClient {
+			http.Error(w, "no cluster configured yet", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(features)
+	})
+}
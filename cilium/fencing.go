@@ -0,0 +1,115 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+)
+
+// fence is the mutating operation running on a cluster, done is closed
+// once it completes
+type fence struct {
+	operation   string
+	operationID string
+	started     time.Time
+	done        chan struct{}
+}
+
+// clusterFences keeps a single mutating operation running per cluster. It
+// is shared by the handlers of every Kubernetes context, so that contexts
+// of the same cluster are fenced together.
+type clusterFences struct {
+	mu      sync.Mutex
+	running map[string]*fence
+}
+
+func newClusterFences() *clusterFences {
+	return &clusterFences{running: map[string]*fence{}}
+}
+
+// tryAcquire takes the fence of cluster, or returns the operation holding
+// it
+func (f *clusterFences) tryAcquire(cluster string, request adapter.OperationRequest) (*fence, *fence) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cur, ok := f.running[cluster]; ok {
+		return nil, cur
+	}
+	acquired := &fence{
+		operation:   request.OperationName,
+		operationID: request.OperationID,
+		started:     time.Now(),
+		done:        make(chan struct{}),
+	}
+	f.running[cluster] = acquired
+	return acquired, nil
+}
+
+func (f *clusterFences) release(cluster string, acquired *fence) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.running[cluster] == acquired {
+		delete(f.running, cluster)
+	}
+	close(acquired.done)
+}
+
+// fenceOperation keeps a mutating operation from running concurrently with
+// another mutating operation of the adapter on the same cluster. The
+// operation is queued behind the running one or rejected, depending on the
+// fencing config, and holds the fence until the returned release function
+// is called.
+func (h *Handler) fenceOperation(ctx context.Context, request adapter.OperationRequest) (func(), error) {
+	noop := func() {}
+	cfg, err := internalconfig.Fencing(h.Config)
+	if err != nil {
+		return noop, err
+	}
+	cluster := h.fenceKey(ctx)
+	if cluster == "" {
+		return noop, nil
+	}
+
+	deadline := time.NewTimer(cfg.Timeout)
+	defer deadline.Stop()
+	deferred := false
+	for {
+		acquired, cur := h.fences.tryAcquire(cluster, request)
+		if acquired != nil {
+			return func() { h.fences.release(cluster, acquired) }, nil
+		}
+		if cfg.Mode == internalconfig.FencingReject {
+			return noop, ErrOperationConflict(fmt.Errorf("%s (operation %s) has been running on the cluster since %s", cur.operation, cur.operationID, cur.started.Format(time.RFC3339)))
+		}
+		if !deferred {
+			deferred = true
+			h.StreamInfo(&adapter.Event{
+				Operationid: request.OperationID,
+				Summary:     fmt.Sprintf("Operation %s deferred", request.OperationName),
+				Details:     fmt.Sprintf("Operation %s (%s) is running on the cluster, waiting for it to complete.", cur.operationID, cur.operation),
+			})
+		}
+
+		select {
+		case <-cur.done:
+		case <-deadline.C:
+			return noop, ErrOperationConflict(fmt.Errorf("%s (operation %s) kept running on the cluster for longer than %s", cur.operation, cur.operationID, cfg.Timeout))
+		case <-ctx.Done():
+			return noop, ErrOperationConflict(ctx.Err())
+		}
+	}
+}
+
+// fenceKey identifies the cluster of the handler, by the API server it
+// talks to when the cluster can't be identified across kubeconfigs. It is
+// empty without a cluster, the operation then fails on its own.
+func (h *Handler) fenceKey(ctx context.Context) string {
+	if id, err := h.clusterID(ctx); err == nil {
+		return id
+	}
+	return h.RestConfig.Host
+}
@@ -0,0 +1,185 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// FQDNEgressTrait is the trait allowing the egress of a workload to domain
+// names through a generated CiliumNetworkPolicy
+const FQDNEgressTrait = "FQDNEgress"
+
+// fqdnEgressWorkloads are the kinds of the workloads the trait applies to
+var fqdnEgressWorkloads = []string{"Deployment", "StatefulSet", "DaemonSet"}
+
+// FQDNEgressProperties are the properties of the FQDNEgress trait
+type FQDNEgressProperties struct {
+	FQDNs []FQDNSelector `json:"fqdns"`
+	Ports []FQDNPort     `json:"ports,omitempty"`
+}
+
+// FQDNSelector is a domain name, either exact or a pattern
+type FQDNSelector struct {
+	MatchName    string `json:"matchName,omitempty"`
+	MatchPattern string `json:"matchPattern,omitempty"`
+}
+
+// FQDNPort is a port the domain names are reached on
+type FQDNPort struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// handleFQDNEgress applies the FQDNEgress trait to a workload component. The
+// generated policy lets the workload look the domain names up through the
+// DNS proxy of the agents, which is how Cilium learns their addresses, and
+// reach them on the ports of the trait.
+func handleFQDNEgress(ctx context.Context, h *Handler, comp v1alpha1.Component, trait v1alpha1.ConfigurationSpecComponentTrait, isDel bool) (string, error) {
+	kind := getKindFromComponent(comp)
+	if !contains(fqdnEgressWorkloads, kind) {
+		return "", ErrFQDNEgress(fmt.Errorf("%s only applies to Deployments, StatefulSets and DaemonSets, %q is a %s", FQDNEgressTrait, comp.Name, kind))
+	}
+	namespace := comp.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	props := FQDNEgressProperties{}
+	byt, err := json.Marshal(trait.Properties)
+	if err != nil {
+		return "", ErrFQDNEgress(err)
+	}
+	if err := json.Unmarshal(byt, &props); err != nil {
+		return "", ErrFQDNEgress(err)
+	}
+	policy, err := fqdnEgressPolicy(comp, namespace, props)
+	if err != nil {
+		return "", ErrFQDNEgress(err)
+	}
+	name, _, _ := unstructured.NestedString(policy, "metadata", "name")
+
+	if !isDel {
+		cfg, err := h.agentConfig(ctx)
+		if err != nil {
+			return "", ErrFQDNEgress(err)
+		}
+		if cfg["enable-l7-proxy"] == "false" {
+			return "", ErrFQDNEgress(fmt.Errorf("the DNS proxy of the agents is disabled, set l7Proxy to true in the Cilium values"))
+		}
+		if err := h.validatePolicy(ctx, policy); err != nil {
+			return "", err
+		}
+	}
+
+	manifest, err := yaml.Marshal(policy)
+	if err != nil {
+		return "", ErrFQDNEgress(err)
+	}
+	if err := h.applyOrdered(ctx, manifest, isDel, namespace); err != nil {
+		return "", ErrApplyPolicy(ciliumNetworkPolicyKind, name, err)
+	}
+
+	if isDel {
+		return fmt.Sprintf("deleted %s \"%s\" of %s \"%s\"", ciliumNetworkPolicyKind, name, kind, comp.Name), nil
+	}
+	return fmt.Sprintf("created %s \"%s\" allowing %s \"%s\" to reach %d domain names", ciliumNetworkPolicyKind, name, kind, comp.Name, len(props.FQDNs)), nil
+}
+
+// fqdnEgressPolicy generates the CiliumNetworkPolicy of the trait, selecting
+// the pods of the workload
+func fqdnEgressPolicy(comp v1alpha1.Component, namespace string, props FQDNEgressProperties) (map[string]interface{}, error) {
+	endpointSelector, err := workloadPodLabels(comp)
+	if err != nil {
+		return nil, err
+	}
+	if len(props.FQDNs) == 0 {
+		return nil, fmt.Errorf("fqdns lists no domain name")
+	}
+
+	var fqdns, lookups []interface{}
+	for _, f := range props.FQDNs {
+		switch {
+		case f.MatchName != "" && f.MatchPattern == "":
+			fqdns = append(fqdns, map[string]interface{}{"matchName": f.MatchName})
+			lookups = append(lookups, map[string]interface{}{"matchName": f.MatchName})
+		case f.MatchPattern != "" && f.MatchName == "":
+			fqdns = append(fqdns, map[string]interface{}{"matchPattern": f.MatchPattern})
+			lookups = append(lookups, map[string]interface{}{"matchPattern": f.MatchPattern})
+		default:
+			return nil, fmt.Errorf("a domain name has either a matchName or a matchPattern")
+		}
+	}
+
+	egress := map[string]interface{}{"toFQDNs": fqdns}
+	if len(props.Ports) > 0 {
+		ports := make([]interface{}, 0, len(props.Ports))
+		for _, p := range props.Ports {
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = "TCP"
+			}
+			ports = append(ports, map[string]interface{}{"port": strconv.Itoa(p.Port), "protocol": protocol})
+		}
+		egress["toPorts"] = []interface{}{map[string]interface{}{"ports": ports}}
+	}
+
+	return workloadPolicy(comp, comp.Name+"-fqdn-egress", namespace, map[string]interface{}{
+		"endpointSelector": map[string]interface{}{"matchLabels": endpointSelector},
+		"egress": []interface{}{
+			// The lookups go through the DNS proxy of the agents
+			map[string]interface{}{
+				"toEndpoints": []interface{}{map[string]interface{}{"matchLabels": map[string]interface{}{
+					"k8s:" + podNamespaceLabel: "kube-system",
+					"k8s:k8s-app":              "kube-dns",
+				}}},
+				"toPorts": []interface{}{map[string]interface{}{
+					"ports": []interface{}{map[string]interface{}{"port": "53", "protocol": "ANY"}},
+					"rules": map[string]interface{}{"dns": lookups},
+				}},
+			},
+			egress,
+		},
+	}), nil
+}
+
+// workloadPodLabels returns the labels of the pods of a workload component
+// as the matchLabels of an endpoint selector
+func workloadPodLabels(comp v1alpha1.Component) (map[string]interface{}, error) {
+	selector, found, _ := unstructured.NestedStringMap(comp.Spec.Settings, "selector", "matchLabels")
+	if !found || len(selector) == 0 {
+		selector, _, _ = unstructured.NestedStringMap(comp.Spec.Settings, "template", "metadata", "labels")
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("%q has no pod labels to select its pods with", comp.Name)
+	}
+	res := map[string]interface{}{}
+	for k, v := range selector {
+		res[k] = v
+	}
+	return res, nil
+}
+
+// workloadPolicy wraps the spec of a CiliumNetworkPolicy generated for a
+// workload component, labeled with the environment of the component
+func workloadPolicy(comp v1alpha1.Component, name, namespace string, spec map[string]interface{}) map[string]interface{} {
+	labels := map[string]interface{}{}
+	for k, v := range componentEnvironment(comp.Annotations, comp.Labels) {
+		labels[k] = v
+	}
+	return map[string]interface{}{
+		"apiVersion": "cilium.io/v2",
+		"kind":       ciliumNetworkPolicyKind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    labels,
+		},
+		"spec": spec,
+	}
+}
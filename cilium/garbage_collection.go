@@ -0,0 +1,205 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Labels marking the resources deployed by the adapter, the ephemeral ones
+// are the test resources the garbage collector removes
+const (
+	ownerLabel     = "meshery.io/managed-by"
+	operationLabel = "meshery.io/operation"
+	ephemeralLabel = "meshery.io/ephemeral"
+)
+
+// ephemeralSelector selects the test resources deployed by the adapter
+var ephemeralSelector = fmt.Sprintf("%s=%s,%s=true", ownerLabel, fieldManager, ephemeralLabel)
+
+var namespaceResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// collectedResources are the resources the test resources are made of, the
+// namespaces come last since deleting them deletes everything they hold
+var collectedResources = []schema.GroupVersionResource{
+	{Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"},
+	{Group: "cilium.io", Version: "v2", Resource: "ciliumclusterwidenetworkpolicies"},
+	{Group: "apps", Version: "v1", Resource: "deployments"},
+	{Group: "apps", Version: "v1", Resource: "statefulsets"},
+	{Group: "apps", Version: "v1", Resource: "daemonsets"},
+	{Version: "v1", Resource: "pods"},
+	{Version: "v1", Resource: "services"},
+	{Version: "v1", Resource: "serviceaccounts"},
+	{Version: "v1", Resource: "configmaps"},
+	namespaceResource,
+}
+
+// CleanupRequest is the body of the cleanup operation
+type CleanupRequest struct {
+	// OlderThan only removes the test resources created before, all of
+	// them are removed by default
+	OlderThan string `json:"olderThan,omitempty"`
+}
+
+// CleanupReport lists the test resources removed
+type CleanupReport struct {
+	Removed []string `json:"removed"`
+	Failed  []string `json:"failed,omitempty"`
+}
+
+// ownershipLabels returns the labels of the resources deployed by an
+// operation, along with the environment labels of the request
+func ownershipLabels(request adapter.OperationRequest, op *adapter.Operation) map[string]string {
+	labels := requestEnvironment(request.CustomBody)
+	labels[ownerLabel] = fieldManager
+	labels[operationLabel] = request.OperationName
+	if internalconfig.EphemeralOperation(op) {
+		labels[ephemeralLabel] = "true"
+	}
+	return labels
+}
+
+// markEphemeral labels a resource created outside of the adapter, such as
+// the namespace of the connectivity test, as a test resource of operation
+func (h *Handler) markEphemeral(ctx context.Context, gvr schema.GroupVersionResource, namespace, name, operation string) error {
+	if h.DynamicKubeClient == nil {
+		return ErrNilClient
+	}
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%q,%q:%q,%q:"true"}}}`, ownerLabel, fieldManager, operationLabel, operation, ephemeralLabel)
+	_, err := h.DynamicKubeClient.Resource(gvr).Namespace(namespace).Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// markCreatedNamespace marks the namespace name as a test resource of
+// operation, only when it was created after the operation started
+func (h *Handler) markCreatedNamespace(ctx context.Context, name string, started time.Time, operation string) error {
+	ns, err := h.KubeClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The timestamps of the API server are truncated to the second
+	if ns.CreationTimestamp.Time.Before(started.Truncate(time.Second)) {
+		return nil
+	}
+	return h.markEphemeral(ctx, namespaceResource, "", name, operation)
+}
+
+// isEphemeral reports whether labels mark a test resource of the adapter
+func isEphemeral(labels map[string]string) bool {
+	return labels[ownerLabel] == fieldManager && labels[ephemeralLabel] == "true"
+}
+
+// cleanup removes the test resources deployed by the adapter
+func (h *Handler) cleanup(ctx context.Context, request adapter.OperationRequest) (string, *CleanupReport, error) {
+	if request.IsDeleteOperation {
+		return status.Removing, nil, ErrOpInvalid
+	}
+	req := CleanupRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return status.Removing, nil, ErrCleanup(err)
+	}
+	var olderThan time.Duration
+	if req.OlderThan != "" {
+		var err error
+		if olderThan, err = time.ParseDuration(req.OlderThan); err != nil || olderThan < 0 {
+			return status.Removing, nil, ErrCleanup(fmt.Errorf("olderThan must be a positive duration, e.g. 1h"))
+		}
+	}
+
+	report, err := h.collectGarbage(ctx, olderThan)
+	if err != nil {
+		return status.Removing, report, err
+	}
+	if len(report.Failed) > 0 {
+		return status.Removing, report, ErrCleanup(fmt.Errorf("%d of %d test resources could not be removed", len(report.Failed), len(report.Failed)+len(report.Removed)))
+	}
+	return status.Removed, report, nil
+}
+
+// collectGarbage removes the test resources created more than ttl ago
+func (h *Handler) collectGarbage(ctx context.Context, ttl time.Duration) (*CleanupReport, error) {
+	if h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+	report := &CleanupReport{Removed: []string{}}
+	background := metav1.DeletePropagationBackground
+	for _, gvr := range collectedResources {
+		list, err := h.DynamicKubeClient.Resource(gvr).List(ctx, metav1.ListOptions{LabelSelector: ephemeralSelector})
+		// The Cilium CRDs are missing until Cilium is installed
+		if kerrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return report, ErrCleanup(err)
+		}
+		for _, item := range list.Items {
+			if time.Since(item.GetCreationTimestamp().Time) < ttl || item.GetDeletionTimestamp() != nil {
+				continue
+			}
+			name := fmt.Sprintf("%s %s", item.GetKind(), qualifiedName(item.GetNamespace(), item.GetName()))
+			err := h.DynamicKubeClient.Resource(gvr).Namespace(item.GetNamespace()).Delete(ctx, item.GetName(), metav1.DeleteOptions{PropagationPolicy: &background})
+			if err != nil && !kerrors.IsNotFound(err) {
+				report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", name, err))
+				continue
+			}
+			report.Removed = append(report.Removed, name)
+			noteResource(ctx, item.GetKind(), item.GetNamespace(), item.GetName())
+		}
+	}
+	sort.Strings(report.Removed)
+	return report, nil
+}
+
+// StartGarbageCollection removes the test resources deployed through the
+// adapter handler h once they are older than ttl, every interval until the
+// adapter shuts down
+func StartGarbageCollection(h adapter.Handler, interval, ttl time.Duration) {
+	handler, ok := h.(*Handler)
+	if !ok {
+		return
+	}
+	handler.goOperation(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-handler.lifecycle.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// No cluster configured yet, the next tick collects again
+			if handler.DynamicKubeClient == nil {
+				continue
+			}
+
+			report, err := handler.collectGarbage(handler.lifecycle.ctx, ttl)
+			if err != nil {
+				handler.Log.Error(err)
+				continue
+			}
+			if len(report.Failed) > 0 {
+				handler.Log.Error(ErrCleanup(fmt.Errorf("%s", strings.Join(report.Failed, "; "))))
+			}
+			if len(report.Removed) > 0 {
+				handler.StreamInfo(&adapter.Event{
+					Summary: fmt.Sprintf("%d stale test resources removed", len(report.Removed)),
+					Details: fmt.Sprintf("The test resources older than %s were removed: %s.", ttl, strings.Join(report.Removed, ", ")),
+				})
+			}
+		}
+	})
+}
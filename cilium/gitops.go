@@ -0,0 +1,114 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/gitops"
+	"sigs.k8s.io/yaml"
+)
+
+// Files of the Cilium release in the export, the release is installed and
+// reconfigured with Helm rather than with manifests
+const (
+	gitOpsReleaseValues    = "cilium/values.yaml"
+	gitOpsReleaseManifests = "cilium/manifests.yaml"
+)
+
+type renderedKey struct{}
+
+// renderedManifests collects the resources an operation applied and
+// deleted, keyed by their path in the export
+type renderedManifests struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	removed map[string]bool
+}
+
+// withRendered returns a context collecting the resources applied by the
+// operation it runs
+func withRendered(ctx context.Context) (context.Context, *renderedManifests) {
+	r := &renderedManifests{files: map[string][]byte{}, removed: map[string]bool{}}
+	return context.WithValue(ctx, renderedKey{}, r), r
+}
+
+// recordRendered records a resource applied or deleted by the operation run
+// with ctx, it does nothing when the manifests are not exported
+func recordRendered(ctx context.Context, kind, namespace, name string, contents []byte, isDel bool) {
+	r, ok := ctx.Value(renderedKey{}).(*renderedManifests)
+	if !ok {
+		return
+	}
+	if namespace == "" {
+		namespace = "_cluster"
+	}
+	file := path.Join("resources", namespace, fmt.Sprintf("%s-%s.yaml", strings.ToLower(kind), name))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if isDel {
+		delete(r.files, file)
+		r.removed[file] = true
+		return
+	}
+	delete(r.removed, file)
+	r.files[file] = contents
+}
+
+// exportGitOps exports the resources the operation applied, along with the
+// Cilium release. Failing to export doesn't fail the operation, it is only
+// logged.
+func (h *Handler) exportGitOps(ctx context.Context, request adapter.OperationRequest, r *renderedManifests) {
+	if h.GitOps == nil {
+		return
+	}
+
+	verb := "Apply"
+	if request.IsDeleteOperation {
+		verb = "Delete"
+	}
+	change := gitops.Change{
+		Message: fmt.Sprintf("%s %s\n\nMeshery operation %s", verb, request.OperationName, request.OperationID),
+		Files:   map[string][]byte{},
+	}
+	r.mu.Lock()
+	for file, contents := range r.files {
+		change.Files[file] = contents
+	}
+	for file := range r.removed {
+		change.Removed = append(change.Removed, file)
+	}
+	r.mu.Unlock()
+
+	if h.KubeClient != nil {
+		rel, err := h.deployedRelease()
+		switch {
+		case err != nil:
+			h.Log.Warn(ErrExportCilium(err))
+		case rel == nil:
+			change.Removed = append(change.Removed, gitOpsReleaseValues, gitOpsReleaseManifests)
+		default:
+			values := rel.Config
+			if values == nil {
+				values = map[string]interface{}{}
+			}
+			byt, err := yaml.Marshal(values)
+			if err != nil {
+				h.Log.Warn(ErrExportCilium(err))
+				break
+			}
+			change.Files[gitOpsReleaseValues] = byt
+			change.Files[gitOpsReleaseManifests] = []byte(rel.Manifest)
+		}
+	}
+
+	if err := h.GitOps.Export(ctx, change); err != nil {
+		h.Log.Error(err)
+		return
+	}
+	reportProgress(ctx, "Applied manifests exported", fmt.Sprintf("%d manifests written and %d removed.", len(change.Files), len(change.Removed)))
+}
@@ -0,0 +1,269 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ciliumNamespace = "kube-system"
+	ciliumAgentName = "cilium"
+	ciliumRelease   = "cilium-release.json"
+	ciliumConfigMap = "cilium-config"
+)
+
+// releaseState is the Cilium Helm release as last applied by the adapter.
+// Helm upgrades replace the previously supplied values, so every
+// reconfiguration merges onto this state instead of starting over.
+type releaseState struct {
+	Version string                 `json:"version"`
+	Values  map[string]interface{} `json:"values"`
+	// Adopted is set when the release was installed outside of the
+	// adapter and its values were imported from the live configuration
+	Adopted *AdoptionReport `json:"adopted,omitempty"`
+}
+
+func (h *Handler) releaseStatePath() string {
+	return h.statePath(ciliumRelease)
+}
+
+func (h *Handler) loadReleaseState() (*releaseState, error) {
+	state := &releaseState{Values: map[string]interface{}{}}
+
+	byt, err := ioutil.ReadFile(h.releaseStatePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(byt, state); err != nil {
+		return nil, err
+	}
+	if state.Values == nil {
+		state.Values = map[string]interface{}{}
+	}
+	return state, nil
+}
+
+func (h *Handler) saveReleaseState(state *releaseState) error {
+	byt, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(h.releaseStatePath(), byt, 0600)
+}
+
+// reconfigureCilium merges values onto the last applied values and
+// upgrades the Cilium release in place
+func (h *Handler) reconfigureCilium(ctx context.Context, values map[string]interface{}) error {
+	if h.MesheryKubeclient == nil {
+		return ErrNilClient
+	}
+
+	state, err := h.loadReleaseState()
+	if err != nil {
+		return ErrReconfigureCilium(err)
+	}
+
+	if state.Version == "" {
+		if err := h.adoptRelease(ctx, state); err != nil {
+			return ErrReconfigureCilium(err)
+		}
+	}
+
+	return h.applyRelease(state, state.Version, values)
+}
+
+// toggleAgentFeature reconfigures the Cilium release with the values of a
+// feature of the agents and restarts the agents so that they pick it up.
+// The beforeRestart functions run once the release is upgraded, the errors
+// are wrapped with wrapErr.
+//
+// It returns the resulting status along with the state of the agent rollout
+func (h *Handler) toggleAgentFeature(ctx context.Context, del bool, values map[string]interface{}, wrapErr func(error) error, beforeRestart ...func(context.Context) error) (string, string, error) {
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	if err := h.reconfigureCilium(ctx, values); err != nil {
+		return st, "", wrapErr(err)
+	}
+	for _, fn := range beforeRestart {
+		if err := fn(ctx); err != nil {
+			return st, "", wrapErr(err)
+		}
+	}
+
+	rollout, err := h.restartAgents(ctx)
+	if err != nil {
+		return st, "", wrapErr(err)
+	}
+
+	st = status.Applied
+	if del {
+		st = status.Removed
+	}
+	return st, fmt.Sprintf("agents restarted: %s", rollout), nil
+}
+
+// applyRelease upgrades the release to version with values merged onto the
+// last applied values, and saves the resulting release state
+func (h *Handler) applyRelease(state *releaseState, version string, values map[string]interface{}) error {
+	state.Version = version
+	mergeValues(state.Values, values)
+
+	if err := h.MesheryKubeclient.ApplyHelmChart(mesherykube.ApplyHelmChartConfig{
+		ChartLocation: mesherykube.HelmChartLocation{
+			Repository: ciliumHelmRepository,
+			Chart:      ciliumHelmChart,
+			Version:    state.Version,
+		},
+		Namespace:      ciliumNamespace,
+		Action:         mesherykube.UPGRADE,
+		OverrideValues: state.Values,
+	}); err != nil {
+		return ErrReconfigureCilium(err)
+	}
+
+	if err := h.saveReleaseState(state); err != nil {
+		return ErrReconfigureCilium(err)
+	}
+	return nil
+}
+
+// ciliumVersion returns the version of the Cilium release managed by the
+// adapter, falling back to the version running in the cluster
+func (h *Handler) ciliumVersion(ctx context.Context) (string, error) {
+	state, err := h.loadReleaseState()
+	if err != nil {
+		return "", err
+	}
+	if state.Version != "" {
+		return state.Version, nil
+	}
+	return h.installedCiliumVersion(ctx)
+}
+
+// versionAtLeast reports whether the semver v is at least major.minor
+func versionAtLeast(v string, major, minor int) bool {
+	var vMajor, vMinor int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(v, "v"), "%d.%d", &vMajor, &vMinor); err != nil {
+		return false
+	}
+	if vMajor != major {
+		return vMajor > major
+	}
+	return vMinor >= minor
+}
+
+// installedCiliumVersion detects the running Cilium version from the
+// image of the agent DaemonSet
+func (h *Handler) installedCiliumVersion(ctx context.Context) (string, error) {
+	if h.KubeClient == nil {
+		return "", ErrNilClient
+	}
+
+	ds, err := h.KubeClient.AppsV1().DaemonSets(ciliumNamespace).Get(ctx, ciliumAgentName, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return "", ErrCiliumNotInstalled
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range ds.Spec.Template.Spec.Containers {
+		if c.Name != "cilium-agent" {
+			continue
+		}
+		return imageVersion(c.Image), nil
+	}
+	return "", ErrCiliumNotInstalled
+}
+
+// agentConfig returns the configuration of the Cilium agents as rendered
+// by the chart into the cilium-config ConfigMap
+func (h *Handler) agentConfig(ctx context.Context) (map[string]string, error) {
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+
+	cm, err := h.KubeClient.CoreV1().ConfigMaps(ciliumNamespace).Get(ctx, ciliumConfigMap, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, ErrCiliumNotInstalled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cm.Data, nil
+}
+
+// imageVersion extracts the semver from an image reference such as
+// quay.io/cilium/cilium:v1.11.0@sha256:...
+func imageVersion(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	idx := strings.LastIndex(image, ":")
+	if idx < 0 || strings.Contains(image[idx:], "/") {
+		return ""
+	}
+	return strings.TrimPrefix(image[idx+1:], "v")
+}
+
+// setValue sets a Helm value addressed by a dotted path, e.g.
+// "encryption.type", creating the intermediate maps
+func setValue(values map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	cur := values
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := cur[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			cur[key] = next
+		}
+		cur = next
+	}
+	cur[keys[len(keys)-1]] = value
+}
+
+// lookupValue reads a Helm value addressed by a dotted path
+func lookupValue(values map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	cur := values
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := cur[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	value, ok := cur[keys[len(keys)-1]]
+	return value, ok
+}
+
+// mergeValues deep merges src into dst
+func mergeValues(dst, src map[string]interface{}) {
+	for key, val := range src {
+		srcMap, ok := val.(map[string]interface{})
+		if !ok {
+			dst[key] = val
+			continue
+		}
+		dstMap, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstMap = map[string]interface{}{}
+			dst[key] = dstMap
+		}
+		mergeValues(dstMap, srcMap)
+	}
+}
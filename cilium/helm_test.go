@@ -0,0 +1,55 @@
+package cilium
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  map[string]interface{}
+		src  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "new keys",
+			dst:  map[string]interface{}{"a": 1},
+			src:  map[string]interface{}{"b": 2},
+			want: map[string]interface{}{"a": 1, "b": 2},
+		},
+		{
+			name: "nested maps are merged",
+			dst:  map[string]interface{}{"hubble": map[string]interface{}{"enabled": true, "relay": map[string]interface{}{"enabled": false}}},
+			src:  map[string]interface{}{"hubble": map[string]interface{}{"relay": map[string]interface{}{"enabled": true}}},
+			want: map[string]interface{}{"hubble": map[string]interface{}{"enabled": true, "relay": map[string]interface{}{"enabled": true}}},
+		},
+		{
+			name: "scalars replace maps",
+			dst:  map[string]interface{}{"kubeProxyReplacement": map[string]interface{}{"mode": "strict"}},
+			src:  map[string]interface{}{"kubeProxyReplacement": true},
+			want: map[string]interface{}{"kubeProxyReplacement": true},
+		},
+		{
+			name: "maps replace scalars",
+			dst:  map[string]interface{}{"encryption": false},
+			src:  map[string]interface{}{"encryption": map[string]interface{}{"enabled": true}},
+			want: map[string]interface{}{"encryption": map[string]interface{}{"enabled": true}},
+		},
+		{
+			name: "lists are replaced",
+			dst:  map[string]interface{}{"metrics": []interface{}{"dns"}},
+			src:  map[string]interface{}{"metrics": []interface{}{"drop", "flow"}},
+			want: map[string]interface{}{"metrics": []interface{}{"drop", "flow"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergeValues(tt.dst, tt.src)
+			if !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("mergeValues() = %v, want %v", tt.dst, tt.want)
+			}
+		})
+	}
+}
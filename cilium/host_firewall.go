@@ -0,0 +1,218 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ciliumHostPolicyComponent is the component of the host policies, the
+// CiliumClusterwideNetworkPolicies selecting nodes with nodeSelector
+const ciliumHostPolicyComponent = "CiliumHostPolicy"
+
+// Ports the control plane reaches the nodes on, the host policies always
+// allow them so that a node is never locked out of the cluster
+const (
+	kubeletPort       = "10250"
+	kubeAPIServerPort = "6443"
+)
+
+// HostFirewallRequest is the body of the host firewall operation
+type HostFirewallRequest struct {
+	// Force enables the host firewall even though host policies applied
+	// outside of the adapter would lock out nodes
+	Force bool `json:"force,omitempty"`
+}
+
+// configureHostFirewall toggles the host firewall of the agents, which
+// enforces the host policies on the nodes. The host policies already in
+// the cluster are checked first since they take effect right away.
+func (h *Handler) configureHostFirewall(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return st, "", ErrNilClient
+	}
+
+	req := HostFirewallRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return st, "", ErrConfigureHostFirewall(err)
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrConfigureHostFirewall(err)
+	}
+
+	values := map[string]interface{}{}
+	if request.IsDeleteOperation {
+		setValue(values, "hostFirewall.enabled", false)
+	} else {
+		if cfg["enable-host-firewall"] == "true" {
+			return status.Applied, "host firewall already enabled, agents not restarted", nil
+		}
+		lockouts, err := h.hostPolicyLockouts(ctx)
+		if err != nil {
+			return st, "", ErrConfigureHostFirewall(err)
+		}
+		if len(lockouts) > 0 && !req.Force {
+			return st, "", ErrConfigureHostFirewall(fmt.Errorf("the host policies would lock out nodes: %s", strings.Join(lockouts, "; ")))
+		}
+		setValue(values, "hostFirewall.enabled", true)
+	}
+
+	return h.toggleAgentFeature(ctx, request.IsDeleteOperation, values, ErrConfigureHostFirewall)
+}
+
+// hostPolicyLockouts lists the host policies of the cluster which leave the
+// kubelet or the kube-apiserver of the nodes they select unreachable
+func (h *Handler) hostPolicyLockouts(ctx context.Context) ([]string, error) {
+	policies, err := h.DynamicKubeClient.Resource(ciliumClusterwidePolicyResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var lockouts []string
+	for _, p := range policies.Items {
+		spec, _ := p.Object["spec"].(map[string]interface{})
+		if _, ok := spec["nodeSelector"]; !ok {
+			continue
+		}
+		for _, w := range hostRuleLockouts(spec) {
+			lockouts = append(lockouts, fmt.Sprintf("%s %s", p.GetName(), w))
+		}
+	}
+	sort.Strings(lockouts)
+	return lockouts, nil
+}
+
+// hostRuleLockouts lists the control plane traffic a host policy rule
+// leaves in default deny
+func hostRuleLockouts(rule map[string]interface{}) []string {
+	ingress, egress := enforcedDirections(rule)
+	var lockouts []string
+	if ingress && !allowsHostIngress(rule, kubeletPort) {
+		lockouts = append(lockouts, "denies the ingress of the kubelet")
+	}
+	if ingress && !allowsHostIngress(rule, kubeAPIServerPort) {
+		lockouts = append(lockouts, "denies the ingress of the kube-apiserver")
+	}
+	if egress && !allowsEgressTo(rule, "kube-apiserver", "", "") {
+		lockouts = append(lockouts, "denies the egress to the kube-apiserver")
+	}
+	return lockouts
+}
+
+// allowsHostIngress reports whether an ingress rule admits the control
+// plane on the port
+func allowsHostIngress(rule map[string]interface{}, port string) bool {
+	for _, r := range ruleList(rule["ingress"]) {
+		if !allowsPort(r, port) {
+			continue
+		}
+		if !hasPeer(r, "from") {
+			return true
+		}
+		for _, e := range stringList(r["fromEntities"]) {
+			switch e {
+			case "all", "cluster", "kube-apiserver", "remote-node":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsPort reports whether the ports of a rule include the TCP port, a
+// rule without ports allows every port
+func allowsPort(rule map[string]interface{}, port string) bool {
+	toPorts := ruleList(rule["toPorts"])
+	if len(toPorts) == 0 {
+		return true
+	}
+	for _, tp := range toPorts {
+		for _, p := range ruleList(tp["ports"]) {
+			proto, _ := p["protocol"].(string)
+			if fmt.Sprint(p["port"]) == port && (proto == "" || proto == "TCP" || proto == "ANY") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// guardHostPolicy returns the settings of a host policy along with the
+// rules which keep the kubelet and the kube-apiserver of the selected nodes
+// reachable, for the directions the policy enforces
+func guardHostPolicy(settings map[string]interface{}) map[string]interface{} {
+	guarded := map[string]interface{}{}
+	for k, v := range settings {
+		guarded[k] = v
+	}
+	ingress, egress := enforcedDirections(settings)
+	if ingress {
+		rules, _ := settings["ingress"].([]interface{})
+		guarded["ingress"] = append(append([]interface{}{}, rules...),
+			map[string]interface{}{
+				"fromEntities": []interface{}{"kube-apiserver", "remote-node", "host"},
+				"toPorts":      tcpPorts(kubeletPort),
+			},
+			// Admins reach the kube-apiserver from outside of the cluster
+			map[string]interface{}{
+				"fromEntities": []interface{}{"all"},
+				"toPorts":      tcpPorts(kubeAPIServerPort),
+			},
+		)
+	}
+	if egress {
+		rules, _ := settings["egress"].([]interface{})
+		guarded["egress"] = append(append([]interface{}{}, rules...),
+			map[string]interface{}{
+				"toEntities": []interface{}{"kube-apiserver"},
+			},
+		)
+	}
+	return guarded
+}
+
+func tcpPorts(ports ...string) []interface{} {
+	list := make([]interface{}, 0, len(ports))
+	for _, p := range ports {
+		list = append(list, map[string]interface{}{"port": p, "protocol": "TCP"})
+	}
+	return []interface{}{map[string]interface{}{"ports": list}}
+}
+
+// handleHostPolicy applies a host policy, a CiliumClusterwideNetworkPolicy
+// selecting nodes, with the guardrail rules added. A warning is returned
+// along when the host firewall is disabled, the policy is not enforced
+// until the host firewall operation enables it.
+func handleHostPolicy(ctx context.Context, h *Handler, comp v1alpha1.Component, isDel bool) (string, error) {
+	if _, ok := comp.Spec.Settings["nodeSelector"]; !ok && !isDel {
+		err := ErrApplyPolicy(ciliumClusterwideNetworkPolicyKind, comp.Name, fmt.Errorf("host policies select the nodes with nodeSelector"))
+		h.Log.Error(err)
+		return "", err
+	}
+	if !isDel {
+		comp.Spec.Settings = guardHostPolicy(comp.Spec.Settings)
+	}
+
+	msg, err := handleCiliumCoreComponent(ctx, h, comp, isDel, "cilium.io/v2", ciliumClusterwideNetworkPolicyKind)
+	if err != nil || isDel {
+		return msg, err
+	}
+
+	if cfg, err := h.agentConfig(ctx); err == nil && cfg["enable-host-firewall"] != "true" {
+		h.Log.Warn(ErrHostFirewallDisabled)
+		return fmt.Sprintf("%s, warning: the host firewall is disabled, the policy is not enforced", msg), nil
+	}
+	return msg, nil
+}
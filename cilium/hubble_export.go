@@ -0,0 +1,358 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	hubbleExporterName    = "meshery-hubble-exporter"
+	hubbleExporterImage   = "otel/opentelemetry-collector-contrib:0.88.0"
+	defaultHubbleFlowFile = "/var/run/cilium/hubble/events.log"
+
+	// Sinks of the exported flows
+	hubbleSinkFile  = "file"
+	hubbleSinkKafka = "kafka"
+	hubbleSinkOTLP  = "otlp"
+)
+
+// HubbleExportRequest is the body of the Hubble flow export operation
+type HubbleExportRequest struct {
+	// Sink is file, kafka or otlp. The agents always write the flows to
+	// a file on their node, the kafka and otlp sinks ship them from there.
+	Sink string `json:"sink"`
+	// FilePath is the file the agents write the flows to
+	FilePath       string `json:"filePath,omitempty"`
+	FileMaxSizeMB  int    `json:"fileMaxSizeMb,omitempty"`
+	FileMaxBackups int    `json:"fileMaxBackups,omitempty"`
+	// AllowList and DenyList are the Hubble flow filters of the exported
+	// flows, FieldMask the fields of the flows exported
+	AllowList []interface{} `json:"allowList,omitempty"`
+	DenyList  []interface{} `json:"denyList,omitempty"`
+	FieldMask []string      `json:"fieldMask,omitempty"`
+
+	Kafka *HubbleKafkaSink `json:"kafka,omitempty"`
+	OTLP  *HubbleOTLPSink  `json:"otlp,omitempty"`
+}
+
+// HubbleKafkaSink ships the flows to a Kafka topic
+type HubbleKafkaSink struct {
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+	// CredentialsSecret is a Secret in kube-system holding the username
+	// and password of the SASL PLAIN authentication
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	TLS               bool   `json:"tls,omitempty"`
+}
+
+// HubbleOTLPSink ships the flows as OTLP logs
+type HubbleOTLPSink struct {
+	// Endpoint is the host:port of the OTLP gRPC receiver
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure,omitempty"`
+	// HeadersSecret is a Secret in kube-system whose keys are sent as the
+	// headers of the requests, e.g. the API key of the backend
+	HeadersSecret string `json:"headersSecret,omitempty"`
+}
+
+// parseHubbleExportRequest reads and validates the body of the operation
+func parseHubbleExportRequest(body string) (HubbleExportRequest, error) {
+	req := HubbleExportRequest{}
+	if err := yaml.Unmarshal([]byte(body), &req); err != nil {
+		return req, err
+	}
+	if req.FilePath == "" {
+		req.FilePath = defaultHubbleFlowFile
+	}
+	if !path.IsAbs(req.FilePath) {
+		return req, fmt.Errorf("filePath must be absolute")
+	}
+
+	switch req.Sink {
+	case hubbleSinkFile:
+	case hubbleSinkKafka:
+		if req.Kafka == nil || len(req.Kafka.Brokers) == 0 || req.Kafka.Topic == "" {
+			return req, fmt.Errorf("kafka.brokers and kafka.topic are required for the kafka sink")
+		}
+	case hubbleSinkOTLP:
+		if req.OTLP == nil || req.OTLP.Endpoint == "" {
+			return req, fmt.Errorf("otlp.endpoint is required for the otlp sink")
+		}
+	default:
+		return req, fmt.Errorf("sink must be %s, %s or %s", hubbleSinkFile, hubbleSinkKafka, hubbleSinkOTLP)
+	}
+	return req, nil
+}
+
+// exportHubbleFlows configures the Hubble exporter of the agents to write
+// the flows to a file, and for the kafka and otlp sinks runs a collector
+// on every node shipping the file to the sink. The credentials of the
+// sinks are read from Secrets and never pass through the adapter. Removing
+// the export stops the exporter and the collectors.
+func (h *Handler) exportHubbleFlows(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+
+	if request.IsDeleteOperation {
+		manifest, err := hubbleExporterManifest(HubbleExportRequest{Sink: hubbleSinkOTLP, FilePath: defaultHubbleFlowFile, OTLP: &HubbleOTLPSink{}}, nil)
+		if err != nil {
+			return st, "", ErrHubbleExport(err)
+		}
+		if err := h.applyOrdered(ctx, manifest, true, ciliumNamespace); err != nil {
+			return st, "", ErrHubbleExport(err)
+		}
+		values := map[string]interface{}{}
+		setValue(values, "hubble.export.static.enabled", false)
+		if err := h.reconfigureCilium(ctx, values); err != nil {
+			return st, "", ErrHubbleExport(err)
+		}
+		rollout, err := h.restartAgents(ctx)
+		if err != nil {
+			return st, "", ErrHubbleExport(err)
+		}
+		return status.Removed, fmt.Sprintf("Hubble flows are no longer exported, agents restarted: %s", rollout), nil
+	}
+
+	req, err := parseHubbleExportRequest(request.CustomBody)
+	if err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+	if cfg["enable-hubble"] != "true" {
+		return st, "", ErrHubbleExport(fmt.Errorf("hubble is disabled on the agents"))
+	}
+	version, err := h.installedCiliumVersion(ctx)
+	if err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+	if !versionAtLeast(version, 1, 14) {
+		return st, "", ErrHubbleExport(fmt.Errorf("the Hubble exporter requires Cilium 1.14 or newer, installed version is %s", version))
+	}
+
+	// The keys of the Secrets are only read to reference them
+	var secretKeys []string
+	switch {
+	case req.Sink == hubbleSinkKafka && req.Kafka.CredentialsSecret != "":
+		secretKeys, err = h.secretKeys(ctx, req.Kafka.CredentialsSecret)
+		for _, key := range []string{"username", "password"} {
+			if err == nil && !contains(secretKeys, key) {
+				err = fmt.Errorf("secret %s has no %s", req.Kafka.CredentialsSecret, key)
+			}
+		}
+	case req.Sink == hubbleSinkOTLP && req.OTLP.HeadersSecret != "":
+		secretKeys, err = h.secretKeys(ctx, req.OTLP.HeadersSecret)
+	}
+	if err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+
+	values := map[string]interface{}{}
+	setValue(values, "hubble.export.static.enabled", true)
+	setValue(values, "hubble.export.static.filePath", req.FilePath)
+	setValue(values, "hubble.export.static.allowList", nonNilList(req.AllowList))
+	setValue(values, "hubble.export.static.denyList", nonNilList(req.DenyList))
+	fieldMask := make([]interface{}, 0, len(req.FieldMask))
+	for _, f := range req.FieldMask {
+		fieldMask = append(fieldMask, f)
+	}
+	setValue(values, "hubble.export.static.fieldMask", fieldMask)
+	if req.FileMaxSizeMB > 0 {
+		setValue(values, "hubble.export.fileMaxSizeMb", req.FileMaxSizeMB)
+	}
+	if req.FileMaxBackups > 0 {
+		setValue(values, "hubble.export.fileMaxBackups", req.FileMaxBackups)
+	}
+	if err := h.reconfigureCilium(ctx, values); err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+
+	manifest, err := hubbleExporterManifest(req, secretKeys)
+	if err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+	// The collectors of a previous sink are removed along with the sink
+	if err := h.applyOrdered(ctx, manifest, req.Sink == hubbleSinkFile, ciliumNamespace); err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+
+	rollout, err := h.restartAgents(ctx)
+	if err != nil {
+		return st, "", ErrHubbleExport(err)
+	}
+	if req.Sink == hubbleSinkFile {
+		return status.Applied, fmt.Sprintf("Hubble flows are written to %s on every node, agents restarted: %s", req.FilePath, rollout), nil
+	}
+	return status.Applied, fmt.Sprintf("Hubble flows are shipped to the %s sink, agents restarted: %s", req.Sink, rollout), nil
+}
+
+// secretKeys returns the keys of a Secret of kube-system, sorted
+func (h *Handler) secretKeys(ctx context.Context, name string) ([]string, error) {
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+	secret, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// hubbleExporterManifest renders the collectors shipping the flow file of
+// every node to the sink. The secret values are passed to the collectors
+// as environment variables referenced by their configuration.
+func hubbleExporterManifest(req HubbleExportRequest, secretKeys []string) ([]byte, error) {
+	labels := map[string]interface{}{"app": hubbleExporterName}
+	var env []interface{}
+	secretEnv := func(name, secret, key string) {
+		env = append(env, map[string]interface{}{
+			"name": name,
+			"valueFrom": map[string]interface{}{
+				"secretKeyRef": map[string]interface{}{"name": secret, "key": key},
+			},
+		})
+	}
+
+	exporters := map[string]interface{}{}
+	var exporter string
+	switch req.Sink {
+	case hubbleSinkKafka:
+		exporter = "kafka"
+		brokers := make([]interface{}, 0, len(req.Kafka.Brokers))
+		for _, b := range req.Kafka.Brokers {
+			brokers = append(brokers, b)
+		}
+		kafka := map[string]interface{}{
+			"brokers":  brokers,
+			"topic":    req.Kafka.Topic,
+			"encoding": "raw",
+		}
+		auth := map[string]interface{}{}
+		if req.Kafka.CredentialsSecret != "" {
+			secretEnv("KAFKA_USERNAME", req.Kafka.CredentialsSecret, "username")
+			secretEnv("KAFKA_PASSWORD", req.Kafka.CredentialsSecret, "password")
+			auth["sasl"] = map[string]interface{}{
+				"username":  "${env:KAFKA_USERNAME}",
+				"password":  "${env:KAFKA_PASSWORD}",
+				"mechanism": "PLAIN",
+			}
+		}
+		if req.Kafka.TLS {
+			auth["tls"] = map[string]interface{}{"insecure": false}
+		}
+		if len(auth) > 0 {
+			kafka["auth"] = auth
+		}
+		exporters[exporter] = kafka
+	case hubbleSinkOTLP:
+		exporter = "otlp"
+		headers := map[string]interface{}{}
+		for i, key := range secretKeys {
+			name := fmt.Sprintf("OTLP_HEADER_%d", i)
+			secretEnv(name, req.OTLP.HeadersSecret, key)
+			headers[key] = fmt.Sprintf("${env:%s}", name)
+		}
+		exporters[exporter] = map[string]interface{}{
+			"endpoint": req.OTLP.Endpoint,
+			"tls":      map[string]interface{}{"insecure": req.OTLP.Insecure},
+			"headers":  headers,
+		}
+	}
+
+	collectorConfig, err := yaml.Marshal(map[string]interface{}{
+		"receivers": map[string]interface{}{
+			"filelog": map[string]interface{}{
+				"include":  []interface{}{req.FilePath},
+				"start_at": "end",
+			},
+		},
+		"exporters": exporters,
+		"service": map[string]interface{}{
+			"pipelines": map[string]interface{}{
+				"logs": map[string]interface{}{
+					"receivers": []interface{}{"filelog"},
+					"exporters": []interface{}{exporter},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	container := map[string]interface{}{
+		"name":  "collector",
+		"image": hubbleExporterImage,
+		"args":  []interface{}{"--config=/etc/collector/config.yaml"},
+		"volumeMounts": []interface{}{
+			map[string]interface{}{"name": "config", "mountPath": "/etc/collector", "readOnly": true},
+			map[string]interface{}{"name": "flows", "mountPath": path.Dir(req.FilePath), "readOnly": true},
+		},
+	}
+	if len(env) > 0 {
+		container["env"] = env
+	}
+
+	docs := []map[string]interface{}{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": hubbleExporterName, "namespace": ciliumNamespace, "labels": labels},
+			"data":       map[string]interface{}{"config.yaml": string(collectorConfig)},
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "DaemonSet",
+			"metadata":   map[string]interface{}{"name": hubbleExporterName, "namespace": ciliumNamespace, "labels": labels},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": labels},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"labels": labels},
+					"spec": map[string]interface{}{
+						"containers": []interface{}{container},
+						// The flows of every node are shipped, as with the agents
+						"tolerations": []interface{}{map[string]interface{}{"operator": "Exists"}},
+						"volumes": []interface{}{
+							map[string]interface{}{"name": "config", "configMap": map[string]interface{}{"name": hubbleExporterName}},
+							map[string]interface{}{"name": "flows", "hostPath": map[string]interface{}{"path": path.Dir(req.FilePath), "type": "DirectoryOrCreate"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var manifest []string
+	for _, doc := range docs {
+		byt, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, string(byt))
+	}
+	return []byte(strings.Join(manifest, "---\n")), nil
+}
+
+func nonNilList(list []interface{}) []interface{} {
+	if list == nil {
+		return []interface{}{}
+	}
+	return list
+}
@@ -0,0 +1,156 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultHubbleMetricsPort = 9965
+
+// hubbleMetricNames are the metrics Hubble derives from the flows
+var hubbleMetricNames = []string{"dns", "drop", "tcp", "flow", "http", "httpV2", "icmp", "kafka", "port-distribution", "flows-to-world", "policy"}
+
+// HubbleMetric is a metric derived from the flows. Its options tailor the
+// cardinality of the metric, e.g. sourceContext=namespace labels the
+// series with the source namespace instead of the source pod.
+type HubbleMetric struct {
+	Name    string   `json:"name"`
+	Options []string `json:"options,omitempty"`
+}
+
+func (m HubbleMetric) String() string {
+	if len(m.Options) == 0 {
+		return m.Name
+	}
+	return m.Name + ":" + strings.Join(m.Options, ";")
+}
+
+// HubbleMetricsRequest is the body of the Hubble metrics operation
+type HubbleMetricsRequest struct {
+	Metrics []HubbleMetric `json:"metrics"`
+	// Port is the port the agents serve the metrics on
+	Port int `json:"port,omitempty"`
+}
+
+// parseHubbleMetricsRequest reads and validates the body of the operation
+func parseHubbleMetricsRequest(body string) (HubbleMetricsRequest, error) {
+	req := HubbleMetricsRequest{}
+	if err := yaml.Unmarshal([]byte(body), &req); err != nil {
+		return req, err
+	}
+	if len(req.Metrics) == 0 {
+		return req, fmt.Errorf("metrics lists no metric, delete the operation to disable the Hubble metrics")
+	}
+	for _, m := range req.Metrics {
+		if !contains(hubbleMetricNames, m.Name) {
+			return req, fmt.Errorf("unknown Hubble metric %q, the metrics are %s", m.Name, strings.Join(hubbleMetricNames, ", "))
+		}
+	}
+	if req.Port == 0 {
+		req.Port = defaultHubbleMetricsPort
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		return req, fmt.Errorf("port %d is out of range", req.Port)
+	}
+	return req, nil
+}
+
+// configureHubbleMetrics enables the Hubble metrics of the request and
+// annotates them for Prometheus. The pods of the agents are annotated
+// unless they are annotated for the agent metrics already, the Service of
+// the Hubble metrics is annotated in either case. Deleting the operation
+// disables the Hubble metrics.
+func (h *Handler) configureHubbleMetrics(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrHubbleMetrics(err)
+	}
+
+	values := map[string]interface{}{}
+	var enabled []string
+	if request.IsDeleteOperation {
+		if cfg["hubble-metrics-server"] == "" {
+			return status.Removed, "Hubble metrics already disabled, agents not restarted.", nil
+		}
+		setValue(values, "hubble.metrics.enabled", []interface{}{})
+		setValue(values, "hubble.metrics.serviceAnnotations", nil)
+		if cfg["prometheus-serve-addr"] == "" {
+			values["podAnnotations"] = map[string]interface{}{
+				"prometheus.io/scrape": nil,
+				"prometheus.io/port":   nil,
+			}
+		}
+	} else {
+		req, err := parseHubbleMetricsRequest(request.CustomBody)
+		if err != nil {
+			return st, "", ErrHubbleMetrics(err)
+		}
+		list := make([]interface{}, 0, len(req.Metrics))
+		for _, m := range req.Metrics {
+			enabled = append(enabled, m.String())
+			list = append(list, m.String())
+		}
+		if cfg["hubble-metrics-server"] == fmt.Sprintf(":%d", req.Port) && sameMetrics(cfg["hubble-metrics"], enabled) {
+			return status.Applied, "Hubble metrics already enabled, agents not restarted.", nil
+		}
+
+		port := strconv.Itoa(req.Port)
+		setValue(values, "hubble.enabled", true)
+		setValue(values, "hubble.metrics.enabled", list)
+		setValue(values, "hubble.metrics.port", req.Port)
+		setValue(values, "hubble.metrics.serviceAnnotations", map[string]interface{}{
+			"prometheus.io/scrape": "true",
+			"prometheus.io/port":   port,
+		})
+		// A pod is scraped on a single port, the agent metrics keep it
+		if cfg["prometheus-serve-addr"] == "" {
+			values["podAnnotations"] = map[string]interface{}{
+				"prometheus.io/scrape": "true",
+				"prometheus.io/port":   port,
+			}
+		}
+	}
+
+	if err := h.reconfigureCilium(ctx, values); err != nil {
+		return st, "", ErrHubbleMetrics(err)
+	}
+	rollout, err := h.restartAgents(ctx)
+	if err != nil {
+		return st, "", ErrHubbleMetrics(err)
+	}
+
+	if request.IsDeleteOperation {
+		return status.Removed, fmt.Sprintf("Hubble metrics disabled, agents restarted: %s", rollout), nil
+	}
+	return status.Applied, fmt.Sprintf("Hubble metrics %s enabled, agents restarted: %s", strings.Join(enabled, ", "), rollout), nil
+}
+
+// sameMetrics reports whether the hubble-metrics setting of the agents
+// enables the metrics, whatever their order
+func sameMetrics(current string, metrics []string) bool {
+	cur := strings.Fields(current)
+	if len(cur) != len(metrics) {
+		return false
+	}
+	want := append([]string{}, metrics...)
+	sort.Strings(cur)
+	sort.Strings(want)
+	for i := range cur {
+		if cur[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,360 @@
+package cilium
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// The secrets the chart stores the Hubble certificates in
+	hubbleServerCertsSecret      = "hubble-server-certs"
+	hubbleRelayClientCertsSecret = "hubble-relay-client-certs"
+	hubbleRelayServerCertsSecret = "hubble-relay-server-certs"
+
+	// hubbleRelayServerName is a name the certificate of the relay is
+	// valid for, the certificates are issued for *.hubble-relay.cilium.io
+	hubbleRelayServerName = "relay.hubble-relay.cilium.io"
+	hubbleRelayTLSPort    = 443
+
+	// Methods generating the certificates of Hubble
+	hubbleCertsCertgen     = "certgen"
+	hubbleCertsHelm        = "helm"
+	hubbleCertsCertManager = "certmanager"
+	hubbleCertsExisting    = "existing"
+
+	// hubbleCertsRenewBefore is how long before they expire the existing
+	// certificates are no longer reused
+	hubbleCertsRenewBefore = 30 * 24 * time.Hour
+
+	hubbleRelayReadyPoll    = 5 * time.Second
+	hubbleRelayReadyTimeout = 5 * time.Minute
+)
+
+// certManagerCertificatesCRD is only served once cert-manager is installed
+const certManagerCertificatesCRD = "certificates.cert-manager.io"
+
+// HubbleRelayRequest is the body of the Hubble Relay operation
+type HubbleRelayRequest struct {
+	// CertMethod generates the certificates of Hubble: certgen runs the
+	// certgen job of the chart, helm generates them on every upgrade,
+	// certmanager issues them from a cert-manager issuer and existing
+	// reuses the certificates already in the cluster. By default the
+	// existing certificates are reused unless they expire soon, certgen
+	// generates them otherwise.
+	CertMethod string `json:"certMethod,omitempty"`
+	// Issuer is the cert-manager issuer of the certmanager method, a
+	// ClusterIssuer unless IssuerKind says otherwise
+	Issuer     string `json:"issuer,omitempty"`
+	IssuerKind string `json:"issuerKind,omitempty"`
+	// ValidityDays is how long the generated certificates are valid for
+	ValidityDays int `json:"validityDays,omitempty"`
+	// Schedule is the cron schedule the certgen job regenerates the
+	// certificates on
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// HubbleCertificate is a certificate of Hubble stored in a secret
+type HubbleCertificate struct {
+	Secret   string    `json:"secret"`
+	DNSNames []string  `json:"dnsNames,omitempty"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// HubbleRelayEndpoint is how Meshery reaches the flow API of Hubble Relay
+type HubbleRelayEndpoint struct {
+	Address string `json:"address"`
+	TLS     bool   `json:"tls"`
+	// ServerName is the name to verify the certificate of the relay with
+	ServerName string `json:"serverName,omitempty"`
+	// CASecret holds the CA of the relay under ca.crt, CACert is its
+	// certificate
+	CASecret     string              `json:"caSecret,omitempty"`
+	CACert       string              `json:"caCert,omitempty"`
+	CertMethod   string              `json:"certMethod,omitempty"`
+	Certificates []HubbleCertificate `json:"certificates,omitempty"`
+}
+
+// parseHubbleRelayRequest reads and validates the body of the operation
+func parseHubbleRelayRequest(body string) (HubbleRelayRequest, error) {
+	req := HubbleRelayRequest{}
+	if err := yaml.Unmarshal([]byte(body), &req); err != nil {
+		return req, err
+	}
+	switch req.CertMethod {
+	case "", hubbleCertsCertgen, hubbleCertsHelm, hubbleCertsExisting:
+	case hubbleCertsCertManager:
+		if req.Issuer == "" {
+			return req, fmt.Errorf("issuer is required by the %s method", hubbleCertsCertManager)
+		}
+		if req.IssuerKind == "" {
+			req.IssuerKind = "ClusterIssuer"
+		}
+		if req.IssuerKind != "ClusterIssuer" && req.IssuerKind != "Issuer" {
+			return req, fmt.Errorf("issuerKind must be ClusterIssuer or Issuer")
+		}
+	default:
+		return req, fmt.Errorf("certMethod must be %s, %s, %s or %s", hubbleCertsCertgen, hubbleCertsHelm, hubbleCertsCertManager, hubbleCertsExisting)
+	}
+	if req.ValidityDays < 0 {
+		return req, fmt.Errorf("validityDays must be positive")
+	}
+	return req, nil
+}
+
+// configureHubbleRelay enables Hubble Relay serving the flow API over TLS,
+// with the certificates of Hubble generated by certgen, Helm or cert-manager
+// or reused from the cluster, and returns the endpoint of the relay.
+// Removing it disables Hubble Relay.
+func (h *Handler) configureHubbleRelay(ctx context.Context, request adapter.OperationRequest) (string, *HubbleRelayEndpoint, error) {
+	if h.KubeClient == nil {
+		return status.Applying, nil, ErrNilClient
+	}
+	if request.IsDeleteOperation {
+		values := map[string]interface{}{}
+		setValue(values, "hubble.relay.enabled", false)
+		if err := h.reconfigureCilium(ctx, values); err != nil {
+			return status.Removing, nil, ErrConfigureHubbleRelay(err)
+		}
+		return status.Removed, nil, nil
+	}
+
+	req, err := parseHubbleRelayRequest(request.CustomBody)
+	if err != nil {
+		return status.Applying, nil, ErrConfigureHubbleRelay(err)
+	}
+
+	values := map[string]interface{}{}
+	setValue(values, "hubble.enabled", true)
+	setValue(values, "hubble.relay.enabled", true)
+	setValue(values, "hubble.tls.enabled", true)
+	setValue(values, "hubble.relay.tls.server.enabled", true)
+	method, err := h.hubbleCertValues(ctx, values, req)
+	if err != nil {
+		return status.Applying, nil, ErrConfigureHubbleRelay(err)
+	}
+	if err := h.kubernetesValues(ctx, values); err != nil {
+		return status.Applying, nil, err
+	}
+	reportProgress(ctx, "Enabling Hubble Relay with TLS", fmt.Sprintf("The certificates of Hubble are provided by %s.", method))
+
+	if err := h.reconfigureCilium(ctx, values); err != nil {
+		return status.Applying, nil, ErrConfigureHubbleRelay(err)
+	}
+	// The agents only load the certificates of their Hubble server on start
+	if _, err := h.restartAgents(ctx); err != nil {
+		return status.Applying, nil, ErrConfigureHubbleRelay(err)
+	}
+	if err := h.waitForHubbleRelay(ctx); err != nil {
+		return status.Applying, nil, ErrConfigureHubbleRelay(err)
+	}
+
+	endpoint, err := h.hubbleRelayEndpoint(ctx)
+	if err != nil {
+		return status.Applying, nil, ErrConfigureHubbleRelay(err)
+	}
+	endpoint.CertMethod = method
+	return status.Applied, endpoint, nil
+}
+
+// hubbleCertValues sets the chart values generating or reusing the
+// certificates of Hubble and returns the method used
+func (h *Handler) hubbleCertValues(ctx context.Context, values map[string]interface{}, req HubbleRelayRequest) (string, error) {
+	method := req.CertMethod
+	if method == "" {
+		method = hubbleCertsCertgen
+		if certs, err := h.hubbleCertificates(ctx); err == nil && certsValid(certs) {
+			method = hubbleCertsExisting
+		}
+	}
+
+	if method == hubbleCertsExisting {
+		setValue(values, "hubble.tls.auto.enabled", false)
+		return method, h.existingHubbleCertValues(ctx, values)
+	}
+
+	setValue(values, "hubble.tls.auto.enabled", true)
+	if req.ValidityDays > 0 {
+		setValue(values, "hubble.tls.auto.certValidityDuration", req.ValidityDays)
+	}
+	switch method {
+	case hubbleCertsCertgen:
+		setValue(values, "hubble.tls.auto.method", "cronJob")
+		if req.Schedule != "" {
+			setValue(values, "hubble.tls.auto.schedule", req.Schedule)
+		}
+	case hubbleCertsHelm:
+		setValue(values, "hubble.tls.auto.method", "helm")
+	case hubbleCertsCertManager:
+		if h.DynamicKubeClient == nil {
+			return method, ErrNilClient
+		}
+		if _, err := h.DynamicKubeClient.Resource(crdResource).Get(ctx, certManagerCertificatesCRD, metav1.GetOptions{}); err != nil {
+			if kerrors.IsNotFound(err) {
+				err = fmt.Errorf("cert-manager is not installed, the %s CRD is missing", certManagerCertificatesCRD)
+			}
+			return method, err
+		}
+		setValue(values, "hubble.tls.auto.method", "certmanager")
+		setValue(values, "hubble.tls.auto.certManagerIssuerRef", map[string]interface{}{
+			"group": "cert-manager.io",
+			"kind":  req.IssuerKind,
+			"name":  req.Issuer,
+		})
+	}
+	return method, nil
+}
+
+// existingHubbleCertValues passes the certificates stored in the cluster
+// to the chart, which otherwise replaces them with empty ones
+func (h *Handler) existingHubbleCertValues(ctx context.Context, values map[string]interface{}) error {
+	secrets := []struct {
+		name string
+		path string
+	}{
+		{hubbleServerCertsSecret, "hubble.tls.server"},
+		{hubbleRelayClientCertsSecret, "hubble.relay.tls.client"},
+		{hubbleRelayServerCertsSecret, "hubble.relay.tls.server"},
+	}
+	for _, s := range secrets {
+		secret, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, s.name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return fmt.Errorf("the %s secret doesn't exist, there are no certificates to reuse", s.name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(secret.Data["tls.crt"]) == 0 || len(secret.Data["tls.key"]) == 0 {
+			return fmt.Errorf("the %s secret holds no certificate", s.name)
+		}
+		setValue(values, s.path+".cert", base64.StdEncoding.EncodeToString(secret.Data["tls.crt"]))
+		setValue(values, s.path+".key", base64.StdEncoding.EncodeToString(secret.Data["tls.key"]))
+		if ca := secret.Data["ca.crt"]; len(ca) > 0 {
+			setValue(values, "hubble.tls.ca.cert", base64.StdEncoding.EncodeToString(ca))
+		}
+	}
+	return nil
+}
+
+// hubbleCertificates returns the certificates of Hubble stored in the
+// cluster
+func (h *Handler) hubbleCertificates(ctx context.Context) ([]HubbleCertificate, error) {
+	var certs []HubbleCertificate
+	for _, name := range []string{hubbleServerCertsSecret, hubbleRelayClientCertsSecret, hubbleRelayServerCertsSecret} {
+		secret, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		cert, err := parseCertificate(secret.Data["tls.crt"])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		certs = append(certs, HubbleCertificate{Secret: name, DNSNames: cert.DNSNames, NotAfter: cert.NotAfter})
+	}
+	return certs, nil
+}
+
+// certsValid reports whether every certificate is valid for longer than
+// hubbleCertsRenewBefore
+func certsValid(certs []HubbleCertificate) bool {
+	for _, c := range certs {
+		if time.Until(c.NotAfter) < hubbleCertsRenewBefore {
+			return false
+		}
+	}
+	return len(certs) > 0
+}
+
+// parseCertificate parses the first certificate of a PEM bundle
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// waitForHubbleRelay blocks until every replica of Hubble Relay runs the
+// latest template and is ready
+func (h *Handler) waitForHubbleRelay(ctx context.Context) error {
+	ready := ""
+	err := wait.PollImmediate(hubbleRelayReadyPoll, hubbleRelayReadyTimeout, func() (bool, error) {
+		relay, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Get(ctx, hubbleRelayName, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		cur := fmt.Sprintf("%d/%d replicas updated, %d ready", relay.Status.UpdatedReplicas, relay.Status.Replicas, relay.Status.ReadyReplicas)
+		if cur != ready {
+			reportProgress(ctx, "Hubble Relay rolling out", cur)
+		}
+		ready = cur
+		return relay.Status.ObservedGeneration >= relay.Generation &&
+			relay.Status.ReadyReplicas > 0 && relay.Status.UpdatedReplicas == relay.Status.Replicas &&
+			relay.Status.ReadyReplicas == relay.Status.Replicas, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s not ready within %s: %s", hubbleRelayName, hubbleRelayReadyTimeout, ready)
+	}
+	return nil
+}
+
+// hubbleRelayEndpoint returns the endpoint of Hubble Relay along with the
+// certificates of Hubble
+func (h *Handler) hubbleRelayEndpoint(ctx context.Context) (*HubbleRelayEndpoint, error) {
+	secret, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, hubbleRelayServerCertsSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	certs, err := h.hubbleCertificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &HubbleRelayEndpoint{
+		Address:      fmt.Sprintf("%s.%s.svc:%d", hubbleRelayName, ciliumNamespace, hubbleRelayTLSPort),
+		TLS:          true,
+		ServerName:   hubbleRelayServerName,
+		CASecret:     ciliumNamespace + "/" + hubbleRelayServerCertsSecret,
+		CACert:       string(secret.Data["ca.crt"]),
+		Certificates: certs,
+	}, nil
+}
+
+// hubbleTLSArgs returns the arguments of the hubble CLI verifying the
+// certificate of Hubble Relay when it serves over TLS, along with the
+// function removing the CA written for the CLI
+func (h *Handler) hubbleTLSArgs(ctx context.Context) ([]string, func(), error) {
+	secret, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, hubbleRelayServerCertsSecret, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, func() {}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := ioutil.TempFile("", "hubble-relay-ca-*.crt")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	_, err = f.Write(secret.Data["ca.crt"])
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return []string{"--tls", "--tls-server-name", hubbleRelayServerName, "--tls-ca-cert-files", f.Name()}, cleanup, nil
+}
@@ -0,0 +1,350 @@
+package cilium
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	hubbleUIName        = "meshery-hubble-ui"
+	hubbleUIService     = "hubble-ui"
+	ciliumOperatorName  = "cilium-operator"
+	hubbleUIProxyPort   = 8080
+	basicAuthProxyImage = "nginxinc/nginx-unprivileged:1.23-alpine"
+	oidcProxyImage      = "quay.io/oauth2-proxy/oauth2-proxy:v7.3.0"
+
+	// Authentication modes of the exposed Hubble UI
+	hubbleUIBasicAuth = "basic"
+	hubbleUIOIDC      = "oidc"
+)
+
+// HubbleUIRequest is the body of the Hubble UI exposure operation
+type HubbleUIRequest struct {
+	// Host is the name the Hubble UI is served under
+	Host string `json:"host"`
+	// TLSSecret is an existing kubernetes.io/tls Secret in kube-system
+	// holding the certificate of the host
+	TLSSecret string `json:"tlsSecret,omitempty"`
+	// ClusterIssuer is the cert-manager issuer of the certificate, used
+	// when no TLSSecret is given
+	ClusterIssuer string `json:"clusterIssuer,omitempty"`
+	// Auth guards the access to the Hubble UI
+	Auth HubbleUIAuth `json:"auth"`
+}
+
+// HubbleUIAuth is the authentication in front of the Hubble UI
+type HubbleUIAuth struct {
+	// Type is either basic or oidc
+	Type string `json:"type"`
+	// Htpasswd holds the htpasswd entries of the basic auth users, the
+	// passwords are never passed in clear
+	Htpasswd string `json:"htpasswd,omitempty"`
+	// IssuerURL, ClientID and ClientSecret configure the OIDC provider
+	IssuerURL    string `json:"issuerURL,omitempty"`
+	ClientID     string `json:"clientID,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// EmailDomains restricts the OIDC users allowed in, all by default
+	EmailDomains []string `json:"emailDomains,omitempty"`
+}
+
+// parseHubbleUIRequest reads and validates the body of the operation
+func parseHubbleUIRequest(body string) (HubbleUIRequest, error) {
+	req := HubbleUIRequest{}
+	if err := yaml.Unmarshal([]byte(body), &req); err != nil {
+		return req, err
+	}
+	if req.Host == "" {
+		return req, fmt.Errorf("host is required")
+	}
+	if req.TLSSecret == "" && req.ClusterIssuer == "" {
+		return req, fmt.Errorf("either tlsSecret or clusterIssuer is required, the Hubble UI is only exposed over TLS")
+	}
+
+	switch req.Auth.Type {
+	case hubbleUIBasicAuth:
+		if strings.TrimSpace(req.Auth.Htpasswd) == "" {
+			return req, fmt.Errorf("auth.htpasswd is required for basic auth")
+		}
+	case hubbleUIOIDC:
+		if req.Auth.IssuerURL == "" || req.Auth.ClientID == "" || req.Auth.ClientSecret == "" {
+			return req, fmt.Errorf("auth.issuerURL, auth.clientID and auth.clientSecret are required for oidc")
+		}
+	default:
+		return req, fmt.Errorf("auth.type must be %s or %s", hubbleUIBasicAuth, hubbleUIOIDC)
+	}
+	return req, nil
+}
+
+// exposeHubbleUI serves the Hubble UI through the Cilium ingress controller
+// over TLS, behind a proxy enforcing basic auth or an OIDC login. Hubble,
+// the UI and the ingress controller are enabled first if needed. Removing
+// the exposure leaves the Cilium features enabled.
+func (h *Handler) exposeHubbleUI(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+
+	if request.IsDeleteOperation {
+		manifest, err := hubbleUIManifest(HubbleUIRequest{Auth: HubbleUIAuth{Type: hubbleUIBasicAuth}}, "")
+		if err != nil {
+			return st, "", ErrExposeHubbleUI(err)
+		}
+		if err := h.applyOrdered(ctx, manifest, true, ciliumNamespace); err != nil {
+			return st, "", ErrExposeHubbleUI(err)
+		}
+		return status.Removed, "Hubble UI is no longer exposed.", nil
+	}
+
+	req, err := parseHubbleUIRequest(request.CustomBody)
+	if err != nil {
+		return st, "", ErrExposeHubbleUI(err)
+	}
+
+	enabled, err := h.enableHubbleUIIngress(ctx)
+	if err != nil {
+		return st, "", ErrExposeHubbleUI(err)
+	}
+
+	cookieSecret, err := randomHex(16)
+	if err != nil {
+		return st, "", ErrExposeHubbleUI(err)
+	}
+	manifest, err := hubbleUIManifest(req, cookieSecret)
+	if err != nil {
+		return st, "", ErrExposeHubbleUI(err)
+	}
+	if err := h.applyOrdered(ctx, manifest, false, ciliumNamespace); err != nil {
+		return st, "", ErrExposeHubbleUI(err)
+	}
+
+	return status.Applied, fmt.Sprintf("Hubble UI is served at https://%s with %s authentication, %s.", req.Host, req.Auth.Type, enabled), nil
+}
+
+// enableHubbleUIIngress enables Hubble, its relay and UI along with the
+// ingress controller and the kube-proxy replacement it requires, unless
+// they already run
+func (h *Handler) enableHubbleUIIngress(ctx context.Context) (string, error) {
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	version, err := h.installedCiliumVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !versionAtLeast(version, 1, 12) {
+		return "", fmt.Errorf("the Cilium ingress controller requires Cilium 1.12 or newer, installed version is %s", version)
+	}
+
+	_, uiErr := h.KubeClient.CoreV1().Services(ciliumNamespace).Get(ctx, hubbleUIService, metav1.GetOptions{})
+	if cfg["enable-hubble"] == "true" && uiErr == nil && cfg["enable-ingress-controller"] == "true" {
+		return "Cilium not reconfigured", nil
+	}
+
+	values := map[string]interface{}{}
+	setValue(values, "hubble.enabled", true)
+	setValue(values, "hubble.relay.enabled", true)
+	setValue(values, "hubble.ui.enabled", true)
+	setValue(values, "ingressController.enabled", true)
+	if !kubeProxyReplacementEnabled(cfg) {
+		if err := h.kubeProxyReplacementValues(ctx, values, true); err != nil {
+			return "", err
+		}
+	}
+	if err := h.reconfigureCilium(ctx, values); err != nil {
+		return "", err
+	}
+
+	// The ingress controller runs in the operator, which only reads
+	// its configuration on start
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"%s"}}}}}`, time.Now().Format(time.RFC3339))
+	if _, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Patch(ctx, ciliumOperatorName, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return "", err
+	}
+	rollout, err := h.restartAgents(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("agents restarted: %s", rollout), nil
+}
+
+// hubbleUIManifest renders the authenticating proxy and the Ingress of the
+// Hubble UI
+func hubbleUIManifest(req HubbleUIRequest, cookieSecret string) ([]byte, error) {
+	labels := map[string]interface{}{"app": hubbleUIName}
+	upstream := fmt.Sprintf("http://%s.%s.svc", hubbleUIService, ciliumNamespace)
+
+	var container map[string]interface{}
+	secretData := map[string]interface{}{}
+	switch req.Auth.Type {
+	case hubbleUIBasicAuth:
+		secretData["htpasswd"] = req.Auth.Htpasswd
+		secretData["default.conf"] = fmt.Sprintf(`server {
+    listen %d;
+    location / {
+        auth_basic "Hubble UI";
+        auth_basic_user_file /etc/nginx/conf.d/htpasswd;
+        proxy_pass %s;
+        proxy_http_version 1.1;
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection "upgrade";
+        proxy_read_timeout 1h;
+    }
+}
+`, hubbleUIProxyPort, upstream)
+		container = map[string]interface{}{
+			"name":  "proxy",
+			"image": basicAuthProxyImage,
+			"volumeMounts": []interface{}{
+				map[string]interface{}{"name": "config", "mountPath": "/etc/nginx/conf.d", "readOnly": true},
+			},
+		}
+	case hubbleUIOIDC:
+		secretData["client-secret"] = req.Auth.ClientSecret
+		secretData["cookie-secret"] = cookieSecret
+		domains := req.Auth.EmailDomains
+		if len(domains) == 0 {
+			domains = []string{"*"}
+		}
+		args := []interface{}{
+			"--provider=oidc",
+			"--oidc-issuer-url=" + req.Auth.IssuerURL,
+			"--client-id=" + req.Auth.ClientID,
+			"--redirect-url=https://" + req.Host + "/oauth2/callback",
+			fmt.Sprintf("--http-address=0.0.0.0:%d", hubbleUIProxyPort),
+			"--upstream=" + upstream,
+			"--cookie-secure=true",
+			"--reverse-proxy=true",
+		}
+		for _, domain := range domains {
+			args = append(args, "--email-domain="+domain)
+		}
+		secretEnv := func(name, key string) map[string]interface{} {
+			return map[string]interface{}{
+				"name": name,
+				"valueFrom": map[string]interface{}{
+					"secretKeyRef": map[string]interface{}{"name": hubbleUIName, "key": key},
+				},
+			}
+		}
+		container = map[string]interface{}{
+			"name":  "proxy",
+			"image": oidcProxyImage,
+			"args":  args,
+			"env": []interface{}{
+				secretEnv("OAUTH2_PROXY_CLIENT_SECRET", "client-secret"),
+				secretEnv("OAUTH2_PROXY_COOKIE_SECRET", "cookie-secret"),
+			},
+		}
+	}
+	container["ports"] = []interface{}{
+		map[string]interface{}{"containerPort": hubbleUIProxyPort},
+	}
+
+	ingressAnnotations := map[string]interface{}{}
+	tlsSecret := req.TLSSecret
+	if tlsSecret == "" {
+		tlsSecret = hubbleUIName + "-tls"
+		if req.ClusterIssuer != "" {
+			ingressAnnotations["cert-manager.io/cluster-issuer"] = req.ClusterIssuer
+		}
+	}
+
+	docs := []map[string]interface{}{
+		{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": hubbleUIName, "namespace": ciliumNamespace, "labels": labels},
+			"stringData": secretData,
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": hubbleUIName, "namespace": ciliumNamespace, "labels": labels},
+			"spec": map[string]interface{}{
+				"replicas": 1,
+				"selector": map[string]interface{}{"matchLabels": labels},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"labels": labels},
+					"spec": map[string]interface{}{
+						"containers": []interface{}{container},
+						"volumes": []interface{}{
+							map[string]interface{}{"name": "config", "secret": map[string]interface{}{"secretName": hubbleUIName}},
+						},
+					},
+				},
+			},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": hubbleUIName, "namespace": ciliumNamespace, "labels": labels},
+			"spec": map[string]interface{}{
+				"selector": labels,
+				"ports": []interface{}{
+					map[string]interface{}{"name": "http", "port": hubbleUIProxyPort, "targetPort": hubbleUIProxyPort},
+				},
+			},
+		},
+		{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": hubbleUIName, "namespace": ciliumNamespace, "labels": labels, "annotations": ingressAnnotations},
+			"spec": map[string]interface{}{
+				"ingressClassName": "cilium",
+				"tls": []interface{}{
+					map[string]interface{}{"hosts": []interface{}{req.Host}, "secretName": tlsSecret},
+				},
+				"rules": []interface{}{
+					map[string]interface{}{
+						"host": req.Host,
+						"http": map[string]interface{}{
+							"paths": []interface{}{
+								map[string]interface{}{
+									"path":     "/",
+									"pathType": "Prefix",
+									"backend": map[string]interface{}{
+										"service": map[string]interface{}{
+											"name": hubbleUIName,
+											"port": map[string]interface{}{"number": hubbleUIProxyPort},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var manifest []string
+	for _, doc := range docs {
+		byt, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, string(byt))
+	}
+	return []byte(strings.Join(manifest, "---\n")), nil
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
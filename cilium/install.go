@@ -15,14 +15,48 @@
 package cilium
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
 )
 
-func (h *Handler) installCilium(del bool, version, ns string) (string, error) {
+// ciliumCoreCRDs are the CRDs the agents register and wait for on startup
+var ciliumCoreCRDs = []string{
+	"ciliumendpoints.cilium.io",
+	"ciliumidentities.cilium.io",
+	"ciliumnetworkpolicies.cilium.io",
+	"ciliumclusterwidenetworkpolicies.cilium.io",
+	"ciliumnodes.cilium.io",
+}
+
+// checkCiliumVersion checks version against the compatibility matrix, for
+// the Kubernetes version of the cluster and the Cilium version it replaces
+// when Cilium is installed already
+func (h *Handler) checkCiliumVersion(ctx context.Context, version string) error {
+	if h.KubeClient == nil {
+		return ErrNilClient
+	}
+	server, err := h.KubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return internalconfig.ErrIncompatibleVersion(fmt.Errorf("reading the Kubernetes version of the cluster: %s", err))
+	}
+	installed, err := h.installedCiliumVersion(ctx)
+	if err == ErrCiliumNotInstalled {
+		installed = ""
+	} else if err != nil {
+		return err
+	}
+	return internalconfig.CheckCiliumVersion(version, server.GitVersion, installed)
+}
+
+// installCilium installs the Cilium chart with the IPAM and dual-stack of
+// the install request
+func (h *Handler) installCilium(ctx context.Context, del bool, version, ns string, install InstallRequest) (string, error) {
 	h.Log.Debug(fmt.Sprintf("Requested install of version: %s", version))
 	h.Log.Debug(fmt.Sprintf("Requested action is delete: %v", del))
 	h.Log.Debug(fmt.Sprintf("Requested action is in namespace: %s", ns))
@@ -37,39 +71,86 @@ func (h *Handler) installCilium(del bool, version, ns string) (string, error) {
 		return st, ErrMeshConfig(err)
 	}
 
+	values := map[string]interface{}{}
+	if !del {
+		if err := h.checkCiliumVersion(ctx, version); err != nil {
+			return st, err
+		}
+		if values, err = h.installValues(ctx, install, version); err != nil {
+			return st, err
+		}
+	}
+
 	h.Log.Info("Installing...")
-	err = h.applyHelmChart(del, version, ns)
+	reportProgress(ctx, fmt.Sprintf("Fetching Cilium chart %s", version), fmt.Sprintf("Fetching chart %s %s from %s.", ciliumHelmChart, version, ciliumHelmRepository))
+	err = h.applyHelmChart(del, version, ns, values)
 	if err != nil {
 		return st, ErrApplyHelmChart(err)
 	}
 
+	noteResource(ctx, "DaemonSet", ciliumNamespace, ciliumAgentName)
+	noteResource(ctx, "Deployment", ciliumNamespace, ciliumOperatorName)
 	st = status.Installed
 	if del {
 		st = status.Removed
+		return st, nil
 	}
+	reportProgress(ctx, fmt.Sprintf("Cilium chart %s applied", version), "Waiting for the Cilium agents to roll out.")
+
+	rollout, err := h.waitForDaemonSetRollout(ctx, ciliumNamespace, ciliumAgentName)
+	if err != nil {
+		noteRemediation(ctx,
+			fmt.Sprintf("Inspect the pods of the %s DaemonSet in %s, e.g. for images failing to pull or crash loops", ciliumAgentName, ciliumNamespace),
+			"Run the cilium_node_health operation to find the nodes whose agent is not ready")
+		return status.Installing, err
+	}
+	if err := h.waitForCRDs(ctx, ciliumCoreCRDs); err != nil {
+		noteRemediation(ctx, fmt.Sprintf("Check the logs of the %s Deployment, it registers the Cilium CRDs", ciliumOperatorName))
+		return status.Installing, ErrInstallCilium(err)
+	}
+	reportProgress(ctx, "Cilium CRDs established", fmt.Sprintf("Cilium agents ready: %s.", rollout))
 
 	return st, nil
 }
 
-func (h *Handler) applyHelmChart(del bool, version, namespace string) error {
+const (
+	ciliumHelmRepository = "https://helm.cilium.io/"
+	ciliumHelmChart      = "cilium"
+)
+
+func (h *Handler) applyHelmChart(del bool, version, namespace string, values map[string]interface{}) error {
 	kClient := h.MesheryKubeclient
+	if kClient == nil {
+		return ErrNilClient
+	}
 
-	repo := "https://helm.cilium.io/"
-	chart := "cilium"
 	var act mesherykube.HelmChartAction
 	if del {
 		act = mesherykube.UNINSTALL
 	} else {
 		act = mesherykube.INSTALL
 	}
-	return kClient.ApplyHelmChart(mesherykube.ApplyHelmChartConfig{
+	if err := kClient.ApplyHelmChart(mesherykube.ApplyHelmChartConfig{
 		ChartLocation: mesherykube.HelmChartLocation{
-			Repository: repo,
-			Chart:      chart,
+			Repository: ciliumHelmRepository,
+			Chart:      ciliumHelmChart,
 			Version:    version,
 		},
-		Namespace:       "kube-system",
+		Namespace:       ciliumNamespace,
 		Action:          act,
 		CreateNamespace: true,
-	})
+		OverrideValues:  values,
+	}); err != nil {
+		return err
+	}
+
+	// Keep track of the installed release so that later reconfigurations
+	// upgrade the same chart version
+	if del {
+		if err := os.Remove(h.releaseStatePath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return h.saveReleaseState(&releaseState{Version: version, Values: values})
 }
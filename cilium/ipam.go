@@ -0,0 +1,216 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// IPAM modes of the install
+const (
+	ipamClusterPool = "cluster-pool"
+	ipamKubernetes  = "kubernetes"
+	ipamENI         = "eni"
+	ipamAzure       = "azure"
+	// ipamGKE runs the kubernetes mode with the routing of GKE
+	ipamGKE = "gke"
+)
+
+// Cloud providers, as the scheme of the providerID of the nodes
+const (
+	providerAWS   = "aws"
+	providerAzure = "azure"
+	providerGCE   = "gce"
+)
+
+// ipamProviders are the cloud providers the IPAM modes require
+var ipamProviders = map[string]string{
+	ipamENI:   providerAWS,
+	ipamAzure: providerAzure,
+	ipamGKE:   providerGCE,
+}
+
+// InstallRequest is the body of the install operation, the settings of a
+// CiliumMesh component
+type InstallRequest struct {
+	IPAM *IPAMConfig `json:"ipam,omitempty"`
+	// DualStack installs Cilium with IPv6 alongside IPv4
+	DualStack *DualStackRequest `json:"dualStack,omitempty"`
+	// Registry pulls the images from a private registry, for clusters
+	// without internet access
+	Registry *RegistryConfig `json:"registry,omitempty"`
+}
+
+// IPAMConfig is the IP address management of the pods chosen on install,
+// the chart defaults to cluster-pool with 10.0.0.0/8 and /24 per node
+type IPAMConfig struct {
+	// Mode is cluster-pool, kubernetes, eni, azure or gke
+	Mode string `json:"mode"`
+	// ClusterPoolIPv4PodCIDRList and ClusterPoolIPv4MaskSize are the pod
+	// CIDRs of the cluster-pool mode and the size of the CIDR each node
+	// is given out of them
+	ClusterPoolIPv4PodCIDRList []string `json:"clusterPoolIPv4PodCIDRList,omitempty"`
+	ClusterPoolIPv4MaskSize    int      `json:"clusterPoolIPv4MaskSize,omitempty"`
+}
+
+func parseInstallRequest(body string) (InstallRequest, error) {
+	req := InstallRequest{}
+	if err := yaml.Unmarshal([]byte(body), &req); err != nil {
+		return req, ErrConfigureIPAM(err)
+	}
+	return req, nil
+}
+
+// componentInstall reads the install settings of a CiliumMesh component
+func componentInstall(settings map[string]interface{}) (InstallRequest, error) {
+	req := InstallRequest{}
+	byt, err := json.Marshal(settings)
+	if err != nil {
+		return req, ErrConfigureIPAM(err)
+	}
+	if err := json.Unmarshal(byt, &req); err != nil {
+		return req, ErrConfigureIPAM(err)
+	}
+	return req, nil
+}
+
+// installValues returns the chart values of an install once its IPAM,
+// registry and dual-stack passed their checks
+func (h *Handler) installValues(ctx context.Context, req InstallRequest, version string) (map[string]interface{}, error) {
+	values, err := h.ipamValues(ctx, req.IPAM, version)
+	if err != nil {
+		return nil, err
+	}
+	if req.Registry != nil {
+		if err := h.registryValues(ctx, values, *req.Registry, chartImages); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.kubernetesValues(ctx, values); err != nil {
+		return nil, err
+	}
+	if req.DualStack == nil {
+		return values, nil
+	}
+
+	mode := ipamClusterPool
+	if req.IPAM != nil {
+		mode = req.IPAM.Mode
+	}
+	if mode == ipamGKE {
+		mode = ipamKubernetes
+	}
+	findings, err := h.dualStackPreflight(ctx, mode, *req.DualStack)
+	if err != nil {
+		return nil, ErrConfigureDualStack(err)
+	}
+	if len(findings) > 0 {
+		return nil, ErrDualStackPreflight(findings)
+	}
+	dualStackValues(values, true, *req.DualStack)
+	return values, nil
+}
+
+// ipamValues validates the IPAM of an install against the cloud provider
+// of the nodes and returns the chart values implementing it, before the
+// chart is rendered since the IPAM mode can't be changed once the pods
+// got their addresses
+func (h *Handler) ipamValues(ctx context.Context, ipam *IPAMConfig, version string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if ipam == nil {
+		return values, nil
+	}
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+	nodes, err := h.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrConfigureIPAM(err)
+	}
+
+	provider := ""
+	var withoutPodCIDR []string
+	for _, node := range nodes.Items {
+		if i := strings.Index(node.Spec.ProviderID, "://"); i > 0 && provider == "" {
+			provider = node.Spec.ProviderID[:i]
+		}
+		if node.Spec.PodCIDR == "" {
+			withoutPodCIDR = append(withoutPodCIDR, node.Name)
+		}
+	}
+	if required, ok := ipamProviders[ipam.Mode]; ok && provider != required {
+		if provider == "" {
+			provider = "none"
+		}
+		return nil, ErrConfigureIPAM(fmt.Errorf("IPAM mode %s requires %s nodes, the cloud provider of the nodes is %s", ipam.Mode, required, provider))
+	}
+
+	switch ipam.Mode {
+	case ipamClusterPool:
+		if err := validateClusterPool(ipam); err != nil {
+			return nil, ErrConfigureIPAM(err)
+		}
+		setValue(values, "ipam.mode", ipamClusterPool)
+		if len(ipam.ClusterPoolIPv4PodCIDRList) > 0 {
+			// Cilium 1.11 turned the pod CIDR into a list
+			if versionAtLeast(version, 1, 11) {
+				setValue(values, "ipam.operator.clusterPoolIPv4PodCIDRList", ipam.ClusterPoolIPv4PodCIDRList)
+			} else {
+				setValue(values, "ipam.operator.clusterPoolIPv4PodCIDR", ipam.ClusterPoolIPv4PodCIDRList[0])
+			}
+		}
+		if ipam.ClusterPoolIPv4MaskSize > 0 {
+			setValue(values, "ipam.operator.clusterPoolIPv4MaskSize", ipam.ClusterPoolIPv4MaskSize)
+		}
+	case ipamKubernetes, ipamGKE:
+		if len(withoutPodCIDR) > 0 {
+			return nil, ErrConfigureIPAM(fmt.Errorf("IPAM mode %s uses the pod CIDRs of the nodes, %s have none, enable --allocate-node-cidrs on the controller manager", ipam.Mode, strings.Join(withoutPodCIDR, ", ")))
+		}
+		setValue(values, "ipam.mode", ipamKubernetes)
+		if ipam.Mode == ipamGKE {
+			setValue(values, "gke.enabled", true)
+		}
+	case ipamENI:
+		setValue(values, "ipam.mode", ipamENI)
+		setValue(values, "eni.enabled", true)
+	case ipamAzure:
+		setValue(values, "ipam.mode", ipamAzure)
+		setValue(values, "azure.enabled", true)
+	default:
+		return nil, ErrConfigureIPAM(fmt.Errorf("IPAM mode %q is not one of cluster-pool, kubernetes, eni, azure or gke", ipam.Mode))
+	}
+	if ipam.Mode != ipamClusterPool && (len(ipam.ClusterPoolIPv4PodCIDRList) > 0 || ipam.ClusterPoolIPv4MaskSize > 0) {
+		return nil, ErrConfigureIPAM(fmt.Errorf("the cluster-pool CIDRs don't apply to IPAM mode %s", ipam.Mode))
+	}
+	return values, nil
+}
+
+// validateClusterPool checks that the pod CIDRs are IPv4 and each leaves
+// room for at least one node CIDR of the mask size
+func validateClusterPool(ipam *IPAMConfig) error {
+	mask := ipam.ClusterPoolIPv4MaskSize
+	if mask == 0 {
+		mask = 24
+	}
+	if mask > 30 {
+		return fmt.Errorf("clusterPoolIPv4MaskSize %d leaves no addresses for the pods of a node", mask)
+	}
+	for _, cidr := range ipam.ClusterPoolIPv4PodCIDRList {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		if ip.To4() == nil {
+			return fmt.Errorf("%s is not an IPv4 CIDR", cidr)
+		}
+		if size, _ := ipNet.Mask.Size(); size > mask {
+			return fmt.Errorf("%s is smaller than the /%d CIDR of a node", cidr, mask)
+		}
+	}
+	return nil
+}
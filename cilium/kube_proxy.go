@@ -0,0 +1,176 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// KubeProxyReplacementRequest is the body of a kube-proxy replacement
+// operation
+type KubeProxyReplacementRequest struct {
+	// K8sServiceHost and K8sServicePort are the address the agents reach
+	// the API server at, they are taken from the endpoints of the
+	// kubernetes Service when not set
+	K8sServiceHost string `json:"k8sServiceHost,omitempty"`
+	K8sServicePort string `json:"k8sServicePort,omitempty"`
+}
+
+// configureKubeProxyReplacement switches the eBPF kube-proxy replacement on
+// or off. Cilium can no longer rely on kube-proxy to reach the API server,
+// its address is given in the body or taken from the cluster.
+func (h *Handler) configureKubeProxyReplacement(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	del := request.IsDeleteOperation
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	req := KubeProxyReplacementRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return st, "", ErrKubeProxyReplacement(err)
+	}
+
+	values := map[string]interface{}{}
+	if err := h.kubeProxyReplacementValuesFor(ctx, values, !del, req); err != nil {
+		return st, "", ErrKubeProxyReplacement(err)
+	}
+
+	return h.toggleAgentFeature(ctx, del, values, ErrKubeProxyReplacement)
+}
+
+// kubeProxyReplacementValues sets the Helm values switching the kube-proxy
+// replacement on or off for the installed Cilium version
+func (h *Handler) kubeProxyReplacementValues(ctx context.Context, values map[string]interface{}, enable bool) error {
+	return h.kubeProxyReplacementValuesFor(ctx, values, enable, KubeProxyReplacementRequest{})
+}
+
+// kubeProxyReplacementValuesFor is kubeProxyReplacementValues with the API
+// server address of req, when it is set
+func (h *Handler) kubeProxyReplacementValuesFor(ctx context.Context, values map[string]interface{}, enable bool, req KubeProxyReplacementRequest) error {
+	version, err := h.ciliumVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Cilium 1.14 replaced the strict/disabled modes with a boolean
+	enabled, disabled := interface{}("strict"), interface{}("disabled")
+	if versionAtLeast(version, 1, 14) {
+		enabled, disabled = true, false
+	}
+
+	if !enable {
+		setValue(values, "kubeProxyReplacement", disabled)
+		return nil
+	}
+
+	host, port := req.K8sServiceHost, req.K8sServicePort
+	if host == "" && port == "" {
+		host, port, err = h.apiServerAddress(ctx)
+	} else {
+		err = validateAPIServerAddress(host, port)
+	}
+	if err != nil {
+		return err
+	}
+	setValue(values, "kubeProxyReplacement", enabled)
+	setValue(values, "k8sServiceHost", host)
+	setValue(values, "k8sServicePort", port)
+	return nil
+}
+
+// apiServerAddress returns the address the agents reach the API server at.
+// The endpoints of the kubernetes Service are the addresses of the API
+// servers as the nodes see them, the kubeconfig may instead go through a
+// tunnel or a load balancer which isn't reachable from the cluster.
+func (h *Handler) apiServerAddress(ctx context.Context) (string, string, error) {
+	endpoints, err := h.KubeClient.CoreV1().Endpoints(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err == nil {
+		for _, subset := range endpoints.Subsets {
+			if len(subset.Addresses) == 0 || len(subset.Ports) == 0 {
+				continue
+			}
+			port := subset.Ports[0].Port
+			for _, p := range subset.Ports {
+				if p.Name == "https" {
+					port = p.Port
+				}
+			}
+			host := subset.Addresses[0].IP
+			if err := validateAPIServerAddress(host, strconv.Itoa(int(port))); err == nil {
+				return host, strconv.Itoa(int(port)), nil
+			}
+		}
+	}
+
+	host, port, err := apiServerHostPort(h.RestConfig.Host)
+	if err != nil {
+		return "", "", err
+	}
+	if err := validateAPIServerAddress(host, port); err != nil {
+		return "", "", fmt.Errorf("%s, set k8sServiceHost and k8sServicePort to the address the nodes reach the API server at", err)
+	}
+	return host, port, nil
+}
+
+// validateAPIServerAddress rejects the addresses the agents can't reach
+// the API server at
+func validateAPIServerAddress(host, port string) error {
+	if host == "" || port == "" {
+		return fmt.Errorf("both k8sServiceHost and k8sServicePort are required")
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("invalid API server port %q", port)
+	}
+	if isLoopback(host) {
+		return fmt.Errorf("the API server address %s is a loopback address, the agents can't reach it", host)
+	}
+	return nil
+}
+
+// isLoopback reports whether host is a loopback address or localhost
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiServerHostPort splits the API server url of a rest config into
+// the host and port expected by the Cilium chart. The rest configs of
+// some kubeconfigs hold a bare host:port.
+func apiServerHostPort(server string) (string, string, error) {
+	if server == "" {
+		return "", "", fmt.Errorf("kubeconfig does not specify an API server address")
+	}
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid API server address %q", server)
+	}
+	if port := u.Port(); port != "" {
+		return u.Hostname(), port, nil
+	}
+
+	// Fall back to the default port of the scheme
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	return u.Hostname(), port, nil
+}
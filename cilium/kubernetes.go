@@ -0,0 +1,81 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podSecurityEnforceLabel is the label of a namespace holding the Pod
+// Security level its pods are admitted with
+const podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+// chartDisruptionBudgets are the PodDisruptionBudgets of the chart, they
+// are rendered as policy/v1beta1 on the clusters without policy/v1 and
+// Kubernetes 1.25 removed policy/v1beta1
+var chartDisruptionBudgets = []string{
+	"operator.podDisruptionBudget.enabled",
+	"hubble.relay.podDisruptionBudget.enabled",
+	"clustermesh.apiserver.podDisruptionBudget.enabled",
+}
+
+// kubernetesValues checks that the namespace of Cilium admits its agents
+// and selects the chart values matching the APIs served by the cluster
+func (h *Handler) kubernetesValues(ctx context.Context, values map[string]interface{}) error {
+	if h.KubeClient == nil {
+		return ErrNilClient
+	}
+
+	// The agents run privileged, the Pod Security admission of Kubernetes
+	// 1.23 and later rejects them under a stricter level
+	ns, err := h.KubeClient.CoreV1().Namespaces().Get(ctx, ciliumNamespace, metav1.GetOptions{})
+	if err != nil {
+		return ErrKubernetesValues(err)
+	}
+	if level := ns.Labels[podSecurityEnforceLabel]; level != "" && level != "privileged" {
+		return ErrKubernetesValues(fmt.Errorf("the %s namespace enforces the %s Pod Security level, the Cilium agents require privileged", ciliumNamespace, level))
+	}
+
+	served, err := h.servesKind("policy/v1", "PodDisruptionBudget")
+	if err != nil {
+		return ErrKubernetesValues(err)
+	}
+	if !served {
+		for _, path := range chartDisruptionBudgets {
+			setValue(values, path, false)
+		}
+	}
+
+	// The certgen CronJob of Hubble is rendered as batch/v1, only served
+	// from Kubernetes 1.21
+	if method, _ := lookupValue(values, "hubble.tls.auto.method"); method == "cronJob" {
+		served, err := h.servesKind("batch/v1", "CronJob")
+		if err != nil {
+			return ErrKubernetesValues(err)
+		}
+		if !served {
+			setValue(values, "hubble.tls.auto.method", "helm")
+			reportProgress(ctx, "Hubble certificates generated by Helm", "The cluster doesn't serve batch/v1 CronJobs, the certificates are generated on every upgrade instead.")
+		}
+	}
+	return nil
+}
+
+// servesKind reports whether the cluster serves kind in groupVersion
+func (h *Handler) servesKind(groupVersion, kind string) (bool, error) {
+	resources, err := h.KubeClient.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Kind == kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
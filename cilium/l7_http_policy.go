@@ -0,0 +1,196 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// L7HTTPPolicyTrait is the trait restricting the HTTP requests a workload
+// accepts through a generated CiliumNetworkPolicy
+const L7HTTPPolicyTrait = "L7HTTPPolicy"
+
+// l7ChainingModes are the CNI chaining modes the proxy of the agents can
+// redirect the traffic to the L7 rules in
+var l7ChainingModes = []string{"", "none", "portmap"}
+
+// L7HTTPPolicyProperties are the properties of the L7HTTPPolicy trait
+type L7HTTPPolicyProperties struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol,omitempty"`
+	// FromEndpoints are the labels of the clients allowed to send the
+	// requests, every endpoint of the cluster by default
+	FromEndpoints map[string]string `json:"fromEndpoints,omitempty"`
+	Rules         []HTTPRule        `json:"rules"`
+}
+
+// HTTPRule is a request allowed by the trait, the method and the path are
+// extended regular expressions matched against the whole request
+type HTTPRule struct {
+	Method  string   `json:"method,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Host    string   `json:"host,omitempty"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+// handleL7HTTPPolicy applies the L7HTTPPolicy trait to a workload component.
+// The generated policy redirects the traffic to the port of the workload
+// to the proxy of the agents, which only forwards the requests matching one
+// of the rules and answers the others with 403.
+func handleL7HTTPPolicy(ctx context.Context, h *Handler, comp v1alpha1.Component, trait v1alpha1.ConfigurationSpecComponentTrait, isDel bool) (string, error) {
+	kind := getKindFromComponent(comp)
+	if !contains(fqdnEgressWorkloads, kind) {
+		return "", ErrL7HTTPPolicy(fmt.Errorf("%s only applies to Deployments, StatefulSets and DaemonSets, %q is a %s", L7HTTPPolicyTrait, comp.Name, kind))
+	}
+	namespace := comp.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	props := L7HTTPPolicyProperties{}
+	byt, err := json.Marshal(trait.Properties)
+	if err != nil {
+		return "", ErrL7HTTPPolicy(err)
+	}
+	if err := json.Unmarshal(byt, &props); err != nil {
+		return "", ErrL7HTTPPolicy(err)
+	}
+	policy, err := l7HTTPPolicy(comp, namespace, props)
+	if err != nil {
+		return "", ErrL7HTTPPolicy(err)
+	}
+	name, _, _ := unstructured.NestedString(policy, "metadata", "name")
+
+	if !isDel {
+		cfg, err := h.agentConfig(ctx)
+		if err != nil {
+			return "", ErrL7HTTPPolicy(err)
+		}
+		if err := l7Compatible(cfg); err != nil {
+			return "", ErrL7HTTPPolicy(err)
+		}
+		if err := h.validatePolicy(ctx, policy); err != nil {
+			return "", err
+		}
+	}
+
+	manifest, err := yaml.Marshal(policy)
+	if err != nil {
+		return "", ErrL7HTTPPolicy(err)
+	}
+	if err := h.applyOrdered(ctx, manifest, isDel, namespace); err != nil {
+		return "", ErrApplyPolicy(ciliumNetworkPolicyKind, name, err)
+	}
+
+	if isDel {
+		return fmt.Sprintf("deleted %s \"%s\" of %s \"%s\"", ciliumNetworkPolicyKind, name, kind, comp.Name), nil
+	}
+	return fmt.Sprintf("created %s \"%s\" allowing %d HTTP rules on port %d of %s \"%s\"", ciliumNetworkPolicyKind, name, len(props.Rules), props.Port, kind, comp.Name), nil
+}
+
+// l7Compatible checks that the datapath of the agents redirects the traffic
+// to the proxy enforcing the L7 rules
+func l7Compatible(cfg map[string]string) error {
+	if cfg["enable-l7-proxy"] == "false" {
+		return fmt.Errorf("the L7 proxy of the agents is disabled, set l7Proxy to true in the Cilium values")
+	}
+	if mode := cfg["cni-chaining-mode"]; !contains(l7ChainingModes, mode) {
+		return fmt.Errorf("L7 rules are not enforced in the %s CNI chaining mode", mode)
+	}
+	return nil
+}
+
+// l7HTTPPolicy generates the CiliumNetworkPolicy of the trait, selecting the
+// pods of the workload
+func l7HTTPPolicy(comp v1alpha1.Component, namespace string, props L7HTTPPolicyProperties) (map[string]interface{}, error) {
+	endpointSelector, err := workloadPodLabels(comp)
+	if err != nil {
+		return nil, err
+	}
+	if props.Port < 1 || props.Port > 65535 {
+		return nil, fmt.Errorf("port %d is not a valid port", props.Port)
+	}
+	protocol := props.Protocol
+	if protocol == "" {
+		protocol = "TCP"
+	}
+	if protocol != "TCP" {
+		return nil, fmt.Errorf("HTTP rules only apply to TCP, not %s", protocol)
+	}
+	if len(props.Rules) == 0 {
+		return nil, fmt.Errorf("rules lists no HTTP request")
+	}
+
+	rules := make([]interface{}, 0, len(props.Rules))
+	for i, r := range props.Rules {
+		rule, err := httpRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %s", i, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	from := map[string]interface{}{"fromEntities": []interface{}{"cluster"}}
+	if len(props.FromEndpoints) > 0 {
+		labels := map[string]interface{}{}
+		for k, v := range props.FromEndpoints {
+			labels[k] = v
+		}
+		from = map[string]interface{}{"fromEndpoints": []interface{}{map[string]interface{}{"matchLabels": labels}}}
+	}
+	from["toPorts"] = []interface{}{map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"port": strconv.Itoa(props.Port), "protocol": protocol}},
+		"rules": map[string]interface{}{"http": rules},
+	}}
+
+	return workloadPolicy(comp, comp.Name+"-l7-http", namespace, map[string]interface{}{
+		"endpointSelector": map[string]interface{}{"matchLabels": endpointSelector},
+		"ingress":          []interface{}{from},
+	}), nil
+}
+
+// httpRule builds an HTTP rule of Cilium, checking that its regular
+// expressions compile. Envoy matches them with RE2, the syntax of the
+// regexp package.
+func httpRule(r HTTPRule) (map[string]interface{}, error) {
+	rule := map[string]interface{}{}
+	if r.Method != "" {
+		if _, err := regexp.Compile(r.Method); err != nil {
+			return nil, fmt.Errorf("method %q is not a valid regular expression: %s", r.Method, err)
+		}
+		rule["method"] = r.Method
+	}
+	if r.Path != "" {
+		if _, err := regexp.Compile(r.Path); err != nil {
+			return nil, fmt.Errorf("path %q is not a valid regular expression: %s", r.Path, err)
+		}
+		rule["path"] = r.Path
+	}
+	if r.Host != "" {
+		if _, err := regexp.Compile(r.Host); err != nil {
+			return nil, fmt.Errorf("host %q is not a valid regular expression: %s", r.Host, err)
+		}
+		rule["host"] = r.Host
+	}
+	if len(r.Headers) > 0 {
+		headers := make([]interface{}, 0, len(r.Headers))
+		for _, hdr := range r.Headers {
+			if strings.TrimSpace(strings.SplitN(hdr, ":", 2)[0]) == "" {
+				return nil, fmt.Errorf("header %q has no name", hdr)
+			}
+			headers = append(headers, hdr)
+		}
+		rule["headers"] = headers
+	}
+	if len(rule) == 0 {
+		return nil, fmt.Errorf("an HTTP rule has at least a method, a path, a host or a header")
+	}
+	return rule, nil
+}
@@ -0,0 +1,162 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	"k8s.io/apimachinery/pkg/apis/meta/unstructured"
+)
+
+const (
+	ciliumLocalRedirectPolicyKind = "CiliumLocalRedirectPolicy"
+	ciliumLocalRedirectPolicyCRD  = "ciliumlocalredirectpolicies.cilium.io"
+)
+
+// localRedirectPolicyEnabled reports whether the agents redirect the
+// traffic matched by the local redirect policies
+func localRedirectPolicyEnabled(cfg map[string]string) bool {
+	return cfg["enable-local-redirect-policy"] == "true"
+}
+
+// configureLocalRedirectPolicy enables the local redirect policies along
+// with the kube-proxy replacement they rely on, unless it is already
+// enabled. Disabling only turns off the local redirect policies.
+func (h *Handler) configureLocalRedirectPolicy(ctx context.Context, del bool) (string, string, error) {
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrConfigureLocalRedirectPolicy(err)
+	}
+
+	values := map[string]interface{}{}
+	if del {
+		setValue(values, "localRedirectPolicy", false)
+	} else {
+		if localRedirectPolicyEnabled(cfg) {
+			return status.Applied, "local redirect policies already enabled, agents not restarted", nil
+		}
+		setValue(values, "localRedirectPolicy", true)
+		if !kubeProxyReplacementEnabled(cfg) {
+			if err := h.kubeProxyReplacementValues(ctx, values, true); err != nil {
+				return st, "", ErrConfigureLocalRedirectPolicy(err)
+			}
+		}
+	}
+
+	return h.toggleAgentFeature(ctx, del, values, ErrConfigureLocalRedirectPolicy)
+}
+
+// checkLocalRedirectPolicy fails the apply of a local redirect policy early
+// when it is invalid or when the agents would ignore it
+func (h *Handler) checkLocalRedirectPolicy(ctx context.Context, policy map[string]interface{}, namespace string) error {
+	name, _, _ := unstructured.NestedString(policy, "metadata", "name")
+
+	violations, err := h.validateCRDSchema(ctx, ciliumLocalRedirectPolicyCRD, policy)
+	if err != nil {
+		return ErrValidatePolicy(ciliumLocalRedirectPolicyKind, name, err)
+	}
+	spec, _ := policy["spec"].(map[string]interface{})
+	violations = append(violations, validateLocalRedirectPolicy(spec, namespace)...)
+	if len(violations) > 0 {
+		return ErrInvalidPolicy(ciliumLocalRedirectPolicyKind, name, violations)
+	}
+
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return ErrConfigureLocalRedirectPolicy(err)
+	}
+	if !localRedirectPolicyEnabled(cfg) {
+		return ErrLocalRedirectPolicyDisabled
+	}
+	return nil
+}
+
+// validateLocalRedirectPolicy checks the rules the agents enforce once they
+// import a local redirect policy, which the CRD schema doesn't express
+func validateLocalRedirectPolicy(spec map[string]interface{}, namespace string) []PolicyViolation {
+	var violations []PolicyViolation
+
+	frontend, _ := spec["redirectFrontend"].(map[string]interface{})
+	addressMatcher, byAddress := frontend["addressMatcher"].(map[string]interface{})
+	serviceMatcher, byService := frontend["serviceMatcher"].(map[string]interface{})
+
+	var frontendPorts []map[string]interface{}
+	frontendField := "spec.redirectFrontend"
+	switch {
+	case byAddress && byService:
+		violations = append(violations, PolicyViolation{Field: "spec.redirectFrontend", Message: "addressMatcher and serviceMatcher are mutually exclusive"})
+	case byAddress:
+		if ip, _ := addressMatcher["ip"].(string); ip == "" {
+			violations = append(violations, PolicyViolation{Field: "spec.redirectFrontend.addressMatcher.ip", Message: "the frontend IP is required"})
+		}
+		frontendPorts = ruleList(addressMatcher["toPorts"])
+		frontendField = "spec.redirectFrontend.addressMatcher.toPorts"
+		if len(frontendPorts) == 0 {
+			violations = append(violations, PolicyViolation{Field: "spec.redirectFrontend.addressMatcher.toPorts", Message: "the frontend ports are required"})
+		}
+	case byService:
+		if svc, _ := serviceMatcher["serviceName"].(string); svc == "" {
+			violations = append(violations, PolicyViolation{Field: "spec.redirectFrontend.serviceMatcher.serviceName", Message: "the service name is required"})
+		}
+		// The agents only redirect services of the namespace of the policy
+		if ns, _ := serviceMatcher["namespace"].(string); ns == "" {
+			violations = append(violations, PolicyViolation{Field: "spec.redirectFrontend.serviceMatcher.namespace", Message: "the service namespace is required"})
+		} else if namespace != "" && ns != namespace {
+			violations = append(violations, PolicyViolation{Field: "spec.redirectFrontend.serviceMatcher.namespace", Message: fmt.Sprintf("the service namespace %q differs from the namespace %q of the policy", ns, namespace)})
+		}
+		frontendPorts = ruleList(serviceMatcher["toPorts"])
+		frontendField = "spec.redirectFrontend.serviceMatcher.toPorts"
+	default:
+		violations = append(violations, PolicyViolation{Field: "spec.redirectFrontend", Message: "one of addressMatcher or serviceMatcher is required"})
+	}
+
+	backend, _ := spec["redirectBackend"].(map[string]interface{})
+	if _, ok := backend["localEndpointSelector"].(map[string]interface{}); !ok {
+		violations = append(violations, PolicyViolation{Field: "spec.redirectBackend.localEndpointSelector", Message: "the selector of the node-local backend pods is required"})
+	}
+	backendPorts := ruleList(backend["toPorts"])
+	if len(backendPorts) == 0 {
+		violations = append(violations, PolicyViolation{Field: "spec.redirectBackend.toPorts", Message: "the backend ports are required"})
+	}
+
+	violations = append(violations, validateRedirectPorts(frontendField, frontendPorts)...)
+	violations = append(violations, validateRedirectPorts("spec.redirectBackend.toPorts", backendPorts)...)
+
+	// Several ports are mapped from the frontend to the backend by name
+	if len(frontendPorts) > 1 {
+		names := map[string]bool{}
+		for _, p := range backendPorts {
+			name, _ := p["name"].(string)
+			names[strings.ToLower(name)] = true
+		}
+		for i, p := range frontendPorts {
+			name, _ := p["name"].(string)
+			if name != "" && !names[strings.ToLower(name)] {
+				violations = append(violations, PolicyViolation{Field: fmt.Sprintf("%s[%d].name", frontendField, i), Message: fmt.Sprintf("no backend port is named %q", name)})
+			}
+		}
+	}
+
+	return violations
+}
+
+// validateRedirectPorts checks the port numbers of a redirect frontend or
+// backend, the ports must be named as soon as there are several of them
+func validateRedirectPorts(field string, ports []map[string]interface{}) []PolicyViolation {
+	var violations []PolicyViolation
+	for i, p := range ports {
+		if port := fmt.Sprint(p["port"]); p["port"] == nil || port == "" {
+			violations = append(violations, PolicyViolation{Field: fmt.Sprintf("%s[%d].port", field, i), Message: "the port number is required"})
+		}
+		if name, _ := p["name"].(string); name == "" && len(ports) > 1 {
+			violations = append(violations, PolicyViolation{Field: fmt.Sprintf("%s[%d].name", field, i), Message: "ports must be named when there are several of them"})
+		}
+	}
+	return violations
+}
@@ -0,0 +1,260 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// MeshStatusPath is the path under which the consolidated status of Cilium
+// is served
+const MeshStatusPath = "/mesh-status"
+
+const (
+	clusterMeshAPIServerName = "clustermesh-apiserver"
+	clusterMeshSecret        = "cilium-clustermesh"
+
+	// statusPageSize bounds the items listed at once to count them
+	statusPageSize = 500
+)
+
+var networkPolicyResource = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+
+// MeshStatus is the overview of the Cilium installation of a cluster, as
+// rendered by the Cilium card of Meshery
+type MeshStatus struct {
+	Version     string            `json:"version"`
+	Healthy     bool              `json:"healthy"`
+	Agents      AgentsHealth      `json:"agents"`
+	Operator    OperatorStatus    `json:"operator"`
+	Features    StatusFeatures    `json:"features"`
+	Policies    PolicyCounts      `json:"policies"`
+	Endpoints   EndpointHealth    `json:"endpoints"`
+	Hubble      HubbleStatus      `json:"hubble"`
+	ClusterMesh ClusterMeshStatus `json:"clusterMesh"`
+}
+
+// AgentsHealth counts the agents by health, Unhealthy lists the nodes of
+// the agents which are not
+type AgentsHealth struct {
+	Total     int      `json:"total"`
+	Healthy   int      `json:"healthy"`
+	Unhealthy []string `json:"unhealthy,omitempty"`
+}
+
+// PolicyCounts counts the network policies enforced by the agents
+type PolicyCounts struct {
+	CiliumNetworkPolicies     int `json:"ciliumNetworkPolicies"`
+	CiliumClusterwidePolicies int `json:"ciliumClusterwideNetworkPolicies"`
+	KubernetesNetworkPolicies int `json:"kubernetesNetworkPolicies"`
+	EndpointsEnforcingIngress int `json:"endpointsEnforcingIngress"`
+	EndpointsEnforcingEgress  int `json:"endpointsEnforcingEgress"`
+}
+
+// EndpointHealth counts the Cilium endpoints by state
+type EndpointHealth struct {
+	Total int `json:"total"`
+	Ready int `json:"ready"`
+	// States counts the endpoints which are not ready by state, e.g.
+	// regenerating or not-ready
+	States map[string]int `json:"states,omitempty"`
+}
+
+// HubbleStatus is the availability of Hubble and its components
+type HubbleStatus struct {
+	Enabled bool `json:"enabled"`
+	Relay   bool `json:"relay"`
+	UI      bool `json:"ui"`
+	// Metrics are the metrics derived from the flows
+	Metrics []string `json:"metrics,omitempty"`
+}
+
+// ClusterMeshStatus is the membership of the cluster in a ClusterMesh
+type ClusterMeshStatus struct {
+	Enabled     bool   `json:"enabled"`
+	ClusterName string `json:"clusterName,omitempty"`
+	ClusterID   string `json:"clusterID,omitempty"`
+	// APIServer reports whether the clustermesh-apiserver exposing the
+	// cluster to the others is ready
+	APIServer bool `json:"apiServer"`
+	// RemoteClusters are the clusters the agents connect to
+	RemoteClusters []string `json:"remoteClusters,omitempty"`
+}
+
+// GetMeshStatus consolidates the health of the agents and the operator,
+// the features enabled, the policies and endpoints, Hubble and ClusterMesh
+// in a single status
+func (h *Handler) GetMeshStatus(ctx context.Context) (*MeshStatus, error) {
+	st, err := h.ciliumStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &MeshStatus{
+		Version:  st.Version,
+		Healthy:  st.Healthy,
+		Operator: st.Operator,
+		Features: st.Features,
+		Hubble: HubbleStatus{
+			Enabled: st.Features.Hubble,
+			Relay:   st.Features.HubbleRelay,
+		},
+		Endpoints: EndpointHealth{States: map[string]int{}},
+	}
+	res.Agents.Total = len(st.Agents)
+	for _, a := range st.Agents {
+		if a.Ready && a.State == "Ok" && a.Error == "" && len(a.FailingControllers) == 0 {
+			res.Agents.Healthy++
+			continue
+		}
+		res.Agents.Unhealthy = append(res.Agents.Unhealthy, a.Node)
+	}
+
+	if cfg["hubble-metrics-server"] != "" {
+		for _, m := range strings.Fields(cfg["hubble-metrics"]) {
+			res.Hubble.Metrics = append(res.Hubble.Metrics, strings.SplitN(m, ":", 2)[0])
+		}
+	}
+	if ui, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Get(ctx, hubbleUIService, metav1.GetOptions{}); err == nil {
+		res.Hubble.UI = ui.Status.ReadyReplicas > 0
+	}
+
+	if res.Policies.CiliumNetworkPolicies, err = h.countResources(ctx, ciliumNetworkPolicyResource); err != nil {
+		return nil, ErrCiliumStatus(err)
+	}
+	if res.Policies.CiliumClusterwidePolicies, err = h.countResources(ctx, ciliumClusterwidePolicyResource); err != nil {
+		return nil, ErrCiliumStatus(err)
+	}
+	if res.Policies.KubernetesNetworkPolicies, err = h.countResources(ctx, networkPolicyResource); err != nil {
+		return nil, ErrCiliumStatus(err)
+	}
+	if err := h.countEndpoints(ctx, res); err != nil {
+		return nil, ErrCiliumStatus(err)
+	}
+
+	res.ClusterMesh = h.clusterMeshStatus(ctx, cfg)
+	return res, nil
+}
+
+// eachPage lists the resources of gvr in every namespace one page at a
+// time, a resource which is not served is empty
+func (h *Handler) eachPage(ctx context.Context, gvr schema.GroupVersionResource, fn func(*unstructured.UnstructuredList)) error {
+	opts := metav1.ListOptions{Limit: statusPageSize}
+	for {
+		list, err := h.DynamicKubeClient.Resource(gvr).List(ctx, opts)
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(list)
+		if list.GetContinue() == "" {
+			return nil
+		}
+		opts.Continue = list.GetContinue()
+	}
+}
+
+func (h *Handler) countResources(ctx context.Context, gvr schema.GroupVersionResource) (int, error) {
+	count := 0
+	err := h.eachPage(ctx, gvr, func(list *unstructured.UnstructuredList) { count += len(list.Items) })
+	return count, err
+}
+
+// countEndpoints counts the Cilium endpoints by state and by the policy
+// enforcement of their identity
+func (h *Handler) countEndpoints(ctx context.Context, res *MeshStatus) error {
+	return h.eachPage(ctx, ciliumEndpointResource, func(list *unstructured.UnstructuredList) {
+		for _, ep := range list.Items {
+			res.Endpoints.Total++
+			state, _, _ := unstructured.NestedString(ep.Object, "status", "state")
+			if state == "ready" {
+				res.Endpoints.Ready++
+			} else {
+				if state == "" {
+					state = "unknown"
+				}
+				res.Endpoints.States[state]++
+			}
+			if enforcing, _, _ := unstructured.NestedBool(ep.Object, "status", "policy", "ingress", "enforcing"); enforcing {
+				res.Policies.EndpointsEnforcingIngress++
+			}
+			if enforcing, _, _ := unstructured.NestedBool(ep.Object, "status", "policy", "egress", "enforcing"); enforcing {
+				res.Policies.EndpointsEnforcingEgress++
+			}
+		}
+	})
+}
+
+// clusterMeshStatus reads the ClusterMesh membership of the cluster. The
+// remote clusters are the entries of the cilium-clustermesh Secret, the
+// certificates it holds along with them have a dotted name.
+func (h *Handler) clusterMeshStatus(ctx context.Context, cfg map[string]string) ClusterMeshStatus {
+	res := ClusterMeshStatus{ClusterName: cfg["cluster-name"], ClusterID: cfg["cluster-id"]}
+	if apiServer, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Get(ctx, clusterMeshAPIServerName, metav1.GetOptions{}); err == nil {
+		res.Enabled = true
+		res.APIServer = apiServer.Status.ReadyReplicas > 0
+	}
+	if secret, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, clusterMeshSecret, metav1.GetOptions{}); err == nil {
+		for name := range secret.Data {
+			if !strings.Contains(name, ".") {
+				res.RemoteClusters = append(res.RemoteClusters, name)
+			}
+		}
+		sort.Strings(res.RemoteClusters)
+	}
+	res.Enabled = res.Enabled || len(res.RemoteClusters) > 0
+	return res
+}
+
+// MeshStatusHandler serves the consolidated status of the cluster managed
+// by the adapter handler h, the context query parameter selects the
+// cluster
+func MeshStatusHandler(h adapter.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler, ok := h.(*Handler)
+		if !ok {
+			http.Error(w, "mesh status is not supported", http.StatusNotImplemented)
+			return
+		}
+		handler, err := handler.forContext(r.URL.Query().Get("context"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		res, err := handler.GetMeshStatus(r.Context())
+		switch {
+		case err == ErrNilClient:
+			http.Error(w, "no cluster configured yet", http.StatusServiceUnavailable)
+			return
+		case err == ErrCiliumNotInstalled:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,140 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultMonitoringNamespace = "monitoring"
+
+// MonitoringRequest is the body of the monitoring add-on operation
+type MonitoringRequest struct {
+	// Namespace is where the dashboards are created for the Grafana
+	// sidecar, the namespace of the operation or monitoring by default
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceMonitorLabels are added to the ServiceMonitors so that they
+	// are selected by the Prometheus of the monitoring stack, e.g.
+	// release: kube-prometheus-stack
+	ServiceMonitorLabels map[string]string `json:"serviceMonitorLabels,omitempty"`
+}
+
+// MonitoringReport describes the ServiceMonitors and the dashboards
+// provisioned by the Cilium chart
+type MonitoringReport struct {
+	Namespace       string   `json:"namespace"`
+	ServiceMonitors []string `json:"serviceMonitors"`
+	Dashboards      []string `json:"dashboards"`
+	// AgentsRestarted describes the restart of the agents whose metrics
+	// were disabled, empty when they were not restarted
+	AgentsRestarted string `json:"agentsRestarted,omitempty"`
+}
+
+// provisionMonitoring enables the ServiceMonitors of the agents, the
+// operator and Hubble along with the official Grafana dashboards shipped
+// by the Cilium chart. Hubble is monitored only when its metrics are
+// enabled. The agent and operator metrics are enabled as needed, the
+// agents are restarted then. Deleting the operation removes the
+// ServiceMonitors and the dashboards, the metrics are left enabled.
+func (h *Handler) provisionMonitoring(ctx context.Context, request adapter.OperationRequest) (string, *MonitoringReport, error) {
+	st := status.Installing
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	if h.DynamicKubeClient == nil {
+		return st, nil, ErrNilClient
+	}
+
+	req := MonitoringRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return st, nil, ErrMonitoringAddon(err)
+	}
+	report := &MonitoringReport{Namespace: req.Namespace, ServiceMonitors: []string{}, Dashboards: []string{}}
+	if report.Namespace == "" {
+		report.Namespace = request.Namespace
+	}
+	if report.Namespace == "" {
+		report.Namespace = defaultMonitoringNamespace
+	}
+
+	values := map[string]interface{}{}
+	if request.IsDeleteOperation {
+		for _, prefix := range []string{"prometheus", "operator.prometheus", "hubble.metrics"} {
+			setValue(values, prefix+".serviceMonitor.enabled", false)
+			setValue(values, prefix+".serviceMonitor.labels", nil)
+		}
+		for _, prefix := range []string{"", "operator.", "hubble.metrics."} {
+			setValue(values, prefix+"dashboards.enabled", false)
+		}
+		if err := h.reconfigureCilium(ctx, values); err != nil {
+			return st, report, ErrMonitoringAddon(err)
+		}
+		return status.Removed, report, nil
+	}
+
+	version, err := h.installedCiliumVersion(ctx)
+	if err != nil {
+		return st, report, ErrMonitoringAddon(err)
+	}
+	if !versionAtLeast(version, 1, 12) {
+		return st, report, ErrMonitoringAddon(fmt.Errorf("the dashboards of the Cilium chart require Cilium 1.12 or newer, %s is installed", version))
+	}
+	// The chart fails to render the ServiceMonitors without their CRD
+	if _, err := h.DynamicKubeClient.Resource(serviceMonitorResource).Namespace(ciliumNamespace).List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		if kerrors.IsNotFound(err) {
+			err = fmt.Errorf("the ServiceMonitor CRD of the Prometheus operator is not installed")
+		}
+		return st, report, ErrMonitoringAddon(err)
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, report, ErrMonitoringAddon(err)
+	}
+
+	ns := fmt.Sprintf("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: %s\n", report.Namespace)
+	if err := h.applyOrdered(ctx, []byte(ns), false, ""); err != nil {
+		return st, report, ErrMonitoringAddon(err)
+	}
+
+	labels := map[string]interface{}{}
+	for k, v := range req.ServiceMonitorLabels {
+		labels[k] = v
+	}
+	monitor := func(prefix, serviceMonitor, dashboards, dashboard string) {
+		setValue(values, prefix+".enabled", true)
+		setValue(values, prefix+".serviceMonitor.enabled", true)
+		setValue(values, prefix+".serviceMonitor.labels", labels)
+		setValue(values, dashboards+".enabled", true)
+		setValue(values, dashboards+".namespace", report.Namespace)
+		report.ServiceMonitors = append(report.ServiceMonitors, serviceMonitor)
+		report.Dashboards = append(report.Dashboards, dashboard)
+	}
+	monitor("prometheus", "cilium-agent", "dashboards", "agent")
+	monitor("operator.prometheus", "cilium-operator", "operator.dashboards", "operator")
+	if cfg["hubble-metrics-server"] != "" {
+		setValue(values, "hubble.metrics.serviceMonitor.enabled", true)
+		setValue(values, "hubble.metrics.serviceMonitor.labels", labels)
+		setValue(values, "hubble.metrics.dashboards.enabled", true)
+		setValue(values, "hubble.metrics.dashboards.namespace", report.Namespace)
+		report.ServiceMonitors = append(report.ServiceMonitors, "hubble")
+		report.Dashboards = append(report.Dashboards, "hubble")
+	}
+
+	if err := h.reconfigureCilium(ctx, values); err != nil {
+		return st, report, ErrMonitoringAddon(err)
+	}
+	// The agents read whether they serve metrics on start only
+	if cfg["prometheus-serve-addr"] == "" {
+		rollout, err := h.restartAgents(ctx)
+		if err != nil {
+			return st, report, ErrMonitoringAddon(err)
+		}
+		report.AgentsRestarted = rollout.String()
+	}
+	return status.Installed, report, nil
+}
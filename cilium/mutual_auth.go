@@ -0,0 +1,160 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// MutualAuthTrait is the trait requiring the peers allowed by a Cilium
+// policy to authenticate each other with their SPIFFE identity
+const MutualAuthTrait = "MutualAuthentication"
+
+const (
+	// spireNamespace is the namespace the chart installs SPIRE in
+	spireNamespace    = "cilium-spire"
+	spireServerName   = "spire-server"
+	spireAgentName    = "spire-agent"
+	spireReadyPoll    = 5 * time.Second
+	spireReadyTimeout = 5 * time.Minute
+)
+
+// authModes are the authentication modes of a policy rule
+var authModes = []string{"required", "disabled"}
+
+// mutualAuthEnabled reports whether the agents authenticate the peers of
+// the rules requiring it
+func mutualAuthEnabled(cfg map[string]string) bool {
+	return cfg["mesh-auth-mutual-enabled"] == "true"
+}
+
+// configureMutualAuth enables the mutual authentication of the agents with
+// the SPIRE server installed by the chart, and waits for SPIRE to be ready
+// to issue the identities of the endpoints. Disabling removes SPIRE, the
+// rules requiring authentication then drop the traffic.
+func (h *Handler) configureMutualAuth(ctx context.Context, del bool) (string, string, error) {
+	st := status.Applying
+	if del {
+		st = status.Removing
+	}
+
+	version, err := h.ciliumVersion(ctx)
+	if err != nil {
+		return st, "", ErrConfigureMutualAuth(err)
+	}
+	if !versionAtLeast(version, 1, 14) {
+		return st, "", ErrConfigureMutualAuth(fmt.Errorf("mutual authentication requires Cilium 1.14 or newer, %s is installed", version))
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, "", ErrConfigureMutualAuth(err)
+	}
+	if !del && mutualAuthEnabled(cfg) {
+		return status.Applied, "mutual authentication already enabled, agents not restarted", nil
+	}
+
+	values := map[string]interface{}{}
+	setValue(values, "authentication.mutual.spire.enabled", !del)
+	setValue(values, "authentication.mutual.spire.install.enabled", !del)
+
+	// SPIRE has to issue the identities before the agents restart
+	var beforeRestart []func(context.Context) error
+	if !del {
+		beforeRestart = append(beforeRestart, h.waitForSpire)
+	}
+	return h.toggleAgentFeature(ctx, del, values, ErrConfigureMutualAuth, beforeRestart...)
+}
+
+// waitForSpire blocks until the SPIRE server and an agent on every node
+// are ready
+func (h *Handler) waitForSpire(ctx context.Context) error {
+	if h.KubeClient == nil {
+		return ErrNilClient
+	}
+
+	ready := ""
+	err := wait.PollImmediate(spireReadyPoll, spireReadyTimeout, func() (bool, error) {
+		server, err := h.KubeClient.AppsV1().StatefulSets(spireNamespace).Get(ctx, spireServerName, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		agents, err := h.KubeClient.AppsV1().DaemonSets(spireNamespace).Get(ctx, spireAgentName, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+
+		cur := fmt.Sprintf("%d/%d servers ready, %d/%d agents ready", server.Status.ReadyReplicas, server.Status.Replicas, agents.Status.NumberReady, agents.Status.DesiredNumberScheduled)
+		if cur != ready {
+			reportProgress(ctx, "SPIRE starting", cur)
+		}
+		ready = cur
+		return server.Status.ReadyReplicas > 0 && server.Status.ReadyReplicas == server.Status.Replicas &&
+			agents.Status.DesiredNumberScheduled > 0 && agents.Status.NumberReady == agents.Status.DesiredNumberScheduled, nil
+	})
+	if err != nil {
+		return fmt.Errorf("SPIRE not ready within %s: %s", spireReadyTimeout, ready)
+	}
+	return nil
+}
+
+// handleMutualAuth applies the MutualAuthentication trait to a policy
+// component, setting the authentication mode of its allow rules and applying
+// the policy again. The policy itself is removed along with its component.
+func handleMutualAuth(ctx context.Context, h *Handler, comp v1alpha1.Component, trait v1alpha1.ConfigurationSpecComponentTrait, isDel bool) (string, error) {
+	kind := getKindFromComponent(comp)
+	if _, ok := policyCRDs[kind]; !ok {
+		return "", ErrConfigureMutualAuth(fmt.Errorf("%s only applies to Cilium policies, %q is a %s", MutualAuthTrait, comp.Name, kind))
+	}
+	if isDel {
+		return fmt.Sprintf("authentication of %s \"%s\" removed with the policy", kind, comp.Name), nil
+	}
+
+	mode := "required"
+	if m, ok := trait.Properties["mode"].(string); ok && m != "" {
+		mode = m
+	}
+	if !contains(authModes, mode) {
+		return "", ErrConfigureMutualAuth(fmt.Errorf("authentication mode %q is neither required nor disabled", mode))
+	}
+	if mode == "required" {
+		cfg, err := h.agentConfig(ctx)
+		if err != nil {
+			return "", ErrConfigureMutualAuth(err)
+		}
+		if !mutualAuthEnabled(cfg) {
+			return "", ErrConfigureMutualAuth(fmt.Errorf("mutual authentication is disabled, the agents would drop the traffic of %q, run the mutual authentication operation first", comp.Name))
+		}
+	}
+
+	// The settings are shared with the component applied before the traits
+	byt, err := json.Marshal(comp.Spec.Settings)
+	if err != nil {
+		return "", ErrConfigureMutualAuth(err)
+	}
+	settings := map[string]interface{}{}
+	if err := json.Unmarshal(byt, &settings); err != nil {
+		return "", ErrConfigureMutualAuth(err)
+	}
+	rules := 0
+	for _, direction := range []string{"ingress", "egress"} {
+		for _, r := range ruleList(settings[direction]) {
+			r["authentication"] = map[string]interface{}{"mode": mode}
+			rules++
+		}
+	}
+	if rules == 0 {
+		return "", ErrConfigureMutualAuth(fmt.Errorf("%q has no ingress or egress rule to authenticate", comp.Name))
+	}
+	comp.Spec.Settings = settings
+
+	if _, err := handleCiliumCoreComponent(ctx, h, comp, false, "", kind); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("authentication %s on %d rules of %s \"%s\"", mode, rules, kind, comp.Name), nil
+}
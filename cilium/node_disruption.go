@@ -0,0 +1,215 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// skippedNode is a node whose agent was left untouched by a restart
+type skippedNode struct {
+	Node   string `json:"node"`
+	Reason string `json:"reason"`
+}
+
+// nodeRestart describes the agents restarted node by node
+type nodeRestart struct {
+	Restarted []string      `json:"restarted"`
+	Skipped   []skippedNode `json:"skipped"`
+	Waves     int           `json:"waves"`
+}
+
+func (r nodeRestart) String() string {
+	msg := fmt.Sprintf("%d agents restarted in %d waves", len(r.Restarted), r.Waves)
+	if len(r.Skipped) == 0 {
+		return msg
+	}
+	skipped := make([]string, 0, len(r.Skipped))
+	for _, s := range r.Skipped {
+		skipped = append(skipped, fmt.Sprintf("%s (%s)", s.Node, s.Reason))
+	}
+	return fmt.Sprintf("%s, %d nodes skipped: %s", msg, len(r.Skipped), strings.Join(skipped, ", "))
+}
+
+// restartAgents restarts the Cilium agents so that they pick up a new
+// configuration. They are rolled out by their DaemonSet unless node
+// disruption constraints are configured, they are then restarted node by
+// node within the constraints.
+func (h *Handler) restartAgents(ctx context.Context) (fmt.Stringer, error) {
+	limits := internalconfig.DisruptionConfig{}
+	if h.Config != nil {
+		var err error
+		if limits, err = internalconfig.Disruption(h.Config); err != nil {
+			h.Log.Warn(err)
+		}
+	}
+	if !limits.Enabled() {
+		if err := h.restartDaemonSet(ctx, ciliumNamespace, ciliumAgentName); err != nil {
+			return nil, err
+		}
+		return h.waitForDaemonSetRollout(ctx, ciliumNamespace, ciliumAgentName)
+	}
+	return h.restartAgentsByNode(ctx, limits)
+}
+
+// agentNode is a node running a Cilium agent
+type agentNode struct {
+	name string
+	pod  corev1.Pod
+}
+
+// restartAgentsByNode deletes the agent pods in waves holding at most
+// limits.MaxPerZone nodes of a zone, the DaemonSet recreates them with the
+// new configuration. The not ready nodes are skipped and count against the
+// limit of their zone, the cordoned nodes are skipped as well.
+func (h *Handler) restartAgentsByNode(ctx context.Context, limits internalconfig.DisruptionConfig) (nodeRestart, error) {
+	res := nodeRestart{Restarted: []string{}, Skipped: []skippedNode{}}
+	if h.KubeClient == nil {
+		return res, ErrNilClient
+	}
+
+	pods, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).List(ctx, metav1.ListOptions{LabelSelector: ciliumAgentSelector})
+	if err != nil {
+		return res, ErrRolloutDaemonSet(err)
+	}
+
+	queues := map[string][]agentNode{}
+	disrupted := map[string]int{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		node, err := h.KubeClient.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return res, ErrRolloutDaemonSet(err)
+		}
+		zone := node.Labels[limits.ZoneLabel]
+
+		switch {
+		case limits.SkipCordoned && node.Spec.Unschedulable:
+			res.Skipped = append(res.Skipped, skippedNode{Node: node.Name, Reason: "cordoned"})
+		case !nodeReady(node):
+			disrupted[zone]++
+			res.Skipped = append(res.Skipped, skippedNode{Node: node.Name, Reason: "node not ready"})
+		case !podReady(&pod):
+			// The node is disrupted already, its agent is restarted first
+			queues[zone] = append([]agentNode{{name: node.Name, pod: pod}}, queues[zone]...)
+		default:
+			queues[zone] = append(queues[zone], agentNode{name: node.Name, pod: pod})
+		}
+	}
+
+	zones := make([]string, 0, len(queues))
+	for zone := range queues {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	for {
+		var wave []agentNode
+		for _, zone := range zones {
+			queue := queues[zone]
+			if len(queue) == 0 {
+				continue
+			}
+			budget := limits.MaxPerZone - disrupted[zone]
+			if budget <= 0 {
+				for _, n := range queue {
+					res.Skipped = append(res.Skipped, skippedNode{
+						Node:   n.name,
+						Reason: fmt.Sprintf("%d nodes of zone %q already disrupted, the limit is %d", disrupted[zone], zone, limits.MaxPerZone),
+					})
+				}
+				queues[zone] = nil
+				continue
+			}
+			if budget > len(queue) {
+				budget = len(queue)
+			}
+			wave = append(wave, queue[:budget]...)
+			queues[zone] = queue[budget:]
+		}
+		if len(wave) == 0 {
+			break
+		}
+
+		res.Waves++
+		names := make([]string, 0, len(wave))
+		for _, n := range wave {
+			names = append(names, n.name)
+		}
+		reportProgress(ctx, fmt.Sprintf("Restarting agents, wave %d", res.Waves), strings.Join(names, ", "))
+		if err := h.restartWave(ctx, wave); err != nil {
+			return res, err
+		}
+		res.Restarted = append(res.Restarted, names...)
+	}
+	return res, nil
+}
+
+// restartWave deletes the agent pods of the wave and waits for their
+// replacements to be ready
+func (h *Handler) restartWave(ctx context.Context, wave []agentNode) error {
+	for _, n := range wave {
+		err := h.KubeClient.CoreV1().Pods(ciliumNamespace).Delete(ctx, n.pod.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return ErrRolloutDaemonSet(fmt.Errorf("restarting the agent of node %s: %s", n.name, err))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+	defer cancel()
+	for _, n := range wave {
+		err := wait.PollImmediateUntil(rolloutPollInterval, func() (bool, error) {
+			return h.agentReplaced(ctx, n.name, n.pod.UID)
+		}, ctx.Done())
+		if err != nil {
+			return ErrRolloutDaemonSet(fmt.Errorf("the agent of node %s did not become ready: %s", n.name, err))
+		}
+	}
+	return nil
+}
+
+// agentReplaced reports whether an agent pod other than old runs and is
+// ready on node
+func (h *Handler) agentReplaced(ctx context.Context, node string, old types.UID) (bool, error) {
+	pods, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: ciliumAgentSelector,
+		FieldSelector: "spec.nodeName=" + node,
+	})
+	if err != nil {
+		return false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.UID != old && pod.DeletionTimestamp == nil && podReady(pod) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
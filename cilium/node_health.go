@@ -0,0 +1,275 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// mapPressureThreshold is the fill ratio above which a BPF map is reported,
+// the agents start dropping entries once a map is full
+const mapPressureThreshold = 0.9
+
+// NodeHealth is the health of the agent and of the endpoints of a node
+type NodeHealth struct {
+	Node    string `json:"node"`
+	Pod     string `json:"pod,omitempty"`
+	Healthy bool   `json:"healthy"`
+	// State is the state the agent reports in its healthz, Ok when healthy
+	State              string   `json:"state,omitempty"`
+	FailingControllers []string `json:"failingControllers,omitempty"`
+	// PolicyRevision is the latest policy revision realized on the node
+	PolicyRevision int64         `json:"policyRevision"`
+	Endpoints      NodeEndpoints `json:"endpoints"`
+	// MapPressure is the fill ratio of the BPF maps of the agent, by map
+	MapPressure map[string]float64 `json:"mapPressure,omitempty"`
+	// Problems explain why the node is not healthy
+	Problems []string `json:"problems,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// NodeEndpoints counts the endpoints of a node
+type NodeEndpoints struct {
+	Total int `json:"total"`
+	Ready int `json:"ready"`
+	// Regenerated are the endpoints which realized the latest policy
+	// revision of the node, the others are still regenerating
+	Regenerated int `json:"regenerated"`
+	// States counts the endpoints which are not ready by state
+	States map[string]int `json:"states,omitempty"`
+	// CiliumEndpoints are the CiliumEndpoint resources of the node, they
+	// lag behind the endpoints of the agent while it syncs them
+	CiliumEndpoints int `json:"ciliumEndpoints"`
+}
+
+// NodeHealthReport is the health of every node running Cilium
+type NodeHealthReport struct {
+	Healthy bool         `json:"healthy"`
+	Nodes   []NodeHealth `json:"nodes"`
+}
+
+// Summary describes the report in a sentence
+func (r *NodeHealthReport) Summary() string {
+	healthy := 0
+	for _, n := range r.Nodes {
+		if n.Healthy {
+			healthy++
+		}
+	}
+	return fmt.Sprintf("%d/%d nodes healthy", healthy, len(r.Nodes))
+}
+
+// agentEndpoint is the part of the output of cilium endpoint list -o json
+// the report uses
+type agentEndpoint struct {
+	Status struct {
+		State  string `json:"state"`
+		Policy struct {
+			Realized struct {
+				PolicyRevision int64 `json:"policy-revision"`
+			} `json:"realized"`
+		} `json:"policy"`
+	} `json:"status"`
+}
+
+// agentMetric is an entry of the output of cilium metrics list -o json
+type agentMetric struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// nodeHealthReport queries the agent of every CiliumNode for its healthz,
+// its endpoints and the pressure of its BPF maps. Each node is streamed as
+// an event of the operation as soon as it is known, the nodes which can't be
+// queried are reported along with the error.
+func (h *Handler) nodeHealthReport(ctx context.Context, operationID string) (*NodeHealthReport, error) {
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+
+	nodes, err := h.DynamicKubeClient.Resource(ciliumNodeResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrNodeHealthReport(err)
+	}
+	pods, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).List(ctx, metav1.ListOptions{LabelSelector: ciliumAgentSelector})
+	if err != nil {
+		return nil, ErrNodeHealthReport(err)
+	}
+	agents := map[string]string{}
+	ready := map[string]bool{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		agents[pod.Spec.NodeName] = pod.Name
+		ready[pod.Name] = podReady(pod)
+	}
+
+	// The CiliumEndpoints reference their node by its IP
+	nodeIPs := map[string]string{}
+	for _, n := range nodes.Items {
+		addresses, _, _ := unstructured.NestedSlice(n.Object, "spec", "addresses")
+		for _, a := range addresses {
+			if addr, ok := a.(map[string]interface{}); ok {
+				if ip, _ := addr["ip"].(string); ip != "" {
+					nodeIPs[ip] = n.GetName()
+				}
+			}
+		}
+	}
+	ciliumEndpoints := map[string]int{}
+	err = h.eachPage(ctx, ciliumEndpointResource, func(list *unstructured.UnstructuredList) {
+		for _, ep := range list.Items {
+			ip, _, _ := unstructured.NestedString(ep.Object, "status", "networking", "node")
+			ciliumEndpoints[nodeIPs[ip]]++
+		}
+	})
+	if err != nil {
+		return nil, ErrNodeHealthReport(err)
+	}
+
+	report := &NodeHealthReport{Healthy: true, Nodes: []NodeHealth{}}
+	for _, n := range nodes.Items {
+		node := NodeHealth{Node: n.GetName(), Pod: agents[n.GetName()]}
+		if node.Pod == "" {
+			node.Error = "no Cilium agent runs on the node"
+		} else {
+			h.agentHealth(&node, ready[node.Pod])
+		}
+		node.Endpoints.CiliumEndpoints = ciliumEndpoints[node.Node]
+		node.Problems = nodeProblems(node)
+		node.Healthy = len(node.Problems) == 0
+		report.Healthy = report.Healthy && node.Healthy
+		report.Nodes = append(report.Nodes, node)
+		h.streamNodeHealth(operationID, node)
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Node < report.Nodes[j].Node })
+	return report, nil
+}
+
+// agentHealth fills the health of a node from its agent
+func (h *Handler) agentHealth(node *NodeHealth, ready bool) {
+	status := h.agentStatus(node.Pod, ready)
+	node.State = status.State
+	node.FailingControllers = status.FailingControllers
+	if status.Error != "" {
+		node.Error = status.Error
+		return
+	}
+
+	out, err := h.execInAgent(node.Pod, []string{"cilium", "endpoint", "list", "-o", "json"})
+	if err != nil {
+		node.Error = err.Error()
+		return
+	}
+	var endpoints []agentEndpoint
+	if err := json.Unmarshal([]byte(out), &endpoints); err != nil {
+		node.Error = fmt.Sprintf("unexpected output of cilium endpoint list: %s", err)
+		return
+	}
+	node.Endpoints, node.PolicyRevision = endpointCounts(endpoints)
+
+	// The map pressure metric is only exported by Cilium 1.13 and later
+	out, err = h.execInAgent(node.Pod, []string{"cilium", "metrics", "list", "-o", "json"})
+	if err != nil {
+		node.Error = err.Error()
+		return
+	}
+	var metrics []agentMetric
+	if err := json.Unmarshal([]byte(out), &metrics); err != nil {
+		node.Error = fmt.Sprintf("unexpected output of cilium metrics list: %s", err)
+		return
+	}
+	for _, m := range metrics {
+		if m.Name != "cilium_bpf_map_pressure" {
+			continue
+		}
+		if node.MapPressure == nil {
+			node.MapPressure = map[string]float64{}
+		}
+		node.MapPressure[m.Labels["map_name"]] = m.Value
+	}
+}
+
+// endpointCounts counts the endpoints of an agent by state along with the
+// latest policy revision they realized, the endpoints at that revision
+// count as regenerated
+func endpointCounts(endpoints []agentEndpoint) (NodeEndpoints, int64) {
+	counts := NodeEndpoints{Total: len(endpoints)}
+	var revision int64
+	for _, ep := range endpoints {
+		if rev := ep.Status.Policy.Realized.PolicyRevision; rev > revision {
+			revision = rev
+		}
+	}
+	for _, ep := range endpoints {
+		if ep.Status.Policy.Realized.PolicyRevision == revision {
+			counts.Regenerated++
+		}
+		state := ep.Status.State
+		if state == "ready" {
+			counts.Ready++
+			continue
+		}
+		if state == "" {
+			state = "unknown"
+		}
+		if counts.States == nil {
+			counts.States = map[string]int{}
+		}
+		counts.States[state]++
+	}
+	return counts, revision
+}
+
+// nodeProblems lists why a node is not healthy
+func nodeProblems(node NodeHealth) []string {
+	var problems []string
+	if node.Error != "" {
+		problems = append(problems, node.Error)
+	}
+	if node.State != "" && node.State != "Ok" {
+		problems = append(problems, fmt.Sprintf("the agent reports %s", node.State))
+	}
+	if len(node.FailingControllers) > 0 {
+		problems = append(problems, fmt.Sprintf("%d controllers failing", len(node.FailingControllers)))
+	}
+	if n := node.Endpoints.Total - node.Endpoints.Ready; n > 0 {
+		problems = append(problems, fmt.Sprintf("%d endpoints not ready", n))
+	}
+	if n := node.Endpoints.Total - node.Endpoints.Regenerated; n > 0 {
+		problems = append(problems, fmt.Sprintf("%d endpoints behind policy revision %d", n, node.PolicyRevision))
+	}
+	var maps []string
+	for name, pressure := range node.MapPressure {
+		if pressure >= mapPressureThreshold {
+			maps = append(maps, fmt.Sprintf("%s %.0f%%", name, pressure*100))
+		}
+	}
+	if len(maps) > 0 {
+		sort.Strings(maps)
+		problems = append(problems, fmt.Sprintf("BPF maps under pressure: %s", strings.Join(maps, ", ")))
+	}
+	return problems
+}
+
+// streamNodeHealth streams the health of a node as an event of the
+// operation, an error event when the node is not healthy
+func (h *Handler) streamNodeHealth(operationID string, node NodeHealth) {
+	e := &adapter.Event{
+		Operationid: operationID,
+		Details:     reportDetails(node),
+	}
+	if node.Healthy {
+		e.Summary = fmt.Sprintf("Node %s healthy: %d endpoints at policy revision %d", node.Node, node.Endpoints.Total, node.PolicyRevision)
+		h.StreamInfo(e)
+		return
+	}
+	e.Summary = fmt.Sprintf("Node %s unhealthy: %s", node.Node, strings.Join(node.Problems, "; "))
+	h.StreamErr(e, ErrNodeUnhealthy(node.Node, node.Problems))
+}
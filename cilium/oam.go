@@ -1,29 +1,68 @@
 package cilium
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/meshes"
 	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
 	"gopkg.in/yaml.v2"
 )
 
+// oamOperation is the name the OAM requests are given a timeout under,
+// they otherwise take the timeout of the configure operations
+const oamOperation = "oam"
+
 // CompHandler is the type for functions which can handle OAM components
-type CompHandler func(*Handler, v1alpha1.Component, bool) (string, error)
+type CompHandler func(context.Context, *Handler, v1alpha1.Component, bool) (string, error)
+
+// TraitHandler is the type for functions which can handle the OAM traits
+// applied on a component
+type TraitHandler func(context.Context, *Handler, v1alpha1.Component, v1alpha1.ConfigurationSpecComponentTrait, bool) (string, error)
+
+// oamContext returns the context an OAM request received with the context
+// parent is processed with, it is cancelled when Meshery aborts the request,
+// when the adapter shuts down or once the timeout elapses
+func (h *Handler) oamContext(parent context.Context) (context.Context, context.CancelFunc, error) {
+	timeout, err := h.operationTimeout(oamOperation, &adapter.Operation{Type: int32(meshes.OpCategory_CONFIGURE)})
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-h.lifecycle.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if timeout > 0 {
+		timeoutCtx, timeoutCancel := context.WithTimeout(ctx, timeout)
+		return timeoutCtx, func() {
+			timeoutCancel()
+			cancel()
+		}, nil
+	}
+	return ctx, cancel, nil
+}
 
 // HandleComponents handles the processing of OAM components
-func (h *Handler) HandleComponents(comps []v1alpha1.Component, isDel bool) (string, error) {
+func (h *Handler) HandleComponents(ctx context.Context, comps []v1alpha1.Component, isDel bool) (string, error) {
 	var errs []error
 	var msgs []string
 
 	compFuncMap := map[string]CompHandler{
-		"CiliumMesh": handleComponentCiliumMesh,
+		"CiliumMesh":                       handleComponentCiliumMesh,
+		ciliumClusterwideNetworkPolicyKind: handleClusterwidePolicy,
+		ciliumHostPolicyComponent:          handleHostPolicy,
 	}
 
 	for _, comp := range comps {
 		fnc, ok := compFuncMap[comp.Spec.Type]
 		if !ok {
-			msg, err := handleCiliumCoreComponent(h, comp, isDel, "", "")
+			msg, err := handleCiliumCoreComponent(ctx, h, comp, isDel, "", "")
 			if err != nil {
 				errs = append(errs, err)
 				continue
@@ -33,7 +72,7 @@ func (h *Handler) HandleComponents(comps []v1alpha1.Component, isDel bool) (stri
 			continue
 		}
 
-		msg, err := fnc(h, comp, isDel)
+		msg, err := fnc(ctx, h, comp, isDel)
 		if err != nil {
 			errs = append(errs, err)
 			continue
@@ -50,12 +89,38 @@ func (h *Handler) HandleComponents(comps []v1alpha1.Component, isDel bool) (stri
 }
 
 // HandleApplicationConfiguration handles the processing of OAM application configuration
-func (h *Handler) HandleApplicationConfiguration(config v1alpha1.Configuration, isDel bool) (string, error) {
+func (h *Handler) HandleApplicationConfiguration(ctx context.Context, config v1alpha1.Configuration, comps []v1alpha1.Component, isDel bool) (string, error) {
 	var errs []error
 	var msgs []string
+
+	compsByName := map[string]v1alpha1.Component{}
+	for _, comp := range comps {
+		compsByName[comp.Name] = comp
+	}
+
+	traitFuncMap := map[string]TraitHandler{
+		PolicyAuditModeTrait: handlePolicyAuditMode,
+		FQDNEgressTrait:      handleFQDNEgress,
+		L7HTTPPolicyTrait:    handleL7HTTPPolicy,
+		MutualAuthTrait:      handleMutualAuth,
+		EgressBandwidthTrait: handleEgressBandwidth,
+	}
+
 	for _, comp := range config.Spec.Components {
 		for _, trait := range comp.Traits {
-			msgs = append(msgs, fmt.Sprintf("applied trait \"%s\" on service \"%s\"", trait.Name, comp.ComponentName))
+			fnc, ok := traitFuncMap[trait.Name]
+			if !ok {
+				msgs = append(msgs, fmt.Sprintf("applied trait \"%s\" on service \"%s\"", trait.Name, comp.ComponentName))
+				continue
+			}
+
+			msg, err := fnc(ctx, h, compsByName[comp.ComponentName], trait, isDel)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			msgs = append(msgs, msg)
 		}
 	}
 
@@ -67,13 +132,18 @@ func (h *Handler) HandleApplicationConfiguration(config v1alpha1.Configuration,
 
 }
 
-func handleComponentCiliumMesh(h *Handler, comp v1alpha1.Component, isDel bool) (string, error) {
+func handleComponentCiliumMesh(ctx context.Context, h *Handler, comp v1alpha1.Component, isDel bool) (string, error) {
 	// Get the Cilium version from the settings
 	// we are sure that the version of Cilium would be present
 	// because the configuration is already validated against the schema
 	version := comp.Spec.Settings["version"].(string)
 
-	msg, err := h.installCilium(isDel, version, comp.Namespace)
+	install, err := componentInstall(comp.Spec.Settings)
+	if err != nil {
+		return comp.Name, err
+	}
+
+	msg, err := h.installCilium(ctx, isDel, version, comp.Namespace, install)
 	if err != nil {
 		return fmt.Sprintf("%s: %s", comp.Name, msg), err
 	}
@@ -82,6 +152,7 @@ func handleComponentCiliumMesh(h *Handler, comp v1alpha1.Component, isDel bool)
 }
 
 func handleCiliumCoreComponent(
+	ctx context.Context,
 	h *Handler,
 	comp v1alpha1.Component,
 	isDel bool,
@@ -101,17 +172,65 @@ func handleCiliumCoreComponent(
 		}
 	}
 
+	// Identify the Meshery environment the component was deployed from
+	labels := map[string]string{}
+	for k, v := range comp.Labels {
+		labels[k] = v
+	}
+	for k, v := range componentEnvironment(comp.Annotations, comp.Labels) {
+		labels[k] = v
+	}
+
 	component := map[string]interface{}{
 		"apiVersion": apiVersion,
 		"kind":       kind,
 		"metadata": map[string]interface{}{
 			"name":        comp.Name,
 			"annotations": comp.Annotations,
-			"labels":      comp.Labels,
+			"labels":      labels,
 		},
 		"spec": comp.Spec.Settings,
 	}
 
+	// Cilium policies are only fully validated by the agents, catch the
+	// mistakes before they reach the cluster
+	_, isPolicy := policyCRDs[kind]
+	if isPolicy && !isDel {
+		if err := h.validatePolicy(ctx, component); err != nil {
+			h.Log.Error(err)
+			h.emitPolicy(kind, comp.Namespace, comp.Name, fmt.Sprintf("%s %s rejected", kind, comp.Name), err)
+			return "", err
+		}
+	}
+
+	if kind == ciliumEgressGatewayPolicyKind && !isDel {
+		if err := h.checkEgressGateway(ctx); err != nil {
+			h.Log.Error(err)
+			return "", err
+		}
+	}
+
+	if (kind == ciliumEnvoyConfigKind || kind == ciliumClusterwideEnvoyConfigKind) && !isDel {
+		if err := h.checkEnvoyConfig(ctx); err != nil {
+			h.Log.Error(err)
+			return "", err
+		}
+	}
+
+	if kind == ciliumLocalRedirectPolicyKind && !isDel {
+		if err := h.checkLocalRedirectPolicy(ctx, component, comp.Namespace); err != nil {
+			h.Log.Error(err)
+			return "", err
+		}
+	}
+
+	if (kind == ciliumBGPPeeringPolicyKind || kind == ciliumBGPClusterConfigKind) && !isDel {
+		if err := h.checkBGPControlPlane(ctx, kind); err != nil {
+			h.Log.Error(err)
+			return "", err
+		}
+	}
+
 	// Convert to yaml
 	yamlByt, err := yaml.Marshal(component)
 	if err != nil {
@@ -125,7 +244,41 @@ func handleCiliumCoreComponent(
 		msg = fmt.Sprintf("deleted %s config \"%s\" in namespace \"%s\"", kind, comp.Name, comp.Namespace)
 	}
 
-	return msg, h.applyManifest(yamlByt, isDel, comp.Namespace)
+	if err := h.applyManifest(ctx, yamlByt, isDel, comp.Namespace); err != nil {
+		if isPolicy {
+			err = ErrApplyPolicy(kind, comp.Name, err)
+			h.emitPolicy(kind, comp.Namespace, comp.Name, fmt.Sprintf("Error while applying %s %s", kind, comp.Name), err)
+		}
+		h.Log.Error(err)
+		return msg, err
+	}
+
+	if isPolicy {
+		policy := appliedPolicy{Kind: kind, Namespace: comp.Namespace, Name: comp.Name, Spec: comp.Spec.Settings, Manifest: string(yamlByt)}
+		if kind == ciliumClusterwideNetworkPolicyKind {
+			policy.Namespace = ""
+		}
+		// Drift detection is best effort, the policy is applied regardless
+		if err := h.recordPolicy(policy, isDel); err != nil {
+			h.Log.Error(ErrDetectDrift(err))
+		}
+	}
+
+	// A policy only counts as applied once the selected endpoints enforce it
+	if isPolicy && !isDel {
+		convergence, err := h.waitForPolicyConvergence(ctx, comp, kind, component)
+		if err != nil {
+			h.Log.Error(err)
+			h.emitPolicy(kind, comp.Namespace, comp.Name, fmt.Sprintf("%s %s not enforced", kind, comp.Name), err)
+			return msg, err
+		}
+		msg = fmt.Sprintf("%s, %s", msg, convergence)
+	}
+	if isPolicy {
+		h.emitPolicy(kind, comp.Namespace, comp.Name, msg, nil)
+	}
+
+	return msg, nil
 }
 
 func getAPIVersionFromComponent(comp v1alpha1.Component) string {
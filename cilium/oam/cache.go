@@ -0,0 +1,209 @@
+package oam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshkit/utils/manifests"
+)
+
+const componentCacheDir = "component-cache"
+
+// cachedComponents are the components generated from a source along with
+// what identifies the version of the source they were generated from
+type cachedComponents struct {
+	URL          string `json:"url"`
+	Method       string `json:"method"`
+	Version      string `json:"version"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	// ChartDigest is the digest of the chart of an oci:// reference, tags
+	// may be pushed again
+	ChartDigest string   `json:"chartDigest,omitempty"`
+	Schemas     []string `json:"schemas"`
+	Definitions []string `json:"definitions"`
+	// Failures are the CRDs which failed to generate, only the entries of
+	// earlier releases have any
+	Failures []componentFailure `json:"failures,omitempty"`
+}
+
+// cacheKey identifies the generation described by dc
+func cacheKey(dc *adapter.DynamicComponentsConfig) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		dc.URL,
+		dc.GenerationMethod,
+		dc.Config.MeshVersion,
+		strings.Join(dc.Config.Filter.OnlyRes, ","),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachePath is the file caching the generation of key, a variable so that
+// the tests don't touch the cache of the adapter
+var cachePath = func(key string) string {
+	return filepath.Join(config.RootPath(), componentCacheDir, key+".json")
+}
+
+// loadCachedComponents returns the cached generation, nil when there is none
+func loadCachedComponents(key string) *cachedComponents {
+	byt, err := ioutil.ReadFile(cachePath(key))
+	if err != nil {
+		return nil
+	}
+	cached := &cachedComponents{}
+	if err := json.Unmarshal(byt, cached); err != nil {
+		// A corrupt entry only costs a new generation
+		return nil
+	}
+	return cached
+}
+
+func (c *cachedComponents) save(key string) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath(key)), 0700); err != nil {
+		return err
+	}
+	byt, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cachePath(key), byt, 0600)
+}
+
+func (c *cachedComponents) generation() *generation {
+	return &generation{component: &manifests.Component{Schemas: c.Schemas, Definitions: c.Definitions}, failures: c.Failures}
+}
+
+// generateComponents returns the components described by dc, generated
+// by workers concurrently. Generating them is expensive, so the components
+// are cached on disk and reused as long as the source is unchanged: remote
+// manifests and charts are revalidated with conditional requests, the charts
+// of oci:// references by the digest of their manifest and local sources by
+// digest. The charts of oci:// references are pulled with the registry
+// credentials auth. The generations with failed CRDs aren't
+// cached, the failures may be transient such as a timeout.
+func generateComponents(dc *adapter.DynamicComponentsConfig, workers int, auth config.RegistryAuth) (*generation, error) {
+	key := cacheKey(dc)
+	cached := loadCachedComponents(key)
+	// Earlier releases cached the failed generations as well
+	if cached != nil && len(cached.Failures) > 0 {
+		cached = nil
+	}
+	entry := &cachedComponents{URL: dc.URL, Method: dc.GenerationMethod, Version: dc.Config.MeshVersion}
+
+	var manifest string
+	var err error
+	path, local := localSource(dc.URL)
+	switch {
+	case local:
+		manifest, err = readLocalManifests(path, dc.GenerationMethod)
+		if err != nil {
+			return nil, err
+		}
+	case dc.GenerationMethod == adapter.Manifests:
+		var notModified bool
+		manifest, notModified, err = fetchManifest(dc.URL, cached, entry)
+		if err != nil {
+			return nil, err
+		}
+		if notModified {
+			return cached.generation(), nil
+		}
+	case dc.GenerationMethod == adapter.HelmCHARTS:
+		// The CRDs of the chart are generated like the ones of a manifest
+		var notModified bool
+		if isOCIReference(dc.URL) {
+			manifest, notModified, err = fetchOCIChart(dc.URL, auth, cached, entry)
+		} else {
+			manifest, notModified, err = fetchChart(dc.URL, cached, entry)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if notModified {
+			return cached.generation(), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown generation method: %s", dc.GenerationMethod)
+	}
+
+	sum := sha256.Sum256([]byte(manifest))
+	entry.SourceDigest = hex.EncodeToString(sum[:])
+	if cached != nil && cached.SourceDigest == entry.SourceDigest {
+		// Keep the validators of the response up to date
+		entry.Schemas, entry.Definitions = cached.Schemas, cached.Definitions
+		_ = entry.save(key)
+		return cached.generation(), nil
+	}
+
+	gen := generateFromManifest(manifest, dc.Config, workers, time.Duration(dc.TimeoutInMinutes)*time.Minute)
+	if len(gen.failures) > 0 {
+		return gen, nil
+	}
+	entry.Schemas, entry.Definitions = gen.component.Schemas, gen.component.Definitions
+	// Failing to cache only costs a new generation next time
+	_ = entry.save(key)
+	return gen, nil
+}
+
+// fetchManifest downloads a remote manifest, revalidating the cached
+// generation with the validators of the previous response. It reports
+// whether the manifest is unchanged, and records the validators of the
+// response in entry.
+func fetchManifest(url string, cached, entry *cachedComponents) (string, bool, error) {
+	resp, notModified, err := conditionalGet(url, cached, entry)
+	if err != nil || notModified {
+		return "", notModified, err
+	}
+	defer resp.Body.Close()
+
+	byt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	return string(byt), false, nil
+}
+
+// conditionalGet requests url with the validators of the cached generation
+// and reports whether the source is unchanged. Otherwise the response is
+// returned with its validators recorded in entry, the caller closes its body.
+func conditionalGet(url string, cached, entry *cachedComponents) (*http.Response, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		return nil, true, nil
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("fetching %s returned status code %d", url, resp.StatusCode)
+	}
+	entry.ETag = resp.Header.Get("ETag")
+	entry.LastModified = resp.Header.Get("Last-Modified")
+	return resp, false, nil
+}
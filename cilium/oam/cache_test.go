@@ -0,0 +1,203 @@
+package oam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshkit/utils/manifests"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// manifestServer serves manifest with the ETag etag, answering the
+// conditional requests matching it with 304. The returned function counts
+// the requests answered with 304.
+func manifestServer(manifest *string, etag string) (*httptest.Server, func() int) {
+	var mu sync.Mutex
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, *manifest)
+	}))
+	return server, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return notModified
+	}
+}
+
+func TestGenerateComponentsDoesNotCacheFailures(t *testing.T) {
+	_, restore := useTempState(t)
+	defer restore()
+
+	// The CRD without a group fails to generate
+	manifest := fmt.Sprintf(crdTemplate, "ciliumnodes.cilium.io", "CiliumNode") + "---\n" +
+		"apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nspec:\n  names:\n    kind: CiliumEndpoint\n  versions:\n  - name: v2\n"
+	server, notModified := manifestServer(&manifest, `"v1"`)
+	defer server.Close()
+
+	dc := &adapter.DynamicComponentsConfig{
+		TimeoutInMinutes: 1,
+		URL:              server.URL + "/crds.yaml",
+		GenerationMethod: adapter.Manifests,
+		Config:           manifests.Config{MeshVersion: "v1.14.0"},
+	}
+	for i := 0; i < 2; i++ {
+		gen, err := generateComponents(dc, 1, config.RegistryAuth{})
+		if err != nil {
+			t.Fatalf("generateComponents() error = %s", err)
+		}
+		if len(gen.failures) != 1 || len(gen.component.Definitions) != 1 {
+			t.Fatalf("generateComponents() = %d components and %d failures, want 1 and 1", len(gen.component.Definitions), len(gen.failures))
+		}
+	}
+	if n := notModified(); n != 0 {
+		t.Errorf("the failed generation was revalidated %d times, want it regenerated", n)
+	}
+	if _, err := os.Stat(cachePath(cacheKey(dc))); !os.IsNotExist(err) {
+		t.Errorf("the failed generation was cached")
+	}
+}
+
+func TestGenerateComponentsRevalidatesManifests(t *testing.T) {
+	_, restore := useTempState(t)
+	defer restore()
+
+	manifest := fmt.Sprintf(crdTemplate, "ciliumnodes.cilium.io", "CiliumNode")
+	server, notModified := manifestServer(&manifest, `"v1"`)
+	defer server.Close()
+
+	dc := &adapter.DynamicComponentsConfig{
+		TimeoutInMinutes: 1,
+		URL:              server.URL + "/crds.yaml",
+		GenerationMethod: adapter.Manifests,
+		Config:           manifests.Config{MeshVersion: "v1.14.0"},
+	}
+	for i := 0; i < 2; i++ {
+		gen, err := generateComponents(dc, 1, config.RegistryAuth{})
+		if err != nil {
+			t.Fatalf("generateComponents() error = %s", err)
+		}
+		if len(gen.component.Definitions) != 1 {
+			t.Fatalf("generateComponents() = %d components, want 1", len(gen.component.Definitions))
+		}
+	}
+	if n := notModified(); n != 1 {
+		t.Errorf("the cached generation was revalidated %d times, want 1", n)
+	}
+}
+
+// packageChart returns a packaged chart holding the CRDs of kinds
+func packageChart(t *testing.T, kinds ...string) []byte {
+	t.Helper()
+	c := &chart.Chart{Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "cilium", Version: "1.14.0"}}
+	for _, kind := range kinds {
+		c.Files = append(c.Files, &chart.File{
+			Name: "crds/" + strings.ToLower(kind) + ".yaml",
+			Data: []byte(fmt.Sprintf(crdTemplate, strings.ToLower(kind)+"s.cilium.io", kind)),
+		})
+	}
+	dir, err := ioutil.TempDir("", "chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, err := chartutil.Save(c, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return byt
+}
+
+func TestGenerateComponentsRevalidatesCharts(t *testing.T) {
+	_, restore := useTempState(t)
+	defer restore()
+
+	var mu sync.Mutex
+	archive := packageChart(t, "CiliumNode")
+	pulls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		sum := sha256.Sum256(archive)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		switch r.URL.Path {
+		case "/cilium-1.14.0.tgz":
+			if r.Header.Get("If-None-Match") == `"`+digest+`"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			pulls++
+			w.Header().Set("ETag", `"`+digest+`"`)
+			w.Write(archive)
+		case "/v2/charts/cilium/manifests/1.14.0":
+			fmt.Fprintf(w, `{"layers":[{"mediaType":%q,"digest":%q}]}`, helmChartMediaType, digest)
+		case "/v2/charts/cilium/blobs/" + digest:
+			pulls++
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, url := range []string{server.URL + "/cilium-1.14.0.tgz", "oci://" + host + "/charts/cilium:1.14.0"} {
+		t.Run(url, func(t *testing.T) {
+			mu.Lock()
+			archive, pulls = packageChart(t, "CiliumNode"), 0
+			mu.Unlock()
+			dc := &adapter.DynamicComponentsConfig{
+				TimeoutInMinutes: 1,
+				URL:              url,
+				GenerationMethod: adapter.HelmCHARTS,
+				Config:           manifests.Config{MeshVersion: "v1.14.0"},
+			}
+			generate := func(want int) {
+				t.Helper()
+				gen, err := generateComponents(dc, 1, config.RegistryAuth{PlainHTTP: true})
+				if err != nil {
+					t.Fatalf("generateComponents() error = %s", err)
+				}
+				if len(gen.component.Definitions) != want {
+					t.Fatalf("generateComponents() = %d components, want %d", len(gen.component.Definitions), want)
+				}
+			}
+
+			generate(1)
+			generate(1)
+			// The chart is pushed again under the same version
+			mu.Lock()
+			archive = packageChart(t, "CiliumNode", "CiliumEndpoint")
+			mu.Unlock()
+			generate(2)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if pulls != 2 {
+				t.Errorf("pulled the chart %d times, want 2", pulls)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package oam
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// deliverRetryTimeout caps the retries of a registration before it is
+	// queued, the queue retries it for longer
+	deliverRetryTimeout = 30 * time.Second
+	// unreachableWindow is how long the registrations are queued without
+	// being sent once the server was found unreachable
+	unreachableWindow = time.Minute
+)
+
+// Client is used for every request the adapter makes to the Meshery server.
+// It verifies the server certificate, optionally presents a client certificate,
+// presents the token and retries failed requests with backoff. The
+// retries fail over to the next server when several are known.
+type Client struct {
+	mu           sync.RWMutex
+	httpClient   *http.Client
+	token        string
+	tokenFile    string
+	provider     string
+	retryTimeout time.Duration
+	schemas      config.SchemaLimits
+	workers      int
+	// timeout bounds the generation of the components, in minutes
+	timeout int
+	// registry authenticates the pulls of the oci:// chart references
+	registry config.RegistryAuth
+
+	// servers are the addresses of the Meshery servers, the requests to
+	// any of them are sent to servers[current]
+	servers  []string
+	current  int
+	discover func() []string
+
+	// unreachableAt is when a request last failed to reach the server
+	unreachableAt time.Time
+}
+
+// NewClient creates a Client from the Meshery server settings
+func NewClient(cfg config.MesheryServerConfig) (*Client, error) {
+	c := &Client{}
+	if err := c.Reconfigure(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reconfigure applies new Meshery server settings to the requests made
+// from now on, the settings are left untouched when they are invalid
+func (c *Client) Reconfigure(cfg config.MesheryServerConfig) error {
+	if err := cfg.Proxy.Validate(); err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Skipping verification is an explicit opt-in of the operator
+		// #nosec
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		ca, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return ErrLoadTLSConfig(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return ErrLoadTLSConfig(fmt.Errorf("no certificates found in %s", cfg.CAFile))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return ErrLoadTLSConfig(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = cfg.Proxy.ProxyFunc()
+
+	// In diagnostic mode the failures of the server are simulated
+	var rt http.RoundTripper = transport
+	if cfg.Faults.Enabled() {
+		rt = NewFaultTransport(transport, cfg.Faults)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.httpClient = &http.Client{
+		Transport: rt,
+		Timeout:   time.Minute,
+	}
+	c.token = cfg.Token
+	c.tokenFile = cfg.TokenFile
+	c.provider = cfg.Provider
+	c.retryTimeout = cfg.RetryTimeout
+	c.schemas = cfg.Schemas
+	c.workers = cfg.ComponentsWorkers
+	c.timeout = cfg.ComponentsTimeoutInMinutes()
+	c.registry = cfg.ComponentsRegistry
+	return nil
+}
+
+// SetTransport replaces the transport used to reach the Meshery server
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Requests in flight keep the client they started with
+	httpClient := *c.httpClient
+	httpClient.Transport = rt
+	c.httpClient = &httpClient
+}
+
+// SetServers sets the addresses of the Meshery servers the requests fail
+// over between, in the order of preference. discover is called for fresh
+// addresses once every server failed, it may be nil.
+func (c *Client) SetServers(addrs []string, discover func() []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.servers = append([]string{}, addrs...)
+	c.current = 0
+	c.discover = discover
+}
+
+// Server returns the address of the Meshery server the requests are sent to
+func (c *Client) Server() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.servers) == 0 {
+		return ""
+	}
+	return c.servers[c.current]
+}
+
+// target returns url sent to the current server when url addresses one
+// of the servers, along with the server
+func (c *Client) target(url string) (string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, server := range c.servers {
+		if strings.HasPrefix(url, server) {
+			current := c.servers[c.current]
+			return current + strings.TrimPrefix(url, server), current
+		}
+	}
+	return url, ""
+}
+
+// failover moves the requests to the next server after failed failed
+func (c *Client) failover(failed string) {
+	c.mu.Lock()
+	if failed == "" || len(c.servers) < 2 && c.discover == nil || c.servers[c.current] != failed {
+		// Unknown server, or another request failed over already
+		c.mu.Unlock()
+		return
+	}
+	c.current = (c.current + 1) % len(c.servers)
+	discover := c.discover
+	wrapped := c.current == 0
+	c.mu.Unlock()
+
+	if !wrapped || discover == nil {
+		return
+	}
+	if addrs := discover(); len(addrs) > 0 {
+		c.mu.Lock()
+		c.servers = append([]string{}, addrs...)
+		c.current = 0
+		c.mu.Unlock()
+	}
+}
+
+// schemaLimits returns the limits of the schemas of the components
+func (c *Client) schemaLimits() config.SchemaLimits {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.schemas
+}
+
+// generationWorkers returns the CRDs generated concurrently
+func (c *Client) generationWorkers() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.workers
+}
+
+// generationTimeout returns the minutes the generation of the components
+// of a single source may take
+func (c *Client) generationTimeout() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.timeout
+}
+
+// registryAuth returns the credentials of the registry of the oci:// charts
+func (c *Client) registryAuth() config.RegistryAuth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.registry
+}
+
+// post sends the payload as json to the given url, retrying until the
+// server accepts it or the registration is queued
+func (c *Client) post(url string, payload interface{}) error {
+	return c.send(http.MethodPost, url, payload)
+}
+
+// send delivers a registration to the Meshery server. The registrations
+// which can't reach the server are queued on disk and replayed by Replay,
+// ErrRegistrationQueued is returned for them.
+func (c *Client) send(method, url string, payload interface{}) error {
+	code, _, err := c.deliver(method, url, payload)
+	// Only the registrations which may go through later are queued
+	if _, ok := err.(permanentError); ok {
+		return ErrRegistrationRejected(err)
+	}
+	if err != nil {
+		return queueRegistration(method, url, payload, err)
+	}
+	if unauthorized(code) {
+		return ErrUnauthorized(code)
+	}
+	if !accepted(code) {
+		return ErrRegistrationRejected(fmt.Errorf("host returned status code %d", code))
+	}
+	return nil
+}
+
+// Retryable reports whether a failed registration may go through when it is
+// sent again: the server was unreachable or failed, and the registration
+// couldn't be queued. The rejected registrations and the components which
+// failed to generate fail the same until the server or the source changes.
+func Retryable(err error) bool {
+	e, ok := errors.Is(err)
+	return ok && e.Code == ErrRegisterCode
+}
+
+// deliver sends a registration like do, retrying it for a short while only
+// since the registrations failing to reach the server are queued. Once a
+// request found the server unreachable, the registrations sent shortly
+// after fail right away so that buffering many of them doesn't take long.
+func (c *Client) deliver(method, url string, payload interface{}) (int, []byte, error) {
+	c.mu.RLock()
+	unreachableAt, retryTimeout := c.unreachableAt, c.retryTimeout
+	c.mu.RUnlock()
+	if !unreachableAt.IsZero() && time.Since(unreachableAt) < unreachableWindow {
+		if _, err := json.Marshal(payload); err != nil {
+			return 0, nil, permanentError{err}
+		}
+		return 0, nil, fmt.Errorf("the Meshery server was unreachable %s ago", time.Since(unreachableAt).Round(time.Second))
+	}
+	if retryTimeout == 0 || retryTimeout > deliverRetryTimeout {
+		retryTimeout = deliverRetryTimeout
+	}
+	return c.doWithin(method, url, payload, retryTimeout)
+}
+
+// permanentError is the error of a request which can't be sent at all, such
+// as a payload which doesn't encode, retrying or replaying it fails the same
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// do sends the payload as json to the given url and returns the status code
+// and body of the response. Server side errors are retried until the retry
+// timeout elapses, client errors are returned to the caller as they won't
+// be fixed by retrying. The servers which are unreachable or unavailable
+// are failed over. The requests which can't be built return a
+// permanentError.
+func (c *Client) do(method, url string, payload interface{}) (int, []byte, error) {
+	c.mu.RLock()
+	retryTimeout := c.retryTimeout
+	c.mu.RUnlock()
+	return c.doWithin(method, url, payload, retryTimeout)
+}
+
+// doWithin is do retrying for retryTimeout, it records whether the server
+// was reached for deliver
+func (c *Client) doWithin(method, url string, payload interface{}, retryTimeout time.Duration) (int, []byte, error) {
+	contentByt, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, permanentError{err}
+	}
+
+	c.mu.RLock()
+	httpClient, compress := c.httpClient, c.schemas.Gzip
+	c.mu.RUnlock()
+
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(contentByt); err != nil {
+			return 0, nil, permanentError{err}
+		}
+		if err := zw.Close(); err != nil {
+			return 0, nil, permanentError{err}
+		}
+		contentByt = buf.Bytes()
+	}
+
+	var code int
+	var body []byte
+	backoffOpt := backoff.NewExponentialBackOff()
+	backoffOpt.MaxElapsedTime = retryTimeout
+	if err := backoff.Retry(func() error {
+		target, server := c.target(url)
+		req, err := http.NewRequest(method, target, bytes.NewReader(contentByt))
+		if err != nil {
+			return backoff.Permanent(permanentError{err})
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if compress {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		creds, err := c.credentials()
+		if err != nil {
+			return backoff.Permanent(permanentError{err})
+		}
+		creds.apply(req)
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			c.failover(server)
+			return err
+		}
+		body, _ = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		code = resp.StatusCode
+
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			c.failover(server)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("host returned status: %s with status code %d", resp.Status, resp.StatusCode)
+		}
+		return nil
+	}, backoffOpt); err != nil {
+		if _, ok := err.(permanentError); !ok {
+			c.mu.Lock()
+			c.unreachableAt = time.Now()
+			c.mu.Unlock()
+		}
+		return code, body, err
+	}
+
+	c.mu.Lock()
+	c.unreachableAt = time.Time{}
+	c.mu.Unlock()
+	return code, body, nil
+}
+
+func accepted(code int) bool {
+	return code == http.StatusCreated || code == http.StatusOK || code == http.StatusAccepted
+}
+
+// unauthorized reports whether the server rejected the credentials, the
+// request is not retried as it fails until the token is replaced
+func unauthorized(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// credentials are presented to the Meshery server with every request
+type credentials struct {
+	Token    string `json:"token"`
+	Provider string `json:"meshery-provider"`
+}
+
+// apply presents the token as a bearer token, and as the cookies set by the
+// Meshery UI and mesheryctl when its provider is known
+func (cr credentials) apply(req *http.Request) {
+	if cr.Token == "" {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+cr.Token)
+	if cr.Provider != "" {
+		req.AddCookie(&http.Cookie{Name: "token", Value: cr.Token})
+		req.AddCookie(&http.Cookie{Name: "meshery-provider", Value: cr.Provider})
+	}
+}
+
+// credentials returns the configured token, or reads it from the token
+// file. The file holds either the bare token or the auth.json of mesheryctl,
+// whose provider takes precedence over the configured one.
+func (c *Client) credentials() (credentials, error) {
+	c.mu.RLock()
+	creds := credentials{Token: c.token, Provider: c.provider}
+	tokenFile := c.tokenFile
+	c.mu.RUnlock()
+	if creds.Token != "" || tokenFile == "" {
+		return creds, nil
+	}
+
+	byt, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return credentials{}, ErrReadToken(err)
+	}
+	var auth credentials
+	if err := json.Unmarshal(byt, &auth); err == nil && auth.Token != "" {
+		if auth.Provider != "" {
+			creds.Provider = auth.Provider
+		}
+		creds.Token = auth.Token
+		return creds, nil
+	}
+	creds.Token = strings.TrimSpace(string(byt))
+	return creds, nil
+}
@@ -0,0 +1,81 @@
+package oam
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "unreachable and not queued", err: ErrRegister(fmt.Errorf("connection refused, queueing it failed: read-only file system")), want: true},
+		{name: "rejected", err: ErrRegistrationRejected(fmt.Errorf("host returned status code 404"))},
+		{name: "unauthorized", err: ErrUnauthorized(http.StatusForbidden)},
+		{name: "generation failed", err: ErrGenerateComponents(fmt.Errorf("fetching the CRDs returned status code 404"))},
+		{name: "queued", err: ErrRegistrationQueued},
+		{name: "not a registration error", err: fmt.Errorf("reading the templates failed")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendClientErrorsAreNotRetryable(t *testing.T) {
+	for _, code := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed} {
+		t.Run(http.StatusText(code), func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(code)
+			}))
+			defer server.Close()
+
+			c := &Client{httpClient: server.Client(), retryTimeout: time.Second}
+			err := c.send(http.MethodPost, server.URL+"/api/oam/workload", workload("CiliumNode", "v1.14.0"))
+			if err == nil || Retryable(err) {
+				t.Errorf("send() error = %v, want an error which is not retryable", err)
+			}
+			if requests != 1 {
+				t.Errorf("sent %d requests, want 1", requests)
+			}
+		})
+	}
+}
+
+func TestSendQueuesOnceTheServerIsUnreachable(t *testing.T) {
+	defer useTempQueue(t)()
+
+	// Nothing listens on the address of a closed server
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL + "/api/oam/workload"
+	server.Close()
+
+	c := &Client{httpClient: &http.Client{Timeout: time.Second}, retryTimeout: time.Second}
+	if err := c.send(http.MethodPost, url, workload("CiliumNode", "v1.14.0")); err != ErrRegistrationQueued {
+		t.Fatalf("send() error = %v, want ErrRegistrationQueued", err)
+	}
+
+	start := time.Now()
+	for _, name := range []string{"CiliumEndpoint", "CiliumIdentity", "CiliumNetworkPolicy"} {
+		if err := c.send(http.MethodPost, url, workload(name, "v1.14.0")); err != ErrRegistrationQueued {
+			t.Fatalf("send() error = %v, want ErrRegistrationQueued", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("send() took %s to queue the registrations once the server was unreachable", elapsed)
+	}
+	if n := QueuedRegistrations(); n != 4 {
+		t.Errorf("queued %d registrations, want 4", n)
+	}
+}
@@ -0,0 +1,108 @@
+package oam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Lock is held by an adapter on a cluster while it runs an operation which
+// changes the CNI or the proxies of the cluster. Adapters of other meshes
+// check for it before running such an operation themselves.
+type Lock struct {
+	Adapter     string    `json:"adapter"`
+	Cluster     string    `json:"cluster"`
+	Operation   string    `json:"operation"`
+	OperationID string    `json:"operation_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Announcement tells the other adapters that an operation changed a cluster
+type Announcement struct {
+	Adapter     string    `json:"adapter"`
+	Cluster     string    `json:"cluster"`
+	Operation   string    `json:"operation"`
+	OperationID string    `json:"operation_id"`
+	Succeeded   bool      `json:"succeeded"`
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// Coordinator takes the cluster locks and publishes the announcements of
+// the adapter through the Meshery server
+//
+// Locks are managed with POST and DELETE requests to $runtime/api/system/adapters/locks,
+// announcements are sent as POST requests to $runtime/api/system/adapters/announcements
+type Coordinator struct {
+	client  *Client
+	runtime string
+	// Timeout bounds the time an operation waits for the lock of another adapter
+	Timeout time.Duration
+}
+
+// NewCoordinator creates a Coordinator talking to the Meshery server at runtime
+func NewCoordinator(client *Client, runtime string, timeout time.Duration) *Coordinator {
+	return &Coordinator{
+		client:  client,
+		runtime: runtime,
+		Timeout: timeout,
+	}
+}
+
+// Acquire takes or renews the lock of a cluster. When another adapter holds
+// the lock it is returned instead. ErrCoordinationUnsupported is returned
+// when the Meshery server doesn't implement the locks.
+func (c *Coordinator) Acquire(lock Lock) (*Lock, error) {
+	code, body, err := c.client.do(http.MethodPost, c.runtime+"/api/system/adapters/locks", lock)
+	if err != nil {
+		return nil, ErrCoordination(err)
+	}
+
+	switch {
+	case accepted(code):
+		return nil, nil
+	case code == http.StatusConflict:
+		holder := &Lock{}
+		if err := json.Unmarshal(body, holder); err != nil {
+			return nil, ErrCoordination(err)
+		}
+		return holder, nil
+	case unsupported(code):
+		return nil, ErrCoordinationUnsupported
+	case unauthorized(code):
+		return nil, ErrUnauthorized(code)
+	default:
+		return nil, ErrCoordination(fmt.Errorf("host returned status code %d", code))
+	}
+}
+
+// Release gives up the lock of a cluster
+func (c *Coordinator) Release(lock Lock) error {
+	code, _, err := c.client.do(http.MethodDelete, c.runtime+"/api/system/adapters/locks", lock)
+	if err != nil {
+		return ErrCoordination(err)
+	}
+	if !accepted(code) && code != http.StatusNoContent && !unsupported(code) {
+		return ErrCoordination(fmt.Errorf("host returned status code %d", code))
+	}
+	return nil
+}
+
+// Announce publishes the outcome of an operation to the other adapters
+func (c *Coordinator) Announce(a Announcement) error {
+	code, _, err := c.client.do(http.MethodPost, c.runtime+"/api/system/adapters/announcements", a)
+	if err != nil {
+		return ErrCoordination(err)
+	}
+	if !accepted(code) && !unsupported(code) {
+		return ErrCoordination(fmt.Errorf("host returned status code %d", code))
+	}
+	return nil
+}
+
+// unsupported reports whether the status code was returned by a Meshery
+// server without the coordination endpoints
+func unsupported(code int) bool {
+	return code == http.StatusNotFound || code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented
+}
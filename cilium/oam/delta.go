@@ -0,0 +1,135 @@
+package oam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/layer5io/meshery-cilium/internal/config"
+)
+
+const publishedComponentsFile = "published-components.json"
+
+// publishMu serializes the reads and updates of the published components
+// record, the components of several versions are registered concurrently
+var publishMu sync.Mutex
+
+// WorkloadDeletion is the payload sent to the Meshery server to remove
+// workload definitions which are no longer generated by the adapter
+type WorkloadDeletion struct {
+	Names []string `json:"names"`
+	// Version restricts the deletion to the components of a Cilium version
+	Version  string            `json:"version,omitempty"`
+	Host     string            `json:"host,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// publishedComponents maps a registry to the digests of the components
+// last published to it, keyed by component name
+type publishedComponents map[string]map[string]string
+
+// publishedComponentsPath is the file holding the published components, a
+// variable so that the tests don't touch the record of the adapter
+var publishedComponentsPath = func() string {
+	return filepath.Join(config.RootPath(), publishedComponentsFile)
+}
+
+func loadPublishedComponents() (publishedComponents, error) {
+	published := publishedComponents{}
+
+	byt, err := ioutil.ReadFile(publishedComponentsPath())
+	if os.IsNotExist(err) {
+		return published, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(byt, &published); err != nil {
+		// A corrupt record only costs a full republish
+		return publishedComponents{}, nil
+	}
+	return published, nil
+}
+
+// publishedSet returns the digests last published for set
+func publishedSet(set string) (map[string]string, error) {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	published, err := loadPublishedComponents()
+	if err != nil {
+		return nil, err
+	}
+	return published[set], nil
+}
+
+// recordPublished records the digests published for set, the record is
+// read again since the other sets may have been updated meanwhile
+func recordPublished(set string, cur map[string]string) error {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	published, err := loadPublishedComponents()
+	if err != nil {
+		return err
+	}
+	published[set] = cur
+	return published.save()
+}
+
+// ForgetPublished drops the record of the published components, so that
+// the next registration publishes every component again. The server may
+// have lost them, e.g. when its database was reset.
+func ForgetPublished() error {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	err := os.Remove(publishedComponentsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (p publishedComponents) save() error {
+	byt, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(publishedComponentsPath(), byt, 0600)
+}
+
+// digest returns a stable fingerprint of a component definition and schema
+func digest(definition, schema string) string {
+	sum := sha256.Sum256([]byte(definition + "\x00" + schema))
+	return hex.EncodeToString(sum[:])
+}
+
+// diffComponents compares the previously published digests against the
+// current ones and returns the names which changed or are new, followed
+// by the names which are no longer present
+func diffComponents(prev, cur map[string]string) (changed, removed []string) {
+	for name, d := range cur {
+		if prev[name] != d {
+			changed = append(changed, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// componentName returns the name of an OAM definition
+func componentName(definition map[string]interface{}) string {
+	metadata, _ := definition["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
@@ -0,0 +1,56 @@
+package oam
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffComponents(t *testing.T) {
+	tests := []struct {
+		name        string
+		prev        map[string]string
+		cur         map[string]string
+		wantChanged []string
+		wantRemoved []string
+	}{
+		{
+			name:        "first publish",
+			cur:         map[string]string{"CiliumNetworkPolicy": "a", "CiliumEndpoint": "b"},
+			wantChanged: []string{"CiliumEndpoint", "CiliumNetworkPolicy"},
+		},
+		{
+			name: "unchanged",
+			prev: map[string]string{"CiliumNetworkPolicy": "a"},
+			cur:  map[string]string{"CiliumNetworkPolicy": "a"},
+		},
+		{
+			name:        "changed and new",
+			prev:        map[string]string{"CiliumNetworkPolicy": "a", "CiliumEndpoint": "b"},
+			cur:         map[string]string{"CiliumNetworkPolicy": "c", "CiliumEndpoint": "b", "CiliumNode": "d"},
+			wantChanged: []string{"CiliumNetworkPolicy", "CiliumNode"},
+		},
+		{
+			name:        "removed",
+			prev:        map[string]string{"CiliumNetworkPolicy": "a", "CiliumEgressNATPolicy": "b", "CiliumBGPPeeringPolicy": "c"},
+			cur:         map[string]string{"CiliumNetworkPolicy": "a"},
+			wantRemoved: []string{"CiliumBGPPeeringPolicy", "CiliumEgressNATPolicy"},
+		},
+		{
+			name:        "everything removed",
+			prev:        map[string]string{"CiliumNetworkPolicy": "a"},
+			wantRemoved: []string{"CiliumNetworkPolicy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, removed := diffComponents(tt.prev, tt.cur)
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("diffComponents() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("diffComponents() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
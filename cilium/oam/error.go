@@ -0,0 +1,152 @@
+package oam
+
+import (
+	"fmt"
+
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrLoadTLSConfigCode represents the errors which are generated
+	// while loading the certificates used to talk to the Meshery server
+	ErrLoadTLSConfigCode = "1026"
+
+	// ErrRegisterCode represents the errors which are generated
+	// when a registration request to the Meshery server fails
+	ErrRegisterCode = "1027"
+
+	// ErrReadTokenCode represents the errors which are generated
+	// while reading the Meshery server token from a file
+	ErrReadTokenCode = "1028"
+
+	// ErrGenerateComponentsCode represents the errors which are generated
+	// during the dynamic component generation
+	ErrGenerateComponentsCode = "1029"
+
+	// ErrOpenOAMFileCode represents the errors which are generated
+	// while reading OAM definition and schema files
+	ErrOpenOAMFileCode = "1030"
+
+	// ErrCoordinationCode represents the errors which are generated
+	// while taking or releasing a cluster lock through the Meshery server
+	ErrCoordinationCode = "1054"
+
+	// ErrCoordinationUnsupportedCode represents the error which is generated
+	// when the Meshery server doesn't implement the cluster locks
+	ErrCoordinationUnsupportedCode = "1056"
+
+	// ErrSchemaLimitCode represents the errors which are generated when
+	// the schemas of components exceed the size limit
+	ErrSchemaLimitCode = "1081"
+
+	// ErrRegisterModelCode represents the errors which are generated while
+	// building or recording the registration of the Cilium model
+	ErrRegisterModelCode = "1106"
+
+	// ErrModelsUnsupportedCode represents the error which is generated when
+	// the Meshery server doesn't implement the registry of models
+	ErrModelsUnsupportedCode = "1107"
+
+	// ErrGenerateComponentCode represents the errors which are generated
+	// when the components of some of the CRDs of a source fail to generate
+	ErrGenerateComponentCode = "1108"
+
+	// ErrRegistrationQueueCode represents the errors which are generated
+	// while reading or writing the queue of the registrations
+	ErrRegistrationQueueCode = "1109"
+
+	// ErrRegistrationQueuedCode represents the error which is generated when
+	// registrations are queued until the Meshery server is reachable
+	ErrRegistrationQueuedCode = "1110"
+
+	// ErrUnauthorizedCode represents the error which is generated when the
+	// Meshery server rejects the token presented by the adapter
+	ErrUnauthorizedCode = "1113"
+
+	// ErrRegistrationRejectedCode represents the errors which are generated
+	// when the Meshery server rejects a registration as a client error
+	ErrRegistrationRejectedCode = "1131"
+
+	// ErrWorkloadDeletionUnsupportedCode represents the error which is
+	// generated when the Meshery server can't remove workload definitions
+	ErrWorkloadDeletionUnsupportedCode = "1132"
+)
+
+var (
+	// ErrCoordinationUnsupported is the error when the Meshery server
+	// doesn't implement the cross-adapter locks
+	ErrCoordinationUnsupported = errors.New(ErrCoordinationUnsupportedCode, errors.Alert, []string{"Meshery server doesn't support adapter coordination"}, []string{"The lock endpoints are not available"}, []string{"The Meshery server predates adapter coordination"}, []string{"Upgrade the Meshery server to coordinate operations across adapters"})
+
+	// ErrModelsUnsupported is the error when the Meshery server doesn't
+	// implement the registry of models, the OAM definitions are used instead
+	ErrModelsUnsupported = errors.New(ErrModelsUnsupportedCode, errors.Alert, []string{"Meshery server doesn't support models"}, []string{"The model registration endpoint is not available"}, []string{"The Meshery server predates the registry of models"}, []string{"Upgrade the Meshery server to register Cilium as a model, the OAM definitions keep working meanwhile"})
+
+	// ErrWorkloadDeletionUnsupported is the error when the Meshery server
+	// doesn't implement the deletion of workload definitions, the components
+	// the adapter no longer generates stay registered
+	ErrWorkloadDeletionUnsupported = errors.New(ErrWorkloadDeletionUnsupportedCode, errors.Alert, []string{"Meshery server doesn't support removing components"}, []string{"The workload deletion endpoint is not available"}, []string{"The Meshery server predates the deletion of workload definitions"}, []string{"Upgrade the Meshery server to remove the components Cilium no longer ships, the other components are registered"})
+
+	// ErrRegistrationQueued is the error when the Meshery server is
+	// unreachable, the registrations are replayed once it is reachable
+	ErrRegistrationQueued = errors.New(ErrRegistrationQueuedCode, errors.Alert, []string{"Registrations queued until the Meshery server is reachable"}, []string{"The Meshery server could not be reached, the registrations are buffered on disk"}, []string{"Meshery server is down or unreachable"}, []string{"The registrations are replayed automatically, check the Meshery server address if they remain queued"})
+)
+
+// ErrLoadTLSConfig is the error while loading the TLS certificates for the Meshery server
+func ErrLoadTLSConfig(err error) error {
+	return errors.New(ErrLoadTLSConfigCode, errors.Alert, []string{"Error loading TLS configuration for Meshery server"}, []string{err.Error()}, []string{"Certificate, key or CA file is missing or invalid"}, []string{"Verify the paths set in MESHERY_SERVER_CA_FILE, MESHERY_SERVER_CERT_FILE and MESHERY_SERVER_KEY_FILE"})
+}
+
+// ErrRegister is the error when registering capabilities with the Meshery server fails
+func ErrRegister(err error) error {
+	return errors.New(ErrRegisterCode, errors.Alert, []string{"Error registering capabilities with Meshery server"}, []string{err.Error()}, []string{"Meshery server is unreachable", "The token is invalid or expired", "The server certificate could not be verified"}, []string{"Check the Meshery server address, token and TLS settings"})
+}
+
+// ErrReadToken is the error while reading the Meshery server token file
+func ErrReadToken(err error) error {
+	return errors.New(ErrReadTokenCode, errors.Alert, []string{"Error reading Meshery server token"}, []string{err.Error()}, []string{"The secret holding the token is not mounted"}, []string{"Verify the path set in MESHERY_SERVER_TOKEN_FILE"})
+}
+
+// ErrUnauthorized is the error when the Meshery server rejects the token of the adapter
+func ErrUnauthorized(code int) error {
+	return errors.New(ErrUnauthorizedCode, errors.Alert, []string{"Meshery server rejected the credentials of the adapter"}, []string{fmt.Sprintf("host returned status code %d", code)}, []string{"No token is configured while the server enforces authentication", "The token is invalid or expired", "The token was issued by another provider"}, []string{"Set MESHERY_SERVER_TOKEN or MESHERY_SERVER_TOKEN_FILE to a valid token", "Set MESHERY_PROVIDER to the provider which issued the token"})
+}
+
+// ErrRegistrationRejected is the error when the Meshery server rejects a registration, sending it again fails the same
+func ErrRegistrationRejected(err error) error {
+	return errors.New(ErrRegistrationRejectedCode, errors.Alert, []string{"Meshery server rejected the registration"}, []string{err.Error()}, []string{"The Meshery server doesn't serve the registration endpoint", "The registration is malformed or can't be encoded"}, []string{"Check that the Meshery server version supports the adapter"})
+}
+
+// ErrGenerateComponents is the error during the dynamic component generation
+func ErrGenerateComponents(err error) error {
+	return errors.New(ErrGenerateComponentsCode, errors.Alert, []string{"Error generating components"}, []string{err.Error()}, []string{"Invalid component generation method or URL"}, []string{"Verify the values of COMP_GEN_URL and COMP_GEN_METHOD"})
+}
+
+// ErrOpenOAMFile is the error while reading an OAM definition or schema
+func ErrOpenOAMFile(err error) error {
+	return errors.New(ErrOpenOAMFileCode, errors.Alert, []string{"Error reading OAM definition"}, []string{err.Error()}, []string{"The templates directory is missing or contains invalid json"}, []string{"Run the adapter from the repository root or reinstall the templates"})
+}
+
+// ErrCoordination is the error while coordinating an operation with the other adapters
+func ErrCoordination(err error) error {
+	return errors.New(ErrCoordinationCode, errors.Alert, []string{"Error coordinating with other adapters"}, []string{err.Error()}, []string{"Meshery server is unreachable", "The token is invalid or expired"}, []string{"Check the Meshery server address, token and TLS settings"})
+}
+
+// ErrSchemaLimit is the error when the schemas of components exceed the size limit, the other components are registered
+func ErrSchemaLimit(sizes []string) error {
+	return errors.New(ErrSchemaLimitCode, errors.Alert, []string{"Components not registered, their schema exceeds the size limit"}, sizes, []string{"The OpenAPI schemas of the CRDs carry long descriptions"}, []string{"Set MESHERY_SERVER_SCHEMA_MAX_DESCRIPTION to prune the long descriptions", "Raise MESHERY_SERVER_SCHEMA_MAX_BYTES if the Meshery server accepts larger requests"})
+}
+
+// ErrRegisterModel is the error while building or recording the registration of the Cilium model
+func ErrRegisterModel(err error) error {
+	return errors.New(ErrRegisterModelCode, errors.Alert, []string{"Error registering the Cilium model"}, []string{err.Error()}, []string{"The record of the published components is unreadable"}, []string{"Verify the files of the adapter under ~/.meshery"})
+}
+
+// ErrGenerateComponent is the error when the components of some CRDs fail to generate, the other components are registered
+func ErrGenerateComponent(failures []string) error {
+	return errors.New(ErrGenerateComponentCode, errors.Alert, []string{"Components not registered, their CRD failed to generate"}, failures, []string{"The CRD has no group or version", "The source holds an invalid document", "The generation timed out"}, []string{"Verify the CRDs served at COMP_GEN_URL", "Raise COMP_GEN_WORKERS to generate the CRDs faster"})
+}
+
+// ErrRegistrationQueue is the error while reading or writing the queue of the registrations
+func ErrRegistrationQueue(err error) error {
+	return errors.New(ErrRegistrationQueueCode, errors.Alert, []string{"Error accessing the registration queue"}, []string{err.Error()}, []string{"The queue file under ~/.meshery is unreadable or not writable"}, []string{"Verify the files of the adapter under ~/.meshery, removing the queue file drops the queued registrations"})
+}
@@ -0,0 +1,94 @@
+package oam
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-cilium/internal/config"
+)
+
+// FaultHeader is set on the responses simulated by a FaultTransport
+const FaultHeader = "X-Simulated-Fault"
+
+// FaultTransport simulates the failures of a Meshery server in front of
+// the transport reaching the real server. Each request draws a single
+// fault: a 503 answer, a timeout after the delay or a slow request sent
+// after the delay.
+type FaultTransport struct {
+	Base   http.RoundTripper
+	Faults config.Faults
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewFaultTransport wraps base with the simulated faults
+func NewFaultTransport(base http.RoundTripper, faults config.Faults) *FaultTransport {
+	return &FaultTransport{
+		Base:   base,
+		Faults: faults,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())), // #nosec
+	}
+}
+
+// faultTimeout is the error of simulated timeouts, it is a net.Error so
+// that it is handled as the timeouts of the real transport
+type faultTimeout struct {
+	url string
+}
+
+func (e faultTimeout) Error() string {
+	return fmt.Sprintf("simulated timeout requesting %s", e.url)
+}
+
+func (e faultTimeout) Timeout() bool   { return true }
+func (e faultTimeout) Temporary() bool { return true }
+
+// RoundTrip implements http.RoundTripper
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	draw := t.rand.Float64()
+	t.mu.Unlock()
+
+	f := t.Faults
+	switch {
+	case draw < f.ServerErrorRate:
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable)),
+			StatusCode: http.StatusServiceUnavailable,
+			Proto:      req.Proto,
+			ProtoMajor: req.ProtoMajor,
+			ProtoMinor: req.ProtoMinor,
+			Header:     http.Header{FaultHeader: []string{"5xx"}},
+			Body:       ioutil.NopCloser(bytes.NewBufferString("simulated server error")),
+			Request:    req,
+		}, nil
+	case draw < f.ServerErrorRate+f.TimeoutRate:
+		if err := t.hold(req); err != nil {
+			return nil, err
+		}
+		return nil, faultTimeout{url: req.URL.String()}
+	case draw < f.ServerErrorRate+f.TimeoutRate+f.SlowRate:
+		if err := t.hold(req); err != nil {
+			return nil, err
+		}
+	}
+	return t.Base.RoundTrip(req)
+}
+
+// hold waits for the delay of the faults unless the request is cancelled
+func (t *FaultTransport) hold(req *http.Request) error {
+	timer := time.NewTimer(t.Faults.Delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
@@ -0,0 +1,241 @@
+package oam
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	"github.com/layer5io/meshkit/utils/manifests"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"sigs.k8s.io/yaml"
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// crdDocument is a CustomResourceDefinition of the source of a generation
+type crdDocument struct {
+	kind string
+	crd  map[string]interface{}
+}
+
+// componentFailure is a CRD whose component could not be generated, the
+// kind is empty for the documents which could not be decoded
+type componentFailure struct {
+	Kind  string `json:"kind,omitempty"`
+	Error string `json:"error"`
+}
+
+func (f componentFailure) String() string {
+	if f.Kind == "" {
+		return f.Error
+	}
+	return fmt.Sprintf("%s: %s", f.Kind, f.Error)
+}
+
+// generation is the outcome of the generation of a source
+type generation struct {
+	component *manifests.Component
+	failures  []componentFailure
+}
+
+// failureStrings lists the failures of the generation
+func (g *generation) failureStrings() []string {
+	res := make([]string, 0, len(g.failures))
+	for _, f := range g.failures {
+		res = append(res, f.String())
+	}
+	return res
+}
+
+// generateFromManifest generates the components of the CRDs of a manifest
+// on a pool of workers. A CRD failing to generate doesn't fail the others,
+// it is reported among the failures instead. The CRDs left once the
+// timeout elapsed are reported as failures as well.
+func generateFromManifest(manifest string, cfg manifests.Config, workers int, timeout time.Duration) *generation {
+	crds, failures := manifestCRDs(manifest, cfg.Filter.OnlyRes)
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(crds) {
+		workers = len(crds)
+	}
+
+	type result struct {
+		definition string
+		schema     string
+		err        error
+	}
+	results := make([]result, len(crds))
+	deadline := time.Now().Add(timeout)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if timeout > 0 && time.Now().After(deadline) {
+					results[i].err = fmt.Errorf("generation timed out after %s", timeout)
+					continue
+				}
+				results[i].definition, results[i].schema, results[i].err = crdComponent(crds[i], cfg)
+			}
+		}()
+	}
+	for i := range crds {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// The components keep the order of the CRDs in the source
+	res := &generation{component: &manifests.Component{Schemas: []string{}, Definitions: []string{}}, failures: failures}
+	for i, r := range results {
+		if r.err != nil {
+			res.failures = append(res.failures, componentFailure{Kind: crds[i].kind, Error: r.err.Error()})
+			continue
+		}
+		res.component.Definitions = append(res.component.Definitions, r.definition)
+		res.component.Schemas = append(res.component.Schemas, r.schema)
+	}
+	return res
+}
+
+// manifestCRDs returns the CRDs of a manifest, restricted to the given kinds
+// when there are any, along with the documents which could not be decoded
+func manifestCRDs(manifest string, only []string) ([]crdDocument, []componentFailure) {
+	var crds []crdDocument
+	var failures []componentFailure
+	for i, raw := range documentSeparator.Split(manifest, -1) {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		doc := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(raw), &doc); err != nil {
+			failures = append(failures, componentFailure{Error: fmt.Sprintf("document %d: %s", i, err)})
+			continue
+		}
+		if doc["kind"] != "CustomResourceDefinition" {
+			continue
+		}
+		spec, _ := doc["spec"].(map[string]interface{})
+		names, _ := spec["names"].(map[string]interface{})
+		kind, _ := names["kind"].(string)
+		if kind == "" || len(only) > 0 && !containsString(only, kind) {
+			continue
+		}
+		crds = append(crds, crdDocument{kind: kind, crd: doc})
+	}
+	return crds, failures
+}
+
+// crdComponent generates the workload definition and the schema of the
+// component of a CRD, alike the ones generated by meshkit: the version is
+// the first one of the CRD and the schema the one of its spec
+func crdComponent(doc crdDocument, cfg manifests.Config) (definition, schema string, err error) {
+	// A malformed CRD only fails its own component
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	spec, _ := doc.crd["spec"].(map[string]interface{})
+	group, _ := spec["group"].(string)
+	if group == "" {
+		return "", "", fmt.Errorf("no group")
+	}
+	version, _ := spec["version"].(string)
+	openAPISchema := nestedMap(spec, "validation", "openAPIV3Schema")
+	if versions, _ := spec["versions"].([]interface{}); len(versions) > 0 {
+		first, _ := versions[0].(map[string]interface{})
+		version, _ = first["name"].(string)
+		if s := nestedMap(first, "schema", "openAPIV3Schema"); s != nil {
+			openAPISchema = s
+		}
+	}
+	if version == "" {
+		return "", "", fmt.Errorf("no version")
+	}
+
+	var def v1alpha1.WorkloadDefinition
+	def.APIVersion = "core.oam.dev/v1alpha1"
+	def.Kind = "WorkloadDefinition"
+	def.ObjectMeta.Name = doc.kind
+	def.Spec.DefinitionRef.Name = strings.ToLower(doc.kind) + ".meshery.layer5.io"
+	def.Spec.Metadata = map[string]string{
+		"@type":         "pattern.meshery.io/mesh/workload",
+		"meshVersion":   cfg.MeshVersion,
+		"meshName":      cfg.Name,
+		"k8sAPIVersion": group + "/" + version,
+		"k8sKind":       doc.kind,
+	}
+	byt, err := json.MarshalIndent(def, "", " ")
+	if err != nil {
+		return "", "", err
+	}
+	definition = string(byt)
+
+	if specSchema := nestedMap(openAPISchema, "properties", "spec"); specSchema != nil {
+		specSchema["title"] = strings.ToLower(doc.kind)
+		if byt, err = json.MarshalIndent(specSchema, "", " "); err != nil {
+			return "", "", err
+		}
+		schema = string(byt)
+	}
+
+	if cfg.ModifyDefSchema != nil {
+		cfg.ModifyDefSchema(&definition, &schema)
+	}
+	return definition, schema, nil
+}
+
+// fetchChart downloads a packaged chart and returns its CRDs as a manifest,
+// it reports whether the chart of the cached generation is unchanged
+func fetchChart(url string, cached, entry *cachedComponents) (string, bool, error) {
+	resp, notModified, err := conditionalGet(url, cached, entry)
+	if err != nil || notModified {
+		return "", notModified, err
+	}
+	defer resp.Body.Close()
+
+	chart, err := loader.LoadArchive(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	return chartCRDs(chart), false, nil
+}
+
+// chartCRDs returns the CRDs of a chart as a manifest
+func chartCRDs(c *chart.Chart) string {
+	var docs []string
+	for _, crd := range c.CRDObjects() {
+		docs = append(docs, string(crd.File.Data))
+	}
+	return strings.Join(docs, "\n---\n")
+}
+
+func nestedMap(m map[string]interface{}, fields ...string) map[string]interface{} {
+	for _, f := range fields {
+		next, ok := m[f].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		m = next
+	}
+	return m
+}
+
+func containsString(list []string, s string) bool {
+	for _, cur := range list {
+		if cur == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package oam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// localSource returns the filesystem path of a component source given as a
+// file:// URL or as an absolute path, so that components can be generated in
+// air-gapped environments
+func localSource(url string) (string, bool) {
+	if strings.HasPrefix(url, "file://") {
+		return strings.TrimPrefix(url, "file://"), true
+	}
+	if filepath.IsAbs(url) {
+		return url, true
+	}
+	return "", false
+}
+
+// readLocalManifests returns the CRDs held by a local source. A chart, as a
+// directory or a packaged archive, is read when generating from Helm charts,
+// a manifest file or a directory of manifest files otherwise.
+func readLocalManifests(path, method string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch method {
+	case adapter.HelmCHARTS:
+		chart, err := loader.Load(path)
+		if err != nil {
+			return "", err
+		}
+		var docs []string
+		for _, crd := range chart.CRDObjects() {
+			docs = append(docs, string(crd.File.Data))
+		}
+		return strings.Join(docs, "\n---\n"), nil
+	case adapter.Manifests:
+		if !info.IsDir() {
+			// #nosec
+			byt, err := ioutil.ReadFile(path)
+			return string(byt), err
+		}
+
+		var files []string
+		if err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			switch filepath.Ext(p) {
+			case ".yaml", ".yml", ".json":
+				if !fi.IsDir() {
+					files = append(files, p)
+				}
+			}
+			return nil
+		}); err != nil {
+			return "", err
+		}
+		sort.Strings(files)
+
+		var docs []string
+		for _, f := range files {
+			// #nosec
+			byt, err := ioutil.ReadFile(f)
+			if err != nil {
+				return "", err
+			}
+			docs = append(docs, string(byt))
+		}
+		if len(docs) == 0 {
+			return "", fmt.Errorf("no manifests found in %s", path)
+		}
+		return strings.Join(docs, "\n---\n"), nil
+	}
+	return "", fmt.Errorf("unknown generation method: %s", method)
+}
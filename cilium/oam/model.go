@@ -0,0 +1,365 @@
+package oam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/config"
+)
+
+// ModelName is the name of Cilium in the Meshery registry of models
+const ModelName = "cilium"
+
+// modelDigestKey is the key under which the digest of a model registration
+// is recorded among the published components
+const modelDigestKey = "model"
+
+// Model describes Cilium in the Meshery registry, the components and the
+// relationships of a version are registered under it
+type Model struct {
+	Name        string            `json:"name"`
+	DisplayName string            `json:"displayName"`
+	Version     string            `json:"version"`
+	Category    string            `json:"category"`
+	SubCategory string            `json:"subCategory"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// Capability is something Meshery can do with a component
+type Capability struct {
+	Kind        string `json:"kind"`
+	Type        string `json:"type"`
+	SubType     string `json:"subType,omitempty"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description,omitempty"`
+	// EntityState is the state of the component the capability applies
+	// to, declaration for the designs and instance for the cluster
+	EntityState []string `json:"entityState"`
+}
+
+// ModelComponent is a resource of the model, a CRD of Cilium or a workload
+// of the adapter
+type ModelComponent struct {
+	Kind         string       `json:"kind"`
+	APIVersion   string       `json:"apiVersion"`
+	DisplayName  string       `json:"displayName"`
+	Schema       string       `json:"schema"`
+	Capabilities []Capability `json:"capabilities"`
+	// Metadata carries the OAM definition the component was generated
+	// from, so that both registries resolve to the same component
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// RelationshipSelector matches the components on both ends of a
+// relationship, Match maps the path of a field of the from component to
+// the path of the field of the to component it selects on
+type RelationshipSelector struct {
+	From  []string          `json:"from"`
+	To    []string          `json:"to"`
+	Match map[string]string `json:"match,omitempty"`
+}
+
+// Relationship is a dependency between the components of the model, or
+// with the components of the Kubernetes model
+type Relationship struct {
+	Kind        string                 `json:"kind"`
+	Type        string                 `json:"type"`
+	SubType     string                 `json:"subType"`
+	Description string                 `json:"description"`
+	Selectors   []RelationshipSelector `json:"selectors"`
+}
+
+// ModelRegistration is the payload sent to the Meshery server to register
+// the model of a Cilium version
+type ModelRegistration struct {
+	Host          string           `json:"host"`
+	Model         Model            `json:"model"`
+	Components    []ModelComponent `json:"components"`
+	Relationships []Relationship   `json:"relationships"`
+}
+
+var (
+	// workloadKinds are the Kubernetes workloads selected by the policies
+	workloadKinds = []string{"Pod", "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job", "CronJob"}
+
+	// Relationships are the relationships of the Cilium components, only the
+	// ones whose components are registered are sent along with the model
+	Relationships = []Relationship{
+		{
+			Kind:        "edge",
+			Type:        "network",
+			SubType:     "policy-selects-workload",
+			Description: "The network policy applies to the workloads whose labels match its endpoint selector",
+			Selectors: []RelationshipSelector{{
+				From:  []string{"CiliumNetworkPolicy", "CiliumClusterwideNetworkPolicy"},
+				To:    workloadKinds,
+				Match: map[string]string{"spec.endpointSelector.matchLabels": "metadata.labels"},
+			}},
+		},
+		{
+			Kind:        "edge",
+			Type:        "network",
+			SubType:     "policy-selects-node",
+			Description: "The host policy applies to the nodes whose labels match its node selector",
+			Selectors: []RelationshipSelector{{
+				From:  []string{"CiliumClusterwideNetworkPolicy"},
+				To:    []string{"Node"},
+				Match: map[string]string{"spec.nodeSelector.matchLabels": "metadata.labels"},
+			}},
+		},
+		{
+			Kind:        "edge",
+			Type:        "network",
+			SubType:     "egress-gateway-selects-workload",
+			Description: "The traffic of the selected pods leaves the cluster through the gateway node",
+			Selectors: []RelationshipSelector{{
+				From:  []string{"CiliumEgressGatewayPolicy"},
+				To:    workloadKinds,
+				Match: map[string]string{"spec.selectors.podSelector.matchLabels": "metadata.labels"},
+			}},
+		},
+		{
+			Kind:        "edge",
+			Type:        "network",
+			SubType:     "envoy-config-routes-service",
+			Description: "The traffic of the listed services is redirected to the Envoy listeners of the configuration",
+			Selectors: []RelationshipSelector{{
+				From:  []string{"CiliumEnvoyConfig", "CiliumClusterwideEnvoyConfig"},
+				To:    []string{"Service"},
+				Match: map[string]string{"spec.services.name": "metadata.name"},
+			}},
+		},
+		{
+			Kind:        "edge",
+			Type:        "network",
+			SubType:     "bgp-peering-selects-node",
+			Description: "The nodes whose labels match the node selector peer with the routers of the policy",
+			Selectors: []RelationshipSelector{{
+				From:  []string{"CiliumBGPPeeringPolicy", "CiliumBGPClusterConfig"},
+				To:    []string{"Node"},
+				Match: map[string]string{"spec.nodeSelector.matchLabels": "metadata.labels"},
+			}},
+		},
+	}
+)
+
+// modelCapabilities are the capabilities of every component of the model
+var modelCapabilities = []Capability{
+	{Kind: "mutate", Type: "configuration", SubType: "config", DisplayName: "Configuration", Description: "Configure the component", EntityState: []string{"declaration"}},
+	{Kind: "view", Type: "configuration", SubType: "config", DisplayName: "Details", Description: "View the component in the cluster", EntityState: []string{"instance"}},
+}
+
+// relationshipCapability is the capability of the components on the from
+// end of a relationship
+var relationshipCapability = Capability{Kind: "interaction", Type: "graph", SubType: "network", DisplayName: "Relationships", Description: "Relate the component to the workloads it selects", EntityState: []string{"declaration"}}
+
+// RegisterModel registers Cilium as a model with the components generated
+// from the manifests or the helm chart described by dc, the workloads of the
+// adapter and their relationships. The OAM definitions are registered as
+// well by RegisterWorkloads and RegisterWorkloadsDynamically, for the
+// Meshery servers which predate the registry of models.
+// ErrModelsUnsupported is returned by those servers.
+//
+// Registration process will send POST request to $runtime/api/meshmodels/register
+func RegisterModel(client *Client, runtime, host string, dc *adapter.DynamicComponentsConfig) error {
+	gen, err := generateComponents(dc, client.generationWorkers(), client.registryAuth())
+	if err != nil {
+		return ErrGenerateComponents(err)
+	}
+	comp := gen.component
+	if len(comp.Definitions) == 0 {
+		if len(gen.failures) > 0 {
+			return ErrGenerateComponent(gen.failureStrings())
+		}
+		return ErrGenerateComponents(errors.New("no components generated"))
+	}
+
+	components, err := staticModelComponents()
+	if err != nil {
+		return err
+	}
+	for i, def := range comp.Definitions {
+		definitionMap := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(def), &definitionMap); err != nil {
+			return ErrGenerateComponents(err)
+		}
+		components = append(components, modelComponent(definitionMap, comp.Schemas[i]))
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Kind < components[j].Kind })
+
+	// The components whose schema is too large are left out, like the
+	// OAM definitions
+	limits := client.schemaLimits()
+	var oversized []string
+	registered := make([]ModelComponent, 0, len(components))
+	for _, c := range components {
+		schema, size := limitSchema(limits, c.Kind, c.Schema)
+		if size != nil {
+			oversized = append(oversized, size.String())
+			continue
+		}
+		c.Schema = schema
+		registered = append(registered, c)
+	}
+
+	registration := ModelRegistration{
+		Host: host,
+		Model: Model{
+			Name:        ModelName,
+			DisplayName: "Cilium",
+			Version:     dc.Config.MeshVersion,
+			Category:    "Cloud Native Network",
+			SubCategory: "Service Mesh",
+			Metadata: map[string]string{
+				config.OAMAdapterNameMetadataKey: dc.Operation,
+			},
+		},
+		Components:    registered,
+		Relationships: modelRelationships(registered),
+	}
+
+	// The model is only registered again when it changed
+	registry := fmt.Sprintf("%s/api/meshmodels/register", runtime)
+	set := strings.Join([]string{registry, host, dc.Config.MeshVersion, strings.Join(dc.Config.Filter.OnlyRes, ",")}, "|")
+	prev, err := publishedSet(set)
+	if err != nil {
+		return ErrRegisterModel(err)
+	}
+
+	byt, err := json.Marshal(registration)
+	if err != nil {
+		return ErrRegisterModel(err)
+	}
+	cur := digest(string(byt), "")
+	if prev[modelDigestKey] != cur {
+		code, _, err := client.deliver(http.MethodPost, registry, registration)
+		_, permanent := err.(permanentError)
+		switch {
+		case permanent:
+			return ErrRegisterModel(err)
+		case err != nil:
+			return queueRegistration(http.MethodPost, registry, registration, err)
+		case unsupported(code):
+			return ErrModelsUnsupported
+		case unauthorized(code):
+			return ErrUnauthorized(code)
+		case !accepted(code):
+			return ErrRegistrationRejected(fmt.Errorf("host returned status code %d", code))
+		}
+		if err := recordPublished(set, map[string]string{modelDigestKey: cur}); err != nil {
+			return ErrRegisterModel(err)
+		}
+	}
+
+	if len(oversized) > 0 {
+		return ErrSchemaLimit(oversized)
+	}
+	if len(gen.failures) > 0 {
+		return ErrGenerateComponent(gen.failureStrings())
+	}
+	return nil
+}
+
+// staticModelComponents are the workloads of the adapter, such as the
+// CiliumMesh installation, as components of the model
+func staticModelComponents() ([]ModelComponent, error) {
+	pathSets, err := load(workloadPath)
+	if err != nil {
+		return nil, ErrOpenOAMFile(err)
+	}
+	components := make([]ModelComponent, 0, len(pathSets))
+	for _, pathSet := range pathSets {
+		definition, err := ioutil.ReadFile(pathSet.oamDefinitionPath)
+		if err != nil {
+			return nil, ErrOpenOAMFile(err)
+		}
+		definitionMap := map[string]interface{}{}
+		if err := json.Unmarshal(definition, &definitionMap); err != nil {
+			return nil, ErrOpenOAMFile(err)
+		}
+		schema, err := ioutil.ReadFile(pathSet.jsonSchemaPath)
+		if err != nil {
+			return nil, ErrOpenOAMFile(err)
+		}
+		components = append(components, modelComponent(definitionMap, string(schema)))
+	}
+	return components, nil
+}
+
+// modelComponent converts an OAM workload definition to a component, the
+// Kubernetes kind and API version are taken from the metadata of the
+// generated definitions
+func modelComponent(definition map[string]interface{}, schema string) ModelComponent {
+	name := componentName(definition)
+	c := ModelComponent{
+		Kind:        name,
+		APIVersion:  "core.oam.dev/v1alpha1",
+		DisplayName: displayName(name),
+		Schema:      schema,
+		Metadata:    map[string]interface{}{"oamDefinition": definition},
+	}
+	spec, _ := definition["spec"].(map[string]interface{})
+	metadata, _ := spec["metadata"].(map[string]interface{})
+	if kind, _ := metadata["k8sKind"].(string); kind != "" {
+		c.Kind = kind
+	}
+	if apiVersion, _ := metadata["k8sAPIVersion"].(string); apiVersion != "" {
+		c.APIVersion = apiVersion
+	}
+
+	c.Capabilities = append([]Capability{}, modelCapabilities...)
+	for _, r := range Relationships {
+		if relates(r, c.Kind) {
+			c.Capabilities = append(c.Capabilities, relationshipCapability)
+			break
+		}
+	}
+	return c
+}
+
+// modelRelationships returns the relationships whose from components are
+// among the components
+func modelRelationships(components []ModelComponent) []Relationship {
+	res := []Relationship{}
+	for _, r := range Relationships {
+		for _, c := range components {
+			if relates(r, c.Kind) {
+				res = append(res, r)
+				break
+			}
+		}
+	}
+	return res
+}
+
+func relates(r Relationship, kind string) bool {
+	for _, s := range r.Selectors {
+		for _, from := range s.From {
+			if from == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// displayName splits a kind at its words, CiliumNetworkPolicy is displayed
+// as Cilium Network Policy
+func displayName(kind string) string {
+	var b strings.Builder
+	runes := []rune(kind)
+	for i, r := range runes {
+		upper := r >= 'A' && r <= 'Z'
+		if i > 0 && upper && (runes[i-1] < 'A' || runes[i-1] > 'Z' || i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z') {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,276 @@
+package oam
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/layer5io/meshery-cilium/internal/config"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+const (
+	ociScheme            = "oci://"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	helmChartMediaType   = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	// maxChartBytes bounds the charts pulled, Cilium's is a few hundred KB
+	maxChartBytes = 64 << 20
+)
+
+// ociReference is a chart stored in an OCI registry, the reference is
+// either a tag or a digest
+type ociReference struct {
+	registry   string
+	repository string
+	reference  string
+}
+
+// ociManifest is the part of an OCI image manifest holding the layers
+type ociManifest struct {
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+}
+
+// isOCIReference reports whether url references a chart of an OCI registry
+func isOCIReference(url string) bool {
+	return strings.HasPrefix(url, ociScheme)
+}
+
+// parseOCIReference parses oci://registry/repository/chart:version or
+// oci://registry/repository/chart@sha256:digest. The version is required
+// since the components of a chart reference are generated only once.
+func parseOCIReference(raw string) (ociReference, error) {
+	ref := ociReference{}
+	rest := strings.TrimPrefix(raw, ociScheme)
+	slash := strings.Index(rest, "/")
+	if slash <= 0 {
+		return ref, fmt.Errorf("invalid chart reference %q: the registry and the repository are required", raw)
+	}
+	ref.registry, rest = rest[:slash], rest[slash+1:]
+
+	if at := strings.Index(rest, "@"); at >= 0 {
+		ref.repository, ref.reference = rest[:at], rest[at+1:]
+	} else if colon := strings.LastIndex(rest, ":"); colon >= 0 {
+		// Semantic versions may carry build metadata, the registries only
+		// accept the + of the tags as an underscore
+		ref.repository, ref.reference = rest[:colon], strings.Replace(rest[colon+1:], "+", "_", -1)
+	} else {
+		ref.repository = rest
+	}
+	if ref.repository == "" || ref.reference == "" {
+		return ref, fmt.Errorf("invalid chart reference %q: the chart version is required, e.g. %s:1.2.3", raw, raw)
+	}
+	return ref, nil
+}
+
+// ociPuller pulls from an OCI registry through the distribution API,
+// authenticating with a bearer token or basic authentication
+type ociPuller struct {
+	ref    ociReference
+	auth   config.RegistryAuth
+	scheme string
+	token  string
+}
+
+// fetchOCIChart pulls a chart from an OCI registry and returns its CRDs as
+// a manifest. The chart is only pulled when its digest differs from the one
+// of the cached generation, it reports whether it is unchanged.
+func fetchOCIChart(raw string, auth config.RegistryAuth, cached, entry *cachedComponents) (string, bool, error) {
+	ref, err := parseOCIReference(raw)
+	if err != nil {
+		return "", false, err
+	}
+	p := &ociPuller{ref: ref, auth: auth, scheme: "https"}
+	if auth.PlainHTTP {
+		p.scheme = "http"
+	}
+
+	body, err := p.get("manifests/"+ref.reference, ociManifestMediaType)
+	if err != nil {
+		return "", false, err
+	}
+	manifest := ociManifest{}
+	err = json.NewDecoder(body).Decode(&manifest)
+	body.Close()
+	if err != nil {
+		return "", false, fmt.Errorf("decoding the manifest of %s: %s", raw, err)
+	}
+	digest := ""
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == helmChartMediaType {
+			digest = layer.Digest
+			break
+		}
+	}
+	if digest == "" {
+		return "", false, fmt.Errorf("%s is not a Helm chart: no layer of type %s", raw, helmChartMediaType)
+	}
+	if cached != nil && cached.ChartDigest == digest {
+		return "", true, nil
+	}
+	entry.ChartDigest = digest
+
+	body, err = p.get("blobs/"+digest, "")
+	if err != nil {
+		return "", false, err
+	}
+	defer body.Close()
+	byt, err := ioutil.ReadAll(io.LimitReader(body, maxChartBytes))
+	if err != nil {
+		return "", false, err
+	}
+	sum := sha256.Sum256(byt)
+	if want := "sha256:" + hex.EncodeToString(sum[:]); digest != want {
+		return "", false, fmt.Errorf("the chart of %s doesn't match its digest %s", raw, digest)
+	}
+
+	chart, err := loader.LoadArchive(bytes.NewReader(byt))
+	if err != nil {
+		return "", false, err
+	}
+	return chartCRDs(chart), false, nil
+}
+
+// get requests path of the repository, authenticating once when the
+// registry challenges the request
+func (p *ociPuller) get(path, accept string) (io.ReadCloser, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", p.scheme, p.ref.registry, p.ref.repository, path)
+	resp, err := p.do(u, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && p.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := p.authenticate(challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = p.do(u, accept); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s returned status code %d", u, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (p *ociPuller) do(u, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	switch {
+	case p.token != "":
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	case p.auth.Username != "":
+		req.SetBasicAuth(p.auth.Username, p.auth.Password)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// authenticate answers the challenge of the registry: a bearer token is
+// requested from its token service, anonymously without credentials
+func (p *ociPuller) authenticate(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") {
+		if p.auth.Username == "" {
+			return fmt.Errorf("the registry %s requires credentials, set COMP_GEN_REGISTRY_USERNAME and COMP_GEN_REGISTRY_PASSWORD", p.ref.registry)
+		}
+		return fmt.Errorf("the registry %s rejected the credentials of %s", p.ref.registry, p.auth.Username)
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("the registry %s challenged without a token realm", p.ref.registry)
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", p.ref.repository)
+	}
+	query.Set("scope", scope)
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if p.auth.Username != "" {
+		req.SetBasicAuth(p.auth.Username, p.auth.Password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the token service of %s returned status code %d", p.ref.registry, resp.StatusCode)
+	}
+
+	// Registries return the token in either field
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	p.token = token.Token
+	if p.token == "" {
+		p.token = token.AccessToken
+	}
+	if p.token == "" {
+		return fmt.Errorf("the token service of %s returned no token", p.ref.registry)
+	}
+	return nil
+}
+
+// parseChallenge splits a WWW-Authenticate header, e.g.
+// Bearer realm="https://auth.example.com/token",service="registry"
+func parseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	header = strings.TrimSpace(header)
+	space := strings.Index(header, " ")
+	if space < 0 {
+		return header, params
+	}
+	scheme, rest := header[:space], header[space+1:]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return scheme, params
+}
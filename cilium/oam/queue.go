@@ -0,0 +1,220 @@
+package oam
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/config"
+)
+
+const registrationQueueFile = "registration-queue.json"
+
+// maxQueuedRegistrations bounds the registrations buffered while the
+// Meshery server is unreachable, the oldest ones are dropped first
+const maxQueuedRegistrations = 2000
+
+var (
+	// queueMu serializes the updates of the registration queue, the
+	// components of several versions are registered concurrently
+	queueMu sync.Mutex
+	// replayMu serializes the replays of the queue
+	replayMu sync.Mutex
+)
+
+// queuedRegistration is a registration request which could not reach the
+// Meshery server, replayed once the server is reachable again
+type queuedRegistration struct {
+	// Key identifies the registration, a newer registration of the same
+	// component replaces the queued one
+	Key      string          `json:"key"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Payload  json.RawMessage `json:"payload"`
+	QueuedAt time.Time       `json:"queuedAt"`
+}
+
+// registrationQueuePath is the file holding the queue, a variable so that
+// the tests don't touch the queue of the adapter
+var registrationQueuePath = func() string {
+	return filepath.Join(config.RootPath(), registrationQueueFile)
+}
+
+func loadRegistrationQueue() ([]queuedRegistration, error) {
+	queue := []queuedRegistration{}
+	byt, err := ioutil.ReadFile(registrationQueuePath())
+	if os.IsNotExist(err) {
+		return queue, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(byt, &queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+func saveRegistrationQueue(queue []queuedRegistration) error {
+	byt, err := json.Marshal(queue)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(registrationQueuePath(), byt, 0600)
+}
+
+// registrationKey identifies the component, the deletion or the model a
+// registration request is about
+func registrationKey(method, url string, payload interface{}) string {
+	var id string
+	switch p := payload.(type) {
+	case adapter.OAMRegistrantData:
+		// The components of every version are registered under the same name
+		definition, _ := p.OAMDefinition.(map[string]interface{})
+		id = componentName(definition)
+		spec, _ := definition["spec"].(map[string]interface{})
+		metadata, _ := spec["metadata"].(map[string]interface{})
+		if version, _ := metadata["meshVersion"].(string); version != "" {
+			id += "@" + version
+		}
+	case WorkloadDeletion:
+		id = strings.Join(append([]string{p.Version}, p.Names...), ",")
+	case ModelRegistration:
+		id = p.Model.Name + "@" + p.Model.Version
+	default:
+		byt, _ := json.Marshal(payload)
+		id = digest(string(byt), "")
+	}
+	return strings.Join([]string{method, url, id}, "|")
+}
+
+// enqueue buffers a registration on disk, replacing the queued
+// registration of the same component
+func enqueue(method, url string, payload interface{}) error {
+	byt, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	entry := queuedRegistration{
+		Key:      registrationKey(method, url, payload),
+		Method:   method,
+		URL:      url,
+		Payload:  byt,
+		QueuedAt: time.Now().UTC(),
+	}
+
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	queue, err := loadRegistrationQueue()
+	if err != nil {
+		return err
+	}
+	res := make([]queuedRegistration, 0, len(queue)+1)
+	for _, q := range queue {
+		if q.Key != entry.Key {
+			res = append(res, q)
+		}
+	}
+	res = append(res, entry)
+	if len(res) > maxQueuedRegistrations {
+		res = res[len(res)-maxQueuedRegistrations:]
+	}
+	return saveRegistrationQueue(res)
+}
+
+// queueRegistration queues a registration which failed to reach the
+// Meshery server with err, err is returned when it can't be queued either
+func queueRegistration(method, url string, payload interface{}, err error) error {
+	if qerr := enqueue(method, url, payload); qerr != nil {
+		return ErrRegister(fmt.Errorf("%s, queueing it failed: %s", err, qerr))
+	}
+	return ErrRegistrationQueued
+}
+
+// QueuedRegistrations returns the number of registrations waiting for the
+// Meshery server
+func QueuedRegistrations() int {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	queue, err := loadRegistrationQueue()
+	if err != nil {
+		return 0
+	}
+	return len(queue)
+}
+
+// Replay sends the registrations buffered while the Meshery server was
+// unreachable, in the order they were queued. It stops at the first
+// registration the server can't be reached for, the rest are replayed by
+// the next call. The registrations the server rejects, or which can't be
+// sent at all, are dropped and returned as an error once the others are
+// replayed.
+func (c *Client) Replay() (int, error) {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	// The queue isn't locked while the registrations are sent, so that new
+	// registrations are queued meanwhile
+	queueMu.Lock()
+	queue, err := loadRegistrationQueue()
+	queueMu.Unlock()
+	if err != nil {
+		return 0, ErrRegistrationQueue(err)
+	}
+
+	replayed := 0
+	var rejected []string
+	var sendErr error
+	done := map[string]time.Time{}
+	for _, q := range queue {
+		code, _, err := c.do(q.Method, q.URL, q.Payload)
+		if _, ok := err.(permanentError); ok {
+			done[q.Key] = q.QueuedAt
+			rejected = append(rejected, fmt.Sprintf("%s: %s", q.Key, err))
+			continue
+		}
+		if err != nil {
+			sendErr = ErrRegister(err)
+			break
+		}
+		done[q.Key] = q.QueuedAt
+		if !accepted(code) {
+			rejected = append(rejected, fmt.Sprintf("%s: host returned status code %d", q.Key, code))
+			continue
+		}
+		replayed++
+	}
+
+	// The registrations queued again since are kept
+	if len(done) > 0 {
+		queueMu.Lock()
+		cur, err := loadRegistrationQueue()
+		if err == nil {
+			res := make([]queuedRegistration, 0, len(cur))
+			for _, q := range cur {
+				if at, ok := done[q.Key]; !ok || !at.Equal(q.QueuedAt) {
+					res = append(res, q)
+				}
+			}
+			err = saveRegistrationQueue(res)
+		}
+		queueMu.Unlock()
+		if err != nil {
+			return replayed, ErrRegistrationQueue(err)
+		}
+	}
+
+	if sendErr != nil {
+		return replayed, sendErr
+	}
+	if len(rejected) > 0 {
+		return replayed, ErrRegistrationRejected(fmt.Errorf("queued registrations rejected: %s", strings.Join(rejected, ", ")))
+	}
+	return replayed, nil
+}
@@ -0,0 +1,215 @@
+package oam
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshkit/errors"
+)
+
+const workloadURL = "http://meshery:9081/api/oam/workload"
+
+// workload returns the registration of a component of a Cilium version
+func workload(name, version string) adapter.OAMRegistrantData {
+	return adapter.OAMRegistrantData{
+		OAMDefinition: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name},
+			"spec": map[string]interface{}{
+				"metadata": map[string]interface{}{"meshVersion": version},
+			},
+		},
+	}
+}
+
+// useTempQueue points the registration queue at a temporary file, the
+// returned function restores it
+func useTempQueue(t *testing.T) func() {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "registration-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := registrationQueuePath
+	registrationQueuePath = func() string {
+		return filepath.Join(dir, registrationQueueFile)
+	}
+	return func() {
+		registrationQueuePath = path
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRegistrationKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   interface{}
+		method string
+		same   bool
+	}{
+		{
+			name: "same component and version",
+			a:    workload("CiliumNetworkPolicy", "v1.14.0"),
+			b:    workload("CiliumNetworkPolicy", "v1.14.0"),
+			same: true,
+		},
+		{
+			name: "same component of another version",
+			a:    workload("CiliumNetworkPolicy", "v1.14.0"),
+			b:    workload("CiliumNetworkPolicy", "v1.15.0"),
+		},
+		{
+			name: "another component",
+			a:    workload("CiliumNetworkPolicy", "v1.14.0"),
+			b:    workload("CiliumEndpoint", "v1.14.0"),
+		},
+		{
+			name: "same deletion",
+			a:    WorkloadDeletion{Names: []string{"CiliumEgressNATPolicy"}, Version: "v1.14.0"},
+			b:    WorkloadDeletion{Names: []string{"CiliumEgressNATPolicy"}, Version: "v1.14.0", Host: "cilium:10012"},
+			same: true,
+		},
+		{
+			name: "deletion of other components",
+			a:    WorkloadDeletion{Names: []string{"CiliumEgressNATPolicy"}, Version: "v1.14.0"},
+			b:    WorkloadDeletion{Names: []string{"CiliumNode"}, Version: "v1.14.0"},
+		},
+		{
+			name: "same model version",
+			a:    ModelRegistration{Model: Model{Name: ModelName, Version: "v1.14.0"}},
+			b:    ModelRegistration{Model: Model{Name: ModelName, Version: "v1.14.0", DisplayName: "Cilium"}},
+			same: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := registrationKey(http.MethodPost, workloadURL, tt.a)
+			b := registrationKey(http.MethodPost, workloadURL, tt.b)
+			if (a == b) != tt.same {
+				t.Errorf("registrationKey() = %q and %q, want same %t", a, b, tt.same)
+			}
+		})
+	}
+
+	post := registrationKey(http.MethodPost, workloadURL, workload("CiliumNode", "v1.14.0"))
+	del := registrationKey(http.MethodDelete, workloadURL, workload("CiliumNode", "v1.14.0"))
+	if post == del {
+		t.Errorf("registrationKey() is %q for both methods", post)
+	}
+}
+
+func TestEnqueueReplacesTheQueuedRegistration(t *testing.T) {
+	defer useTempQueue(t)()
+
+	registrations := []adapter.OAMRegistrantData{
+		workload("CiliumNetworkPolicy", "v1.14.0"),
+		workload("CiliumEndpoint", "v1.14.0"),
+		workload("CiliumNetworkPolicy", "v1.14.0"),
+		workload("CiliumNetworkPolicy", "v1.15.0"),
+	}
+	for _, r := range registrations {
+		if err := enqueue(http.MethodPost, workloadURL, r); err != nil {
+			t.Fatalf("enqueue() error = %s", err)
+		}
+	}
+
+	queue, err := loadRegistrationQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		registrationKey(http.MethodPost, workloadURL, registrations[1]),
+		registrationKey(http.MethodPost, workloadURL, registrations[2]),
+		registrationKey(http.MethodPost, workloadURL, registrations[3]),
+	}
+	if len(queue) != len(want) {
+		t.Fatalf("queued %d registrations, want %d", len(queue), len(want))
+	}
+	for i, q := range queue {
+		if q.Key != want[i] {
+			t.Errorf("queue[%d] = %q, want %q", i, q.Key, want[i])
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	defer useTempQueue(t)()
+
+	// The server accepts the components and rejects the deletions
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Method)
+		mu.Unlock()
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	url := server.URL + "/api/oam/workload"
+	queued := []struct {
+		method  string
+		payload interface{}
+	}{
+		{http.MethodPost, workload("CiliumNetworkPolicy", "v1.14.0")},
+		{http.MethodDelete, WorkloadDeletion{Names: []string{"CiliumEgressNATPolicy"}, Version: "v1.14.0"}},
+		{http.MethodPost, workload("CiliumEndpoint", "v1.14.0")},
+	}
+	for _, q := range queued {
+		if err := enqueue(q.method, url, q.payload); err != nil {
+			t.Fatalf("enqueue() error = %s", err)
+		}
+	}
+
+	c := &Client{httpClient: server.Client(), retryTimeout: time.Second}
+	replayed, err := c.Replay()
+	if replayed != 2 {
+		t.Errorf("Replay() replayed %d registrations, want 2", replayed)
+	}
+	if e, ok := errors.Is(err); !ok || e.Code != ErrRegistrationRejectedCode {
+		t.Errorf("Replay() error = %v, want the rejected deletion", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{http.MethodPost, http.MethodDelete, http.MethodPost}; !reflect.DeepEqual(received, want) {
+		t.Errorf("Replay() sent %v, want %v in the order they were queued", received, want)
+	}
+	if n := QueuedRegistrations(); n != 0 {
+		t.Errorf("%d registrations left queued, want the rejected one dropped as well", n)
+	}
+}
+
+func TestReplayKeepsTheQueueWhileTheServerIsUnreachable(t *testing.T) {
+	defer useTempQueue(t)()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL + "/api/oam/workload"
+	server.Close()
+
+	for _, name := range []string{"CiliumNetworkPolicy", "CiliumEndpoint"} {
+		if err := enqueue(http.MethodPost, url, workload(name, "v1.14.0")); err != nil {
+			t.Fatalf("enqueue() error = %s", err)
+		}
+	}
+
+	c := &Client{httpClient: &http.Client{Timeout: time.Second}, retryTimeout: time.Second}
+	replayed, err := c.Replay()
+	if replayed != 0 || err == nil {
+		t.Errorf("Replay() = %d, %v, want nothing replayed and an error", replayed, err)
+	}
+	if n := QueuedRegistrations(); n != 2 {
+		t.Errorf("%d registrations left queued, want 2", n)
+	}
+}
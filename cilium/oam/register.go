@@ -1,16 +1,46 @@
 package oam
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshkit/utils/manifests"
+	smp "github.com/layer5io/service-mesh-performance/spec"
 )
 
 var (
+	// GatewayAPIKinds are the Gateway API resources implemented by Cilium
+	GatewayAPIKinds = []string{"GatewayClass", "Gateway", "HTTPRoute"}
+
+	// EgressGatewayKinds are the egress gateway resources of Cilium
+	EgressGatewayKinds = []string{"CiliumEgressGatewayPolicy"}
+
+	// ClusterwidePolicyKinds are the clusterwide policy resources of Cilium
+	ClusterwidePolicyKinds = []string{"CiliumClusterwideNetworkPolicy"}
+
+	// LocalRedirectPolicyKinds are the local redirect policy resources of
+	// Cilium, redirecting the traffic of a frontend to node-local pods
+	LocalRedirectPolicyKinds = []string{"CiliumLocalRedirectPolicy"}
+
+	// EnvoyConfigKinds are the Envoy configuration resources of the
+	// sidecar-free service mesh of Cilium
+	EnvoyConfigKinds = []string{"CiliumEnvoyConfig", "CiliumClusterwideEnvoyConfig"}
+
+	// BGPKinds are the BGP control plane resources of Cilium
+	BGPKinds = []string{"CiliumBGPPeeringPolicy", "CiliumBGPClusterConfig"}
+
+	// TetragonKinds are the Tetragon runtime security policy resources
+	TetragonKinds = []string{"TracingPolicy"}
+
 	basePath, _  = os.Getwd()
 	workloadPath = filepath.Join(basePath, "templates", "oam", "workloads")
 	traitPath    = filepath.Join(basePath, "templates", "oam", "traits")
@@ -26,12 +56,12 @@ type schemaDefinitionPathSet struct {
 // present in the path oam/workloads
 //
 // Registration process will send POST request to $runtime/api/oam/workload
-func RegisterWorkloads(runtime, host string) error {
+func RegisterWorkloads(client *Client, runtime, host string) error {
 	oamRDP := []adapter.OAMRegistrantDefinitionPath{}
 
 	pathSets, err := load(workloadPath)
 	if err != nil {
-		return err
+		return ErrOpenOAMFile(err)
 	}
 
 	for _, pathSet := range pathSets {
@@ -51,21 +81,19 @@ func RegisterWorkloads(runtime, host string) error {
 		})
 	}
 
-	return adapter.
-		NewOAMRegistrant(oamRDP, fmt.Sprintf("%s/api/oam/workload", runtime)).
-		Register()
+	return client.register(oamRDP, fmt.Sprintf("%s/api/oam/workload", runtime))
 }
 
 // RegisterTraits will register all of the trait definitions
 // present in the path oam/traits
 //
 // Registeration process will send POST request to $runtime/api/oam/trait
-func RegisterTraits(runtime, host string) error {
+func RegisterTraits(client *Client, runtime, host string) error {
 	oamRDP := []adapter.OAMRegistrantDefinitionPath{}
 
 	pathSets, err := load(traitPath)
 	if err != nil {
-		return err
+		return ErrOpenOAMFile(err)
 	}
 
 	for _, pathSet := range pathSets {
@@ -81,9 +109,293 @@ func RegisterTraits(runtime, host string) error {
 		})
 	}
 
-	return adapter.
-		NewOAMRegistrant(oamRDP, fmt.Sprintf("%s/api/oam/trait", runtime)).
-		Register()
+	return client.register(oamRDP, fmt.Sprintf("%s/api/oam/trait", runtime))
+}
+
+// RegisterWorkloadsDynamically generates the workload definitions from the
+// manifests or the helm chart described by dc and registers them
+//
+// Registration process will send POST request to $runtime/api/oam/workload
+func RegisterWorkloadsDynamically(client *Client, runtime, host string, dc *adapter.DynamicComponentsConfig) error {
+	gen, err := generateComponents(dc, client.generationWorkers(), client.registryAuth())
+	if err != nil {
+		return ErrGenerateComponents(err)
+	}
+	comp := gen.component
+	if len(comp.Definitions) == 0 {
+		if len(gen.failures) > 0 {
+			return ErrGenerateComponent(gen.failureStrings())
+		}
+		return ErrGenerateComponents(errors.New("no components generated"))
+	}
+
+	metadata := map[string]string{
+		config.OAMAdapterNameMetadataKey: dc.Operation,
+	}
+
+	// Only the components which changed since the last successful
+	// publish are sent, along with the names of the removed ones
+	registry := fmt.Sprintf("%s/api/oam/workload", runtime)
+	// Generations from another source, restricted to specific kinds or for
+	// another version are tracked separately so that they don't mark the
+	// components of the other sets as removed
+	set := strings.Join([]string{registry, host, dc.URL, dc.Config.MeshVersion, strings.Join(dc.Config.Filter.OnlyRes, ",")}, "|")
+	prev, err := publishedSet(set)
+	if err != nil {
+		return ErrGenerateComponents(err)
+	}
+
+	definitions := map[string]map[string]interface{}{}
+	schemas := map[string]string{}
+	cur := map[string]string{}
+	for i, def := range comp.Definitions {
+		definitionMap := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(def), &definitionMap); err != nil {
+			return ErrGenerateComponents(err)
+		}
+		definitionMap["apiVersion"] = "core.oam.dev/v1alpha1"
+		definitionMap["kind"] = "WorkloadDefinition"
+
+		name := componentName(definitionMap)
+		definitions[name] = definitionMap
+		schemas[name] = comp.Schemas[i]
+		cur[name] = digest(def, comp.Schemas[i])
+	}
+
+	// The components which failed to generate stay as last published
+	for _, f := range gen.failures {
+		if d, ok := prev[f.Kind]; ok {
+			cur[f.Kind] = d
+		}
+	}
+
+	// The components whose schema is too large are left out, they are
+	// published again by the next registration
+	limits := client.schemaLimits()
+	var oversized []string
+	queued := false
+	changed, removed := diffComponents(prev, cur)
+	for _, name := range changed {
+		schema, size := limitSchema(limits, name, schemas[name])
+		if size != nil {
+			oversized = append(oversized, size.String())
+			if d, ok := prev[name]; ok {
+				cur[name] = d
+			} else {
+				delete(cur, name)
+			}
+			continue
+		}
+		err := client.post(registry, adapter.OAMRegistrantData{
+			OAMDefinition: definitions[name],
+			OAMRefSchema:  schema,
+			Host:          host,
+			Metadata:      metadata,
+		})
+		// The queued components count as published, the queue delivers them
+		if err == ErrRegistrationQueued {
+			queued = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The Meshery servers without the deletion endpoint keep the removed
+	// components, they are still recorded as removed so that the deletion
+	// isn't sent again by every registration
+	deletionUnsupported := false
+	if len(removed) > 0 {
+		deletion := WorkloadDeletion{
+			Names:    removed,
+			Version:  dc.Config.MeshVersion,
+			Host:     host,
+			Metadata: metadata,
+		}
+		code, _, err := client.deliver(http.MethodDelete, registry, deletion)
+		_, permanent := err.(permanentError)
+		switch {
+		case permanent:
+			return ErrRegistrationRejected(err)
+		case err != nil:
+			if err := queueRegistration(http.MethodDelete, registry, deletion, err); err != ErrRegistrationQueued {
+				return err
+			}
+			queued = true
+		case unsupported(code):
+			deletionUnsupported = true
+		case unauthorized(code):
+			return ErrUnauthorized(code)
+		case !accepted(code) && code != http.StatusNoContent:
+			return ErrRegistrationRejected(fmt.Errorf("host returned status code %d", code))
+		}
+	}
+
+	if err := recordPublished(set, cur); err != nil {
+		return ErrGenerateComponents(err)
+	}
+
+	if len(oversized) > 0 {
+		return ErrSchemaLimit(oversized)
+	}
+	if len(gen.failures) > 0 {
+		return ErrGenerateComponent(gen.failureStrings())
+	}
+	if queued {
+		return ErrRegistrationQueued
+	}
+	if deletionUnsupported {
+		return ErrWorkloadDeletionUnsupported
+	}
+	return nil
+}
+
+// RegisterGatewayAPIWorkloads generates and registers the workload definitions
+// for the Gateway API resources implemented by Cilium from the Gateway API
+// CRDs found at url
+func RegisterGatewayAPIWorkloads(client *Client, runtime, host, url, version string) error {
+	return registerCRDWorkloads(client, runtime, host, url, version, GatewayAPIKinds)
+}
+
+// RegisterEgressGatewayWorkloads generates and registers the workload
+// definitions for the egress gateway policies from the CRD found at url
+func RegisterEgressGatewayWorkloads(client *Client, runtime, host, url, version string) error {
+	return registerCRDWorkloads(client, runtime, host, url, version, EgressGatewayKinds)
+}
+
+// RegisterClusterwidePolicyWorkloads generates and registers the workload
+// definition of the Cilium clusterwide network policies from the CRD found
+// at url
+func RegisterClusterwidePolicyWorkloads(client *Client, runtime, host, url, version string) error {
+	return registerCRDWorkloads(client, runtime, host, url, version, ClusterwidePolicyKinds)
+}
+
+// RegisterLocalRedirectPolicyWorkloads generates and registers the workload
+// definition of the Cilium local redirect policies from the CRD found at url
+func RegisterLocalRedirectPolicyWorkloads(client *Client, runtime, host, url, version string) error {
+	return registerCRDWorkloads(client, runtime, host, url, version, LocalRedirectPolicyKinds)
+}
+
+// RegisterEnvoyConfigWorkloads generates and registers the workload
+// definitions for the Envoy configurations from the CRDs found at the comma
+// separated urls, Cilium keeps each CRD in its own file
+func RegisterEnvoyConfigWorkloads(client *Client, runtime, host, urls, version string) error {
+	return registerCRDWorkloadsFrom(client, runtime, host, urls, version, EnvoyConfigKinds)
+}
+
+// RegisterBGPWorkloads generates and registers the workload definitions for
+// the BGP control plane resources from the CRDs found at the comma
+// separated urls
+func RegisterBGPWorkloads(client *Client, runtime, host, urls, version string) error {
+	return registerCRDWorkloadsFrom(client, runtime, host, urls, version, BGPKinds)
+}
+
+// RegisterTetragonWorkloads generates and registers the workload definitions
+// for the Tetragon runtime security policies from the Tetragon CRDs found at url
+func RegisterTetragonWorkloads(client *Client, runtime, host, url, version string) error {
+	return registerCRDWorkloads(client, runtime, host, url, version, TetragonKinds)
+}
+
+// ciliumSourceVersion matches the Cilium release of a file of the Cilium
+// repository, e.g. https://raw.githubusercontent.com/cilium/cilium/v1.16.0/...
+var ciliumSourceVersion = regexp.MustCompile(`/cilium/cilium/(v\d+\.\d+\.\d+[^/]*)/`)
+
+// registerCRDWorkloadsFrom registers the workload definitions generated
+// from the CRDs found at the comma separated urls. The CRDs of a Cilium
+// release are registered under its version, the others under version.
+func registerCRDWorkloadsFrom(client *Client, runtime, host, urls, version string, kinds []string) error {
+	for _, url := range strings.Split(urls, ",") {
+		url = strings.TrimSpace(url)
+		v := version
+		if m := ciliumSourceVersion.FindStringSubmatch(url); m != nil {
+			v = m[1]
+		}
+		if err := registerCRDWorkloads(client, runtime, host, url, v, kinds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerCRDWorkloads registers the workload definitions generated from
+// the CRDs found at url, restricted to the given kinds
+func registerCRDWorkloads(client *Client, runtime, host, url, version string, kinds []string) error {
+	return RegisterWorkloadsDynamically(client, runtime, host, &adapter.DynamicComponentsConfig{
+		TimeoutInMinutes: client.generationTimeout(),
+		URL:              url,
+		GenerationMethod: adapter.Manifests,
+		Config: manifests.Config{
+			Name:        smp.ServiceMesh_Type_name[int32(smp.ServiceMesh_CILIUM_SERVICE_MESH)],
+			MeshVersion: version,
+			Filter: manifests.CrdFilter{
+				RootFilter:    []string{"$[?(@.kind==\"CustomResourceDefinition\")]"},
+				NameFilter:    []string{"$..[\"spec\"][\"names\"][\"kind\"]"},
+				VersionFilter: []string{"$[0]..spec.versions[0]"},
+				GroupFilter:   []string{"$[0]..spec"},
+				SpecFilter:    []string{"$[0]..openAPIV3Schema.properties.spec"},
+				ItrFilter:     []string{"$[?(@.spec.names.kind"},
+				ItrSpecFilter: []string{"$[?(@.spec.names.kind"},
+				VField:        "name",
+				GField:        "group",
+				OnlyRes:       kinds,
+			},
+		},
+		Operation: config.CiliumOperation,
+	})
+}
+
+// register reads the definitions and schemas present in the given paths
+// and sends them to the registry
+func (c *Client) register(paths []adapter.OAMRegistrantDefinitionPath, registry string) error {
+	limits := c.schemaLimits()
+	var oversized []string
+	queued := false
+	for _, dpath := range paths {
+		definition, err := ioutil.ReadFile(dpath.OAMDefintionPath)
+		if err != nil {
+			return ErrOpenOAMFile(err)
+		}
+
+		definitionMap := map[string]interface{}{}
+		if err := json.Unmarshal(definition, &definitionMap); err != nil {
+			return ErrOpenOAMFile(err)
+		}
+
+		schema, err := ioutil.ReadFile(dpath.OAMRefSchemaPath)
+		if err != nil {
+			return ErrOpenOAMFile(err)
+		}
+
+		limited, size := limitSchema(limits, componentName(definitionMap), string(schema))
+		if size != nil {
+			oversized = append(oversized, size.String())
+			continue
+		}
+
+		err = c.post(registry, adapter.OAMRegistrantData{
+			OAMDefinition: definitionMap,
+			OAMRefSchema:  limited,
+			Host:          dpath.Host,
+			Restricted:    dpath.Restricted,
+			Metadata:      dpath.Metadata,
+		})
+		if err == ErrRegistrationQueued {
+			queued = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(oversized) > 0 {
+		return ErrSchemaLimit(oversized)
+	}
+	if queued {
+		return ErrRegistrationQueued
+	}
+	return nil
 }
 
 func load(basePath string) ([]schemaDefinitionPathSet, error) {
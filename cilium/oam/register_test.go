@@ -0,0 +1,121 @@
+package oam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshkit/utils/manifests"
+)
+
+const crdTemplate = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: %s
+spec:
+  group: cilium.io
+  names:
+    kind: %s
+  versions:
+  - name: v2
+    schema:
+      openAPIV3Schema:
+        properties:
+          spec:
+            type: object
+`
+
+// useTempState points the published components and the component cache at
+// a temporary directory, the returned function restores them
+func useTempState(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "oam-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, cache := publishedComponentsPath, cachePath
+	publishedComponentsPath = func() string {
+		return filepath.Join(dir, publishedComponentsFile)
+	}
+	cachePath = func(key string) string {
+		return filepath.Join(dir, componentCacheDir, key+".json")
+	}
+	return dir, func() {
+		publishedComponentsPath, cachePath = published, cache
+		os.RemoveAll(dir)
+	}
+}
+
+// writeCRDs writes a manifest holding the CRDs of kinds to path
+func writeCRDs(t *testing.T, path string, kinds ...string) {
+	t.Helper()
+	manifest := ""
+	for _, kind := range kinds {
+		manifest += "---\n" + fmt.Sprintf(crdTemplate, strings.ToLower(kind)+"s.cilium.io", kind)
+	}
+	if err := ioutil.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterWorkloadsDynamicallyWithoutDeletion(t *testing.T) {
+	dir, restore := useTempState(t)
+	defer restore()
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method]++
+		mu.Unlock()
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	count := func(method string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[method]
+	}
+
+	source := filepath.Join(dir, "crds.yaml")
+	dc := &adapter.DynamicComponentsConfig{
+		TimeoutInMinutes: 1,
+		URL:              source,
+		GenerationMethod: adapter.Manifests,
+		Config:           manifests.Config{Name: "CILIUM_SERVICE_MESH", MeshVersion: "v1.14.0"},
+	}
+	c := &Client{httpClient: server.Client()}
+
+	writeCRDs(t, source, "CiliumNetworkPolicy", "CiliumEgressNATPolicy")
+	if err := RegisterWorkloadsDynamically(c, server.URL, "cilium:10012", dc); err != nil {
+		t.Fatalf("RegisterWorkloadsDynamically() error = %s", err)
+	}
+	if count(http.MethodPost) != 2 {
+		t.Fatalf("posted %d components, want 2", count(http.MethodPost))
+	}
+
+	writeCRDs(t, source, "CiliumNetworkPolicy")
+	if err := RegisterWorkloadsDynamically(c, server.URL, "cilium:10012", dc); err != ErrWorkloadDeletionUnsupported {
+		t.Fatalf("RegisterWorkloadsDynamically() error = %v, want ErrWorkloadDeletionUnsupported", err)
+	}
+	if err := RegisterWorkloadsDynamically(c, server.URL, "cilium:10012", dc); err != nil {
+		t.Fatalf("RegisterWorkloadsDynamically() error = %s", err)
+	}
+	if count(http.MethodDelete) != 1 {
+		t.Errorf("sent %d deletions, want 1", count(http.MethodDelete))
+	}
+	if count(http.MethodPost) != 2 {
+		t.Errorf("posted %d components, want the 2 of the first registration", count(http.MethodPost))
+	}
+}
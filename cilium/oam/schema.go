@@ -0,0 +1,67 @@
+package oam
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/layer5io/meshery-cilium/internal/config"
+)
+
+// schemaSize is the accounting of the schema of a component
+type schemaSize struct {
+	component string
+	original  int
+	pruned    int
+	limit     int
+}
+
+func (s schemaSize) String() string {
+	if s.pruned != s.original {
+		return fmt.Sprintf("%s: %d bytes once pruned (%d before), the limit is %d", s.component, s.pruned, s.original, s.limit)
+	}
+	return fmt.Sprintf("%s: %d bytes, the limit is %d", s.component, s.original, s.limit)
+}
+
+// limitSchema prunes the description fields longer than the limit from
+// the schema of component and checks that it fits the size limit
+func limitSchema(limits config.SchemaLimits, component, schema string) (string, *schemaSize) {
+	size := schemaSize{component: component, original: len(schema), pruned: len(schema), limit: limits.MaxBytes}
+
+	if limits.MaxDescriptionBytes > 0 && len(schema) > limits.MaxDescriptionBytes {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(schema), &doc); err == nil && pruneDescriptions(doc, limits.MaxDescriptionBytes) {
+			if byt, err := json.Marshal(doc); err == nil {
+				schema = string(byt)
+				size.pruned = len(schema)
+			}
+		}
+	}
+
+	if limits.MaxBytes > 0 && size.pruned > limits.MaxBytes {
+		return schema, &size
+	}
+	return schema, nil
+}
+
+// pruneDescriptions removes the string descriptions longer than max from
+// doc, and reports whether any was removed. A property named description
+// is an object and is kept.
+func pruneDescriptions(doc interface{}, max int) bool {
+	pruned := false
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if desc, ok := val.(string); ok && key == "description" && len(desc) > max {
+				delete(v, key)
+				pruned = true
+				continue
+			}
+			pruned = pruneDescriptions(val, max) || pruned
+		}
+	case []interface{}:
+		for _, val := range v {
+			pruned = pruneDescriptions(val, max) || pruned
+		}
+	}
+	return pruned
+}
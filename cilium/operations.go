@@ -2,12 +2,16 @@ package cilium
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/common"
 	"github.com/layer5io/meshery-adapter-library/status"
 	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshery-cilium/internal/metrics"
 )
 
 // ApplyOperation function contains the operation handlers
@@ -24,65 +28,503 @@ func (h *Handler) ApplyOperation(ctx context.Context, request adapter.OperationR
 		Details:     "Operation is not supported",
 	}
 
-	//deployment
+	op, ok := operations[request.OperationName]
+	if !ok {
+		h.StreamErr(e, ErrOpInvalid)
+		return nil
+	}
+
+	// Meshery gave up on the request before the operation started
+	if ctx.Err() != nil {
+		err := ErrOperationCancelled(request.OperationName, "the request was cancelled by Meshery")
+		e.Summary = fmt.Sprintf("Operation %s cancelled", request.OperationName)
+		e.Details = err.Error()
+		h.StreamErr(e, err)
+		return nil
+	}
+
+	// Operations run against the cluster of the context they target
+	target, err := h.forContext(requestContext(request.CustomBody))
+	if err != nil {
+		e.Details = err.Error()
+		h.StreamErr(e, err)
+		return nil
+	}
+
+	if op.AdditionalProperties[internalconfig.OperationType] == internalconfig.PipelineOperationType {
+		target.goOperation(func() { target.runPipeline(request, operations, e) })
+		return nil
+	}
+
+	target.goOperation(func() {
+		start := time.Now()
+		// The final event refers to the resources the operation applied
+		notes := &eventNotes{}
+		summary, details, err := target.runOperation(target.lifecycle.ctx, request, operations[request.OperationName], notes)
+		metrics.ObserveOperation(request.OperationName, start, err)
+		target.emit(notes.event(request.OperationID, summary, eventDetails(details), err))
+	})
+	return nil
+}
+
+// RunOperation runs an operation to completion and returns the summary and
+// details of its result, its progress is streamed as events. It is the
+// synchronous counterpart of ApplyOperation for the integration tests.
+func (h *Handler) RunOperation(request adapter.OperationRequest) (string, string, error) {
+	operations := make(adapter.Operations)
+	if err := h.Config.GetObject(adapter.OperationsKey, &operations); err != nil {
+		return "", "", err
+	}
+	op, ok := operations[request.OperationName]
+	if !ok {
+		return status.Deploying, "Operation is not supported", ErrOpInvalid
+	}
+	target, err := h.forContext(requestContext(request.CustomBody))
+	if err != nil {
+		return status.Deploying, err.Error(), err
+	}
+	return target.runOperation(target.lifecycle.ctx, request, op, nil)
+}
+
+// runOperation runs a single operation to completion under parent and
+// returns the summary and details of its result, the resources it applied
+// and the hints to remediate its failure are noted in notes unless nil
+func (h *Handler) runOperation(parent context.Context, request adapter.OperationRequest, op *adapter.Operation, notes *eventNotes) (summary string, details string, err error) {
+	// The operation is cancelled on shutdown, on request or once its
+	// timeout elapses, the work done with ctx stops then
+	ctx, run, done := h.startOperation(parent, request)
+	defer done()
+	var timeout time.Duration
+	defer func() {
+		if err == nil {
+			return
+		}
+		if interrupted := h.interruption(ctx, run, timeout); interrupted != nil {
+			summary, details, err = fmt.Sprintf("Operation %s interrupted", request.OperationName), interrupted.Error(), interrupted
+		}
+	}()
+
+	// The operations of the adapter are fenced first, so that a queued
+	// operation doesn't hold the lock shared with the other adapters
+	if internalconfig.Mutating(op) {
+		release, fenceErr := h.fenceOperation(ctx, request)
+		if fenceErr != nil {
+			return fmt.Sprintf("Error while waiting to run %s", request.OperationName), fenceErr.Error(), fenceErr
+		}
+		defer release()
+	}
+	if op.AdditionalProperties[internalconfig.Disruptive] == "true" {
+		release, lockErr := h.coordinate(ctx, request)
+		if lockErr != nil {
+			return fmt.Sprintf("Error while waiting to run %s", request.OperationName), lockErr.Error(), lockErr
+		}
+		defer func() { release(err) }()
+	}
+
+	// The timeout only runs once the operation is no longer queued
+	timeout, err = h.operationTimeout(request.OperationName, op)
+	if err != nil {
+		return fmt.Sprintf("Error while loading the timeout of %s", request.OperationName), err.Error(), err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Resources created by the operation are labeled with the Meshery
+	// environment it runs in and as deployed by the adapter
+	ctx = withEnvironment(ctx, ownershipLabels(request, op))
+	ctx = withProgress(ctx, h.streamProgress(request.OperationID))
+	if notes != nil {
+		ctx = withEventNotes(ctx, notes)
+	}
+
+	// The manifests applied by the mutating operations are exported once
+	// they succeed, while the cluster is still fenced
+	if internalconfig.Mutating(op) && h.GitOps != nil {
+		var rendered *renderedManifests
+		ctx, rendered = withRendered(ctx)
+		defer func() {
+			if err == nil {
+				h.exportGitOps(ctx, request, rendered)
+			}
+		}()
+	}
+
 	switch request.OperationName {
 	case internalconfig.CiliumOperation:
-		go func(hh *Handler, ee *adapter.Event) {
-			version := string(operations[request.OperationName].Versions[0])
-			stat, err := hh.installCilium(request.IsDeleteOperation, version, request.Namespace)
-			if err != nil {
-				e.Summary = fmt.Sprintf("Error while %s Cilium service mesh", stat)
-				e.Details = err.Error()
-				hh.StreamErr(e, err)
-				return
-			}
-			ee.Summary = fmt.Sprintf("Cilium service mesh %s successfully", stat)
-			ee.Details = fmt.Sprintf("Cilium service mesh is now %s.", stat)
-			hh.StreamInfo(e)
-		}(h, e)
+		version := string(op.Versions[0])
+		purge := parsePurgeRequest(request.CustomBody)
+		if request.IsDeleteOperation && purge.Purge {
+			return h.purgeCilium(ctx, request, version, purge)
+		}
+		install, err := parseInstallRequest(request.CustomBody)
+		if err != nil {
+			return "Error while parsing the install request", err.Error(), err
+		}
+		stat, err := h.installCilium(ctx, request.IsDeleteOperation, version, request.Namespace, install)
+		if err != nil {
+			return fmt.Sprintf("Error while %s Cilium service mesh", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium service mesh %s successfully", stat), fmt.Sprintf("Cilium service mesh is now %s.", stat), nil
 	case
 		common.BookInfoOperation,
 		common.HTTPBinOperation,
 		common.ImageHubOperation,
 		common.EmojiVotoOperation:
-		go func(hh *Handler, ee *adapter.Event) {
-			appName := operations[request.OperationName].AdditionalProperties[common.ServiceName]
-			stat, err := hh.installSampleApp(request.IsDeleteOperation, request.Namespace, operations[request.OperationName].Templates)
-			if err != nil {
-				e.Summary = fmt.Sprintf("Error while %s %s application", stat, appName)
-				e.Details = err.Error()
-				hh.StreamErr(e, err)
-				return
-			}
-			ee.Summary = fmt.Sprintf("%s application %s successfully", appName, stat)
-			ee.Details = fmt.Sprintf("The %s application is now %s.", appName, stat)
-			hh.StreamInfo(e)
-		}(h, e)
+		appName := op.AdditionalProperties[common.ServiceName]
+		stat, err := h.installSampleApp(ctx, request.IsDeleteOperation, request.Namespace, op.Templates)
+		if err != nil {
+			return fmt.Sprintf("Error while %s %s application", stat, appName), err.Error(), err
+		}
+		return fmt.Sprintf("%s application %s successfully", appName, stat), fmt.Sprintf("The %s application is now %s.", appName, stat), nil
 	case common.SmiConformanceOperation:
-		go func(hh *Handler, ee *adapter.Event) {
-			name := operations[request.OperationName].Description
-			_, err := hh.RunSMITest(adapter.SMITestOptions{
-				Ctx:         context.TODO(),
-				OperationID: ee.Operationid,
-				Manifest:    string(operations[request.OperationName].Templates[0]),
-				Namespace:   "meshery",
-				Labels: map[string]string{
-					"cilium.io/monitored-by": "cilium",
-				},
-				Annotations: make(map[string]string),
-			})
-			if err != nil {
-				e.Summary = fmt.Sprintf("Error while %s %s test", status.Running, name)
-				e.Details = err.Error()
-				hh.StreamErr(e, err)
-				return
+		name := op.Description
+		_, err := h.RunSMITest(adapter.SMITestOptions{
+			Ctx:         ctx,
+			OperationID: request.OperationID,
+			Manifest:    string(op.Templates[0]),
+			Namespace:   "meshery",
+			Labels: map[string]string{
+				"cilium.io/monitored-by": "cilium",
+			},
+			Annotations: make(map[string]string),
+		})
+		if err != nil {
+			return fmt.Sprintf("Error while %s %s test", status.Running, name), err.Error(), err
+		}
+		return fmt.Sprintf("%s test %s successfully", name, status.Completed), "", nil
+	case common.CustomOperation:
+		stat, report, err := h.applyCustomManifest(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "manifest-report.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s the custom manifest", stat), details, err
+		}
+		return fmt.Sprintf("Custom manifest %s successfully, %d resources", stat, len(report.Resources)), details, nil
+	case internalconfig.CiliumSecurityReportOperation:
+		report, err := h.securityReport(ctx)
+		if err != nil {
+			return "Error while generating ServiceAccount security report", err.Error(), err
+		}
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "security-report.json", []byte(details))
+		for _, sa := range report.ServiceAccounts {
+			if len(sa.SuggestedManifests) == 0 {
+				continue
 			}
-			ee.Summary = fmt.Sprintf("%s test %s successfully", name, status.Completed)
-			ee.Details = ""
-			hh.StreamInfo(e)
-		}(h, e)
-	default:
-		h.StreamErr(e, ErrOpInvalid)
+			name := fmt.Sprintf("%s-%s-rbac.yaml", sa.Namespace, sa.Name)
+			h.attachArtifact(request.OperationID, name, []byte(strings.Join(sa.SuggestedManifests, "---\n")))
+		}
+		return "ServiceAccount security report generated successfully", details, nil
+	case internalconfig.CiliumWireguardEncryptionOperation, internalconfig.CiliumIPsecEncryptionOperation:
+		mode := op.AdditionalProperties[internalconfig.EncryptionType]
+		stat, rollout, err := h.configureEncryption(ctx, request.IsDeleteOperation, mode)
+		if err != nil {
+			return fmt.Sprintf("Error while %s %s encryption", stat, mode), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium %s encryption %s successfully", mode, stat), fmt.Sprintf("Cilium %s encryption %s, %s.", mode, stat, rollout), nil
+	case internalconfig.CiliumKubeProxyReplacementOperation:
+		stat, rollout, err := h.configureKubeProxyReplacement(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s kube-proxy replacement", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium kube-proxy replacement %s successfully", stat), fmt.Sprintf("Kube-proxy replacement %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumEgressGatewayOperation:
+		stat, rollout, err := h.configureEgressGateway(ctx, request.IsDeleteOperation)
+		if err != nil {
+			return fmt.Sprintf("Error while %s egress gateway", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium egress gateway %s successfully", stat), fmt.Sprintf("Cilium egress gateway %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumEgressIPReportOperation:
+		report, err := h.egressIPReport(ctx)
+		if err != nil {
+			return "Error while generating egress IP report", err.Error(), err
+		}
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "egress-ip-report.json", []byte(details))
+		return "Egress IP report generated successfully", details, nil
+	case internalconfig.CiliumTrafficMirrorOperation:
+		stat, details, err := h.mirrorTraffic(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s traffic mirror", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Traffic mirror %s successfully", stat), details, nil
+	case internalconfig.CiliumPolicyTestOperation:
+		stat, report, err := h.runPolicyTests(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "policy-test-report.json", []byte(details))
+		if err != nil {
+			return "Error while running policy tests", details, err
+		}
+		return fmt.Sprintf("Policy tests %s successfully", stat), details, nil
+	case internalconfig.CiliumSelfTestOperation:
+		stat, report, err := h.selfTest(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "self-test-report.json", []byte(details))
+		if err != nil {
+			return "Self-test failed", details, err
+		}
+		return fmt.Sprintf("Self-test %s successfully", stat), details, nil
+	case internalconfig.CiliumGrafanaDashboardsOperation:
+		stat, report, err := h.installDashboards(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "grafana-dashboards.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s Grafana dashboards", stat), details, err
+		}
+		return fmt.Sprintf("Grafana dashboards %s successfully", stat), details, nil
+	case internalconfig.CiliumHubbleUIOperation:
+		stat, details, err := h.exposeHubbleUI(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s Hubble UI exposure", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Hubble UI exposure %s successfully", stat), details, nil
+	case internalconfig.CiliumHubbleRelayOperation:
+		stat, endpoint, err := h.configureHubbleRelay(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s Hubble Relay", stat), err.Error(), err
+		}
+		if endpoint == nil {
+			return fmt.Sprintf("Hubble Relay %s successfully", stat), "Hubble Relay is disabled.", nil
+		}
+		details := reportDetails(endpoint)
+		h.attachArtifact(request.OperationID, "hubble-relay.json", []byte(details))
+		return fmt.Sprintf("Hubble Relay %s successfully, serving at %s", stat, endpoint.Address), details, nil
+	case internalconfig.CiliumCRDUpgradeOperation:
+		if request.IsDeleteOperation {
+			return "CRD upgrades cannot be reverted", "Cilium CRDs are only ever upgraded.", ErrOpInvalid
+		}
+		version := string(op.Versions[0])
+		stat, report, err := h.upgradeCRDs(ctx, version)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "crd-upgrade-report.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s Cilium %s CRDs", stat, version), details, err
+		}
+		return fmt.Sprintf("Cilium %s CRDs %s successfully", version, stat), details, nil
+	case internalconfig.CiliumConnectivityTestOperation:
+		stat, details, err := h.connectivityTest(ctx, request)
+		h.attachArtifact(request.OperationID, "connectivity-test.txt", []byte(details))
+		if err != nil {
+			return "Connectivity test failed", details, err
+		}
+		return fmt.Sprintf("Connectivity test %s successfully", stat), details, nil
+	case internalconfig.CiliumVisibilityAnnotationOperation:
+		stat, report, err := h.annotateVisibility(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "annotated-workloads.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s visibility annotations", stat), details, err
+		}
+		return fmt.Sprintf("Visibility annotations %s successfully", stat), details, nil
+	case internalconfig.CiliumBandwidthAnnotationOperation:
+		stat, report, err := h.annotateBandwidth(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "annotated-workloads.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s bandwidth annotations", stat), details, err
+		}
+		return fmt.Sprintf("Bandwidth annotations %s successfully", stat), details, nil
+	case internalconfig.CiliumStatusOperation:
+		if request.IsDeleteOperation {
+			return "The status cannot be deleted", "The Cilium status is only ever reported.", ErrOpInvalid
+		}
+		st, err := h.ciliumStatus(ctx)
+		if err != nil {
+			return "Error while collecting the Cilium status", err.Error(), err
+		}
+		details := reportDetails(st)
+		h.attachArtifact(request.OperationID, "cilium-status.json", []byte(details))
+		return st.Summary(), details, nil
+	case internalconfig.CiliumCleanupOperation:
+		stat, report, err := h.cleanup(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "cleanup-report.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s test resources", stat), details, err
+		}
+		return fmt.Sprintf("%d test resources %s successfully", len(report.Removed), stat), details, nil
+	case internalconfig.CiliumPolicyLintOperation:
+		if request.IsDeleteOperation {
+			return "The policy lint cannot be deleted", "The policy lint is only ever reported.", ErrOpInvalid
+		}
+		report, err := h.lintPolicies(ctx, request)
+		if err != nil {
+			return "Error while linting the network policies", err.Error(), err
+		}
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "policy-lint.json", []byte(details))
+		return report.Summary(), details, nil
+	case internalconfig.CiliumNodeHealthOperation:
+		if request.IsDeleteOperation {
+			return "The node health cannot be deleted", "The health of the nodes is only ever reported.", ErrOpInvalid
+		}
+		report, err := h.nodeHealthReport(ctx, request.OperationID)
+		if err != nil {
+			return "Error while collecting the health of the nodes", err.Error(), err
+		}
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "node-health.json", []byte(details))
+		return report.Summary(), details, nil
+	case internalconfig.CiliumHubbleExportOperation:
+		stat, details, err := h.exportHubbleFlows(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s Hubble flow export", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Hubble flow export %s successfully", stat), details, nil
+	case internalconfig.CiliumHubbleMetricsOperation:
+		stat, details, err := h.configureHubbleMetrics(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s Hubble metrics", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Hubble metrics %s successfully", stat), details, nil
+	case internalconfig.CiliumMonitoringOperation:
+		stat, report, err := h.provisionMonitoring(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "monitoring.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s Cilium monitoring", stat), details, err
+		}
+		return fmt.Sprintf("Cilium monitoring %s successfully", stat), details, nil
+	case internalconfig.CiliumPolicyRecommendationOperation:
+		stat, report, err := h.recommendPolicies(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "policy-recommendation.json", []byte(details))
+		if err != nil {
+			return "Error while recommending policies", details, err
+		}
+		if report.Design != "" {
+			h.attachArtifact(request.OperationID, "recommended-policies.yaml", []byte(report.Design))
+		}
+		return fmt.Sprintf("Policy recommendation %s: %d policies from %d flows", stat, len(report.Policies), report.Flows), details, nil
+	case internalconfig.CiliumEnvoyConfigOperation:
+		stat, rollout, err := h.configureEnvoyConfig(ctx, request.IsDeleteOperation)
+		if err != nil {
+			return fmt.Sprintf("Error while %s Envoy L7 proxy", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium Envoy L7 proxy %s successfully", stat), fmt.Sprintf("CiliumEnvoyConfig %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumMutualAuthOperation:
+		stat, rollout, err := h.configureMutualAuth(ctx, request.IsDeleteOperation)
+		if err != nil {
+			return fmt.Sprintf("Error while %s mutual authentication", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium mutual authentication %s successfully", stat), fmt.Sprintf("Mutual authentication %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumBGPControlPlaneOperation:
+		stat, rollout, err := h.configureBGPControlPlane(ctx, request.IsDeleteOperation)
+		if err != nil {
+			return fmt.Sprintf("Error while %s BGP control plane", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium BGP control plane %s successfully", stat), fmt.Sprintf("BGP control plane %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumBandwidthManagerOperation:
+		stat, rollout, err := h.configureBandwidthManager(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s bandwidth manager", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium bandwidth manager %s successfully", stat), fmt.Sprintf("Bandwidth manager %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumDualStackOperation:
+		stat, report, err := h.configureDualStack(ctx, request)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "dual-stack.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s dual-stack", stat), details, err
+		}
+		return fmt.Sprintf("Cilium dual-stack %s successfully", stat), details, nil
+	case internalconfig.CiliumUpgradeOperation:
+		stat, report, err := h.upgradeCilium(ctx, request, string(op.Versions[0]))
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "upgrade-report.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s the Cilium upgrade", stat), details, err
+		}
+		if report.Phase == upgradePaused {
+			return fmt.Sprintf("Cilium upgrade to %s paused: %s", report.To, report.Reason), details, nil
+		}
+		return fmt.Sprintf("Cilium upgrade to %s %s", report.To, report.Phase), details, nil
+	case internalconfig.CiliumPerformanceTestOperation:
+		stat, report, err := h.runPerformanceTest(ctx, request)
+		details := reportDetails(report)
+		if report != nil {
+			h.attachArtifact(request.OperationID, "smp-result.json", []byte(details))
+		}
+		if err != nil {
+			return fmt.Sprintf("Error while %s the performance test", stat), details, err
+		}
+		return fmt.Sprintf("Performance test %s: %.1f requests/s, p99 %.2fms", stat, report.Result.ActualQps, report.Result.LatenciesMs.P99), details, nil
+	case internalconfig.CiliumExportOperation:
+		if request.IsDeleteOperation {
+			return "The export cannot be deleted", "The Cilium configuration is only ever exported.", ErrOpInvalid
+		}
+		export, err := h.exportCilium(ctx)
+		if err != nil {
+			return "Error while exporting the Cilium configuration", err.Error(), err
+		}
+		h.attachArtifact(request.OperationID, "values.yaml", export.values)
+		if export.computed != nil {
+			h.attachArtifact(request.OperationID, "computed-values.yaml", export.computed)
+		}
+		h.attachArtifact(request.OperationID, "manifests.yaml", export.manifests)
+		details := reportDetails(export.report)
+		return fmt.Sprintf("Cilium %s exported, source: %s", export.report.Version, export.report.Source), details, nil
+	case internalconfig.CiliumReconcileOperation:
+		if request.IsDeleteOperation {
+			return "The reconciliation cannot be deleted", "The applied state is only ever restored.", ErrOpInvalid
+		}
+		stat, report, err := h.reconcileDrift(ctx)
+		details := reportDetails(report)
+		h.attachArtifact(request.OperationID, "drift.json", []byte(details))
+		if err != nil {
+			return fmt.Sprintf("Error while %s the Cilium configuration", stat), details, err
+		}
+		return fmt.Sprintf("Cilium configuration reconciled, %d differences restored", len(report.Reconciled)), details, nil
+	case internalconfig.CiliumHostFirewallOperation:
+		stat, rollout, err := h.configureHostFirewall(ctx, request)
+		if err != nil {
+			return fmt.Sprintf("Error while %s host firewall", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium host firewall %s successfully", stat), fmt.Sprintf("Host firewall %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumLocalRedirectPolicyOperation:
+		stat, rollout, err := h.configureLocalRedirectPolicy(ctx, request.IsDeleteOperation)
+		if err != nil {
+			return fmt.Sprintf("Error while %s local redirect policies", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Cilium local redirect policies %s successfully", stat), fmt.Sprintf("Local redirect policies %s, %s.", stat, rollout), nil
+	case internalconfig.CiliumCancelOperation:
+		return h.cancelOperations(request)
+	case internalconfig.TetragonOperation:
+		version := string(op.Versions[0])
+		install, err := parseInstallRequest(request.CustomBody)
+		if err != nil {
+			return "Error while parsing the Tetragon install request", err.Error(), err
+		}
+		stat, err := h.installTetragon(ctx, request.IsDeleteOperation, version, install)
+		if err != nil {
+			return fmt.Sprintf("Error while %s Tetragon", stat), err.Error(), err
+		}
+		return fmt.Sprintf("Tetragon %s successfully", stat), fmt.Sprintf("Tetragon is now %s.", stat), nil
 	}
-	return nil
+	return status.Deploying, "Operation is not supported", ErrOpInvalid
+}
+
+// maxEventDetails keeps the events well below the default 4MiB gRPC
+// message size limit of Meshery
+const maxEventDetails = 512 * 1024
+
+// eventDetails caps the details of an event, reports which don't fit are
+// only available as artifacts of the operation
+func eventDetails(details string) string {
+	if len(details) <= maxEventDetails {
+		return details
+	}
+	return fmt.Sprintf("The details are %d bytes long and were left out of the event, download them from the artifacts of the operation.", len(details))
+}
+
+// reportDetails renders a structured report as the details of an event
+func reportDetails(report interface{}) string {
+	byt, err := json.Marshal(report)
+	if err != nil {
+		return err.Error()
+	}
+	return string(byt)
 }
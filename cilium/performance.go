@@ -0,0 +1,429 @@
+package cilium
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	smp "github.com/layer5io/service-mesh-performance/spec"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	perfPrefix = "meshery-perf-"
+	// smpVersion is the version of the SMP spec the results follow
+	smpVersion = "v0.3.3"
+
+	loadGeneratorFortio = "fortio"
+	loadGeneratorWrk2   = "wrk2"
+
+	defaultPerfDuration    = 30 * time.Second
+	maxPerfDuration        = 30 * time.Minute
+	defaultPerfRPS         = 100
+	defaultPerfConnections = 1
+	// perfStartTimeout bounds the pull and the scheduling of the load
+	// generator on top of the length of the test
+	perfStartTimeout = 2 * time.Minute
+
+	forwardMetric = "cilium_forward_count_total"
+)
+
+// PerformanceReport is the outcome of the performance test operation, the
+// SMP result along with the datapath counters of the agents
+type PerformanceReport struct {
+	Result *smp.PerformanceTestResult `json:"result"`
+	// Datapath are the packets forwarded and dropped by the agents per
+	// second during the test, empty when the agents serve no metrics
+	Datapath map[string]float64 `json:"datapath,omitempty"`
+}
+
+// loadResult is the outcome of a load generator run
+type loadResult struct {
+	qps       float64
+	latencies *smp.PerformanceTestResult_Latency
+}
+
+// parsePerformanceRequest reads the SMP test configuration from the body of
+// the operation and fills in the defaults of its single client
+func parsePerformanceRequest(body string) (*smp.PerformanceTestConfig, *smp.PerformanceTestConfig_Client, time.Duration, error) {
+	cfg := &smp.PerformanceTestConfig{}
+	if err := yaml.Unmarshal([]byte(body), cfg); err != nil {
+		return nil, nil, 0, err
+	}
+	if len(cfg.Clients) != 1 {
+		return nil, nil, 0, fmt.Errorf("the test needs exactly one client, %d given", len(cfg.Clients))
+	}
+	client := cfg.Clients[0]
+	if len(client.EndpointUrls) != 1 {
+		return nil, nil, 0, fmt.Errorf("the client needs exactly one endpoint URL, %d given", len(client.EndpointUrls))
+	}
+	if _, err := url.ParseRequestURI(client.EndpointUrls[0]); err != nil {
+		return nil, nil, 0, err
+	}
+
+	if client.LoadGenerator == "" {
+		client.LoadGenerator = loadGeneratorFortio
+	}
+	switch client.Protocol {
+	case smp.PerformanceTestConfig_Client_PROTOCOL_INVALID:
+		client.Protocol = smp.PerformanceTestConfig_Client_PROTOCOL_HTTP
+	case smp.PerformanceTestConfig_Client_PROTOCOL_HTTP:
+	case smp.PerformanceTestConfig_Client_PROTOCOL_GRPC:
+		if client.LoadGenerator != loadGeneratorFortio {
+			return nil, nil, 0, fmt.Errorf("%s doesn't load gRPC endpoints, use fortio", client.LoadGenerator)
+		}
+	default:
+		return nil, nil, 0, fmt.Errorf("protocol %s is not supported, use HTTP or gRPC", client.Protocol)
+	}
+	if client.LoadGenerator != loadGeneratorFortio && client.LoadGenerator != loadGeneratorWrk2 {
+		return nil, nil, 0, fmt.Errorf("load generator %q is neither fortio nor wrk2", client.LoadGenerator)
+	}
+	if client.Rps <= 0 {
+		client.Rps = defaultPerfRPS
+	}
+	if client.Connections <= 0 {
+		client.Connections = defaultPerfConnections
+	}
+
+	duration := defaultPerfDuration
+	if cfg.Duration != "" {
+		d, err := time.ParseDuration(cfg.Duration)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		duration = d
+	}
+	if duration < time.Second || duration > maxPerfDuration {
+		return nil, nil, 0, fmt.Errorf("duration must be between 1s and %s", maxPerfDuration)
+	}
+	return cfg, client, duration, nil
+}
+
+// runPerformanceTest loads the endpoint of the SMP test configuration from a
+// load generator Job in the namespace of the operation, and returns the SMP
+// result along with the packets forwarded and dropped by the agents during
+// the test
+func (h *Handler) runPerformanceTest(ctx context.Context, request adapter.OperationRequest) (string, *PerformanceReport, error) {
+	st := status.Deploying
+	if h.KubeClient == nil {
+		return st, nil, ErrNilClient
+	}
+	cfg, client, duration, err := parsePerformanceRequest(request.CustomBody)
+	if err != nil {
+		return st, nil, ErrPerformanceTest(err)
+	}
+	version, err := h.ciliumVersion(ctx)
+	if err != nil {
+		return st, nil, ErrPerformanceTest(err)
+	}
+	agentCfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return st, nil, ErrPerformanceTest(err)
+	}
+
+	port := strings.TrimPrefix(agentCfg["prometheus-serve-addr"], ":")
+	metrics := []string{forwardMetric, agentDropMetric}
+	var before map[string]float64
+	if port != "" {
+		if before, err = h.datapathCounters(ctx, port, metrics); err != nil {
+			return st, nil, ErrPerformanceTest(err)
+		}
+	}
+
+	start := time.Now()
+	reportProgress(ctx, fmt.Sprintf("Loading %s with %s", client.EndpointUrls[0], client.LoadGenerator), fmt.Sprintf("%d requests/s over %d connections for %s.", client.Rps, client.Connections, duration))
+	out, err := h.runLoadGenerator(ctx, request.Namespace, client, duration)
+	if err != nil {
+		return st, nil, ErrPerformanceTest(err)
+	}
+	end := time.Now()
+
+	var res loadResult
+	if client.LoadGenerator == loadGeneratorFortio {
+		res, err = parseFortioResult(out)
+	} else {
+		res, err = parseWrk2Result(out)
+	}
+	if err != nil {
+		return st, nil, ErrPerformanceTest(err)
+	}
+
+	report := &PerformanceReport{Result: &smp.PerformanceTestResult{
+		SmpVersion:  smpVersion,
+		Id:          cfg.Id,
+		TestId:      cfg.Name,
+		LatenciesMs: res.latencies,
+		ActualQps:   res.qps,
+		Labels: map[string]string{
+			"load_generator": client.LoadGenerator,
+			"mesh":           smp.ServiceMesh_CILIUM_SERVICE_MESH.String(),
+			"mesh_version":   version,
+		},
+	}}
+	report.Result.StartTime, _ = ptypes.TimestampProto(start)
+	report.Result.EndTime, _ = ptypes.TimestampProto(end)
+
+	if port != "" {
+		after, err := h.datapathCounters(ctx, port, metrics)
+		if err != nil {
+			return st, report, ErrPerformanceTest(err)
+		}
+		elapsed := end.Sub(start).Seconds()
+		report.Datapath = map[string]float64{}
+		for _, m := range metrics {
+			report.Datapath[m] = (after[m] - before[m]) / elapsed
+		}
+	}
+	return status.Completed, report, nil
+}
+
+// runLoadGenerator runs the load generator of client as a Job and returns
+// its output once it completed. The Job is removed afterwards.
+func (h *Handler) runLoadGenerator(ctx context.Context, namespace string, client *smp.PerformanceTestConfig_Client, duration time.Duration) ([]byte, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+	image, args := internalconfig.FortioImage(), fortioArgs(client, duration)
+	if client.LoadGenerator == loadGeneratorWrk2 {
+		image, args = internalconfig.Wrk2Image(), wrk2Args(client, duration)
+	}
+	// An air-gapped cluster pulls the load generator from the mirror of the
+	// install, the pull secrets of kube-system aren't usable by the Job so
+	// the mirror must serve it to the nodes as it serves the Cilium images
+	if prefix, ok := h.installRegistry(); ok {
+		image = mirroredRepository(prefix, image)
+	}
+
+	backoff := int32(0)
+	job, err := h.KubeClient.BatchV1().Jobs(namespace).Create(ctx, &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: perfPrefix,
+			Labels:       map[string]string{"app": perfPrefix + client.LoadGenerator},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoff,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": perfPrefix + client.LoadGenerator}},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:  client.LoadGenerator,
+						Image: image,
+						Args:  args,
+					}},
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		propagation := metav1.DeletePropagationBackground
+		if err := h.KubeClient.BatchV1().Jobs(namespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil {
+			h.Log.Error(ErrPerformanceTest(err))
+		}
+	}()
+
+	timeout := duration + perfStartTimeout
+	err = wait.PollImmediate(rolloutPollInterval, timeout, func() (bool, error) {
+		cur, err := h.KubeClient.BatchV1().Jobs(namespace).Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if cur.Status.Failed > 0 {
+			return false, fmt.Errorf("the load generator %s failed", job.Name)
+		}
+		return cur.Status.Succeeded > 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("the load generator %s did not complete within %s", job.Name, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := h.KubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + job.Name})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded {
+			return h.KubeClient.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+		}
+	}
+	return nil, fmt.Errorf("the pod of the load generator %s is gone", job.Name)
+}
+
+func fortioArgs(client *smp.PerformanceTestConfig_Client, duration time.Duration) []string {
+	args := []string{"load", "-json", "-", "-quiet",
+		"-qps", strconv.FormatInt(client.Rps, 10),
+		"-c", strconv.Itoa(int(client.Connections)),
+		"-t", duration.String(),
+	}
+	if client.Protocol == smp.PerformanceTestConfig_Client_PROTOCOL_GRPC {
+		args = append(args, "-grpc")
+	}
+	for k, v := range client.Headers {
+		args = append(args, "-H", fmt.Sprintf("%s: %s", k, v))
+	}
+	if client.Body != "" {
+		args = append(args, "-payload", client.Body)
+	}
+	if client.ContentType != "" {
+		args = append(args, "-content-type", client.ContentType)
+	}
+	return append(args, client.EndpointUrls[0])
+}
+
+func wrk2Args(client *smp.PerformanceTestConfig_Client, duration time.Duration) []string {
+	args := []string{"--latency",
+		"-t", "1",
+		"-c", strconv.Itoa(int(client.Connections)),
+		"-d", fmt.Sprintf("%ds", int(duration.Seconds())),
+		"-R", strconv.FormatInt(client.Rps, 10),
+	}
+	for k, v := range client.Headers {
+		args = append(args, "-H", fmt.Sprintf("%s: %s", k, v))
+	}
+	return append(args, client.EndpointUrls[0])
+}
+
+// fortioResult is the part of the JSON results of fortio the SMP result is
+// made of, the durations are in seconds
+type fortioResult struct {
+	ActualQPS         float64
+	DurationHistogram struct {
+		Min         float64
+		Max         float64
+		Avg         float64
+		Percentiles []struct {
+			Percentile float64
+			Value      float64
+		}
+	}
+}
+
+// parseFortioResult reads the JSON results fortio prints once done, the
+// logs of the load generator precede them
+func parseFortioResult(out []byte) (loadResult, error) {
+	i := bytes.Index(out, []byte("\n{"))
+	if i < 0 {
+		if !bytes.HasPrefix(out, []byte("{")) {
+			return loadResult{}, fmt.Errorf("the output of fortio holds no results")
+		}
+		i = -1
+	}
+	res := fortioResult{}
+	if err := json.Unmarshal(out[i+1:], &res); err != nil {
+		return loadResult{}, fmt.Errorf("reading the results of fortio: %s", err)
+	}
+
+	h := res.DurationHistogram
+	latencies := &smp.PerformanceTestResult_Latency{Min: h.Min * 1000, Average: h.Avg * 1000, Max: h.Max * 1000}
+	for _, p := range h.Percentiles {
+		switch p.Percentile {
+		case 50:
+			latencies.P50 = p.Value * 1000
+		case 90:
+			latencies.P90 = p.Value * 1000
+		case 99:
+			latencies.P99 = p.Value * 1000
+		}
+	}
+	return loadResult{qps: res.ActualQPS, latencies: latencies}, nil
+}
+
+// parseWrk2Result reads the summary and the latency distribution wrk2
+// prints with --latency. wrk2 doesn't report the minimum latency.
+func parseWrk2Result(out []byte) (loadResult, error) {
+	res := loadResult{latencies: &smp.PerformanceTestResult_Latency{}}
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch {
+		case fields[0] == "Requests/sec:":
+			qps, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return res, err
+			}
+			res.qps, found = qps, true
+		case fields[0] == "Latency" && fields[1] != "Distribution" && len(fields) >= 4:
+			// Latency <avg> <stdev> <max> <+/- stdev>
+			res.latencies.Average = wrk2Millis(fields[1])
+			res.latencies.Max = wrk2Millis(fields[3])
+		case fields[0] == "50.000%":
+			res.latencies.P50 = wrk2Millis(fields[1])
+		case fields[0] == "90.000%":
+			res.latencies.P90 = wrk2Millis(fields[1])
+		case fields[0] == "99.000%":
+			res.latencies.P99 = wrk2Millis(fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+	if !found {
+		return res, fmt.Errorf("the output of wrk2 holds no results")
+	}
+	return res, nil
+}
+
+// wrk2Millis converts a duration printed by wrk2, e.g. 1.23ms, to
+// milliseconds
+func wrk2Millis(s string) float64 {
+	units := []struct {
+		suffix string
+		millis float64
+	}{{"us", 0.001}, {"ms", 1}, {"s", 1000}, {"m", 60000}}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0
+			}
+			return v * u.millis
+		}
+	}
+	return 0
+}
+
+// datapathCounters sums the counters of metrics over the agents
+func (h *Handler) datapathCounters(ctx context.Context, port string, metrics []string) (map[string]float64, error) {
+	pods, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).List(ctx, metav1.ListOptions{LabelSelector: ciliumAgentSelector})
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]float64{}
+	for _, pod := range pods.Items {
+		if !podReady(&pod) {
+			continue
+		}
+		for _, m := range metrics {
+			v, err := h.scrapeCounter(ctx, pod.Name, port, m)
+			if err != nil {
+				return nil, err
+			}
+			res[m] += v
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package cilium
+
+import (
+	"math"
+	"testing"
+)
+
+const wrk2Output = `Running 30s test @ http://meshery-perf-target:8080
+  2 threads and 10 connections
+  Thread calibration: mean lat.: 1.513ms, rate sampling interval: 10ms
+  Thread Stats   Avg      Stdev     Max   +/- Stdev
+    Latency     1.52ms  612.30us  12.48ms   78.12%
+    Req/Sec    52.81     68.14   200.00     78.50%
+  Latency Distribution (HdrHistogram - Recorded Latency)
+ 50.000%    1.43ms
+ 75.000%    1.82ms
+ 90.000%    2.21ms
+ 99.000%    3.50ms
+ 99.900%    9.87ms
+  2999 requests in 30.00s, 1.02MB read
+Requests/sec:     99.97
+Transfer/sec:     34.80KB
+`
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestParseWrk2Result(t *testing.T) {
+	res, err := parseWrk2Result([]byte(wrk2Output))
+	if err != nil {
+		t.Fatalf("parseWrk2Result() error = %s", err)
+	}
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"qps", res.qps, 99.97},
+		{"average", res.latencies.Average, 1.52},
+		{"max", res.latencies.Max, 12.48},
+		{"p50", res.latencies.P50, 1.43},
+		{"p90", res.latencies.P90, 2.21},
+		{"p99", res.latencies.P99, 3.50},
+	}
+	for _, tt := range tests {
+		if !approxEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseWrk2ResultWithoutResults(t *testing.T) {
+	if _, err := parseWrk2Result([]byte("unable to connect to meshery-perf-target:8080 Connection refused\n")); err == nil {
+		t.Error("parseWrk2Result() of a failed run returned no error")
+	}
+}
+
+func TestWrk2Millis(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"612.00us", 0.612},
+		{"1.52ms", 1.52},
+		{"2.00s", 2000},
+		{"1.50m", 90000},
+		{"1.52", 0},
+		{"fast", 0},
+	}
+	for _, tt := range tests {
+		if got := wrk2Millis(tt.in); !approxEqual(got, tt.want) {
+			t.Errorf("wrk2Millis(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshery-cilium/internal/metrics"
+)
+
+// pipelineStepResult is the outcome of a single pipeline step
+type pipelineStepResult struct {
+	Operation string `json:"operation"`
+	Summary   string `json:"summary"`
+	Succeeded bool   `json:"succeeded"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runPipeline runs the steps of a pipeline one after the other, streaming
+// the result of every step and finally the aggregated result. The revert
+// of a pipeline runs the reverts of its steps in reverse order.
+func (h *Handler) runPipeline(request adapter.OperationRequest, operations adapter.Operations, e *adapter.Event) {
+	start := time.Now()
+	pipelines := internalconfig.Pipelines{}
+	if err := h.Config.GetObject(internalconfig.PipelinesKey, &pipelines); err != nil {
+		e.Summary = fmt.Sprintf("Error while loading pipeline %s", request.OperationName)
+		e.Details = err.Error()
+		h.StreamErr(e, ErrRunPipeline(err))
+		return
+	}
+	pipeline, ok := pipelines[request.OperationName]
+	if !ok {
+		h.StreamErr(e, ErrOpInvalid)
+		return
+	}
+
+	steps := pipeline.Steps
+	if request.IsDeleteOperation {
+		steps = make([]internalconfig.PipelineStep, len(pipeline.Steps))
+		for i, step := range pipeline.Steps {
+			steps[len(steps)-1-i] = step
+		}
+	}
+
+	// Cancelling the pipeline cancels its running step and skips the
+	// next ones
+	ctx, run, done := h.startOperation(h.lifecycle.ctx, request)
+	defer done()
+
+	var results []pipelineStepResult
+	var failed error
+	for i, step := range steps {
+		if err := h.interruption(ctx, run, 0); err != nil {
+			failed = err
+			results = append(results, pipelineStepResult{Operation: step.Operation, Error: err.Error()})
+			break
+		}
+		op, ok := operations[step.Operation]
+		if !ok {
+			failed = ErrRunPipeline(fmt.Errorf("unknown operation %q", step.Operation))
+			results = append(results, pipelineStepResult{Operation: step.Operation, Error: failed.Error()})
+			break
+		}
+
+		stepStart := time.Now()
+		summary, err := h.runPipelineStep(ctx, request, step, op)
+		metrics.ObserveOperation(step.Operation, stepStart, err)
+		result := pipelineStepResult{Operation: step.Operation, Summary: summary, Succeeded: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+
+		stepEvent := &adapter.Event{
+			Operationid: request.OperationID,
+			Summary:     fmt.Sprintf("Pipeline %s step %d/%d: %s", request.OperationName, i+1, len(steps), summary),
+			Details:     result.Error,
+		}
+		if err != nil {
+			h.StreamErr(stepEvent, err)
+			if !step.ContinueOnError {
+				failed = ErrRunPipeline(err)
+				break
+			}
+			continue
+		}
+		h.StreamInfo(stepEvent)
+	}
+
+	succeeded := 0
+	for _, r := range results {
+		if r.Succeeded {
+			succeeded++
+		}
+	}
+	e.Details = eventDetails(reportDetails(results))
+	metrics.ObserveOperation(request.OperationName, start, failed)
+	if failed != nil {
+		e.Summary = fmt.Sprintf("Pipeline %s failed after %d/%d steps", request.OperationName, succeeded, len(steps))
+		h.StreamErr(e, failed)
+		return
+	}
+	e.Summary = fmt.Sprintf("Pipeline %s completed, %d/%d steps succeeded", request.OperationName, succeeded, len(steps))
+	h.StreamInfo(e)
+}
+
+// runPipelineStep runs a single step and waits for its gate
+func (h *Handler) runPipelineStep(ctx context.Context, request adapter.OperationRequest, step internalconfig.PipelineStep, op *adapter.Operation) (string, error) {
+	// Step properties override the ones of the operation without
+	// modifying the shared definition
+	stepOp := *op
+	stepOp.AdditionalProperties = map[string]string{}
+	for k, v := range op.AdditionalProperties {
+		stepOp.AdditionalProperties[k] = v
+	}
+	for k, v := range step.Properties {
+		stepOp.AdditionalProperties[k] = v
+	}
+
+	stepRequest := request
+	stepRequest.OperationName = step.Operation
+	stepRequest.IsDeleteOperation = step.Delete != request.IsDeleteOperation
+
+	// The step runs under the pipeline, cancelling the pipeline cancels it
+	summary, _, err := h.runOperation(ctx, stepRequest, &stepOp, nil)
+	if err != nil {
+		return summary, err
+	}
+
+	if step.WaitFor == "" || stepRequest.IsDeleteOperation {
+		return summary, nil
+	}
+	parts := strings.SplitN(step.WaitFor, "/", 2)
+	if len(parts) != 2 {
+		return summary, ErrRunPipeline(fmt.Errorf("invalid waitFor %q, expected namespace/name", step.WaitFor))
+	}
+	rollout, err := h.waitForDaemonSetRollout(ctx, parts[0], parts[1])
+	if err != nil {
+		return summary, err
+	}
+	return fmt.Sprintf("%s, %s", summary, rollout), nil
+}
@@ -0,0 +1,167 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	convergencePollInterval = 2 * time.Second
+	convergenceTimeout      = 2 * time.Minute
+)
+
+var policyRevision = regexp.MustCompile(`Revision: (\d+)`)
+
+// policyConvergence is the enforcement state of a policy on the endpoints
+// it selects
+type policyConvergence struct {
+	Endpoints int           `json:"endpoints"`
+	Converged int           `json:"converged"`
+	Latency   time.Duration `json:"latency"`
+	Pending   []string      `json:"pending,omitempty"`
+	// HostRules are the rules selecting nodes, whose enforcement is not
+	// tracked
+	HostRules int `json:"hostRules,omitempty"`
+}
+
+func (c policyConvergence) String() string {
+	if c.Endpoints == 0 && c.HostRules > 0 {
+		return fmt.Sprintf("enforcement of %d host rules not tracked", c.HostRules)
+	}
+	res := fmt.Sprintf("enforced on %d endpoints in %s", c.Endpoints, c.Latency.Round(time.Millisecond))
+	if len(c.Pending) > 0 {
+		res = fmt.Sprintf("enforced on %d/%d endpoints, pending: %s", c.Converged, c.Endpoints, strings.Join(c.Pending, ", "))
+	}
+	if c.HostRules > 0 {
+		res = fmt.Sprintf("%s, enforcement of %d host rules not tracked", res, c.HostRules)
+	}
+	return res
+}
+
+// waitForPolicyConvergence waits until the agents imported the policy and
+// every endpoint selected by one of its rules realized the resulting policy
+// revision, so that an applied policy is known to be enforced. The rules
+// selecting nodes are host policies, they are skipped.
+func (h *Handler) waitForPolicyConvergence(ctx context.Context, comp v1alpha1.Component, kind string, policy map[string]interface{}) (policyConvergence, error) {
+	start := time.Now()
+	res := policyConvergence{}
+
+	namespace := comp.Namespace
+	labels := []string{"k8s:io.cilium.k8s.policy.name=" + comp.Name}
+	if kind == ciliumClusterwideNetworkPolicyKind {
+		namespace = ""
+	} else {
+		labels = append(labels, "k8s:io.cilium.k8s.policy.namespace="+comp.Namespace)
+	}
+
+	// The endpoints selected by several rules are waited for once
+	endpoints := map[string][]string{}
+	seen := map[string]bool{}
+	for _, rule := range policyRules(policy) {
+		endpointSelector, ok := rule.spec["endpointSelector"]
+		if !ok {
+			res.HostRules++
+			continue
+		}
+		selector, ns, err := podSelector(endpointSelector, namespace)
+		if err != nil {
+			return res, ErrPolicyConvergence(fmt.Errorf("%s.endpointSelector: %s", rule.field, err))
+		}
+		selected, err := h.selectedEndpoints(ctx, ns, selector)
+		if err != nil {
+			return res, ErrPolicyConvergence(err)
+		}
+		for node, ids := range selected {
+			for _, id := range ids {
+				if key := node + "/" + id; !seen[key] {
+					seen[key] = true
+					endpoints[node] = append(endpoints[node], id)
+					res.Endpoints++
+				}
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, convergenceTimeout)
+	defer cancel()
+
+	for node, ids := range endpoints {
+		pod, err := h.agentPod(ctx, node)
+		if err != nil {
+			return res, ErrPolicyConvergence(err)
+		}
+
+		// The revision of the policy repository once the policy is imported
+		var revision int64
+		if err := wait.PollImmediateUntil(convergencePollInterval, func() (bool, error) {
+			out, err := h.execInAgent(pod, append([]string{"cilium", "policy", "get"}, labels...))
+			if err != nil {
+				return false, nil
+			}
+			m := policyRevision.FindStringSubmatch(out)
+			if m == nil {
+				return false, nil
+			}
+			revision, _ = strconv.ParseInt(m[1], 10, 64)
+			return true, nil
+		}, ctx.Done()); err != nil {
+			for _, id := range ids {
+				res.Pending = append(res.Pending, fmt.Sprintf("%s/%s", node, id))
+			}
+			continue
+		}
+
+		for _, id := range ids {
+			if err := wait.PollImmediateUntil(convergencePollInterval, func() (bool, error) {
+				realized, err := h.endpointPolicyRevision(pod, id)
+				if err != nil {
+					return false, nil
+				}
+				return realized >= revision, nil
+			}, ctx.Done()); err != nil {
+				res.Pending = append(res.Pending, fmt.Sprintf("%s/%s", node, id))
+				continue
+			}
+			res.Converged++
+		}
+	}
+
+	res.Latency = time.Since(start)
+	if len(res.Pending) > 0 {
+		return res, ErrPolicyConvergence(fmt.Errorf("%s %q not enforced within %s: %s", kind, comp.Name, convergenceTimeout, res))
+	}
+	return res, nil
+}
+
+// endpointPolicyRevision returns the policy revision realized by an endpoint
+func (h *Handler) endpointPolicyRevision(pod, id string) (int64, error) {
+	out, err := h.execInAgent(pod, []string{"cilium", "endpoint", "get", id, "-o", "json"})
+	if err != nil {
+		return 0, err
+	}
+
+	var eps []struct {
+		Status struct {
+			Policy struct {
+				Realized struct {
+					PolicyRevision int64 `json:"policy-revision"`
+				} `json:"realized"`
+			} `json:"policy"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(out), &eps); err != nil {
+		return 0, err
+	}
+	if len(eps) == 0 {
+		return 0, fmt.Errorf("endpoint %s not found", id)
+	}
+	return eps[0].Status.Policy.Realized.PolicyRevision, nil
+}
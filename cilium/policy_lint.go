@@ -0,0 +1,581 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	lintBroadSelector = "broad-selector"
+	lintMissingDNS    = "missing-dns-egress"
+	lintShadowedRule  = "shadowed-rule"
+	lintDenyAllGap    = "deny-all-gap"
+
+	policyLintHistory = "policy-lint.json"
+	// maxLintHistory bounds the scores kept for every scope
+	maxLintHistory = 50
+	// clusterScope is the scope of the runs linting every namespace
+	clusterScope = "cluster"
+)
+
+// lintPenalties are the points a finding costs to the score of a run
+var lintPenalties = map[string]int{
+	severityHigh:   10,
+	severityMedium: 5,
+	severityLow:    2,
+}
+
+// policyLintMu guards the history of the scores, runs may be concurrent
+var policyLintMu sync.Mutex
+
+// PolicyLintRequest is the body of the policy lint operation
+type PolicyLintRequest struct {
+	// Namespace lints the policies of a single namespace, every namespace
+	// and the clusterwide policies are linted by default
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// PolicyLintFinding is a best-practice check failed by a policy or, for the
+// deny-all gaps, by a namespace
+type PolicyLintFinding struct {
+	Check     string `json:"check"`
+	Severity  string `json:"severity"`
+	Policy    string `json:"policy,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Field     string `json:"field,omitempty"`
+	Message   string `json:"message"`
+}
+
+// PolicyLintScore is the score of a past run
+type PolicyLintScore struct {
+	Time     time.Time `json:"time"`
+	Score    int       `json:"score"`
+	Findings int       `json:"findings"`
+}
+
+// PolicyLintReport is the outcome of a policy lint run. The score starts at
+// 100 and every finding takes points off depending on its severity, the
+// scores of the previous runs of the same scope are kept to track it.
+type PolicyLintReport struct {
+	Scope    string              `json:"scope"`
+	Policies int                 `json:"policies"`
+	Score    int                 `json:"score"`
+	Previous *PolicyLintScore    `json:"previous,omitempty"`
+	Findings []PolicyLintFinding `json:"findings"`
+	History  []PolicyLintScore   `json:"history,omitempty"`
+}
+
+// Summary returns the score of the run and how it changed since the last one
+func (r *PolicyLintReport) Summary() string {
+	summary := fmt.Sprintf("Policy lint score %d/100 with %d findings", r.Score, len(r.Findings))
+	if r.Previous != nil {
+		summary += fmt.Sprintf(", %+d since the last run", r.Score-r.Previous.Score)
+	}
+	return summary
+}
+
+// lintedPolicy is a policy of the cluster along with its rules
+type lintedPolicy struct {
+	kind      string
+	namespace string
+	name      string
+	rules     []policyRule
+}
+
+func (p lintedPolicy) String() string {
+	return fmt.Sprintf("%s %s", p.kind, qualifiedName(p.namespace, p.name))
+}
+
+// lintPolicies lints the CiliumNetworkPolicies of a namespace, or of the
+// whole cluster along with the CiliumClusterwideNetworkPolicies. The
+// clusterwide policies count towards the DNS and deny-all coverage of a
+// namespace in both cases.
+func (h *Handler) lintPolicies(ctx context.Context, request adapter.OperationRequest) (*PolicyLintReport, error) {
+	if h.DynamicKubeClient == nil || h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+	req := PolicyLintRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return nil, ErrPolicyLint(err)
+	}
+
+	namespaced, err := h.listLintedPolicies(ctx, ciliumNetworkPolicyKind, req.Namespace)
+	if err != nil {
+		return nil, ErrPolicyLint(err)
+	}
+	clusterwide, err := h.listLintedPolicies(ctx, ciliumClusterwideNetworkPolicyKind, "")
+	if err != nil {
+		return nil, ErrPolicyLint(err)
+	}
+
+	report := &PolicyLintReport{Scope: clusterScope, Findings: []PolicyLintFinding{}}
+	linted := namespaced
+	if req.Namespace != "" {
+		report.Scope = req.Namespace
+	} else {
+		linted = append(linted, clusterwide...)
+	}
+	report.Policies = len(linted)
+
+	all := append(append([]lintedPolicy{}, namespaced...), clusterwide...)
+	for _, p := range linted {
+		for _, rule := range p.rules {
+			report.Findings = append(report.Findings, lintSelectors(p, rule)...)
+			report.Findings = append(report.Findings, lintDNSEgress(p, rule, all)...)
+			report.Findings = append(report.Findings, lintShadowedRules(p, rule)...)
+		}
+	}
+	gaps, err := h.lintDenyAllGaps(ctx, req.Namespace, all)
+	if err != nil {
+		return nil, ErrPolicyLint(err)
+	}
+	report.Findings = append(report.Findings, gaps...)
+
+	report.Score = 100
+	for _, f := range report.Findings {
+		report.Score -= lintPenalties[f.Severity]
+	}
+	if report.Score < 0 {
+		report.Score = 0
+	}
+
+	if err := h.recordLintScore(report); err != nil {
+		// The report is still valid without its history
+		h.Log.Error(ErrPolicyLint(err))
+	}
+	return report, nil
+}
+
+// listLintedPolicies lists the policies of kind, in every namespace when
+// namespace is empty
+func (h *Handler) listLintedPolicies(ctx context.Context, kind, namespace string) ([]lintedPolicy, error) {
+	gvr := ciliumNetworkPolicyResource
+	if kind == ciliumClusterwideNetworkPolicyKind {
+		gvr = ciliumClusterwidePolicyResource
+	}
+	list, err := h.DynamicKubeClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	// No policy exists until Cilium is installed
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var policies []lintedPolicy
+	for _, item := range list.Items {
+		policies = append(policies, lintedPolicy{
+			kind:      kind,
+			namespace: item.GetNamespace(),
+			name:      item.GetName(),
+			rules:     policyRules(item.Object),
+		})
+	}
+	return policies, nil
+}
+
+// lintSelectors flags the allow rules selecting every endpoint, the
+// selectors of the deny rules are broad on purpose
+func lintSelectors(p lintedPolicy, rule policyRule) []PolicyLintFinding {
+	var findings []PolicyLintFinding
+	finding := func(severity, field, message string) {
+		findings = append(findings, PolicyLintFinding{Check: lintBroadSelector, Severity: severity, Policy: p.String(), Namespace: p.namespace, Field: field, Message: message})
+	}
+
+	everyEndpoint := "every endpoint of the namespace"
+	if p.kind == ciliumClusterwideNetworkPolicyKind {
+		everyEndpoint = "every endpoint of the cluster"
+		if sel, ok := rule.spec["endpointSelector"]; ok && emptySelector(sel) && allowsTraffic(rule.spec) {
+			finding(severityLow, rule.field+".endpointSelector", "the empty selector applies the allow rules to "+everyEndpoint)
+		}
+	}
+
+	for _, direction := range []string{"ingress", "egress"} {
+		peer := "from"
+		if direction == "egress" {
+			peer = "to"
+		}
+		sections, _ := rule.spec[direction].([]interface{})
+		for i, s := range sections {
+			section, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			field := fmt.Sprintf("%s.%s[%d]", rule.field, direction, i)
+
+			endpoints, _ := section[peer+"Endpoints"].([]interface{})
+			for j, sel := range endpoints {
+				if emptySelector(sel) {
+					severity := severityLow
+					if p.kind == ciliumClusterwideNetworkPolicyKind {
+						severity = severityMedium
+					}
+					finding(severity, fmt.Sprintf("%s.%sEndpoints[%d]", field, peer, j), fmt.Sprintf("the empty selector allows %s %s", direction, everyEndpoint))
+				}
+			}
+
+			entities, _ := section[peer+"Entities"].([]interface{})
+			for _, e := range entities {
+				switch entity, _ := e.(string); entity {
+				case "all":
+					finding(severityHigh, field+"."+peer+"Entities", fmt.Sprintf("the all entity allows %s with any peer, inside or outside the cluster", direction))
+				case "world":
+					if direction == "ingress" {
+						finding(severityMedium, field+"."+peer+"Entities", "the world entity exposes the endpoints to any address outside the cluster")
+					}
+				}
+			}
+
+			for _, cidr := range sectionCIDRs(section, peer) {
+				if cidr == "0.0.0.0/0" || cidr == "::/0" {
+					finding(severityMedium, field+"."+peer+"CIDR", fmt.Sprintf("%s allows %s with any address, select the networks or use the world entity", cidr, direction))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// lintDNSEgress flags the toFQDNs rules whose endpoints can't look the
+// names up through the DNS proxy: the rules only match the addresses the
+// proxy has seen, so they never allow anything without a DNS rule
+func lintDNSEgress(p lintedPolicy, rule policyRule, all []lintedPolicy) []PolicyLintFinding {
+	sections, _ := rule.spec["egress"].([]interface{})
+	var fqdn []int
+	for i, s := range sections {
+		if section, ok := s.(map[string]interface{}); ok && hasSections(section, "toFQDNs") {
+			fqdn = append(fqdn, i)
+		}
+	}
+	if len(fqdn) == 0 || dnsCovered(p, rule, all) {
+		return nil
+	}
+
+	var findings []PolicyLintFinding
+	for _, i := range fqdn {
+		findings = append(findings, PolicyLintFinding{
+			Check:     lintMissingDNS,
+			Severity:  severityHigh,
+			Policy:    p.String(),
+			Namespace: p.namespace,
+			Field:     fmt.Sprintf("%s.egress[%d].toFQDNs", rule.field, i),
+			Message:   "no egress rule of the selected endpoints sends their DNS lookups through the DNS proxy, allow port 53 with a dns rule",
+		})
+	}
+	return findings
+}
+
+// dnsCovered reports whether a rule with a DNS proxy rule applies to the
+// endpoints of rule: the rule itself, or a policy of its namespace or a
+// clusterwide one selecting the same endpoints or every endpoint
+func dnsCovered(p lintedPolicy, rule policyRule, all []lintedPolicy) bool {
+	if hasDNSRule(rule.spec) {
+		return true
+	}
+	selector := rule.spec["endpointSelector"]
+	for _, other := range all {
+		if other.kind == ciliumNetworkPolicyKind && other.namespace != p.namespace {
+			continue
+		}
+		for _, r := range other.rules {
+			sel, ok := r.spec["endpointSelector"]
+			if !ok {
+				continue
+			}
+			if (emptySelector(sel) || reflect.DeepEqual(sel, selector)) && hasDNSRule(r.spec) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasDNSRule reports whether a rule redirects egress DNS to the proxy
+func hasDNSRule(spec map[string]interface{}) bool {
+	sections, _ := spec["egress"].([]interface{})
+	for _, s := range sections {
+		section, _ := s.(map[string]interface{})
+		toPorts, _ := section["toPorts"].([]interface{})
+		for _, p := range toPorts {
+			portRule, _ := p.(map[string]interface{})
+			rules, _ := portRule["rules"].(map[string]interface{})
+			if dns, _ := rules["dns"].([]interface{}); len(dns) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lintShadowedRules flags the allow sections which never take effect: the
+// ones denied by a deny section, which takes precedence, and the ones
+// covered by another allow section of the same peers on every port. The L7
+// rules of a covered section are bypassed.
+func lintShadowedRules(p lintedPolicy, rule policyRule) []PolicyLintFinding {
+	var findings []PolicyLintFinding
+	finding := func(severity, field, message string) {
+		findings = append(findings, PolicyLintFinding{Check: lintShadowedRule, Severity: severity, Policy: p.String(), Namespace: p.namespace, Field: field, Message: message})
+	}
+
+	for _, direction := range []string{"ingress", "egress"} {
+		allows, _ := rule.spec[direction].([]interface{})
+		denies, _ := rule.spec[direction+"Deny"].([]interface{})
+		for i, a := range allows {
+			allow, ok := a.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			field := fmt.Sprintf("%s.%s[%d]", rule.field, direction, i)
+			peers := sectionPeers(allow)
+
+			for j, d := range denies {
+				deny, ok := d.(map[string]interface{})
+				if !ok || !reflect.DeepEqual(peers, sectionPeers(deny)) {
+					continue
+				}
+				if !hasSections(deny, "toPorts") || reflect.DeepEqual(sectionPorts(allow), sectionPorts(deny)) {
+					finding(severityMedium, field, fmt.Sprintf("the same traffic is denied by %s.%sDeny[%d], deny rules take precedence", rule.field, direction, j))
+				}
+			}
+
+			for j, o := range allows {
+				other, ok := o.(map[string]interface{})
+				if !ok || j == i || !reflect.DeepEqual(peers, sectionPeers(other)) {
+					continue
+				}
+				otherField := fmt.Sprintf("%s.%s[%d]", rule.field, direction, j)
+				switch {
+				case reflect.DeepEqual(allow, other):
+					// Only the second of two duplicates is reported
+					if j < i {
+						finding(severityLow, field, "duplicate of "+otherField)
+					}
+				case hasSections(allow, "toPorts") && !hasSections(other, "toPorts"):
+					if hasL7Rules(allow) {
+						finding(severityHigh, field, fmt.Sprintf("the L7 rules are bypassed, %s allows every port of the same peers", otherField))
+					} else {
+						finding(severityLow, field, fmt.Sprintf("redundant, %s allows every port of the same peers", otherField))
+					}
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// lintDenyAllGaps flags the namespaces running pods which no baseline
+// policy puts in default deny: without a policy selecting every endpoint,
+// the endpoints no other policy selects allow all traffic
+func (h *Handler) lintDenyAllGaps(ctx context.Context, namespace string, all []lintedPolicy) ([]PolicyLintFinding, error) {
+	namespaces := []string{namespace}
+	if namespace == "" {
+		list, err := h.KubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		namespaces = namespaces[:0]
+		for _, ns := range list.Items {
+			namespaces = append(namespaces, ns.Name)
+		}
+		sort.Strings(namespaces)
+	}
+
+	var findings []PolicyLintFinding
+	for _, ns := range namespaces {
+		pods, err := h.KubeClient.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(pods.Items) == 0 {
+			continue
+		}
+		for _, direction := range []string{"ingress", "egress"} {
+			if defaultDenied(ns, direction, all) {
+				continue
+			}
+			findings = append(findings, PolicyLintFinding{
+				Check:     lintDenyAllGap,
+				Severity:  severityMedium,
+				Namespace: ns,
+				Message:   fmt.Sprintf("no policy selecting every endpoint puts the %s of the namespace in default deny", direction),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// defaultDenied reports whether a policy of namespace, or a clusterwide
+// one, selects every endpoint with a rule of direction. Cilium denies the
+// traffic of a direction no rule allows once a rule of it selects an
+// endpoint, unless the rule opts out with enableDefaultDeny.
+func defaultDenied(namespace, direction string, all []lintedPolicy) bool {
+	for _, p := range all {
+		if p.kind == ciliumNetworkPolicyKind && p.namespace != namespace {
+			continue
+		}
+		for _, r := range p.rules {
+			sel, ok := r.spec["endpointSelector"]
+			if !ok || !emptySelector(sel) {
+				continue
+			}
+			if _, ok := r.spec[direction]; !ok {
+				if _, ok := r.spec[direction+"Deny"]; !ok {
+					continue
+				}
+			}
+			if enabled, ok := nestedValue(r.spec, "enableDefaultDeny", direction).(bool); ok && !enabled {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// emptySelector reports whether a label selector selects everything
+func emptySelector(v interface{}) bool {
+	sel, ok := v.(map[string]interface{})
+	if v != nil && !ok {
+		return false
+	}
+	labels, _ := sel["matchLabels"].(map[string]interface{})
+	expressions, _ := sel["matchExpressions"].([]interface{})
+	return len(labels) == 0 && len(expressions) == 0
+}
+
+// hasSections reports whether key of m is a non-empty list
+func hasSections(m map[string]interface{}, key string) bool {
+	list, _ := m[key].([]interface{})
+	return len(list) > 0
+}
+
+// allowsTraffic reports whether a rule has allow sections, the empty ones
+// of the baseline policies only put the endpoints in default deny
+func allowsTraffic(spec map[string]interface{}) bool {
+	for _, direction := range []string{"ingress", "egress"} {
+		sections, _ := spec[direction].([]interface{})
+		for _, s := range sections {
+			if section, _ := s.(map[string]interface{}); len(section) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasL7Rules reports whether a section redirects some of its ports to the
+// proxy
+func hasL7Rules(section map[string]interface{}) bool {
+	toPorts, _ := section["toPorts"].([]interface{})
+	for _, p := range toPorts {
+		portRule, _ := p.(map[string]interface{})
+		if rules, _ := portRule["rules"].(map[string]interface{}); len(rules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sectionPeers returns the peers of a section, without its ports
+func sectionPeers(section map[string]interface{}) map[string]interface{} {
+	peers := map[string]interface{}{}
+	for k, v := range section {
+		if k != "toPorts" && k != "icmps" {
+			peers[k] = v
+		}
+	}
+	return peers
+}
+
+// sectionPorts returns the ports of a section, without their L7 rules
+func sectionPorts(section map[string]interface{}) []interface{} {
+	toPorts, _ := section["toPorts"].([]interface{})
+	var ports []interface{}
+	for _, p := range toPorts {
+		portRule, _ := p.(map[string]interface{})
+		ports = append(ports, portRule["ports"])
+	}
+	return ports
+}
+
+// sectionCIDRs returns the CIDRs a section allows, from its CIDR lists and
+// CIDR sets
+func sectionCIDRs(section map[string]interface{}, peer string) []string {
+	var cidrs []string
+	list, _ := section[peer+"CIDR"].([]interface{})
+	for _, c := range list {
+		if cidr, ok := c.(string); ok {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	sets, _ := section[peer+"CIDRSet"].([]interface{})
+	for _, s := range sets {
+		set, _ := s.(map[string]interface{})
+		if cidr, ok := set["cidr"].(string); ok {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
+
+func nestedValue(m map[string]interface{}, fields ...string) interface{} {
+	var cur interface{} = m
+	for _, f := range fields {
+		next, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = next[f]
+	}
+	return cur
+}
+
+func (h *Handler) policyLintPath() string {
+	return h.statePath(policyLintHistory)
+}
+
+// recordLintScore adds the score of a run to the history of its scope and
+// sets the previous scores of the report
+func (h *Handler) recordLintScore(report *PolicyLintReport) error {
+	policyLintMu.Lock()
+	defer policyLintMu.Unlock()
+
+	history := map[string][]PolicyLintScore{}
+	byt, err := ioutil.ReadFile(h.policyLintPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(byt, &history); err != nil {
+			return err
+		}
+	}
+
+	scores := history[report.Scope]
+	if len(scores) > 0 {
+		previous := scores[len(scores)-1]
+		report.Previous = &previous
+	}
+	report.History = append([]PolicyLintScore{}, scores...)
+
+	scores = append(scores, PolicyLintScore{Time: time.Now().UTC(), Score: report.Score, Findings: len(report.Findings)})
+	if len(scores) > maxLintHistory {
+		scores = scores[len(scores)-maxLintHistory:]
+	}
+	history[report.Scope] = scores
+	if byt, err = json.MarshalIndent(history, "", "  "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(h.policyLintPath(), byt, 0600)
+}
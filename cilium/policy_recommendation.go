@@ -0,0 +1,504 @@
+package cilium
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/layer5io/meshery-cilium/internal/cli"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultRecommendationWindow   = time.Hour
+	defaultRecommendationMaxFlows = 10000
+)
+
+// unselectableLabels are the labels of the endpoints which differ between
+// the pods of a workload, or are derived by Cilium, and are left out of the
+// recommended selectors
+var unselectableLabels = []string{
+	"k8s:pod-template-hash",
+	"k8s:controller-revision-hash",
+	"k8s:pod-template-generation",
+	"k8s:statefulset.kubernetes.io/pod-name",
+	"k8s:apps.kubernetes.io/pod-index",
+	"k8s:io.cilium.k8s.policy.cluster",
+	"k8s:io.cilium.k8s.policy.serviceaccount",
+}
+
+// PolicyRecommendationRequest is the body of the policy recommendation
+// operation
+type PolicyRecommendationRequest struct {
+	// Namespace holds the workloads the policies are recommended for
+	Namespace string `json:"namespace"`
+	// Workload is a label selector restricting the workloads of the
+	// namespace, e.g. app=reviews, every workload by default
+	Workload string `json:"workload,omitempty"`
+	// Since is the window of the observed flows, 1h by default
+	Since string `json:"since,omitempty"`
+	// MaxFlows caps the flows read from Hubble Relay
+	MaxFlows int `json:"maxFlows,omitempty"`
+}
+
+// PolicyRecommendation describes the policies synthesized from the flows
+type PolicyRecommendation struct {
+	Namespace string `json:"namespace"`
+	Since     string `json:"since"`
+	Flows     int    `json:"flows"`
+	// Skipped counts the flows no rule is recommended for, e.g. replies
+	// and ICMP
+	Skipped  int                 `json:"skipped"`
+	Policies []RecommendedPolicy `json:"policies"`
+	// Design is the Meshery design holding the policies as components
+	Design string `json:"design,omitempty"`
+}
+
+// RecommendedPolicy is a policy synthesized for a workload
+type RecommendedPolicy struct {
+	Name     string            `json:"name"`
+	Selector map[string]string `json:"selector"`
+	Ingress  []string          `json:"ingress"`
+	Egress   []string          `json:"egress"`
+}
+
+// observedEndpoint is a side of a flow as output by hubble observe
+type observedEndpoint struct {
+	Namespace string   `json:"namespace"`
+	Labels    []string `json:"labels"`
+	PodName   string   `json:"pod_name"`
+}
+
+type observedPort struct {
+	DestinationPort int `json:"destination_port"`
+}
+
+// observedFlow is the part of a flow the recommendations are derived from
+type observedFlow struct {
+	IP *struct {
+		Destination string `json:"destination"`
+	} `json:"IP"`
+	L4 *struct {
+		TCP  *observedPort `json:"TCP"`
+		UDP  *observedPort `json:"UDP"`
+		SCTP *observedPort `json:"SCTP"`
+	} `json:"l4"`
+	Source           *observedEndpoint `json:"source"`
+	Destination      *observedEndpoint `json:"destination"`
+	IsReply          bool              `json:"is_reply"`
+	DestinationNames []string          `json:"destination_names"`
+}
+
+// port is the destination port and protocol of a flow, e.g. 80/TCP
+func (f observedFlow) port() (string, bool) {
+	if f.L4 == nil {
+		return "", false
+	}
+	switch {
+	case f.L4.TCP != nil:
+		return fmt.Sprintf("%d/TCP", f.L4.TCP.DestinationPort), true
+	case f.L4.UDP != nil:
+		return fmt.Sprintf("%d/UDP", f.L4.UDP.DestinationPort), true
+	case f.L4.SCTP != nil:
+		return fmt.Sprintf("%d/SCTP", f.L4.SCTP.DestinationPort), true
+	}
+	return "", false
+}
+
+// policyPeer is what a rule allows traffic from or to: endpoints selected
+// by their labels, an entity, a domain name or a CIDR
+type policyPeer struct {
+	kind     string
+	value    string
+	selector map[string]string
+}
+
+func (p policyPeer) String() string {
+	return p.kind + ":" + p.value
+}
+
+// recommendedRules are the peers and ports observed for a workload
+type recommendedRules struct {
+	selector map[string]string
+	ingress  map[string]map[string]bool
+	egress   map[string]map[string]bool
+	peers    map[string]policyPeer
+}
+
+func (r *recommendedRules) allow(rules map[string]map[string]bool, peer policyPeer, port string) {
+	key := peer.String()
+	r.peers[key] = peer
+	if rules[key] == nil {
+		rules[key] = map[string]bool{}
+	}
+	rules[key][port] = true
+}
+
+// recommendPolicies reads the flows of the namespace from Hubble Relay and
+// synthesizes a least-privilege CiliumNetworkPolicy per workload, allowing
+// only the peers and ports observed. The policies are returned as the
+// components of a Meshery design to be reviewed and imported, nothing is
+// applied to the cluster.
+func (h *Handler) recommendPolicies(ctx context.Context, request adapter.OperationRequest) (string, *PolicyRecommendation, error) {
+	if request.IsDeleteOperation {
+		return status.Running, nil, ErrOpInvalid
+	}
+	if h.KubeClient == nil {
+		return status.Running, nil, ErrNilClient
+	}
+	req := PolicyRecommendationRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return status.Running, nil, ErrPolicyRecommendation(err)
+	}
+	if req.Namespace == "" {
+		req.Namespace = request.Namespace
+	}
+	if req.Namespace == "" {
+		return status.Running, nil, ErrPolicyRecommendation(fmt.Errorf("the namespace of the workloads is required"))
+	}
+	since := defaultRecommendationWindow
+	if req.Since != "" {
+		var err error
+		if since, err = time.ParseDuration(req.Since); err != nil || since <= 0 {
+			return status.Running, nil, ErrPolicyRecommendation(fmt.Errorf("since must be a positive duration, e.g. 30m"))
+		}
+	}
+	if req.MaxFlows <= 0 {
+		req.MaxFlows = defaultRecommendationMaxFlows
+	}
+	workload := labels.Everything()
+	if req.Workload != "" {
+		var err error
+		if workload, err = labels.Parse(req.Workload); err != nil {
+			return status.Running, nil, ErrPolicyRecommendation(err)
+		}
+	}
+
+	if _, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Get(ctx, hubbleRelayName, metav1.GetOptions{}); err != nil {
+		if kerrors.IsNotFound(err) {
+			err = fmt.Errorf("the hubble-relay Deployment is missing, enable hubble.relay in the Cilium values")
+		}
+		return status.Running, nil, ErrPolicyRecommendation(err)
+	}
+
+	args := []string{"observe", "--port-forward", "--output", "json",
+		"--namespace", req.Namespace,
+		"--since", since.String(),
+		"--last", strconv.Itoa(req.MaxFlows),
+		"--verdict", "FORWARDED", "--verdict", "AUDIT",
+	}
+	// The certificate of the relay is verified when it serves over TLS
+	tlsArgs, cleanup, err := h.hubbleTLSArgs(ctx)
+	if err != nil {
+		return status.Running, nil, ErrPolicyRecommendation(err)
+	}
+	defer cleanup()
+	reportProgress(ctx, "Reading the flows from Hubble Relay", "hubble "+strings.Join(args, " "))
+	out, err := h.runCLI(ctx, cli.Hubble, append(args, tlsArgs...)...)
+	if err != nil {
+		return status.Running, nil, ErrPolicyRecommendation(err)
+	}
+
+	report := &PolicyRecommendation{Namespace: req.Namespace, Since: since.String(), Policies: []RecommendedPolicy{}}
+	workloads := map[string]*recommendedRules{}
+	local := func(ep *observedEndpoint) *recommendedRules {
+		if ep == nil || ep.Namespace != req.Namespace || ep.PodName == "" {
+			return nil
+		}
+		selector := endpointSelector(ep.Labels, false)
+		if !workload.Matches(labels.Set(trimmedLabels(selector))) {
+			return nil
+		}
+		key := labels.Set(selector).String()
+		if workloads[key] == nil {
+			workloads[key] = &recommendedRules{
+				selector: selector,
+				ingress:  map[string]map[string]bool{},
+				egress:   map[string]map[string]bool{},
+				peers:    map[string]policyPeer{},
+			}
+		}
+		return workloads[key]
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			Flow *observedFlow `json:"flow"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Flow == nil {
+			continue
+		}
+		report.Flows++
+		f := line.Flow
+		port, ok := f.port()
+		if f.IsReply || !ok {
+			report.Skipped++
+			continue
+		}
+		src, dst := local(f.Source), local(f.Destination)
+		if src == nil && dst == nil {
+			report.Skipped++
+			continue
+		}
+		if src != nil {
+			src.allow(src.egress, egressPeer(f), port)
+		}
+		if dst != nil {
+			dst.allow(dst.ingress, ingressPeer(f.Source), port)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return status.Running, report, ErrPolicyRecommendation(err)
+	}
+
+	keys := make([]string, 0, len(workloads))
+	for k := range workloads {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	services := map[string]interface{}{}
+	for _, k := range keys {
+		rules := workloads[k]
+		name := recommendedPolicyName(rules.selector, services)
+		services[name] = map[string]interface{}{
+			"name":       name,
+			"type":       ciliumNetworkPolicyKind,
+			"apiVersion": "cilium.io/v2",
+			"namespace":  req.Namespace,
+			"settings":   recommendedPolicySpec(rules),
+		}
+		report.Policies = append(report.Policies, RecommendedPolicy{
+			Name:     name,
+			Selector: rules.selector,
+			Ingress:  describeRules(rules.ingress),
+			Egress:   describeRules(rules.egress),
+		})
+	}
+	if len(services) == 0 {
+		return status.Completed, report, nil
+	}
+
+	design, err := yaml.Marshal(map[string]interface{}{
+		"name":     "cilium-recommended-policies-" + req.Namespace,
+		"services": services,
+	})
+	if err != nil {
+		return status.Running, report, ErrPolicyRecommendation(err)
+	}
+	report.Design = string(design)
+	return status.Completed, report, nil
+}
+
+// endpointSelector selects the endpoints by the labels of a side of a flow,
+// along with their namespace when it is a peer
+func endpointSelector(endpointLabels []string, peer bool) map[string]string {
+	res := map[string]string{}
+	for _, l := range endpointLabels {
+		if !strings.HasPrefix(l, "k8s:") || contains(unselectableLabels, strings.SplitN(l, "=", 2)[0]) {
+			continue
+		}
+		kv := strings.SplitN(l, "=", 2)
+		if strings.HasPrefix(kv[0], "k8s:io.cilium.k8s.namespace.labels.") {
+			continue
+		}
+		if kv[0] == "k8s:"+podNamespaceLabel && !peer {
+			continue
+		}
+		val := ""
+		if len(kv) == 2 {
+			val = kv[1]
+		}
+		res[kv[0]] = val
+	}
+	return res
+}
+
+// trimmedLabels removes the source of the labels of a selector so that it
+// can be matched against a pod label selector
+func trimmedLabels(selector map[string]string) map[string]string {
+	res := map[string]string{}
+	for k, v := range selector {
+		res[trimLabelSource(k)] = v
+	}
+	return res
+}
+
+// reservedEntity returns the entity of the reserved identities, e.g. world
+// for reserved:world
+func reservedEntity(endpointLabels []string) string {
+	for _, l := range endpointLabels {
+		if strings.HasPrefix(l, "reserved:") {
+			return strings.TrimPrefix(strings.SplitN(l, "=", 2)[0], "reserved:")
+		}
+	}
+	return ""
+}
+
+func ingressPeer(src *observedEndpoint) policyPeer {
+	if src == nil {
+		return policyPeer{kind: "entity", value: "world"}
+	}
+	if entity := reservedEntity(src.Labels); entity != "" {
+		return policyPeer{kind: "entity", value: entity}
+	}
+	sel := endpointSelector(src.Labels, true)
+	return policyPeer{kind: "endpoints", value: labels.Set(sel).String(), selector: sel}
+}
+
+// egressPeer is the destination of a flow, the names looked up for the
+// destinations outside the cluster are preferred over their addresses
+func egressPeer(f *observedFlow) policyPeer {
+	dst := f.Destination
+	if dst == nil {
+		return policyPeer{kind: "entity", value: "world"}
+	}
+	entity := reservedEntity(dst.Labels)
+	switch {
+	case entity == "world" && len(f.DestinationNames) > 0:
+		return policyPeer{kind: "fqdn", value: f.DestinationNames[0]}
+	case entity == "world" && f.IP != nil && f.IP.Destination != "":
+		suffix := "/32"
+		if strings.Contains(f.IP.Destination, ":") {
+			suffix = "/128"
+		}
+		return policyPeer{kind: "cidr", value: f.IP.Destination + suffix}
+	case entity != "":
+		return policyPeer{kind: "entity", value: entity}
+	}
+	sel := endpointSelector(dst.Labels, true)
+	return policyPeer{kind: "endpoints", value: labels.Set(sel).String(), selector: sel}
+}
+
+// recommendedPolicyName names the policy after the app label of the
+// workload, unique among the policies of the design
+func recommendedPolicyName(selector map[string]string, taken map[string]interface{}) string {
+	base := "workload"
+	for _, key := range []string{"k8s:app.kubernetes.io/name", "k8s:app", "k8s:k8s-app", "k8s:name"} {
+		if v := selector[key]; v != "" {
+			base = v
+			break
+		}
+	}
+	name := base + "-recommended"
+	for i := 2; taken[name] != nil; i++ {
+		name = fmt.Sprintf("%s-recommended-%d", base, i)
+	}
+	return name
+}
+
+// recommendedPolicySpec renders the rules of a workload, a rule per peer.
+// The lookups of the domain names are allowed through the DNS proxy of
+// the agents so that toFQDNs learns their addresses.
+func recommendedPolicySpec(r *recommendedRules) map[string]interface{} {
+	spec := map[string]interface{}{
+		"endpointSelector": map[string]interface{}{"matchLabels": stringMap(r.selector)},
+	}
+
+	ingress := []interface{}{}
+	for _, key := range sortedPeers(r.ingress) {
+		rule := peerRule(r.peers[key], "from")
+		rule["toPorts"] = portRules(r.ingress[key])
+		ingress = append(ingress, rule)
+	}
+	if len(ingress) > 0 {
+		spec["ingress"] = ingress
+	}
+
+	egress := []interface{}{}
+	var lookups []interface{}
+	for _, key := range sortedPeers(r.egress) {
+		peer := r.peers[key]
+		rule := peerRule(peer, "to")
+		rule["toPorts"] = portRules(r.egress[key])
+		egress = append(egress, rule)
+		if peer.kind == "fqdn" {
+			lookups = append(lookups, map[string]interface{}{"matchName": peer.value})
+		}
+	}
+	if len(lookups) > 0 {
+		egress = append(egress, map[string]interface{}{
+			"toEndpoints": []interface{}{map[string]interface{}{"matchLabels": map[string]interface{}{
+				"k8s:" + podNamespaceLabel: "kube-system",
+				"k8s:k8s-app":              "kube-dns",
+			}}},
+			"toPorts": []interface{}{map[string]interface{}{
+				"ports": []interface{}{map[string]interface{}{"port": "53", "protocol": "ANY"}},
+				"rules": map[string]interface{}{"dns": lookups},
+			}},
+		})
+	}
+	if len(egress) > 0 {
+		spec["egress"] = egress
+	}
+	return spec
+}
+
+// peerRule renders the peer of a rule, direction is from for the ingress
+// and to for the egress
+func peerRule(p policyPeer, direction string) map[string]interface{} {
+	switch p.kind {
+	case "entity":
+		return map[string]interface{}{direction + "Entities": []interface{}{p.value}}
+	case "fqdn":
+		return map[string]interface{}{"toFQDNs": []interface{}{map[string]interface{}{"matchName": p.value}}}
+	case "cidr":
+		return map[string]interface{}{direction + "CIDR": []interface{}{p.value}}
+	}
+	return map[string]interface{}{direction + "Endpoints": []interface{}{map[string]interface{}{"matchLabels": stringMap(p.selector)}}}
+}
+
+func portRules(ports map[string]bool) []interface{} {
+	list := make([]interface{}, 0, len(ports))
+	for _, p := range sortedSet(ports) {
+		portProto := strings.SplitN(p, "/", 2)
+		list = append(list, map[string]interface{}{"port": portProto[0], "protocol": portProto[1]})
+	}
+	return []interface{}{map[string]interface{}{"ports": list}}
+}
+
+// describeRules lists the rules as peer ports, e.g. endpoints:k8s:app=db 5432/TCP
+func describeRules(rules map[string]map[string]bool) []string {
+	res := []string{}
+	for _, key := range sortedPeers(rules) {
+		res = append(res, key+" "+strings.Join(sortedSet(rules[key]), ","))
+	}
+	return res
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+func sortedPeers(rules map[string]map[string]bool) []string {
+	keys := make([]string, 0, len(rules))
+	for k := range rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,317 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	internalconfig "github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshkit/models/oam/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	policyTestPrefix     = "meshery-policy-test-"
+	policyTestImage      = "registry.k8s.io/e2e-test-images/agnhost:2.39"
+	policyTestContainer  = "fixture"
+	policyTestTimeout    = 5 * time.Second
+	fixtureReadyTimeout  = 3 * time.Minute
+	fixturePollInterval  = 2 * time.Second
+	assertionAllow       = "allow"
+	assertionDeny        = "deny"
+	defaultAssertionPort = 80
+)
+
+// PolicyTestBundle is the body of the policy test operation: the policies
+// under test, the pods they apply to and the traffic expected between them
+type PolicyTestBundle struct {
+	// Namespace the fixtures and the namespaced policies are created in, a
+	// dedicated namespace is generated and removed afterwards when empty
+	Namespace string `json:"namespace,omitempty"`
+	// Keep leaves the fixtures and policies in place after the run
+	Keep       bool                     `json:"keep,omitempty"`
+	Fixtures   []PolicyTestFixture      `json:"fixtures"`
+	Policies   []map[string]interface{} `json:"policies"`
+	Assertions []PolicyTestAssertion    `json:"assertions"`
+}
+
+// PolicyTestFixture is a pod the policies select and the assertions connect
+// from or to. It accepts TCP connections on its ports.
+type PolicyTestFixture struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Ports  []int             `json:"ports,omitempty"`
+}
+
+// PolicyTestAssertion is a connection expected to be allowed or denied
+type PolicyTestAssertion struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Port   int    `json:"port,omitempty"`
+	Expect string `json:"expect"`
+}
+
+// PolicyTestResult is the outcome of an assertion
+type PolicyTestResult struct {
+	PolicyTestAssertion
+	Observed string `json:"observed"`
+	Passed   bool   `json:"passed"`
+	Output   string `json:"output,omitempty"`
+}
+
+// PolicyTestReport is the outcome of a policy test run
+type PolicyTestReport struct {
+	Namespace string             `json:"namespace"`
+	Policies  []string           `json:"policies"`
+	Passed    int                `json:"passed"`
+	Failed    int                `json:"failed"`
+	Results   []PolicyTestResult `json:"results"`
+}
+
+// parsePolicyTestBundle reads and validates the body of the operation
+func parsePolicyTestBundle(body string) (PolicyTestBundle, error) {
+	bundle := PolicyTestBundle{}
+	if err := yaml.Unmarshal([]byte(body), &bundle); err != nil {
+		return bundle, err
+	}
+
+	fixtures := map[string]PolicyTestFixture{}
+	for _, f := range bundle.Fixtures {
+		if f.Name == "" {
+			return bundle, fmt.Errorf("fixtures need a name")
+		}
+		fixtures[f.Name] = f
+	}
+	for _, p := range bundle.Policies {
+		kind, _ := p["kind"].(string)
+		if _, ok := policyCRDs[kind]; !ok {
+			return bundle, fmt.Errorf("unsupported policy kind %q", kind)
+		}
+	}
+	if len(bundle.Assertions) == 0 {
+		return bundle, fmt.Errorf("at least one assertion is required")
+	}
+	for i, a := range bundle.Assertions {
+		if _, ok := fixtures[a.From]; !ok {
+			return bundle, fmt.Errorf("assertions[%d]: unknown fixture %q", i, a.From)
+		}
+		if _, ok := fixtures[a.To]; !ok {
+			return bundle, fmt.Errorf("assertions[%d]: unknown fixture %q", i, a.To)
+		}
+		if a.Expect != assertionAllow && a.Expect != assertionDeny {
+			return bundle, fmt.Errorf("assertions[%d]: expect must be %s or %s", i, assertionAllow, assertionDeny)
+		}
+		if a.Port == 0 {
+			bundle.Assertions[i].Port = defaultAssertionPort
+		}
+	}
+	return bundle, nil
+}
+
+// runPolicyTests spins up the fixtures of a bundle, applies its policies,
+// waits for them to be enforced and checks every assertion by connecting
+// from the source fixture to the destination one. The fixtures and
+// policies are removed afterwards unless the bundle keeps them.
+func (h *Handler) runPolicyTests(ctx context.Context, request adapter.OperationRequest) (string, *PolicyTestReport, error) {
+	st := status.Deploying
+	bundle, err := parsePolicyTestBundle(request.CustomBody)
+	if err != nil {
+		return st, nil, ErrPolicyTest(err)
+	}
+	if h.KubeClient == nil {
+		return st, nil, ErrNilClient
+	}
+
+	if request.IsDeleteOperation && bundle.Namespace == "" {
+		return status.Removing, nil, ErrPolicyTest(fmt.Errorf("the namespace of the run to remove is required"))
+	}
+	createNamespace := bundle.Namespace == ""
+	if createNamespace {
+		suffix, err := randomHex(3)
+		if err != nil {
+			return st, nil, ErrPolicyTest(err)
+		}
+		bundle.Namespace = policyTestPrefix + suffix
+	}
+	report := &PolicyTestReport{Namespace: bundle.Namespace}
+
+	fixtures, err := fixturesManifest(bundle, createNamespace)
+	if err != nil {
+		return st, report, ErrPolicyTest(err)
+	}
+	if request.IsDeleteOperation {
+		if err := h.teardownPolicyTests(ctx, bundle, fixtures); err != nil {
+			return status.Removing, report, ErrPolicyTest(err)
+		}
+		return status.Removed, report, nil
+	}
+
+	if !bundle.Keep {
+		defer func() {
+			if err := h.teardownPolicyTests(context.TODO(), bundle, fixtures); err != nil {
+				h.Log.Error(ErrPolicyTest(err))
+			}
+		}()
+	}
+
+	if err := h.applyOrdered(ctx, fixtures, false, bundle.Namespace); err != nil {
+		return st, report, ErrPolicyTest(err)
+	}
+	ips, err := h.waitForFixtures(ctx, bundle)
+	if err != nil {
+		return st, report, ErrPolicyTest(err)
+	}
+
+	for _, policy := range bundle.Policies {
+		comp, kind := policyTestComponent(policy, bundle.Namespace)
+		msg, err := handleCiliumCoreComponent(ctx, h, comp, false, "cilium.io/v2", kind)
+		if err != nil {
+			return st, report, ErrPolicyTest(err)
+		}
+		report.Policies = append(report.Policies, msg)
+	}
+
+	for _, a := range bundle.Assertions {
+		result := PolicyTestResult{PolicyTestAssertion: a, Observed: assertionAllow}
+		out, err := h.execInPod(bundle.Namespace, a.From, policyTestContainer, []string{
+			"/agnhost", "connect", fmt.Sprintf("%s:%d", ips[a.To], a.Port), "--timeout=" + policyTestTimeout.String(),
+		})
+		if err != nil {
+			result.Observed = assertionDeny
+			result.Output = strings.TrimSpace(out + " " + err.Error())
+		}
+		result.Passed = result.Observed == a.Expect
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if report.Failed > 0 {
+		return status.Completed, report, ErrPolicyTest(fmt.Errorf("%d/%d assertions failed", report.Failed, len(report.Results)))
+	}
+	return status.Completed, report, nil
+}
+
+// teardownPolicyTests removes the policies and fixtures of a bundle
+func (h *Handler) teardownPolicyTests(ctx context.Context, bundle PolicyTestBundle, fixtures []byte) error {
+	var errs []error
+	for _, policy := range bundle.Policies {
+		comp, kind := policyTestComponent(policy, bundle.Namespace)
+		if _, err := handleCiliumCoreComponent(ctx, h, comp, true, "cilium.io/v2", kind); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := h.applyOrdered(ctx, fixtures, true, bundle.Namespace); err != nil {
+		errs = append(errs, err)
+	}
+	return mergeErrors(errs)
+}
+
+// policyTestComponent turns a policy of the bundle into the component which
+// is applied like the policies deployed through Meshery
+func policyTestComponent(policy map[string]interface{}, namespace string) (v1alpha1.Component, string) {
+	kind, _ := policy["kind"].(string)
+	comp := v1alpha1.Component{}
+	if md, ok := policy["metadata"].(map[string]interface{}); ok {
+		comp.Name, _ = md["name"].(string)
+	}
+	if kind == ciliumNetworkPolicyKind {
+		comp.Namespace = namespace
+	}
+	comp.Spec.Settings, _ = policy["spec"].(map[string]interface{})
+	// The policies are test resources like the fixtures
+	comp.Labels = map[string]string{
+		ownerLabel:     fieldManager,
+		operationLabel: internalconfig.CiliumPolicyTestOperation,
+		ephemeralLabel: "true",
+	}
+	return comp, kind
+}
+
+// waitForFixtures waits for the fixtures to run and returns their IPs
+func (h *Handler) waitForFixtures(ctx context.Context, bundle PolicyTestBundle) (map[string]string, error) {
+	ips := map[string]string{}
+	err := wait.PollImmediate(fixturePollInterval, fixtureReadyTimeout, func() (bool, error) {
+		for _, f := range bundle.Fixtures {
+			pod, err := h.KubeClient.CoreV1().Pods(bundle.Namespace).Get(ctx, f.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+				return false, nil
+			}
+			ips[f.Name] = pod.Status.PodIP
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fixtures not running within %s: %s", fixtureReadyTimeout, err)
+	}
+	return ips, nil
+}
+
+// fixturesManifest renders the pods of a bundle along with their namespace
+// when it is generated. The pods run the porter of agnhost which accepts
+// connections on the ports set in its SERVE_PORT_* variables.
+func fixturesManifest(bundle PolicyTestBundle, createNamespace bool) ([]byte, error) {
+	var docs []map[string]interface{}
+	if createNamespace {
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": bundle.Namespace},
+		})
+	}
+
+	for _, f := range bundle.Fixtures {
+		labels := map[string]interface{}{"meshery.io/policy-test-fixture": f.Name}
+		for k, v := range f.Labels {
+			labels[k] = v
+		}
+		ports := f.Ports
+		if len(ports) == 0 {
+			ports = []int{defaultAssertionPort}
+		}
+		var env, containerPorts []interface{}
+		for _, p := range ports {
+			env = append(env, map[string]interface{}{"name": fmt.Sprintf("SERVE_PORT_%d", p), "value": "ok"})
+			containerPorts = append(containerPorts, map[string]interface{}{"containerPort": p})
+		}
+
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   map[string]interface{}{"name": f.Name, "namespace": bundle.Namespace, "labels": labels},
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{
+						"name":  policyTestContainer,
+						"image": policyTestImage,
+						"args":  []interface{}{"porter"},
+						"env":   env,
+						"ports": containerPorts,
+					},
+				},
+			},
+		})
+	}
+
+	var manifest []string
+	for _, doc := range docs {
+		byt, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, string(byt))
+	}
+	return []byte(strings.Join(manifest, "---\n")), nil
+}
@@ -0,0 +1,213 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	ciliumNetworkPolicyKind            = "CiliumNetworkPolicy"
+	ciliumClusterwideNetworkPolicyKind = "CiliumClusterwideNetworkPolicy"
+)
+
+// policyCRDs maps the policy kinds to the CRDs holding their schema
+var policyCRDs = map[string]string{
+	ciliumNetworkPolicyKind:            "ciliumnetworkpolicies.cilium.io",
+	ciliumClusterwideNetworkPolicyKind: "ciliumclusterwidenetworkpolicies.cilium.io",
+}
+
+// PolicyViolation is a single problem found in a Cilium policy
+type PolicyViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Message)
+}
+
+// validatePolicy checks a CiliumNetworkPolicy or CiliumClusterwideNetworkPolicy
+// against the schema of its CRD and against the rules Cilium enforces only
+// once the policy is imported by the agents
+func (h *Handler) validatePolicy(ctx context.Context, policy map[string]interface{}) error {
+	kind, _ := policy["kind"].(string)
+	name, _, _ := unstructured.NestedString(policy, "metadata", "name")
+
+	violations, err := h.validatePolicySchema(ctx, kind, policy)
+	if err != nil {
+		return ErrValidatePolicy(kind, name, err)
+	}
+
+	violations = append(violations, ruleViolations(kind, policy)...)
+
+	if len(violations) > 0 {
+		return ErrInvalidPolicy(kind, name, violations)
+	}
+	return nil
+}
+
+// policyRule is a rule of a policy along with its field in the policy
+type policyRule struct {
+	field string
+	spec  map[string]interface{}
+}
+
+// policyRules returns the rules of a policy, held in spec or in specs
+func policyRules(policy map[string]interface{}) []policyRule {
+	var rules []policyRule
+	if spec, ok := policy["spec"].(map[string]interface{}); ok {
+		rules = append(rules, policyRule{field: "spec", spec: spec})
+	}
+	if list, ok := policy["specs"].([]interface{}); ok {
+		for i, s := range list {
+			if spec, ok := s.(map[string]interface{}); ok {
+				rules = append(rules, policyRule{field: fmt.Sprintf("specs[%d]", i), spec: spec})
+			}
+		}
+	}
+	return rules
+}
+
+// ruleViolations applies the semantic rules of Cilium to every rule of a
+// policy
+func ruleViolations(kind string, policy map[string]interface{}) []PolicyViolation {
+	var violations []PolicyViolation
+	for _, rule := range policyRules(policy) {
+		violations = append(violations, validateRule(kind, rule.field, rule.spec)...)
+	}
+	return violations
+}
+
+// validatePolicySchema validates the policy against the OpenAPI schema of
+// the CRD served by the cluster. The check is skipped when the CRD is not
+// installed as the apply fails on its own in that case.
+func (h *Handler) validatePolicySchema(ctx context.Context, kind string, policy map[string]interface{}) ([]PolicyViolation, error) {
+	return h.validateCRDSchema(ctx, policyCRDs[kind], policy)
+}
+
+// validateCRDSchema validates obj against the OpenAPI schema of the
+// named CRD, the check is skipped when the CRD is not installed
+func (h *Handler) validateCRDSchema(ctx context.Context, crdName string, obj map[string]interface{}) ([]PolicyViolation, error) {
+	if h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+
+	crd, err := h.DynamicKubeClient.Resource(crdResource).Get(ctx, crdName, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	apiVersion, _ := obj["apiVersion"].(string)
+	version := apiVersion[strings.LastIndex(apiVersion, "/")+1:]
+
+	schema := versionSchema(crd, version)
+	if schema == nil {
+		return []PolicyViolation{{Field: "apiVersion", Message: fmt.Sprintf("version %q is not served by %s", version, crdName)}}, nil
+	}
+
+	res, err := gojsonschema.Validate(gojsonschema.NewGoLoader(schema), gojsonschema.NewGoLoader(obj))
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []PolicyViolation
+	for _, e := range res.Errors() {
+		violations = append(violations, PolicyViolation{Field: e.Field(), Message: e.Description()})
+	}
+	return violations, nil
+}
+
+// validateRule applies the semantic rules of Cilium to a single policy rule
+func validateRule(kind, field string, rule map[string]interface{}) []PolicyViolation {
+	var violations []PolicyViolation
+
+	_, hasEndpoints := rule["endpointSelector"]
+	_, hasNodes := rule["nodeSelector"]
+	switch {
+	case hasEndpoints && hasNodes:
+		violations = append(violations, PolicyViolation{Field: field, Message: "endpointSelector and nodeSelector are mutually exclusive"})
+	case !hasEndpoints && !hasNodes:
+		violations = append(violations, PolicyViolation{Field: field, Message: "one of endpointSelector or nodeSelector is required"})
+	case hasNodes && kind == ciliumNetworkPolicyKind:
+		violations = append(violations, PolicyViolation{Field: field + ".nodeSelector", Message: "host policies require a CiliumClusterwideNetworkPolicy"})
+	}
+
+	for _, direction := range []string{"ingress", "egress", "ingressDeny", "egressDeny"} {
+		sections, _ := rule[direction].([]interface{})
+		for i, s := range sections {
+			section, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			sectionField := fmt.Sprintf("%s.%s[%d]", field, direction, i)
+			toPorts, _ := section["toPorts"].([]interface{})
+			for j, p := range toPorts {
+				portRule, ok := p.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				violations = append(violations, validatePortRule(fmt.Sprintf("%s.toPorts[%d]", sectionField, j), direction, hasNodes, portRule)...)
+			}
+		}
+	}
+
+	return violations
+}
+
+// validatePortRule checks that L7 rules are only used where the traffic
+// is redirected to the proxy
+func validatePortRule(field, direction string, hostPolicy bool, portRule map[string]interface{}) []PolicyViolation {
+	rules, ok := portRule["rules"].(map[string]interface{})
+	if !ok || len(rules) == 0 {
+		return nil
+	}
+
+	var violations []PolicyViolation
+	rulesField := field + ".rules"
+	if hostPolicy {
+		violations = append(violations, PolicyViolation{Field: rulesField, Message: "L7 rules are not supported by host policies selected with nodeSelector"})
+	}
+	if strings.HasSuffix(direction, "Deny") {
+		violations = append(violations, PolicyViolation{Field: rulesField, Message: "L7 rules are not supported in deny rules"})
+	}
+	if _, ok := rules["dns"]; ok && direction != "egress" {
+		violations = append(violations, PolicyViolation{Field: rulesField + ".dns", Message: "DNS rules are only supported in egress rules"})
+	}
+
+	ports, _ := portRule["ports"].([]interface{})
+	if len(ports) == 0 {
+		violations = append(violations, PolicyViolation{Field: field + ".ports", Message: "L7 rules require the ports that are redirected to the proxy"})
+	}
+	_, isDNS := rules["dns"]
+	for i, p := range ports {
+		port, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		portField := fmt.Sprintf("%s.ports[%d]", field, i)
+		if number := fmt.Sprint(port["port"]); number == "" || number == "0" || number == "<nil>" {
+			violations = append(violations, PolicyViolation{Field: portField + ".port", Message: "L7 rules require an explicit port"})
+		}
+		protocol, _ := port["protocol"].(string)
+		switch strings.ToUpper(protocol) {
+		case "", "ANY", "TCP":
+		case "UDP":
+			if !isDNS {
+				violations = append(violations, PolicyViolation{Field: portField + ".protocol", Message: "only DNS rules can be applied to UDP ports"})
+			}
+		default:
+			violations = append(violations, PolicyViolation{Field: portField + ".protocol", Message: fmt.Sprintf("L7 rules are not supported for protocol %s", protocol)})
+		}
+	}
+
+	return violations
+}
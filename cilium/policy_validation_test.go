@@ -0,0 +1,213 @@
+package cilium
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// violationFields returns the fields of the violations, in order
+func violationFields(violations []PolicyViolation) []string {
+	var fields []string
+	for _, v := range violations {
+		fields = append(fields, v.Field)
+	}
+	return fields
+}
+
+// parseRule reads a rule written in YAML
+func parseRule(t *testing.T, rule string) map[string]interface{} {
+	t.Helper()
+	res := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(rule), &res); err != nil {
+		t.Fatalf("parsing the rule: %s", err)
+	}
+	return res
+}
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name string
+		kind string
+		rule string
+		want []string
+	}{
+		{
+			name: "endpoint selector",
+			kind: ciliumNetworkPolicyKind,
+			rule: `
+endpointSelector: {}
+ingress:
+- fromEndpoints: [{}]
+`,
+		},
+		{
+			name: "both selectors",
+			kind: ciliumClusterwideNetworkPolicyKind,
+			rule: `
+endpointSelector: {}
+nodeSelector: {}
+`,
+			want: []string{"spec"},
+		},
+		{
+			name: "no selector",
+			kind: ciliumNetworkPolicyKind,
+			rule: `ingress: []`,
+			want: []string{"spec"},
+		},
+		{
+			name: "host policy in a namespaced policy",
+			kind: ciliumNetworkPolicyKind,
+			rule: `nodeSelector: {}`,
+			want: []string{"spec.nodeSelector"},
+		},
+		{
+			name: "host policy in a clusterwide policy",
+			kind: ciliumClusterwideNetworkPolicyKind,
+			rule: `nodeSelector: {}`,
+		},
+		{
+			name: "DNS rule on egress",
+			kind: ciliumNetworkPolicyKind,
+			rule: `
+endpointSelector: {}
+egress:
+- toPorts:
+  - ports: [{port: "53", protocol: UDP}]
+    rules:
+      dns: [{matchPattern: "*"}]
+`,
+		},
+		{
+			name: "L7 rule in a deny rule",
+			kind: ciliumNetworkPolicyKind,
+			rule: `
+endpointSelector: {}
+ingressDeny:
+- toPorts:
+  - ports: [{port: "80"}]
+    rules:
+      http: [{method: GET}]
+`,
+			want: []string{"spec.ingressDeny[0].toPorts[0].rules"},
+		},
+		{
+			name: "L7 rule in a host policy",
+			kind: ciliumClusterwideNetworkPolicyKind,
+			rule: `
+nodeSelector: {}
+ingress:
+- toPorts:
+  - ports: [{port: "80"}]
+    rules:
+      http: [{method: GET}]
+`,
+			want: []string{"spec.ingress[0].toPorts[0].rules"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationFields(validateRule(tt.kind, "spec", parseRule(t, tt.rule)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateRule() violations at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePortRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		direction  string
+		hostPolicy bool
+		portRule   string
+		want       []string
+	}{
+		{
+			name:      "no L7 rules",
+			direction: "ingress",
+			portRule:  `ports: [{port: "80"}]`,
+		},
+		{
+			name:      "HTTP rule",
+			direction: "ingress",
+			portRule: `
+ports: [{port: "80", protocol: TCP}]
+rules:
+  http: [{method: GET}]
+`,
+		},
+		{
+			name:       "HTTP rule in a host policy",
+			direction:  "ingress",
+			hostPolicy: true,
+			portRule: `
+ports: [{port: "80"}]
+rules:
+  http: [{method: GET}]
+`,
+			want: []string{"toPorts[0].rules"},
+		},
+		{
+			name:      "DNS rule on ingress",
+			direction: "ingress",
+			portRule: `
+ports: [{port: "53", protocol: UDP}]
+rules:
+  dns: [{matchPattern: "*"}]
+`,
+			want: []string{"toPorts[0].rules.dns"},
+		},
+		{
+			name:      "L7 rule without ports",
+			direction: "egress",
+			portRule: `
+rules:
+  http: [{method: GET}]
+`,
+			want: []string{"toPorts[0].ports"},
+		},
+		{
+			name:      "L7 rule on any port",
+			direction: "egress",
+			portRule: `
+ports: [{port: "0"}]
+rules:
+  http: [{method: GET}]
+`,
+			want: []string{"toPorts[0].ports[0].port"},
+		},
+		{
+			name:      "HTTP rule on a UDP port",
+			direction: "egress",
+			portRule: `
+ports: [{port: "80", protocol: UDP}]
+rules:
+  http: [{method: GET}]
+`,
+			want: []string{"toPorts[0].ports[0].protocol"},
+		},
+		{
+			name:      "L7 rule on an SCTP port",
+			direction: "egress",
+			portRule: `
+ports: [{port: "80", protocol: SCTP}]
+rules:
+  http: [{method: GET}]
+`,
+			want: []string{"toPorts[0].ports[0].protocol"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationFields(validatePortRule("toPorts[0]", tt.direction, tt.hostPolicy, parseRule(t, tt.portRule)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validatePortRule() violations at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package cilium
+
+import (
+	"context"
+
+	"github.com/layer5io/meshery-cilium/internal/events"
+)
+
+type progressKey struct{}
+
+// progressFunc reports an intermediate step of a long running operation
+type progressFunc func(summary, details string)
+
+// withProgress returns a context carrying the reporter the progress of the
+// operation it runs is streamed with
+func withProgress(ctx context.Context, report progressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// reportProgress reports a step of the operation run with ctx, it does
+// nothing when the operation was not started by Meshery
+func reportProgress(ctx context.Context, summary, details string) {
+	if report, ok := ctx.Value(progressKey{}).(progressFunc); ok {
+		report(summary, details)
+	}
+}
+
+// streamProgress streams the progress of an operation as informational
+// events, Meshery shows them while waiting for the final event
+func (h *Handler) streamProgress(operationID string) progressFunc {
+	return func(summary, details string) {
+		h.emit(events.Event{
+			Severity:    events.SeverityInfo,
+			OperationID: operationID,
+			Summary:     summary,
+			Details:     details,
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package cilium
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const ciliumGroup = "cilium.io"
+
+// tetragonCRDs are the CRDs of Tetragon, they share the group of Cilium but
+// are left to the Tetragon install
+var tetragonCRDs = []string{
+	"tracingpolicies.cilium.io",
+	"tracingpoliciesnamespaced.cilium.io",
+	"podinfo.cilium.io",
+}
+
+// PurgeRequest is the custom body of a Cilium delete removing the
+// resources the chart leaves behind
+type PurgeRequest struct {
+	Purge bool `json:"purge"`
+	// Confirm is the token of the purge plan streamed by a previous
+	// delete, the resources are only removed when it is current
+	Confirm string `json:"confirm"`
+}
+
+func parsePurgeRequest(body string) PurgeRequest {
+	req := PurgeRequest{}
+	// Bodies which are not YAML simply don't purge
+	_ = yaml.Unmarshal([]byte(body), &req)
+	return req
+}
+
+// PurgeResource is a resource removed by a purge
+type PurgeResource struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Objects are the custom resources removed along with a CRD
+	Objects int `json:"objects,omitempty"`
+}
+
+func (r PurgeResource) String() string {
+	if r.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+	}
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
+
+// PurgeReport lists the resources of a purge, they are removed once
+// Confirmed
+type PurgeReport struct {
+	Token     string          `json:"token"`
+	Confirmed bool            `json:"confirmed"`
+	Resources []PurgeResource `json:"resources"`
+	Removed   int             `json:"removed"`
+}
+
+// Summary describes the resources of the purge in a sentence
+func (r *PurgeReport) Summary() string {
+	byKind := map[string]int{}
+	objects := 0
+	for _, res := range r.Resources {
+		byKind[res.Kind]++
+		objects += res.Objects
+	}
+	kinds := make([]string, 0, len(byKind))
+	for kind, n := range byKind {
+		kinds = append(kinds, fmt.Sprintf("%d %s", n, kind))
+	}
+	sort.Strings(kinds)
+	if len(kinds) == 0 {
+		return "nothing is left behind"
+	}
+	return fmt.Sprintf("%s holding %d custom resources", strings.Join(kinds, ", "), objects)
+}
+
+// purgeCilium uninstalls Cilium and removes the resources it leaves
+// behind. The resources are only listed along with the token confirming
+// them until the delete is run again with the token, so that nothing is
+// removed without being shown first.
+func (h *Handler) purgeCilium(ctx context.Context, request adapter.OperationRequest, version string, req PurgeRequest) (string, string, error) {
+	plan, err := h.purgePlan(ctx)
+	if err != nil {
+		return "Error while purging Cilium service mesh", err.Error(), err
+	}
+	if req.Confirm != plan.Token {
+		details := reportDetails(plan)
+		h.attachArtifact(request.OperationID, "purge-plan.json", []byte(details))
+		msg := fmt.Sprintf("The purge removes %s. Run the delete again with confirm: %s in the body to uninstall Cilium and remove them.", plan.Summary(), plan.Token)
+		if req.Confirm != "" {
+			msg = "The confirmation token is outdated, the resources changed since it was issued. " + msg
+		}
+		return "Purge of Cilium service mesh awaiting confirmation", msg, nil
+	}
+
+	stat, err := h.installCilium(ctx, true, version, request.Namespace, InstallRequest{})
+	if err != nil {
+		return fmt.Sprintf("Error while %s Cilium service mesh", stat), err.Error(), err
+	}
+	err = h.purge(ctx, plan)
+	details := reportDetails(plan)
+	h.attachArtifact(request.OperationID, "purge-report.json", []byte(details))
+	if err != nil {
+		return "Error while purging Cilium service mesh", details, err
+	}
+	return "Cilium service mesh removed and purged successfully", details, nil
+}
+
+// purgePlan lists the Cilium CRDs along with their custom resources, the
+// validating webhooks labeled as part of Cilium and the secrets of Hubble and of the
+// encryption. The token of the plan changes with the resources and with
+// the cluster, so that a confirmation only applies to the plan shown.
+func (h *Handler) purgePlan(ctx context.Context) (*PurgeReport, error) {
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+	report := &PurgeReport{Resources: []PurgeResource{}}
+
+	crds, err := h.DynamicKubeClient.Resource(crdResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrPurgeCilium(err)
+	}
+	for i := range crds.Items {
+		crd := &crds.Items[i]
+		if group, _, _ := unstructured.NestedString(crd.Object, "spec", "group"); group != ciliumGroup || contains(tetragonCRDs, crd.GetName()) {
+			continue
+		}
+		res := PurgeResource{Kind: "CustomResourceDefinition", Name: crd.GetName()}
+		if version := storageVersion(crd); version != "" {
+			if list, err := h.DynamicKubeClient.Resource(crdGVR(crd, version)).List(ctx, metav1.ListOptions{}); err == nil {
+				res.Objects = len(list.Items)
+			}
+		}
+		report.Resources = append(report.Resources, res)
+	}
+
+	webhooks, err := h.KubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrPurgeCilium(err)
+	}
+	for _, wh := range webhooks.Items {
+		if wh.Labels["app.kubernetes.io/part-of"] == "cilium" {
+			report.Resources = append(report.Resources, PurgeResource{Kind: "ValidatingWebhookConfiguration", Name: wh.Name})
+		}
+	}
+
+	secrets, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrPurgeCilium(err)
+	}
+	for _, s := range secrets.Items {
+		if s.Type == corev1.SecretTypeServiceAccountToken {
+			continue
+		}
+		if strings.HasPrefix(s.Name, "hubble-") || s.Name == "cilium-ca" || s.Name == ipsecSecretName {
+			report.Resources = append(report.Resources, PurgeResource{Kind: "Secret", Namespace: s.Namespace, Name: s.Name})
+		}
+	}
+
+	ns, err := h.KubeClient.CoreV1().Namespaces().Get(ctx, ciliumNamespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrPurgeCilium(err)
+	}
+	sum := sha256.New()
+	sum.Write([]byte(ns.UID))
+	for _, res := range report.Resources {
+		sum.Write([]byte("\n" + res.String()))
+	}
+	report.Token = hex.EncodeToString(sum.Sum(nil))[:12]
+	return report, nil
+}
+
+// purge removes the resources of the confirmed plan, the webhooks first
+// so that they don't reject the removal of the custom resources
+func (h *Handler) purge(ctx context.Context, report *PurgeReport) error {
+	report.Confirmed = true
+	order := map[string]int{"ValidatingWebhookConfiguration": 0, "Secret": 1, "CustomResourceDefinition": 2}
+	sort.SliceStable(report.Resources, func(i, j int) bool {
+		return order[report.Resources[i].Kind] < order[report.Resources[j].Kind]
+	})
+
+	var failed []string
+	for _, res := range report.Resources {
+		var err error
+		switch res.Kind {
+		case "ValidatingWebhookConfiguration":
+			err = h.KubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Delete(ctx, res.Name, metav1.DeleteOptions{})
+		case "Secret":
+			err = h.KubeClient.CoreV1().Secrets(res.Namespace).Delete(ctx, res.Name, metav1.DeleteOptions{})
+		case "CustomResourceDefinition":
+			err = h.DynamicKubeClient.Resource(crdResource).Delete(ctx, res.Name, metav1.DeleteOptions{})
+		}
+		if err != nil && !kerrors.IsNotFound(err) {
+			failed = append(failed, fmt.Sprintf("%s: %s", res, err))
+			continue
+		}
+		report.Removed++
+		details := fmt.Sprintf("%s removed.", res)
+		if res.Objects > 0 {
+			details = fmt.Sprintf("%s removed along with its %d custom resources.", res, res.Objects)
+		}
+		reportProgress(ctx, fmt.Sprintf("Purging Cilium, %d/%d resources removed", report.Removed, len(report.Resources)), details)
+	}
+	if len(failed) > 0 {
+		return ErrPurgeCilium(fmt.Errorf("%s", strings.Join(failed, "; ")))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RegistryConfig is the private registry the images of an air-gapped
+// install are pulled from, it mirrors the repositories of the public ones
+type RegistryConfig struct {
+	// Prefix replaces the registry of the images, e.g.
+	// registry.example.com:5000/mirror turns quay.io/cilium/cilium into
+	// registry.example.com:5000/mirror/cilium/cilium
+	Prefix string `json:"prefix"`
+	// ImagePullSecrets are the secrets of kube-system the images are
+	// pulled with
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// UseDigests keeps the digests the chart pins the images to, the mirror
+	// must then preserve the digests of the public images
+	UseDigests bool `json:"useDigests,omitempty"`
+}
+
+// chartImage is the value of an image of a chart along with its public
+// repository
+type chartImage struct {
+	path       string
+	repository string
+}
+
+// chartImages are the images of the Cilium chart, the values unknown to
+// older charts are ignored
+var chartImages = []chartImage{
+	{"image", "quay.io/cilium/cilium"},
+	{"preflight.image", "quay.io/cilium/cilium"},
+	// The chart appends the suffix of the cloud provider, e.g. -generic
+	{"operator.image", "quay.io/cilium/operator"},
+	{"hubble.relay.image", "quay.io/cilium/hubble-relay"},
+	{"hubble.ui.frontend.image", "quay.io/cilium/hubble-ui"},
+	{"hubble.ui.backend.image", "quay.io/cilium/hubble-ui-backend"},
+	{"hubble.ui.proxy.image", "docker.io/envoyproxy/envoy"},
+	{"clustermesh.apiserver.image", "quay.io/cilium/clustermesh-apiserver"},
+	{"certgen.image", "quay.io/cilium/certgen"},
+	{"nodeinit.image", "quay.io/cilium/startup-script"},
+	{"envoy.image", "quay.io/cilium/cilium-envoy"},
+	{"etcd.image", "quay.io/coreos/etcd"},
+}
+
+// registryValues validates the registry of an install and sets the chart
+// values pulling every image of images from it
+func (h *Handler) registryValues(ctx context.Context, values map[string]interface{}, registry RegistryConfig, images []chartImage) error {
+	prefix := strings.TrimSuffix(strings.TrimSpace(registry.Prefix), "/")
+	if prefix == "" {
+		return ErrConfigureRegistry(fmt.Errorf("the registry prefix is required"))
+	}
+	if strings.Contains(prefix, "://") {
+		return ErrConfigureRegistry(fmt.Errorf("the registry prefix %q must be an image reference such as registry.example.com/mirror, not a URL", prefix))
+	}
+
+	// A missing pull secret only shows once the pods fail to pull
+	if len(registry.ImagePullSecrets) > 0 && h.KubeClient == nil {
+		return ErrNilClient
+	}
+	secrets := make([]interface{}, 0, len(registry.ImagePullSecrets))
+	for _, name := range registry.ImagePullSecrets {
+		_, err := h.KubeClient.CoreV1().Secrets(ciliumNamespace).Get(ctx, name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return ErrConfigureRegistry(fmt.Errorf("the image pull secret %s doesn't exist in %s", name, ciliumNamespace))
+		}
+		if err != nil {
+			return ErrConfigureRegistry(err)
+		}
+		secrets = append(secrets, map[string]interface{}{"name": name})
+	}
+
+	for _, img := range images {
+		setValue(values, img.path+".repository", mirroredRepository(prefix, img.repository))
+		if !registry.UseDigests {
+			setValue(values, img.path+".useDigest", false)
+		}
+	}
+	if len(secrets) > 0 {
+		setValue(values, "imagePullSecrets", secrets)
+	}
+	return nil
+}
+
+// mirroredRepository replaces the registry of a repository with prefix
+func mirroredRepository(prefix, repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	return prefix + "/" + parts[len(parts)-1]
+}
+
+// installRegistry returns the prefix of the registry the release was
+// installed from, it is read back from the repository of the agent image
+func (h *Handler) installRegistry() (string, bool) {
+	state, err := h.loadReleaseState()
+	if err != nil {
+		return "", false
+	}
+	repository, _ := lookupValue(state.Values, "image.repository")
+	repo, _ := repository.(string)
+	const agent = "/cilium/cilium"
+	if repo == "" || repo == chartImages[0].repository || !strings.HasSuffix(repo, agent) {
+		return "", false
+	}
+	return strings.TrimSuffix(repo, agent), true
+}
@@ -0,0 +1,278 @@
+package cilium
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/internal/paging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ReportsPrefix is the path under which the lists of endpoints, identities,
+// policies and flows of the cluster are served, one page at a time
+const ReportsPrefix = "/reports/"
+
+// maxFlows caps the flows returned in a single page, they are read from
+// the flow buffer of an agent
+const maxFlows = 1000
+
+var (
+	ciliumIdentityResource          = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumidentities"}
+	ciliumNetworkPolicyResource     = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"}
+	ciliumClusterwidePolicyResource = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumclusterwidenetworkpolicies"}
+)
+
+// errBadReportRequest is returned for report requests with invalid parameters
+type errBadReportRequest string
+
+func (e errBadReportRequest) Error() string { return string(e) }
+
+// EndpointSummary is a Cilium endpoint as listed by the endpoints report
+type EndpointSummary struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Node      string   `json:"node,omitempty"`
+	State     string   `json:"state,omitempty"`
+	Identity  int64    `json:"identity,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// IdentitySummary is a security identity as listed by the identities report
+type IdentitySummary struct {
+	ID     string            `json:"id"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PolicySummary is a policy as listed by the policies report
+type PolicySummary struct {
+	Kind      string            `json:"kind"`
+	Namespace string            `json:"namespace,omitempty"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt metav1.Time       `json:"createdAt"`
+}
+
+// ReportsHandler serves the paginated reports of the cluster managed by the
+// adapter handler h at /reports/{endpoints,identities,policies,flows}. The
+// limit and continue query parameters page through the items, namespace,
+// labelSelector and fieldSelector filter them on the API server, context
+// selects the cluster.
+func ReportsHandler(h adapter.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler, ok := h.(*Handler)
+		if !ok {
+			http.Error(w, "reports are not supported", http.StatusNotImplemented)
+			return
+		}
+		handler, err := handler.forContext(r.URL.Query().Get("context"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		report := strings.Trim(strings.TrimPrefix(r.URL.Path, ReportsPrefix), "/")
+		max := int64(paging.MaxLimit)
+		if report == "flows" {
+			max = maxFlows
+		}
+		params, err := paging.Parse(r, max)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var page paging.Page
+		switch report {
+		case "endpoints":
+			page, err = handler.endpointsPage(r.Context(), params)
+		case "identities":
+			page, err = handler.identitiesPage(r.Context(), params)
+		case "policies":
+			page, err = handler.policiesPage(r.Context(), r.URL.Query().Get("kind"), params)
+		case "flows":
+			q := r.URL.Query()
+			page, err = handler.flowsPage(r.Context(), q.Get("node"), q.Get("pod"), q.Get("verdict"), params)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		var bad errBadReportRequest
+		switch {
+		case err == ErrNilClient:
+			http.Error(w, "no cluster configured yet", http.StatusServiceUnavailable)
+			return
+		case errors.As(err, &bad):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	})
+}
+
+func (h *Handler) listPage(ctx context.Context, gvr schema.GroupVersionResource, params paging.Params) (*unstructured.UnstructuredList, error) {
+	if h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+	list, err := h.DynamicKubeClient.Resource(gvr).Namespace(params.Namespace).List(ctx, params.ListOptions())
+	if err != nil {
+		return nil, ErrListReport(err)
+	}
+	return list, nil
+}
+
+func (h *Handler) endpointsPage(ctx context.Context, params paging.Params) (paging.Page, error) {
+	list, err := h.listPage(ctx, ciliumEndpointResource, params)
+	if err != nil {
+		return paging.Page{}, err
+	}
+
+	items := make([]EndpointSummary, 0, len(list.Items))
+	for _, ep := range list.Items {
+		summary := EndpointSummary{Namespace: ep.GetNamespace(), Name: ep.GetName()}
+		summary.State, _, _ = unstructured.NestedString(ep.Object, "status", "state")
+		summary.Node, _, _ = unstructured.NestedString(ep.Object, "status", "networking", "node")
+		summary.Identity, _, _ = unstructured.NestedInt64(ep.Object, "status", "identity", "id")
+		for _, addr := range nestedMaps(ep.Object, "status", "networking", "addressing") {
+			for _, family := range []string{"ipv4", "ipv6"} {
+				if ip, ok := addr[family].(string); ok && ip != "" {
+					summary.Addresses = append(summary.Addresses, ip)
+				}
+			}
+		}
+		items = append(items, summary)
+	}
+	return paging.FromList(items, metav1.ListMeta{Continue: list.GetContinue(), RemainingItemCount: list.GetRemainingItemCount()}), nil
+}
+
+func (h *Handler) identitiesPage(ctx context.Context, params paging.Params) (paging.Page, error) {
+	// Identities are cluster-scoped
+	params.Namespace = ""
+	list, err := h.listPage(ctx, ciliumIdentityResource, params)
+	if err != nil {
+		return paging.Page{}, err
+	}
+
+	items := make([]IdentitySummary, 0, len(list.Items))
+	for _, id := range list.Items {
+		labels, _, _ := unstructured.NestedStringMap(id.Object, "security-labels")
+		items = append(items, IdentitySummary{ID: id.GetName(), Labels: labels})
+	}
+	return paging.FromList(items, metav1.ListMeta{Continue: list.GetContinue(), RemainingItemCount: list.GetRemainingItemCount()}), nil
+}
+
+func (h *Handler) policiesPage(ctx context.Context, kind string, params paging.Params) (paging.Page, error) {
+	gvr := ciliumNetworkPolicyResource
+	switch kind {
+	case "", "CiliumNetworkPolicy":
+		kind = "CiliumNetworkPolicy"
+	case "CiliumClusterwideNetworkPolicy":
+		gvr = ciliumClusterwidePolicyResource
+		params.Namespace = ""
+	default:
+		return paging.Page{}, errBadReportRequest("kind must be CiliumNetworkPolicy or CiliumClusterwideNetworkPolicy")
+	}
+
+	list, err := h.listPage(ctx, gvr, params)
+	if err != nil {
+		return paging.Page{}, err
+	}
+
+	items := make([]PolicySummary, 0, len(list.Items))
+	for _, p := range list.Items {
+		items = append(items, PolicySummary{
+			Kind:      kind,
+			Namespace: p.GetNamespace(),
+			Name:      p.GetName(),
+			Labels:    p.GetLabels(),
+			CreatedAt: p.GetCreationTimestamp(),
+		})
+	}
+	return paging.FromList(items, metav1.ListMeta{Continue: list.GetContinue(), RemainingItemCount: list.GetRemainingItemCount()}), nil
+}
+
+// flowsPage returns the latest flows observed by the agent of a node. Flows
+// are not Kubernetes objects, the continue token is the time of the oldest
+// flow returned and the next page holds the flows which precede it.
+func (h *Handler) flowsPage(ctx context.Context, node, pod, verdict string, params paging.Params) (paging.Page, error) {
+	if node == "" {
+		return paging.Page{}, errBadReportRequest("the node query parameter is required")
+	}
+
+	args := []string{"hubble", "observe", "--output", "json", "--last", strconv.FormatInt(params.Limit, 10)}
+	if params.Continue != "" {
+		until, err := time.Parse(time.RFC3339Nano, params.Continue)
+		if err != nil {
+			return paging.Page{}, errBadReportRequest("invalid continue token")
+		}
+		args = append(args, "--until", until.Add(-time.Nanosecond).Format(time.RFC3339Nano))
+	}
+	if params.Namespace != "" {
+		args = append(args, "--namespace", params.Namespace)
+	}
+	if pod != "" {
+		args = append(args, "--pod", pod)
+	}
+	if verdict != "" {
+		args = append(args, "--verdict", verdict)
+	}
+	if params.LabelSelector != "" {
+		args = append(args, "--label", params.LabelSelector)
+	}
+
+	agent, err := h.agentPod(ctx, node)
+	if err != nil {
+		return paging.Page{}, err
+	}
+	out, err := h.execInAgent(agent, args)
+	if err != nil {
+		return paging.Page{}, ErrListReport(err)
+	}
+
+	flows := []json.RawMessage{}
+	var oldest time.Time
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			Flow json.RawMessage `json:"flow"`
+			Time time.Time       `json:"time"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || len(line.Flow) == 0 {
+			continue
+		}
+		if oldest.IsZero() || line.Time.Before(oldest) {
+			oldest = line.Time
+		}
+		flows = append(flows, line.Flow)
+	}
+	if err := scanner.Err(); err != nil {
+		return paging.Page{}, ErrListReport(err)
+	}
+
+	page := paging.Page{Items: flows}
+	// A full page means older flows may be left in the buffer
+	if int64(len(flows)) == params.Limit && !oldest.IsZero() {
+		page.Continue = oldest.Format(time.RFC3339Nano)
+	}
+	return page, nil
+}
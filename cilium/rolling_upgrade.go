@@ -0,0 +1,500 @@
+package cilium
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Actions of the upgrade operation
+const (
+	upgradeStart  = "start"
+	upgradeResume = "resume"
+	upgradeAbort  = "abort"
+)
+
+// Phases of an upgrade
+const (
+	upgradeCompleted = "completed"
+	upgradePaused    = "paused"
+	upgradeAborted   = "aborted"
+)
+
+const (
+	ciliumUpgrade = "cilium-upgrade.json"
+
+	defaultDropThreshold = 10
+	// dropSampleInterval is the time the drops of the upgraded agents are
+	// counted over before the next agents are upgraded
+	dropSampleInterval = 30 * time.Second
+
+	hubbleDropMetric  = "hubble_drop_total"
+	agentDropMetric   = "cilium_drop_count_total"
+	revisionHashKey   = "controller-revision-hash"
+	onDeleteStrategy  = "OnDelete"
+	rollingUpdateType = "RollingUpdate"
+)
+
+// UpgradeRequest is the body of the upgrade operation
+type UpgradeRequest struct {
+	// Action is start, resume or abort, start by default
+	Action string `json:"action,omitempty"`
+	// Version is the chart version upgraded to, the version of the
+	// operation by default
+	Version string `json:"version,omitempty"`
+	// MaxUnavailable is the number of agents upgraded at once, 1 by default
+	MaxUnavailable int `json:"maxUnavailable,omitempty"`
+	// MaxSurge is the surge of the operator Deployment, e.g. 25%. The agents
+	// can't surge, they bind the ports of their node.
+	MaxSurge string `json:"maxSurge,omitempty"`
+	// DropThreshold is the rate of dropped packets of an upgraded agent,
+	// per second, which pauses the upgrade
+	DropThreshold float64 `json:"dropThreshold,omitempty"`
+}
+
+// upgradeState is the upgrade in progress, kept so that a paused upgrade
+// is resumed or aborted by a later operation
+type upgradeState struct {
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	MaxUnavailable int     `json:"maxUnavailable"`
+	DropThreshold  float64 `json:"dropThreshold"`
+	Paused         bool    `json:"paused"`
+	Reason         string  `json:"reason,omitempty"`
+}
+
+// UpgradeReport is the outcome of the upgrade operation
+type UpgradeReport struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Phase string `json:"phase"`
+	// Reason is why the upgrade paused
+	Reason    string   `json:"reason,omitempty"`
+	Upgraded  []string `json:"upgraded"`
+	Remaining []string `json:"remaining"`
+	// DropRates are the dropped packets per second of the upgraded agents
+	DropRates map[string]float64 `json:"dropRates,omitempty"`
+	// DropMetric is the metric the drops are counted with, empty when
+	// neither the agents nor Hubble serve metrics
+	DropMetric string `json:"dropMetric,omitempty"`
+}
+
+func (h *Handler) upgradeStatePath() string {
+	return h.statePath(ciliumUpgrade)
+}
+
+func (h *Handler) loadUpgradeState() (*upgradeState, error) {
+	byt, err := ioutil.ReadFile(h.upgradeStatePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &upgradeState{}
+	if err := json.Unmarshal(byt, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (h *Handler) saveUpgradeState(state *upgradeState) error {
+	byt, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(h.upgradeStatePath(), byt, 0600)
+}
+
+// upgradeCilium upgrades the chart with the agents switched to the OnDelete
+// strategy, and replaces the agents MaxUnavailable nodes at a time. After
+// every batch the drops of the upgraded agents are counted, the upgrade
+// pauses when they exceed the threshold. A paused upgrade is resumed, or
+// aborted which rolls the chart and the upgraded agents back.
+func (h *Handler) upgradeCilium(ctx context.Context, request adapter.OperationRequest, version string) (string, *UpgradeReport, error) {
+	st := status.Applying
+	if h.KubeClient == nil || h.MesheryKubeclient == nil {
+		return st, nil, ErrNilClient
+	}
+	req := UpgradeRequest{}
+	if err := yaml.Unmarshal([]byte(request.CustomBody), &req); err != nil {
+		return st, nil, ErrRollingUpgrade(err)
+	}
+	if req.Version != "" {
+		version = req.Version
+	}
+
+	state, err := h.loadUpgradeState()
+	if err != nil {
+		return st, nil, ErrRollingUpgrade(err)
+	}
+	switch req.Action {
+	case "", upgradeStart:
+		if state != nil {
+			return st, nil, ErrRollingUpgrade(fmt.Errorf("the upgrade from %s to %s is %s, resume or abort it first", state.From, state.To, upgradePhase(state)))
+		}
+		if state, err = h.startUpgrade(ctx, req, version); err != nil {
+			return st, nil, ErrRollingUpgrade(err)
+		}
+	case upgradeResume:
+		if state == nil {
+			return st, nil, ErrRollingUpgrade(fmt.Errorf("no upgrade to resume"))
+		}
+		state.Paused, state.Reason = false, ""
+	case upgradeAbort:
+		if state == nil {
+			return st, nil, ErrRollingUpgrade(fmt.Errorf("no upgrade to abort"))
+		}
+		report, err := h.abortUpgrade(ctx, state)
+		if err != nil {
+			return st, report, ErrRollingUpgrade(err)
+		}
+		return status.Removed, report, nil
+	default:
+		return st, nil, ErrRollingUpgrade(fmt.Errorf("action %q is not one of start, resume or abort", req.Action))
+	}
+
+	report, err := h.continueUpgrade(ctx, state)
+	if err != nil {
+		return st, report, ErrRollingUpgrade(err)
+	}
+	if report.Phase == upgradePaused {
+		return upgradePaused, report, nil
+	}
+	return status.Applied, report, nil
+}
+
+func upgradePhase(state *upgradeState) string {
+	if state.Paused {
+		return upgradePaused
+	}
+	return "in progress"
+}
+
+// startUpgrade upgrades the chart to version without replacing the agents
+func (h *Handler) startUpgrade(ctx context.Context, req UpgradeRequest, version string) (*upgradeState, error) {
+	release, err := h.loadReleaseState()
+	if err != nil {
+		return nil, err
+	}
+	if release.Version == "" {
+		if err := h.adoptRelease(ctx, release); err != nil {
+			return nil, err
+		}
+	}
+	if !versionLess(release.Version, version) {
+		return nil, fmt.Errorf("Cilium %s is not newer than the installed %s", version, release.Version)
+	}
+	if err := h.checkCiliumVersion(ctx, version); err != nil {
+		return nil, err
+	}
+
+	state := &upgradeState{
+		From:           release.Version,
+		To:             version,
+		MaxUnavailable: req.MaxUnavailable,
+		DropThreshold:  req.DropThreshold,
+	}
+	if state.MaxUnavailable <= 0 {
+		state.MaxUnavailable = 1
+	}
+	if state.DropThreshold <= 0 {
+		state.DropThreshold = defaultDropThreshold
+	}
+	values := map[string]interface{}{}
+	setValue(values, "updateStrategy.type", onDeleteStrategy)
+	setValue(values, "updateStrategy.rollingUpdate", nil)
+	if req.MaxSurge != "" {
+		setValue(values, "operator.updateStrategy.rollingUpdate.maxSurge", req.MaxSurge)
+	}
+	reportProgress(ctx, fmt.Sprintf("Upgrading the Cilium chart to %s", version), fmt.Sprintf("The agents are upgraded %d at a time.", state.MaxUnavailable))
+	if err := h.applyRelease(release, version, values); err != nil {
+		return nil, err
+	}
+	// The state is only kept once the chart is upgraded, a failed upgrade
+	// leaves nothing to resume or abort
+	if err := h.saveUpgradeState(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// continueUpgrade replaces the outdated agents batch by batch until they
+// are all upgraded or their drops pause the upgrade
+func (h *Handler) continueUpgrade(ctx context.Context, state *upgradeState) (*UpgradeReport, error) {
+	report := &UpgradeReport{From: state.From, To: state.To, Upgraded: []string{}, Remaining: []string{}, DropRates: map[string]float64{}}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return report, err
+	}
+	metric, port := dropMetric(cfg)
+	report.DropMetric = metric
+
+	// Every node is restarted at most once, an agent still outdated after
+	// its restart would otherwise be deleted over and over
+	restarted := map[string]bool{}
+	for {
+		outdated, updated, err := h.agentsByRevision(ctx)
+		if err != nil {
+			return report, err
+		}
+		report.Upgraded, report.Remaining = updated, agentNodeNames(outdated)
+		if len(outdated) == 0 {
+			break
+		}
+
+		batch := outdated
+		if len(batch) > state.MaxUnavailable {
+			batch = batch[:state.MaxUnavailable]
+		}
+		names := agentNodeNames(batch)
+		for _, node := range names {
+			if restarted[node] {
+				return report, fmt.Errorf("the agent of node %s still runs an outdated revision after its restart", node)
+			}
+			restarted[node] = true
+		}
+		reportProgress(ctx, fmt.Sprintf("Upgrading agents, %d remaining", len(outdated)), strings.Join(names, ", "))
+		if err := h.restartWave(ctx, batch); err != nil {
+			return report, err
+		}
+		report.Upgraded = append(report.Upgraded, names...)
+
+		if metric == "" {
+			continue
+		}
+		rates, err := h.dropRates(ctx, names, metric, port)
+		if err != nil {
+			return report, err
+		}
+		var over []string
+		for _, node := range names {
+			report.DropRates[node] = rates[node]
+			if rates[node] > state.DropThreshold {
+				over = append(over, fmt.Sprintf("%s drops %.1f packets/s", node, rates[node]))
+			}
+		}
+		if len(over) > 0 {
+			state.Paused = true
+			state.Reason = fmt.Sprintf("%s, above the threshold of %.1f", strings.Join(over, ", "), state.DropThreshold)
+			if err := h.saveUpgradeState(state); err != nil {
+				return report, err
+			}
+			report.Phase, report.Reason = upgradePaused, state.Reason
+			report.Remaining = removeNames(report.Remaining, names)
+			return report, nil
+		}
+	}
+
+	if err := h.restoreRollingUpdate(ctx, state, state.To); err != nil {
+		return report, err
+	}
+	report.Phase = upgradeCompleted
+	return report, os.Remove(h.upgradeStatePath())
+}
+
+// abortUpgrade rolls the chart back to the version the upgrade started
+// from, the DaemonSet then rolls the upgraded agents back
+func (h *Handler) abortUpgrade(ctx context.Context, state *upgradeState) (*UpgradeReport, error) {
+	report := &UpgradeReport{From: state.From, To: state.To, Phase: upgradeAborted, Remaining: []string{}}
+	_, updated, err := h.agentsByRevision(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Upgraded = updated
+
+	reportProgress(ctx, fmt.Sprintf("Rolling Cilium back to %s", state.From), fmt.Sprintf("%d agents were upgraded.", len(updated)))
+	if err := h.restoreRollingUpdate(ctx, state, state.From); err != nil {
+		return report, err
+	}
+	if _, err := h.waitForDaemonSetRollout(ctx, ciliumNamespace, ciliumAgentName); err != nil {
+		return report, err
+	}
+	return report, os.Remove(h.upgradeStatePath())
+}
+
+// restoreRollingUpdate applies version with the agents back on the rolling
+// update strategy
+func (h *Handler) restoreRollingUpdate(ctx context.Context, state *upgradeState, version string) error {
+	release, err := h.loadReleaseState()
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	setValue(values, "updateStrategy.type", rollingUpdateType)
+	setValue(values, "updateStrategy.rollingUpdate.maxUnavailable", state.MaxUnavailable)
+	return h.applyRelease(release, version, values)
+}
+
+// agentsByRevision splits the agents into the ones running an older
+// revision than the current one of their DaemonSet, sorted by node, and the
+// nodes of the up to date ones
+func (h *Handler) agentsByRevision(ctx context.Context) ([]agentNode, []string, error) {
+	ds, err := h.KubeClient.AppsV1().DaemonSets(ciliumNamespace).Get(ctx, ciliumAgentName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := h.currentRevisionHash(ctx, ds)
+	if err != nil {
+		return nil, nil, err
+	}
+	pods, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).List(ctx, metav1.ListOptions{LabelSelector: ciliumAgentSelector})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var outdated []agentNode
+	updated := []string{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Labels[revisionHashKey] == current {
+			updated = append(updated, pod.Spec.NodeName)
+			continue
+		}
+		outdated = append(outdated, agentNode{name: pod.Spec.NodeName, pod: pod})
+	}
+	sort.Slice(outdated, func(i, j int) bool { return outdated[i].name < outdated[j].name })
+	sort.Strings(updated)
+	return outdated, updated, nil
+}
+
+// currentRevisionHash returns the hash of the latest ControllerRevision of
+// ds, the one its new pods are created from. Unlike the generation of ds
+// it only changes with the pod template.
+func (h *Handler) currentRevisionHash(ctx context.Context, ds *appsv1.DaemonSet) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return "", err
+	}
+	revisions, err := h.KubeClient.AppsV1().ControllerRevisions(ds.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return "", err
+	}
+	var latest *appsv1.ControllerRevision
+	for i := range revisions.Items {
+		rev := &revisions.Items[i]
+		if !metav1.IsControlledBy(rev, ds) {
+			continue
+		}
+		if latest == nil || rev.Revision > latest.Revision {
+			latest = rev
+		}
+	}
+	if latest == nil || latest.Labels[revisionHashKey] == "" {
+		return "", fmt.Errorf("no revision of the %s DaemonSet found", ds.Name)
+	}
+	return latest.Labels[revisionHashKey], nil
+}
+
+func agentNodeNames(agents []agentNode) []string {
+	res := make([]string, 0, len(agents))
+	for _, a := range agents {
+		res = append(res, a.name)
+	}
+	return res
+}
+
+func removeNames(list, names []string) []string {
+	res := []string{}
+	for _, n := range list {
+		if !contains(names, n) {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// dropMetric returns the metric the drops of an agent are counted with and
+// the port it is served on, the drop metric of Hubble when it is enabled
+// and the one of the agent otherwise
+func dropMetric(cfg map[string]string) (string, string) {
+	if addr := cfg["hubble-metrics-server"]; addr != "" {
+		for _, m := range strings.Fields(cfg["hubble-metrics"]) {
+			if m == "drop" || strings.HasPrefix(m, "drop:") {
+				return hubbleDropMetric, strings.TrimPrefix(addr, ":")
+			}
+		}
+	}
+	if addr := cfg["prometheus-serve-addr"]; addr != "" {
+		return agentDropMetric, strings.TrimPrefix(addr, ":")
+	}
+	return "", ""
+}
+
+// dropRates counts the drops of the agents of nodes over the sample
+// interval, through the API server proxy so that the adapter doesn't need
+// to reach the nodes
+func (h *Handler) dropRates(ctx context.Context, nodes []string, metric, port string) (map[string]float64, error) {
+	pods := map[string]string{}
+	before := map[string]float64{}
+	for _, node := range nodes {
+		pod, err := h.agentPod(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		pods[node] = pod
+		if before[node], err = h.scrapeCounter(ctx, pod, port, metric); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(dropSampleInterval):
+	}
+	elapsed := time.Since(start).Seconds()
+
+	res := map[string]float64{}
+	for _, node := range nodes {
+		after, err := h.scrapeCounter(ctx, pods[node], port, metric)
+		if err != nil {
+			return nil, err
+		}
+		res[node] = (after - before[node]) / elapsed
+	}
+	return res, nil
+}
+
+// scrapeCounter sums the series of a counter served by an agent pod
+func (h *Handler) scrapeCounter(ctx context.Context, pod, port, metric string) (float64, error) {
+	byt, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).ProxyGet("http", pod, port, "/metrics", nil).DoRaw(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("scraping %s of %s: %s", metric, pod, err)
+	}
+
+	sum := 0.0
+	scanner := bufio.NewScanner(bytes.NewReader(byt))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, metric) {
+			continue
+		}
+		// The name is followed by the labels or a space
+		if rest := strings.TrimPrefix(line, metric); rest == "" || (rest[0] != '{' && rest[0] != ' ') {
+			continue
+		}
+		fields := strings.Fields(line)
+		if v, err := strconv.ParseFloat(fields[len(fields)-1], 64); err == nil {
+			sum += v
+		}
+	}
+	return sum, scanner.Err()
+}
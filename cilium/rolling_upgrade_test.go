@@ -0,0 +1,66 @@
+package cilium
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDropMetric(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        map[string]string
+		wantMetric string
+		wantPort   string
+	}{
+		{
+			name:       "hubble drop metric",
+			cfg:        map[string]string{"hubble-metrics-server": ":9965", "hubble-metrics": "dns drop:sourceContext=pod tcp", "prometheus-serve-addr": ":9962"},
+			wantMetric: hubbleDropMetric,
+			wantPort:   "9965",
+		},
+		{
+			name:       "hubble metrics without drops",
+			cfg:        map[string]string{"hubble-metrics-server": ":9965", "hubble-metrics": "dns tcp", "prometheus-serve-addr": ":9962"},
+			wantMetric: agentDropMetric,
+			wantPort:   "9962",
+		},
+		{
+			name:       "agent metrics",
+			cfg:        map[string]string{"prometheus-serve-addr": ":9962"},
+			wantMetric: agentDropMetric,
+			wantPort:   "9962",
+		},
+		{
+			name: "no metrics",
+			cfg:  map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, port := dropMetric(tt.cfg)
+			if metric != tt.wantMetric || port != tt.wantPort {
+				t.Errorf("dropMetric() = %q, %q, want %q, %q", metric, port, tt.wantMetric, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestRemoveNames(t *testing.T) {
+	got := removeNames([]string{"node-a", "node-b", "node-c"}, []string{"node-b"})
+	if want := []string{"node-a", "node-c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("removeNames() = %v, want %v", got, want)
+	}
+	if got := removeNames([]string{"node-a"}, []string{"node-a"}); len(got) != 0 {
+		t.Errorf("removeNames() = %v, want none", got)
+	}
+}
+
+func TestUpgradePhase(t *testing.T) {
+	if phase := upgradePhase(&upgradeState{Paused: true}); phase != upgradePaused {
+		t.Errorf("upgradePhase() = %q of a paused upgrade, want %q", phase, upgradePaused)
+	}
+	if phase := upgradePhase(&upgradeState{}); phase == upgradePaused {
+		t.Errorf("upgradePhase() = %q of an upgrade in progress", phase)
+	}
+}
@@ -0,0 +1,81 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	rolloutPollInterval = 5 * time.Second
+	rolloutTimeout      = 10 * time.Minute
+)
+
+// rolloutStatus describes the progress of a DaemonSet rollout
+type rolloutStatus struct {
+	Desired   int32 `json:"desired"`
+	Updated   int32 `json:"updated"`
+	Available int32 `json:"available"`
+}
+
+func (r rolloutStatus) String() string {
+	return fmt.Sprintf("%d/%d agents updated, %d available", r.Updated, r.Desired, r.Available)
+}
+
+// restartDaemonSet triggers a rolling restart of the given DaemonSet the same
+// way `kubectl rollout restart` does
+func (h *Handler) restartDaemonSet(ctx context.Context, namespace, name string) error {
+	if h.KubeClient == nil {
+		return ErrNilClient
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"%s"}}}}}`, time.Now().Format(time.RFC3339))
+	_, err := h.KubeClient.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return ErrRolloutDaemonSet(err)
+	}
+	return nil
+}
+
+// waitForDaemonSetRollout blocks until every pod of the DaemonSet runs the
+// latest template and is available, or the timeout elapses. Every change of
+// the rollout status is reported as progress of the operation.
+func (h *Handler) waitForDaemonSetRollout(ctx context.Context, namespace, name string) (rolloutStatus, error) {
+	var status rolloutStatus
+	if h.KubeClient == nil {
+		return status, ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+	defer cancel()
+
+	err := wait.PollImmediateUntil(rolloutPollInterval, func() (bool, error) {
+		ds, err := h.KubeClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		cur := rolloutStatus{
+			Desired:   ds.Status.DesiredNumberScheduled,
+			Updated:   ds.Status.UpdatedNumberScheduled,
+			Available: ds.Status.NumberAvailable,
+		}
+		if cur != status {
+			reportProgress(ctx, fmt.Sprintf("%s rolling out", name), cur.String())
+		}
+		status = cur
+		if ds.Status.ObservedGeneration < ds.Generation {
+			return false, nil
+		}
+		return status.Updated == status.Desired && status.Available == status.Desired, nil
+	}, ctx.Done())
+	if err != nil {
+		return status, ErrRolloutDaemonSet(fmt.Errorf("%s: %s", err, status))
+	}
+
+	return status, nil
+}
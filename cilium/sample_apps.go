@@ -1,18 +1,19 @@
 package cilium
 
 import (
+	"context"
+
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/status"
-	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
 )
 
-func (h *Handler) installSampleApp(del bool, namespace string, templates []adapter.Template) (string, error) {
+func (h *Handler) installSampleApp(ctx context.Context, del bool, namespace string, templates []adapter.Template) (string, error) {
 	st := status.Installing
 	if del {
 		st = status.Removing
 	}
 	for _, template := range templates {
-		err := h.applyManifest([]byte(template.String()), del, namespace)
+		err := h.applyManifest(ctx, []byte(template.String()), del, namespace)
 		if err != nil {
 			return st, ErrSampleApp(err)
 		}
@@ -20,21 +21,6 @@ func (h *Handler) installSampleApp(del bool, namespace string, templates []adapt
 	return status.Installed, nil
 }
 
-func (h *Handler) applyManifest(contents []byte, isDel bool, namespace string) error {
-	kclient := h.MesheryKubeclient
-	if kclient == nil {
-		return ErrNilClient
-	}
-
-	err := kclient.ApplyManifest(contents, mesherykube.ApplyOptions{
-		Namespace: namespace,
-		Update:    true,
-		Delete:    isDel,
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+func (h *Handler) applyManifest(ctx context.Context, contents []byte, isDel bool, namespace string) error {
+	return h.applyOrdered(ctx, contents, isDel, namespace)
 }
@@ -0,0 +1,388 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	findingOverBroad      = "over-broad-permission"
+	findingLongLivedToken = "long-lived-token"
+	findingUnused         = "unused-permission"
+
+	severityHigh   = "high"
+	severityMedium = "medium"
+	severityLow    = "low"
+
+	inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// serviceAccountRef identifies a ServiceAccount covered by the security report
+// along with the verbs the workload using it is expected to need by API group.
+// A nil neededVerbs means no expectation is known and the unused check is
+// skipped.
+type serviceAccountRef struct {
+	Name        string
+	Namespace   string
+	Component   string
+	neededVerbs map[string][]string
+}
+
+// SecurityFinding is a single issue found for a ServiceAccount
+type SecurityFinding struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+// ServiceAccountReport holds the findings for one ServiceAccount
+type ServiceAccountReport struct {
+	Name               string            `json:"name"`
+	Namespace          string            `json:"namespace"`
+	Component          string            `json:"component"`
+	Found              bool              `json:"found"`
+	Findings           []SecurityFinding `json:"findings,omitempty"`
+	SuggestedManifests []string          `json:"suggestedManifests,omitempty"`
+}
+
+// SecurityReport is the result of the ServiceAccount hygiene checks
+type SecurityReport struct {
+	ServiceAccounts []ServiceAccountReport `json:"serviceAccounts"`
+}
+
+func ciliumServiceAccounts() []serviceAccountRef {
+	read := []string{"get", "list", "watch"}
+	write := []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+	return []serviceAccountRef{
+		{Name: "cilium", Namespace: "kube-system", Component: "cilium-agent", neededVerbs: map[string][]string{
+			"":                     {"get", "list", "watch", "update", "patch"},
+			"cilium.io":            write,
+			"networking.k8s.io":    read,
+			"discovery.k8s.io":     read,
+			"apiextensions.k8s.io": read,
+		}},
+		{Name: "cilium-operator", Namespace: "kube-system", Component: "cilium-operator", neededVerbs: map[string][]string{
+			"":                     write,
+			"cilium.io":            write,
+			"networking.k8s.io":    read,
+			"discovery.k8s.io":     read,
+			"apiextensions.k8s.io": {"get", "list", "watch", "create", "update"},
+			"coordination.k8s.io":  {"get", "create", "update"},
+		}},
+		{Name: "hubble-relay", Namespace: "kube-system", Component: "hubble-relay", neededVerbs: map[string][]string{"": read}},
+		{Name: "hubble-ui", Namespace: "kube-system", Component: "hubble-ui", neededVerbs: map[string][]string{
+			"":                  read,
+			"networking.k8s.io": read,
+			"cilium.io":         read,
+		}},
+		adapterServiceAccount(),
+	}
+}
+
+// adapterServiceAccount returns the ServiceAccount the adapter runs as. The name
+// can be overridden with SERVICE_ACCOUNT_NAME, and the namespace is read from the
+// mounted service account when running in-cluster.
+func adapterServiceAccount() serviceAccountRef {
+	sa := serviceAccountRef{
+		Name:      "meshery-cilium",
+		Namespace: "meshery",
+		Component: "meshery-cilium",
+	}
+	if name := os.Getenv("SERVICE_ACCOUNT_NAME"); name != "" {
+		sa.Name = name
+	}
+	if ns, err := ioutil.ReadFile(inClusterNamespaceFile); err == nil {
+		sa.Namespace = strings.TrimSpace(string(ns))
+	}
+	return sa
+}
+
+func (h *Handler) securityReport(ctx context.Context) (*SecurityReport, error) {
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+
+	clusterBindings, err := h.KubeClient.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrSecurityReport(err)
+	}
+	// A RoleBinding of any namespace may bind the ServiceAccounts
+	bindings, err := h.KubeClient.RbacV1().RoleBindings(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrSecurityReport(err)
+	}
+
+	report := &SecurityReport{}
+	for _, sa := range ciliumServiceAccounts() {
+		saReport, err := h.checkServiceAccount(ctx, sa, clusterBindings.Items, bindings.Items)
+		if err != nil {
+			return nil, ErrSecurityReport(err)
+		}
+		report.ServiceAccounts = append(report.ServiceAccounts, saReport)
+	}
+
+	return report, nil
+}
+
+func (h *Handler) checkServiceAccount(ctx context.Context, ref serviceAccountRef, clusterBindings []rbacv1.ClusterRoleBinding, bindings []rbacv1.RoleBinding) (ServiceAccountReport, error) {
+	res := ServiceAccountReport{
+		Name:      ref.Name,
+		Namespace: ref.Namespace,
+		Component: ref.Component,
+	}
+
+	sa, err := h.KubeClient.CoreV1().ServiceAccounts(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	res.Found = true
+
+	for _, binding := range clusterBindings {
+		if !bindsServiceAccount(binding.Subjects, ref) {
+			continue
+		}
+		if err := h.checkRoleRef(ctx, &res, ref, "ClusterRoleBinding/"+binding.Name, "", binding.RoleRef); err != nil {
+			return res, err
+		}
+	}
+	for _, binding := range bindings {
+		if !bindsServiceAccount(binding.Subjects, ref) {
+			continue
+		}
+		resource := "RoleBinding/" + binding.Namespace + "/" + binding.Name
+		if err := h.checkRoleRef(ctx, &res, ref, resource, binding.Namespace, binding.RoleRef); err != nil {
+			return res, err
+		}
+	}
+
+	secrets, err := h.KubeClient.CoreV1().Secrets(ref.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "type=kubernetes.io/service-account-token",
+	})
+	if err != nil {
+		return res, err
+	}
+	for _, secret := range secrets.Items {
+		if secret.Annotations["kubernetes.io/service-account.name"] != sa.Name {
+			continue
+		}
+		res.Findings = append(res.Findings, SecurityFinding{
+			Kind:     findingLongLivedToken,
+			Severity: severityMedium,
+			Resource: "Secret/" + secret.Name,
+			Message:  "Non-expiring ServiceAccount token secret exists; prefer projected (bound) tokens",
+		})
+	}
+
+	return res, nil
+}
+
+// checkRoleRef adds the findings of the role a binding grants, namespace is
+// the one of a RoleBinding, which is where the Roles it references live
+func (h *Handler) checkRoleRef(ctx context.Context, res *ServiceAccountReport, ref serviceAccountRef, binding, namespace string, roleRef rbacv1.RoleRef) error {
+	if roleRef.Kind == "ClusterRole" && roleRef.Name == "cluster-admin" {
+		message := "ServiceAccount is bound to cluster-admin"
+		if namespace != "" {
+			message = fmt.Sprintf("ServiceAccount is granted cluster-admin in %s", namespace)
+		}
+		res.Findings = append(res.Findings, SecurityFinding{
+			Kind:     findingOverBroad,
+			Severity: severityHigh,
+			Resource: binding,
+			Message:  message,
+		})
+		return nil
+	}
+
+	var meta metav1.ObjectMeta
+	var rules []rbacv1.PolicyRule
+	switch roleRef.Kind {
+	case "ClusterRole":
+		role, err := h.KubeClient.RbacV1().ClusterRoles().Get(ctx, roleRef.Name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		meta, rules = metav1.ObjectMeta{Name: role.Name, Labels: role.Labels}, role.Rules
+	case "Role":
+		role, err := h.KubeClient.RbacV1().Roles(namespace).Get(ctx, roleRef.Name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		meta, rules = metav1.ObjectMeta{Name: role.Name, Namespace: role.Namespace, Labels: role.Labels}, role.Rules
+	default:
+		return nil
+	}
+
+	findings, tightened := checkRules(roleRef.Kind, meta, rules, ref)
+	res.Findings = append(res.Findings, findings...)
+	if tightened != "" {
+		res.SuggestedManifests = append(res.SuggestedManifests, tightened)
+	}
+	return nil
+}
+
+func bindsServiceAccount(subjects []rbacv1.Subject, ref serviceAccountRef) bool {
+	for _, subject := range subjects {
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Name == ref.Name && subject.Namespace == ref.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRules inspects the rules of a Role or a ClusterRole and returns the
+// findings along with a tightened manifest of the role if any rule had to be
+// changed
+func checkRules(kind string, meta metav1.ObjectMeta, roleRules []rbacv1.PolicyRule, ref serviceAccountRef) ([]SecurityFinding, string) {
+	var findings []SecurityFinding
+	var rules []rbacv1.PolicyRule
+	changed := false
+	resource := kind + "/" + meta.Name
+	if meta.Namespace != "" {
+		resource = kind + "/" + meta.Namespace + "/" + meta.Name
+	}
+
+	for _, rule := range roleRules {
+		if ref.neededVerbs != nil && !groupsAllowed(rule.APIGroups, ref.neededVerbs) {
+			findings = append(findings, SecurityFinding{
+				Kind:     findingUnused,
+				Severity: severityLow,
+				Resource: resource,
+				Message:  fmt.Sprintf("API groups %v are not used by %s", rule.APIGroups, ref.Component),
+			})
+			changed = true
+			continue
+		}
+
+		if contains(rule.Verbs, "*") {
+			finding := SecurityFinding{
+				Kind:     findingOverBroad,
+				Severity: severityHigh,
+				Resource: resource,
+				Message:  fmt.Sprintf("wildcard verbs granted on %v", rule.Resources),
+			}
+			// The rule keeps the wildcard when the verbs the workload needs
+			// are unknown, narrowing it blindly would break the workload
+			if verbs := verbsNeeded(rule.APIGroups, ref.neededVerbs); verbs != nil {
+				rule.Verbs = verbs
+				changed = true
+			} else {
+				finding.Message += "; enumerate the verbs explicitly"
+			}
+			findings = append(findings, finding)
+		}
+
+		if contains(rule.Resources, "*") || contains(rule.APIGroups, "*") {
+			findings = append(findings, SecurityFinding{
+				Kind:     findingOverBroad,
+				Severity: severityHigh,
+				Resource: resource,
+				Message:  "wildcard resources or API groups granted; enumerate the resources explicitly",
+			})
+		}
+
+		for _, verb := range []string{"escalate", "bind", "impersonate"} {
+			if contains(rule.Verbs, verb) {
+				findings = append(findings, SecurityFinding{
+					Kind:     findingOverBroad,
+					Severity: severityHigh,
+					Resource: resource,
+					Message:  fmt.Sprintf("privilege escalation verb %q granted", verb),
+				})
+				rule.Verbs = remove(rule.Verbs, verb)
+				changed = true
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if !changed {
+		return findings, ""
+	}
+
+	// Role and ClusterRole only differ by the namespace of the metadata
+	tightened := rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       kind,
+		},
+		ObjectMeta: meta,
+		Rules:      rules,
+	}
+	byt, err := yaml.Marshal(tightened)
+	if err != nil {
+		return findings, ""
+	}
+
+	return findings, string(byt)
+}
+
+func groupsAllowed(groups []string, needed map[string][]string) bool {
+	for _, group := range groups {
+		if group == "*" {
+			return true
+		}
+		if _, ok := needed[group]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// verbsNeeded returns the verbs the workload needs on the API groups of a
+// rule, nil when they aren't known for every group
+func verbsNeeded(groups []string, needed map[string][]string) []string {
+	if needed == nil || len(groups) == 0 {
+		return nil
+	}
+	var verbs []string
+	for _, group := range groups {
+		groupVerbs, ok := needed[group]
+		if !ok {
+			return nil
+		}
+		for _, verb := range groupVerbs {
+			if !contains(verbs, verb) {
+				verbs = append(verbs, verb)
+			}
+		}
+	}
+	return verbs
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, s string) []string {
+	res := make([]string, 0, len(list))
+	for _, item := range list {
+		if item != s {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,119 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"github.com/layer5io/meshery-cilium/internal/paging"
+	"sigs.k8s.io/yaml"
+)
+
+// selfTestBundle is the policy test run by the self-test when none is
+// given: only the client may connect to the server
+var selfTestBundle = PolicyTestBundle{
+	Fixtures: []PolicyTestFixture{
+		{Name: "client", Labels: map[string]string{"app": "client"}},
+		{Name: "other", Labels: map[string]string{"app": "other"}},
+		{Name: "server", Labels: map[string]string{"app": "server"}, Ports: []int{defaultAssertionPort}},
+	},
+	Policies: []map[string]interface{}{{
+		"apiVersion": "cilium.io/v2",
+		"kind":       "CiliumNetworkPolicy",
+		"metadata":   map[string]interface{}{"name": "self-test-allow-client"},
+		"spec": map[string]interface{}{
+			"endpointSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "server"}},
+			"ingress": []interface{}{map[string]interface{}{
+				"fromEndpoints": []interface{}{map[string]interface{}{"matchLabels": map[string]interface{}{"app": "client"}}},
+			}},
+		},
+	}},
+	Assertions: []PolicyTestAssertion{
+		{From: "client", To: "server", Expect: assertionAllow},
+		{From: "other", To: "server", Expect: assertionDeny},
+	},
+}
+
+// SelfTestCheck is the outcome of a single check of the self-test
+type SelfTestCheck struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Details  string `json:"details,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// SelfTestReport is the outcome of the self-test
+type SelfTestReport struct {
+	Version string          `json:"version,omitempty"`
+	Checks  []SelfTestCheck `json:"checks"`
+	Passed  int             `json:"passed"`
+	Failed  int             `json:"failed"`
+}
+
+// selfTest exercises the operations of the adapter against the Cilium
+// installation of the cluster: the agents must be ready, the nodes are
+// probed, the security report is generated and a policy test bundle, the
+// body of the operation or a built-in one, is run
+func (h *Handler) selfTest(ctx context.Context, request adapter.OperationRequest) (string, *SelfTestReport, error) {
+	report := &SelfTestReport{}
+	check := func(name string, run func() (string, error)) {
+		start := time.Now()
+		reportProgress(ctx, fmt.Sprintf("Self-test: %s", name), "")
+		details, err := run()
+		c := SelfTestCheck{Name: name, Passed: err == nil, Details: details, Duration: time.Since(start).Round(time.Millisecond).String()}
+		if err != nil {
+			c.Error = err.Error()
+			report.Failed++
+		} else {
+			report.Passed++
+		}
+		report.Checks = append(report.Checks, c)
+	}
+
+	check("cilium-installed", func() (string, error) {
+		version, err := h.installedCiliumVersion(ctx)
+		report.Version = version
+		return version, err
+	})
+	check("agents-ready", func() (string, error) {
+		rollout, err := h.waitForDaemonSetRollout(ctx, ciliumNamespace, ciliumAgentName)
+		return rollout.String(), err
+	})
+	check("node-features", func() (string, error) {
+		page, err := h.nodeFeatures(ctx, paging.Params{Limit: maxFeatureNodes})
+		if err != nil {
+			return "", err
+		}
+		return reportDetails(page.Items), nil
+	})
+	check("security-report", func() (string, error) {
+		sr, err := h.securityReport(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d ServiceAccounts checked", len(sr.ServiceAccounts)), nil
+	})
+	check("policy-test", func() (string, error) {
+		testRequest := request
+		if testRequest.CustomBody == "" {
+			byt, err := yaml.Marshal(selfTestBundle)
+			if err != nil {
+				return "", err
+			}
+			testRequest.CustomBody = string(byt)
+		}
+		_, pr, err := h.runPolicyTests(ctx, testRequest)
+		if pr == nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d assertions passed, %d failed", pr.Passed, pr.Failed), err
+	})
+
+	if report.Failed > 0 {
+		return status.Running, report, ErrSelfTest(fmt.Errorf("%d of %d checks failed", report.Failed, len(report.Checks)))
+	}
+	return status.Completed, report, nil
+}
@@ -0,0 +1,51 @@
+package cilium
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle tracks the operations running in the background so that they
+// are cancelled and waited for when the adapter shuts down. It is shared by
+// the handlers of every Kubernetes context.
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// running are the operations which can be cancelled on request
+	mu      sync.Mutex
+	running []*runningOperation
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// goOperation runs fn in the background as a tracked operation
+func (h *Handler) goOperation(fn func()) {
+	h.lifecycle.wg.Add(1)
+	go func() {
+		defer h.lifecycle.wg.Done()
+		fn()
+	}()
+}
+
+// Shutdown cancels the context of the running operations and waits for
+// them to stream their final event, or for ctx to be done
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.lifecycle.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		h.lifecycle.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
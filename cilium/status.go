@@ -0,0 +1,267 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const hubbleRelayName = "hubble-relay"
+
+var ciliumNodeResource = schema.GroupVersionResource{
+	Group:    "cilium.io",
+	Version:  "v2",
+	Resource: "ciliumnodes",
+}
+
+// AgentStatus is the health of the Cilium agent of a node
+type AgentStatus struct {
+	Node  string `json:"node"`
+	Pod   string `json:"pod,omitempty"`
+	Ready bool   `json:"ready"`
+	// State is the state the agent reports for itself, Ok when healthy
+	State      string `json:"state,omitempty"`
+	Kubernetes string `json:"kubernetes,omitempty"`
+	// FailingControllers are the controllers whose last run failed
+	FailingControllers []string `json:"failingControllers,omitempty"`
+	// PodCIDRs are the pod CIDRs allocated to the node, Allocated the IPs
+	// the agent allocated out of their Capacity
+	PodCIDRs  []string `json:"podCIDRs,omitempty"`
+	Allocated int      `json:"allocated"`
+	Capacity  int      `json:"capacity"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// OperatorStatus is the availability of the Cilium operator
+type OperatorStatus struct {
+	Desired   int32  `json:"desired"`
+	Ready     int32  `json:"ready"`
+	Available int32  `json:"available"`
+	Version   string `json:"version,omitempty"`
+}
+
+// StatusFeatures are the features enabled on the agents
+type StatusFeatures struct {
+	// Encryption is wireguard, ipsec or disabled
+	Encryption string `json:"encryption"`
+	Hubble     bool   `json:"hubble"`
+	// HubbleRelay reports whether the relay aggregating the flows of the
+	// nodes is ready
+	HubbleRelay          bool   `json:"hubbleRelay"`
+	KubeProxyReplacement string `json:"kubeProxyReplacement"`
+	BandwidthManager     bool   `json:"bandwidthManager"`
+	EgressGateway        bool   `json:"egressGateway"`
+	IngressController    bool   `json:"ingressController"`
+	// IPAM is the IP address management mode, e.g. cluster-pool
+	IPAM        string `json:"ipam"`
+	RoutingMode string `json:"routingMode,omitempty"`
+}
+
+// PoolUsage sums the IPs the agents allocated out of the pod CIDRs of
+// their node
+type PoolUsage struct {
+	// CIDRs are the cluster pool the pod CIDRs of the nodes are carved
+	// from, empty when the IPAM mode has no cluster pool
+	CIDRs     []string `json:"cidrs,omitempty"`
+	Allocated int      `json:"allocated"`
+	Capacity  int      `json:"capacity"`
+}
+
+// CiliumStatus is the structured equivalent of cilium status --verbose
+type CiliumStatus struct {
+	Version  string         `json:"version"`
+	Healthy  bool           `json:"healthy"`
+	Agents   []AgentStatus  `json:"agents"`
+	Operator OperatorStatus `json:"operator"`
+	Features StatusFeatures `json:"features"`
+	Pool     PoolUsage      `json:"pool"`
+}
+
+// Summary describes the status in a sentence
+func (s *CiliumStatus) Summary() string {
+	ready := 0
+	for _, a := range s.Agents {
+		if a.Ready && a.Error == "" {
+			ready++
+		}
+	}
+	return fmt.Sprintf("Cilium %s: %d/%d agents healthy, operator %d/%d ready, %d/%d pool IPs allocated",
+		s.Version, ready, len(s.Agents), s.Operator.Ready, s.Operator.Desired, s.Pool.Allocated, s.Pool.Capacity)
+}
+
+// agentStatusResponse is the part of the output of cilium status -o json
+// the status reports
+type agentStatusResponse struct {
+	Cilium *struct {
+		State string `json:"state"`
+		Msg   string `json:"msg"`
+	} `json:"cilium"`
+	Kubernetes *struct {
+		State string `json:"state"`
+	} `json:"kubernetes"`
+	Controllers []struct {
+		Name   string `json:"name"`
+		Status struct {
+			ConsecutiveFailureCount int    `json:"consecutive-failure-count"`
+			LastFailureMsg          string `json:"last-failure-msg"`
+		} `json:"status"`
+	} `json:"controllers"`
+	IPAM *struct {
+		Allocations map[string]string `json:"allocations"`
+	} `json:"ipam"`
+}
+
+// ciliumStatus collects the health of the agents of every node, the
+// availability of the operator, the features enabled and the usage of the
+// pod CIDRs. The agents which can't be queried are reported along with
+// the error instead of failing the status.
+func (h *Handler) ciliumStatus(ctx context.Context) (*CiliumStatus, error) {
+	if h.KubeClient == nil || h.DynamicKubeClient == nil {
+		return nil, ErrNilClient
+	}
+	version, err := h.installedCiliumVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := h.agentConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st := &CiliumStatus{Version: version, Agents: []AgentStatus{}, Features: statusFeatures(cfg)}
+	if cidrs := strings.Fields(cfg["cluster-pool-ipv4-cidr"]); len(cidrs) > 0 {
+		st.Pool.CIDRs = cidrs
+	}
+
+	op, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Get(ctx, ciliumOperatorName, metav1.GetOptions{})
+	if err != nil {
+		return nil, ErrCiliumStatus(err)
+	}
+	st.Operator = OperatorStatus{Ready: op.Status.ReadyReplicas, Available: op.Status.AvailableReplicas}
+	if op.Spec.Replicas != nil {
+		st.Operator.Desired = *op.Spec.Replicas
+	}
+	for _, c := range op.Spec.Template.Spec.Containers {
+		st.Operator.Version = imageVersion(c.Image)
+	}
+
+	if relay, err := h.KubeClient.AppsV1().Deployments(ciliumNamespace).Get(ctx, hubbleRelayName, metav1.GetOptions{}); err == nil {
+		st.Features.HubbleRelay = relay.Status.ReadyReplicas > 0
+	}
+
+	nodes, err := h.DynamicKubeClient.Resource(ciliumNodeResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrCiliumStatus(err)
+	}
+	podCIDRs := map[string][]string{}
+	for i := range nodes.Items {
+		cidrs, _, _ := unstructured.NestedStringSlice(nodes.Items[i].Object, "spec", "ipam", "podCIDRs")
+		podCIDRs[nodes.Items[i].GetName()] = cidrs
+	}
+
+	pods, err := h.KubeClient.CoreV1().Pods(ciliumNamespace).List(ctx, metav1.ListOptions{LabelSelector: ciliumAgentSelector})
+	if err != nil {
+		return nil, ErrCiliumStatus(err)
+	}
+	st.Healthy = st.Operator.Desired == st.Operator.Ready
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		agent := h.agentStatus(pod.Name, podReady(pod))
+		agent.Node = pod.Spec.NodeName
+		agent.PodCIDRs = podCIDRs[agent.Node]
+		agent.Capacity = cidrCapacity(agent.PodCIDRs)
+		st.Pool.Allocated += agent.Allocated
+		st.Pool.Capacity += agent.Capacity
+		st.Healthy = st.Healthy && agent.Ready && agent.State == "Ok" && len(agent.FailingControllers) == 0
+		st.Agents = append(st.Agents, agent)
+	}
+	sort.Slice(st.Agents, func(i, j int) bool { return st.Agents[i].Node < st.Agents[j].Node })
+	return st, nil
+}
+
+// agentStatus queries the status of the agent running in pod
+func (h *Handler) agentStatus(pod string, ready bool) AgentStatus {
+	agent := AgentStatus{Pod: pod, Ready: ready}
+	if !ready {
+		agent.Error = "the agent pod is not ready"
+		return agent
+	}
+	out, err := h.execInAgent(pod, []string{"cilium", "status", "-o", "json"})
+	if err != nil {
+		agent.Error = err.Error()
+		return agent
+	}
+	res := agentStatusResponse{}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		agent.Error = fmt.Sprintf("unexpected output of cilium status: %s", err)
+		return agent
+	}
+
+	if res.Cilium != nil {
+		agent.State = res.Cilium.State
+		if res.Cilium.State != "Ok" && res.Cilium.Msg != "" {
+			agent.Error = res.Cilium.Msg
+		}
+	}
+	if res.Kubernetes != nil {
+		agent.Kubernetes = res.Kubernetes.State
+	}
+	for _, c := range res.Controllers {
+		if c.Status.ConsecutiveFailureCount > 0 {
+			agent.FailingControllers = append(agent.FailingControllers, fmt.Sprintf("%s: %s", c.Name, c.Status.LastFailureMsg))
+		}
+	}
+	if res.IPAM != nil {
+		agent.Allocated = len(res.IPAM.Allocations)
+	}
+	return agent
+}
+
+func statusFeatures(cfg map[string]string) StatusFeatures {
+	f := StatusFeatures{
+		Encryption:           "disabled",
+		Hubble:               cfg["enable-hubble"] == "true",
+		KubeProxyReplacement: cfg["kube-proxy-replacement"],
+		BandwidthManager:     cfg["enable-bandwidth-manager"] == "true",
+		EgressGateway:        egressGatewayEnabled(cfg),
+		IngressController:    cfg["enable-ingress-controller"] == "true",
+		IPAM:                 cfg["ipam"],
+		RoutingMode:          cfg["routing-mode"],
+	}
+	switch {
+	case cfg["enable-wireguard"] == "true":
+		f.Encryption = encryptionWireguard
+	case cfg["enable-ipsec"] == "true":
+		f.Encryption = encryptionIPsec
+	}
+	if f.KubeProxyReplacement == "" {
+		f.KubeProxyReplacement = "disabled"
+	}
+	if f.RoutingMode == "" && cfg["tunnel"] != "" {
+		f.RoutingMode = "tunnel " + cfg["tunnel"]
+	}
+	return f
+}
+
+// cidrCapacity counts the addresses of the IPv4 CIDRs
+func cidrCapacity(cidrs []string) int {
+	total := 0
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil || n.IP.To4() == nil {
+			continue
+		}
+		ones, bits := n.Mask.Size()
+		total += 1 << uint(bits-ones)
+	}
+	return total
+}
@@ -0,0 +1,93 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/layer5io/meshery-adapter-library/status"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+)
+
+const (
+	tetragonHelmChart = "tetragon"
+	tetragonName      = "tetragon"
+)
+
+// tetragonImages are the images of the Tetragon chart
+var tetragonImages = []chartImage{
+	{"tetragon.image", "quay.io/cilium/tetragon"},
+	{"tetragonOperator.image", "quay.io/cilium/tetragon-operator"},
+	{"export.stdout.image", "quay.io/cilium/hubble-export-stdout"},
+}
+
+// installTetragon installs or removes the Tetragon Helm chart next to Cilium.
+// Its images are pulled from the registry of the install request, as those
+// of Cilium, and the install completes once its agents rolled out.
+func (h *Handler) installTetragon(ctx context.Context, del bool, version string, install InstallRequest) (string, error) {
+	h.Log.Debug(fmt.Sprintf("Requested Tetragon version: %s", version))
+	h.Log.Debug(fmt.Sprintf("Requested action is delete: %v", del))
+
+	st := status.Installing
+	if del {
+		st = status.Removing
+	}
+
+	kClient := h.MesheryKubeclient
+	if kClient == nil {
+		return st, ErrNilClient
+	}
+
+	values := map[string]interface{}{}
+	act := mesherykube.UNINSTALL
+	if !del {
+		act = mesherykube.INSTALL
+		if err := h.tetragonValues(ctx, values, install); err != nil {
+			return st, err
+		}
+	}
+
+	reportProgress(ctx, fmt.Sprintf("Fetching Tetragon chart %s", version), fmt.Sprintf("Fetching chart %s %s from %s.", tetragonHelmChart, version, ciliumHelmRepository))
+	if err := kClient.ApplyHelmChart(mesherykube.ApplyHelmChartConfig{
+		ChartLocation: mesherykube.HelmChartLocation{
+			Repository: ciliumHelmRepository,
+			Chart:      tetragonHelmChart,
+			Version:    version,
+		},
+		Namespace:      ciliumNamespace,
+		Action:         act,
+		OverrideValues: values,
+	}); err != nil {
+		return st, ErrInstallTetragon(err)
+	}
+
+	if del {
+		return status.Removed, nil
+	}
+	noteResource(ctx, "DaemonSet", ciliumNamespace, tetragonName)
+	rollout, err := h.waitForDaemonSetRollout(ctx, ciliumNamespace, tetragonName)
+	if err != nil {
+		noteRemediation(ctx, fmt.Sprintf("Inspect the pods of the %s DaemonSet in %s, e.g. for images failing to pull", tetragonName, ciliumNamespace))
+		return st, ErrInstallTetragon(err)
+	}
+	reportProgress(ctx, fmt.Sprintf("Tetragon chart %s applied", version), fmt.Sprintf("Tetragon agents ready: %s.", rollout))
+	return status.Installed, nil
+}
+
+// tetragonValues sets the chart values of a Tetragon install: the pods are
+// labeled with the Meshery environment and pulled from the registry of the
+// install
+func (h *Handler) tetragonValues(ctx context.Context, values map[string]interface{}, install InstallRequest) error {
+	if install.Registry != nil {
+		if err := h.registryValues(ctx, values, *install.Registry, tetragonImages); err != nil {
+			return err
+		}
+	}
+	if labels := environmentFrom(ctx); len(labels) > 0 {
+		podLabels := map[string]interface{}{}
+		for k, v := range labels {
+			podLabels[k] = v
+		}
+		setValue(values, "podLabels", podLabels)
+	}
+	return nil
+}
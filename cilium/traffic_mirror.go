@@ -0,0 +1,317 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	mirrorPrefix          = "meshery-mirror-"
+	mirrorExpiryKey       = "meshery.io/mirror-expires-at"
+	mirrorSinkImage       = "mendhak/http-https-echo:24"
+	mirrorSinkPort        = 8080
+	defaultMirrorDuration = 10 * time.Minute
+	maxMirrorDuration     = time.Hour
+)
+
+var ciliumEnvoyConfigResource = schema.GroupVersionResource{
+	Group:    "cilium.io",
+	Version:  "v2",
+	Resource: "ciliumenvoyconfigs",
+}
+
+// MirrorRequest is the body of a traffic mirroring operation
+type MirrorRequest struct {
+	// Service is the name of the service whose HTTP requests are mirrored
+	Service string `json:"service"`
+	// Duration bounds the mirroring, the mirror is torn down afterwards
+	Duration string `json:"duration,omitempty"`
+}
+
+// parseMirrorRequest reads the service and duration from the body of the
+// operation
+func parseMirrorRequest(body string) (MirrorRequest, time.Duration, error) {
+	req := MirrorRequest{}
+	if err := yaml.Unmarshal([]byte(body), &req); err != nil {
+		return req, 0, err
+	}
+	if req.Service == "" {
+		return req, 0, fmt.Errorf("service is required")
+	}
+
+	duration := defaultMirrorDuration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return req, 0, err
+		}
+		duration = d
+	}
+	if duration <= 0 || duration > maxMirrorDuration {
+		return req, 0, fmt.Errorf("duration must be between 0 and %s", maxMirrorDuration)
+	}
+	return req, duration, nil
+}
+
+// mirrorTraffic mirrors the HTTP requests received by a service to a sink
+// pod logging them. Cilium redirects the traffic of the service to an Envoy
+// listener which forwards every request to the service backends and a copy
+// to the sink. The mirror is torn down once the duration elapsed and the
+// requests logged by the sink are stored as an artifact of the operation.
+func (h *Handler) mirrorTraffic(ctx context.Context, request adapter.OperationRequest) (string, string, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+
+	h.sweepExpiredMirrors(ctx)
+
+	mirror, duration, err := parseMirrorRequest(request.CustomBody)
+	if err != nil {
+		return st, "", ErrTrafficMirror(err)
+	}
+	namespace := request.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	if request.IsDeleteOperation {
+		if err := h.teardownMirror(ctx, namespace, mirror.Service, request.OperationID); err != nil {
+			return st, "", ErrTrafficMirror(err)
+		}
+		return status.Removed, fmt.Sprintf("Traffic mirror of %s/%s removed.", namespace, mirror.Service), nil
+	}
+
+	if h.KubeClient == nil {
+		return st, "", ErrNilClient
+	}
+	if _, err := h.KubeClient.CoreV1().Services(namespace).Get(ctx, mirror.Service, metav1.GetOptions{}); err != nil {
+		return st, "", ErrTrafficMirror(err)
+	}
+
+	expires := time.Now().Add(duration)
+	manifest, err := mirrorManifest(namespace, mirror.Service, expires)
+	if err != nil {
+		return st, "", ErrTrafficMirror(err)
+	}
+	if err := h.applyOrdered(ctx, manifest, false, namespace); err != nil {
+		return st, "", ErrTrafficMirror(err)
+	}
+
+	go func() {
+		time.Sleep(time.Until(expires))
+		e := &adapter.Event{Operationid: request.OperationID}
+		if err := h.teardownMirror(context.TODO(), namespace, mirror.Service, request.OperationID); err != nil {
+			e.Summary = fmt.Sprintf("Error while removing traffic mirror of %s/%s", namespace, mirror.Service)
+			e.Details = err.Error()
+			h.StreamErr(e, ErrTrafficMirror(err))
+			return
+		}
+		e.Summary = fmt.Sprintf("Traffic mirror of %s/%s expired and was removed", namespace, mirror.Service)
+		e.Details = "The mirrored requests are stored as an artifact of the operation."
+		h.StreamInfo(e)
+	}()
+
+	return status.Applied, fmt.Sprintf("Requests to %s/%s are mirrored to %s%s until %s.", namespace, mirror.Service, mirrorPrefix, mirror.Service, expires.Format(time.RFC3339)), nil
+}
+
+// teardownMirror stores the requests logged by the sink as an artifact and
+// removes the mirror of a service
+func (h *Handler) teardownMirror(ctx context.Context, namespace, service, operationID string) error {
+	if logs, err := h.sinkLogs(ctx, namespace, service); err == nil {
+		h.attachArtifact(operationID, fmt.Sprintf("mirror-%s-%s.log", namespace, service), logs)
+	}
+
+	manifest, err := mirrorManifest(namespace, service, time.Time{})
+	if err != nil {
+		return err
+	}
+	return h.applyOrdered(ctx, manifest, true, namespace)
+}
+
+// sweepExpiredMirrors removes the mirrors whose teardown was lost, e.g.
+// because the adapter restarted in the meantime
+func (h *Handler) sweepExpiredMirrors(ctx context.Context) {
+	if h.DynamicKubeClient == nil {
+		return
+	}
+	list, err := h.DynamicKubeClient.Resource(ciliumEnvoyConfigResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+	for _, item := range list.Items {
+		expires, err := time.Parse(time.RFC3339, item.GetAnnotations()[mirrorExpiryKey])
+		if err != nil || time.Now().Before(expires) || !strings.HasPrefix(item.GetName(), mirrorPrefix) {
+			continue
+		}
+		if err := h.teardownMirror(ctx, item.GetNamespace(), strings.TrimPrefix(item.GetName(), mirrorPrefix), ""); err != nil {
+			h.Log.Error(ErrTrafficMirror(err))
+		}
+	}
+}
+
+// sinkLogs returns the requests logged by the sink of a mirror
+func (h *Handler) sinkLogs(ctx context.Context, namespace, service string) ([]byte, error) {
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+	pods, err := h.KubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + mirrorPrefix + service})
+	if err != nil {
+		return nil, err
+	}
+	var logs []byte
+	for _, pod := range pods.Items {
+		byt, err := h.KubeClient.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, byt...)
+	}
+	return logs, nil
+}
+
+// mirrorManifest renders the sink and the CiliumEnvoyConfig mirroring the
+// requests of a service
+func mirrorManifest(namespace, service string, expires time.Time) ([]byte, error) {
+	name := mirrorPrefix + service
+	labels := map[string]interface{}{"app": name}
+	serviceCluster := fmt.Sprintf("%s/%s", namespace, service)
+	sinkCluster := fmt.Sprintf("%s/%s", namespace, name)
+
+	annotations := map[string]interface{}{}
+	if !expires.IsZero() {
+		annotations[mirrorExpiryKey] = expires.Format(time.RFC3339)
+	}
+
+	cluster := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"@type":           "type.googleapis.com/envoy.config.cluster.v3.Cluster",
+			"name":            name,
+			"connect_timeout": "5s",
+			"lb_policy":       "ROUND_ROBIN",
+			"type":            "EDS",
+		}
+	}
+
+	docs := []map[string]interface{}{
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "labels": labels},
+			"spec": map[string]interface{}{
+				"replicas": 1,
+				"selector": map[string]interface{}{"matchLabels": labels},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"labels": labels},
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":  "sink",
+								"image": mirrorSinkImage,
+								"env": []interface{}{
+									map[string]interface{}{"name": "HTTP_PORT", "value": fmt.Sprint(mirrorSinkPort)},
+								},
+								"ports": []interface{}{
+									map[string]interface{}{"containerPort": mirrorSinkPort},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "labels": labels},
+			"spec": map[string]interface{}{
+				"selector": labels,
+				"ports": []interface{}{
+					map[string]interface{}{"name": "http", "port": mirrorSinkPort, "targetPort": mirrorSinkPort},
+				},
+			},
+		},
+		{
+			"apiVersion": "cilium.io/v2",
+			"kind":       "CiliumEnvoyConfig",
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "annotations": annotations},
+			"spec": map[string]interface{}{
+				"services": []interface{}{
+					map[string]interface{}{"name": service, "namespace": namespace},
+				},
+				"backendServices": []interface{}{
+					map[string]interface{}{"name": service, "namespace": namespace},
+					map[string]interface{}{"name": name, "namespace": namespace},
+				},
+				"resources": []interface{}{
+					map[string]interface{}{
+						"@type": "type.googleapis.com/envoy.config.listener.v3.Listener",
+						"name":  name,
+						"filter_chains": []interface{}{
+							map[string]interface{}{
+								"filters": []interface{}{
+									map[string]interface{}{
+										"name": "envoy.filters.network.http_connection_manager",
+										"typed_config": map[string]interface{}{
+											"@type":       "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+											"stat_prefix": name,
+											"rds":         map[string]interface{}{"route_config_name": name},
+											"http_filters": []interface{}{
+												map[string]interface{}{
+													"name":         "envoy.filters.http.router",
+													"typed_config": map[string]interface{}{"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					map[string]interface{}{
+						"@type": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+						"name":  name,
+						"virtual_hosts": []interface{}{
+							map[string]interface{}{
+								"name":    name,
+								"domains": []interface{}{"*"},
+								"routes": []interface{}{
+									map[string]interface{}{
+										"match": map[string]interface{}{"prefix": "/"},
+										"route": map[string]interface{}{
+											"cluster": serviceCluster,
+											"request_mirror_policies": []interface{}{
+												map[string]interface{}{"cluster": sinkCluster},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					cluster(serviceCluster),
+					cluster(sinkCluster),
+				},
+			},
+		},
+	}
+
+	var manifest []string
+	for _, doc := range docs {
+		byt, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, string(byt))
+	}
+	return []byte(strings.Join(manifest, "---\n")), nil
+}
@@ -0,0 +1,51 @@
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+)
+
+// AnnounceUpgrade streams an event when the release channel the adapter is
+// subscribed to points at a newer version than the one running in the
+// cluster managed by the adapter handler h
+func AnnounceUpgrade(h adapter.Handler, channel, version string) {
+	handler, ok := h.(*Handler)
+	if !ok || handler.KubeClient == nil {
+		// No cluster configured yet, the next registration checks again
+		return
+	}
+
+	installed, err := handler.installedCiliumVersion(context.TODO())
+	if err != nil || installed == "" {
+		return
+	}
+	if !versionLess(installed, version) {
+		return
+	}
+
+	handler.StreamInfo(&adapter.Event{
+		Summary: fmt.Sprintf("Cilium %s available", version),
+		Details: fmt.Sprintf("The %s release channel points at Cilium %s, the cluster runs Cilium %s.", channel, version, installed),
+	})
+}
+
+// versionLess reports whether the semver a precedes b, pre-release
+// suffixes are ignored
+func versionLess(a, b string) bool {
+	var av, bv [3]int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(a, "v"), "%d.%d.%d", &av[0], &av[1], &av[2]); err != nil {
+		return false
+	}
+	if _, err := fmt.Sscanf(strings.TrimPrefix(b, "v"), "%d.%d.%d", &bv[0], &bv[1], &bv[2]); err != nil {
+		return false
+	}
+	for i := range av {
+		if av[i] != bv[i] {
+			return av[i] < bv[i]
+		}
+	}
+	return false
+}
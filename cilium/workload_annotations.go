@@ -0,0 +1,357 @@
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	proxyVisibilityAnnotation = "policy.cilium.io/proxy-visibility"
+	// legacyProxyVisibilityAnnotation is read by the agents before 1.11
+	legacyProxyVisibilityAnnotation = "io.cilium.proxy-visibility"
+	egressBandwidthAnnotation       = "kubernetes.io/egress-bandwidth"
+	ingressBandwidthAnnotation      = "kubernetes.io/ingress-bandwidth"
+)
+
+// workloadAnnotations are the per-pod annotations of Cilium the workload
+// reports list
+var workloadAnnotations = []string{
+	proxyVisibilityAnnotation,
+	legacyProxyVisibilityAnnotation,
+	egressBandwidthAnnotation,
+	ingressBandwidthAnnotation,
+}
+
+// VisibilityRule redirects the traffic of a port to the L7 proxy of the
+// agent so that Hubble shows its L7 flows
+type VisibilityRule struct {
+	// Direction is Ingress or Egress
+	Direction string `json:"direction"`
+	Port      int    `json:"port"`
+	// Protocol is TCP, UDP or ANY, TCP by default
+	Protocol string `json:"protocol,omitempty"`
+	// L7 is the protocol parsed by the proxy, HTTP, Kafka or DNS
+	L7 string `json:"l7"`
+}
+
+func (r VisibilityRule) String() string {
+	return fmt.Sprintf("<%s/%d/%s/%s>", r.Direction, r.Port, r.Protocol, r.L7)
+}
+
+func (r *VisibilityRule) validate() error {
+	if r.Protocol == "" {
+		r.Protocol = "TCP"
+	}
+	switch {
+	case r.Direction != "Ingress" && r.Direction != "Egress":
+		return fmt.Errorf("direction of port %d must be Ingress or Egress", r.Port)
+	case r.Port <= 0 || r.Port > 65535:
+		return fmt.Errorf("port %d is out of range", r.Port)
+	case r.Protocol != "TCP" && r.Protocol != "UDP" && r.Protocol != "ANY":
+		return fmt.Errorf("protocol of port %d must be TCP, UDP or ANY", r.Port)
+	case r.L7 != "HTTP" && r.L7 != "Kafka" && r.L7 != "DNS":
+		return fmt.Errorf("l7 of port %d must be HTTP, Kafka or DNS", r.Port)
+	}
+	return nil
+}
+
+// AnnotationRequest is the body of the workload annotation operations
+type AnnotationRequest struct {
+	// Selector is the label selector of the Deployments, StatefulSets and
+	// DaemonSets annotated, every workload of the namespace when empty
+	Selector string `json:"selector"`
+	// Visibility are the ports whose L7 traffic is made visible
+	Visibility []VisibilityRule `json:"visibility,omitempty"`
+	// EgressBandwidth and IngressBandwidth limit the bandwidth of the pods,
+	// e.g. 10M
+	EgressBandwidth  string `json:"egressBandwidth,omitempty"`
+	IngressBandwidth string `json:"ingressBandwidth,omitempty"`
+}
+
+// AnnotatedWorkload is a workload whose pods carry Cilium annotations
+type AnnotatedWorkload struct {
+	Kind        string            `json:"kind"`
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// AnnotationReport lists the workloads changed by an annotation operation
+// and the workloads annotated once it is done
+type AnnotationReport struct {
+	Changed   []string            `json:"changed"`
+	Workloads []AnnotatedWorkload `json:"workloads"`
+}
+
+// workloadKinds patch and list the pod templates of the workloads
+var workloadKinds = []struct {
+	kind  string
+	list  func(h *Handler, ctx context.Context, namespace, selector string) (map[string]map[string]string, error)
+	patch func(h *Handler, ctx context.Context, namespace, name string, patch []byte) error
+}{
+	{
+		kind: "Deployment",
+		list: func(h *Handler, ctx context.Context, namespace, selector string) (map[string]map[string]string, error) {
+			list, err := h.KubeClient.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, err
+			}
+			res := map[string]map[string]string{}
+			for _, w := range list.Items {
+				res[w.Name] = w.Spec.Template.Annotations
+			}
+			return res, nil
+		},
+		patch: func(h *Handler, ctx context.Context, namespace, name string, patch []byte) error {
+			_, err := h.KubeClient.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+			return err
+		},
+	},
+	{
+		kind: "StatefulSet",
+		list: func(h *Handler, ctx context.Context, namespace, selector string) (map[string]map[string]string, error) {
+			list, err := h.KubeClient.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, err
+			}
+			res := map[string]map[string]string{}
+			for _, w := range list.Items {
+				res[w.Name] = w.Spec.Template.Annotations
+			}
+			return res, nil
+		},
+		patch: func(h *Handler, ctx context.Context, namespace, name string, patch []byte) error {
+			_, err := h.KubeClient.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+			return err
+		},
+	},
+	{
+		kind: "DaemonSet",
+		list: func(h *Handler, ctx context.Context, namespace, selector string) (map[string]map[string]string, error) {
+			list, err := h.KubeClient.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, err
+			}
+			res := map[string]map[string]string{}
+			for _, w := range list.Items {
+				res[w.Name] = w.Spec.Template.Annotations
+			}
+			return res, nil
+		},
+		patch: func(h *Handler, ctx context.Context, namespace, name string, patch []byte) error {
+			_, err := h.KubeClient.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+			return err
+		},
+	},
+}
+
+// annotateVisibility sets the proxy visibility annotation on the pod
+// templates of the selected workloads, the delete removes it along with
+// the annotation of the agents before 1.11
+func (h *Handler) annotateVisibility(ctx context.Context, request adapter.OperationRequest) (string, *AnnotationReport, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	req, err := parseAnnotationRequest(request.CustomBody)
+	if err != nil {
+		return st, nil, ErrWorkloadAnnotations(err)
+	}
+
+	annotations := map[string]interface{}{
+		proxyVisibilityAnnotation:       nil,
+		legacyProxyVisibilityAnnotation: nil,
+	}
+	if !request.IsDeleteOperation {
+		if len(req.Visibility) == 0 {
+			return st, nil, ErrWorkloadAnnotations(fmt.Errorf("visibility lists no port"))
+		}
+		rules := make([]string, 0, len(req.Visibility))
+		for i := range req.Visibility {
+			if err := req.Visibility[i].validate(); err != nil {
+				return st, nil, ErrWorkloadAnnotations(err)
+			}
+			rules = append(rules, req.Visibility[i].String())
+		}
+		annotations[proxyVisibilityAnnotation] = strings.Join(rules, ",")
+	}
+
+	report, err := h.annotateWorkloads(ctx, workloadNamespace(request), req.Selector, annotations)
+	if err != nil {
+		return st, report, ErrWorkloadAnnotations(err)
+	}
+	if request.IsDeleteOperation {
+		return status.Removed, report, nil
+	}
+	return status.Applied, report, nil
+}
+
+// annotateBandwidth sets the bandwidth limits on the pod templates of the
+// selected workloads, which the bandwidth manager of the agents enforces
+func (h *Handler) annotateBandwidth(ctx context.Context, request adapter.OperationRequest) (string, *AnnotationReport, error) {
+	st := status.Applying
+	if request.IsDeleteOperation {
+		st = status.Removing
+	}
+	req, err := parseAnnotationRequest(request.CustomBody)
+	if err != nil {
+		return st, nil, ErrWorkloadAnnotations(err)
+	}
+
+	annotations := map[string]interface{}{
+		egressBandwidthAnnotation:  nil,
+		ingressBandwidthAnnotation: nil,
+	}
+	if !request.IsDeleteOperation {
+		if req.EgressBandwidth == "" && req.IngressBandwidth == "" {
+			return st, nil, ErrWorkloadAnnotations(fmt.Errorf("egressBandwidth or ingressBandwidth is required"))
+		}
+		for key, val := range map[string]string{egressBandwidthAnnotation: req.EgressBandwidth, ingressBandwidthAnnotation: req.IngressBandwidth} {
+			if val == "" {
+				continue
+			}
+			if _, err := resource.ParseQuantity(val); err != nil {
+				return st, nil, ErrWorkloadAnnotations(fmt.Errorf("%s: %s", key, err))
+			}
+			annotations[key] = val
+		}
+
+		cfg, err := h.agentConfig(ctx)
+		if err != nil {
+			return st, nil, ErrWorkloadAnnotations(err)
+		}
+		if cfg["enable-bandwidth-manager"] != "true" {
+			return st, nil, ErrWorkloadAnnotations(fmt.Errorf("the bandwidth manager of the agents is disabled, the limits would be ignored"))
+		}
+	}
+
+	report, err := h.annotateWorkloads(ctx, workloadNamespace(request), req.Selector, annotations)
+	if err != nil {
+		return st, report, ErrWorkloadAnnotations(err)
+	}
+	if request.IsDeleteOperation {
+		return status.Removed, report, nil
+	}
+	return status.Applied, report, nil
+}
+
+func parseAnnotationRequest(body string) (AnnotationRequest, error) {
+	req := AnnotationRequest{}
+	if err := yaml.Unmarshal([]byte(body), &req); err != nil {
+		return req, err
+	}
+	if req.Selector != "" {
+		if _, err := metav1.ParseToLabelSelector(req.Selector); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+func workloadNamespace(request adapter.OperationRequest) string {
+	if request.Namespace == "" {
+		return "default"
+	}
+	return request.Namespace
+}
+
+// annotateWorkloads patches the pod templates of the workloads matching
+// selector whose annotations differ, a nil value removes the annotation.
+// Patching the template rolls the pods out with the annotations.
+func (h *Handler) annotateWorkloads(ctx context.Context, namespace, selector string, annotations map[string]interface{}) (*AnnotationReport, error) {
+	if h.KubeClient == nil {
+		return nil, ErrNilClient
+	}
+	report := &AnnotationReport{Changed: []string{}}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"annotations": annotations},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range workloadKinds {
+		workloads, err := k.list(h, ctx, namespace, selector)
+		if err != nil {
+			return report, err
+		}
+		names := make([]string, 0, len(workloads))
+		for name, current := range workloads {
+			if annotationsDiffer(current, annotations) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := k.patch(h, ctx, namespace, name, patch); err != nil {
+				return report, fmt.Errorf("%s %s/%s: %s", k.kind, namespace, name, err)
+			}
+			report.Changed = append(report.Changed, fmt.Sprintf("%s %s/%s", k.kind, namespace, name))
+			reportProgress(ctx, fmt.Sprintf("Annotating workloads, %d changed", len(report.Changed)), fmt.Sprintf("%s %s/%s annotated.", k.kind, namespace, name))
+		}
+	}
+
+	report.Workloads, err = h.annotatedWorkloads(ctx, namespace)
+	return report, err
+}
+
+func annotationsDiffer(current map[string]string, annotations map[string]interface{}) bool {
+	for key, val := range annotations {
+		cur, ok := current[key]
+		if val == nil {
+			if ok {
+				return true
+			}
+			continue
+		}
+		if !ok || cur != val {
+			return true
+		}
+	}
+	return false
+}
+
+// annotatedWorkloads lists the workloads of namespace whose pod template
+// carries one of the annotations of Cilium
+func (h *Handler) annotatedWorkloads(ctx context.Context, namespace string) ([]AnnotatedWorkload, error) {
+	res := []AnnotatedWorkload{}
+	for _, k := range workloadKinds {
+		workloads, err := k.list(h, ctx, namespace, "")
+		if err != nil {
+			return res, err
+		}
+		for name, current := range workloads {
+			found := map[string]string{}
+			for _, key := range workloadAnnotations {
+				if val, ok := current[key]; ok {
+					found[key] = val
+				}
+			}
+			if len(found) > 0 {
+				res = append(res, AnnotatedWorkload{Kind: k.kind, Namespace: namespace, Name: name, Annotations: found})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
@@ -0,0 +1,257 @@
+// Package client is a typed Go client for the gRPC and HTTP APIs of the
+// Cilium adapter, for tools and tests integrating with the adapter without
+// going through Meshery.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	"github.com/layer5io/meshery-cilium/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Report is an operation producing a JSON report, along with the artifact
+// the report is also stored as
+type Report struct {
+	Operation string
+	Artifact  string
+}
+
+// Reports of the adapter
+var (
+	SecurityReport = Report{Operation: config.CiliumSecurityReportOperation, Artifact: "security-report.json"}
+	EgressIPReport = Report{Operation: config.CiliumEgressIPReportOperation, Artifact: "egress-ip-report.json"}
+)
+
+// Options configure the connection to the adapter
+type Options struct {
+	// Address is the host:port of the gRPC API
+	Address string
+	// TLS secures the gRPC connection, nil connects in plain text
+	TLS *tls.Config
+	// APIAddress is the base URL the artifacts are served at, e.g.
+	// http://localhost:10014, reports which don't fit in an event are
+	// downloaded from it. It is reached with the TLS settings as well.
+	APIAddress string
+}
+
+// Client talks to a Cilium adapter
+type Client struct {
+	conn   *grpc.ClientConn
+	mesh   meshes.MeshServiceClient
+	api    string
+	client *http.Client
+}
+
+// New connects to the adapter described by opts
+func New(ctx context.Context, opts Options) (*Client, error) {
+	creds := grpc.WithInsecure()
+	if opts.TLS != nil {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(opts.TLS))
+	}
+	conn, err := grpc.DialContext(ctx, opts.Address, creds)
+	if err != nil {
+		return nil, ErrConnect(err)
+	}
+	client := http.DefaultClient
+	if opts.TLS != nil {
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: opts.TLS}}
+	}
+	return &Client{
+		conn:   conn,
+		mesh:   meshes.NewMeshServiceClient(conn),
+		api:    strings.TrimSuffix(opts.APIAddress, "/"),
+		client: client,
+	}, nil
+}
+
+// Close closes the connection to the adapter
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Connect hands the adapter the kubeconfig of the cluster it manages, as
+// Meshery does when connecting to it
+func (c *Client) Connect(ctx context.Context, kubeconfig []byte, contextName string) error {
+	if _, err := c.mesh.CreateMeshInstance(ctx, &meshes.CreateMeshInstanceRequest{
+		K8SConfig:   kubeconfig,
+		ContextName: contextName,
+	}); err != nil {
+		return ErrConnect(err)
+	}
+	return nil
+}
+
+// Operations lists the operations supported by the adapter
+func (c *Client) Operations(ctx context.Context) ([]*meshes.SupportedOperation, error) {
+	res, err := c.mesh.SupportedOperations(ctx, &meshes.SupportedOperationsRequest{})
+	if err != nil {
+		return nil, ErrRunOperation(err)
+	}
+	return res.GetOps(), nil
+}
+
+// Operation is an operation request
+type Operation struct {
+	Name      string
+	Namespace string
+	// CustomBody holds the parameters of the operation, as YAML
+	CustomBody string
+	Delete     bool
+	// ID identifies the events of the operation, generated when empty
+	ID string
+}
+
+// RunOperation starts an operation and returns its ID, the result of the
+// operation is streamed as events
+func (c *Client) RunOperation(ctx context.Context, op Operation) (string, error) {
+	if op.ID == "" {
+		id, err := newOperationID()
+		if err != nil {
+			return "", ErrRunOperation(err)
+		}
+		op.ID = id
+	}
+
+	res, err := c.mesh.ApplyOperation(ctx, &meshes.ApplyRuleRequest{
+		OpName:      op.Name,
+		Namespace:   op.Namespace,
+		CustomBody:  op.CustomBody,
+		DeleteOp:    op.Delete,
+		OperationId: op.ID,
+	})
+	if err != nil {
+		return "", ErrRunOperation(err)
+	}
+	if res.GetError() != "" {
+		return "", ErrRunOperation(fmt.Errorf("%s", res.GetError()))
+	}
+	return op.ID, nil
+}
+
+// Event is an event streamed by the adapter
+type Event struct {
+	OperationID string
+	Type        meshes.EventType
+	Summary     string
+	Details     string
+}
+
+// Failed reports whether the event reports a failure
+func (e Event) Failed() bool {
+	return e.Type == meshes.EventType_ERROR
+}
+
+// EventStream receives the events of the adapter
+type EventStream struct {
+	stream meshes.MeshService_StreamEventsClient
+}
+
+// WatchEvents streams the events of the adapter until ctx is done. The
+// adapter delivers each event to a single stream.
+func (c *Client) WatchEvents(ctx context.Context) (*EventStream, error) {
+	stream, err := c.mesh.StreamEvents(ctx, &meshes.EventsRequest{})
+	if err != nil {
+		return nil, ErrRunOperation(err)
+	}
+	return &EventStream{stream: stream}, nil
+}
+
+// Recv blocks until the next event
+func (s *EventStream) Recv() (Event, error) {
+	res, err := s.stream.Recv()
+	if err != nil {
+		return Event{}, ErrRunOperation(err)
+	}
+	return Event{
+		OperationID: res.GetOperationId(),
+		Type:        res.GetEventType(),
+		Summary:     res.GetSummary(),
+		Details:     res.GetDetails(),
+	}, nil
+}
+
+// Next blocks until the next event of an operation, the events of other
+// operations are dropped
+func (s *EventStream) Next(operationID string) (Event, error) {
+	for {
+		e, err := s.Recv()
+		if err != nil || e.OperationID == operationID {
+			return e, err
+		}
+	}
+}
+
+// GetReport runs a report operation and decodes the report into out.
+// Reports which don't fit in an event are downloaded from the artifacts
+// of the operation.
+func (c *Client) GetReport(ctx context.Context, report Report, out interface{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Watch before running so that the result can't be missed
+	stream, err := c.WatchEvents(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := c.RunOperation(ctx, Operation{Name: report.Operation})
+	if err != nil {
+		return err
+	}
+	// Report operations stream a single event, their result
+	e, err := stream.Next(id)
+	if err != nil {
+		return err
+	}
+	if e.Failed() {
+		return ErrRunOperation(fmt.Errorf("%s: %s", e.Summary, e.Details))
+	}
+
+	if err := json.Unmarshal([]byte(e.Details), out); err == nil {
+		return nil
+	}
+	if c.api == "" {
+		return ErrGetReport(fmt.Errorf("the report of operation %s is not JSON: %s", id, e.Details))
+	}
+	return c.artifact(ctx, id, report.Artifact, out)
+}
+
+// artifact downloads an artifact of an operation and decodes it into out
+func (c *Client) artifact(ctx context.Context, operationID, name string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/artifacts/%s/%s", c.api, operationID, name), nil)
+	if err != nil {
+		return ErrGetReport(err)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return ErrGetReport(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return ErrGetReport(fmt.Errorf("downloading artifact %s returned status code %d: %s", name, resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return ErrGetReport(err)
+	}
+	return nil
+}
+
+func newOperationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrConnectCode represents the errors which are generated while
+	// connecting to the adapter or handing it a kubeconfig
+	ErrConnectCode = "1064"
+
+	// ErrRunOperationCode represents the errors which are generated while
+	// running an operation or watching its events
+	ErrRunOperationCode = "1065"
+
+	// ErrGetReportCode represents the errors which are generated while
+	// retrieving the result of a report operation
+	ErrGetReportCode = "1066"
+)
+
+// ErrConnect is the error while connecting to the adapter
+func ErrConnect(err error) error {
+	return errors.New(ErrConnectCode, errors.Alert, []string{"Error connecting to the Cilium adapter"}, []string{err.Error()}, []string{"The adapter is not reachable at the given address", "The kubeconfig is not valid"}, []string{"Verify the address of the adapter and the kubeconfig"})
+}
+
+// ErrRunOperation is the error while running an operation
+func ErrRunOperation(err error) error {
+	return errors.New(ErrRunOperationCode, errors.Alert, []string{"Error running operation"}, []string{err.Error()}, []string{"The operation is not supported by the adapter", "The operation failed"}, []string{"Verify the operation is listed by Operations and inspect the details of its events"})
+}
+
+// ErrGetReport is the error while retrieving the result of a report
+func ErrGetReport(err error) error {
+	return errors.New(ErrGetReportCode, errors.Alert, []string{"Error getting report"}, []string{err.Error()}, []string{"The report didn't fit in the event and no HTTP API address was configured"}, []string{"Set the APIAddress option so that large reports are downloaded from the artifacts"})
+}
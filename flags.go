@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// envFlag is a command-line flag overriding the environment variable the
+// setting is otherwise read from
+type envFlag struct {
+	name  string
+	env   string
+	usage string
+	// boolean flags are set without a value, e.g. --debug
+	boolean bool
+}
+
+// envFlags are the settings of the adapter exposed as flags. The token of
+// the Meshery server is left out so that it doesn't show up in the process
+// list, it is passed through MESHERY_SERVER_TOKEN or a token file.
+var envFlags = []envFlag{
+	{name: "debug", env: "DEBUG", usage: "log at debug level, same as --log-level=debug", boolean: true},
+	{name: "log-format", env: "LOG_FORMAT", usage: "format of the logs: syslog, json or terminal"},
+	{name: "log-level", env: "LOG_LEVEL", usage: "least severe level logged: trace, debug, info, warn or error"},
+	{name: "log-file", env: "LOG_FILE", usage: "file the logs are written to next to the standard output"},
+	{name: "log-max-bytes", env: "LOG_MAX_BYTES", usage: "size at which the log file is rotated, 0 disables rotation"},
+	{name: "log-max-backups", env: "LOG_MAX_BACKUPS", usage: "rotated log files kept"},
+	{name: "standalone", env: "STANDALONE", usage: "run without a Meshery server, for local development", boolean: true},
+	{name: "kubeconfig", env: "KUBECONFIG", usage: "kubeconfig used in standalone mode"},
+	{name: "kube-context", env: "KUBE_CONTEXT", usage: "context of the kubeconfig used in standalone mode"},
+	{name: "service-addr", env: "SERVICE_ADDR", usage: "address Meshery reaches the adapter at"},
+	{name: "api-port", env: "API_PORT", usage: "port of the HTTP API"},
+	{name: "artifacts-addr", env: "ARTIFACTS_ADDRESS", usage: "host:port the operation artifacts are served at, over the TLS of the gRPC API when set"},
+	{name: "shutdown-timeout", env: "SHUTDOWN_TIMEOUT", usage: "time given to the running operations to stop on shutdown"},
+
+	{name: "meshery-server", env: "MESHERY_SERVER", usage: "comma separated addresses of the Meshery servers, failed over in order"},
+	{name: "meshery-server-dns", env: "MESHERY_SERVER_DNS", usage: "host resolved to the addresses of more Meshery servers, e.g. a headless Service"},
+	{name: "meshery-server-selector", env: "MESHERY_SERVER_SELECTOR", usage: "label selector of the Services of more Meshery servers"},
+	{name: "meshery-server-namespace", env: "MESHERY_SERVER_NAMESPACE", usage: "namespace of the Services of --meshery-server-selector"},
+	{name: "mesheryctl-config", env: "MESHERYCTL_CONFIG", usage: "mesheryctl config file whose current context gives a Meshery server, the Meshery broker isn't used for discovery"},
+	{name: "meshery-server-ca-file", env: "MESHERY_SERVER_CA_FILE", usage: "CA bundle verifying the Meshery server certificate"},
+	{name: "meshery-server-cert-file", env: "MESHERY_SERVER_CERT_FILE", usage: "client certificate presented to the Meshery server"},
+	{name: "meshery-server-key-file", env: "MESHERY_SERVER_KEY_FILE", usage: "key of the client certificate"},
+	{name: "meshery-server-insecure", env: "MESHERY_SERVER_INSECURE", usage: "skip the verification of the Meshery server certificate", boolean: true},
+	{name: "meshery-server-token-file", env: "MESHERY_SERVER_TOKEN_FILE", usage: "file holding the provider token or API key of the Meshery server, or the auth.json of mesheryctl"},
+	{name: "meshery-provider", env: "MESHERY_PROVIDER", usage: "Meshery provider which issued the token, e.g. Meshery"},
+	{name: "meshery-server-retry-timeout", env: "MESHERY_SERVER_RETRY_TIMEOUT", usage: "time spent retrying a request to the Meshery server, the registrations are queued after 30s at most"},
+	{name: "registration-max-attempts", env: "MESHERY_SERVER_REGISTRATION_MAX_ATTEMPTS", usage: "attempts made to register the capabilities while the Meshery server is unreachable or failing, 0 retries forever"},
+	{name: "registration-max-backoff", env: "MESHERY_SERVER_REGISTRATION_MAX_BACKOFF", usage: "maximum backoff between two registration attempts"},
+	{name: "reregister-interval", env: "MESHERY_SERVER_REREGISTER_INTERVAL", usage: "interval at which the dynamic capabilities are registered again"},
+	{name: "lock-timeout", env: "MESHERY_SERVER_LOCK_TIMEOUT", usage: "time a disruptive operation waits for another adapter, 0 disables coordination"},
+	{name: "meshery-server-schema-max-bytes", env: "MESHERY_SERVER_SCHEMA_MAX_BYTES", usage: "size of a component schema above which the component isn't registered, 0 disables the limit"},
+	{name: "meshery-server-schema-max-description", env: "MESHERY_SERVER_SCHEMA_MAX_DESCRIPTION", usage: "length above which the descriptions are pruned from the schemas, 0 keeps them"},
+	{name: "meshery-server-gzip", env: "MESHERY_SERVER_GZIP", usage: "compress the requests to the Meshery server with gzip", boolean: true},
+	{name: "meshery-server-faults", env: "MESHERY_SERVER_FAULTS", usage: "Meshery server faults simulated in diagnostic mode, e.g. 5xx=0.3,timeout=0.1"},
+
+	{name: "http-proxy", env: "HTTP_PROXY", usage: "proxy of the outbound HTTP requests"},
+	{name: "https-proxy", env: "HTTPS_PROXY", usage: "proxy of the outbound HTTPS requests"},
+	{name: "no-proxy", env: "NO_PROXY", usage: "comma separated hosts, domains and CIDRs reached without proxy"},
+
+	{name: "comp-gen-url", env: "COMP_GEN_URL", usage: "chart or manifests the Cilium components are generated from"},
+	{name: "comp-gen-method", env: "COMP_GEN_METHOD", usage: "generation method of --comp-gen-url, Helm or Manifests"},
+	{name: "comp-gen-workers", env: "COMP_GEN_WORKERS", usage: "CRDs generated concurrently, the number of CPUs by default"},
+	{name: "comp-gen-timeout", env: "COMP_GEN_TIMEOUT", usage: "time the generation of the components of a source may take, e.g. 30m"},
+	{name: "comp-gen-registry-username", env: "COMP_GEN_REGISTRY_USERNAME", usage: "username of the OCI registry of an oci:// --comp-gen-url"},
+	{name: "comp-gen-registry-password", env: "COMP_GEN_REGISTRY_PASSWORD", usage: "password or token of the OCI registry of an oci:// --comp-gen-url"},
+	{name: "comp-gen-registry-plain-http", env: "COMP_GEN_REGISTRY_PLAIN_HTTP", usage: "reach the OCI registry of an oci:// --comp-gen-url over HTTP"},
+	{name: "component-versions", env: "CILIUM_COMPONENT_VERSIONS", usage: "comma separated Cilium versions the components are registered for"},
+	{name: "release-channel", env: "CILIUM_RELEASE_CHANNEL", usage: "Cilium release channel to follow: latest, stable or lts"},
+	{name: "egress-gateway-crds-url", env: "EGRESS_GATEWAY_CRDS_URL", usage: "CRDs the egress gateway components are generated from"},
+	{name: "clusterwide-policy-crds-url", env: "CLUSTERWIDE_POLICY_CRDS_URL", usage: "CRD the clusterwide policy components are generated from"},
+	{name: "local-redirect-policy-crds-url", env: "LOCAL_REDIRECT_POLICY_CRDS_URL", usage: "CRD the local redirect policy components are generated from"},
+	{name: "envoy-config-crds-url", env: "ENVOY_CONFIG_CRDS_URL", usage: "comma separated CRDs the Envoy configuration components are generated from"},
+	{name: "bgp-crds-url", env: "BGP_CRDS_URL", usage: "comma separated CRDs the BGP components are generated from"},
+	{name: "tetragon-crds-url", env: "TETRAGON_CRDS_URL", usage: "CRDs the Tetragon components are generated from"},
+	{name: "gateway-api-crds-url", env: "GATEWAY_API_CRDS_URL", usage: "CRDs the Gateway API components are generated from"},
+	{name: "events-digest", env: "EVENTS_DIGEST", usage: "event categories coalesced into periodic summaries, e.g. registration=5m,upgrade=1h"},
+	{name: "pipelines-file", env: "PIPELINES_FILE", usage: "file defining the pipelines"},
+	{name: "cilium-cli-version", env: "CILIUM_CLI_VERSION", usage: "version of the cilium CLI the operations run"},
+	{name: "hubble-cli-version", env: "HUBBLE_CLI_VERSION", usage: "version of the hubble CLI the operations run, matches the Cilium version by default"},
+	{name: "fortio-image", env: "FORTIO_IMAGE", usage: "image of the fortio load generator of the performance tests"},
+	{name: "wrk2-image", env: "WRK2_IMAGE", usage: "image of the wrk2 load generator of the performance tests, pin it with a digest"},
+
+	{name: "node-disruption-max-per-zone", env: "NODE_DISRUPTION_MAX_PER_ZONE", usage: "nodes of a zone whose agent is restarted at once, 0 rolls out the DaemonSet"},
+	{name: "node-disruption-zone-label", env: "NODE_DISRUPTION_ZONE_LABEL", usage: "node label the zones are read from"},
+	{name: "node-disruption-skip-cordoned", env: "NODE_DISRUPTION_SKIP_CORDONED", usage: "leave the agents of cordoned nodes untouched, true or false"},
+	{name: "operation-fencing", env: "OPERATION_FENCING", usage: "queue or reject the mutating operations targeting a cluster another one is running on"},
+	{name: "operation-fencing-timeout", env: "OPERATION_FENCING_TIMEOUT", usage: "time a queued operation waits for the running one before it is rejected"},
+	{name: "operation-timeout", env: "OPERATION_TIMEOUT", usage: "time an operation may run before it is cancelled, 0 for no timeout"},
+	{name: "operation-timeouts", env: "OPERATION_TIMEOUTS", usage: "comma separated timeouts by operation or category, e.g. install=45m,cilium_connectivity_test=1h"},
+	{name: "registration-replay-interval", env: "REGISTRATION_REPLAY_INTERVAL", usage: "interval at which the registrations queued while Meshery was unreachable are replayed"},
+	{name: "drift-interval", env: "DRIFT_INTERVAL", usage: "interval at which the cluster is checked for drift from the applied state, 0 disables it"},
+	{name: "discovery-interval", env: "DISCOVERY_INTERVAL", usage: "interval at which the Cilium resources of the cluster are reported to Meshery, 0 disables it"},
+	{name: "gc-interval", env: "GC_INTERVAL", usage: "interval at which the stale test resources deployed by the adapter are removed, 0 disables it"},
+	{name: "gc-ttl", env: "GC_TTL", usage: "age at which a test resource deployed by the adapter is stale"},
+
+	{name: "grpc-tls-cert-file", env: "GRPC_TLS_CERT_FILE", usage: "certificate of the gRPC server"},
+	{name: "grpc-tls-key-file", env: "GRPC_TLS_KEY_FILE", usage: "key of the gRPC server certificate"},
+	{name: "grpc-tls-ca-file", env: "GRPC_TLS_CA_FILE", usage: "CA bundle verifying the client certificates"},
+	{name: "grpc-tls-secret", env: "GRPC_TLS_SECRET", usage: "namespace/name of the Secret holding the gRPC certificates"},
+	{name: "grpc-tls-require-client-cert", env: "GRPC_TLS_REQUIRE_CLIENT_CERT", usage: "require the Meshery server to present a client certificate", boolean: true},
+	{name: "gitops-repo-url", env: "GITOPS_REPO_URL", usage: "Git repository the manifests applied by the operations are committed to"},
+	{name: "gitops-branch", env: "GITOPS_BRANCH", usage: "branch the applied manifests are pushed to"},
+	{name: "gitops-path", env: "GITOPS_PATH", usage: "directory of the repository the applied manifests are written to"},
+	{name: "gitops-username", env: "GITOPS_USERNAME", usage: "user of the HTTPS Git repository"},
+	{name: "gitops-token-file", env: "GITOPS_TOKEN_FILE", usage: "file holding the token of the HTTPS Git repository"},
+	{name: "gitops-author-name", env: "GITOPS_AUTHOR_NAME", usage: "author of the commits of the applied manifests"},
+	{name: "gitops-author-email", env: "GITOPS_AUTHOR_EMAIL", usage: "email of the author of the commits"},
+	{name: "gitops-dir", env: "GITOPS_DIR", usage: "directory, e.g. a mounted volume, the applied manifests are written to instead of a repository"},
+	{name: "gitops-timeout", env: "GITOPS_TIMEOUT", usage: "time given to a single export of the applied manifests"},
+	{name: "artifacts-max-age", env: "ARTIFACTS_MAX_AGE", usage: "age after which the artifacts of operations are removed"},
+	{name: "artifacts-max-bytes", env: "ARTIFACTS_MAX_BYTES", usage: "total size the artifacts of operations are capped at"},
+}
+
+// parseFlags parses the command line, the flags which are set override
+// their environment variable so that the settings are read the same way
+// whether they come from flags or from the environment. It reports
+// whether the version was requested instead of running the adapter.
+func parseFlags(args []string, out io.Writer) (bool, error) {
+	if len(args) > 0 && args[0] == "version" {
+		return true, nil
+	}
+
+	fs := flag.NewFlagSet(serviceName, flag.ContinueOnError)
+	fs.SetOutput(out)
+	showVersion := fs.Bool("version", false, "print the version and exit")
+
+	values := map[string]*string{}
+	bools := map[string]*bool{}
+	for _, f := range envFlags {
+		usage := fmt.Sprintf("%s (env %s)", f.usage, f.env)
+		if f.boolean {
+			bools[f.name] = fs.Bool(f.name, os.Getenv(f.env) == "true", usage)
+			continue
+		}
+		values[f.name] = fs.String(f.name, os.Getenv(f.env), usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+
+	envs := map[string]string{}
+	for _, f := range envFlags {
+		envs[f.name] = f.env
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		env, ok := envs[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		val := ""
+		if b, ok := bools[f.Name]; ok {
+			val = strconv.FormatBool(*b)
+		} else {
+			val = *values[f.Name]
+		}
+		err = os.Setenv(env, val)
+	})
+	return *showVersion, err
+}
+
+// printVersion prints the version and the commit the adapter was built from
+func printVersion(out io.Writer) {
+	fmt.Fprintf(out, "%s %s (%s)\n", serviceName, version, gitsha)
+}
@@ -9,8 +9,21 @@ replace (
 )
 
 require (
+	github.com/cenkalti/backoff/v4 v4.1.0
+	github.com/golang/protobuf v1.5.2
+	github.com/grpc-ecosystem/go-grpc-middleware v1.2.0
 	github.com/layer5io/meshery-adapter-library v0.1.25
 	github.com/layer5io/meshkit v0.2.34
 	github.com/layer5io/service-mesh-performance v0.3.3
+	github.com/prometheus/client_golang v1.7.1
+	github.com/sirupsen/logrus v1.8.1
+	github.com/xeipuuv/gojsonschema v1.2.0
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	google.golang.org/grpc v1.38.0
 	gopkg.in/yaml.v2 v2.4.0
+	helm.sh/helm/v3 v3.6.3
+	k8s.io/api v0.21.0
+	k8s.io/apimachinery v0.21.0
+	k8s.io/client-go v0.21.0
+	sigs.k8s.io/yaml v1.2.0
 )
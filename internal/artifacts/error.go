@@ -0,0 +1,34 @@
+package artifacts
+
+import (
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrStoreCode represents the errors which are generated
+	// while reading or writing artifacts on disk
+	ErrStoreCode = "1037"
+
+	// ErrNotFoundCode represents the error which is generated
+	// when a requested artifact does not exist
+	ErrNotFoundCode = "1038"
+
+	// ErrInvalidNameCode represents the error which is generated
+	// when an artifact or operation name is not a plain file name
+	ErrInvalidNameCode = "1039"
+)
+
+var (
+	// ErrNotFound is the error when a requested artifact does not exist
+	ErrNotFound = errors.New(ErrNotFoundCode, errors.Alert, []string{"Artifact not found"}, []string{"The requested artifact does not exist or has been pruned"}, []string{"The artifact exceeded the retention limits"}, []string{"Rerun the operation to produce the artifact again"})
+)
+
+// ErrStore is the error while reading or writing artifacts on disk
+func ErrStore(err error) error {
+	return errors.New(ErrStoreCode, errors.Alert, []string{"Error accessing artifact store"}, []string{err.Error()}, []string{"The adapter config directory is not writable", "The disk is full"}, []string{"Verify the permissions and free space of the adapter config directory"})
+}
+
+// ErrInvalidName is the error when an artifact or operation name is not a plain file name
+func ErrInvalidName(name string) error {
+	return errors.New(ErrInvalidNameCode, errors.Alert, []string{"Invalid artifact name"}, []string{"Artifact names must not be empty or contain path separators: " + name}, []string{}, []string{})
+}
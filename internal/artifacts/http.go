@@ -0,0 +1,53 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Prefix is the path under which the artifacts are served
+const Prefix = "/artifacts/"
+
+// ServeHTTP serves the list of artifacts of an operation at
+// /artifacts/{operationId} and the artifact itself at
+// /artifacts/{operationId}/{name}
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, Prefix), "/"), "/")
+	switch len(parts) {
+	case 1:
+		list, err := s.List(parts[0])
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	case 2:
+		path, err := s.Path(parts[0], parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+parts[1]+"\"")
+		http.ServeFile(w, r, path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func statusCode(err error) int {
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	}
+	if strings.Contains(err.Error(), ErrInvalidNameCode) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
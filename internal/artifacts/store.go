@@ -0,0 +1,182 @@
+// Package artifacts stores the files produced by adapter operations, such as
+// rendered manifests, test reports and generated policies, so that they can
+// be retrieved after the operation finished.
+package artifacts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Artifact describes a stored file
+type Artifact struct {
+	OperationID string    `json:"operationId"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Store keeps artifacts on disk, one directory per operation, and prunes
+// them by age and total size
+type Store struct {
+	root     string
+	maxAge   time.Duration
+	maxBytes int64
+	mu       sync.Mutex
+}
+
+// New creates a Store rooted at root
+func New(root string, maxAge time.Duration, maxBytes int64) (*Store, error) {
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return nil, ErrStore(err)
+	}
+	return &Store{
+		root:     root,
+		maxAge:   maxAge,
+		maxBytes: maxBytes,
+	}, nil
+}
+
+// Put stores data as the artifact name of the given operation, replacing
+// any artifact with the same name
+func (s *Store) Put(operationID, name string, data []byte) (Artifact, error) {
+	if err := validName(operationID); err != nil {
+		return Artifact{}, err
+	}
+	if err := validName(name); err != nil {
+		return Artifact{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.root, operationID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return Artifact{}, ErrStore(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		return Artifact{}, ErrStore(err)
+	}
+
+	if err := s.prune(); err != nil {
+		return Artifact{}, err
+	}
+
+	return Artifact{
+		OperationID: operationID,
+		Name:        name,
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// List returns the artifacts of an operation
+func (s *Store) List(operationID string) ([]Artifact, error) {
+	if err := validName(operationID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(filepath.Join(s.root, operationID))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, ErrStore(err)
+	}
+
+	res := make([]Artifact, 0, len(files))
+	for _, f := range files {
+		res = append(res, Artifact{
+			OperationID: operationID,
+			Name:        f.Name(),
+			Size:        f.Size(),
+			CreatedAt:   f.ModTime(),
+		})
+	}
+	return res, nil
+}
+
+// Path returns the location of an artifact on disk
+func (s *Store) Path(operationID, name string) (string, error) {
+	if err := validName(operationID); err != nil {
+		return "", err
+	}
+	if err := validName(name); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.root, operationID, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// Prune removes the artifacts exceeding the retention limits
+func (s *Store) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prune()
+}
+
+func (s *Store) prune() error {
+	type file struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+
+	var files []file
+	var total int64
+	if err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		files = append(files, file{path: path, size: info.Size(), mod: info.ModTime()})
+		total += info.Size()
+		return nil
+	}); err != nil {
+		return ErrStore(err)
+	}
+
+	// Oldest first
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+
+	cutoff := time.Now().Add(-s.maxAge)
+	for _, f := range files {
+		if !f.mod.Before(cutoff) && total <= s.maxBytes {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return ErrStore(err)
+		}
+		total -= f.size
+
+		// Drop the operation directory once it is empty
+		dir := filepath.Dir(f.path)
+		if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) == 0 {
+			_ = os.Remove(dir)
+		}
+	}
+
+	return nil
+}
+
+// validName rejects names which could escape the store directory
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return ErrInvalidName(name)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Package cli downloads the official Cilium command-line tools into the
+// bin directory of the adapter and runs them, for the operations which are
+// best left to the cilium and hubble CLIs.
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const releaseURL = "https://github.com/%s/releases/download/v%s/%s"
+
+// Tool is a command-line tool released as archives along with their
+// checksums on GitHub
+type Tool struct {
+	// Name is the name of the binary and the prefix of the archives
+	Name string
+	// Repository is the GitHub repository the tool is released from
+	Repository string
+}
+
+var (
+	// Cilium is the cilium CLI
+	Cilium = Tool{Name: "cilium", Repository: "cilium/cilium-cli"}
+	// Hubble is the hubble CLI
+	Hubble = Tool{Name: "hubble", Repository: "cilium/hubble"}
+)
+
+// archive is the name of the release archive of the platform the adapter
+// runs on
+func (t Tool) archive() string {
+	return fmt.Sprintf("%s-%s-%s.tar.gz", t.Name, runtime.GOOS, runtime.GOARCH)
+}
+
+// Manager keeps the downloaded tools in a directory, one binary per tool
+// and version
+type Manager struct {
+	dir    string
+	client *http.Client
+
+	mu sync.Mutex
+}
+
+// NewManager creates a Manager downloading the tools into dir
+func NewManager(dir string) *Manager {
+	return &Manager{
+		dir:    dir,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Path returns the path of the binary of version of t, which is
+// downloaded and verified against its published checksum first when
+// missing
+func (m *Manager) Path(ctx context.Context, t Tool, version string) (string, error) {
+	version = strings.TrimPrefix(version, "v")
+	path := filepath.Join(m.dir, fmt.Sprintf("%s-%s", t.Name, version))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	archive := t.archive()
+	byt, err := m.get(ctx, fmt.Sprintf(releaseURL, t.Repository, version, archive))
+	if err != nil {
+		return "", ErrDownloadCLI(t.Name, version, err)
+	}
+	sums, err := m.get(ctx, fmt.Sprintf(releaseURL, t.Repository, version, archive+".sha256sum"))
+	if err != nil {
+		return "", ErrDownloadCLI(t.Name, version, err)
+	}
+	if err := verifyChecksum(byt, sums, archive); err != nil {
+		return "", ErrDownloadCLI(t.Name, version, err)
+	}
+	bin, err := extract(byt, t.Name)
+	if err != nil {
+		return "", ErrDownloadCLI(t.Name, version, err)
+	}
+
+	// The binary is renamed into place so that an interrupted download
+	// is never picked up
+	if err := os.MkdirAll(m.dir, 0750); err != nil {
+		return "", ErrDownloadCLI(t.Name, version, err)
+	}
+	tmp := path + ".download"
+	// #nosec
+	if err := ioutil.WriteFile(tmp, bin, 0750); err != nil {
+		return "", ErrDownloadCLI(t.Name, version, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", ErrDownloadCLI(t.Name, version, err)
+	}
+	return path, nil
+}
+
+// Run runs version of t with args and returns its standard output, env is
+// added to the environment of the adapter
+func (m *Manager) Run(ctx context.Context, t Tool, version string, env []string, args ...string) (string, error) {
+	path, err := m.Path(ctx, t, version)
+	if err != nil {
+		return "", err
+	}
+
+	// #nosec
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), ErrRunCLI(t.Name, args, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return stdout.String(), nil
+}
+
+func (m *Manager) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned status code %d", url, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// verifyChecksum checks byt against the checksum of name in sums, in the
+// format of sha256sum
+func verifyChecksum(byt, sums []byte, name string) error {
+	sum := sha256.Sum256(byt)
+	actual := hex.EncodeToString(sum[:])
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 1 && strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if !strings.EqualFold(fields[0], actual) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], actual)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum published for %s", name)
+}
+
+// extract returns the file name of the gzipped tarball byt
+func extract(byt []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(byt))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in the archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && filepath.Base(hdr.Name) == name {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrDownloadCLICode represents the errors which are generated while
+	// downloading and verifying a command-line tool
+	ErrDownloadCLICode = "1076"
+
+	// ErrRunCLICode represents the errors which are generated when a
+	// command-line tool fails
+	ErrRunCLICode = "1077"
+)
+
+// ErrDownloadCLI is the error while downloading a command-line tool
+func ErrDownloadCLI(name, version string, err error) error {
+	return errors.New(ErrDownloadCLICode, errors.Alert, []string{fmt.Sprintf("Error downloading the %s CLI %s", name, version)}, []string{err.Error()}, []string{"The release does not exist or has no archive for this platform", "GitHub is not reachable from the adapter", "The downloaded archive does not match its checksum"}, []string{"Verify the CLI version and the proxy settings of the adapter"})
+}
+
+// ErrRunCLI is the error when a command-line tool fails
+func ErrRunCLI(name string, args []string, err error) error {
+	return errors.New(ErrRunCLICode, errors.Alert, []string{fmt.Sprintf("Error running %s %s", name, strings.Join(args, " "))}, []string{err.Error()}, []string{"The cluster is not reachable with the kubeconfig of the adapter", "The command failed against the cluster"}, []string{"Inspect the output of the command in the details of the error"})
+}
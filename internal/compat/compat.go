@@ -0,0 +1,112 @@
+// Package compat describes the versions of Cilium and of the Meshery server
+// the adapter works with, so that Meshery and the operators can tell when
+// the adapter has to be upgraded along with Cilium.
+package compat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path is the path the compatibility matrix is served on
+const Path = "/compatibility"
+
+const (
+	// MinCiliumVersion is the oldest minor version of Cilium the adapter
+	// manages
+	MinCiliumVersion = "1.10"
+	// MaxCiliumVersion is the newest minor version of Cilium the adapter
+	// was released for, newer versions may rely on values and CRDs the
+	// adapter doesn't know about
+	MaxCiliumVersion = "1.16"
+	// MinMesheryServerVersion is the oldest Meshery server accepting the
+	// registrations of the adapter
+	MinMesheryServerVersion = "v0.6.0"
+)
+
+// Feature is an operation of the adapter requiring a newer Cilium than
+// MinCiliumVersion
+type Feature struct {
+	Name      string `json:"name"`
+	MinCilium string `json:"minCilium"`
+}
+
+// Features are the operations with a version requirement of their own
+var Features = []Feature{
+	{Name: "Hubble UI exposure through the ingress controller", MinCilium: "1.12"},
+	{Name: "Hubble flow export", MinCilium: "1.14"},
+	{Name: "Hubble CLI matching the Cilium version", MinCilium: "1.16"},
+}
+
+// VersionRange is a range of minor versions, Max is open when empty
+type VersionRange struct {
+	Min string `json:"min"`
+	Max string `json:"max,omitempty"`
+}
+
+// Matrix is the compatibility matrix of an adapter build
+type Matrix struct {
+	Adapter       string       `json:"adapter"`
+	GitSHA        string       `json:"gitsha"`
+	Cilium        VersionRange `json:"cilium"`
+	MesheryServer VersionRange `json:"mesheryServer"`
+	Features      []Feature    `json:"features"`
+}
+
+// New returns the compatibility matrix of the adapter version built from
+// gitsha
+func New(adapterVersion, gitsha string) Matrix {
+	return Matrix{
+		Adapter:       adapterVersion,
+		GitSHA:        gitsha,
+		Cilium:        VersionRange{Min: MinCiliumVersion, Max: MaxCiliumVersion},
+		MesheryServer: VersionRange{Min: MinMesheryServerVersion},
+		Features:      Features,
+	}
+}
+
+// Support tells whether version of Cilium is supported
+type Support string
+
+const (
+	// Supported versions are within the range of the matrix
+	Supported Support = "supported"
+	// TooOld versions predate the range, Cilium has to be upgraded
+	TooOld Support = "too-old"
+	// TooNew versions are newer than the range, the adapter has to be
+	// upgraded
+	TooNew Support = "too-new"
+	// Unknown versions can't be parsed
+	Unknown Support = "unknown"
+)
+
+// CiliumSupport tells whether the Cilium version is within the range of
+// the matrix
+func (m Matrix) CiliumSupport(version string) Support {
+	v, ok := minor(version)
+	if !ok {
+		return Unknown
+	}
+	if min, ok := minor(m.Cilium.Min); ok && less(v, min) {
+		return TooOld
+	}
+	if max, ok := minor(m.Cilium.Max); ok && less(max, v) {
+		return TooNew
+	}
+	return Supported
+}
+
+func minor(version string) ([2]int, bool) {
+	var v [2]int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(version, "v"), "%d.%d", &v[0], &v[1]); err != nil {
+		return v, false
+	}
+	return v, true
+}
+
+func less(a, b [2]int) bool {
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+	return a[1] < b[1]
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+)
+
+const (
+	// APIServerKey is the config key holding the settings of the
+	// HTTP API served by the adapter next to the gRPC service
+	APIServerKey = "api-server"
+
+	defaultArtifactsMaxAge   = 7 * 24 * time.Hour
+	defaultArtifactsMaxBytes = 512 << 20
+)
+
+// APIServerConfig holds the settings of the adapter's HTTP API
+type APIServerConfig struct {
+	// Port the HTTP API listens on
+	Port string
+	// ArtifactsAddress is the host:port the operation artifacts are
+	// served at. It is bound to the loopback interface by default since
+	// the artifacts may hold cluster details, and served with the TLS
+	// settings of the gRPC API when they are set.
+	ArtifactsAddress string
+	// ArtifactsMaxAge is the time after which operation artifacts are pruned
+	ArtifactsMaxAge time.Duration
+	// ArtifactsMaxBytes caps the disk space used by operation artifacts,
+	// the oldest artifacts are pruned first
+	ArtifactsMaxBytes int64
+}
+
+func apiServerDefaults() map[string]string {
+	return map[string]string{
+		"port":              envOrDefault("API_PORT", "10013"),
+		"artifactsaddress":  envOrDefault("ARTIFACTS_ADDRESS", "127.0.0.1:10014"),
+		"artifactsmaxage":   envOrDefault("ARTIFACTS_MAX_AGE", defaultArtifactsMaxAge.String()),
+		"artifactsmaxbytes": envOrDefault("ARTIFACTS_MAX_BYTES", strconv.Itoa(defaultArtifactsMaxBytes)),
+	}
+}
+
+// APIServer returns the HTTP API settings stored in the config handler
+func APIServer(h config.Handler) (APIServerConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(APIServerKey, &raw); err != nil {
+		return APIServerConfig{}, err
+	}
+
+	cfg := APIServerConfig{
+		Port:              raw["port"],
+		ArtifactsAddress:  raw["artifactsaddress"],
+		ArtifactsMaxAge:   defaultArtifactsMaxAge,
+		ArtifactsMaxBytes: defaultArtifactsMaxBytes,
+	}
+	if age, err := time.ParseDuration(raw["artifactsmaxage"]); err == nil {
+		cfg.ArtifactsMaxAge = age
+	}
+	if size, err := strconv.ParseInt(raw["artifactsmaxbytes"], 10, 64); err == nil {
+		cfg.ArtifactsMaxBytes = size
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Release channels the adapter can be subscribed to, the components are
+// then registered for, and upgrades offered to, the version the channel
+// currently points at instead of the version of the adapter binary
+const (
+	// ChannelLatest is the newest release, release candidates included
+	ChannelLatest = "latest"
+	// ChannelStable is the newest release which is not a pre-release
+	ChannelStable = "stable"
+	// ChannelLTS is the newest patch of the oldest minor version still
+	// maintained upstream, Cilium maintains the three latest minor versions
+	ChannelLTS = "lts"
+
+	ciliumReleasesURL = "https://api.github.com/repos/cilium/cilium/releases?per_page=100"
+
+	maintainedMinors = 3
+)
+
+// releaseVersion is the parsed tag of a release
+type releaseVersion struct {
+	tag                 string
+	major, minor, patch int
+	prerelease          bool
+}
+
+func (v releaseVersion) less(o releaseVersion) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	if v.minor != o.minor {
+		return v.minor < o.minor
+	}
+	if v.patch != o.patch {
+		return v.patch < o.patch
+	}
+	// Pre-releases of a version precede the version
+	return v.prerelease && !o.prerelease
+}
+
+func parseReleaseVersion(r *Release) (releaseVersion, bool) {
+	v := releaseVersion{tag: r.TagName, prerelease: r.Prerelease}
+	tag := strings.TrimPrefix(r.TagName, "v")
+	if _, err := fmt.Sscanf(tag, "%d.%d.%d", &v.major, &v.minor, &v.patch); err != nil {
+		return v, false
+	}
+	v.prerelease = v.prerelease || strings.Contains(tag, "-")
+	return v, true
+}
+
+// ValidReleaseChannel reports whether channel is a known release channel
+func ValidReleaseChannel(channel string) bool {
+	switch channel {
+	case ChannelLatest, ChannelStable, ChannelLTS:
+		return true
+	}
+	return false
+}
+
+// ChannelVersion returns the tag of the Cilium release the channel
+// currently points at
+func ChannelVersion(channel string) (string, error) {
+	if !ValidReleaseChannel(channel) {
+		return "", ErrGetLatestReleaseNames(fmt.Errorf("unknown release channel %q", channel))
+	}
+
+	releases, err := getCiliumReleases()
+	if err != nil {
+		return "", err
+	}
+	return channelVersion(channel, releases)
+}
+
+func channelVersion(channel string, releases []*Release) (string, error) {
+	var versions []releaseVersion
+	for _, r := range releases {
+		if r.Draft {
+			continue
+		}
+		v, ok := parseReleaseVersion(r)
+		if !ok || (v.prerelease && channel != ChannelLatest) {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		return "", ErrGetLatestReleaseNames(fmt.Errorf("no release found on the %s channel", channel))
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[j].less(versions[i]) })
+
+	if channel != ChannelLTS {
+		return versions[0].tag, nil
+	}
+
+	// versions is sorted newest first, keep the newest patch of each minor
+	var minors []releaseVersion
+	for _, v := range versions {
+		if len(minors) > 0 {
+			last := minors[len(minors)-1]
+			if last.major == v.major && last.minor == v.minor {
+				continue
+			}
+		}
+		minors = append(minors, v)
+	}
+	if len(minors) > maintainedMinors {
+		minors = minors[:maintainedMinors]
+	}
+	return minors[len(minors)-1].tag, nil
+}
+
+func getCiliumReleases() ([]*Release, error) {
+	resp, err := http.Get(ciliumReleasesURL)
+	if err != nil {
+		return nil, ErrGetLatestReleases(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrGetLatestReleases(fmt.Errorf("fetching %s returned status code %d", ciliumReleasesURL, resp.StatusCode))
+	}
+
+	var releases []*Release
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, ErrGetLatestReleases(err)
+	}
+	return releases, nil
+}
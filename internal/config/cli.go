@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// DefaultCiliumCLIVersion is the cilium CLI used unless
+	// CILIUM_CLI_VERSION is set, it supports the maintained Cilium releases
+	DefaultCiliumCLIVersion = "0.16.16"
+
+	// DefaultHubbleCLIVersion is the hubble CLI of the Cilium releases
+	// before 1.16, the later releases of Hubble share the Cilium version
+	DefaultHubbleCLIVersion = "0.13.6"
+)
+
+// CiliumCLIVersion returns the version of the cilium CLI the operations
+// shell out to
+func CiliumCLIVersion() string {
+	if v := os.Getenv("CILIUM_CLI_VERSION"); v != "" {
+		return strings.TrimPrefix(v, "v")
+	}
+	return DefaultCiliumCLIVersion
+}
+
+// HubbleCLIVersion returns the version of the hubble CLI matching the
+// Cilium version ciliumVersion, HUBBLE_CLI_VERSION overrides it
+func HubbleCLIVersion(ciliumVersion string) string {
+	if v := os.Getenv("HUBBLE_CLI_VERSION"); v != "" {
+		return strings.TrimPrefix(v, "v")
+	}
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(ciliumVersion, "v"), "%d.%d.%d", &major, &minor, &patch); err == nil {
+		if major > 1 || major == 1 && minor >= 16 {
+			return fmt.Sprintf("%d.%d.%d", major, minor, patch)
+		}
+	}
+	return DefaultHubbleCLIVersion
+}
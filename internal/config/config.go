@@ -76,6 +76,61 @@ func New(provider string) (h config.Handler, err error) {
 		return nil, err
 	}
 
+	// Setup Meshery server config
+	if err := h.SetObject(MesheryServerKey, mesheryServerDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup HTTP API config
+	if err := h.SetObject(APIServerKey, apiServerDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup logging config
+	if err := h.SetObject(LoggingKey, loggingDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup GitOps export config
+	if err := h.SetObject(GitOpsKey, gitOpsDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup gRPC TLS config
+	if err := h.SetObject(GRPCTLSKey, grpcTLSDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup node disruption constraints
+	if err := h.SetObject(DisruptionKey, disruptionDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup operation fencing
+	if err := h.SetObject(FencingKey, fencingDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup operation timeouts
+	if err := h.SetObject(TimeoutsKey, timeoutsDefaults()); err != nil {
+		return nil, err
+	}
+
+	// Setup pipelines
+	pipelines, err := LoadPipelines(Operations)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.SetObject(PipelinesKey, pipelines); err != nil {
+		return nil, err
+	}
+	addPipelineOperations(Operations, pipelines)
+
+	// Setup operations
+	if err := h.SetObject(adapter.OperationsKey, Operations); err != nil {
+		return nil, err
+	}
+
 	return h, nil
 }
 
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// ParseDigest reads the windows of the event categories coalesced by the
+// digest mode from their comma separated form, read from EVENTS_DIGEST,
+// e.g. "registration=5m,upgrade=1h". The invalid entries are ignored and
+// the digest mode is disabled when none is valid.
+func ParseDigest(raw string) map[string]time.Duration {
+	intervals := map[string]time.Duration{}
+	for _, entry := range strings.Split(raw, ",") {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil || d <= 0 {
+			continue
+		}
+		intervals[strings.ToLower(kv[0])] = d
+	}
+	return intervals
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strconv"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+)
+
+const (
+	// DisruptionKey is the config key holding the constraints of the
+	// operations restarting the Cilium agents node by node
+	DisruptionKey = "node-disruption"
+
+	defaultZoneLabel = "topology.kubernetes.io/zone"
+)
+
+// DisruptionConfig bounds the nodes disrupted at once by the operations
+// restarting the Cilium agents, in the spirit of a PodDisruptionBudget.
+// The agents are restarted by a rollout of their DaemonSet when
+// MaxPerZone is zero, and node by node in waves otherwise.
+type DisruptionConfig struct {
+	// MaxPerZone is the number of nodes of a zone whose agent is
+	// restarted at the same time, nodes already unavailable included
+	MaxPerZone int
+	// ZoneLabel is the node label the zones are read from, the nodes
+	// without it share a single zone
+	ZoneLabel string
+	// SkipCordoned leaves the agents of the cordoned nodes untouched
+	SkipCordoned bool
+}
+
+// Enabled reports whether the agents are restarted node by node
+func (c DisruptionConfig) Enabled() bool {
+	return c.MaxPerZone > 0
+}
+
+func disruptionDefaults() map[string]string {
+	return map[string]string{
+		"maxperzone":   envOrDefault("NODE_DISRUPTION_MAX_PER_ZONE", "0"),
+		"zonelabel":    envOrDefault("NODE_DISRUPTION_ZONE_LABEL", defaultZoneLabel),
+		"skipcordoned": envOrDefault("NODE_DISRUPTION_SKIP_CORDONED", "true"),
+	}
+}
+
+// Disruption returns the node disruption constraints stored in the config
+// handler
+func Disruption(h config.Handler) (DisruptionConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(DisruptionKey, &raw); err != nil {
+		return DisruptionConfig{}, err
+	}
+
+	cfg := DisruptionConfig{ZoneLabel: raw["zonelabel"]}
+	if cfg.ZoneLabel == "" {
+		cfg.ZoneLabel = defaultZoneLabel
+	}
+	if max, err := strconv.Atoi(raw["maxperzone"]); err == nil && max > 0 {
+		cfg.MaxPerZone = max
+	}
+	cfg.SkipCordoned, _ = strconv.ParseBool(raw["skipcordoned"])
+	return cfg, nil
+}
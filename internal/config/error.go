@@ -32,6 +32,34 @@ const (
 	ErrGetLatestReleaseNamesCode = "1023"
 
 	ErrGetManifestNamesCode = "1024"
+
+	// ErrLoadPipelinesCode represents the error which occurs while reading
+	// or validating the pipeline definitions
+	ErrLoadPipelinesCode = "1041"
+
+	// ErrGRPCTLSConfigCode represents the error which occurs when the TLS
+	// settings of the gRPC server are inconsistent
+	ErrGRPCTLSConfigCode = "1057"
+
+	// ErrReloadConfigCode represents the error which occurs while applying
+	// the edits of the config file
+	ErrReloadConfigCode = "1072"
+
+	// ErrProxyConfigCode represents the error which occurs when a proxy of
+	// the outbound requests is not a valid URL
+	ErrProxyConfigCode = "1073"
+
+	// ErrIncompatibleVersionCode represents the error which occurs when a
+	// Cilium version is not supported by the cluster or the installed Cilium
+	ErrIncompatibleVersionCode = "1100"
+
+	// ErrLoggingConfigCode represents the error which occurs when the
+	// format or the level of the logs is unknown
+	ErrLoggingConfigCode = "1111"
+
+	// ErrTimeoutsConfigCode represents the error which occurs when a
+	// timeout of the operations is not a valid duration
+	ErrTimeoutsConfigCode = "1122"
 )
 
 var (
@@ -53,3 +81,38 @@ func ErrGetLatestReleaseNames(err error) error {
 func ErrGetManifestNames(err error) error {
 	return errors.New(ErrGetManifestNamesCode, errors.Alert, []string{"Unable to fetch manifest names from github"}, []string{err.Error()}, []string{}, []string{})
 }
+
+// ErrLoadPipelines is the error for invalid pipeline definitions
+func ErrLoadPipelines(err error) error {
+	return errors.New(ErrLoadPipelinesCode, errors.Alert, []string{"Unable to load pipelines"}, []string{err.Error()}, []string{"The pipelines file is not valid YAML", "A pipeline step refers to an unknown operation"}, []string{"Verify the pipeline definitions in the pipelines file"})
+}
+
+// ErrGRPCTLSConfig is the error for inconsistent gRPC TLS settings
+func ErrGRPCTLSConfig(reason string) error {
+	return errors.New(ErrGRPCTLSConfigCode, errors.Alert, []string{"Invalid gRPC TLS configuration"}, []string{reason}, []string{"A required TLS setting is missing"}, []string{"Verify the GRPC_TLS_* settings of the adapter"})
+}
+
+// ErrReloadConfig is the error while applying the edits of the config file
+func ErrReloadConfig(err error) error {
+	return errors.New(ErrReloadConfigCode, errors.Alert, []string{"Error reloading configuration"}, []string{err.Error()}, []string{"The config file is not valid YAML"}, []string{"Fix the config file, the previous settings stay in effect until then"})
+}
+
+// ErrProxyConfig is the error for invalid proxy settings
+func ErrProxyConfig(err error) error {
+	return errors.New(ErrProxyConfigCode, errors.Alert, []string{"Invalid proxy configuration"}, []string{err.Error()}, []string{"HTTP_PROXY, HTTPS_PROXY or the proxy of the config file is not a URL"}, []string{"Set the proxies to URLs such as http://proxy.example.com:3128"})
+}
+
+// ErrIncompatibleVersion is the error for a Cilium version the cluster can't run
+func ErrIncompatibleVersion(err error) error {
+	return errors.New(ErrIncompatibleVersionCode, errors.Alert, []string{"Incompatible Cilium version"}, []string{err.Error()}, []string{"The Cilium version doesn't support the Kubernetes version of the cluster", "The upgrade skips a minor version of Cilium"}, []string{"Choose a Cilium version supporting the Kubernetes version of the cluster", "Upgrade Cilium one minor version at a time"})
+}
+
+// ErrLoggingConfig is the error for invalid logger settings
+func ErrLoggingConfig(err error) error {
+	return errors.New(ErrLoggingConfigCode, errors.Alert, []string{"Invalid logging configuration"}, []string{err.Error()}, []string{"LOG_FORMAT or LOG_LEVEL holds an unknown value"}, []string{"Set LOG_FORMAT to syslog, json or terminal and LOG_LEVEL to trace, debug, info, warn or error"})
+}
+
+// ErrTimeoutsConfig is the error for invalid operation timeouts
+func ErrTimeoutsConfig(err error) error {
+	return errors.New(ErrTimeoutsConfigCode, errors.Alert, []string{"Invalid operation timeouts"}, []string{err.Error()}, []string{"OPERATION_TIMEOUT or OPERATION_TIMEOUTS holds an invalid duration"}, []string{"Set OPERATION_TIMEOUT to a duration such as 30m and OPERATION_TIMEOUTS to pairs such as install=45m,cilium_connectivity_test=1h"})
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultFaultDelay = 5 * time.Second
+
+// Faults describe the failures simulated on the requests made to the
+// Meshery server, so that the retries of the registration can be verified
+// and demoed without breaking a real server. They are read from
+// MESHERY_SERVER_FAULTS, e.g. "5xx=0.3,timeout=0.1,slow=0.2,delay=3s",
+// and disabled when it is unset.
+type Faults struct {
+	// ServerErrorRate is the share of requests answered with a 503
+	ServerErrorRate float64
+	// TimeoutRate is the share of requests failing with a timeout after
+	// Delay, without reaching the server
+	TimeoutRate float64
+	// SlowRate is the share of requests sent to the server after Delay
+	SlowRate float64
+	// Delay is the time timed out and slow requests are held for
+	Delay time.Duration
+}
+
+// Enabled reports whether any failure is simulated
+func (f Faults) Enabled() bool {
+	return f.ServerErrorRate > 0 || f.TimeoutRate > 0 || f.SlowRate > 0
+}
+
+// ParseFaults reads the faults from their comma separated form, the
+// invalid entries are ignored
+func ParseFaults(raw string) Faults {
+	f := Faults{Delay: defaultFaultDelay}
+	for _, entry := range strings.Split(raw, ",") {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, val := strings.ToLower(kv[0]), kv[1]
+		if key == "delay" {
+			if d, err := time.ParseDuration(val); err == nil && d >= 0 {
+				f.Delay = d
+			}
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(val, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			continue
+		}
+		switch key {
+		case "5xx":
+			f.ServerErrorRate = rate
+		case "timeout":
+			f.TimeoutRate = rate
+		case "slow":
+			f.SlowRate = rate
+		}
+	}
+	return f
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/config"
+	"github.com/layer5io/meshery-adapter-library/meshes"
+)
+
+const (
+	// FencingKey is the config key holding how the mutating operations
+	// targeting the same cluster are kept from running concurrently
+	FencingKey = "operation-fencing"
+
+	// FencingQueue waits for the running operation to complete
+	FencingQueue = "queue"
+	// FencingReject fails the operation right away
+	FencingReject = "reject"
+
+	defaultFencingTimeout = 30 * time.Minute
+)
+
+// FencingConfig is what happens to a mutating operation targeting a
+// cluster another mutating operation is running on
+type FencingConfig struct {
+	// Mode is FencingQueue or FencingReject
+	Mode string
+	// Timeout bounds the wait of a queued operation, it is rejected once
+	// the timeout elapses
+	Timeout time.Duration
+}
+
+func fencingDefaults() map[string]string {
+	return map[string]string{
+		"mode":    envOrDefault("OPERATION_FENCING", FencingQueue),
+		"timeout": envOrDefault("OPERATION_FENCING_TIMEOUT", defaultFencingTimeout.String()),
+	}
+}
+
+// Fencing returns the fencing of the mutating operations stored in the
+// config handler
+func Fencing(h config.Handler) (FencingConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(FencingKey, &raw); err != nil {
+		return FencingConfig{}, err
+	}
+
+	cfg := FencingConfig{Mode: FencingQueue, Timeout: defaultFencingTimeout}
+	if raw["mode"] == FencingReject {
+		cfg.Mode = FencingReject
+	}
+	if timeout, err := time.ParseDuration(raw["timeout"]); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
+
+// Mutating reports whether op changes the cluster, the installs, the
+// configurations and the disruptive operations are fenced
+func Mutating(op *adapter.Operation) bool {
+	switch op.Type {
+	case int32(meshes.OpCategory_INSTALL), int32(meshes.OpCategory_CONFIGURE):
+		return true
+	}
+	return op.AdditionalProperties[Disruptive] == "true"
+}
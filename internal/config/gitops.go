@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+)
+
+const (
+	// GitOpsKey is the config key holding where the manifests applied by
+	// the operations are exported to
+	GitOpsKey = "gitops"
+
+	defaultGitOpsBranch      = "main"
+	defaultGitOpsAuthorName  = "Meshery Cilium adapter"
+	defaultGitOpsAuthorEmail = "cilium-adapter@meshery.io"
+	defaultGitOpsTimeout     = 2 * time.Minute
+)
+
+// GitOpsConfig holds where the manifests applied by the operations are
+// exported to, a Git repository or a directory such as a mounted volume.
+// ArgoCD or Flux can then own the reconciliation of the exported manifests.
+type GitOpsConfig struct {
+	// RepoURL is the Git repository the manifests are committed to
+	RepoURL string
+	// Branch is the branch the commits are pushed to, it is created when
+	// it doesn't exist yet
+	Branch string
+	// Path is the directory of the repository the manifests are written to
+	Path string
+	// Username and TokenFile hold the credentials of HTTPS repositories,
+	// SSH repositories use the keys of the adapter
+	Username  string
+	TokenFile string
+	// AuthorName and AuthorEmail sign the commits
+	AuthorName  string
+	AuthorEmail string
+	// Dir is the directory the manifests are written to instead of a
+	// repository
+	Dir string
+	// Timeout bounds a single export
+	Timeout time.Duration
+}
+
+// Enabled reports whether the manifests are exported
+func (c GitOpsConfig) Enabled() bool {
+	return c.RepoURL != "" || c.Dir != ""
+}
+
+func gitOpsDefaults() map[string]string {
+	return map[string]string{
+		"repourl":     os.Getenv("GITOPS_REPO_URL"),
+		"branch":      envOrDefault("GITOPS_BRANCH", defaultGitOpsBranch),
+		"path":        os.Getenv("GITOPS_PATH"),
+		"username":    os.Getenv("GITOPS_USERNAME"),
+		"tokenfile":   os.Getenv("GITOPS_TOKEN_FILE"),
+		"authorname":  envOrDefault("GITOPS_AUTHOR_NAME", defaultGitOpsAuthorName),
+		"authoremail": envOrDefault("GITOPS_AUTHOR_EMAIL", defaultGitOpsAuthorEmail),
+		"dir":         os.Getenv("GITOPS_DIR"),
+		"timeout":     envOrDefault("GITOPS_TIMEOUT", defaultGitOpsTimeout.String()),
+	}
+}
+
+// GitOps returns the export settings stored in the config handler
+func GitOps(h config.Handler) (GitOpsConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(GitOpsKey, &raw); err != nil {
+		return GitOpsConfig{}, err
+	}
+
+	cfg := GitOpsConfig{
+		RepoURL:     raw["repourl"],
+		Branch:      raw["branch"],
+		Path:        raw["path"],
+		Username:    raw["username"],
+		TokenFile:   raw["tokenfile"],
+		AuthorName:  raw["authorname"],
+		AuthorEmail: raw["authoremail"],
+		Dir:         raw["dir"],
+		Timeout:     defaultGitOpsTimeout,
+	}
+	if cfg.Branch == "" {
+		cfg.Branch = defaultGitOpsBranch
+	}
+	if timeout, err := time.ParseDuration(raw["timeout"]); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+)
+
+const (
+	// GRPCTLSKey is the config key holding the TLS settings of the
+	// adapter's gRPC server
+	GRPCTLSKey = "grpc-tls"
+)
+
+// GRPCTLSConfig holds the TLS settings of the adapter's gRPC server. The
+// certificates are read either from files or from a kubernetes.io/tls
+// Secret, the gRPC API is served in plaintext when neither is set.
+type GRPCTLSConfig struct {
+	// CertFile and KeyFile hold the server certificate
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM bundle used to verify the client certificates
+	CAFile string
+	// Secret is a namespace/name reference to a Secret holding the
+	// tls.crt, tls.key and optionally ca.crt entries, it takes
+	// precedence over the files
+	Secret string
+	// RequireClientCert enables mTLS, the Meshery server then has to
+	// present a certificate signed by the CA
+	RequireClientCert bool
+}
+
+// Enabled reports whether the gRPC API is served over TLS
+func (c GRPCTLSConfig) Enabled() bool {
+	return c.Secret != "" || c.CertFile != "" || c.KeyFile != ""
+}
+
+func grpcTLSDefaults() map[string]string {
+	return map[string]string{
+		"certfile":          os.Getenv("GRPC_TLS_CERT_FILE"),
+		"keyfile":           os.Getenv("GRPC_TLS_KEY_FILE"),
+		"cafile":            os.Getenv("GRPC_TLS_CA_FILE"),
+		"secret":            os.Getenv("GRPC_TLS_SECRET"),
+		"requireclientcert": strconv.FormatBool(os.Getenv("GRPC_TLS_REQUIRE_CLIENT_CERT") == "true"),
+	}
+}
+
+// GRPCTLS returns the TLS settings of the gRPC server stored in the config handler
+func GRPCTLS(h config.Handler) (GRPCTLSConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(GRPCTLSKey, &raw); err != nil {
+		return GRPCTLSConfig{}, err
+	}
+
+	cfg := GRPCTLSConfig{
+		CertFile: raw["certfile"],
+		KeyFile:  raw["keyfile"],
+		CAFile:   raw["cafile"],
+		Secret:   raw["secret"],
+	}
+	cfg.RequireClientCert, _ = strconv.ParseBool(raw["requireclientcert"])
+	if cfg.RequireClientCert && cfg.CAFile == "" && cfg.Secret == "" {
+		return cfg, ErrGRPCTLSConfig("client certificates are required but no CA is configured")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KubernetesRange is the range of Kubernetes minor versions a Cilium minor
+// version is tested against
+type KubernetesRange struct {
+	Min string
+	Max string
+}
+
+// CiliumKubernetesCompatibility is the compatibility matrix of the Cilium
+// minor versions with the Kubernetes releases published by Cilium
+var CiliumKubernetesCompatibility = map[string]KubernetesRange{
+	"1.10": {Min: "1.16", Max: "1.21"},
+	"1.11": {Min: "1.16", Max: "1.23"},
+	"1.12": {Min: "1.16", Max: "1.24"},
+	"1.13": {Min: "1.16", Max: "1.26"},
+	"1.14": {Min: "1.16", Max: "1.27"},
+	"1.15": {Min: "1.16", Max: "1.29"},
+	"1.16": {Min: "1.16", Max: "1.30"},
+}
+
+// CheckCiliumVersion checks that the Cilium version target runs on the
+// Kubernetes version of the cluster. When Cilium is already installed,
+// installed is its version and the change has to be to the same or to an
+// adjacent minor version, Cilium upgrades and rolls back one minor version
+// at a time.
+func CheckCiliumVersion(target, kubernetes, installed string) error {
+	t, ok := minorVersion(target)
+	if !ok {
+		return ErrIncompatibleVersion(fmt.Errorf("%q is not a Cilium version", target))
+	}
+	k, ok := minorVersion(kubernetes)
+	if !ok {
+		return ErrIncompatibleVersion(fmt.Errorf("%q is not a Kubernetes version", kubernetes))
+	}
+
+	key := fmt.Sprintf("%d.%d", t[0], t[1])
+	r, ok := CiliumKubernetesCompatibility[key]
+	if !ok {
+		return ErrIncompatibleVersion(fmt.Errorf("Cilium %s is not in the compatibility matrix of the adapter", key))
+	}
+	min, _ := minorVersion(r.Min)
+	max, _ := minorVersion(r.Max)
+	if minorLess(k, min) || minorLess(max, k) {
+		return ErrIncompatibleVersion(fmt.Errorf("Cilium %s supports Kubernetes %s to %s, the cluster runs Kubernetes %d.%d", key, r.Min, r.Max, k[0], k[1]))
+	}
+
+	if installed == "" {
+		return nil
+	}
+	i, ok := minorVersion(installed)
+	if !ok {
+		return ErrIncompatibleVersion(fmt.Errorf("%q is not a Cilium version", installed))
+	}
+	if i[0] != t[0] || t[1]-i[1] > 1 || i[1]-t[1] > 1 {
+		return ErrIncompatibleVersion(fmt.Errorf("Cilium %d.%d can't be changed to %s in one step, go through every minor version in between", i[0], i[1], key))
+	}
+	return nil
+}
+
+// KubernetesCompatible splits the Cilium versions into the ones running
+// on the Kubernetes version of the cluster and the ones which don't. The
+// versions missing from the compatibility matrix are kept, the matrix only
+// rules out the versions it knows.
+func KubernetesCompatible(versions []string, kubernetes string) ([]string, []string) {
+	k, ok := minorVersion(kubernetes)
+	if !ok {
+		return versions, nil
+	}
+	var compatible, incompatible []string
+	for _, v := range versions {
+		t, ok := minorVersion(v)
+		if !ok {
+			compatible = append(compatible, v)
+			continue
+		}
+		r, ok := CiliumKubernetesCompatibility[fmt.Sprintf("%d.%d", t[0], t[1])]
+		if !ok {
+			compatible = append(compatible, v)
+			continue
+		}
+		min, _ := minorVersion(r.Min)
+		max, _ := minorVersion(r.Max)
+		if minorLess(k, min) || minorLess(max, k) {
+			incompatible = append(incompatible, v)
+			continue
+		}
+		compatible = append(compatible, v)
+	}
+	return compatible, incompatible
+}
+
+func minorVersion(version string) ([2]int, bool) {
+	var v [2]int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(version, "v"), "%d.%d", &v[0], &v[1]); err != nil {
+		return v, false
+	}
+	return v, true
+}
+
+func minorLess(a, b [2]int) bool {
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+	return a[1] < b[1]
+}
@@ -0,0 +1,30 @@
+package config
+
+import "os"
+
+const (
+	// DefaultFortioImage is the fortio load generator used unless
+	// FORTIO_IMAGE is set
+	DefaultFortioImage = "fortio/fortio:1.21.1"
+
+	// DefaultWrk2Image is the wrk2 load generator used unless WRK2_IMAGE is
+	// set. The image publishes no versioned tags, set WRK2_IMAGE to a
+	// digest, e.g. cylab/wrk2@sha256:..., to pin the one the tests run.
+	DefaultWrk2Image = "cylab/wrk2:latest"
+)
+
+// FortioImage returns the image of the fortio load generator
+func FortioImage() string {
+	if v := os.Getenv("FORTIO_IMAGE"); v != "" {
+		return v
+	}
+	return DefaultFortioImage
+}
+
+// Wrk2Image returns the image of the wrk2 load generator
+func Wrk2Image() string {
+	if v := os.Getenv("WRK2_IMAGE"); v != "" {
+		return v
+	}
+	return DefaultWrk2Image
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+)
+
+const (
+	// LoggingKey is the config key holding the settings of the logger
+	LoggingKey = "logging"
+
+	// Formats of the logs
+	LogFormatSyslog   = "syslog"
+	LogFormatJSON     = "json"
+	LogFormatTerminal = "terminal"
+
+	// Levels of the logs, from the most to the least verbose
+	LogLevelTrace = "trace"
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+
+	defaultLogMaxBytes   = 100 << 20
+	defaultLogMaxBackups = 5
+)
+
+// LoggingConfig holds the settings of the logger
+type LoggingConfig struct {
+	// Format is syslog, json or terminal
+	Format string
+	// Level is the least severe level logged
+	Level string
+	// File receives the logs next to the standard output when set
+	File string
+	// MaxBytes is the size at which File is rotated, zero disables rotation
+	MaxBytes int64
+	// MaxBackups are the rotated files kept, the oldest are removed first
+	MaxBackups int
+}
+
+func loggingDefaults() map[string]string {
+	// DEBUG predates LOG_LEVEL and is still honored
+	level := LogLevelInfo
+	if os.Getenv("DEBUG") == "true" {
+		level = LogLevelDebug
+	}
+	return map[string]string{
+		"format":     envOrDefault("LOG_FORMAT", LogFormatSyslog),
+		"level":      envOrDefault("LOG_LEVEL", level),
+		"file":       os.Getenv("LOG_FILE"),
+		"maxbytes":   envOrDefault("LOG_MAX_BYTES", strconv.Itoa(defaultLogMaxBytes)),
+		"maxbackups": envOrDefault("LOG_MAX_BACKUPS", strconv.Itoa(defaultLogMaxBackups)),
+	}
+}
+
+// Logging returns the logger settings stored in the config handler
+func Logging(h config.Handler) (LoggingConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(LoggingKey, &raw); err != nil {
+		return LoggingConfig{}, err
+	}
+
+	cfg := LoggingConfig{
+		Format:     strings.ToLower(raw["format"]),
+		Level:      strings.ToLower(raw["level"]),
+		File:       raw["file"],
+		MaxBytes:   defaultLogMaxBytes,
+		MaxBackups: defaultLogMaxBackups,
+	}
+	switch cfg.Format {
+	case LogFormatSyslog, LogFormatJSON, LogFormatTerminal:
+	default:
+		return LoggingConfig{}, ErrLoggingConfig(fmt.Errorf("unknown log format %q", cfg.Format))
+	}
+	switch cfg.Level {
+	case LogLevelTrace, LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		return LoggingConfig{}, ErrLoggingConfig(fmt.Errorf("unknown log level %q", cfg.Level))
+	}
+	if size, err := strconv.ParseInt(raw["maxbytes"], 10, 64); err == nil && size >= 0 {
+		cfg.MaxBytes = size
+	}
+	if n, err := strconv.Atoi(raw["maxbackups"]); err == nil && n >= 0 {
+		cfg.MaxBackups = n
+	}
+
+	return cfg, nil
+}
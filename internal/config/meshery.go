@@ -0,0 +1,233 @@
+package config
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+)
+
+const (
+	// MesheryServerKey is the config key holding the settings used
+	// for the requests made from the adapter to the Meshery server
+	MesheryServerKey = "meshery-server"
+
+	defaultRegistrationTimeout = 10 * time.Minute
+	defaultLockTimeout         = 30 * time.Minute
+	defaultRegistrationBackoff = 5 * time.Minute
+	defaultReRegisterInterval  = 24 * time.Hour
+	defaultComponentsTimeout   = 30 * time.Minute
+)
+
+// MesheryServerConfig holds the settings used for the requests made
+// from the adapter to the Meshery server
+type MesheryServerConfig struct {
+	// Addresses are the Meshery servers the adapter registers with, the
+	// next one is used when a server fails
+	Addresses []string
+	// DiscoveryDNS is a host resolved to the addresses of more servers
+	DiscoveryDNS string
+	// DiscoverySelector selects the Services of more servers in
+	// DiscoveryNamespace, the namespace of the adapter when empty
+	DiscoverySelector  string
+	DiscoveryNamespace string
+	// MesheryctlConfig is the mesheryctl config file the address of the
+	// server of the current context is read from
+	MesheryctlConfig string
+	// CAFile is the PEM bundle used to verify the Meshery server certificate
+	CAFile string
+	// CertFile and KeyFile hold the client certificate presented for mTLS
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables verification of the server certificate
+	InsecureSkipVerify bool
+	// Token is the provider token or API key presented with every request
+	Token string
+	// TokenFile is read before every request when Token is empty so that
+	// tokens mounted from a rotated secret are always current. It holds
+	// either the token or the auth.json written by mesheryctl.
+	TokenFile string
+	// Provider is the Meshery provider which issued the token, the token
+	// is then presented the way the Meshery UI and mesheryctl present it
+	Provider string
+	// RetryTimeout bounds the time spent retrying a single request
+	RetryTimeout time.Duration
+	// RegistrationMaxAttempts bounds the attempts made to register the
+	// capabilities of the adapter, zero retries forever
+	RegistrationMaxAttempts int
+	// RegistrationMaxBackoff caps the jittered exponential backoff between
+	// two registration attempts
+	RegistrationMaxBackoff time.Duration
+	// ReRegisterInterval is the interval at which the latest dynamic
+	// capabilities are registered again
+	ReRegisterInterval time.Duration
+	// LockTimeout bounds the time a disruptive operation waits for
+	// another adapter to release the cluster, zero disables coordination
+	LockTimeout time.Duration
+	// ComponentVersions are the Cilium versions the components are
+	// generated and registered for, the adapter version when empty
+	ComponentVersions []string
+	// ReleaseChannel subscribes the adapter to a Cilium release channel,
+	// the components of the version it points at are registered instead of
+	// those of the adapter version and upgrades to it are announced
+	ReleaseChannel string
+	// ComponentsURL overrides the source the Cilium components are
+	// generated from, a chart or manifests depending on ComponentsMethod
+	ComponentsURL    string
+	ComponentsMethod string
+	// ComponentsWorkers are the CRDs of the components source generated
+	// concurrently
+	ComponentsWorkers int
+	// ComponentsTimeout bounds the generation of the components of a
+	// single source
+	ComponentsTimeout time.Duration
+	// ComponentsRegistry authenticates the pulls of an oci:// ComponentsURL
+	ComponentsRegistry RegistryAuth
+	// Faults are the failures simulated on the requests to the Meshery
+	// server in diagnostic mode
+	Faults Faults
+	// Proxy are the proxies of the outbound requests
+	Proxy ProxyConfig
+	// Schemas bound the schemas of the registered components
+	Schemas SchemaLimits
+}
+
+// mesheryServerDefaults builds the Meshery server settings from the environment
+func mesheryServerDefaults() map[string]string {
+	return map[string]string{
+		"addresses":               os.Getenv("MESHERY_SERVER"),
+		"discoverydns":            os.Getenv("MESHERY_SERVER_DNS"),
+		"discoveryselector":       os.Getenv("MESHERY_SERVER_SELECTOR"),
+		"discoverynamespace":      os.Getenv("MESHERY_SERVER_NAMESPACE"),
+		"mesheryctlconfig":        os.Getenv("MESHERYCTL_CONFIG"),
+		"cafile":                  os.Getenv("MESHERY_SERVER_CA_FILE"),
+		"certfile":                os.Getenv("MESHERY_SERVER_CERT_FILE"),
+		"keyfile":                 os.Getenv("MESHERY_SERVER_KEY_FILE"),
+		"insecureskipverify":      strconv.FormatBool(os.Getenv("MESHERY_SERVER_INSECURE") == "true"),
+		"token":                   os.Getenv("MESHERY_SERVER_TOKEN"),
+		"tokenfile":               os.Getenv("MESHERY_SERVER_TOKEN_FILE"),
+		"provider":                os.Getenv("MESHERY_PROVIDER"),
+		"retrytimeout":            envOrDefault("MESHERY_SERVER_RETRY_TIMEOUT", defaultRegistrationTimeout.String()),
+		"registrationmaxattempts": envOrDefault("MESHERY_SERVER_REGISTRATION_MAX_ATTEMPTS", "0"),
+		"registrationmaxbackoff":  envOrDefault("MESHERY_SERVER_REGISTRATION_MAX_BACKOFF", defaultRegistrationBackoff.String()),
+		"reregisterinterval":      envOrDefault("MESHERY_SERVER_REREGISTER_INTERVAL", defaultReRegisterInterval.String()),
+		"locktimeout":             envOrDefault("MESHERY_SERVER_LOCK_TIMEOUT", defaultLockTimeout.String()),
+		"componentversions":       os.Getenv("CILIUM_COMPONENT_VERSIONS"),
+		"releasechannel":          os.Getenv("CILIUM_RELEASE_CHANNEL"),
+		"faults":                  os.Getenv("MESHERY_SERVER_FAULTS"),
+		"componentsurl":           os.Getenv("COMP_GEN_URL"),
+		"componentsmethod":        os.Getenv("COMP_GEN_METHOD"),
+		"componentsworkers":       envOrDefault("COMP_GEN_WORKERS", strconv.Itoa(runtime.NumCPU())),
+		"componentstimeout":       envOrDefault("COMP_GEN_TIMEOUT", defaultComponentsTimeout.String()),
+		"registryusername":        os.Getenv("COMP_GEN_REGISTRY_USERNAME"),
+		"registrypassword":        os.Getenv("COMP_GEN_REGISTRY_PASSWORD"),
+		"registryplainhttp":       strconv.FormatBool(os.Getenv("COMP_GEN_REGISTRY_PLAIN_HTTP") == "true"),
+		"httpproxy":               envOrDefault("HTTP_PROXY", os.Getenv("http_proxy")),
+		"httpsproxy":              envOrDefault("HTTPS_PROXY", os.Getenv("https_proxy")),
+		"noproxy":                 envOrDefault("NO_PROXY", os.Getenv("no_proxy")),
+		"schemamaxbytes":          envOrDefault("MESHERY_SERVER_SCHEMA_MAX_BYTES", strconv.Itoa(DefaultSchemaMaxBytes)),
+		"schemamaxdescription":    envOrDefault("MESHERY_SERVER_SCHEMA_MAX_DESCRIPTION", "0"),
+		"gzip":                    strconv.FormatBool(os.Getenv("MESHERY_SERVER_GZIP") == "true"),
+	}
+}
+
+// MesheryServer returns the Meshery server settings stored in the config handler
+func MesheryServer(h config.Handler) (MesheryServerConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(MesheryServerKey, &raw); err != nil {
+		return MesheryServerConfig{}, err
+	}
+
+	cfg := MesheryServerConfig{
+		DiscoveryDNS:       raw["discoverydns"],
+		DiscoverySelector:  raw["discoveryselector"],
+		DiscoveryNamespace: raw["discoverynamespace"],
+		MesheryctlConfig:   raw["mesheryctlconfig"],
+		CAFile:             raw["cafile"],
+		CertFile:           raw["certfile"],
+		KeyFile:            raw["keyfile"],
+		Token:              raw["token"],
+		TokenFile:          raw["tokenfile"],
+		Provider:           raw["provider"],
+	}
+	for _, addr := range strings.Split(raw["addresses"], ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.Addresses = append(cfg.Addresses, addr)
+		}
+	}
+	cfg.InsecureSkipVerify, _ = strconv.ParseBool(raw["insecureskipverify"])
+
+	timeout, err := time.ParseDuration(raw["retrytimeout"])
+	if err != nil {
+		timeout = defaultRegistrationTimeout
+	}
+	cfg.RetryTimeout = timeout
+
+	cfg.RegistrationMaxAttempts, _ = strconv.Atoi(raw["registrationmaxattempts"])
+	cfg.RegistrationMaxBackoff = defaultRegistrationBackoff
+	if backoff, err := time.ParseDuration(raw["registrationmaxbackoff"]); err == nil {
+		cfg.RegistrationMaxBackoff = backoff
+	}
+
+	cfg.ReRegisterInterval = defaultReRegisterInterval
+	if interval, err := time.ParseDuration(raw["reregisterinterval"]); err == nil && interval > 0 {
+		cfg.ReRegisterInterval = interval
+	}
+
+	lockTimeout, err := time.ParseDuration(raw["locktimeout"])
+	if err != nil {
+		lockTimeout = defaultLockTimeout
+	}
+	cfg.LockTimeout = lockTimeout
+
+	for _, v := range strings.Split(raw["componentversions"], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			cfg.ComponentVersions = append(cfg.ComponentVersions, v)
+		}
+	}
+
+	if channel := strings.ToLower(raw["releasechannel"]); ValidReleaseChannel(channel) {
+		cfg.ReleaseChannel = channel
+	}
+
+	cfg.Faults = ParseFaults(raw["faults"])
+	cfg.ComponentsURL = raw["componentsurl"]
+	cfg.ComponentsMethod = raw["componentsmethod"]
+	cfg.ComponentsWorkers = runtime.NumCPU()
+	if n, err := strconv.Atoi(raw["componentsworkers"]); err == nil && n > 0 {
+		cfg.ComponentsWorkers = n
+	}
+	cfg.ComponentsTimeout = defaultComponentsTimeout
+	if timeout, err := time.ParseDuration(raw["componentstimeout"]); err == nil && timeout > 0 {
+		cfg.ComponentsTimeout = timeout
+	}
+	cfg.ComponentsRegistry = RegistryAuth{
+		Username: raw["registryusername"],
+		Password: raw["registrypassword"],
+	}
+	cfg.ComponentsRegistry.PlainHTTP, _ = strconv.ParseBool(raw["registryplainhttp"])
+	cfg.Proxy = ProxyConfig{
+		HTTPProxy:  raw["httpproxy"],
+		HTTPSProxy: raw["httpsproxy"],
+		NoProxy:    raw["noproxy"],
+	}
+	cfg.Schemas = parseSchemaLimits(raw)
+
+	return cfg, nil
+}
+
+// ComponentsTimeoutInMinutes returns the generation timeout the way the
+// adapter library expects it, rounded up to the minute
+func (c MesheryServerConfig) ComponentsTimeoutInMinutes() int {
+	return int((c.ComponentsTimeout + time.Minute - 1) / time.Minute)
+}
+
+func envOrDefault(key, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
@@ -3,10 +3,524 @@ package config
 import (
 	"strings"
 
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/common"
+	"github.com/layer5io/meshery-adapter-library/meshes"
 	smp "github.com/layer5io/service-mesh-performance/spec"
 )
 
 var (
 	CiliumOperation = strings.ToLower(smp.ServiceMesh_CILIUM_SERVICE_MESH.Enum().String())
 	ServiceName     = "service_name"
+
+	// CiliumSecurityReportOperation reports on the RBAC and token hygiene
+	// of the ServiceAccounts used by Cilium and by the adapter itself
+	CiliumSecurityReportOperation = "cilium_security_report"
+
+	// CiliumWireguardEncryptionOperation and CiliumIPsecEncryptionOperation
+	// toggle transparent node-to-node encryption
+	CiliumWireguardEncryptionOperation = "cilium_encryption_wireguard"
+	CiliumIPsecEncryptionOperation     = "cilium_encryption_ipsec"
+
+	// CiliumKubeProxyReplacementOperation switches Cilium's eBPF
+	// kube-proxy replacement on or off
+	CiliumKubeProxyReplacementOperation = "cilium_kube_proxy_replacement"
+
+	// CiliumCRDUpgradeOperation upgrades the Cilium CRDs and migrates the
+	// stored custom resources ahead of a Cilium upgrade
+	CiliumCRDUpgradeOperation = "cilium_crd_upgrade"
+
+	// CiliumEgressGatewayOperation enables the egress gateway so that
+	// CiliumEgressGatewayPolicy resources take effect
+	CiliumEgressGatewayOperation = "cilium_egress_gateway"
+
+	// CiliumTrafficMirrorOperation mirrors the HTTP requests of a service
+	// to a debug sink for a bounded duration
+	CiliumTrafficMirrorOperation = "cilium_traffic_mirror"
+
+	// CiliumEgressIPReportOperation reports the egress IPs used by the
+	// workloads of every namespace
+	CiliumEgressIPReportOperation = "cilium_egress_ip_report"
+
+	// CiliumPolicyTestOperation runs a bundle of policies against
+	// declarative traffic assertions on fixture pods
+	CiliumPolicyTestOperation = "cilium_policy_test"
+
+	// CiliumSelfTestOperation checks the Cilium installation and exercises
+	// a subset of the operations against it
+	CiliumSelfTestOperation = "cilium_self_test"
+
+	// CiliumGrafanaDashboardsOperation installs Grafana dashboards for
+	// the features enabled on the agents
+	CiliumGrafanaDashboardsOperation = "cilium_grafana_dashboards"
+
+	// CiliumHubbleUIOperation exposes the Hubble UI through the Cilium
+	// ingress controller with TLS and authentication
+	CiliumHubbleUIOperation = "cilium_hubble_ui"
+
+	// CiliumHubbleRelayOperation enables Hubble Relay serving the flow API
+	// over TLS and reports its endpoint
+	CiliumHubbleRelayOperation = "cilium_hubble_relay"
+
+	// CiliumConnectivityTestOperation runs the connectivity test of the
+	// cilium CLI against the cluster
+	CiliumConnectivityTestOperation = "cilium_connectivity_test"
+
+	// CiliumVisibilityAnnotationOperation annotates the workloads selected
+	// by label with the ports whose L7 traffic the proxy makes visible
+	CiliumVisibilityAnnotationOperation = "cilium_visibility_annotation"
+
+	// CiliumBandwidthAnnotationOperation annotates the workloads selected
+	// by label with the bandwidth limits of their pods
+	CiliumBandwidthAnnotationOperation = "cilium_bandwidth_annotation"
+
+	// CiliumStatusOperation reports the health of the agents and of the
+	// operator, the features enabled and the usage of the pod CIDRs
+	CiliumStatusOperation = "cilium_status"
+
+	// CiliumNodeHealthOperation reports the health of the agent and of the
+	// endpoints of every node
+	CiliumNodeHealthOperation = "cilium_node_health"
+
+	// CiliumHubbleExportOperation exports the Hubble flows to a file on
+	// the nodes, or ships them to Kafka or an OTLP backend
+	CiliumHubbleExportOperation = "cilium_hubble_export"
+
+	// CiliumHubbleMetricsOperation enables the Hubble metrics derived from
+	// the flows and annotates them for Prometheus
+	CiliumHubbleMetricsOperation = "cilium_hubble_metrics"
+
+	// CiliumMonitoringOperation provisions the Prometheus ServiceMonitors
+	// and the official Grafana dashboards of Cilium
+	CiliumMonitoringOperation = "cilium_monitoring"
+
+	// CiliumPolicyRecommendationOperation synthesizes least-privilege
+	// policies from the flows observed by Hubble
+	CiliumPolicyRecommendationOperation = "cilium_policy_recommendation"
+
+	// CiliumEnvoyConfigOperation enables the embedded Envoy so that
+	// CiliumEnvoyConfig resources take effect
+	CiliumEnvoyConfigOperation = "cilium_envoy_config"
+
+	// CiliumMutualAuthOperation enables the mutual authentication of the
+	// agents with the SPIRE server installed by the chart
+	CiliumMutualAuthOperation = "cilium_mutual_auth"
+
+	// CiliumBGPControlPlaneOperation enables the BGP control plane so that
+	// the BGP resources take effect
+	CiliumBGPControlPlaneOperation = "cilium_bgp_control_plane"
+
+	// CiliumBandwidthManagerOperation enables the bandwidth manager of the
+	// agents, optionally with BBR congestion control
+	CiliumBandwidthManagerOperation = "cilium_bandwidth_manager"
+
+	// CiliumHostFirewallOperation enables the host firewall so that the
+	// host policies are enforced on the nodes
+	CiliumHostFirewallOperation = "cilium_host_firewall"
+
+	// CiliumLocalRedirectPolicyOperation enables the local redirect
+	// policies so that CiliumLocalRedirectPolicy resources take effect
+	CiliumLocalRedirectPolicyOperation = "cilium_local_redirect_policy"
+
+	// CiliumDualStackOperation enables IPv6 alongside IPv4 once the
+	// cluster passed the preflight checks
+	CiliumDualStackOperation = "cilium_dual_stack"
+
+	// CiliumUpgradeOperation upgrades Cilium a few agents at a time,
+	// pausing when the upgraded agents drop traffic
+	CiliumUpgradeOperation = "cilium_upgrade"
+
+	// CiliumPerformanceTestOperation runs an SMP performance test against
+	// a service and reports the datapath counters of the agents
+	CiliumPerformanceTestOperation = "cilium_performance_test"
+
+	// CiliumExportOperation exports the chart values and the manifests of
+	// the running Cilium as artifacts
+	CiliumExportOperation = "cilium_export"
+
+	// CiliumReconcileOperation restores the configuration and the policies
+	// last applied through the adapter once they drifted
+	CiliumReconcileOperation = "cilium_reconcile"
+
+	// CiliumCancelOperation cancels the running operations selected by ID
+	// or by name
+	CiliumCancelOperation = "cilium_cancel_operation"
+
+	// CiliumCleanupOperation removes the test resources deployed by the
+	// adapter
+	CiliumCleanupOperation = "cilium_cleanup"
+
+	// CiliumPolicyLintOperation scores the network policies of a namespace
+	// or of the cluster against best-practice checks
+	CiliumPolicyLintOperation = "cilium_policy_lint"
+
+	// TetragonOperation installs Tetragon, Cilium's eBPF based runtime
+	// security enforcement
+	TetragonOperation = "tetragon"
+
+	// Disruptive is the additional property marking the operations which
+	// change the CNI or the proxies of the cluster. They are coordinated
+	// with the other Meshery adapters managing the same cluster.
+	Disruptive = "disruptive"
+
+	// Ephemeral is the additional property marking the operations which
+	// deploy test resources, the garbage collector removes them once stale
+	Ephemeral = "ephemeral"
+
+	// EncryptionType is the additional property holding the encryption
+	// type applied by an encryption operation
+	EncryptionType = "encryption_type"
+
+	// DefaultCiliumVersion is the chart version offered for install
+	// when no other version is requested
+	DefaultCiliumVersion = "1.11.0"
+
+	// DefaultTetragonVersion is the Tetragon chart version offered for install
+	DefaultTetragonVersion = "0.8.3"
+
+	// Operations is the set of operations supported by the adapter
+	Operations = getOperations(common.Operations)
 )
+
+func getOperations(dev adapter.Operations) adapter.Operations {
+	dev[CiliumOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_INSTALL),
+		Description: "Cilium Service Mesh",
+		Versions:    []adapter.Version{adapter.Version(DefaultCiliumVersion)},
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumSecurityReportOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "ServiceAccount and credential hygiene report",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumWireguardEncryptionOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Transparent encryption with WireGuard",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			EncryptionType: "wireguard",
+			Disruptive:     "true",
+		},
+	}
+
+	dev[CiliumIPsecEncryptionOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Transparent encryption with IPsec",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			EncryptionType: "ipsec",
+			Disruptive:     "true",
+		},
+	}
+
+	dev[CiliumKubeProxyReplacementOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "eBPF kube-proxy replacement",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumCRDUpgradeOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Upgrade Cilium CRDs",
+		Versions:    []adapter.Version{adapter.Version(DefaultCiliumVersion)},
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumEgressGatewayOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Egress gateway",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumTrafficMirrorOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CUSTOM),
+		Description: "Mirror service traffic to a debug sink",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumEgressIPReportOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Egress IP usage report",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumPolicyTestOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Test network policies",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Ephemeral: "true",
+		},
+	}
+
+	dev[CiliumSelfTestOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Adapter self-test",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumGrafanaDashboardsOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Grafana dashboards for enabled features",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumHubbleUIOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Expose Hubble UI",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumHubbleRelayOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Hubble Relay with TLS",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumConnectivityTestOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Cilium connectivity test",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Ephemeral: "true",
+		},
+	}
+
+	dev[CiliumVisibilityAnnotationOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "L7 visibility annotations",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumBandwidthAnnotationOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Bandwidth limit annotations",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumStatusOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Cilium status",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumCancelOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CUSTOM),
+		Description: "Cancel running operations",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumCleanupOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Clean up test resources",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumPolicyLintOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Lint network policies against best practices",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumNodeHealthOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "Per-node endpoint and agent health",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumHubbleExportOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Export Hubble flows",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumHubbleMetricsOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Hubble metrics",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumMonitoringOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Prometheus ServiceMonitors and Grafana dashboards",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumPolicyRecommendationOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CUSTOM),
+		Description: "Recommend policies from observed flows",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumEnvoyConfigOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Envoy L7 proxy and load balancing",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumMutualAuthOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Mutual authentication with SPIRE",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumBGPControlPlaneOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "BGP control plane",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumBandwidthManagerOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Bandwidth manager and BBR",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumHostFirewallOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Host firewall",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumLocalRedirectPolicyOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Local redirect policies",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumDualStackOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "IPv4/IPv6 dual-stack",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumUpgradeOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Rolling upgrade of Cilium",
+		Versions:    []adapter.Version{adapter.Version(DefaultCiliumVersion)},
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[CiliumPerformanceTestOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_VALIDATE),
+		Description: "SMP performance test",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumExportOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CUSTOM),
+		Description: "Export the Cilium configuration",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+	}
+
+	dev[CiliumReconcileOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_CONFIGURE),
+		Description: "Reconcile Cilium configuration",
+		Versions:    adapter.NoneVersion,
+		Templates:   adapter.NoneTemplate,
+		AdditionalProperties: map[string]string{
+			Disruptive: "true",
+		},
+	}
+
+	dev[TetragonOperation] = &adapter.Operation{
+		Type:        int32(meshes.OpCategory_INSTALL),
+		Description: "Tetragon runtime security",
+		Versions:    []adapter.Version{adapter.Version(DefaultTetragonVersion)},
+		Templates:   adapter.NoneTemplate,
+	}
+
+	return dev
+}
+
+// EphemeralOperation reports whether op deploys test resources: the sample
+// applications and the operations marked Ephemeral
+func EphemeralOperation(op *adapter.Operation) bool {
+	return op.Type == int32(meshes.OpCategory_SAMPLE_APPLICATION) || op.AdditionalProperties[Ephemeral] == "true"
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// PipelinesKey is the config key holding the pipeline definitions
+	PipelinesKey = "pipelines"
+
+	// PipelineOperationType is the additional property marking an
+	// operation as a pipeline
+	PipelineOperationType = "pipeline"
+
+	// OperationType is the additional property holding the kind of an operation
+	OperationType = "operation_type"
+
+	pipelinesFile = "pipelines.yaml"
+)
+
+// PipelineStep is a single operation run as part of a pipeline
+type PipelineStep struct {
+	// Operation is the name of the operation to run
+	Operation string `json:"operation" yaml:"operation"`
+	// Delete runs the revert of the operation
+	Delete bool `json:"delete,omitempty" yaml:"delete,omitempty"`
+	// Properties override the additional properties of the operation
+	Properties map[string]string `json:"properties,omitempty" yaml:"properties,omitempty"`
+	// WaitFor names a DaemonSet, as namespace/name, which has to be rolled
+	// out before the next step starts
+	WaitFor string `json:"waitFor,omitempty" yaml:"waitFor,omitempty"`
+	// ContinueOnError lets the pipeline go on when the step fails
+	ContinueOnError bool `json:"continueOnError,omitempty" yaml:"continueOnError,omitempty"`
+}
+
+// Pipeline is an ordered list of operations run as a single operation
+type Pipeline struct {
+	Description string         `json:"description" yaml:"description"`
+	Steps       []PipelineStep `json:"steps" yaml:"steps"`
+}
+
+// Pipelines maps the pipeline names to their definitions
+type Pipelines map[string]Pipeline
+
+// DefaultPipelines are the pipelines shipped with the adapter
+var DefaultPipelines = Pipelines{
+	"cilium_secure_install": {
+		Description: "Cilium with WireGuard encryption and Tetragon",
+		Steps: []PipelineStep{
+			{Operation: CiliumOperation, WaitFor: "kube-system/cilium"},
+			{Operation: CiliumWireguardEncryptionOperation},
+			{Operation: TetragonOperation},
+			{Operation: CiliumSecurityReportOperation, ContinueOnError: true},
+		},
+	},
+}
+
+// LoadPipelines returns the default pipelines along with the ones defined
+// in the pipelines file, which is read from PIPELINES_FILE or from the
+// adapter config directory. Pipelines from the file replace the defaults
+// of the same name.
+func LoadPipelines(ops adapter.Operations) (Pipelines, error) {
+	pipelines := Pipelines{}
+	for name, p := range DefaultPipelines {
+		pipelines[name] = p
+	}
+
+	path := envOrDefault("PIPELINES_FILE", filepath.Join(configRootPath, pipelinesFile))
+	byt, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, ErrLoadPipelines(err)
+	}
+	if err == nil {
+		custom := Pipelines{}
+		if err := yaml.Unmarshal(byt, &custom); err != nil {
+			return nil, ErrLoadPipelines(err)
+		}
+		for name, p := range custom {
+			pipelines[name] = p
+		}
+	}
+
+	for name, p := range pipelines {
+		if err := p.validate(ops); err != nil {
+			return nil, ErrLoadPipelines(fmt.Errorf("pipeline %q: %s", name, err))
+		}
+	}
+	return pipelines, nil
+}
+
+// validate checks that every step refers to a known operation which is
+// not a pipeline itself
+func (p Pipeline) validate(ops adapter.Operations) error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("no steps defined")
+	}
+	for i, step := range p.Steps {
+		op, ok := ops[step.Operation]
+		if !ok {
+			return fmt.Errorf("step %d: unknown operation %q", i+1, step.Operation)
+		}
+		if op.AdditionalProperties[OperationType] == PipelineOperationType {
+			return fmt.Errorf("step %d: pipelines cannot be nested", i+1)
+		}
+	}
+	return nil
+}
+
+// addPipelineOperations exposes every pipeline as an operation
+func addPipelineOperations(ops adapter.Operations, pipelines Pipelines) {
+	for name, p := range pipelines {
+		ops[name] = &adapter.Operation{
+			Type:        int32(meshes.OpCategory_CUSTOM),
+			Description: p.Description,
+			Versions:    adapter.NoneVersion,
+			Templates:   adapter.NoneTemplate,
+			AdditionalProperties: map[string]string{
+				OperationType: PipelineOperationType,
+			},
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig are the proxies the outbound requests of the adapter go
+// through, the registration with Meshery and the downloads of the charts
+// and manifests the components are generated from. They are read from the
+// config file and default to HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+type ProxyConfig struct {
+	// HTTPProxy is the proxy of the plain HTTP requests
+	HTTPProxy string
+	// HTTPSProxy is the proxy of the HTTPS requests
+	HTTPSProxy string
+	// NoProxy lists the hosts, domains and CIDRs reached directly
+	NoProxy string
+}
+
+// Validate checks that the proxies are valid URLs
+func (p ProxyConfig) Validate() error {
+	for _, raw := range []string{p.HTTPProxy, p.HTTPSProxy} {
+		if raw == "" {
+			continue
+		}
+		// The scheme defaults to http as with the environment variables
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			if u, err = url.Parse("http://" + raw); err != nil || u.Host == "" {
+				return ErrProxyConfig(fmt.Errorf("invalid proxy address %q", raw))
+			}
+		}
+	}
+	return nil
+}
+
+// ProxyFunc returns the proxy selection of an http.Transport, requests to
+// localhost are never proxied
+func (p ProxyConfig) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	cfg := &httpproxy.Config{
+		HTTPProxy:  p.HTTPProxy,
+		HTTPSProxy: p.HTTPSProxy,
+		NoProxy:    p.NoProxy,
+	}
+	proxy := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+var (
+	defaultProxy     atomic.Value
+	defaultProxyOnce sync.Once
+)
+
+// UseProxy routes the requests made with the default transport, those of
+// the component generation among others, through the proxies of p. It is
+// called again when the settings change.
+func UseProxy(p ProxyConfig) {
+	defaultProxy.Store(p.ProxyFunc())
+	defaultProxyOnce.Do(func() {
+		if t, ok := http.DefaultTransport.(*http.Transport); ok {
+			t.Proxy = func(req *http.Request) (*url.URL, error) {
+				return defaultProxy.Load().(func(*http.Request) (*url.URL, error))(req)
+			}
+		}
+	})
+}
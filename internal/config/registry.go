@@ -0,0 +1,13 @@
+package config
+
+// RegistryAuth are the credentials of the OCI registry the chart the
+// components are generated from is pulled from, when COMP_GEN_URL is an
+// oci:// reference. The registry is reached anonymously without them.
+type RegistryAuth struct {
+	// Username and Password are presented to the token service of the
+	// registry, or to the registry itself with basic authentication
+	Username string
+	Password string
+	// PlainHTTP reaches the registry over HTTP, for local mirrors
+	PlainHTTP bool
+}
@@ -23,11 +23,12 @@ import (
 
 // Release is used to save the release informations
 type Release struct {
-	ID      int             `json:"id,omitempty"`
-	TagName string          `json:"tag_name,omitempty"`
-	Name    adapter.Version `json:"name,omitempty"`
-	Draft   bool            `json:"draft,omitempty"`
-	Assets  []*Asset        `json:"assets,omitempty"`
+	ID         int             `json:"id,omitempty"`
+	TagName    string          `json:"tag_name,omitempty"`
+	Name       adapter.Version `json:"name,omitempty"`
+	Draft      bool            `json:"draft,omitempty"`
+	Prerelease bool            `json:"prerelease,omitempty"`
+	Assets     []*Asset        `json:"assets,omitempty"`
 }
 
 // Asset describes the github release asset object
@@ -0,0 +1,34 @@
+package config
+
+import "strconv"
+
+// DefaultSchemaMaxBytes keeps the schemas well below the request size
+// limits of the Meshery servers and of the proxies in front of them
+const DefaultSchemaMaxBytes = 4 << 20
+
+// SchemaLimits bound the schemas of the components registered with the
+// Meshery server. The OpenAPI schemas generated from some Cilium CRDs are
+// large enough to be rejected, mostly because of their descriptions.
+type SchemaLimits struct {
+	// MaxBytes is the size of a schema once pruned above which its
+	// component isn't registered, zero disables the limit
+	MaxBytes int
+	// MaxDescriptionBytes prunes the descriptions longer than it from the
+	// schemas, zero keeps every description
+	MaxDescriptionBytes int
+	// Gzip compresses the bodies of the requests to the Meshery server,
+	// which has to accept the gzip content encoding
+	Gzip bool
+}
+
+func parseSchemaLimits(raw map[string]string) SchemaLimits {
+	limits := SchemaLimits{MaxBytes: DefaultSchemaMaxBytes}
+	if n, err := strconv.Atoi(raw["schemamaxbytes"]); err == nil && n >= 0 {
+		limits.MaxBytes = n
+	}
+	if n, err := strconv.Atoi(raw["schemamaxdescription"]); err == nil && n >= 0 {
+		limits.MaxDescriptionBytes = n
+	}
+	limits.Gzip, _ = strconv.ParseBool(raw["gzip"])
+	return limits
+}
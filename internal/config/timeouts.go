@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/config"
+	"github.com/layer5io/meshery-adapter-library/meshes"
+)
+
+const (
+	// TimeoutsKey is the config key holding how long the operations may
+	// run before they are cancelled
+	TimeoutsKey = "operation-timeouts"
+
+	defaultOperationTimeout = 30 * time.Minute
+)
+
+// TimeoutsConfig bounds the time the operations run, per operation and per
+// category of operations. Zero lets an operation run until it completes.
+type TimeoutsConfig struct {
+	// Default bounds the operations without a timeout of their own
+	Default time.Duration
+	// Timeouts are the timeouts by operation name or by category, e.g.
+	// cilium_connectivity_test, oam for the OAM requests or install
+	Timeouts map[string]time.Duration
+}
+
+// For returns the timeout of an operation, the timeout of the operation
+// takes precedence over the timeout of its category
+func (c TimeoutsConfig) For(name string, op *adapter.Operation) time.Duration {
+	if timeout, ok := c.Timeouts[name]; ok {
+		return timeout
+	}
+	if timeout, ok := c.Timeouts[OperationCategory(op)]; ok {
+		return timeout
+	}
+	return c.Default
+}
+
+// OperationCategory returns the category of op the way it is named in the
+// timeouts, e.g. install or sample_application
+func OperationCategory(op *adapter.Operation) string {
+	return strings.ToLower(meshes.OpCategory_name[op.Type])
+}
+
+func timeoutsDefaults() map[string]string {
+	return map[string]string{
+		"default":  envOrDefault("OPERATION_TIMEOUT", defaultOperationTimeout.String()),
+		"timeouts": envOrDefault("OPERATION_TIMEOUTS", ""),
+	}
+}
+
+// Timeouts returns the timeouts of the operations stored in the config
+// handler, the timeouts are comma separated name=duration pairs
+func Timeouts(h config.Handler) (TimeoutsConfig, error) {
+	raw := map[string]string{}
+	if err := h.GetObject(TimeoutsKey, &raw); err != nil {
+		return TimeoutsConfig{}, err
+	}
+
+	cfg := TimeoutsConfig{Default: defaultOperationTimeout, Timeouts: map[string]time.Duration{}}
+	if raw["default"] != "" {
+		timeout, err := time.ParseDuration(raw["default"])
+		if err != nil || timeout < 0 {
+			return TimeoutsConfig{}, ErrTimeoutsConfig(fmt.Errorf("invalid default timeout %q", raw["default"]))
+		}
+		cfg.Default = timeout
+	}
+	for _, pair := range strings.Split(raw["timeouts"], ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return TimeoutsConfig{}, ErrTimeoutsConfig(fmt.Errorf("%q is not a name=duration pair", pair))
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || timeout < 0 {
+			return TimeoutsConfig{}, ErrTimeoutsConfig(fmt.Errorf("invalid timeout %q of %s", parts[1], parts[0]))
+		}
+		cfg.Timeouts[strings.ToLower(strings.TrimSpace(parts[0]))] = timeout
+	}
+	return cfg, nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+	configprovider "github.com/layer5io/meshkit/config/provider"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultWatchInterval is the interval at which the config file is checked
+// for changes
+const DefaultWatchInterval = 10 * time.Second
+
+// ReloadableKeys are the config keys whose settings are applied without
+// restarting the adapter when they are edited in the config file
+var ReloadableKeys = []string{MesheryServerKey}
+
+// Watcher picks up the edits of the config file. The settings the adapter
+// starts with override those of the file in the config handler, the
+// changed sections are stored back in the handler before being reported.
+type Watcher struct {
+	path     string
+	handler  config.Handler
+	keys     []string
+	interval time.Duration
+	applied  map[string]map[string]string
+}
+
+// NewWatcher creates a Watcher of the sections keys of the config file
+// backing h
+func NewWatcher(h config.Handler, keys []string, interval time.Duration) *Watcher {
+	return &Watcher{
+		path:     filepath.Join(configRootPath, ProviderConfigDefaults[configprovider.FileName]+"."+ProviderConfigDefaults[configprovider.FileType]),
+		handler:  h,
+		keys:     keys,
+		interval: interval,
+		applied:  map[string]map[string]string{},
+	}
+}
+
+// Watch checks the config file at every interval until ctx is done and
+// calls onChange with the keys whose settings changed, or onError when
+// the file can't be applied
+func (w *Watcher) Watch(ctx context.Context, onChange func(keys []string), onError func(error)) {
+	// The current settings are the baseline the edits are compared with
+	for _, key := range w.keys {
+		raw := map[string]string{}
+		if err := w.handler.GetObject(key, &raw); err == nil {
+			w.applied[key] = raw
+		}
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := w.check()
+		if err != nil {
+			onError(err)
+			continue
+		}
+		if len(changed) > 0 {
+			onChange(changed)
+		}
+	}
+}
+
+// check reads the config file and stores the changed sections
+func (w *Watcher) check() ([]string, error) {
+	// #nosec
+	byt, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, ErrReloadConfig(err)
+	}
+	file := map[string]map[string]interface{}{}
+	if err := yaml.Unmarshal(byt, &file); err != nil {
+		return nil, ErrReloadConfig(err)
+	}
+
+	var changed []string
+	for _, key := range w.keys {
+		section, ok := file[key]
+		if !ok {
+			continue
+		}
+		raw := make(map[string]string, len(section))
+		for k, v := range section {
+			raw[k] = fmt.Sprint(v)
+		}
+		if reflect.DeepEqual(raw, w.applied[key]) {
+			continue
+		}
+		if err := w.handler.SetObject(key, raw); err != nil {
+			return changed, ErrReloadConfig(err)
+		}
+		w.applied[key] = raw
+		changed = append(changed, key)
+	}
+	return changed, nil
+}
@@ -0,0 +1,235 @@
+// Package discovery finds the addresses of the Meshery servers the adapter
+// registers with, beyond the address set by MESHERY_SERVER: through the
+// DNS records or the labels of their Kubernetes Services and through the
+// current context of mesheryctl.
+//
+// The Meshery broker deployed by mesheryctl is not a source: it relays the
+// events of the Meshery operator and doesn't publish the address of the
+// servers. mesheryctl records the address of the server it deployed the
+// broker for in its current context instead, which is the source used
+// when the adapter runs next to mesheryctl.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultAddress is the address of a Meshery server running next to the
+// adapter, used when nothing is discovered
+const DefaultAddress = "http://localhost:9081"
+
+const (
+	defaultPort      = "9081"
+	namespaceFile    = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	defaultNamespace = "meshery"
+)
+
+// Options are the sources the addresses are discovered from, in the order
+// of preference of the addresses
+type Options struct {
+	// Addresses are set explicitly
+	Addresses []string
+	// DNSName is a host, optionally with a port, whose records each give
+	// the address of a server, e.g. the name of a headless Service
+	DNSName string
+	// Selector selects the Services of the servers in Namespace, the
+	// namespace of the adapter when empty
+	Selector  string
+	Namespace string
+	// MesheryctlConfig is the config file of mesheryctl whose current
+	// context gives the address of a server
+	MesheryctlConfig string
+}
+
+// Discover returns the addresses of the Meshery servers found in the
+// sources of opts, DefaultAddress when none is found. The sources which
+// can't be read are reported along with the addresses found in the others.
+func Discover(ctx context.Context, opts Options) ([]string, error) {
+	var addrs []string
+	var errs []string
+
+	for _, addr := range opts.Addresses {
+		addrs = appendAddress(addrs, Normalize(addr))
+	}
+	if opts.DNSName != "" {
+		found, err := lookupDNS(ctx, opts.DNSName)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, addr := range found {
+			addrs = appendAddress(addrs, addr)
+		}
+	}
+	if opts.Selector != "" {
+		found, err := lookupServices(ctx, opts.Selector, opts.Namespace)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, addr := range found {
+			addrs = appendAddress(addrs, addr)
+		}
+	}
+	if opts.MesheryctlConfig != "" {
+		addr, err := mesheryctlEndpoint(opts.MesheryctlConfig)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if addr != "" {
+			addrs = appendAddress(addrs, addr)
+		}
+	}
+
+	if len(addrs) == 0 {
+		addrs = []string{DefaultAddress}
+	}
+	if len(errs) > 0 {
+		return addrs, ErrDiscover(fmt.Errorf("%s", strings.Join(errs, "; ")))
+	}
+	return addrs, nil
+}
+
+// Normalize prefixes an address without scheme with http://
+func Normalize(addr string) string {
+	addr = strings.TrimSuffix(strings.TrimSpace(addr), "/")
+	if addr == "" || strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return addr
+	}
+	return "http://" + addr
+}
+
+// DefaultMesheryctlConfig returns the path of the config file of mesheryctl
+func DefaultMesheryctlConfig() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".meshery", "config.yaml")
+}
+
+func appendAddress(addrs []string, addr string) []string {
+	if addr == "" {
+		return addrs
+	}
+	for _, cur := range addrs {
+		if cur == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
+
+// lookupDNS resolves name to an address per record, the port defaults to
+// the port of Meshery
+func lookupDNS(ctx context.Context, name string) ([]string, error) {
+	scheme := "http"
+	if strings.HasPrefix(name, "https://") {
+		scheme = "https"
+	}
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "http://"), "https://")
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		host, port = name, defaultPort
+	}
+
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(ip, port)))
+	}
+	return addrs, nil
+}
+
+// lookupServices returns the cluster DNS address of every Service matching
+// selector, the adapter has to run in the cluster
+func lookupServices(ctx context.Context, selector, namespace string) ([]string, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		namespace = defaultNamespace
+		// #nosec
+		if byt, err := ioutil.ReadFile(namespaceFile); err == nil {
+			namespace = strings.TrimSpace(string(byt))
+		}
+	}
+
+	svcs, err := client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(svcs.Items))
+	for _, svc := range svcs.Items {
+		port, scheme, ok := servicePort(svc)
+		if !ok {
+			continue
+		}
+		addrs = append(addrs, fmt.Sprintf("%s://%s.%s.svc:%d", scheme, svc.Name, svc.Namespace, port))
+	}
+	return addrs, nil
+}
+
+// servicePort picks the port of the HTTP API of Meshery, the port named
+// http or https, or the only port of the Service
+func servicePort(svc corev1.Service) (int32, string, bool) {
+	for _, p := range svc.Spec.Ports {
+		if p.Name == "http" || p.Name == "https" {
+			return p.Port, p.Name, true
+		}
+	}
+	if len(svc.Spec.Ports) == 1 {
+		return svc.Spec.Ports[0].Port, "http", true
+	}
+	return 0, "", false
+}
+
+// mesheryctlConfig is the part of the config file of mesheryctl holding
+// the address of the server of the current context
+type mesheryctlConfig struct {
+	CurrentContext string `json:"current-context"`
+	Contexts       map[string]struct {
+		Endpoint string `json:"endpoint"`
+	} `json:"contexts"`
+}
+
+// mesheryctlEndpoint returns the endpoint of the current context of the
+// mesheryctl config file at path, an absent file is not an error
+func mesheryctlEndpoint(path string) (string, error) {
+	// #nosec
+	byt, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	cfg := mesheryctlConfig{}
+	if err := yaml.Unmarshal(byt, &cfg); err != nil {
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+	ctx, ok := cfg.Contexts[cfg.CurrentContext]
+	if !ok {
+		return "", nil
+	}
+	return Normalize(ctx.Endpoint), nil
+}
@@ -0,0 +1,16 @@
+package discovery
+
+import (
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrDiscoverCode represents the errors which are generated while
+	// discovering the addresses of the Meshery servers
+	ErrDiscoverCode = "1074"
+)
+
+// ErrDiscover is the error while discovering the Meshery servers
+func ErrDiscover(err error) error {
+	return errors.New(ErrDiscoverCode, errors.Alert, []string{"Error discovering the Meshery servers"}, []string{err.Error()}, []string{"The DNS name of the Meshery server does not resolve", "The adapter is not allowed to list the Services of the Meshery namespace", "The mesheryctl config file is not valid YAML"}, []string{"Verify the MESHERY_SERVER_DNS, MESHERY_SERVER_SELECTOR and MESHERYCTL_CONFIG settings of the adapter"})
+}
@@ -0,0 +1,44 @@
+//go:build e2e
+// +build e2e
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestRun installs Cilium on a kind cluster, or on the cluster of
+// E2E_KUBECONFIG, and runs the self-test. It requires kind and docker:
+//
+//	make e2e
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Minute)
+	defer cancel()
+
+	opts := Options{
+		NodeImage: os.Getenv("E2E_NODE_IMAGE"),
+		Keep:      os.Getenv("E2E_KEEP") == "true",
+	}
+	if path := os.Getenv("E2E_KUBECONFIG"); path != "" {
+		kubeconfig, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.Kubeconfig = kubeconfig
+	}
+
+	res, err := Run(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byt, _ := json.MarshalIndent(res, "", "  ")
+	t.Log(string(byt))
+	if res.Failed() {
+		t.Fatal("operations of the run failed")
+	}
+}
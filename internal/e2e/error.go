@@ -0,0 +1,25 @@
+package e2e
+
+import (
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrKindCode represents the errors which are generated while managing
+	// the kind cluster of the integration tests
+	ErrKindCode = "1068"
+
+	// ErrSetupCode represents the errors which are generated while setting
+	// up the adapter handler under test
+	ErrSetupCode = "1069"
+)
+
+// ErrKind is the error while managing the kind cluster
+func ErrKind(err error) error {
+	return errors.New(ErrKindCode, errors.Alert, []string{"Error managing kind cluster"}, []string{err.Error()}, []string{"The kind CLI is not installed", "Docker is not running"}, []string{"Install kind and make sure Docker is running"})
+}
+
+// ErrSetup is the error while setting up the adapter handler under test
+func ErrSetup(err error) error {
+	return errors.New(ErrSetupCode, errors.Alert, []string{"Error setting up the adapter under test"}, []string{err.Error()}, []string{"The kubeconfig of the cluster is not valid"}, []string{"Verify the cluster is reachable with the kubeconfig"})
+}
@@ -0,0 +1,174 @@
+// Package e2e runs the adapter handler against a real cluster: a kind
+// cluster is created, Cilium is installed through the install operation and
+// the operations under test are run through the same code paths Meshery
+// invokes. A test suite calls Run and fails on the failed steps:
+//
+//	res, err := e2e.Run(ctx, e2e.Options{})
+//	if err != nil || res.Failed() { t.Fatal(err, res) }
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-cilium/cilium"
+	"github.com/layer5io/meshery-cilium/internal/config"
+	configprovider "github.com/layer5io/meshkit/config/provider"
+	"github.com/layer5io/meshkit/logger"
+)
+
+const defaultClusterName = "meshery-cilium-e2e"
+
+// Options configure an integration run
+type Options struct {
+	// ClusterName is the name of the kind cluster created for the run
+	ClusterName string
+	// NodeImage is the kind node image, the default of kind when empty
+	NodeImage string
+	// Kubeconfig selects an existing cluster instead of creating one
+	Kubeconfig []byte
+	// Keep leaves the created cluster in place after the run
+	Keep bool
+	// Operations are run in order once Cilium is installed, the self-test
+	// when empty
+	Operations []adapter.OperationRequest
+	// Log receives the progress of the run, a debug logger when nil
+	Log logger.Handler
+}
+
+// StepResult is the outcome of an operation of the run
+type StepResult struct {
+	Operation string `json:"operation"`
+	Summary   string `json:"summary"`
+	Details   string `json:"details,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// Result is the outcome of an integration run
+type Result struct {
+	Steps []StepResult `json:"steps"`
+}
+
+// Failed reports whether an operation of the run failed
+func (r *Result) Failed() bool {
+	for _, s := range r.Steps {
+		if s.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Run installs Cilium on the cluster of the run and runs the operations
+// under test. The install failing stops the run, the other operations all
+// run and their failures are reported in the result.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	log := opts.Log
+	if log == nil {
+		var err error
+		if log, err = logger.New("cilium-e2e", logger.Options{Format: logger.SyslogLogFormat, DebugLevel: true}); err != nil {
+			return nil, ErrSetup(err)
+		}
+	}
+
+	kubeconfig := opts.Kubeconfig
+	if len(kubeconfig) == 0 {
+		cluster := &kindCluster{name: opts.ClusterName, nodeImage: opts.NodeImage}
+		if cluster.name == "" {
+			cluster.name = defaultClusterName
+		}
+		log.Info("Creating kind cluster ", cluster.name)
+		if err := cluster.create(ctx); err != nil {
+			return nil, err
+		}
+		if !opts.Keep {
+			defer func() {
+				log.Info("Deleting kind cluster ", cluster.name)
+				if err := cluster.delete(context.Background()); err != nil {
+					log.Error(err)
+				}
+			}()
+		}
+		var err error
+		if kubeconfig, err = cluster.kubeconfig(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	handler, err := newHandler(log, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	install := res.run(handler, adapter.OperationRequest{
+		OperationName: config.CiliumOperation,
+		Namespace:     "kube-system",
+	})
+	if install.Error != "" {
+		return res, nil
+	}
+
+	ops := opts.Operations
+	if len(ops) == 0 {
+		ops = []adapter.OperationRequest{{OperationName: config.CiliumSelfTestOperation}}
+	}
+	for _, op := range ops {
+		res.run(handler, op)
+	}
+	return res, nil
+}
+
+// newHandler builds the adapter handler as main does, with in-memory
+// configuration, connected to the cluster of kubeconfig
+func newHandler(log logger.Handler, kubeconfig []byte) (*cilium.Handler, error) {
+	cfg, err := config.New(configprovider.InMemKey)
+	if err != nil {
+		return nil, ErrSetup(err)
+	}
+	kc, err := config.NewKubeconfigBuilder(configprovider.InMemKey)
+	if err != nil {
+		return nil, ErrSetup(err)
+	}
+	handler, ok := cilium.New(cfg, log, kc, nil, nil, nil).(*cilium.Handler)
+	if !ok {
+		return nil, ErrSetup(fmt.Errorf("unexpected handler type"))
+	}
+
+	// The events of the operations are logged as Meshery would show them
+	ch := make(chan interface{}, 100)
+	go func() {
+		for e := range ch {
+			if event, ok := e.(*adapter.Event); ok {
+				log.Info(fmt.Sprintf("event %s: %s", event.Operationid, event.Summary))
+			}
+		}
+	}()
+	if err := handler.CreateInstance(kubeconfig, "", &ch); err != nil {
+		return nil, ErrSetup(err)
+	}
+	return handler, nil
+}
+
+// run runs a single operation and records its outcome
+func (r *Result) run(h *cilium.Handler, request adapter.OperationRequest) StepResult {
+	if request.OperationID == "" {
+		request.OperationID = fmt.Sprintf("e2e-%s-%d", request.OperationName, len(r.Steps))
+	}
+	start := time.Now()
+	summary, details, err := h.RunOperation(request)
+	step := StepResult{
+		Operation: request.OperationName,
+		Summary:   summary,
+		Details:   details,
+		Duration:  time.Since(start).Round(time.Second).String(),
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	r.Steps = append(r.Steps, step)
+	return step
+}
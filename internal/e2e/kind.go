@@ -0,0 +1,58 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// kindConfig disables the default CNI of kind so that Cilium provides the
+// pod network, a worker is added for the connections across nodes
+const kindConfig = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+networking:
+  disableDefaultCNI: true
+nodes:
+- role: control-plane
+- role: worker
+`
+
+// kindCluster is a throwaway cluster run by the kind CLI
+type kindCluster struct {
+	name      string
+	nodeImage string
+}
+
+func (c *kindCluster) create(ctx context.Context) error {
+	args := []string{"create", "cluster", "--name", c.name, "--config", "-", "--wait", "0s"}
+	if c.nodeImage != "" {
+		args = append(args, "--image", c.nodeImage)
+	}
+	_, err := kind(ctx, kindConfig, args...)
+	return err
+}
+
+func (c *kindCluster) delete(ctx context.Context) error {
+	_, err := kind(ctx, "", "delete", "cluster", "--name", c.name)
+	return err
+}
+
+func (c *kindCluster) kubeconfig(ctx context.Context) ([]byte, error) {
+	out, err := kind(ctx, "", "get", "kubeconfig", "--name", c.name)
+	return []byte(out), err
+}
+
+// kind runs the kind CLI with stdin as its standard input
+func kind(ctx context.Context, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "kind", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", ErrKind(fmt.Errorf("kind %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String())))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,106 @@
+// Package events buffers the events of the operations when the adapter runs
+// standalone, without a Meshery server streaming them, and serves them over
+// HTTP.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Path is the path under which the buffered events are served
+const Path = "/events"
+
+// Entry is a buffered event along with its position in the stream
+type Entry struct {
+	Seq        uint64      `json:"seq"`
+	ReceivedAt time.Time   `json:"receivedAt"`
+	Event      interface{} `json:"event"`
+}
+
+// Buffer keeps the latest events received on a channel, the oldest ones
+// are dropped once it is full
+type Buffer struct {
+	mu      sync.RWMutex
+	entries []Entry
+	size    int
+	seq     uint64
+}
+
+// NewBuffer creates a Buffer holding at most size events
+func NewBuffer(size int) *Buffer {
+	return &Buffer{size: size}
+}
+
+// Drain buffers the events received on ch until it is closed
+func (b *Buffer) Drain(ch <-chan interface{}) {
+	for e := range ch {
+		b.add(e)
+	}
+}
+
+func (b *Buffer) add(e interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	b.entries = append(b.entries, Entry{Seq: b.seq, ReceivedAt: time.Now(), Event: e})
+	if len(b.entries) > b.size {
+		b.entries = b.entries[len(b.entries)-b.size:]
+	}
+}
+
+// Since returns the buffered events which follow the event seq
+func (b *Buffer) Since(seq uint64) []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res := []Entry{}
+	for _, e := range b.entries {
+		if e.Seq > seq {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// ServeHTTP serves the buffered events, the since query parameter skips
+// the events already received by the client
+func (b *Buffer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since uint64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if since, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			http.Error(w, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(b.Since(since))
+}
+
+// flushInterval is the interval at which Flush checks for pending events
+const flushInterval = 100 * time.Millisecond
+
+// Flush waits for the events pending on ch to be consumed, by the event
+// streams of Meshery or by a Buffer, or for ctx to be done
+func Flush(ctx context.Context, ch chan interface{}) error {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for len(ch) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
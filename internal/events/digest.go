@@ -0,0 +1,200 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+)
+
+// The categories of the repetitive events the digest mode coalesces
+const (
+	// CategoryRegistration are the failed attempts to register the
+	// capabilities with Meshery
+	CategoryRegistration = "registration"
+	// CategoryUpgrade are the announcements of a newer Cilium version or
+	// adapter, repeated after every registration
+	CategoryUpgrade = "upgrade"
+	// CategoryDeferral are the operations waiting for another adapter
+	CategoryDeferral = "deferral"
+	// CategoryReload are the reloads of the config file
+	CategoryReload = "reload"
+	// CategoryTrafficMirror are the expirations of traffic mirrors
+	CategoryTrafficMirror = "traffic-mirror"
+)
+
+// RegistrationRetrySummary prefixes the summary of the events streamed
+// when a registration is retried
+const RegistrationRetrySummary = "Registration retry: "
+
+// errorEventType is the type of the events streamed with StreamErr
+const errorEventType = int32(SeverityError)
+
+// categories tell the category of an event from its summary
+var categories = []struct {
+	name  string
+	match func(summary string) bool
+}{
+	{CategoryRegistration, func(s string) bool { return strings.HasPrefix(s, RegistrationRetrySummary) }},
+	{CategoryUpgrade, func(s string) bool { return strings.HasPrefix(s, "Cilium ") && strings.HasSuffix(s, " available") }},
+	{CategoryDeferral, func(s string) bool { return strings.HasPrefix(s, "Operation ") && strings.HasSuffix(s, " deferred") }},
+	{CategoryReload, func(s string) bool { return s == "Adapter configuration reloaded" }},
+	{CategoryTrafficMirror, func(s string) bool { return strings.HasPrefix(s, "Traffic mirror of ") }},
+}
+
+// Category returns the digest category of e, or "" when e is never
+// coalesced
+func Category(e *adapter.Event) string {
+	for _, c := range categories {
+		if c.match(e.Summary) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// window is a category whose events are being coalesced
+type window struct {
+	count  int
+	failed bool
+	last   *adapter.Event
+	timer  *time.Timer
+}
+
+// Digest coalesces the repetitive events into periodic summaries so that
+// the notification center of Meshery isn't flooded. The first event of a
+// category is forwarded as is and opens a window of the interval of the
+// category, the events of the category received during the window are
+// counted and streamed as a single summary when it ends. The events of
+// the other categories are forwarded right away.
+type Digest struct {
+	in        chan interface{}
+	out       chan<- interface{}
+	intervals map[string]time.Duration
+	windows   map[string]*window
+	expired   chan string
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewDigest creates a Digest forwarding the events to out, intervals are
+// the windows of the categories which are coalesced
+func NewDigest(out chan<- interface{}, intervals map[string]time.Duration) *Digest {
+	return &Digest{
+		in:        make(chan interface{}, cap(out)),
+		out:       out,
+		intervals: intervals,
+		windows:   map[string]*window{},
+		expired:   make(chan string),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Channel returns the channel the events are streamed to instead of out
+func (d *Digest) Channel() *chan interface{} {
+	return &d.in
+}
+
+// Run coalesces the events until the digest is stopped
+func (d *Digest) Run() {
+	defer close(d.done)
+	for {
+		select {
+		case e := <-d.in:
+			d.add(e)
+		case category := <-d.expired:
+			d.emit(category)
+		case <-d.stop:
+			for len(d.in) > 0 {
+				d.add(<-d.in)
+			}
+			for category := range d.windows {
+				d.emit(category)
+			}
+			return
+		}
+	}
+}
+
+// Stop streams the pending summaries and waits for them to be sent, or
+// for ctx to be done
+func (d *Digest) Stop(ctx context.Context) error {
+	close(d.stop)
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Digest) add(data interface{}) {
+	e, ok := data.(*adapter.Event)
+	if !ok {
+		d.out <- data
+		return
+	}
+	category := Category(e)
+	interval, ok := d.intervals[category]
+	if category == "" || !ok || interval <= 0 {
+		d.out <- e
+		return
+	}
+
+	if w, ok := d.windows[category]; ok {
+		w.count++
+		w.failed = w.failed || e.EType == errorEventType
+		w.last = e
+		return
+	}
+	d.out <- e
+	d.windows[category] = &window{
+		timer: time.AfterFunc(interval, func() {
+			select {
+			case d.expired <- category:
+			case <-d.done:
+			}
+		}),
+	}
+}
+
+// emit closes the window of category and streams its summary, unless no
+// event followed the one opening it
+func (d *Digest) emit(category string) {
+	w, ok := d.windows[category]
+	if !ok {
+		return
+	}
+	w.timer.Stop()
+	delete(d.windows, category)
+	if w.count == 0 {
+		return
+	}
+
+	e := &adapter.Event{
+		Summary: fmt.Sprintf("%d more %s events in the last %s", w.count, category, d.intervals[category]),
+		Details: fmt.Sprintf("Latest: %s. %s", w.last.Summary, w.last.Details),
+	}
+	if w.failed {
+		e.EType = errorEventType
+	}
+	d.out <- e
+}
+
+type digestHandler struct {
+	adapter.Handler
+	digest *Digest
+}
+
+// AddDigest wraps an adapter handler so that the events of the instances
+// Meshery creates are streamed through d
+func AddDigest(h adapter.Handler, d *Digest) adapter.Handler {
+	return &digestHandler{Handler: h, digest: d}
+}
+
+func (h *digestHandler) CreateInstance(b []byte, st string, _ *chan interface{}) error {
+	return h.Handler.CreateInstance(b, st, h.digest.Channel())
+}
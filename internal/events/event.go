@@ -0,0 +1,116 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	meshkiterrors "github.com/layer5io/meshkit/errors"
+)
+
+// Severity is how urgently Meshery shows an event, the values are the
+// event types of the MeshService
+type Severity int32
+
+// The severities of the events
+const (
+	SeverityInfo    Severity = 0
+	SeverityWarning Severity = 1
+	SeverityError   Severity = 2
+)
+
+// maxResources bounds the resources listed in the details of an event, a
+// custom manifest applies any number of them
+const maxResources = 20
+
+// Resource references a Kubernetes resource an event is about
+type Resource struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+func (r Resource) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// Event is an event of the adapter along with what Meshery shows to act
+// on it: the operation it belongs to, the resources it is about and the
+// hints to remediate it
+type Event struct {
+	Severity    Severity
+	OperationID string
+	Summary     string
+	Details     string
+	Resources   []Resource
+	// Cause defaults to the probable cause of the meshkit error Err, the
+	// remediation of Err follows the Remediation hints
+	Cause       []string
+	Remediation []string
+	Err         error
+}
+
+// Adapter returns the event streamed over the MeshService, the resources,
+// the cause and the remediation are appended to the details so that the
+// notification center of Meshery shows them
+func (e Event) Adapter() *adapter.Event {
+	cause, remediation := e.Cause, append([]string{}, e.Remediation...)
+	if e.Err != nil {
+		if len(cause) == 0 {
+			cause = nonEmpty(meshkiterrors.GetCause(e.Err))
+		}
+		remediation = append(remediation, nonEmpty(meshkiterrors.GetRemedy(e.Err))...)
+	}
+
+	details := []string{}
+	if e.Details != "" {
+		details = append(details, e.Details)
+	} else if e.Err != nil {
+		details = append(details, e.Err.Error())
+	}
+	if len(e.Resources) > 0 {
+		refs := make([]string, 0, maxResources+1)
+		for i, r := range e.Resources {
+			if i == maxResources {
+				refs = append(refs, fmt.Sprintf("and %d more", len(e.Resources)-maxResources))
+				break
+			}
+			refs = append(refs, r.String())
+		}
+		details = append(details, "Resources: "+strings.Join(refs, ", "))
+	}
+	if len(cause) > 0 {
+		details = append(details, "Probable cause: "+strings.Join(cause, "; "))
+	}
+	if len(remediation) > 0 {
+		details = append(details, "Suggested remediation: "+strings.Join(remediation, "; "))
+	}
+
+	return &adapter.Event{
+		Operationid: e.OperationID,
+		EType:       int32(e.Severity),
+		Summary:     e.Summary,
+		Details:     strings.Join(details, "\n"),
+	}
+}
+
+// Emit streams e to ch without blocking, the event is dropped when ch is
+// full. It reports whether the event was streamed.
+func Emit(ch chan<- interface{}, e Event) bool {
+	select {
+	case ch <- e.Adapter():
+		return true
+	default:
+		return false
+	}
+}
+
+func nonEmpty(s string) []string {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	return []string{s}
+}
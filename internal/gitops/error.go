@@ -0,0 +1,25 @@
+package gitops
+
+import (
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrExportCode represents the errors which are generated while
+	// exporting the applied manifests to the Git repository or directory
+	ErrExportCode = "1114"
+
+	// ErrGitCode represents the errors which are generated while running
+	// the git CLI
+	ErrGitCode = "1115"
+)
+
+// ErrExport is the error while exporting the applied manifests
+func ErrExport(err error) error {
+	return errors.New(ErrExportCode, errors.Alert, []string{"Error exporting the applied manifests"}, []string{err.Error()}, []string{"The export directory is not writable", "A file of the change is outside of the export directory"}, []string{"Verify GITOPS_DIR and GITOPS_PATH and the permissions of the directory"})
+}
+
+// ErrGit is the error while running the git CLI
+func ErrGit(err error) error {
+	return errors.New(ErrGitCode, errors.Alert, []string{"Error committing the applied manifests"}, []string{err.Error()}, []string{"The git CLI is not installed", "The repository is unreachable", "The credentials are not allowed to push to the branch"}, []string{"Install git in the adapter image", "Verify GITOPS_REPO_URL, GITOPS_USERNAME and GITOPS_TOKEN_FILE"})
+}
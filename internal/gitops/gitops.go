@@ -0,0 +1,199 @@
+// Package gitops exports the manifests applied by the operations of the
+// adapter, committed to a Git repository or written to a directory, so that
+// the changes made through Meshery are audited and can be reconciled by
+// ArgoCD or Flux afterwards.
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/meshery-cilium/internal/config"
+)
+
+// pushAttempts bounds the attempts to push a commit, another writer may
+// have pushed to the branch in the meantime
+const pushAttempts = 3
+
+// Change is what an operation applied to the cluster
+type Change struct {
+	// Message describes the change, it is the message of the commit
+	Message string
+	// Files are written, their paths are relative to the export directory
+	Files map[string][]byte
+	// Removed are the paths of the files deleted
+	Removed []string
+}
+
+// Exporter writes the changes to the directory or commits them to the
+// repository of its settings, one change at a time
+type Exporter struct {
+	cfg config.GitOpsConfig
+	// workdir is the clone of the repository
+	workdir string
+	mu      sync.Mutex
+}
+
+// New creates an Exporter, the repository is cloned into workdir
+func New(cfg config.GitOpsConfig, workdir string) *Exporter {
+	return &Exporter{cfg: cfg, workdir: workdir}
+}
+
+// Export writes the change and, for a repository, commits and pushes it.
+// Nothing is committed when the change leaves the files as they are.
+func (e *Exporter) Export(ctx context.Context, change Change) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	if e.cfg.RepoURL == "" {
+		return writeChange(filepath.Join(e.cfg.Dir, e.cfg.Path), change)
+	}
+
+	var err error
+	for attempt := 0; attempt < pushAttempts; attempt++ {
+		if err = e.commit(ctx, change); err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// commit writes the change on top of the remote branch and pushes it
+func (e *Exporter) commit(ctx context.Context, change Change) error {
+	if _, err := os.Stat(filepath.Join(e.workdir, ".git")); err != nil {
+		if err := os.RemoveAll(e.workdir); err != nil {
+			return ErrExport(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(e.workdir), 0750); err != nil {
+			return ErrExport(err)
+		}
+		if _, err := e.git(ctx, "", "clone", "--no-checkout", e.cfg.RepoURL, e.workdir); err != nil {
+			return err
+		}
+	}
+
+	if _, err := e.git(ctx, e.workdir, "fetch", "--prune", "origin"); err != nil {
+		return err
+	}
+	// The branch is created from the default branch when it doesn't exist
+	// yet, or without parent in an empty repository
+	checkout := []string{"checkout", "--force", "-B", e.cfg.Branch, "origin/" + e.cfg.Branch}
+	if _, err := e.git(ctx, e.workdir, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+e.cfg.Branch); err != nil {
+		checkout[len(checkout)-1] = "HEAD"
+		if _, err := e.git(ctx, e.workdir, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+			checkout = []string{"checkout", "--orphan", e.cfg.Branch}
+		}
+	}
+	if _, err := e.git(ctx, e.workdir, checkout...); err != nil {
+		return err
+	}
+	if _, err := e.git(ctx, e.workdir, "clean", "-fdx"); err != nil {
+		return err
+	}
+
+	if err := writeChange(filepath.Join(e.workdir, e.cfg.Path), change); err != nil {
+		return err
+	}
+	pathspec := e.cfg.Path
+	if pathspec == "" {
+		pathspec = "."
+	}
+	if _, err := e.git(ctx, e.workdir, "add", "--all", "--", pathspec); err != nil {
+		return err
+	}
+	if _, err := e.git(ctx, e.workdir, "diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	if _, err := e.git(ctx, e.workdir,
+		"-c", "user.name="+e.cfg.AuthorName,
+		"-c", "user.email="+e.cfg.AuthorEmail,
+		"commit", "--message", change.Message); err != nil {
+		return err
+	}
+	_, err := e.git(ctx, e.workdir, "push", "origin", "HEAD:refs/heads/"+e.cfg.Branch)
+	return err
+}
+
+// git runs the git CLI in dir. The credentials are passed through the
+// environment so that they don't show up in the process list.
+func (e *Exporter) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if e.cfg.TokenFile != "" {
+		token, err := ioutil.ReadFile(e.cfg.TokenFile)
+		if err != nil {
+			return "", ErrGit(err)
+		}
+		username := e.cfg.Username
+		if username == "" {
+			username = "git"
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + strings.TrimSpace(string(token))))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", ErrGit(fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String())))
+	}
+	return stdout.String(), nil
+}
+
+// writeChange writes and removes the files of the change under root
+func writeChange(root string, change Change) error {
+	for name, data := range change.Files {
+		path, err := within(root, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return ErrExport(err)
+		}
+		// The file is replaced at once so that a reader never sees it
+		// half written
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+			return ErrExport(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return ErrExport(err)
+		}
+	}
+	for _, name := range change.Removed {
+		path, err := within(root, name)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return ErrExport(err)
+		}
+	}
+	return nil
+}
+
+// within returns the path of name under root, names escaping root are
+// rejected
+func within(root, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", ErrExport(fmt.Errorf("%q is outside of the export directory", name))
+	}
+	return filepath.Join(root, clean), nil
+}
@@ -0,0 +1,104 @@
+package gitops
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithin(t *testing.T) {
+	root := filepath.FromSlash("/export")
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "cilium/values.yaml", want: filepath.Join(root, "cilium", "values.yaml")},
+		{name: "policies/../values.yaml", want: filepath.Join(root, "values.yaml")},
+		{name: "./values.yaml", want: filepath.Join(root, "values.yaml")},
+		{name: "..values.yaml", want: filepath.Join(root, "..values.yaml")},
+		{name: "../values.yaml", wantErr: true},
+		{name: "policies/../../values.yaml", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: ".", wantErr: true},
+		{name: "", wantErr: true},
+		{name: "/etc/passwd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := within(root, tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("within(%q) error = %v, want error %t", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("within(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteChange(t *testing.T) {
+	root, err := ioutil.TempDir("", "gitops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	stale := filepath.Join(root, "policies", "stale.yaml")
+	if err := os.MkdirAll(filepath.Dir(stale), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(stale, []byte("kind: CiliumNetworkPolicy"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	change := Change{
+		Files: map[string][]byte{
+			"cilium/values.yaml":  []byte("hubble:\n  enabled: true\n"),
+			"policies/allow.yaml": []byte("kind: CiliumNetworkPolicy"),
+		},
+		Removed: []string{"policies/stale.yaml", "policies/missing.yaml"},
+	}
+	if err := writeChange(root, change); err != nil {
+		t.Fatalf("writeChange() error = %s", err)
+	}
+
+	for name, want := range change.Files {
+		got, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("reading %s: %s", name, err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)) + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("the temporary file of %s was left behind", name)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("the removed file %s still exists", stale)
+	}
+}
+
+func TestWriteChangeOutsideTheExport(t *testing.T) {
+	root, err := ioutil.TempDir("", "gitops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	changes := []Change{
+		{Files: map[string][]byte{"../escaped.yaml": []byte("kind: CiliumNetworkPolicy")}},
+		{Removed: []string{"../escaped.yaml"}},
+	}
+	for _, change := range changes {
+		if err := writeChange(root, change); err == nil {
+			t.Errorf("writeChange() of %v returned no error", change)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escaped.yaml")); !os.IsNotExist(err) {
+		t.Error("a file was written outside of the export directory")
+	}
+}
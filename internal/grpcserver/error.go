@@ -0,0 +1,25 @@
+package grpcserver
+
+import (
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrServeCode represents the errors which are generated while
+	// serving the gRPC API
+	ErrServeCode = "1058"
+
+	// ErrLoadCertificatesCode represents the errors which are generated
+	// while loading the certificates of the gRPC server
+	ErrLoadCertificatesCode = "1059"
+)
+
+// ErrLoadCertificates is the error while loading the certificates of the gRPC server
+func ErrLoadCertificates(err error) error {
+	return errors.New(ErrLoadCertificatesCode, errors.Alert, []string{"Error loading gRPC server certificates"}, []string{err.Error()}, []string{"The certificate, key or CA is missing or invalid", "The adapter is not allowed to read the TLS Secret"}, []string{"Verify the GRPC_TLS_* settings of the adapter"})
+}
+
+// ErrServe is the error while serving the gRPC API
+func ErrServe(err error) error {
+	return errors.New(ErrServeCode, errors.Alert, []string{"Error serving gRPC API"}, []string{err.Error()}, []string{"The port is already in use"}, []string{"Verify the port the adapter listens on"})
+}
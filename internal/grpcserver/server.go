@@ -0,0 +1,203 @@
+// Package grpcserver serves the adapter's gRPC API. The server of the
+// adapter library only listens in plaintext and can't be stopped, this
+// package starts the same MeshService, optionally with TLS credentials
+// requiring the Meshery server to present a client certificate, and drains
+// it on shutdown.
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	adaptergrpc "github.com/layer5io/meshery-adapter-library/api/grpc"
+	"github.com/layer5io/meshery-adapter-library/meshes"
+	"github.com/layer5io/meshery-cilium/internal/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TLSConfig builds the server TLS configuration from the gRPC TLS settings
+func TLSConfig(cfg config.GRPCTLSConfig) (*tls.Config, error) {
+	certPEM, keyPEM, caPEM, err := loadPEM(cfg)
+	if err != nil {
+		return nil, ErrLoadCertificates(err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, ErrLoadCertificates(err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, ErrLoadCertificates(fmt.Errorf("no CA certificates found"))
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if cfg.RequireClientCert {
+		if tlsConfig.ClientCAs == nil {
+			return nil, ErrLoadCertificates(fmt.Errorf("client certificates are required but no CA is configured"))
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// loadPEM reads the certificate, key and CA bundle from the Secret or the
+// files of the settings
+func loadPEM(cfg config.GRPCTLSConfig) (cert, key, ca []byte, err error) {
+	if cfg.Secret != "" {
+		parts := strings.SplitN(cfg.Secret, "/", 2)
+		if len(parts) != 2 {
+			return nil, nil, nil, fmt.Errorf("invalid secret %q, expected namespace/name", cfg.Secret)
+		}
+		// The Secret lives in the cluster the adapter runs in, not in the
+		// one managed through the kubeconfig received from Meshery
+		client, err := mesherykube.New(nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		secret, err := client.KubeClient.CoreV1().Secrets(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return secret.Data["tls.crt"], secret.Data["tls.key"], secret.Data["ca.crt"], nil
+	}
+
+	if cert, err = ioutil.ReadFile(cfg.CertFile); err != nil {
+		return nil, nil, nil, err
+	}
+	if key, err = ioutil.ReadFile(cfg.KeyFile); err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg.CAFile != "" {
+		if ca, err = ioutil.ReadFile(cfg.CAFile); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return cert, key, ca, nil
+}
+
+// drainInterval is the interval at which Drain checks for calls in flight
+const drainInterval = 100 * time.Millisecond
+
+// Server serves the MeshService of the adapter and keeps track of the
+// unary calls in flight so that they are drained on shutdown
+type Server struct {
+	service *adaptergrpc.Service
+	server  *grpc.Server
+	health  *health.Server
+	calls   int64
+}
+
+// New creates the server of the MeshService of s, it mirrors the server
+// started by the adapter library and serves over TLS unless tlsConfig is nil
+func New(s *adaptergrpc.Service, tlsConfig *tls.Config) *Server {
+	srv := &Server{service: s}
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(middleware.ChainUnaryServer(
+			srv.track,
+			grpc_recovery.UnaryServerInterceptor(
+				grpc_recovery.WithRecoveryHandler(func(r interface{}) error {
+					return ErrServe(fmt.Errorf("panic: %v", r))
+				}),
+			),
+		)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv.server = grpc.NewServer(opts...)
+	reflection.Register(srv.server)
+	meshes.RegisterMeshServiceServer(srv.server, s)
+
+	// The standard health service lets load balancers and grpcurl probe
+	// the adapter, it reports NOT_SERVING until SetServing is called
+	srv.health = health.NewServer()
+	srv.SetServing(false)
+	healthpb.RegisterHealthServer(srv.server, srv.health)
+	return srv
+}
+
+// meshServiceName is the name of the MeshService in the health service
+const meshServiceName = "meshes.MeshService"
+
+// SetServing sets the status reported by the health service, for the
+// server as a whole and for the MeshService
+func (s *Server) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	s.health.SetServingStatus("", status)
+	s.health.SetServingStatus(meshServiceName, status)
+}
+
+func (s *Server) track(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	atomic.AddInt64(&s.calls, 1)
+	defer atomic.AddInt64(&s.calls, -1)
+	return handler(ctx, req)
+}
+
+// Serve listens on the port of the service until the server is stopped
+func (s *Server) Serve() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", s.service.Port))
+	if err != nil {
+		return ErrServe(err)
+	}
+	if err := s.server.Serve(listener); err != nil {
+		return ErrServe(err)
+	}
+	return nil
+}
+
+// Drain stops accepting calls and waits for the unary calls in flight, or
+// for ctx to be done. The event streams are kept open so that the pending
+// events still reach Meshery, Stop closes them.
+func (s *Server) Drain(ctx context.Context) error {
+	// The health checks report NOT_SERVING from now on, so that no new
+	// calls are routed to the adapter
+	s.health.Shutdown()
+
+	// The event streams never end on their own, GracefulStop only returns
+	// once Stop closed them
+	go s.server.GracefulStop()
+
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&s.calls) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Stop closes the connections and the event streams
+func (s *Server) Stop() {
+	s.server.Stop()
+}
@@ -0,0 +1,95 @@
+// Package health serves the liveness and readiness probes of the adapter.
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Paths of the probes
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// Conditions the adapter waits for before reporting ready
+const (
+	ConfigLoaded = "config"
+	Registered   = "registration"
+)
+
+// Checker tracks the conditions the readiness of the adapter depends on
+type Checker struct {
+	mu       sync.RWMutex
+	pending  map[string]bool
+	watchers []func(ready bool)
+}
+
+// New creates a Checker which reports ready once all of the given
+// conditions are met
+func New(conditions ...string) *Checker {
+	pending := map[string]bool{}
+	for _, c := range conditions {
+		pending[c] = true
+	}
+	return &Checker{pending: pending}
+}
+
+// Done marks a condition as met
+func (c *Checker) Done(condition string) {
+	c.mu.Lock()
+	_, wasPending := c.pending[condition]
+	delete(c.pending, condition)
+	ready := len(c.pending) == 0
+	watchers := append([]func(bool){}, c.watchers...)
+	c.mu.Unlock()
+
+	if wasPending && ready {
+		for _, w := range watchers {
+			w(true)
+		}
+	}
+}
+
+// Watch calls fn with the readiness of the adapter, right away and again
+// once it becomes ready
+func (c *Checker) Watch(fn func(ready bool)) {
+	c.mu.Lock()
+	c.watchers = append(c.watchers, fn)
+	ready := len(c.pending) == 0
+	c.mu.Unlock()
+	fn(ready)
+}
+
+// Pending returns the conditions which are not met yet
+func (c *Checker) Pending() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make([]string, 0, len(c.pending))
+	for condition := range c.pending {
+		res = append(res, condition)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Liveness reports the adapter alive as long as it serves HTTP requests
+func (c *Checker) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// Readiness reports the adapter ready once all conditions are met
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pending := c.Pending(); len(pending) > 0 {
+			http.Error(w, "waiting for: "+strings.Join(pending, ", "), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
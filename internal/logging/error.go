@@ -0,0 +1,16 @@
+package logging
+
+import (
+	"github.com/layer5io/meshkit/errors"
+)
+
+const (
+	// ErrLogFileCode represents the errors which are generated while
+	// opening, writing or rotating the log file
+	ErrLogFileCode = "1112"
+)
+
+// ErrLogFile is the error while opening, writing or rotating the log file
+func ErrLogFile(err error) error {
+	return errors.New(ErrLogFileCode, errors.Alert, []string{"Error writing log file"}, []string{err.Error()}, []string{"The directory of the log file is not writable", "The disk is full"}, []string{"Verify LOG_FILE and the permissions and free space of its directory"})
+}
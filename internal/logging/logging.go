@@ -0,0 +1,119 @@
+// Package logging builds the logger of the adapter from the logging
+// settings: the format and the level of the logs and the file they are
+// written to next to the standard output.
+package logging
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshkit/errors"
+	"github.com/layer5io/meshkit/logger"
+	"github.com/sirupsen/logrus"
+)
+
+var levels = map[string]logrus.Level{
+	config.LogLevelTrace: logrus.TraceLevel,
+	config.LogLevelDebug: logrus.DebugLevel,
+	config.LogLevelInfo:  logrus.InfoLevel,
+	config.LogLevelWarn:  logrus.WarnLevel,
+	config.LogLevelError: logrus.ErrorLevel,
+}
+
+// Logger is a logger.Handler honoring the logging settings. The methods it
+// doesn't override are served by the meshkit logger it wraps.
+type Logger struct {
+	logger.Handler
+	write *logrus.Entry
+}
+
+// New creates the logger of the application appname
+func New(appname string, cfg config.LoggingConfig) (*Logger, error) {
+	format := logger.SyslogLogFormat
+	if cfg.Format == config.LogFormatJSON {
+		format = logger.JsonLogFormat
+	}
+	level, ok := levels[cfg.Level]
+	if !ok {
+		level = logrus.InfoLevel
+	}
+	base, err := logger.New(appname, logger.Options{
+		Format:     format,
+		DebugLevel: level >= logrus.DebugLevel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log := logrus.New()
+	log.SetLevel(level)
+	var out io.Writer = os.Stdout
+	if cfg.File != "" {
+		file, err := openRotatingFile(cfg.File, cfg.MaxBytes, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = io.MultiWriter(os.Stdout, file)
+	}
+	log.SetOutput(out)
+
+	switch cfg.Format {
+	case config.LogFormatJSON:
+		log.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339})
+	case config.LogFormatTerminal:
+		// Colors only go to the terminal, not to the log file
+		log.SetFormatter(&logrus.TextFormatter{
+			ForceColors:     cfg.File == "",
+			FullTimestamp:   true,
+			TimestampFormat: time.Kitchen,
+		})
+	default:
+		log.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   true,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+		})
+	}
+
+	return &Logger{
+		Handler: base,
+		write:   log.WithFields(logrus.Fields{"app": appname}),
+	}, nil
+}
+
+// Trace logs at the most verbose level, below debug
+func (l *Logger) Trace(description ...interface{}) {
+	l.write.Log(logrus.TraceLevel, description...)
+}
+
+// Debug logs at debug level
+func (l *Logger) Debug(description ...interface{}) {
+	l.write.Log(logrus.DebugLevel, description...)
+}
+
+// Info logs at info level
+func (l *Logger) Info(description ...interface{}) {
+	l.write.Log(logrus.InfoLevel, description...)
+}
+
+// Warn logs err at warn level with its meshkit details
+func (l *Logger) Warn(err error) {
+	l.withDetails(err).Log(logrus.WarnLevel, err.Error())
+}
+
+// Error logs err at error level with its meshkit details
+func (l *Logger) Error(err error) {
+	l.withDetails(err).Log(logrus.ErrorLevel, err.Error())
+}
+
+func (l *Logger) withDetails(err error) *logrus.Entry {
+	return l.write.WithFields(logrus.Fields{
+		"code":                  errors.GetCode(err),
+		"severity":              errors.GetSeverity(err),
+		"short-description":     errors.GetSDescription(err),
+		"probable-cause":        errors.GetCause(err),
+		"suggested-remediation": errors.GetRemedy(err),
+	})
+}
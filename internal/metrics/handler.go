@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+)
+
+type adapterMetrics struct {
+	next adapter.Handler
+}
+
+// AddMetrics wraps an adapter handler to record the gRPC requests it
+// serves, all of which are delegated to the handler
+func AddMetrics(h adapter.Handler) adapter.Handler {
+	return &adapterMetrics{next: h}
+}
+
+func (s *adapterMetrics) GetName() string {
+	return s.next.GetName()
+}
+
+func (s *adapterMetrics) GetComponentInfo(svc interface{}) error {
+	start := time.Now()
+	err := s.next.GetComponentInfo(svc)
+	observeGRPC("ComponentInfo", start, err)
+	return err
+}
+
+func (s *adapterMetrics) CreateInstance(b []byte, st string, c *chan interface{}) error {
+	start := time.Now()
+	err := s.next.CreateInstance(b, st, c)
+	observeGRPC("CreateMeshInstance", start, err)
+	return err
+}
+
+func (s *adapterMetrics) ApplyOperation(ctx context.Context, op adapter.OperationRequest) error {
+	start := time.Now()
+	err := s.next.ApplyOperation(ctx, op)
+	observeGRPC("ApplyOperation", start, err)
+	return err
+}
+
+func (s *adapterMetrics) ProcessOAM(ctx context.Context, oamRequest adapter.OAMRequest) (string, error) {
+	start := time.Now()
+	msg, err := s.next.ProcessOAM(ctx, oamRequest)
+	observeGRPC("ProcessOAM", start, err)
+	return msg, err
+}
+
+func (s *adapterMetrics) ListOperations() (adapter.Operations, error) {
+	start := time.Now()
+	ops, err := s.next.ListOperations()
+	observeGRPC("SupportedOperations", start, err)
+	return ops, err
+}
+
+func (s *adapterMetrics) StreamErr(e *adapter.Event, err error) {
+	s.next.StreamErr(e, err)
+}
+
+func (s *adapterMetrics) StreamInfo(e *adapter.Event) {
+	s.next.StreamInfo(e)
+}
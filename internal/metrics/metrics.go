@@ -0,0 +1,97 @@
+// Package metrics exports the Prometheus metrics of the adapter: the
+// operations it ran, the registration of its components with Meshery and
+// the gRPC requests it served.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is the path under which the metrics are served
+const Path = "/metrics"
+
+const (
+	namespace = "meshery_cilium"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Number of operations run, by operation and result.",
+	}, []string{"operation", "result"})
+
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Time taken by operations to complete, by operation.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+	}, []string{"operation"})
+
+	registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Number of component registrations with the Meshery server, by kind and result.",
+	}, []string{"kind", "result"})
+
+	lastRegistration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_registration_timestamp_seconds",
+		Help:      "Time of the last successful component registration, by kind.",
+	}, []string{"kind"})
+
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Number of gRPC requests handled, by method and result.",
+	}, []string{"method", "result"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Time taken to handle gRPC requests, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(operations, operationDuration, registrations, lastRegistration, grpcRequests, grpcDuration)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+// ObserveOperation records the completion of an operation started at start
+func ObserveOperation(operation string, start time.Time, err error) {
+	operations.WithLabelValues(operation, result(err)).Inc()
+	operationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRegistration records the outcome of a component registration
+func ObserveRegistration(kind string, err error) {
+	registrations.WithLabelValues(kind, result(err)).Inc()
+	if err == nil {
+		lastRegistration.WithLabelValues(kind).SetToCurrentTime()
+	}
+}
+
+func observeGRPC(method string, start time.Time, err error) {
+	grpcRequests.WithLabelValues(method, result(err)).Inc()
+	grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
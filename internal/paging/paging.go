@@ -0,0 +1,85 @@
+// Package paging parses the pagination and filtering parameters of the list
+// APIs of the adapter, so that the responses stay bounded on large clusters.
+package paging
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultLimit is the page size used when none is requested
+	DefaultLimit = 500
+	// MaxLimit caps the page size a client can request
+	MaxLimit = 5000
+)
+
+// Params are the pagination and filtering parameters of a list request
+type Params struct {
+	// Limit is the maximum number of items returned
+	Limit int64
+	// Continue is the token returned with the previous page
+	Continue string
+	// Namespace restricts the items to a namespace
+	Namespace string
+	// LabelSelector and FieldSelector filter the items server-side
+	LabelSelector string
+	FieldSelector string
+}
+
+// Page is a page of a list response
+type Page struct {
+	Items interface{} `json:"items"`
+	// Continue is the token to request the next page with, empty on the
+	// last page
+	Continue string `json:"continue,omitempty"`
+	// Remaining is the number of items left after this page when known
+	Remaining *int64 `json:"remaining,omitempty"`
+}
+
+// Parse reads the parameters of a list request, limit defaults to
+// DefaultLimit and is capped at max
+func Parse(r *http.Request, max int64) (Params, error) {
+	q := r.URL.Query()
+	p := Params{
+		Limit:         DefaultLimit,
+		Continue:      q.Get("continue"),
+		Namespace:     q.Get("namespace"),
+		LabelSelector: q.Get("labelSelector"),
+		FieldSelector: q.Get("fieldSelector"),
+	}
+	if p.Limit > max {
+		p.Limit = max
+	}
+
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit <= 0 {
+			return p, fmt.Errorf("invalid limit %q", raw)
+		}
+		if limit > max {
+			limit = max
+		}
+		p.Limit = limit
+	}
+	return p, nil
+}
+
+// ListOptions returns the options listing a page of Kubernetes objects, the
+// API server paginates and filters them
+func (p Params) ListOptions() metav1.ListOptions {
+	return metav1.ListOptions{
+		Limit:         p.Limit,
+		Continue:      p.Continue,
+		LabelSelector: p.LabelSelector,
+		FieldSelector: p.FieldSelector,
+	}
+}
+
+// FromList returns the page of the items of a Kubernetes list
+func FromList(items interface{}, meta metav1.ListMeta) Page {
+	return Page{Items: items, Continue: meta.Continue, Remaining: meta.RemainingItemCount}
+}
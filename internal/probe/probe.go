@@ -0,0 +1,163 @@
+// Package probe evaluates the datapath features a node can run from its
+// kernel and the state reported by its Cilium agent. Cilium only reports
+// its probe results in the agent logs, this package turns them into a
+// capability matrix which can be queried before enabling a feature.
+package probe
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Feature names of the capability matrix
+const (
+	BPFHostRouting   = "bpfHostRouting"
+	WireGuard        = "wireguard"
+	BandwidthManager = "bandwidthManager"
+	BBR              = "bbr"
+	SocketLB         = "socketLB"
+)
+
+// Capability is the state of a feature on a node
+type Capability struct {
+	// Supported reports whether the kernel can run the feature
+	Supported bool `json:"supported"`
+	// Enabled reports whether the agent runs with the feature
+	Enabled bool `json:"enabled"`
+	// Reason explains why the feature is not supported
+	Reason string `json:"reason,omitempty"`
+}
+
+// NodeFeatures is the capability matrix of a node
+type NodeFeatures struct {
+	Node          string                `json:"node"`
+	KernelVersion string                `json:"kernelVersion"`
+	Features      map[string]Capability `json:"features"`
+	// Error is set when the agent of the node could not be queried, the
+	// matrix is then derived from the kernel version only
+	Error string `json:"error,omitempty"`
+}
+
+// Input is the data the features of a node are evaluated from
+type Input struct {
+	Node          string
+	KernelVersion string
+	// AgentStatus is the output of `cilium status --verbose`
+	AgentStatus string
+	// CongestionControl is the content of
+	// /proc/sys/net/ipv4/tcp_available_congestion_control
+	CongestionControl string
+}
+
+// kernel is a kernel version
+type kernel struct {
+	major, minor, patch int
+}
+
+var kernelVersion = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?`)
+
+func parseKernel(v string) (kernel, bool) {
+	m := kernelVersion.FindStringSubmatch(v)
+	if m == nil {
+		return kernel{}, false
+	}
+	k := kernel{}
+	k.major, _ = strconv.Atoi(m[1])
+	k.minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		k.patch, _ = strconv.Atoi(m[3])
+	}
+	return k, true
+}
+
+func (k kernel) atLeast(major, minor, patch int) bool {
+	if k.major != major {
+		return k.major > major
+	}
+	if k.minor != minor {
+		return k.minor > minor
+	}
+	return k.patch >= patch
+}
+
+// requirement is the minimum kernel of a feature
+type requirement struct {
+	major, minor, patch int
+}
+
+func (r requirement) String() string {
+	return fmt.Sprintf("%d.%d.%d", r.major, r.minor, r.patch)
+}
+
+var requirements = map[string]requirement{
+	BPFHostRouting:   {5, 10, 0},
+	WireGuard:        {5, 6, 0},
+	BandwidthManager: {5, 1, 0},
+	BBR:              {5, 18, 0},
+	SocketLB:         {4, 19, 57},
+}
+
+// Evaluate builds the capability matrix of a node
+func Evaluate(in Input) NodeFeatures {
+	res := NodeFeatures{
+		Node:          in.Node,
+		KernelVersion: in.KernelVersion,
+		Features:      map[string]Capability{},
+	}
+
+	k, ok := parseKernel(in.KernelVersion)
+	status := parseStatus(in.AgentStatus)
+	for feature, req := range requirements {
+		c := Capability{Supported: ok && k.atLeast(req.major, req.minor, req.patch)}
+		if !ok {
+			c.Reason = fmt.Sprintf("unknown kernel version %q", in.KernelVersion)
+		} else if !c.Supported {
+			c.Reason = fmt.Sprintf("requires kernel %s or newer", req)
+		}
+		res.Features[feature] = c
+	}
+
+	// Refine the kernel based results with what the agent detected
+	set := func(feature string, enabled bool) {
+		c := res.Features[feature]
+		c.Enabled = enabled
+		if enabled {
+			c.Supported, c.Reason = true, ""
+		}
+		res.Features[feature] = c
+	}
+	set(BPFHostRouting, strings.HasPrefix(status["Host Routing"], "BPF"))
+	set(WireGuard, strings.HasPrefix(status["Encryption"], "Wireguard"))
+	set(SocketLB, status["Socket LB"] == "Enabled" || strings.HasPrefix(status["KubeProxyReplacement"], "Strict"))
+	set(BandwidthManager, strings.HasPrefix(status["BandwidthManager"], "EDT"))
+	set(BBR, strings.Contains(status["BandwidthManager"], "BBR"))
+
+	if in.CongestionControl != "" && !strings.Contains(in.CongestionControl, "bbr") {
+		c := res.Features[BBR]
+		c.Supported = false
+		c.Reason = "the tcp_bbr module is not available"
+		res.Features[BBR] = c
+	}
+
+	return res
+}
+
+// parseStatus reads the "Key: value" lines of the agent status, including
+// the indented lines of the detail sections
+func parseStatus(out string) map[string]string {
+	res := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		if _, ok := res[key]; ok {
+			continue
+		}
+		res[key] = strings.TrimSpace(parts[1])
+	}
+	return res
+}
@@ -0,0 +1,53 @@
+// Package registration lets Meshery or an operator force the adapter to
+// re-register its dynamic capabilities, e.g. after a new Cilium release
+// shipped, instead of waiting for the periodic re-registration.
+package registration
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Path is the path the re-registration is triggered on
+const Path = "/registration"
+
+// Trigger delivers on-demand re-registration requests to the registration loop
+type Trigger struct {
+	ch chan struct{}
+}
+
+// NewTrigger creates a Trigger
+func NewTrigger() *Trigger {
+	// Requests received while one is pending are coalesced into it
+	return &Trigger{ch: make(chan struct{}, 1)}
+}
+
+// C is the channel the registration loop receives the requests on
+func (t *Trigger) C() <-chan struct{} {
+	return t.ch
+}
+
+// Fire requests a re-registration, it reports false when one is already pending
+func (t *Trigger) Fire() bool {
+	select {
+	case t.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// ServeHTTP requests a re-registration on POST
+func (t *Trigger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	if !t.Fire() {
+		fmt.Fprintln(w, "re-registration already pending")
+		return
+	}
+	fmt.Fprintln(w, "re-registration scheduled")
+}
@@ -14,27 +14,82 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	backoff "github.com/cenkalti/backoff/v4"
 	"github.com/layer5io/meshery-adapter-library/adapter"
 	"github.com/layer5io/meshery-adapter-library/api/grpc"
 	"github.com/layer5io/meshery-cilium/cilium"
 	"github.com/layer5io/meshery-cilium/cilium/oam"
+	"github.com/layer5io/meshery-cilium/internal/artifacts"
+	"github.com/layer5io/meshery-cilium/internal/compat"
 	"github.com/layer5io/meshery-cilium/internal/config"
+	"github.com/layer5io/meshery-cilium/internal/discovery"
+	"github.com/layer5io/meshery-cilium/internal/events"
+	"github.com/layer5io/meshery-cilium/internal/gitops"
+	"github.com/layer5io/meshery-cilium/internal/grpcserver"
+	"github.com/layer5io/meshery-cilium/internal/health"
+	"github.com/layer5io/meshery-cilium/internal/logging"
+	"github.com/layer5io/meshery-cilium/internal/metrics"
+	"github.com/layer5io/meshery-cilium/internal/registration"
+	meshkitcfg "github.com/layer5io/meshkit/config"
 	configprovider "github.com/layer5io/meshkit/config/provider"
 	"github.com/layer5io/meshkit/logger"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
 	"github.com/layer5io/meshkit/utils/manifests"
 	smp "github.com/layer5io/service-mesh-performance/spec"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// standaloneEventsBuffer is the number of events kept in standalone mode
+	standaloneEventsBuffer = 1000
+
+	defaultShutdownTimeout = 25 * time.Second
+
+	defaultDiscoveryInterval = 30 * time.Second
+	defaultDriftInterval     = 5 * time.Minute
+	defaultGCTTL             = 24 * time.Hour
+	defaultReplayInterval    = time.Minute
+
+	defaultGatewayAPICRDsURL = "https://github.com/kubernetes-sigs/gateway-api/releases/download/v0.5.1/standard-install.yaml"
+
+	// CiliumEgressGatewayPolicy replaced CiliumEgressNATPolicy in Cilium 1.12
+	defaultEgressGatewayCRDsURL = "https://raw.githubusercontent.com/cilium/cilium/v1.12.0/pkg/k8s/apis/cilium.io/client/crds/v2/ciliumegressgatewaypolicies.yaml"
+
+	// The chart leaves the policy CRDs to the operator, the clusterwide
+	// policies are registered from their CRD
+	defaultClusterwidePolicyCRDsURL = "https://raw.githubusercontent.com/cilium/cilium/v1.12.0/pkg/k8s/apis/cilium.io/client/crds/v2/ciliumclusterwidenetworkpolicies.yaml"
+
+	defaultLocalRedirectPolicyCRDsURL = "https://raw.githubusercontent.com/cilium/cilium/v1.12.0/pkg/k8s/apis/cilium.io/client/crds/v2/ciliumlocalredirectpolicies.yaml"
+
+	defaultEnvoyConfigCRDsURL = "https://raw.githubusercontent.com/cilium/cilium/v1.12.0/pkg/k8s/apis/cilium.io/client/crds/v2/ciliumenvoyconfigs.yaml," +
+		"https://raw.githubusercontent.com/cilium/cilium/v1.12.0/pkg/k8s/apis/cilium.io/client/crds/v2/ciliumclusterwideenvoyconfigs.yaml"
+
+	// CiliumBGPClusterConfig superseded CiliumBGPPeeringPolicy in Cilium 1.16
+	defaultBGPCRDsURL = "https://raw.githubusercontent.com/cilium/cilium/v1.12.0/pkg/k8s/apis/cilium.io/client/crds/v2alpha1/ciliumbgppeeringpolicies.yaml," +
+		"https://raw.githubusercontent.com/cilium/cilium/v1.16.0/pkg/k8s/apis/cilium.io/client/crds/v2alpha1/ciliumbgpclusterconfigs.yaml"
 )
 
 var (
 	serviceName = "cilium-adapter"
 	version     = "edge"
 	gitsha      = "none"
+
+	defaultTetragonCRDsURL = "https://raw.githubusercontent.com/cilium/tetragon/v" + config.DefaultTetragonVersion + "/pkg/k8s/apis/cilium.io/client/crds/v1alpha1/cilium.io_tracingpolicies.yaml"
 )
 
 func init() {
@@ -48,16 +103,43 @@ func init() {
 
 // main is the entrypoint of the adaptor
 func main() {
+	showVersion, err := parseFlags(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		// The flag set has already printed the error and the usage
+		os.Exit(2)
+	}
+	if showVersion {
+		printVersion(os.Stdout)
+		return
+	}
+
+	// Initialize application specific configs and dependencies
+	// App and request config
+	cfg, err := config.New(configprovider.ViperKey)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	// Initialize Logger instance
-	log, err := logger.New(serviceName, logger.Options{
-		Format:     logger.SyslogLogFormat,
-		DebugLevel: isDebug(),
-	})
+	logCfg, err := config.Logging(cfg)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	log, err := logging.New(serviceName, logCfg)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
+	// The kubeconfig of the user is only used in standalone mode, the
+	// adapter otherwise works with the kubeconfig received from Meshery, or
+	// with the in-cluster credentials until it is received
+	userKubeconfig := os.Getenv("KUBECONFIG")
 	err = os.Setenv("KUBECONFIG", path.Join(
 		config.KubeConfigDefaults[configprovider.FilePath],
 		fmt.Sprintf("%s.%s", config.KubeConfigDefaults[configprovider.FileName], config.KubeConfigDefaults[configprovider.FileType])),
@@ -68,20 +150,36 @@ func main() {
 		log.Warn(err)
 	}
 
-	// Initialize application specific configs and dependencies
-	// App and request config
-	cfg, err := config.New(configprovider.ViperKey)
+	service := &grpc.Service{}
+	err = cfg.GetObject(adapter.ServerKey, service)
 	if err != nil {
 		log.Error(err)
 		os.Exit(1)
 	}
 
-	service := &grpc.Service{}
-	err = cfg.GetObject(adapter.ServerKey, service)
+	mesheryServer, err := config.MesheryServer(cfg)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	client, err := oam.NewClient(mesheryServer)
 	if err != nil {
 		log.Error(err)
 		os.Exit(1)
 	}
+	// The charts and manifests of the components are downloaded with the
+	// default transport
+	config.UseProxy(mesheryServer.Proxy)
+	// The requests fail over between the discovered servers, which are
+	// discovered again once they all failed
+	if !isStandalone() {
+		discover := serverDiscovery(mesheryServer, log)
+		client.SetServers(discover(), discover)
+	}
+	if f := mesheryServer.Faults; f.Enabled() {
+		log.Info(fmt.Sprintf("Diagnostic mode: simulating Meshery server faults (5xx %.2f, timeout %.2f, slow %.2f, delay %s)", f.ServerErrorRate, f.TimeoutRate, f.SlowRate, f.Delay))
+	}
 
 	kubeconfigHandler, err := config.NewKubeconfigBuilder(configprovider.ViperKey)
 	if err != nil {
@@ -89,6 +187,43 @@ func main() {
 		os.Exit(1)
 	}
 
+	apiServer, err := config.APIServer(cfg)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	grpcTLS, err := config.GRPCTLS(cfg)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	store, err := artifacts.New(filepath.Join(config.RootPath(), "artifacts"), apiServer.ArtifactsMaxAge, apiServer.ArtifactsMaxBytes)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	gitOps, err := config.GitOps(cfg)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	var exporter *gitops.Exporter
+	if gitOps.Enabled() {
+		exporter = gitops.New(gitOps, filepath.Join(config.RootPath(), "gitops"))
+	}
+
+	// The timeouts are read by every operation, a mistake fails the start
+	if _, err := config.Timeouts(cfg); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	checker := health.New(health.ConfigLoaded, health.Registered)
+	checker.Done(health.ConfigLoaded)
+
 	// // Initialize Tracing instance
 	// tracer, err := tracing.New(service.Name, service.TraceURL)
 	// if err != nil {
@@ -97,42 +232,284 @@ func main() {
 	// }
 
 	// Initialize Handler intance
-	handler := cilium.New(cfg, log, kubeconfigHandler)
-	handler = adapter.AddLogger(log, handler)
+	// Without a Meshery server there are no other adapters to coordinate with
+	var coordinator *oam.Coordinator
+	if !isStandalone() {
+		coordinator = oam.NewCoordinator(client, client.Server(), mesheryServer.LockTimeout)
+	}
+	ciliumHandler := cilium.New(cfg, log, kubeconfigHandler, store, coordinator, exporter)
+	handler := metrics.AddMetrics(adapter.AddLogger(log, ciliumHandler))
+	if interval := discoveryInterval(); interval > 0 {
+		cilium.StartDiscovery(ciliumHandler, interval)
+	}
+	if interval := driftInterval(); interval > 0 {
+		cilium.StartDriftDetection(ciliumHandler, interval)
+	}
+	if interval := gcInterval(); interval > 0 {
+		cilium.StartGarbageCollection(ciliumHandler, interval, gcTTL())
+	}
 
-	service.Handler = handler
 	service.Channel = make(chan interface{}, 10)
+	// The repetitive events are coalesced into summaries before being
+	// streamed, for the categories listed in EVENTS_DIGEST
+	digest := events.NewDigest(service.Channel, config.ParseDigest(os.Getenv("EVENTS_DIGEST")))
+	go digest.Run()
+	service.Handler = events.AddDigest(handler, digest)
 	service.StartedAt = time.Now()
 	service.Version = version
 	service.GitSHA = gitsha
-	go registerCapabilities(service.Port, log)        //Registering static capabilities
-	go registerDynamicCapabilities(service.Port, log) //Registering latest capabilities periodically
+
+	// HTTP API Initialization
+	mux := http.NewServeMux()
+	if isStandalone() {
+		// Nothing is registered and the events are buffered until they
+		// are polled over HTTP instead of streamed to Meshery
+		log.Info("Running standalone, skipping the registration with Meshery")
+		checker.Done(health.Registered)
+		buffer := events.NewBuffer(standaloneEventsBuffer)
+		go buffer.Drain(service.Channel)
+		mux.Handle(events.Path, buffer)
+		if err := createLocalInstance(ciliumHandler, userKubeconfig, digest.Channel()); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	} else {
+		if userKubeconfig == "" && inCluster() {
+			// Work with the service account until Meshery connects with
+			// a kubeconfig, so that the APIs relying on the cluster are
+			// served out of the box
+			log.Info("No kubeconfig supplied, using the in-cluster service account")
+			if err := createLocalInstance(ciliumHandler, "", digest.Channel()); err != nil {
+				log.Warn(err)
+			}
+		}
+		trigger := registration.NewTrigger()
+		mux.Handle(registration.Path, trigger)
+		go registerCapabilities(client, mesheryServer, service.Port, log, *digest.Channel(), checker) //Registering static capabilities
+		// Only the latest configuration matters, a pending one is replaced
+		reload := make(chan config.MesheryServerConfig, 1)
+		go registerDynamicCapabilities(client, mesheryServer, service.Port, log, *digest.Channel(), trigger, ciliumHandler, reload) //Registering latest capabilities periodically
+		go replayRegistrations(client, log, *digest.Channel(), replayInterval())                                                    //Replaying the registrations queued while Meshery was unreachable
+		go watchConfig(context.Background(), cfg, client, log, *digest.Channel(), reload)
+	}
+	mux.Handle(cilium.FeaturesPath, cilium.FeaturesHandler(ciliumHandler))
+	mux.Handle(cilium.ReportsPrefix, cilium.ReportsHandler(ciliumHandler))
+	mux.Handle(cilium.MeshStatusPath, cilium.MeshStatusHandler(ciliumHandler))
+	mux.Handle(cilium.DiscoveryPath, cilium.DiscoveryHandler(ciliumHandler))
+	mux.Handle(compat.Path, cilium.CompatibilityHandler(ciliumHandler, compat.New(version, gitsha)))
+	mux.Handle(metrics.Path, metrics.Handler())
+	mux.Handle(health.LivenessPath, checker.Liveness())
+	mux.Handle(health.ReadinessPath, checker.Readiness())
+	httpServer := &http.Server{Addr: ":" + apiServer.Port, Handler: mux}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Info("HTTP API Listening at port: ", apiServer.Port)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error(err)
+		}
+	}()
 
 	// Server Initialization
-	log.Info("Adaptor Listening at port: ", service.Port)
-	err = grpc.Start(service, nil)
-	if err != nil {
+	var tlsConfig *tls.Config
+	if grpcTLS.Enabled() {
+		tlsConfig, err = grpcserver.TLSConfig(grpcTLS)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	}
+	// The artifacts are only served to the clients of the gRPC API
+	artifactsMux := http.NewServeMux()
+	artifactsMux.Handle(artifacts.Prefix, store)
+	artifactsServer := &http.Server{Addr: apiServer.ArtifactsAddress, Handler: artifactsMux, TLSConfig: tlsConfig}
+	go func() {
+		log.Info("Artifacts served at: ", apiServer.ArtifactsAddress)
+		var err error
+		if tlsConfig != nil {
+			err = artifactsServer.ListenAndServeTLS("", "")
+		} else {
+			err = artifactsServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Error(err)
+		}
+	}()
+
+	grpcServer := grpcserver.New(service, tlsConfig)
+	// The health service of the gRPC server reports the readiness of the adapter
+	checker.Watch(grpcServer.SetServing)
+	go func() {
+		log.Info("Adaptor Listening at port: ", service.Port)
+		serveErr <- grpcServer.Serve()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			log.Error(err)
+		}
+		os.Exit(1)
+	case sig := <-signals:
+		log.Info("Received ", sig, ", shutting down")
+	}
+
+	if err := shutdown(log, grpcServer, []*http.Server{httpServer, artifactsServer}, ciliumHandler, digest, service.Channel); err != nil {
 		log.Error(err)
 		os.Exit(1)
 	}
+	log.Info("Shutdown complete")
 }
 
-func isDebug() bool {
-	return os.Getenv("DEBUG") == "true"
+// shutdown stops accepting calls, cancels the running operations and waits
+// for their final events to be streamed before closing the servers. It
+// fails when the calls or the operations don't end within the timeout.
+func shutdown(log logger.Handler, grpcServer *grpcserver.Server, httpServers []*http.Server, h adapter.Handler, digest *events.Digest, ch chan interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	defer grpcServer.Stop()
+
+	if err := grpcServer.Drain(ctx); err != nil {
+		return err
+	}
+	if ciliumHandler, ok := h.(*cilium.Handler); ok {
+		if err := ciliumHandler.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	// Nothing consumes the events while Meshery is not streaming them, they
+	// are then lost rather than failing the shutdown
+	if err := digest.Stop(ctx); err != nil {
+		log.Warn(fmt.Errorf("the pending event digests were not delivered before the shutdown timeout: %s", err))
+	}
+	if err := events.Flush(ctx, ch); err != nil {
+		log.Warn(fmt.Errorf("%d events were not delivered before the shutdown timeout: %s", len(ch), err))
+	}
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Warn(err)
+		}
+	}
+	return nil
+}
+
+// shutdownTimeout bounds the time given to the running operations to stop
+// and stream their result, within the default termination grace period of
+// Kubernetes pods
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultShutdownTimeout
 }
 
-func mesheryServerAddress() string {
-	meshReg := os.Getenv("MESHERY_SERVER")
+// discoveryInterval is the interval at which the Cilium resources of the
+// cluster are discovered, 0 disables the discovery
+func discoveryInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DISCOVERY_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultDiscoveryInterval
+}
+
+// driftInterval is the interval at which the cluster is checked for drift
+// from the state applied through the adapter, 0 disables the check
+func driftInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DRIFT_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultDriftInterval
+}
+
+// gcInterval is the interval at which the stale test resources deployed by
+// the adapter are removed, 0 disables the garbage collection
+func gcInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("GC_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return 0
+}
 
-	if meshReg != "" {
-		if strings.HasPrefix(meshReg, "http") {
-			return meshReg
+// gcTTL is the age at which a test resource deployed by the adapter is stale
+func gcTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("GC_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultGCTTL
+}
+
+// replayInterval is the interval at which the queued registrations are
+// replayed
+func replayInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("REGISTRATION_REPLAY_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultReplayInterval
+}
+
+// isStandalone reports whether the adapter runs without a Meshery server,
+// e.g. for local development
+func isStandalone() bool {
+	return os.Getenv("STANDALONE") == "true"
+}
+
+// createLocalInstance configures the handler as Meshery would when
+// connecting to the adapter, with the kubeconfig found at kubeconfigPath or
+// at the default path, falling back to the credentials of the service
+// account when the adapter is deployed in the cluster without a kubeconfig
+func createLocalInstance(h adapter.Handler, kubeconfigPath string, ch *chan interface{}) error {
+	if kubeconfigPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
 		}
+		kubeconfigPath = filepath.Join(home, ".kube", "config")
+	}
+	// The first path of a KUBECONFIG list is used
+	kubeconfigPath = filepath.SplitList(kubeconfigPath)[0]
 
-		return "http://" + meshReg
+	// #nosec
+	kubeconfig, err := ioutil.ReadFile(kubeconfigPath)
+	if os.IsNotExist(err) && inCluster() {
+		// An empty kubeconfig makes the handler use the in-cluster config
+		return h.CreateInstance(nil, "", ch)
+	}
+	if err != nil {
+		return err
 	}
+	return h.CreateInstance(kubeconfig, os.Getenv("KUBE_CONTEXT"), ch)
+}
 
-	return "http://localhost:9081"
+// inCluster reports whether the adapter runs in a pod with the credentials
+// of a service account mounted
+func inCluster() bool {
+	_, err := rest.InClusterConfig()
+	return err == nil
+}
+
+// serverDiscovery discovers the addresses of the Meshery servers from the
+// sources of cfg, the current context of mesheryctl is looked up when no
+// address is set
+func serverDiscovery(cfg config.MesheryServerConfig, log logger.Handler) func() []string {
+	opts := discovery.Options{
+		Addresses:        cfg.Addresses,
+		DNSName:          cfg.DiscoveryDNS,
+		Selector:         cfg.DiscoverySelector,
+		Namespace:        cfg.DiscoveryNamespace,
+		MesheryctlConfig: cfg.MesheryctlConfig,
+	}
+	if len(opts.Addresses) == 0 && opts.MesheryctlConfig == "" {
+		opts.MesheryctlConfig = discovery.DefaultMesheryctlConfig()
+	}
+	return func() []string {
+		addrs, err := discovery.Discover(context.Background(), opts)
+		if err != nil {
+			log.Warn(err)
+		}
+		log.Info("Meshery servers: ", strings.Join(addrs, ", "))
+		return addrs
+	}
 }
 
 func serviceAddress() string {
@@ -145,58 +522,374 @@ func serviceAddress() string {
 	return "localhost"
 }
 
-func registerCapabilities(port string, log logger.Handler) {
+// retryRegistration runs register until it succeeds, backing off
+// exponentially with jitter between the attempts so that an adapter started
+// before the Meshery server registers once the server comes up
+func retryRegistration(cfg config.MesheryServerConfig, log logger.Handler, ch chan<- interface{}, name string, register func() error) error {
+	expBackoff := backoff.NewExponentialBackOff()
+	expBackoff.InitialInterval = 5 * time.Second
+	expBackoff.MaxInterval = cfg.RegistrationMaxBackoff
+	expBackoff.MaxElapsedTime = 0
+
+	var b backoff.BackOff = expBackoff
+	if cfg.RegistrationMaxAttempts > 0 {
+		b = backoff.WithMaxRetries(b, uint64(cfg.RegistrationMaxAttempts-1))
+	}
+
+	err := backoff.RetryNotify(func() error {
+		err := register()
+		// Only the unreachable and failing servers are retried, retrying
+		// doesn't fix the CRDs, the credentials or a rejected request, and
+		// the queued registrations are replayed once the server is reachable
+		if err != nil && !oam.Retryable(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, b, func(err error, next time.Duration) {
+		details := fmt.Sprintf("Registering %s failed, retrying in %s: %s", name, next.Round(time.Second), err)
+		log.Info(details)
+		// The retries are logged even when the events are not consumed
+		events.Emit(ch, events.Event{
+			Severity:    events.SeverityWarning,
+			Summary:     events.RegistrationRetrySummary + name,
+			Details:     details,
+			Remediation: []string{"Check that the Meshery server is reachable from the adapter"},
+		})
+	})
+	// The queued registrations are replayed later on, and the servers
+	// without models fall back to the OAM definitions
+	if err != nil && err != oam.ErrRegistrationQueued && err != oam.ErrModelsUnsupported && err != oam.ErrWorkloadDeletionUnsupported {
+		events.Emit(ch, events.Event{
+			Severity: events.SeverityError,
+			Summary:  fmt.Sprintf("Registration of %s failed", name),
+			Err:      err,
+		})
+	}
+	return err
+}
+
+// registerCapabilities registers the static capabilities, the adapter only
+// reports ready once the registration succeeded
+func registerCapabilities(client *oam.Client, cfg config.MesheryServerConfig, port string, log logger.Handler, ch chan<- interface{}, checker *health.Checker) {
+	err := retryRegistration(cfg, log, ch, "static capabilities", func() error {
+		return registerStaticCapabilities(client, port, log)
+	})
+	// The queued capabilities are delivered by the replay
+	if err != nil && err != oam.ErrRegistrationQueued {
+		log.Error(err)
+		return
+	}
+	if err == oam.ErrRegistrationQueued {
+		log.Info("Static capabilities queued until the Meshery server is reachable")
+	}
+	checker.Done(health.Registered)
+}
+
+// replayRegistrations replays the registrations queued while the Meshery
+// server was unreachable every interval, and announces them once delivered
+func replayRegistrations(client *oam.Client, log logger.Handler, ch chan<- interface{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if oam.QueuedRegistrations() == 0 {
+			continue
+		}
+		replayed, err := client.Replay()
+		if err != nil {
+			log.Info("Replaying the queued registrations: ", err.Error())
+		}
+		if replayed == 0 {
+			continue
+		}
+		details := fmt.Sprintf("%d registrations queued while the Meshery server was unreachable were replayed, %d remain queued.", replayed, oam.QueuedRegistrations())
+		log.Info(details)
+		// The replay is logged even when the events are not consumed
+		events.Emit(ch, events.Event{Severity: events.SeverityInfo, Summary: "Queued registrations replayed", Details: details})
+	}
+}
+
+func registerStaticCapabilities(client *oam.Client, port string, log logger.Handler) error {
 	// Register workloads
 	log.Info("Registering static workloads...")
-	if err := oam.RegisterWorkloads(mesheryServerAddress(), serviceAddress()+":"+port); err != nil {
-		log.Info(err.Error())
+	err := oam.RegisterWorkloads(client, client.Server(), serviceAddress()+":"+port)
+	metrics.ObserveRegistration("static_workloads", err)
+	if err != nil {
+		return err
 	}
 	log.Info("Registering static workloads completed")
 	// Register traits
-	if err := oam.RegisterTraits(mesheryServerAddress(), serviceAddress()+":"+port); err != nil {
-		log.Info(err.Error())
-	}
+	err = oam.RegisterTraits(client, client.Server(), serviceAddress()+":"+port)
+	metrics.ObserveRegistration("traits", err)
+	return err
 }
 
-func registerDynamicCapabilities(port string, log logger.Handler) {
-	registerWorkloads(port, log)
+func registerDynamicCapabilities(client *oam.Client, cfg config.MesheryServerConfig, port string, log logger.Handler, ch chan<- interface{}, trigger *registration.Trigger, h adapter.Handler, reload <-chan config.MesheryServerConfig) {
+	registerWorkloads(client, cfg, port, log, ch, h)
 	//Start the ticker
-	const reRegisterAfter = 24
-	ticker := time.NewTicker(reRegisterAfter * time.Hour)
+	ticker := time.NewTicker(cfg.ReRegisterInterval)
 	for {
-		<-ticker.C
-		registerWorkloads(port, log)
+		select {
+		case <-ticker.C:
+			// The periodic registration publishes everything again, in
+			// case the server lost the components published before
+			if err := oam.ForgetPublished(); err != nil {
+				log.Error(err)
+			}
+		case <-trigger.C():
+			log.Info("Re-registration requested")
+		case cfg = <-reload:
+			// The components source, versions or interval may have changed
+			ticker.Stop()
+			ticker = time.NewTicker(cfg.ReRegisterInterval)
+			log.Info("Re-registering with the reloaded configuration")
+		}
+		registerWorkloads(client, cfg, port, log, ch, h)
 	}
+}
+
+// watchConfig applies the edits of the Meshery server settings in the
+// config file to the client and to the registration, and announces them
+func watchConfig(ctx context.Context, cfg meshkitcfg.Handler, client *oam.Client, log logger.Handler, ch chan interface{}, reload chan config.MesheryServerConfig) {
+	watcher := config.NewWatcher(cfg, config.ReloadableKeys, config.DefaultWatchInterval)
+	watcher.Watch(ctx, func(keys []string) {
+		mesheryServer, err := config.MesheryServer(cfg)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if err := client.Reconfigure(mesheryServer); err != nil {
+			log.Error(err)
+			return
+		}
+		config.UseProxy(mesheryServer.Proxy)
+		discover := serverDiscovery(mesheryServer, log)
+		client.SetServers(discover(), discover)
+		sendLatest(reload, mesheryServer)
+
+		details := fmt.Sprintf("The %s settings were reloaded from the config file.", strings.Join(keys, ", "))
+		log.Info(details)
+		// The change is logged even when the events are not consumed
+		events.Emit(ch, events.Event{Severity: events.SeverityInfo, Summary: "Adapter configuration reloaded", Details: details})
+	}, func(err error) {
+		log.Error(err)
+	})
+}
 
+// sendLatest hands cfg to the registration without blocking the watcher
+// while a registration runs, a configuration not yet picked up is stale
+// and dropped in favor of cfg
+func sendLatest(reload chan config.MesheryServerConfig, cfg config.MesheryServerConfig) {
+	for {
+		select {
+		case reload <- cfg:
+			return
+		default:
+		}
+		select {
+		case <-reload:
+		default:
+		}
+	}
 }
-func registerWorkloads(port string, log logger.Handler) {
-	var url string
-	var gm string
+
+func registerWorkloads(client *oam.Client, cfg config.MesheryServerConfig, port string, log logger.Handler, ch chan<- interface{}, h adapter.Handler) {
+	cilium.AnnounceOutdated(h, compat.New(version, gitsha))
 
 	//If a URL is passed from env variable, it will be used for component generation with default method being "using manifests"
 	// In case a helm chart URL is passed, COMP_GEN_METHOD env variable should be set to Helm otherwise the component generation fails
-	if os.Getenv("COMP_GEN_URL") != "" {
-		url = os.Getenv("COMP_GEN_URL")
-		if os.Getenv("COMP_GEN_METHOD") == "Helm" || os.Getenv("COMP_GEN_METHOD") == "Manifest" {
-			gm = os.Getenv("COMP_GEN_METHOD")
-		} else {
-			gm = adapter.Manifests
+	// The URL can also be a file:// URL or an absolute path to a local manifest, directory of manifests or chart for air-gapped clusters
+	// An oci:// reference pulls the chart from an OCI registry with the COMP_GEN_REGISTRY_* credentials
+	if url := cfg.ComponentsURL; url != "" {
+		gm := adapter.Manifests
+		switch {
+		case cfg.ComponentsMethod == "Helm", cfg.ComponentsMethod == adapter.HelmCHARTS:
+			gm = adapter.HelmCHARTS
+		// OCI registries only hold charts
+		case strings.HasPrefix(url, "oci://"):
+			gm = adapter.HelmCHARTS
 		}
 		log.Info("Registering workload components from url ", url, " using ", gm, " method...")
+		registerCiliumWorkloads(client, cfg, port, log, ch, url, gm, version)
 	} else {
-		log.Info("Registering latest workload components for version ", version)
-		//default way
-		url = "https://raw.githubusercontent.com/cilium/cilium/" + version + "/install/kubernetes/cilium/Chart.yaml"
-		gm = adapter.Manifests
+		//default way, the components of every supported version are
+		// generated and registered concurrently
+		versions := append([]string{}, cfg.ComponentVersions...)
+		if cfg.ReleaseChannel != "" {
+			if v, err := config.ChannelVersion(cfg.ReleaseChannel); err != nil {
+				log.Error(err)
+			} else {
+				log.Info("The ", cfg.ReleaseChannel, " release channel points at version ", v)
+				versions = appendVersion(versions, v)
+				cilium.AnnounceUpgrade(h, cfg.ReleaseChannel, v)
+			}
+		}
+		if len(versions) == 0 {
+			versions = []string{version}
+		}
+		// The components of the versions the cluster can't run reference
+		// APIs it doesn't serve
+		if kubernetes := clusterKubernetesVersion(); kubernetes != "" {
+			compatible, skipped := config.KubernetesCompatible(versions, kubernetes)
+			if len(skipped) > 0 {
+				details := fmt.Sprintf("The components of Cilium %s are not registered, they don't support Kubernetes %s which the cluster runs.", strings.Join(skipped, ", "), kubernetes)
+				log.Info(details)
+				events.Emit(ch, events.Event{
+					Severity:    events.SeverityWarning,
+					Summary:     "Cilium versions skipped for Kubernetes " + kubernetes,
+					Details:     details,
+					Remediation: []string{"Set CILIUM_COMPONENT_VERSIONS to the Cilium versions supporting the Kubernetes version of the cluster"},
+				})
+			}
+			versions = compatible
+		}
+		var wg sync.WaitGroup
+		for _, v := range versions {
+			wg.Add(1)
+			go func(v string) {
+				defer wg.Done()
+				log.Info("Registering latest workload components for version ", v)
+				url := "https://raw.githubusercontent.com/cilium/cilium/" + v + "/install/kubernetes/cilium/Chart.yaml"
+				registerCiliumWorkloads(client, cfg, port, log, ch, url, adapter.Manifests, v)
+			}(v)
+		}
+		wg.Wait()
 	}
-	// Register workloads
-	if err := adapter.RegisterWorkLoadsDynamically(mesheryServerAddress(), serviceAddress()+":"+port, &adapter.DynamicComponentsConfig{
-		TimeoutInMinutes: 30,
+
+	egressURL := os.Getenv("EGRESS_GATEWAY_CRDS_URL")
+	if egressURL == "" {
+		egressURL = defaultEgressGatewayCRDsURL
+	}
+	log.Info("Registering egress gateway components from ", egressURL)
+	err := retryRegistration(cfg, log, ch, "egress gateway components", func() error {
+		err := oam.RegisterEgressGatewayWorkloads(client, client.Server(), serviceAddress()+":"+port, egressURL, version)
+		metrics.ObserveRegistration("egress_gateway_workloads", err)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+	} else {
+		log.Info("Egress gateway components successfully registered.")
+	}
+
+	clusterwideURL := os.Getenv("CLUSTERWIDE_POLICY_CRDS_URL")
+	if clusterwideURL == "" {
+		clusterwideURL = defaultClusterwidePolicyCRDsURL
+	}
+	log.Info("Registering clusterwide policy components from ", clusterwideURL)
+	err = retryRegistration(cfg, log, ch, "clusterwide policy components", func() error {
+		err := oam.RegisterClusterwidePolicyWorkloads(client, client.Server(), serviceAddress()+":"+port, clusterwideURL, version)
+		metrics.ObserveRegistration("clusterwide_policy_workloads", err)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+	} else {
+		log.Info("Clusterwide policy components successfully registered.")
+	}
+
+	lrpURL := os.Getenv("LOCAL_REDIRECT_POLICY_CRDS_URL")
+	if lrpURL == "" {
+		lrpURL = defaultLocalRedirectPolicyCRDsURL
+	}
+	log.Info("Registering local redirect policy components from ", lrpURL)
+	err = retryRegistration(cfg, log, ch, "local redirect policy components", func() error {
+		err := oam.RegisterLocalRedirectPolicyWorkloads(client, client.Server(), serviceAddress()+":"+port, lrpURL, version)
+		metrics.ObserveRegistration("local_redirect_policy_workloads", err)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+	} else {
+		log.Info("Local redirect policy components successfully registered.")
+	}
+
+	envoyURL := os.Getenv("ENVOY_CONFIG_CRDS_URL")
+	if envoyURL == "" {
+		envoyURL = defaultEnvoyConfigCRDsURL
+	}
+	log.Info("Registering Envoy configuration components from ", envoyURL)
+	err = retryRegistration(cfg, log, ch, "Envoy configuration components", func() error {
+		err := oam.RegisterEnvoyConfigWorkloads(client, client.Server(), serviceAddress()+":"+port, envoyURL, version)
+		metrics.ObserveRegistration("envoy_config_workloads", err)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+	} else {
+		log.Info("Envoy configuration components successfully registered.")
+	}
+
+	bgpURL := os.Getenv("BGP_CRDS_URL")
+	if bgpURL == "" {
+		bgpURL = defaultBGPCRDsURL
+	}
+	log.Info("Registering BGP components from ", bgpURL)
+	err = retryRegistration(cfg, log, ch, "BGP components", func() error {
+		err := oam.RegisterBGPWorkloads(client, client.Server(), serviceAddress()+":"+port, bgpURL, version)
+		metrics.ObserveRegistration("bgp_workloads", err)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+	} else {
+		log.Info("BGP components successfully registered.")
+	}
+
+	tetragonURL := os.Getenv("TETRAGON_CRDS_URL")
+	if tetragonURL == "" {
+		tetragonURL = defaultTetragonCRDsURL
+	}
+	log.Info("Registering Tetragon components from ", tetragonURL)
+	err = retryRegistration(cfg, log, ch, "Tetragon components", func() error {
+		err := oam.RegisterTetragonWorkloads(client, client.Server(), serviceAddress()+":"+port, tetragonURL, config.DefaultTetragonVersion)
+		metrics.ObserveRegistration("tetragon_workloads", err)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+	} else {
+		log.Info("Tetragon components successfully registered.")
+	}
+
+	if !gatewayAPIInstalled() {
+		return
+	}
+	gatewayURL := os.Getenv("GATEWAY_API_CRDS_URL")
+	if gatewayURL == "" {
+		gatewayURL = defaultGatewayAPICRDsURL
+	}
+	log.Info("Gateway API CRDs detected, registering Gateway API components from ", gatewayURL)
+	err = retryRegistration(cfg, log, ch, "Gateway API components", func() error {
+		err := oam.RegisterGatewayAPIWorkloads(client, client.Server(), serviceAddress()+":"+port, gatewayURL, version)
+		metrics.ObserveRegistration("gateway_api_workloads", err)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	log.Info("Gateway API components successfully registered.")
+}
+
+func appendVersion(versions []string, v string) []string {
+	for _, cur := range versions {
+		if cur == v {
+			return versions
+		}
+	}
+	return append(versions, v)
+}
+
+// registerCiliumWorkloads generates the Cilium components of a version
+// from url and registers them
+func registerCiliumWorkloads(client *oam.Client, cfg config.MesheryServerConfig, port string, log logger.Handler, ch chan<- interface{}, url, gm, ver string) {
+	dc := &adapter.DynamicComponentsConfig{
+		TimeoutInMinutes: cfg.ComponentsTimeoutInMinutes(),
 		URL:              url,
 		GenerationMethod: gm,
 		Config: manifests.Config{
 			Name:        smp.ServiceMesh_Type_name[int32(smp.ServiceMesh_CILIUM_SERVICE_MESH)],
-			MeshVersion: version,
+			MeshVersion: ver,
 			Filter: manifests.CrdFilter{
 				RootFilter:    []string{"$[?(@.kind==\"CustomResourceDefinition\")]"},
 				NameFilter:    []string{"$..[\"spec\"][\"names\"][\"kind\"]"},
@@ -210,9 +903,70 @@ func registerWorkloads(port string, log logger.Handler) {
 			},
 		},
 		Operation: config.CiliumOperation,
-	}); err != nil {
-		log.Info(err.Error())
+	}
+	err := retryRegistration(cfg, log, ch, "workload components for version "+ver, func() error {
+		err := oam.RegisterWorkloadsDynamically(client, client.Server(), serviceAddress()+":"+port, dc)
+		metrics.ObserveRegistration("workloads", err)
+		return err
+	})
+	if err == oam.ErrWorkloadDeletionUnsupported {
+		log.Info("The Meshery server doesn't support removing components, the components version ", ver, " no longer ships stay registered")
+		err = nil
+	}
+	if err != nil {
+		log.Error(err)
 		return
 	}
-	log.Info("Latest workload components successfully registered.")
+	log.Info("Latest workload components for version ", ver, " successfully registered.")
+
+	// Newer Meshery servers keep the components in their registry of
+	// models, the OAM definitions above remain for the older ones
+	err = retryRegistration(cfg, log, ch, "model for version "+ver, func() error {
+		err := oam.RegisterModel(client, client.Server(), serviceAddress()+":"+port, dc)
+		metrics.ObserveRegistration("model", err)
+		return err
+	})
+	switch {
+	case err == oam.ErrModelsUnsupported:
+		log.Info("The Meshery server doesn't support models, only the OAM definitions are registered")
+	case err != nil:
+		log.Error(err)
+	default:
+		log.Info("Cilium model for version ", ver, " successfully registered.")
+	}
+}
+
+// clusterKubernetesVersion returns the Kubernetes version of the cluster
+// described by the kubeconfig received from Meshery, empty when it isn't
+// reachable
+func clusterKubernetesVersion() string {
+	client, err := mesherykube.New(nil)
+	if err != nil {
+		return ""
+	}
+	server, err := client.KubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return ""
+	}
+	return server.GitVersion
+}
+
+// gatewayAPIInstalled reports whether the cluster described by the
+// kubeconfig received from Meshery serves the Gateway API
+func gatewayAPIInstalled() bool {
+	client, err := mesherykube.New(nil)
+	if err != nil {
+		return false
+	}
+
+	groups, err := client.KubeClient.Discovery().ServerGroups()
+	if err != nil {
+		return false
+	}
+	for _, group := range groups.Groups {
+		if group.Name == "gateway.networking.k8s.io" {
+			return true
+		}
+	}
+	return false
 }